@@ -0,0 +1,323 @@
+// Command agent runs planemgr deploys on networks the server can't reach.
+// It registers with the server over an outbound connection, polls for the
+// deploy jobs routed to its labels and runs up to AGENT_CAPACITY of them at
+// once in the local docker runner.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/mtolmacs/planemgr/internal/server/deploy"
+)
+
+const (
+	// pollTimeout leaves the server time to end its 30 second long poll. It
+	// bounds every request but gates.
+	pollTimeout = 45 * time.Second
+	// gateTimeout bounds waiting for the server to evaluate a gate, which
+	// may wait on run tasks for up to an hour.
+	gateTimeout  = 2 * time.Hour
+	retryDelay   = 5 * time.Second
+	resultTries  = 5
+	agentAPIPath = "/api/agent"
+)
+
+var errAgentUnknown = errors.New("Agent is not registered")
+
+func main() {
+	loadEnvFiles()
+
+	serverURL := strings.TrimRight(strings.TrimSpace(os.Getenv("AGENT_SERVER_URL")), "/")
+	if _, err := url.Parse(serverURL); err != nil || serverURL == "" {
+		log.Fatalf("AGENT_SERVER_URL must be set to the planemgr server URL")
+	}
+	username := os.Getenv("AGENT_USERNAME")
+	password := os.Getenv("AGENT_PASSWORD")
+	if username == "" || password == "" {
+		log.Fatalf("AGENT_USERNAME and AGENT_PASSWORD must be set")
+	}
+	name := strings.TrimSpace(os.Getenv("AGENT_NAME"))
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+
+	capacity := 1
+	if value := strings.TrimSpace(os.Getenv("AGENT_CAPACITY")); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			log.Fatalf("AGENT_CAPACITY must be a positive number")
+		}
+		capacity = parsed
+	}
+
+	if os.Getenv("RUNNER_IMAGE_SCAN") == "true" {
+		go func() {
+			scan, err := deploy.ScanRunnerImage(context.Background())
+			if err != nil {
+				log.Printf("Runner image scan failed: %v", err)
+				return
+			}
+			log.Printf("Runner image %s has %d critical vulnerabilities", scan.Image, scan.Counts[deploy.SeverityCritical])
+		}()
+	}
+
+	client := &agentClient{
+		serverURL: serverURL,
+		username:  username,
+		password:  password,
+		http:      &http.Client{},
+	}
+	client.run(context.Background(), name, parseLabels(os.Getenv("AGENT_LABELS")), capacity)
+}
+
+// agentClient talks to the server as the agent user, logging in again
+// whenever the access token expires.
+type agentClient struct {
+	serverURL string
+	username  string
+	password  string
+	http      *http.Client
+
+	mu    sync.Mutex
+	token string
+}
+
+type registerResponse struct {
+	ID string `json:"id"`
+}
+
+func (c *agentClient) run(ctx context.Context, name string, labels []string, capacity int) {
+	var agentID string
+	for {
+		if agentID == "" {
+			id, err := c.register(ctx, name, labels, capacity)
+			if err != nil {
+				log.Printf("Agent registration failed: %v", err)
+				time.Sleep(retryDelay)
+				continue
+			}
+			agentID = id
+			log.Printf("Registered agent %s (%s) with labels %v", name, agentID, labels)
+		}
+
+		job, err := c.poll(ctx, agentID)
+		if errors.Is(err, errAgentUnknown) {
+			// The server restarted and forgot the registration.
+			agentID = ""
+			continue
+		}
+		if err != nil {
+			log.Printf("Job poll failed: %v", err)
+			time.Sleep(retryDelay)
+			continue
+		}
+		if job != nil {
+			go c.runJob(ctx, agentID, *job)
+		}
+	}
+}
+
+func (c *agentClient) register(ctx context.Context, name string, labels []string, capacity int) (string, error) {
+	var registered registerResponse
+	status, err := c.do(ctx, http.MethodPost, agentAPIPath, map[string]any{
+		"name":     name,
+		"labels":   labels,
+		"capacity": capacity,
+	}, &registered)
+	if err != nil {
+		return "", err
+	}
+	if status != http.StatusCreated {
+		return "", fmt.Errorf("Unexpected status %d", status)
+	}
+	return registered.ID, nil
+}
+
+func (c *agentClient) poll(ctx context.Context, agentID string) (*deploy.Job, error) {
+	var job deploy.Job
+	status, err := c.do(ctx, http.MethodGet, agentAPIPath+"/"+agentID+"/jobs", nil, &job)
+	if err != nil {
+		return nil, err
+	}
+	switch status {
+	case http.StatusOK:
+		return &job, nil
+	case http.StatusNoContent:
+		return nil, nil
+	case http.StatusNotFound:
+		return nil, errAgentUnknown
+	default:
+		return nil, fmt.Errorf("Unexpected status %d", status)
+	}
+}
+
+func (c *agentClient) runJob(ctx context.Context, agentID string, job deploy.Job) {
+	target := job.ChartID
+	if job.Stack != "" {
+		target += " stack " + job.Stack
+	}
+	log.Printf("Deploying %s at %s (job %s)", target, job.Ref, job.ID)
+
+	req := job.Request(c.serverURL)
+	for _, stage := range job.Gates {
+		req.Gates = append(req.Gates, deploy.Gate{
+			After: stage,
+			Evaluate: func(ctx context.Context, input deploy.GateInput) []deploy.PolicyResult {
+				return c.gate(ctx, agentID, job.ID, input)
+			},
+		})
+	}
+	result, err := deploy.RunDockerDeploy(ctx, req)
+	if err != nil {
+		log.Printf("Deploy of %s failed: %v", target, err)
+	}
+
+	path := agentAPIPath + "/" + agentID + "/jobs/" + job.ID
+	for try := 1; ; try++ {
+		status, err := c.do(ctx, http.MethodPost, path, deploy.NewJobResult(result, err), nil)
+		if err == nil && (status == http.StatusNoContent || status == http.StatusNotFound) {
+			// Not found means the server stopped waiting for the result.
+			return
+		}
+		if try == resultTries {
+			log.Printf("Reporting the result of job %s failed (status %d): %v", job.ID, status, err)
+			return
+		}
+		time.Sleep(retryDelay)
+	}
+}
+
+// gate asks the server for the verdict of a gate the job paused at. Gates
+// that can't be evaluated block the deploy.
+func (c *agentClient) gate(ctx context.Context, agentID, jobID string, input deploy.GateInput) []deploy.PolicyResult {
+	ctx, cancel := context.WithTimeout(ctx, gateTimeout)
+	defer cancel()
+
+	var verdict struct {
+		Results []deploy.PolicyResult `json:"results"`
+	}
+	status, err := c.do(ctx, http.MethodPost, agentAPIPath+"/"+agentID+"/jobs/"+jobID+"/gate", input, &verdict)
+	if err == nil && status != http.StatusOK {
+		err = fmt.Errorf("Unexpected status %d", status)
+	}
+	if err != nil {
+		return []deploy.PolicyResult{{Name: "gate", Outcome: deploy.PolicyBlocked, Message: err.Error()}}
+	}
+	return verdict.Results
+}
+
+// do sends a JSON request and decodes a JSON response into out, logging in
+// first when there is no token or it was rejected.
+func (c *agentClient) do(ctx context.Context, method, path string, body, out any) (int, error) {
+	for attempt := 0; ; attempt++ {
+		token, err := c.accessToken(ctx, attempt > 0)
+		if err != nil {
+			return 0, err
+		}
+
+		status, err := c.send(ctx, method, path, token, body, out)
+		if err != nil || status != http.StatusUnauthorized || attempt > 0 {
+			return status, err
+		}
+	}
+}
+
+func (c *agentClient) accessToken(ctx context.Context, renew bool) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && !renew {
+		return c.token, nil
+	}
+
+	var tokens struct {
+		AccessToken string `json:"accessToken"`
+	}
+	status, err := c.send(ctx, http.MethodPost, "/api/auth", "", map[string]string{
+		"username": c.username,
+		"password": c.password,
+	}, &tokens)
+	if err != nil {
+		return "", err
+	}
+	if status != http.StatusOK {
+		return "", fmt.Errorf("Login failed with status %d", status)
+	}
+	c.token = tokens.AccessToken
+	return c.token, nil
+}
+
+func (c *agentClient) send(ctx context.Context, method, path, token string, body, out any) (int, error) {
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return 0, err
+		}
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, pollTimeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.serverURL+path, &payload)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if out != nil && (resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated) {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, err
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+func parseLabels(value string) []string {
+	labels := []string{}
+	for _, label := range strings.Split(value, ",") {
+		if label = strings.TrimSpace(label); label != "" {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+func loadEnvFiles() {
+	files := []string{
+		".env",
+		".env.local",
+		".env.production",
+		".env.production.local",
+	}
+
+	for _, file := range files {
+		if err := godotenv.Overload(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Skipping env file load (%s): %v", file, err)
+		}
+	}
+}
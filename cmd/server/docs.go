@@ -1,10 +1,26 @@
 // @title Plane Manager API
 // @version 0.1.0
-// @description Plane Manager HTTP API for chart and workspace operations.
+// @description Plane Manager HTTP API for chart and workspace operations. Fields are camelCase; clients still expecting the snake_case names of the auth and user responses can send "X-JSON-Casing: legacy". Add ?pretty=1 to any request for indented JSON. Error responses keep their English message and stable code; send Accept-Language to also get a localizedMessage where a translation exists.
 // @BasePath /api
 // @schemes http
+// @tag.name auth
+// @tag.description Sessions and tokens
+// @tag.name user
+// @tag.description The authenticated user, their SSH keys, preferences and notifications
+// @tag.name service-account
+// @tag.description Non-human subjects automation logs in as, with role bindings
+// @tag.name chart
+// @tag.description Chart files, history, branches and settings. Errors of chart file endpoints carry a message instead of a code in error
+// @tag.name deploy
+// @tag.description Deploys and the agents that run them
+// @tag.name jobs
+// @tag.description Deploy jobs self-hosted agents claim, report on and gate
+// @tag.name runner
+// @tag.description The runner image and its scan
+// @tag.name health
+// @tag.description Liveness
 // @securityDefinitions.apikey BearerAuth
 // @in header
 // @name Authorization
-// @description Use "Bearer <token>" for authenticated requests.
+// @description Use "Bearer <token>" for authenticated requests. Chart permissions can further deny destroying resources per stack to users who may still deploy, see /chart/{id}/permissions.
 package main
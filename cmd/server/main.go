@@ -18,6 +18,16 @@ import (
 func main() {
 	loadEnvFiles()
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "export", "import":
+			runMigration(os.Args[1], os.Args[2:])
+			return
+		default:
+			log.Fatalf("Unknown command %q. The supported commands are: export, import", os.Args[1])
+		}
+	}
+
 	port := os.Getenv("API_PORT")
 	if port == "" {
 		port = "4000"
@@ -32,6 +42,10 @@ func main() {
 	switch os.Getenv("RUNNER_TYPE") {
 	case "", "docker":
 		docker.TestRunnerImage(runnerImage)
+		server.StartRunnerImageScan()
+		if err := server.StartServiceAddressCheck(); err != nil {
+			log.Fatalf("Invalid SERVICE_ADDRESS or SERVICE_ADDRESS_ALLOWLIST: %v", err)
+		}
 	default:
 		log.Fatalf(
 			"Unsupported RUNNER_TYPE: %s. The supported runner types are: docker",
@@ -45,6 +59,16 @@ func main() {
 		ReadHeaderTimeout: 5 * time.Second,
 	}
 
+	server.StartVulnerabilityScans()
+	server.StartChartTrashPurge()
+	server.StartDeployLogTiering()
+	server.StartSessionSweeper()
+	server.StartDeploySchedules()
+	server.StartEnvironmentExpiry()
+	if err := server.StartStandbyReplication(); err != nil {
+		log.Fatalf("Invalid standby replication settings: %v", err)
+	}
+
 	log.Printf("Planerider listening on http://localhost:%s", port)
 	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("Server error: %v", err)
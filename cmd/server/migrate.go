@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/mtolmacs/planemgr/internal/server"
+)
+
+// runMigration runs the export and import commands, which move every chart,
+// the trash and the secure store between instances. Secrets in the archive
+// are sealed with MIGRATION_PASSPHRASE.
+func runMigration(command string, args []string) {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	file := flags.String("file", "", "Migration archive to write or read, - for stdout or stdin")
+	_ = flags.Parse(args)
+	if *file == "" {
+		log.Fatalf("Usage: %s %s -file <archive.tar.gz>", os.Args[0], command)
+	}
+	passphrase := os.Getenv("MIGRATION_PASSPHRASE")
+	if passphrase == "" {
+		log.Fatalf("MIGRATION_PASSPHRASE is required to seal the secrets of the archive")
+	}
+
+	switch command {
+	case "export":
+		var output io.WriteCloser = os.Stdout
+		if *file != "-" {
+			created, err := os.OpenFile(*file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+			if err != nil {
+				log.Fatalf("Export failed: %v", err)
+			}
+			output = created
+		}
+		summary, err := server.ExportInstance(output, passphrase)
+		if err == nil {
+			err = output.Close()
+		}
+		if err != nil {
+			log.Fatalf("Export failed: %v", err)
+		}
+		log.Printf("Exported %d charts, %d deleted charts and %d users and service accounts", summary.Charts, summary.Trashed, summary.Subjects)
+	case "import":
+		var input io.ReadCloser = os.Stdin
+		if *file != "-" {
+			opened, err := os.Open(*file)
+			if err != nil {
+				log.Fatalf("Import failed: %v", err)
+			}
+			input = opened
+		}
+		defer input.Close()
+		summary, err := server.ImportInstance(input, passphrase)
+		if err != nil {
+			log.Fatalf("Import failed: %v", err)
+		}
+		log.Printf("Imported %d charts, %d deleted charts and %d users and service accounts", summary.Charts, summary.Trashed, summary.Subjects)
+	}
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+)
+
+// maxMigrationBytes caps the archive an import through the API accepts.
+const maxMigrationBytes = 8 << 30
+
+// migrationPassphraseHeader carries the passphrase sealing the secrets of
+// a migration archive.
+const migrationPassphraseHeader = "X-Migration-Passphrase"
+
+// isInstanceAdmin reports whether subject, holding the role bindings of its
+// token, is an instance admin: a service account with the admin role, or a
+// user named in the comma-separated INSTANCE_ADMINS.
+func isInstanceAdmin(subject string, roles []auth.RoleBinding) bool {
+	if auth.IsServiceAccount(subject) {
+		return auth.AllowsRole(roles, auth.RoleAdmin, "")
+	}
+	return slices.ContainsFunc(strings.Split(os.Getenv("INSTANCE_ADMINS"), ","), func(name string) bool {
+		return strings.TrimSpace(name) == subject
+	})
+}
+
+// requireInstanceAdmin answers the request unless it comes from an instance
+// admin.
+func requireInstanceAdmin(w http.ResponseWriter, r *http.Request) bool {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return false
+	}
+	if !isInstanceAdmin(claims.Subject, claims.Roles) {
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: "forbidden", Message: "only instance admins can export and import the instance"})
+		return false
+	}
+	return true
+}
+
+// HandleAdminExport handles /api/admin/export requests.
+// @Summary Export the instance
+// @Description Returns every chart with its history and metadata, the trash and the secure store as a tar.gz archive, as `server export` writes it. Chart secrets, stored secrets and service account keys are sealed with the passphrase in X-Migration-Passphrase; user keys stay encrypted with the passwords of their users. Charts written to during the export may be archived half way, so export while the instance is idle. Only instance admins can export: users named in INSTANCE_ADMINS and service accounts with the admin role.
+// @Tags admin
+// @Security BearerAuth
+// @Produce application/gzip
+// @Param X-Migration-Passphrase header string true "Passphrase sealing the secrets of the archive"
+// @Success 200 {file} file
+// @Failure 400 {object} errorResponse "`invalid_passphrase`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 500 {object} errorResponse "`export_failed`"
+// @Router /admin/export [post]
+func HandleAdminExport(w http.ResponseWriter, r *http.Request) {
+	if !requireInstanceAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+		return
+	}
+
+	// The archive is written aside first, so a failure can still be
+	// answered with an error instead of a truncated archive.
+	file, err := os.CreateTemp("", "planemgr-export-*.tar.gz")
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "export_failed", Message: err.Error()})
+		return
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if _, err := ExportInstance(file, r.Header.Get(migrationPassphraseHeader)); errors.Is(err, ErrMigrationPassphrase) {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_passphrase", Message: "a passphrase is required in " + migrationPassphraseHeader})
+		return
+	} else if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "export_failed", Message: err.Error()})
+		return
+	}
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "export_failed", Message: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"planemgr-%s.tar.gz\"", time.Now().UTC().Format("20060102-150405")))
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.Copy(w, file)
+}
+
+type adminImportResponse struct {
+	Charts   int `json:"charts"`
+	Trashed  int `json:"trashed"`
+	Subjects int `json:"subjects"` // Users and service accounts
+}
+
+// HandleAdminImport handles /api/admin/import requests.
+// @Summary Import an instance export
+// @Description Restores the archive of an export in the body, as `server import` does, keeping the chart IDs and subjects. Nothing is imported when the instance already has any of them. The passphrase the archive was sealed with goes in X-Migration-Passphrase. Only instance admins can import: users named in INSTANCE_ADMINS and service accounts with the admin role.
+// @Tags admin
+// @Security BearerAuth
+// @Accept application/gzip
+// @Produce json
+// @Param X-Migration-Passphrase header string true "Passphrase the archive was sealed with"
+// @Success 200 {object} adminImportResponse
+// @Failure 400 {object} errorResponse "`invalid_passphrase`, `invalid_archive`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 409 {object} errorResponse "`migration_conflict`"
+// @Failure 500 {object} errorResponse "`import_failed`"
+// @Router /admin/import [post]
+func HandleAdminImport(w http.ResponseWriter, r *http.Request) {
+	if !requireInstanceAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+		return
+	}
+
+	summary, err := ImportInstance(http.MaxBytesReader(w, r.Body, maxMigrationBytes), r.Header.Get(migrationPassphraseHeader))
+	switch {
+	case errors.Is(err, ErrMigrationPassphrase):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_passphrase", Message: err.Error()})
+	case errors.Is(err, ErrInvalidMigrationArchive):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_archive", Message: err.Error()})
+	case errors.Is(err, ErrMigrationConflict):
+		writeJSON(w, http.StatusConflict, errorResponse{Error: "migration_conflict", Message: err.Error()})
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "import_failed", Message: err.Error()})
+	default:
+		writeJSON(w, http.StatusOK, adminImportResponse{Charts: summary.Charts, Trashed: summary.Trashed, Subjects: summary.Subjects})
+	}
+}
@@ -0,0 +1,160 @@
+package advisory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Severities reported for advisories. OSV records from GitHub rate
+// "moderate", which is reported as medium.
+const (
+	SeverityCritical = "critical"
+	SeverityHigh     = "high"
+	SeverityMedium   = "medium"
+	SeverityLow      = "low"
+	SeverityUnknown  = "unknown"
+)
+
+const defaultOSVURL = "https://api.osv.dev"
+
+var client = &http.Client{Timeout: 30 * time.Second}
+
+// Advisory is a known vulnerability affecting a provider version.
+type Advisory struct {
+	ID       string
+	Aliases  []string
+	Summary  string
+	Severity string
+	Fixed    []string // Versions fixing the vulnerability, if known
+}
+
+type osvQuery struct {
+	Version string     `json:"version"`
+	Package osvPackage `json:"package"`
+}
+
+type osvPackage struct {
+	Name      string `json:"name"`
+	Ecosystem string `json:"ecosystem"`
+}
+
+type osvResponse struct {
+	Vulns []osvVuln `json:"vulns"`
+}
+
+type osvVuln struct {
+	ID       string   `json:"id"`
+	Aliases  []string `json:"aliases"`
+	Summary  string   `json:"summary"`
+	Affected []struct {
+		Package osvPackage `json:"package"`
+		Ranges  []struct {
+			Events []struct {
+				Fixed string `json:"fixed"`
+			} `json:"events"`
+		} `json:"ranges"`
+	} `json:"affected"`
+	DatabaseSpecific struct {
+		Severity string `json:"severity"`
+	} `json:"database_specific"`
+}
+
+// ProviderModule maps a provider address to the Go module it is built from.
+// Providers are published from github.com/<namespace>/terraform-provider-<type>,
+// which is how OSV tracks them.
+func ProviderModule(source string) (string, bool) {
+	parts := strings.Split(source, "/")
+	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+		return "", false
+	}
+	return "github.com/" + parts[1] + "/terraform-provider-" + parts[2], true
+}
+
+// QueryProvider asks OSV for the advisories affecting version of the provider
+// at source. The API location can be overridden with OSV_API_URL.
+func QueryProvider(ctx context.Context, source, version string) ([]Advisory, error) {
+	module, ok := ProviderModule(source)
+	if !ok {
+		return nil, fmt.Errorf("unsupported provider address %q", source)
+	}
+
+	body, err := json.Marshal(osvQuery{
+		Version: strings.TrimPrefix(version, "v"),
+		Package: osvPackage{Name: module, Ecosystem: "Go"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL := strings.TrimRight(os.Getenv("OSV_API_URL"), "/")
+	if baseURL == "" {
+		baseURL = defaultOSVURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/v1/query", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OSV query for %s returned %s", module, resp.Status)
+	}
+
+	var result osvResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	advisories := make([]Advisory, 0, len(result.Vulns))
+	for _, vuln := range result.Vulns {
+		advisory := Advisory{
+			ID:       vuln.ID,
+			Aliases:  vuln.Aliases,
+			Summary:  vuln.Summary,
+			Severity: severity(vuln.DatabaseSpecific.Severity),
+			Fixed:    []string{},
+		}
+		for _, affected := range vuln.Affected {
+			if affected.Package.Name != module {
+				continue
+			}
+			for _, r := range affected.Ranges {
+				for _, event := range r.Events {
+					if event.Fixed != "" && !slices.Contains(advisory.Fixed, event.Fixed) {
+						advisory.Fixed = append(advisory.Fixed, event.Fixed)
+					}
+				}
+			}
+		}
+		advisories = append(advisories, advisory)
+	}
+
+	return advisories, nil
+}
+
+func severity(value string) string {
+	switch strings.ToLower(value) {
+	case "critical":
+		return SeverityCritical
+	case "high":
+		return SeverityHigh
+	case "moderate", "medium":
+		return SeverityMedium
+	case "low":
+		return SeverityLow
+	default:
+		return SeverityUnknown
+	}
+}
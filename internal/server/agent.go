@@ -0,0 +1,745 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/deploy"
+)
+
+const (
+	// agentPollTimeout is how long a job poll waits for a job before the
+	// agent is told to poll again.
+	agentPollTimeout = 30 * time.Second
+	// agentOfflineAfter is how long an agent may go without polling before
+	// it stops receiving jobs, and the jobs it holds fail.
+	agentOfflineAfter = 2 * agentPollTimeout
+	maxAgentCapacity  = 64
+)
+
+var ErrNoAgent = errors.New("No connected agent matches the requested labels")
+var errAgentOffline = errors.New("Deploy agent went offline")
+
+// deployAgent is a self-hosted runner that registered over an outbound
+// connection and polls for deploy jobs. Agents receive the SSH keys of the
+// deploying user, so they only run jobs of the user they registered as.
+type deployAgent struct {
+	ID           string
+	Name         string
+	Labels       []string
+	Capacity     int // Jobs the agent runs at once
+	Subject      string
+	RegisteredAt time.Time
+	LastSeen     time.Time
+	Running      int
+}
+
+// agentJob is a deploy job waiting in the queue of its label set, or running
+// on the agent that claimed it.
+type agentJob struct {
+	job      deploy.Job
+	labels   []string
+	queuedAt time.Time
+	agentID  string // Empty while queued
+	result   chan deploy.JobResult
+	gates    []deploy.Gate // Evaluated here when the agent reaches them
+}
+
+var agentRegistry = struct {
+	mu     sync.Mutex
+	agents map[string]*deployAgent
+	jobs   map[string]*agentJob   // Queued and running jobs by ID
+	queues map[string][]*agentJob // Queued jobs by label set, oldest first
+	wake   chan struct{}          // Closed when jobs are queued or capacity frees up
+}{
+	agents: map[string]*deployAgent{},
+	jobs:   map[string]*agentJob{},
+	queues: map[string][]*agentJob{},
+	wake:   make(chan struct{}),
+}
+
+type agentRegisterRequest struct {
+	Name     string   `json:"name" example:"eu-runner-1"`
+	Labels   []string `json:"labels,omitempty" example:"cloud=aws,region=eu"`
+	Capacity int      `json:"capacity,omitempty" example:"2"` // Defaults to 1
+}
+
+type agentResponse struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	Labels       []string `json:"labels"`
+	Capacity     int      `json:"capacity"`
+	Connected    bool     `json:"connected"`
+	Running      int      `json:"running"`
+	RegisteredAt string   `json:"registeredAt"`
+	LastSeen     string   `json:"lastSeen"`
+}
+
+type agentListResponse struct {
+	Agents []agentResponse `json:"agents"`
+}
+
+// agentPoolResponse sums up the connected agents sharing a label set.
+type agentPoolResponse struct {
+	Labels    []string `json:"labels"`
+	Agents    int      `json:"agents"`
+	Capacity  int      `json:"capacity"`
+	Running   int      `json:"running"`
+	Available int      `json:"available"`
+}
+
+// agentQueueResponse sums up the jobs waiting for an agent with a label set.
+// Available is the free capacity of the connected agents carrying it.
+type agentQueueResponse struct {
+	Labels         []string `json:"labels"`
+	Queued         int      `json:"queued"`
+	OldestQueuedAt string   `json:"oldestQueuedAt"`
+	Available      int      `json:"available"`
+}
+
+type agentCapacityResponse struct {
+	Pools  []agentPoolResponse  `json:"pools"`
+	Queues []agentQueueResponse `json:"queues"`
+}
+
+// HandleAgents handles /api/agent requests.
+func HandleAgents(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		HandleAgentList(w, r, claims.Subject)
+	case http.MethodPost:
+		HandleAgentRegister(w, r, claims.Subject)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+	}
+}
+
+// HandleAgentList handles GET /api/agent requests.
+// @Summary List deploy agents
+// @Description Returns the deploy agents registered by the current user since the server started.
+// @Tags deploy
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} agentListResponse
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Router /agent [get]
+func HandleAgentList(w http.ResponseWriter, _ *http.Request, subject string) {
+	agentRegistry.mu.Lock()
+	defer agentRegistry.mu.Unlock()
+
+	agents := []agentResponse{}
+	for _, agent := range agentRegistry.agents {
+		if agent.Subject != subject {
+			continue
+		}
+		agents = append(agents, agentResponse{
+			ID:           agent.ID,
+			Name:         agent.Name,
+			Labels:       agent.Labels,
+			Capacity:     agent.Capacity,
+			Connected:    agent.connected(),
+			Running:      agent.Running,
+			RegisteredAt: agent.RegisteredAt.UTC().Format(time.RFC3339),
+			LastSeen:     agent.LastSeen.UTC().Format(time.RFC3339),
+		})
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].Name < agents[j].Name })
+
+	writeJSON(w, http.StatusOK, agentListResponse{Agents: agents})
+}
+
+// HandleAgentRegister handles POST /api/agent requests.
+// @Summary Register a deploy agent
+// @Description Registers a self-hosted deploy agent. The agent then polls /agent/{id}/jobs for the deploys of the current user that request a subset of its labels, such as cloud=aws or region=eu, and runs up to capacity of them at once in its own network. Registrations are kept in memory, agents register again when the server restarts.
+// @Tags deploy
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body agentRegisterRequest true "Agent"
+// @Success 201 {object} agentResponse
+// @Failure 400 {object} errorResponse "`invalid_request`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Router /agent [post]
+func HandleAgentRegister(w http.ResponseWriter, r *http.Request, subject string) {
+	var req agentRegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "Invalid JSON payload"})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "Agent name is required"})
+		return
+	}
+	if req.Capacity < 0 || req.Capacity > maxAgentCapacity {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "Agent capacity must be between 1 and 64"})
+		return
+	}
+	if req.Capacity == 0 {
+		req.Capacity = 1
+	}
+
+	now := time.Now()
+	agent := &deployAgent{
+		ID:           uuid.NewString(),
+		Name:         req.Name,
+		Labels:       normalizeAgentLabels(req.Labels),
+		Capacity:     req.Capacity,
+		Subject:      subject,
+		RegisteredAt: now,
+		LastSeen:     now,
+	}
+
+	agentRegistry.mu.Lock()
+	agentRegistry.agents[agent.ID] = agent
+	agentRegistry.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, agentResponse{
+		ID:           agent.ID,
+		Name:         agent.Name,
+		Labels:       agent.Labels,
+		Capacity:     agent.Capacity,
+		Connected:    true,
+		RegisteredAt: now.UTC().Format(time.RFC3339),
+		LastSeen:     now.UTC().Format(time.RFC3339),
+	})
+}
+
+// HandleAgentCapacity handles GET /api/agent/capacity requests.
+// @Summary Deploy agent capacity
+// @Description Returns the connected agents of the current user grouped by label set with their free capacity, and the deploys queued per requested label set.
+// @Tags deploy
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} agentCapacityResponse
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Router /agent/capacity [get]
+func HandleAgentCapacity(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+		return
+	}
+
+	agentRegistry.mu.Lock()
+	defer agentRegistry.mu.Unlock()
+
+	pools := map[string]*agentPoolResponse{}
+	for _, agent := range agentRegistry.agents {
+		if agent.Subject != claims.Subject || !agent.connected() {
+			continue
+		}
+		key := agentLabelSet(agent.Labels)
+		pool, ok := pools[key]
+		if !ok {
+			pool = &agentPoolResponse{Labels: agent.Labels}
+			pools[key] = pool
+		}
+		pool.Agents++
+		pool.Capacity += agent.Capacity
+		pool.Running += agent.Running
+		pool.Available += agent.available()
+	}
+
+	response := agentCapacityResponse{Pools: []agentPoolResponse{}, Queues: []agentQueueResponse{}}
+	for _, pool := range pools {
+		response.Pools = append(response.Pools, *pool)
+	}
+	for _, queue := range agentRegistry.queues {
+		var jobs []*agentJob
+		for _, job := range queue {
+			if job.job.Subject == claims.Subject {
+				jobs = append(jobs, job)
+			}
+		}
+		if len(jobs) == 0 {
+			continue
+		}
+		available := 0
+		for _, agent := range agentRegistry.agents {
+			if agent.Subject == claims.Subject && agent.connected() && hasAgentLabels(agent.Labels, jobs[0].labels) {
+				available += agent.available()
+			}
+		}
+		response.Queues = append(response.Queues, agentQueueResponse{
+			Labels:         jobs[0].labels,
+			Queued:         len(jobs),
+			OldestQueuedAt: jobs[0].queuedAt.UTC().Format(time.RFC3339),
+			Available:      available,
+		})
+	}
+	sort.Slice(response.Pools, func(i, j int) bool {
+		return agentLabelSet(response.Pools[i].Labels) < agentLabelSet(response.Pools[j].Labels)
+	})
+	sort.Slice(response.Queues, func(i, j int) bool {
+		return agentLabelSet(response.Queues[i].Labels) < agentLabelSet(response.Queues[j].Labels)
+	})
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// HandleAgentJobs handles GET /api/agent/{id}/jobs requests.
+// @Summary Poll for a deploy job
+// @Description Waits up to 30 seconds for a queued deploy job the agent can take: the oldest one whose labels the agent carries, while the agent runs fewer jobs than its capacity. Agents that stop polling for a minute are considered offline.
+// @Tags jobs
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Agent ID"
+// @Success 200 {object} deploy.Job
+// @Success 204
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`agent_not_found`"
+// @Router /agent/{id}/jobs [get]
+func HandleAgentJobs(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+		return
+	}
+
+	agent, ok := agentForSubject(r.PathValue("id"), claims.Subject)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "agent_not_found"})
+		return
+	}
+
+	timer := time.NewTimer(agentPollTimeout)
+	defer timer.Stop()
+	for {
+		job, wake := claimAgentJob(agent)
+		if job != nil {
+			writeJSON(w, http.StatusOK, job)
+			return
+		}
+
+		select {
+		case <-wake:
+		case <-timer.C:
+			agent.seen()
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// HandleAgentJobResult handles POST /api/agent/{id}/jobs/{jobId} requests.
+// @Summary Report a deploy job result
+// @Description Completes a deploy job with the result of the run on the agent.
+// @Tags jobs
+// @Security BearerAuth
+// @Accept json
+// @Param id path string true "Agent ID"
+// @Param jobId path string true "Job ID"
+// @Param request body deploy.JobResult true "Job result"
+// @Success 204
+// @Failure 400 {object} errorResponse "`invalid_request`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`agent_not_found`, `job_not_found`"
+// @Router /agent/{id}/jobs/{jobId} [post]
+func HandleAgentJobResult(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+		return
+	}
+
+	agent, ok := agentForSubject(r.PathValue("id"), claims.Subject)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "agent_not_found"})
+		return
+	}
+	agent.seen()
+
+	var result deploy.JobResult
+	if err := json.NewDecoder(r.Body).Decode(&result); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "Invalid JSON payload"})
+		return
+	}
+
+	agentRegistry.mu.Lock()
+	job, ok := agentRegistry.jobs[r.PathValue("jobId")]
+	if ok && job.agentID == agent.ID {
+		select {
+		case job.result <- result:
+		default:
+			// The result was already reported.
+		}
+	}
+	agentRegistry.mu.Unlock()
+	if !ok || job.agentID != agent.ID {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "job_not_found"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type agentGateResponse struct {
+	Results []deploy.PolicyResult `json:"results"`
+}
+
+// HandleAgentJobGate handles POST /api/agent/{id}/jobs/{jobId}/gate requests.
+// @Summary Evaluate a deploy job gate
+// @Description Evaluates the gate a running job paused at, such as the chart run tasks following a stage, and returns its results once it decided. Any blocked result fails the job.
+// @Tags jobs
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Agent ID"
+// @Param jobId path string true "Job ID"
+// @Param request body deploy.GateInput true "Gate stage and plan"
+// @Success 200 {object} agentGateResponse
+// @Failure 400 {object} errorResponse "`invalid_request`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`agent_not_found`, `gate_not_found`"
+// @Router /agent/{id}/jobs/{jobId}/gate [post]
+func HandleAgentJobGate(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+		return
+	}
+
+	agent, ok := agentForSubject(r.PathValue("id"), claims.Subject)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "agent_not_found"})
+		return
+	}
+	agent.seen()
+
+	var input deploy.GateInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "Invalid JSON payload"})
+		return
+	}
+
+	agentRegistry.mu.Lock()
+	job, ok := agentRegistry.jobs[r.PathValue("jobId")]
+	var gates []deploy.Gate
+	if ok && job.agentID == agent.ID {
+		gates = job.gates
+	}
+	agentRegistry.mu.Unlock()
+	index := slices.IndexFunc(gates, func(gate deploy.Gate) bool { return gate.After == input.Stage })
+	if index < 0 {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "gate_not_found"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, agentGateResponse{Results: gates[index].Evaluate(r.Context(), input)})
+}
+
+// runDeployRequest runs a deploy in the local runner, or on a connected agent
+// of the deploying user that carries all agentLabels. jobType labels it in the
+// job summary.
+func runDeployRequest(ctx context.Context, jobType string, req deploy.Request, agentLabels []string) (result deploy.Result, err error) {
+	local := len(agentLabels) == 0
+	recordJobStarted(jobType, local)
+	defer func() { recordJobFinished(jobType, local, err) }()
+
+	if local {
+		return deploy.RunDockerDeploy(ctx, req)
+	}
+
+	job, err := newAgentJob(req)
+	if err != nil {
+		return deploy.Result{}, err
+	}
+	return dispatchAgentJob(ctx, job, req.Gates, normalizeAgentLabels(agentLabels))
+}
+
+// newAgentJob converts a deploy request for an agent, replacing the chart
+// policies with their settings.
+func newAgentJob(req deploy.Request) (deploy.Job, error) {
+	job := deploy.Job{
+		ID:               uuid.NewString(),
+		Token:            req.Token,
+		DeployID:         req.DeployID,
+		ChartID:          req.ChartID,
+		Ref:              req.Ref,
+		Commit:           req.Commit,
+		Stack:            req.Stack,
+		Pipeline:         req.Pipeline,
+		Subject:          req.Subject,
+		PublicKey:        req.PublicKey,
+		PrivateKey:       req.PrivateKey,
+		OverridePolicies: req.OverridePolicies,
+		Sandbox:          req.Sandbox,
+		ServiceURL:       req.ServiceURL,
+		TimeoutSeconds:   int(req.Timeout / time.Second),
+		State:            req.State,
+		Secrets:          req.Secrets,
+		Environment:      req.Environment,
+		Variables:        req.Variables,
+		Traffic:          req.Traffic,
+	}
+	for _, gate := range req.Gates {
+		job.Gates = append(job.Gates, gate.After)
+	}
+	if len(req.Policies) == 0 {
+		return job, nil
+	}
+
+	budget, err := loadChartBudget(req.ChartID)
+	if err != nil {
+		return deploy.Job{}, err
+	}
+	if budget.Enabled() {
+		job.Budget = &budget
+	}
+	requiredTags, err := loadChartRequiredTags(req.ChartID)
+	if err != nil {
+		return deploy.Job{}, err
+	}
+	if requiredTags.Enabled() {
+		job.RequiredTags = &requiredTags
+	}
+	if maxCritical, ok := runnerImageMaxCritical(); ok {
+		job.RunnerImageMaxCritical = &maxCritical
+	}
+	for _, policy := range req.Policies {
+		if policy.Name == deploy.DestroyPolicyName {
+			job.DenyDestroy = true
+		}
+	}
+	return job, nil
+}
+
+// dispatchAgentJob queues the job for its label set and waits for the result.
+// Jobs stay queued while every matching agent is busy, and fail when no
+// matching agent is connected or the agent running them goes offline.
+func dispatchAgentJob(ctx context.Context, job deploy.Job, gates []deploy.Gate, labels []string) (deploy.Result, error) {
+	pending, err := queueAgentJob(job, gates, labels)
+	if err != nil {
+		return deploy.Result{}, err
+	}
+	defer finishAgentJob(pending)
+
+	ticker := time.NewTicker(agentPollTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case result := <-pending.result:
+			return result.Result, result.Err()
+		case <-ticker.C:
+			if err := agentJobHealth(pending); err != nil {
+				return deploy.Result{}, err
+			}
+		case <-ctx.Done():
+			return deploy.Result{}, ctx.Err()
+		}
+	}
+}
+
+func queueAgentJob(job deploy.Job, gates []deploy.Gate, labels []string) (*agentJob, error) {
+	agentRegistry.mu.Lock()
+	defer agentRegistry.mu.Unlock()
+
+	pending := &agentJob{
+		job:      job,
+		labels:   labels,
+		queuedAt: time.Now(),
+		result:   make(chan deploy.JobResult, 1),
+		gates:    gates,
+	}
+	if err := agentJobHealthLocked(pending); err != nil {
+		return nil, err
+	}
+
+	key := agentLabelSet(labels)
+	agentRegistry.queues[key] = append(agentRegistry.queues[key], pending)
+	agentRegistry.jobs[job.ID] = pending
+	wakeAgentsLocked()
+	return pending, nil
+}
+
+// claimAgentJob hands the oldest queued job the agent can run to it. Without
+// one, it returns a channel that is closed when that may have changed.
+func claimAgentJob(agent *deployAgent) (*deploy.Job, <-chan struct{}) {
+	agentRegistry.mu.Lock()
+	defer agentRegistry.mu.Unlock()
+
+	agent.LastSeen = time.Now()
+	if agent.available() == 0 {
+		return nil, agentRegistry.wake
+	}
+
+	var claimed *agentJob
+	for _, queue := range agentRegistry.queues {
+		for _, job := range queue {
+			if job.job.Subject != agent.Subject || !hasAgentLabels(agent.Labels, job.labels) {
+				continue
+			}
+			if claimed == nil || job.queuedAt.Before(claimed.queuedAt) {
+				claimed = job
+			}
+			break
+		}
+	}
+	if claimed == nil {
+		return nil, agentRegistry.wake
+	}
+
+	dequeueAgentJobLocked(claimed)
+	recordJobWait(time.Since(claimed.queuedAt))
+	claimed.agentID = agent.ID
+	agent.Running++
+	return &claimed.job, nil
+}
+
+// finishAgentJob forgets a job once its deploy returned, freeing the
+// capacity of the agent that ran it.
+func finishAgentJob(pending *agentJob) {
+	agentRegistry.mu.Lock()
+	defer agentRegistry.mu.Unlock()
+
+	delete(agentRegistry.jobs, pending.job.ID)
+	if pending.agentID == "" {
+		dequeueAgentJobLocked(pending)
+		return
+	}
+	if agent, ok := agentRegistry.agents[pending.agentID]; ok {
+		agent.Running--
+	}
+	wakeAgentsLocked()
+}
+
+func agentJobHealth(pending *agentJob) error {
+	agentRegistry.mu.Lock()
+	defer agentRegistry.mu.Unlock()
+
+	return agentJobHealthLocked(pending)
+}
+
+// agentJobHealthLocked fails queued jobs no connected agent can take, and
+// running jobs whose agent went offline.
+func agentJobHealthLocked(pending *agentJob) error {
+	if pending.agentID != "" {
+		if agent, ok := agentRegistry.agents[pending.agentID]; ok && agent.connected() {
+			return nil
+		}
+		return errAgentOffline
+	}
+
+	for _, agent := range agentRegistry.agents {
+		if agent.Subject == pending.job.Subject && agent.connected() && hasAgentLabels(agent.Labels, pending.labels) {
+			return nil
+		}
+	}
+	return ErrNoAgent
+}
+
+func dequeueAgentJobLocked(pending *agentJob) {
+	key := agentLabelSet(pending.labels)
+	queue := slices.DeleteFunc(agentRegistry.queues[key], func(job *agentJob) bool { return job == pending })
+	if len(queue) == 0 {
+		delete(agentRegistry.queues, key)
+		return
+	}
+	agentRegistry.queues[key] = queue
+}
+
+// wakeAgentsLocked lets waiting polls look for a job again.
+func wakeAgentsLocked() {
+	close(agentRegistry.wake)
+	agentRegistry.wake = make(chan struct{})
+}
+
+func agentForSubject(id, subject string) (*deployAgent, bool) {
+	agentRegistry.mu.Lock()
+	defer agentRegistry.mu.Unlock()
+
+	agent, ok := agentRegistry.agents[id]
+	if !ok || agent.Subject != subject {
+		return nil, false
+	}
+	return agent, true
+}
+
+func (a *deployAgent) seen() {
+	agentRegistry.mu.Lock()
+	a.LastSeen = time.Now()
+	agentRegistry.mu.Unlock()
+}
+
+// connected reports whether the agent polled recently. Callers hold the
+// registry lock.
+func (a *deployAgent) connected() bool {
+	return time.Since(a.LastSeen) < agentOfflineAfter
+}
+
+// available is the number of jobs the agent can still take. Callers hold the
+// registry lock.
+func (a *deployAgent) available() int {
+	return max(a.Capacity-a.Running, 0)
+}
+
+func hasAgentLabels(agentLabels, labels []string) bool {
+	for _, label := range labels {
+		if !slices.Contains(agentLabels, label) {
+			return false
+		}
+	}
+	return true
+}
+
+// agentLabelSet identifies a normalized label set.
+func agentLabelSet(labels []string) string {
+	return strings.Join(labels, ",")
+}
+
+func normalizeAgentLabels(labels []string) []string {
+	normalized := []string{}
+	for _, label := range labels {
+		label = strings.TrimSpace(label)
+		if label != "" && !slices.Contains(normalized, label) {
+			normalized = append(normalized, label)
+		}
+	}
+	slices.Sort(normalized)
+	return normalized
+}
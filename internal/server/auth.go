@@ -5,26 +5,52 @@ import (
 	"errors"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/mtolmacs/planemgr/internal/server/auth"
 	"github.com/mtolmacs/planemgr/internal/server/user"
 )
 
 type authRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username string `json:"username" example:"alice"`
+	Password string `json:"password" example:"correct horse battery staple"`
 }
 
 type authResponse struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
-	TokenType    string `json:"token_type"`
-	ExpiresIn    int64  `json:"expires_in"`
+	AccessToken      string `json:"accessToken"`
+	RefreshToken     string `json:"refreshToken"`
+	TokenType        string `json:"tokenType"`
+	ExpiresIn        int64  `json:"expiresIn"` // Seconds until the access token expires
+	ExpiresAt        string `json:"expiresAt" example:"2026-01-02T15:04:05Z"`
+	RefreshExpiresIn int64  `json:"refreshExpiresIn"` // Seconds until the refresh token expires
+	RefreshExpiresAt string `json:"refreshExpiresAt" example:"2026-01-09T15:04:05Z"`
+	SessionExpiresAt string `json:"sessionExpiresAt" example:"2026-02-01T15:04:05Z"` // No refresh extends the session past this
 }
 
+type legacyAuthResponse struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	ExpiresAt        string `json:"expires_at"`
+	RefreshExpiresIn int64  `json:"refresh_expires_in"`
+	RefreshExpiresAt string `json:"refresh_expires_at"`
+	SessionExpiresAt string `json:"session_expires_at"`
+}
+
+func (response authResponse) legacyJSON() any {
+	return legacyAuthResponse(response)
+}
+
+// errorResponse is the body of failed requests. Error is a stable code clients
+// can branch on; every endpoint documents the codes it returns per status.
+// LocalizedMessage is set when Accept-Language asks for a language the
+// message catalogue translates the code to.
 type errorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message,omitempty"`
+	Error            string `json:"error" example:"invalid_request"`
+	Message          string `json:"message,omitempty" example:"invalid JSON payload"`
+	LocalizedMessage string `json:"localizedMessage,omitempty" example:"Die Anfrage ist ungültig."`
 }
 
 type emptyResponse struct{}
@@ -45,15 +71,15 @@ func HandleAuth(w http.ResponseWriter, r *http.Request) {
 
 // HandleAuthLogin godoc
 // @Summary Log in
-// @Description Issues access and refresh tokens by decrypting the stored SSH private key with the provided password.
+// @Description Issues access and refresh tokens by decrypting the stored SSH private key with the provided password. Service accounts log in with their subject ("service:" and their name) as the username and their secret as the password, and get tokens only allowing what their role bindings grant.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param credentials body authRequest true "User credentials"
 // @Success 200 {object} authResponse
-// @Failure 400 {object} errorResponse
-// @Failure 401 {object} errorResponse
-// @Failure 500 {object} errorResponse
+// @Failure 400 {object} errorResponse "`invalid_request`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 500 {object} errorResponse "`token_error`, `key_load_failed`"
 // @Router /auth [post]
 func HandleAuthLogin(w http.ResponseWriter, r *http.Request) {
 	if r.Body == nil {
@@ -72,6 +98,11 @@ func HandleAuthLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if auth.IsServiceAccount(req.Username) {
+		handleServiceAccountLogin(w, strings.TrimPrefix(req.Username, auth.ServiceAccountPrefix), req.Password)
+		return
+	}
+
 	privateKey, err := user.LoadUserPrivateKey(req.Username, req.Password)
 	if err != nil {
 		status := http.StatusUnauthorized
@@ -84,29 +115,23 @@ func HandleAuthLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	auth.StorePrivateKey(req.Username, privateKey)
-	accessToken, refreshToken, expiresIn, err := auth.IssueTokens(req.Username)
+	tokens, err := auth.IssueTokens(req.Username)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "token_error", Message: err.Error()})
 		return
 	}
 
-	writeJSON(w, http.StatusOK, authResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		TokenType:    "Bearer",
-		ExpiresIn:    expiresIn,
-	})
+	writeJSON(w, http.StatusOK, newAuthResponse(tokens))
 }
 
 // HandleAuthRefresh godoc
 // @Summary Refresh access token
-// @Description Issues a new access token using a refresh token in the Authorization header or refresh_token query param.
+// @Description Issues a new access token using a refresh token in the Authorization header or refresh_token query param. The new refresh token keeps the expiry of the session's login, unless sliding sessions are enabled, in which case it expires a full refresh token lifetime from now, but never after sessionExpiresAt.
 // @Tags auth
 // @Param refresh_token query string true "Refresh token"
 // @Produce json
 // @Success 200 {object} authResponse
-// @Failure 401 {object} errorResponse
-// @Failure 500 {object} errorResponse
+// @Failure 401 {object} errorResponse "`unauthorized`"
 // @Router /auth [get]
 func HandleAuthRefresh(w http.ResponseWriter, r *http.Request) {
 	claims, err := auth.RequireRefreshToken(r)
@@ -115,16 +140,70 @@ func HandleAuthRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	accessToken, newRefreshToken, expiresIn, err := auth.IssueTokens(claims.Subject)
+	var roles []auth.RoleBinding
+	if auth.IsServiceAccount(claims.Subject) {
+		account, err := user.LoadServiceAccount(strings.TrimPrefix(claims.Subject, auth.ServiceAccountPrefix))
+		if err != nil {
+			auth.EndSession(claims.Subject)
+			writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized", Message: auth.ErrLoggedOut.Error()})
+			return
+		}
+		roles = account.Roles
+	}
+
+	tokens, err := auth.RefreshTokens(claims, roles)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized", Message: err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newAuthResponse(tokens))
+}
+
+func handleServiceAccountLogin(w http.ResponseWriter, name, secret string) {
+	account, err := user.LoadServiceAccount(name)
+	if err != nil || !account.CheckSecret(secret) {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized", Message: "invalid credentials"})
+		return
+	}
+
+	_, privateKey, err := user.LoadServiceAccountKeyPair(account)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "key_load_failed", Message: err.Error()})
+		return
+	}
+
+	auth.StoreServiceSession(account.Subject(), privateKey)
+	tokens, err := auth.IssueServiceTokens(account.Subject(), account.Roles)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "token_error", Message: err.Error()})
 		return
 	}
 
-	writeJSON(w, http.StatusOK, authResponse{
-		AccessToken:  accessToken,
-		RefreshToken: newRefreshToken,
-		TokenType:    "Bearer",
-		ExpiresIn:    expiresIn,
-	})
+	writeJSON(w, http.StatusOK, newAuthResponse(tokens))
+}
+
+// requirePrivateKey returns the SSH private key of a logged in subject, or
+// writes 403 when the subject is a service account without a key pair.
+func requirePrivateKey(w http.ResponseWriter, subject string) (string, bool) {
+	privateKey, ok := auth.PrivateKeyForSubject(subject)
+	if !ok {
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: "ssh_key_required", Message: "subject has no SSH key pair"})
+		return "", false
+	}
+	return privateKey, true
+}
+
+func newAuthResponse(tokens auth.Tokens) authResponse {
+	now := time.Now()
+	return authResponse{
+		AccessToken:      tokens.AccessToken,
+		RefreshToken:     tokens.RefreshToken,
+		TokenType:        "Bearer",
+		ExpiresIn:        int64(tokens.AccessExpiresAt.Sub(now).Round(time.Second).Seconds()),
+		ExpiresAt:        tokens.AccessExpiresAt.Format(time.RFC3339),
+		RefreshExpiresIn: int64(tokens.RefreshExpiresAt.Sub(now).Round(time.Second).Seconds()),
+		RefreshExpiresAt: tokens.RefreshExpiresAt.Format(time.RFC3339),
+		SessionExpiresAt: tokens.SessionExpiresAt.Format(time.RFC3339),
+	}
 }
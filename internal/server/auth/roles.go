@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+// ServiceAccountPrefix starts the subject of every service account, so
+// service accounts can't be confused with users.
+const ServiceAccountPrefix = "service:"
+
+const (
+	RoleViewer   = "viewer"   // Read charts, their history and deploy results
+	RoleEditor   = "editor"   // Viewer, and commit to and manage charts
+	RoleDeployer = "deployer" // Viewer, and deploy charts and run agents
+	RoleAdmin    = "admin"    // Viewer, and export and import the instance
+)
+
+var ErrForbidden = errors.New("service account has no role binding allowing the request")
+
+// RoleBinding grants a role on the listed charts, or on every chart and the
+// endpoints not specific to one when Charts is empty.
+type RoleBinding struct {
+	Role   string   `json:"role" enums:"viewer,editor,deployer,admin"`
+	Charts []string `json:"charts,omitempty" example:"3fa85f64-5717-4562-b3fc-2c963f66afa6"`
+}
+
+// IsServiceAccount reports whether subject is a service account.
+func IsServiceAccount(subject string) bool {
+	return strings.HasPrefix(subject, ServiceAccountPrefix)
+}
+
+// ValidRole reports whether role is one bindings can grant.
+func ValidRole(role string) bool {
+	return role == RoleViewer || role == RoleEditor || role == RoleDeployer || role == RoleAdmin
+}
+
+// AllowsRole reports whether the bindings grant role on chartID, which is
+// empty for endpoints not specific to one chart. Editors, deployers and
+// admins are viewers too.
+func AllowsRole(bindings []RoleBinding, role, chartID string) bool {
+	for _, binding := range bindings {
+		if binding.Role != role && (role != RoleViewer || !ValidRole(binding.Role)) {
+			continue
+		}
+		if len(binding.Charts) == 0 || (chartID != "" && slices.Contains(binding.Charts, chartID)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package auth
+
+import "time"
+
+// Reasons a session is swept.
+const (
+	SessionExpired = "expired" // Every refresh token issued to it expired
+	SessionIdle    = "idle"    // No request used it for the idle timeout
+)
+
+// unissuedGrace is how long a session may wait for its first tokens, which
+// are issued right after it is stored.
+const unissuedGrace = time.Minute
+
+// SweptSession is a session ended by SweepSessions.
+type SweptSession struct {
+	Subject       string
+	Reason        string
+	HadPrivateKey bool // An unlocked private key was dropped with it
+}
+
+// SweepSessions ends the sessions no token can use anymore at now and, with
+// a positive idle, those no request used for that long, dropping their
+// unlocked private keys. Idle subjects have to log in again.
+func SweepSessions(now time.Time, idle time.Duration) []SweptSession {
+	privateKeyStore.mu.Lock()
+	defer privateKeyStore.mu.Unlock()
+
+	var swept []SweptSession
+	for subject, current := range privateKeyStore.sessions {
+		lastUsed := time.Unix(current.lastUsed.Load(), 0)
+		reason := ""
+		switch {
+		case current.expiresAt.IsZero() && now.Sub(lastUsed) > unissuedGrace:
+			reason = SessionExpired
+		case !current.expiresAt.IsZero() && !now.Before(current.expiresAt):
+			reason = SessionExpired
+		case idle > 0 && now.Sub(lastUsed) >= idle:
+			reason = SessionIdle
+		default:
+			continue
+		}
+		delete(privateKeyStore.sessions, subject)
+		swept = append(swept, SweptSession{Subject: subject, Reason: reason, HadPrivateKey: current.privateKey != ""})
+	}
+	return swept
+}
+
+// ActiveSessions counts the sessions held in memory.
+func ActiveSessions() int {
+	privateKeyStore.mu.RLock()
+	defer privateKeyStore.mu.RUnlock()
+	return len(privateKeyStore.sessions)
+}
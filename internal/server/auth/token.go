@@ -2,69 +2,223 @@ package auth
 
 import (
 	"errors"
+	"log"
 	"net/http"
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
 const (
-	accessTokenTTL  = 15 * time.Minute
-	refreshTokenTTL = 7 * 24 * time.Hour
+	defaultAccessTokenTTL     = 15 * time.Minute
+	defaultRefreshTokenTTL    = 7 * 24 * time.Hour
+	defaultSessionMaxLifetime = 30 * 24 * time.Hour
 )
 
 type tokenClaims struct {
-	TokenType string `json:"typ"`
+	TokenType string           `json:"typ"`
+	AuthTime  *jwt.NumericDate `json:"auth_time,omitempty"` // When the session logged in
+	Roles     []RoleBinding    `json:"roles,omitempty"`     // Role bindings of service accounts
 	jwt.RegisteredClaims
 }
 
+// Tokens are the tokens of a session and when they expire. Refreshing can't
+// extend the session past SessionExpiresAt.
+type Tokens struct {
+	AccessToken      string
+	RefreshToken     string
+	AccessExpiresAt  time.Time
+	RefreshExpiresAt time.Time
+	SessionExpiresAt time.Time
+}
+
+// sessionConfig is read from ACCESS_TOKEN_TTL and REFRESH_TOKEN_TTL, and, when
+// SESSION_SLIDING is "true", SESSION_MAX_LIFETIME. Without sliding sessions a
+// refreshed refresh token keeps the expiry of the login, so sessions last
+// REFRESH_TOKEN_TTL; with them every refresh extends the session by
+// REFRESH_TOKEN_TTL, up to SESSION_MAX_LIFETIME after the login.
+type sessionConfig struct {
+	accessTTL   time.Duration
+	refreshTTL  time.Duration
+	sliding     bool
+	maxLifetime time.Duration
+}
+
+func loadSessionConfig() sessionConfig {
+	config := sessionConfig{
+		accessTTL:  envDuration("ACCESS_TOKEN_TTL", defaultAccessTokenTTL),
+		refreshTTL: envDuration("REFRESH_TOKEN_TTL", defaultRefreshTokenTTL),
+		sliding:    os.Getenv("SESSION_SLIDING") == "true",
+	}
+	config.maxLifetime = config.refreshTTL
+	if config.sliding {
+		config.maxLifetime = max(envDuration("SESSION_MAX_LIFETIME", defaultSessionMaxLifetime), config.refreshTTL)
+	}
+	return config
+}
+
+// envDuration reads a positive duration from the environment, falling back to
+// fallback when it's unset or invalid.
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		log.Printf("Invalid %s %q, using %s", name, value, fallback)
+		return fallback
+	}
+	return parsed
+}
+
 var ErrLoggedOut = errors.New("User is logged out")
 
+// session is the server side of a login: the unlocked private key, when the
+// subject has one, until the last refresh token issued to it expires.
+type session struct {
+	privateKey string
+	expiresAt  time.Time    // Latest expiry of the refresh tokens issued
+	lastUsed   atomic.Int64 // Unix seconds of the last authenticated request
+}
+
 var privateKeyStore = struct {
-	mu   sync.RWMutex
-	keys map[string]string
+	mu       sync.RWMutex
+	sessions map[string]*session
 }{
-	keys: map[string]string{},
+	sessions: map[string]*session{},
+}
+
+// IssueTokens starts a session for subject.
+func IssueTokens(subject string) (Tokens, error) {
+	now := time.Now().UTC()
+	return issueTokens(subject, nil, now, now, time.Time{})
+}
+
+// IssueServiceTokens starts a session for a service account, whose tokens
+// only allow what roles grant.
+func IssueServiceTokens(subject string, roles []RoleBinding) (Tokens, error) {
+	now := time.Now().UTC()
+	return issueTokens(subject, roles, now, now, time.Time{})
 }
 
-func IssueTokens(subject string) (string, string, int64, error) {
+// IssueAccessToken signs an access token for the running session of subject
+// without extending it, for work the server does on behalf of subject. It
+// fails with ErrLoggedOut when subject has no session.
+func IssueAccessToken(subject string, roles []RoleBinding) (string, error) {
 	secret := os.Getenv("SESSION_SECRET")
 	if secret == "" {
-		return "", "", 0, errors.New("SESSION_SECRET is not configured")
+		return "", errors.New("SESSION_SECRET is not configured")
+	}
+
+	privateKeyStore.mu.RLock()
+	current, ok := privateKeyStore.sessions[subject]
+	var sessionExpiresAt time.Time
+	if ok {
+		sessionExpiresAt = current.expiresAt
+	}
+	privateKeyStore.mu.RUnlock()
+	if !ok {
+		return "", ErrLoggedOut
 	}
 
 	now := time.Now().UTC()
+	expiresAt := now.Add(loadSessionConfig().accessTTL)
+	if !sessionExpiresAt.IsZero() && expiresAt.After(sessionExpiresAt) {
+		expiresAt = sessionExpiresAt
+	}
+	claims := tokenClaims{
+		TokenType: "access",
+		AuthTime:  jwt.NewNumericDate(now),
+		Roles:     roles,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+}
+
+// RefreshTokens issues new tokens for the session of a refresh token, with
+// the current role bindings of service accounts. The session keeps its login
+// time, and its refresh token its expiry unless sessions slide.
+func RefreshTokens(claims *tokenClaims, roles []RoleBinding) (Tokens, error) {
+	authTime := claims.IssuedAt
+	if claims.AuthTime != nil {
+		authTime = claims.AuthTime
+	}
+	if authTime == nil || claims.ExpiresAt == nil {
+		return Tokens{}, errors.New("invalid token")
+	}
+	return issueTokens(claims.Subject, roles, time.Now().UTC(), authTime.Time, claims.ExpiresAt.Time)
+}
+
+// issueTokens signs the tokens of a session that logged in at authTime. A
+// non-zero refreshExpiresAt is the expiry of the refresh token being
+// refreshed.
+func issueTokens(subject string, roles []RoleBinding, now, authTime, refreshExpiresAt time.Time) (Tokens, error) {
+	secret := os.Getenv("SESSION_SECRET")
+	if secret == "" {
+		return Tokens{}, errors.New("SESSION_SECRET is not configured")
+	}
+
+	config := loadSessionConfig()
+	tokens := Tokens{
+		AccessExpiresAt:  now.Add(config.accessTTL),
+		RefreshExpiresAt: now.Add(config.refreshTTL),
+		SessionExpiresAt: authTime.Add(config.maxLifetime),
+	}
+	if !config.sliding && !refreshExpiresAt.IsZero() {
+		tokens.RefreshExpiresAt = refreshExpiresAt
+	}
+	if tokens.RefreshExpiresAt.After(tokens.SessionExpiresAt) {
+		tokens.RefreshExpiresAt = tokens.SessionExpiresAt
+	}
+	if !tokens.RefreshExpiresAt.After(now) {
+		return Tokens{}, errors.New("session expired")
+	}
+	if tokens.AccessExpiresAt.After(tokens.RefreshExpiresAt) {
+		tokens.AccessExpiresAt = tokens.RefreshExpiresAt
+	}
+
 	accessClaims := tokenClaims{
 		TokenType: "access",
+		AuthTime:  jwt.NewNumericDate(authTime),
+		Roles:     roles,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Subject:   subject,
 			IssuedAt:  jwt.NewNumericDate(now),
-			ExpiresAt: jwt.NewNumericDate(now.Add(accessTokenTTL)),
+			ExpiresAt: jwt.NewNumericDate(tokens.AccessExpiresAt),
 		},
 	}
 	refreshClaims := tokenClaims{
 		TokenType: "refresh",
+		AuthTime:  jwt.NewNumericDate(authTime),
 		RegisteredClaims: jwt.RegisteredClaims{
 			Subject:   subject,
 			IssuedAt:  jwt.NewNumericDate(now),
-			ExpiresAt: jwt.NewNumericDate(now.Add(refreshTokenTTL)),
+			ExpiresAt: jwt.NewNumericDate(tokens.RefreshExpiresAt),
 		},
 	}
 
-	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims).SignedString([]byte(secret))
+	var err error
+	tokens.AccessToken, err = jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims).SignedString([]byte(secret))
 	if err != nil {
-		return "", "", 0, err
+		return Tokens{}, err
 	}
 
-	refreshToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims).SignedString([]byte(secret))
+	tokens.RefreshToken, err = jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims).SignedString([]byte(secret))
 	if err != nil {
-		return "", "", 0, err
+		return Tokens{}, err
 	}
 
-	return accessToken, refreshToken, int64(accessTokenTTL.Seconds()), nil
+	extendSession(subject, tokens.RefreshExpiresAt)
+	return tokens, nil
 }
 
 func ParseToken(token string) (*tokenClaims, error) {
@@ -103,31 +257,31 @@ func RequireAccessTokenClaims(r *http.Request) (*tokenClaims, error) {
 	if claims.TokenType != "access" {
 		return nil, errors.New("invalid token type")
 	}
-	if _, ok := PrivateKeyForSubject(claims.Subject); !ok {
+	if !hasSession(claims.Subject) {
 		return nil, ErrLoggedOut
 	}
 
 	return claims, nil
 }
 
-func RequireAccessTokenFromBasicAuth(r *http.Request, expectedUser string) error {
+func RequireAccessTokenFromBasicAuth(r *http.Request, expectedUser string) (*tokenClaims, error) {
 	user, token, ok := r.BasicAuth()
 	if !ok || user != expectedUser || strings.TrimSpace(token) == "" {
-		return errors.New("missing basic auth token")
+		return nil, errors.New("missing basic auth token")
 	}
 
 	claims, err := ParseToken(token)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if claims.TokenType != "access" {
-		return errors.New("invalid token type")
+		return nil, errors.New("invalid token type")
 	}
-	if _, ok := PrivateKeyForSubject(claims.Subject); !ok {
-		return ErrLoggedOut
+	if !hasSession(claims.Subject) {
+		return nil, ErrLoggedOut
 	}
 
-	return nil
+	return claims, nil
 }
 
 func RequireRefreshToken(r *http.Request) (*tokenClaims, error) {
@@ -143,7 +297,7 @@ func RequireRefreshToken(r *http.Request) (*tokenClaims, error) {
 	if claims.TokenType != "refresh" {
 		return nil, errors.New("invalid token type")
 	}
-	if _, ok := PrivateKeyForSubject(claims.Subject); !ok {
+	if !hasSession(claims.Subject) {
 		return nil, ErrLoggedOut
 	}
 
@@ -170,18 +324,65 @@ func RefreshTokenFromRequest(r *http.Request) string {
 
 func StorePrivateKey(subject, privateKey string) {
 	privateKey = strings.TrimSpace(privateKey)
-	privateKeyStore.mu.Lock()
-	defer privateKeyStore.mu.Unlock()
 	if privateKey == "" {
-		delete(privateKeyStore.keys, subject)
+		EndSession(subject)
 		return
 	}
-	privateKeyStore.keys[subject] = privateKey
+	storeSession(subject, privateKey)
+}
+
+// StoreServiceSession starts the session of a service account, which may
+// have no SSH key pair.
+func StoreServiceSession(subject, privateKey string) {
+	storeSession(subject, strings.TrimSpace(privateKey))
+}
+
+// storeSession starts or renews the session of subject. Logins share the
+// session, so tokens of an earlier login keep it alive until they expire.
+func storeSession(subject, privateKey string) {
+	privateKeyStore.mu.Lock()
+	defer privateKeyStore.mu.Unlock()
+	current := &session{privateKey: privateKey}
+	if previous, ok := privateKeyStore.sessions[subject]; ok {
+		current.expiresAt = previous.expiresAt
+	}
+	current.lastUsed.Store(time.Now().Unix())
+	privateKeyStore.sessions[subject] = current
+}
+
+// extendSession keeps the session of subject until at least expiresAt, when
+// a refresh token issued to it expires.
+func extendSession(subject string, expiresAt time.Time) {
+	privateKeyStore.mu.Lock()
+	defer privateKeyStore.mu.Unlock()
+	if current, ok := privateKeyStore.sessions[subject]; ok && expiresAt.After(current.expiresAt) {
+		current.expiresAt = expiresAt
+	}
+}
+
+// EndSession logs subject out, invalidating every token issued to it.
+func EndSession(subject string) {
+	privateKeyStore.mu.Lock()
+	defer privateKeyStore.mu.Unlock()
+	delete(privateKeyStore.sessions, subject)
 }
 
 func PrivateKeyForSubject(subject string) (string, bool) {
 	privateKeyStore.mu.RLock()
 	defer privateKeyStore.mu.RUnlock()
-	privateKey, ok := privateKeyStore.keys[subject]
-	return privateKey, ok
+	current, ok := privateKeyStore.sessions[subject]
+	if !ok || current.privateKey == "" {
+		return "", false
+	}
+	return current.privateKey, true
+}
+
+func hasSession(subject string) bool {
+	privateKeyStore.mu.RLock()
+	defer privateKeyStore.mu.RUnlock()
+	current, ok := privateKeyStore.sessions[subject]
+	if ok {
+		current.lastUsed.Store(time.Now().Unix())
+	}
+	return ok
 }
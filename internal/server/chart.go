@@ -2,11 +2,20 @@ package server
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"io"
+	"log"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/go-git/go-billy/v5/osfs"
 	"github.com/go-git/go-git/v5"
@@ -16,7 +25,6 @@ import (
 	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
 	"github.com/go-git/go-git/v5/plumbing/transport"
 	gitsrv "github.com/go-git/go-git/v5/plumbing/transport/server"
-	"github.com/google/uuid"
 	"github.com/mtolmacs/planemgr/internal/server/auth"
 	"github.com/mtolmacs/planemgr/internal/server/chart"
 )
@@ -25,8 +33,38 @@ type chartResponse struct {
 	ChartID string `json:"chartId,omitempty"`
 }
 
+const (
+	defaultChartListLimit = 100
+	maxChartListLimit     = 500
+
+	chartSortID         = "id"
+	chartSortLastCommit = "lastCommit"
+
+	// chartEncodingBase64 marks file contents carried as base64, for binary
+	// files JSON strings can't hold.
+	chartEncodingBase64 = "base64"
+
+	// defaultChartFileInlineKB caps the files returned inside JSON, as base64
+	// and JSON escaping inflate large files well past their size.
+	defaultChartFileInlineKB = 1024
+)
+
 type chartListResponse struct {
-	ChartIDs []string `json:"chartIds"`
+	Charts     []chartListEntry `json:"charts"`
+	Total      int              `json:"total"`
+	Offset     int              `json:"offset"`
+	Limit      int              `json:"limit"`
+	NextOffset *int             `json:"nextOffset,omitempty"`
+}
+
+type chartListEntry struct {
+	ChartID      string `json:"chartId"`
+	Archived     bool   `json:"archived,omitempty"`
+	Head         string `json:"head,omitempty" example:"main"` // Branch HEAD points at
+	Ref          string `json:"ref,omitempty"`                 // Commit of the branch, omitted before the first commit
+	LastCommitAt string `json:"lastCommitAt,omitempty" example:"2026-01-02T15:04:05Z"`
+	FileCount    int    `json:"fileCount"`
+	lastCommit   time.Time
 }
 
 type chartTreeResponse struct {
@@ -35,6 +73,25 @@ type chartTreeResponse struct {
 	Files   []string `json:"files"`
 }
 
+// chartTreeEntriesResponse is the listing of one level, or a few, of a chart
+// tree.
+type chartTreeEntriesResponse struct {
+	ChartID string           `json:"chartId"`
+	Ref     string           `json:"ref"`
+	Path    string           `json:"path"`
+	Entries []chartTreeEntry `json:"entries"`
+}
+
+type chartTreeEntry struct {
+	Path         string `json:"path"`
+	Type         string `json:"type" enums:"file,dir"`
+	Hash         string `json:"hash"`
+	Mode         string `json:"mode" example:"100644"`
+	Size         int64  `json:"size"` // Blob size of files in bytes
+	LastCommit   string `json:"lastCommit"`
+	LastCommitAt string `json:"lastCommitAt" example:"2026-01-02T15:04:05Z"`
+}
+
 type chartCommitResponse struct {
 	ChartID string   `json:"chartId"`
 	Ref     string   `json:"ref"`
@@ -42,20 +99,33 @@ type chartCommitResponse struct {
 }
 
 type chartFileResponse struct {
-	ChartID  string `json:"chartId"`
-	Ref      string `json:"ref"`
-	Path     string `json:"path"`
-	Contents string `json:"contents"`
+	ChartID     string `json:"chartId"`
+	Ref         string `json:"ref"`
+	Path        string `json:"path"`
+	ContentType string `json:"contentType" example:"application/json"`
+	Size        int64  `json:"size"`
+	Contents    string `json:"contents"`
+	Encoding    string `json:"encoding,omitempty" enums:"base64"`
 }
 
 type chartFileUpdate struct {
-	Path    string `json:"path"`
-	Content string `json:"content"`
+	Path     string `json:"path" example:"main.tf.json"`
+	Content  string `json:"content" example:"{}"`
+	Encoding string `json:"encoding,omitempty" enums:"base64"`
+	Delete   bool   `json:"delete,omitempty"`
+	OldPath  string `json:"oldPath,omitempty" example:"network.tf.json"`
+	NewPath  string `json:"newPath,omitempty" example:"vpc.tf.json"`
 }
 
 type chartCommitRequest struct {
-	Message string            `json:"message"`
+	Message string            `json:"message" example:"Add VPC"`
 	Files   []chartFileUpdate `json:"files"`
+	// ExpectedRef is the commit the branch must still be at, so concurrent
+	// edits aren't overwritten. The If-Match header can carry it instead.
+	ExpectedRef string `json:"expectedRef,omitempty" example:"9fceb02d0ae598e95dc970b74767f19372d61af8"`
+	// Validate rejects the commit when a written .tf.json file isn't valid
+	// Terraform JSON configuration, or a .tf or .tfvars file isn't valid HCL.
+	Validate bool `json:"validate,omitempty"`
 }
 
 // Handle /api/chart requests.
@@ -78,21 +148,104 @@ func HandleChartCollection(w http.ResponseWriter, r *http.Request) {
 
 // Handle GET /api/chart requests.
 // @Summary List charts
-// @Description Lists all available charts.
+// @Description Lists charts a page at a time with the branch and commit of their HEAD, when it was committed and how many files it has. Archived charts are only listed, marked archived, when requested. With watch and the X-Watch-Cursor of the last response in since, the request waits until charts are created, deleted, archived or committed to. Charts can be filtered by ID and sorted by ID or by last commit, newest first; charts without commits sort last.
 // @Tags chart
 // @Security BearerAuth
+// @Param archived query bool false "Also list archived charts"
+// @Param q query string false "Only list charts whose ID contains this text"
+// @Param sort query string false "Sort by id (default) or lastCommit"
+// @Param offset query int false "Number of charts to skip"
+// @Param limit query int false "Maximum number of charts (default 100, max 500)"
+// @Param fields query string false "Comma-separated chart fields to return, such as chartId,lastCommitAt"
+// @Param watch query bool false "Wait up to 30 seconds for a change when since is the current cursor"
+// @Param since query string false "X-Watch-Cursor of the last response"
 // @Success 200 {object} chartListResponse
+// @Failure 400 {object} errorResponse "`invalid pagination`, `invalid sort`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 500 {object} errorResponse "`failed to list charts`"
 // @Router /chart [get]
-func HandleChartList(w http.ResponseWriter, _ *http.Request) {
+func HandleChartList(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	offset, limit, ok := paginationParams(r, defaultChartListLimit, maxChartListLimit)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid pagination"})
+		return
+	}
+	sortBy := query.Get("sort")
+	if sortBy == "" {
+		sortBy = chartSortID
+	}
+	if sortBy != chartSortID && sortBy != chartSortLastCommit {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid sort"})
+		return
+	}
+	if !watchChanges(w, r, watchTopicCharts) {
+		return
+	}
+
 	charts, err := chart.ListChartRepos()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list charts"})
 		return
 	}
 
-	writeJSON(w, http.StatusOK, chartListResponse{
-		ChartIDs: charts,
+	includeArchived := query.Get("archived") == "true"
+	filter := strings.ToLower(query.Get("q"))
+	entries := []chartListEntry{}
+	for _, chartID := range charts {
+		if filter != "" && !strings.Contains(strings.ToLower(chartID), filter) {
+			continue
+		}
+		archived, err := isChartArchived(chartID)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list charts"})
+			return
+		}
+		if archived && !includeArchived {
+			continue
+		}
+
+		head, err := chart.ReadChartHead(chartID)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list charts"})
+			return
+		}
+		entry := chartListEntry{
+			ChartID:    chartID,
+			Archived:   archived,
+			Head:       head.Branch,
+			Ref:        head.Ref,
+			FileCount:  head.FileCount,
+			lastCommit: head.When,
+		}
+		if head.Ref != "" {
+			entry.LastCommitAt = head.When.UTC().Format(time.RFC3339)
+		}
+		entries = append(entries, entry)
+	}
+
+	slices.SortFunc(entries, func(a, b chartListEntry) int {
+		if sortBy == chartSortLastCommit {
+			if c := b.lastCommit.Compare(a.lastCommit); c != 0 {
+				return c
+			}
+		}
+		return strings.Compare(a.ChartID, b.ChartID)
 	})
+
+	page := entries[min(offset, len(entries)):min(offset+limit, len(entries))]
+	response := chartListResponse{
+		Charts: page,
+		Total:  len(entries),
+		Offset: offset,
+		Limit:  limit,
+	}
+	if next := offset + len(page); next < len(entries) {
+		response.NextOffset = &next
+	}
+
+	writeJSONFields(w, r, http.StatusOK, response, "charts")
 }
 
 // Handle POST /api/chart requests.
@@ -101,6 +254,9 @@ func HandleChartList(w http.ResponseWriter, _ *http.Request) {
 // @Tags chart
 // @Security BearerAuth
 // @Success 201 {object} chartResponse
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 500 {object} errorResponse "`failed to create chart`, `failed to initialize chart`"
 // @Router /chart [post]
 func HandleChartCreate(w http.ResponseWriter, _ *http.Request) {
 	chartID, err := chart.CreateChartRepo()
@@ -114,11 +270,12 @@ func HandleChartCreate(w http.ResponseWriter, _ *http.Request) {
 			Path:    "main.tf.json",
 			Content: "{}",
 		},
-	}, "Initialization")
+	}, "Initialization", "")
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to initialize chart"})
 		return
 	}
+	publishChartChange(chartID)
 
 	writeJSON(w, http.StatusCreated, chartResponse{
 		ChartID: chartID,
@@ -127,7 +284,8 @@ func HandleChartCreate(w http.ResponseWriter, _ *http.Request) {
 
 // Handle /api/chart/{id} requests.
 func HandleChartEntity(w http.ResponseWriter, r *http.Request) {
-	if _, err := auth.RequireAccessTokenClaims(r); err != nil {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
 		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
 		return
 	}
@@ -138,21 +296,33 @@ func HandleChartEntity(w http.ResponseWriter, r *http.Request) {
 	case http.MethodGet:
 		HandleChartFileGet(w, r)
 	case http.MethodPut:
-		HandleChartPut(w, r)
+		HandleChartPut(w, r, claims.Subject)
+	case http.MethodPatch:
+		HandleChartPatch(w, r, claims.Subject)
+	case http.MethodDelete:
+		HandleChartDelete(w, r, claims.Subject)
 	default:
-		w.Header().Set("Allow", "HEAD, GET, PUT")
+		w.Header().Set("Allow", "HEAD, GET, PUT, PATCH, DELETE")
 		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
 	}
 }
 
 // Handle HEAD /api/chart/{id} requests.
 // @Summary List chart files
-// @Description Returns a recursive listing of files for a chart at a ref.
+// @Description Returns a recursive listing of files for a chart at a ref. With path or depth, returns the entries of the directory at path instead, directories included, and of its subdirectories up to depth levels down (1 by default, the directory alone), so large trees can be loaded lazily. Entries carry their mode, the size of files and the last commit on the first-parent line that changed them. With at, the listing is of the commit the ref pointed to at that time, following its first parents.
 // @Tags chart
 // @Security BearerAuth
 // @Param id path string true "Chart ID"
 // @Param ref query string false "Git ref (defaults to HEAD)"
-// @Success 200 {object} chartTreeResponse
+// @Param at query string false "RFC 3339 timestamp; resolves ref to the commit it pointed to at that time"
+// @Param path query string false "Directory to list (defaults to the root)"
+// @Param depth query int false "Directory levels to list" minimum(1)
+// @Success 200 {object} chartTreeResponse "Recursive listing, or a chartTreeEntriesResponse with path or depth"
+// @Failure 400 {object} errorResponse "`invalid chart id`, `chart id required`, `depth must be a positive integer`, `invalid chart file path`, `at must be an RFC 3339 timestamp`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart not found`, `chart ref not found`, `chart directory not found`, `no chart commit at that time`"
+// @Failure 500 {object} errorResponse "`failed to list chart files`, `failed to resolve chart ref`"
 // @Router /chart/{id} [head]
 func HandleChartHead(w http.ResponseWriter, r *http.Request) {
 	chartID := r.PathValue("id")
@@ -161,7 +331,16 @@ func HandleChartHead(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ref := r.URL.Query().Get("ref")
+	query := r.URL.Query()
+	if query.Has("path") || query.Has("depth") {
+		handleChartTreeEntries(w, r, chartID)
+		return
+	}
+
+	ref, ok := chartQueryRef(w, r, chartID, "ref", "at")
+	if !ok {
+		return
+	}
 	resolvedRef, files, err := chart.ListChartTree(chartID, ref)
 	if err != nil {
 		if errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist) {
@@ -177,6 +356,9 @@ func HandleChartHead(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if resolvedRef != "" {
+		w.Header().Set("ETag", `"`+resolvedRef+`"`)
+	}
 	writeJSON(w, http.StatusOK, chartTreeResponse{
 		ChartID: chartID,
 		Ref:     resolvedRef,
@@ -184,15 +366,81 @@ func HandleChartHead(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func handleChartTreeEntries(w http.ResponseWriter, r *http.Request, chartID string) {
+	depth := 1
+	if value := r.URL.Query().Get("depth"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "depth must be a positive integer"})
+			return
+		}
+		depth = parsed
+	}
+	dirPath := strings.Trim(r.URL.Query().Get("path"), "/")
+
+	ref, ok := chartQueryRef(w, r, chartID, "ref", "at")
+	if !ok {
+		return
+	}
+	resolvedRef, entries, err := chart.ListChartTreeEntries(chartID, ref, dirPath, depth)
+	if err != nil {
+		switch {
+		case errors.Is(err, chart.ErrInvalidPath):
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		case errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart not found"})
+		case errors.Is(err, plumbing.ErrReferenceNotFound):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart ref not found"})
+		case errors.Is(err, object.ErrDirectoryNotFound):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart directory not found"})
+		default:
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list chart files"})
+		}
+		return
+	}
+
+	response := chartTreeEntriesResponse{
+		ChartID: chartID,
+		Ref:     resolvedRef,
+		Path:    dirPath,
+		Entries: make([]chartTreeEntry, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		response.Entries = append(response.Entries, chartTreeEntry{
+			Path:         entry.Path,
+			Type:         entry.Type,
+			Hash:         entry.Hash,
+			Mode:         entry.Mode,
+			Size:         entry.Size,
+			LastCommit:   entry.LastCommit,
+			LastCommitAt: entry.LastCommitAt.UTC().Format(time.RFC3339),
+		})
+	}
+	if resolvedRef != "" {
+		w.Header().Set("ETag", `"`+resolvedRef+`"`)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
 // Handle GET /api/chart/{id} requests.
 // @Summary Get chart file
-// @Description Returns the contents of a file in a chart at a ref.
+// @Description Returns the contents of a file in a chart at a ref. Contents are base64 encoded, with encoding set to "base64", when asked for or when the file isn't valid UTF-8. contentType is guessed from the file name or content and size is in bytes. Files larger than CHART_FILE_INLINE_KB (1024 by default) aren't inlined; 422 is returned with a raw link to the raw endpoint instead. With at, the file is read from the commit the ref pointed to at that time. The ETag is the blob hash, so polling with If-None-Match gets 304 until the content changes; X-Chart-Ref is the commit the file was read from.
 // @Tags chart
 // @Security BearerAuth
 // @Param id path string true "Chart ID"
 // @Param file query string true "File path in the chart repo"
 // @Param ref query string false "Git ref (defaults to HEAD)"
+// @Param at query string false "RFC 3339 timestamp; resolves ref to the commit it pointed to at that time"
+// @Param encoding query string false "Set to base64 to always get base64 encoded contents" Enums(base64)
+// @Param If-None-Match header string false "Blob hash of the content the client has"
 // @Success 200 {object} chartFileResponse
+// @Success 304
+// @Failure 400 {object} errorResponse "`invalid chart id`, `chart id required`, `file required`, `unsupported encoding`, `at must be an RFC 3339 timestamp`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart not found`, `chart ref not found`, `chart file not found`, `no chart commit at that time`"
+// @Failure 422 {object} errorResponse "`chart path is a symlink`, `chart file too large to inline`"
+// @Failure 500 {object} errorResponse "`failed to read chart file`, `failed to resolve chart ref`"
 // @Router /chart/{id} [get]
 func HandleChartFileGet(w http.ResponseWriter, r *http.Request) {
 	chartID := r.PathValue("id")
@@ -206,9 +454,17 @@ func HandleChartFileGet(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "file required"})
 		return
 	}
+	encoding := r.URL.Query().Get("encoding")
+	if encoding != "" && encoding != chartEncodingBase64 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported encoding"})
+		return
+	}
 
-	ref := r.URL.Query().Get("ref")
-	resolvedRef, contents, err := chart.ReadChartFile(chartID, filePath, ref)
+	ref, ok := chartQueryRef(w, r, chartID, "ref", "at")
+	if !ok {
+		return
+	}
+	file, err := chart.OpenChartFile(chartID, filePath, ref)
 	if err != nil {
 		if errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist) {
 			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart not found"})
@@ -218,38 +474,96 @@ func HandleChartFileGet(w http.ResponseWriter, r *http.Request) {
 			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart ref not found"})
 			return
 		}
-		if errors.Is(err, object.ErrFileNotFound) {
+		if errors.Is(err, object.ErrFileNotFound) || errors.Is(err, object.ErrDirectoryNotFound) {
 			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart file not found"})
 			return
 		}
+		if errors.Is(err, chart.ErrPathIsSymlink) {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": "chart path is a symlink"})
+			return
+		}
+
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read chart file"})
+		return
+	}
+	defer file.Close()
+
+	etag := `"` + file.Hash + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Chart-Ref", file.Ref)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if limit := chartFileInlineLimit(); limit > 0 && file.Size > limit {
+		query := url.Values{"file": {filePath}, "ref": {file.Ref}}
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{
+			"error": "chart file too large to inline",
+			"raw":   "/api/chart/" + chartID + "/raw?" + query.Encode(),
+		})
+		return
+	}
 
+	data, err := io.ReadAll(file)
+	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read chart file"})
 		return
 	}
+	contentType := chartFileContentType(filePath, data[:min(len(data), 512)])
+	contents, encoding := encodeChartFileContents(string(data), encoding)
 
 	writeJSON(w, http.StatusOK, chartFileResponse{
-		ChartID:  chartID,
-		Ref:      resolvedRef,
-		Path:     filePath,
-		Contents: contents,
+		ChartID:     chartID,
+		Ref:         file.Ref,
+		Path:        filePath,
+		ContentType: contentType,
+		Size:        file.Size,
+		Contents:    contents,
+		Encoding:    encoding,
 	})
 }
 
+// encodeChartFileContents base64 encodes file contents when encoding asks for
+// it or when they aren't valid UTF-8, as JSON strings would replace invalid
+// UTF-8 and corrupt binary files. It returns the encoding used.
+func encodeChartFileContents(contents, encoding string) (string, string) {
+	if encoding == "" && !utf8.ValidString(contents) {
+		encoding = chartEncodingBase64
+	}
+	if encoding == chartEncodingBase64 {
+		contents = base64.StdEncoding.EncodeToString([]byte(contents))
+	}
+	return contents, encoding
+}
+
 // Handle PUT /api/chart/{id} requests.
-// @Summary Create or replace whole files in chart
-// @Description Writes files to a chart and commits the change.
+// @Summary Create, replace, delete or move whole files in chart
+// @Description Writes files to a chart and commits the change. Entries with "encoding": "base64" carry base64 encoded content, for binary files. Entries with "delete": true remove the path instead, and entries with "oldPath" and "newPath" move a file without changing its content. With expectedRef, or an If-Match header, holding the commit the edit was based on, nothing is committed and 409 is returned with the current ref when the branch moved since. With "validate": true, written .tf.json files must be well-formed Terraform JSON configuration and .tf and .tfvars files valid HCL, or nothing is committed and 422 is returned. Writes breaking the chart commit policy are rejected with 422 and the reason.
 // @Tags chart
 // @Security BearerAuth
 // @Param id path string true "Chart ID"
 // @Param request body chartCommitRequest true "Commit payload"
+// @Param If-Match header string false "Commit the branch must still be at, as returned in the ETag of tree listings or the X-Chart-Ref header of file reads"
 // @Success 200 {object} chartCommitResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`, `chart id required`, `invalid request body`, `message required`, `files required`, `moved files require only oldPath and newPath`, `file path required`, `deleted files cannot have content`, `invalid base64 content`, `unsupported encoding`, `expectedRef and If-Match differ`, `invalid file path`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart not found`, `chart file not found`, `chart_not_found`"
+// @Failure 409 {object} errorResponse "`chart branch moved past the expected commit`, `chart file already exists`, `chart changed concurrently, retry`"
+// @Failure 422 {object} errorResponse "the path of the invalid file and the validation error, `commit rejected by policy`"
+// @Failure 423 {object} errorResponse "`chart_locked`"
+// @Failure 500 {object} errorResponse "`failed to write chart file`, `chart_settings_failed`"
 // @Router /chart/{id} [put]
-func HandleChartPut(w http.ResponseWriter, r *http.Request) {
+func HandleChartPut(w http.ResponseWriter, r *http.Request, subject string) {
 	chartID := r.PathValue("id")
 	if chartID == "" {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "chart id required"})
 		return
 	}
+	if !requireChartUnlocked(w, chartID, subject) {
+		return
+	}
 
 	var req chartCommitRequest
 	decoder := json.NewDecoder(r.Body)
@@ -270,20 +584,81 @@ func HandleChartPut(w http.ResponseWriter, r *http.Request) {
 	updates := make([]chart.FileUpdate, 0, len(req.Files))
 	paths := make([]string, 0, len(req.Files))
 	for _, file := range req.Files {
+		if file.OldPath != "" || file.NewPath != "" {
+			if file.OldPath == "" || file.NewPath == "" || file.Path != "" || file.Content != "" || file.Encoding != "" || file.Delete {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "moved files require only oldPath and newPath"})
+				return
+			}
+			updates = append(updates, chart.FileUpdate{
+				Path:    file.NewPath,
+				OldPath: file.OldPath,
+			})
+			paths = append(paths, file.OldPath, file.NewPath)
+			continue
+		}
 		if file.Path == "" {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "file path required"})
 			return
 		}
+		if file.Delete && file.Content != "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "deleted files cannot have content"})
+			return
+		}
+		content := file.Content
+		switch file.Encoding {
+		case "":
+		case chartEncodingBase64:
+			decoded, err := base64.StdEncoding.DecodeString(content)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid base64 content"})
+				return
+			}
+			content = string(decoded)
+		default:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported encoding"})
+			return
+		}
+		if req.Validate && !file.Delete {
+			var err error
+			switch {
+			case chart.IsTerraformJSON(file.Path):
+				err = chart.ValidateTerraformJSON([]byte(content))
+			case chart.IsHCL(file.Path):
+				err = chart.ValidateHCL(file.Path, []byte(content))
+			}
+			if err != nil {
+				writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": file.Path + ": " + err.Error()})
+				return
+			}
+		}
 		updates = append(updates, chart.FileUpdate{
 			Path:    file.Path,
-			Content: file.Content,
+			Content: content,
+			Delete:  file.Delete,
 		})
 		paths = append(paths, file.Path)
 	}
 
-	commitRef, err := chart.WriteChartFiles(chartID, updates, req.Message)
+	expectedRef := req.ExpectedRef
+	if match := strings.Trim(strings.TrimPrefix(r.Header.Get("If-Match"), "W/"), `"`); match != "" && match != "*" {
+		if expectedRef != "" && expectedRef != match {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "expectedRef and If-Match differ"})
+			return
+		}
+		expectedRef = match
+	}
+
+	commitRef, err := chart.WriteChartFiles(chartID, updates, req.Message, expectedRef)
 	if err != nil {
-		if errors.Is(err, chart.ErrInvalidPath) || errors.Is(err, chart.ErrPathIsDirectory) {
+		if writeCommitPolicyError(w, err) {
+			return
+		}
+		if errors.Is(err, chart.ErrBranchMoved) || (expectedRef != "" && errors.Is(err, chart.ErrHistoryChanged)) {
+			current, _ := chart.ResolveChartRef(chartID, "")
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "chart branch moved past the expected commit", "ref": current})
+			return
+		}
+		if errors.Is(err, chart.ErrInvalidPath) || errors.Is(err, chart.ErrPathIsDirectory) || errors.Is(err, chart.ErrUnsafeTree) {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid file path"})
 			return
 		}
@@ -291,11 +666,25 @@ func HandleChartPut(w http.ResponseWriter, r *http.Request) {
 			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart not found"})
 			return
 		}
+		if errors.Is(err, object.ErrFileNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart file not found"})
+			return
+		}
+		if errors.Is(err, chart.ErrPathExists) {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "chart file already exists"})
+			return
+		}
+		if errors.Is(err, chart.ErrHistoryChanged) {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "chart changed concurrently, retry"})
+			return
+		}
 
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to write chart file"})
 		return
 	}
 
+	notifyChartCommit(chartID, commitRef, req.Message, paths)
+
 	writeJSON(w, http.StatusOK, chartCommitResponse{
 		ChartID: chartID,
 		Ref:     commitRef,
@@ -303,26 +692,161 @@ func HandleChartPut(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// HandleChartGit serves a read-only smart HTTP git endpoint for chart repos.
-func HandleChartGit(w http.ResponseWriter, r *http.Request) {
-	if err := auth.RequireAccessTokenFromBasicAuth(r, "access"); err != nil {
-		w.Header().Set("WWW-Authenticate", `Basic realm="planemgr"`)
-		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
-		return
-	}
+// Content types of the patch documents PATCH /api/chart/{id} accepts.
+var chartPatchTypes = map[string]string{
+	"application/json-patch+json":  chart.PatchJSON,
+	"application/merge-patch+json": chart.PatchMerge,
+}
 
+// Handle PATCH /api/chart/{id} requests.
+// @Summary Patch a JSON file in chart
+// @Description Applies an RFC 6902 JSON Patch (Content-Type application/json-patch+json) or RFC 7386 JSON Merge Patch (Content-Type application/merge-patch+json) document to a JSON file of the chart, such as main.tf.json, and commits the result. The patch is applied to the latest commit, so changes committed meanwhile are never overwritten; use a JSON Patch "test" operation to make the patch depend on a value. The file keeps its key order and indentation. A patch that changes nothing returns the current commit without committing.
+// @Tags chart
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Param file query string true "Path of the JSON file"
+// @Param message query string false "Commit message, defaults to Patch followed by the file path"
+// @Param request body object true "JSON Patch or JSON Merge Patch document"
+// @Success 200 {object} chartCommitResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`, `chart id required`, `file query parameter required`, `invalid request body`, `invalid file path`, `invalid patch document`, `chart file is not a JSON document`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart not found`, `chart file not found`, `chart_not_found`"
+// @Failure 409 {object} errorResponse "`chart changed concurrently, retry`, `patch does not apply to the chart file`"
+// @Failure 415 {object} errorResponse "`unsupported patch content type`"
+// @Failure 422 {object} errorResponse "`commit rejected by policy`"
+// @Failure 423 {object} errorResponse "`chart_locked`"
+// @Failure 500 {object} errorResponse "`failed to patch chart file`, `chart_settings_failed`"
+// @Router /chart/{id} [patch]
+func HandleChartPatch(w http.ResponseWriter, r *http.Request, subject string) {
 	chartID := r.PathValue("id")
 	if chartID == "" {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "chart id required"})
 		return
 	}
+	if !requireChartUnlocked(w, chartID, subject) {
+		return
+	}
 
-	trimmedChartID := strings.TrimSuffix(chartID, ".git")
-	if _, err := uuid.Parse(trimmedChartID); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid chart id"})
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	kind, ok := chartPatchTypes[mediaType]
+	if !ok {
+		w.Header().Set("Accept-Patch", "application/json-patch+json, application/merge-patch+json")
+		writeJSON(w, http.StatusUnsupportedMediaType, map[string]string{"error": "unsupported patch content type"})
+		return
+	}
+
+	filePath := r.URL.Query().Get("file")
+	if filePath == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "file query parameter required"})
+		return
+	}
+	message := strings.TrimSpace(r.URL.Query().Get("message"))
+	if message == "" {
+		message = "Patch " + filePath
+	}
+
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
 		return
 	}
 
+	commitRef, changed, err := chart.PatchChartFile(chartID, filePath, kind, patch, message)
+	if err != nil {
+		if writeCommitPolicyError(w, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, chart.ErrInvalidPath):
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid file path"})
+		case errors.Is(err, chart.ErrInvalidPatch) || errors.Is(err, chart.ErrNotJSON):
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		case errors.Is(err, chart.ErrPatchConflict):
+			writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		case errors.Is(err, chart.ErrHistoryChanged):
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "chart changed concurrently, retry"})
+		case errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart not found"})
+		case errors.Is(err, object.ErrFileNotFound) || errors.Is(err, object.ErrDirectoryNotFound):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart file not found"})
+		default:
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to patch chart file"})
+		}
+		return
+	}
+
+	files := []string{}
+	if changed {
+		files = append(files, filePath)
+		notifyChartCommit(chartID, commitRef, message, files)
+	}
+
+	writeJSON(w, http.StatusOK, chartCommitResponse{
+		ChartID: chartID,
+		Ref:     commitRef,
+		Files:   files,
+	})
+}
+
+// Handle DELETE /api/chart/{id} requests.
+// @Summary Delete chart
+// @Description Moves a chart repository to the trash, where it can be restored until CHART_TRASH_RETENTION (30 days by default) passes. Fails with 409 while a deploy of the chart is running.
+// @Tags chart
+// @Security BearerAuth
+// @Param id path string true "Chart ID"
+// @Success 200 {object} chartResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart not found`, `chart_not_found`"
+// @Failure 409 {object} errorResponse "`chart deploy in progress`"
+// @Failure 423 {object} errorResponse "`chart_locked`"
+// @Failure 500 {object} errorResponse "`failed to delete chart`, `chart_settings_failed`"
+// @Router /chart/{id} [delete]
+func HandleChartDelete(w http.ResponseWriter, r *http.Request, subject string) {
+	chartID := r.PathValue("id")
+	if !requireChartUnlocked(w, chartID, subject) {
+		return
+	}
+
+	if !tryAcquireChartDeleteLock(chartID) {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "chart deploy in progress"})
+		return
+	}
+	defer releaseChartDeleteLock(chartID)
+
+	if err := chart.TrashChartRepo(chartID, subject); err != nil {
+		if errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart not found"})
+			return
+		}
+
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to delete chart"})
+		return
+	}
+	publishChartChange(chartID)
+
+	writeJSON(w, http.StatusOK, chartResponse{
+		ChartID: chartID,
+	})
+}
+
+// HandleChartGit serves a smart HTTP git endpoint for chart repos. Pushes are
+// only served when GIT_PUSH_ENABLED is "true".
+func HandleChartGit(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenFromBasicAuth(r, "access")
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="planemgr"`)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+
+	chartID := r.PathValue("id")
+	trimmedChartID := strings.TrimSuffix(chartID, ".git")
+
 	basePath := "/api/chart/" + chartID
 	suffix := strings.TrimPrefix(r.URL.Path, basePath)
 	switch suffix {
@@ -333,7 +857,11 @@ func HandleChartGit(w http.ResponseWriter, r *http.Request) {
 	case "/git-upload-pack":
 		handleChartGitUploadPack(w, r, trimmedChartID)
 	case "/git-receive-pack":
-		writeJSON(w, http.StatusForbidden, map[string]string{"error": "pushes are disabled"})
+		if !chartGitPushEnabled() {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "pushes are disabled"})
+			return
+		}
+		handleChartGitReceivePack(w, r, trimmedChartID, claims.Subject)
 	default:
 		writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown git endpoint"})
 	}
@@ -351,12 +879,22 @@ func handleChartGitInfoRefs(w http.ResponseWriter, r *http.Request, chartID stri
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "service required"})
 		return
 	}
-	if service != transport.UploadPackServiceName {
-		writeJSON(w, http.StatusForbidden, map[string]string{"error": "service not supported"})
+	if service == transport.UploadPackServiceName && gitProtocolV2(r) {
+		writeChartGitV2Capabilities(w, chartID)
 		return
 	}
 
-	session, err := chartUploadPackSession(chartID)
+	var session transport.Session
+	var err error
+	switch {
+	case service == transport.UploadPackServiceName:
+		session, err = chartUploadPackSession(chartID)
+	case service == transport.ReceivePackServiceName && chartGitPushEnabled():
+		session, err = chartReceivePackSession(chartID)
+	default:
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "service not supported"})
+		return
+	}
 	if err != nil {
 		handleChartGitSessionError(w, err)
 		return
@@ -369,7 +907,7 @@ func handleChartGitInfoRefs(w http.ResponseWriter, r *http.Request, chartID stri
 		return
 	}
 	advRefs.Prefix = [][]byte{
-		[]byte("# service=git-upload-pack"),
+		[]byte("# service=" + service),
 		pktline.Flush,
 	}
 
@@ -379,7 +917,7 @@ func handleChartGitInfoRefs(w http.ResponseWriter, r *http.Request, chartID stri
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+	w.Header().Set("Content-Type", "application/x-"+service+"-advertisement")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Pragma", "no-cache")
 	w.WriteHeader(http.StatusOK)
@@ -393,6 +931,25 @@ func handleChartGitUploadPack(w http.ResponseWriter, r *http.Request, chartID st
 		return
 	}
 
+	release, err := uploadPackLimits().acquire(r.Context())
+	if err != nil {
+		if errors.Is(err, errUploadPackBusy) {
+			w.Header().Set("Retry-After", "5")
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "too many concurrent clones"})
+		}
+		return
+	}
+	defer release()
+
+	meter := newPackMeter(w)
+	defer meter.record(chartID)
+	w = meter
+
+	if gitProtocolV2(r) {
+		handleChartGitV2Command(w, r, chartID)
+		return
+	}
+
 	session, err := chartUploadPackSession(chartID)
 	if err != nil {
 		handleChartGitSessionError(w, err)
@@ -419,6 +976,83 @@ func handleChartGitUploadPack(w http.ResponseWriter, r *http.Request, chartID st
 	_ = resp.Encode(w)
 }
 
+func handleChartGitReceivePack(w http.ResponseWriter, r *http.Request, chartID, subject string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	if !requireChartUnlocked(w, chartID, subject) {
+		return
+	}
+
+	session, err := chartReceivePackSession(chartID)
+	if err != nil {
+		handleChartGitSessionError(w, err)
+		return
+	}
+	defer session.Close()
+
+	req := packp.NewReferenceUpdateRequest()
+	if err := req.Decode(r.Body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid receive-pack request"})
+		return
+	}
+	// Clients send no packfile when every command deletes a ref.
+	onlyDeletes := true
+	for _, cmd := range req.Commands {
+		if cmd.Action() != packp.Delete {
+			onlyDeletes = false
+			break
+		}
+	}
+	if onlyDeletes {
+		req.Packfile = nil
+	}
+
+	// Rejected ref updates are reported per ref in the status, so the error
+	// only matters when the client didn't ask for one.
+	status, err := session.ReceivePack(r.Context(), req)
+	if err != nil && status == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to receive pack"})
+		return
+	}
+	publishChartChange(chartID)
+	publishChartPushEvents(chartID, req.Commands, status)
+
+	w.Header().Set("Content-Type", "application/x-git-receive-pack-result")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if status != nil {
+		_ = status.Encode(w)
+	}
+}
+
+// chartFileInlineLimit is the largest file in bytes HandleChartFileGet
+// returns inline, set by CHART_FILE_INLINE_KB. Zero means no limit.
+func chartFileInlineLimit() int64 {
+	value := strings.TrimSpace(os.Getenv("CHART_FILE_INLINE_KB"))
+	if value == "" {
+		return defaultChartFileInlineKB << 10
+	}
+	limit, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || limit < 0 {
+		log.Printf("Invalid CHART_FILE_INLINE_KB %q, using %d", value, defaultChartFileInlineKB)
+		return defaultChartFileInlineKB << 10
+	}
+	return limit << 10
+}
+
+func chartGitPushEnabled() bool {
+	return os.Getenv("GIT_PUSH_ENABLED") == "true"
+}
+
+func chartReceivePackSession(chartID string) (transport.ReceivePackSession, error) {
+	srv := gitsrv.NewServer(chart.NewPushLoader(chartID))
+	return srv.NewReceivePackSession(&transport.Endpoint{}, nil)
+}
+
 func chartUploadPackSession(chartID string) (transport.UploadPackSession, error) {
 	dir := osfs.New(chart.ChartWorkdir() + "/" + chartID)
 	loader := gitsrv.NewFilesystemLoader(dir)
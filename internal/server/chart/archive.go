@@ -0,0 +1,246 @@
+package chart
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const (
+	ArchiveTarGz = "tar.gz"
+	ArchiveZip   = "zip"
+)
+
+var (
+	ErrInvalidArchiveFormat = errors.New("invalid chart archive format")
+	ErrInvalidArchive       = errors.New("invalid chart archive")
+)
+
+// Archive is the tree of a chart at a resolved commit, ready to be written
+// out as an archive.
+type Archive struct {
+	Ref    string            // Resolved commit hash
+	Prefix string            // Directory every tree file is placed under
+	Extra  map[string][]byte // Files written after the tree, by archive path
+	commit *object.Commit
+}
+
+// OpenChartArchive resolves ref (HEAD by default) of a chart for archiving.
+func OpenChartArchive(chartID, ref string) (*Archive, error) {
+	repo, err := openChartRepo(chartID)
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := resolveChartCommit(repo, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := commit.Hash.String()
+	return &Archive{
+		Ref:    hash,
+		Prefix: chartID + "-" + hash[:7] + "/",
+		commit: commit,
+	}, nil
+}
+
+// Write streams the archive to w in the given format.
+func (a *Archive) Write(w io.Writer, format string) error {
+	switch format {
+	case ArchiveTarGz:
+		return a.writeTarGz(w)
+	case ArchiveZip:
+		return a.writeZip(w)
+	default:
+		return ErrInvalidArchiveFormat
+	}
+}
+
+func (a *Archive) writeTarGz(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	err := a.forEachFile(func(file *object.File, mode fs.FileMode, modTime time.Time) error {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    a.Prefix + file.Name,
+			Mode:    int64(mode),
+			Size:    file.Size,
+			ModTime: modTime,
+		}); err != nil {
+			return err
+		}
+		return copyFileContents(tw, file)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, name := range a.extraNames() {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0o644,
+			Size:    int64(len(a.Extra[name])),
+			ModTime: a.commit.Committer.When,
+		}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(a.Extra[name]); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func (a *Archive) writeZip(w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	err := a.forEachFile(func(file *object.File, mode fs.FileMode, modTime time.Time) error {
+		header := &zip.FileHeader{
+			Name:     a.Prefix + file.Name,
+			Method:   zip.Deflate,
+			Modified: modTime,
+		}
+		header.SetMode(mode)
+
+		writer, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		return copyFileContents(writer, file)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, name := range a.extraNames() {
+		writer, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: a.commit.Committer.When,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write(a.Extra[name]); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func (a *Archive) forEachFile(fn func(file *object.File, mode fs.FileMode, modTime time.Time) error) error {
+	tree, err := a.commit.Tree()
+	if err != nil {
+		return err
+	}
+
+	modTime := a.commit.Committer.When
+	return tree.Files().ForEach(func(file *object.File) error {
+		mode := fs.FileMode(0o644)
+		if file.Mode == filemode.Executable {
+			mode = 0o755
+		}
+		return fn(file, mode, modTime)
+	})
+}
+
+func (a *Archive) extraNames() []string {
+	names := make([]string, 0, len(a.Extra))
+	for name := range a.Extra {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func copyFileContents(w io.Writer, file *object.File) error {
+	reader, err := file.Reader()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	_, err = io.Copy(w, reader)
+	return err
+}
+
+// ReadArchiveFiles returns the contents of the regular files of a tar.gz or
+// zip archive by their slash-separated path. Other entries are skipped.
+func ReadArchiveFiles(data []byte, format string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	add := func(name string, r io.Reader) error {
+		name = path.Clean(name)
+		if !fs.ValidPath(name) || name == "." {
+			return fmt.Errorf("%w: unexpected entry %q", ErrInvalidArchive, name)
+		}
+		contents, err := io.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		files[name] = contents
+		return nil
+	}
+
+	switch format {
+	case ArchiveTarGz:
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		tr := tar.NewReader(gz)
+		for {
+			header, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+			}
+			if header.Typeflag != tar.TypeReg {
+				continue
+			}
+			if err := add(header.Name, tr); err != nil {
+				return nil, err
+			}
+		}
+	case ArchiveZip:
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		for _, file := range zr.File {
+			if !file.Mode().IsRegular() {
+				continue
+			}
+			reader, err := file.Open()
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+			}
+			err = add(file.Name, reader)
+			_ = reader.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, ErrInvalidArchiveFormat
+	}
+	return files, nil
+}
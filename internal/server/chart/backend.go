@@ -0,0 +1,157 @@
+package chart
+
+import (
+	"errors"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+var ErrNoBackend = errors.New("module configures no state backend")
+
+// ChartBackend is the state backend a module of a chart configures in the
+// terraform block of one of its files.
+type ChartBackend struct {
+	Type string // Backend type, such as s3, or cloud for a cloud block
+	File string // Chart path of the file configuring it
+	// Attributes holds the attributes set to literal strings, numbers or
+	// bools, as strings. Others, like references, are left out.
+	Attributes map[string]string
+}
+
+// ReadChartBackend returns the backend or cloud block the module in dir,
+// the chart root when empty, configures at ref. Files that don't parse are
+// skipped; tofu reports them when it runs.
+func ReadChartBackend(chartID, ref, dir string) (ChartBackend, error) {
+	repo, err := openChartRepo(chartID)
+	if err != nil {
+		return ChartBackend{}, err
+	}
+
+	commit, err := resolveChartCommit(repo, ref)
+	if err != nil {
+		return ChartBackend{}, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return ChartBackend{}, err
+	}
+	if dir = path.Clean(dir); dir != "." && dir != "" {
+		if tree, err = tree.Tree(dir); errors.Is(err, object.ErrDirectoryNotFound) {
+			return ChartBackend{}, ErrNoBackend
+		} else if err != nil {
+			return ChartBackend{}, err
+		}
+	} else {
+		dir = ""
+	}
+
+	for _, entry := range tree.Entries {
+		if entry.Mode != filemode.Regular && entry.Mode != filemode.Executable || !strings.HasSuffix(entry.Name, ".tf") {
+			continue
+		}
+		file, err := tree.TreeEntryFile(&entry)
+		if err != nil {
+			return ChartBackend{}, err
+		}
+		contents, err := file.Contents()
+		if err != nil {
+			return ChartBackend{}, err
+		}
+		parsed, diags := hclsyntax.ParseConfig([]byte(contents), entry.Name, hcl.InitialPos)
+		if diags.HasErrors() {
+			continue
+		}
+		for _, block := range parsed.Body.(*hclsyntax.Body).Blocks {
+			if block.Type != "terraform" {
+				continue
+			}
+			for _, nested := range block.Body.Blocks {
+				if nested.Type != "backend" && nested.Type != "cloud" {
+					continue
+				}
+				backend := ChartBackend{Type: nested.Type, File: path.Join(dir, entry.Name), Attributes: map[string]string{}}
+				if nested.Type == "backend" && len(nested.Labels) > 0 {
+					backend.Type = nested.Labels[0]
+				}
+				for name, attr := range nested.Body.Attributes {
+					if value, ok := literalString(attr.Expr); ok {
+						backend.Attributes[name] = value
+					}
+				}
+				return backend, nil
+			}
+		}
+	}
+	return ChartBackend{}, ErrNoBackend
+}
+
+// RemoveChartBackend commits the removal of the backend block of the module
+// in dir, the chart root when empty, to the chart branch, so deploys of the
+// module use the managed state. The terraform block is removed with it when
+// nothing else is left in it. A commit landing after the backend was read
+// fails the removal with ErrBranchMoved.
+func RemoveChartBackend(chartID, dir, message string) (string, error) {
+	head, err := ReadChartHead(chartID)
+	if err != nil {
+		return "", err
+	}
+	backend, err := ReadChartBackend(chartID, head.Ref, dir)
+	if err != nil {
+		return "", err
+	}
+	_, contents, err := ReadChartFile(chartID, backend.File, head.Ref)
+	if err != nil {
+		return "", err
+	}
+
+	file, diags := hclwrite.ParseConfig([]byte(contents), backend.File, hcl.InitialPos)
+	if diags.HasErrors() {
+		return "", ErrInvalidHCL
+	}
+	for _, block := range file.Body().Blocks() {
+		if block.Type() != "terraform" {
+			continue
+		}
+		for _, nested := range block.Body().Blocks() {
+			if nested.Type() == "backend" || nested.Type() == "cloud" {
+				block.Body().RemoveBlock(nested)
+			}
+		}
+		if len(block.Body().Blocks()) == 0 && len(block.Body().Attributes()) == 0 {
+			file.Body().RemoveBlock(block)
+		}
+	}
+
+	return WriteChartFiles(chartID, []FileUpdate{{Path: backend.File, Content: strings.TrimLeft(string(hclwrite.Format(file.Bytes())), "\n")}}, message, head.Ref)
+}
+
+// literalString returns the value of a literal string, number or bool
+// expression as a string.
+func literalString(expr hclsyntax.Expression) (string, bool) {
+	if len(expr.Variables()) > 0 {
+		return "", false
+	}
+	value, diags := expr.Value(nil)
+	if diags.HasErrors() || !value.IsKnown() || value.IsNull() {
+		return "", false
+	}
+	switch value.Type() {
+	case cty.String:
+		return value.AsString(), true
+	case cty.Number:
+		return value.AsBigFloat().Text('f', -1), true
+	case cty.Bool:
+		if value.True() {
+			return "true", true
+		}
+		return "false", true
+	}
+	return "", false
+}
@@ -0,0 +1,75 @@
+package chart
+
+import (
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// BlameLine is a line of a chart file with the commit that last changed it.
+type BlameLine struct {
+	Number      int // 1-based
+	Text        string
+	Hash        string
+	AuthorName  string
+	AuthorEmail string
+	When        time.Time
+	Summary     string // First line of the commit message
+}
+
+// BlameChartFile annotates every line of a chart file at ref (HEAD by
+// default) with the commit that last modified it. It returns the resolved
+// commit hash and the path blamed.
+func BlameChartFile(chartID, filePath, ref string) (string, string, []BlameLine, error) {
+	cleanPath, err := cleanChartPath(filePath)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	repo, err := openChartRepo(chartID)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	commit, err := resolveChartCommit(repo, ref)
+	if err != nil {
+		return "", "", nil, err
+	}
+	if _, err := commit.File(cleanPath); err != nil {
+		return "", "", nil, err
+	}
+
+	blame, err := git.Blame(commit, cleanPath)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	summaries := map[plumbing.Hash]string{}
+	lines := make([]BlameLine, 0, len(blame.Lines))
+	for i, line := range blame.Lines {
+		summary, ok := summaries[line.Hash]
+		if !ok {
+			lineCommit, err := object.GetCommit(repo.Storer, line.Hash)
+			if err != nil {
+				return "", "", nil, err
+			}
+			summary, _, _ = strings.Cut(strings.TrimSpace(lineCommit.Message), "\n")
+			summaries[line.Hash] = summary
+		}
+
+		lines = append(lines, BlameLine{
+			Number:      i + 1,
+			Text:        line.Text,
+			Hash:        line.Hash.String(),
+			AuthorName:  line.AuthorName,
+			AuthorEmail: line.Author,
+			When:        line.Date,
+			Summary:     summary,
+		})
+	}
+
+	return commit.Hash.String(), cleanPath, lines, nil
+}
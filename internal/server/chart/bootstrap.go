@@ -0,0 +1,124 @@
+package chart
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	ProviderAWS        = "aws"
+	ProviderGCP        = "gcp"
+	ProviderAzure      = "azure"
+	ProviderKubernetes = "k8s"
+)
+
+var ErrInvalidBootstrap = errors.New("invalid bootstrap parameters")
+
+var (
+	bootstrapValuePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	// Bucket, resource group and namespace names all accept this subset.
+	bootstrapNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,61}[a-z0-9]$`)
+)
+
+// Bootstrap selects the cloud provider a new chart starts from, with the few
+// settings its provider block and example resource need.
+type Bootstrap struct {
+	Provider string
+	Region   string // Region, or location on Azure; defaulted per provider
+	Project  string // GCP project, or Azure subscription when set
+	Name     string // Name of the example resource
+}
+
+// bootstrapProviders are the required_providers entries and default regions
+// of the supported providers.
+var bootstrapProviders = map[string]struct {
+	name    string
+	source  string
+	version string
+	region  string
+}{
+	ProviderAWS:        {"aws", "hashicorp/aws", "~> 5.0", "us-east-1"},
+	ProviderGCP:        {"google", "hashicorp/google", "~> 6.0", "us-central1"},
+	ProviderAzure:      {"azurerm", "hashicorp/azurerm", "~> 4.0", "westeurope"},
+	ProviderKubernetes: {"kubernetes", "hashicorp/kubernetes", "~> 2.0", ""},
+}
+
+func (b Bootstrap) Validate() error {
+	if _, ok := bootstrapProviders[b.Provider]; !ok {
+		return fmt.Errorf("%w: provider must be one of aws, gcp, azure or k8s", ErrInvalidBootstrap)
+	}
+	if b.Region != "" && !bootstrapValuePattern.MatchString(b.Region) {
+		return fmt.Errorf("%w: invalid region %q", ErrInvalidBootstrap, b.Region)
+	}
+	if b.Project != "" && !bootstrapValuePattern.MatchString(b.Project) {
+		return fmt.Errorf("%w: invalid project %q", ErrInvalidBootstrap, b.Project)
+	}
+	if b.Provider == ProviderGCP && b.Project == "" {
+		return fmt.Errorf("%w: project is required for gcp", ErrInvalidBootstrap)
+	}
+	if b.Name != "" && !bootstrapNamePattern.MatchString(b.Name) {
+		return fmt.Errorf("%w: name must be 3 to 63 lowercase letters, digits and dashes", ErrInvalidBootstrap)
+	}
+	return nil
+}
+
+// BootstrapFiles returns the main.tf.json of a chart using the provider of
+// b: the required provider, its configuration and an example resource named
+// b.Name. Credentials are left to the runner environment.
+func BootstrapFiles(b Bootstrap) ([]FileUpdate, error) {
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	provider := bootstrapProviders[b.Provider]
+	region := b.Region
+	if region == "" {
+		region = provider.region
+	}
+
+	config := map[string]any{}
+	var resourceType string
+	var resource map[string]any
+	switch b.Provider {
+	case ProviderAWS:
+		config["region"] = region
+		resourceType = "aws_s3_bucket"
+		resource = map[string]any{"bucket": b.Name}
+	case ProviderGCP:
+		config["project"] = b.Project
+		config["region"] = region
+		resourceType = "google_storage_bucket"
+		resource = map[string]any{"name": b.Name, "location": region}
+	case ProviderAzure:
+		config["features"] = map[string]any{}
+		if b.Project != "" {
+			config["subscription_id"] = b.Project
+		}
+		resourceType = "azurerm_resource_group"
+		resource = map[string]any{"name": b.Name, "location": region}
+	case ProviderKubernetes:
+		resourceType = "kubernetes_namespace"
+		resource = map[string]any{"metadata": map[string]any{"name": b.Name}}
+	}
+
+	main := map[string]any{
+		"terraform": map[string]any{
+			"required_providers": map[string]any{
+				provider.name: map[string]any{"source": provider.source, "version": provider.version},
+			},
+		},
+		"provider": map[string]any{provider.name: config},
+		"resource": map[string]any{resourceType: map[string]any{"example": resource}},
+	}
+	var contents strings.Builder
+	encoder := json.NewEncoder(&contents)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(main); err != nil {
+		return nil, err
+	}
+
+	return []FileUpdate{{Path: "main.tf.json", Content: contents.String()}}, nil
+}
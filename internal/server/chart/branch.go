@@ -0,0 +1,92 @@
+package chart
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+const fallbackBranch = "main"
+
+var ErrInvalidBranch = errors.New("invalid branch name")
+
+var (
+	defaultBranch     string
+	defaultBranchOnce sync.Once
+)
+
+// DefaultBranch is the branch new charts start on, set by DEFAULT_BRANCH
+// (main by default).
+func DefaultBranch() string {
+	defaultBranchOnce.Do(func() {
+		defaultBranch = fallbackBranch
+		if value := strings.TrimSpace(os.Getenv("DEFAULT_BRANCH")); value != "" {
+			if err := ValidateBranchName(value); err != nil {
+				log.Printf("Ignoring invalid DEFAULT_BRANCH %q", value)
+			} else {
+				defaultBranch = value
+			}
+		}
+	})
+	return defaultBranch
+}
+
+// ValidateBranchName reports whether name can name a branch, following the
+// git ref name rules.
+func ValidateBranchName(name string) error {
+	if name == "" || strings.HasPrefix(name, "-") || name == "HEAD" {
+		return ErrInvalidBranch
+	}
+	if err := plumbing.NewBranchReferenceName(name).Validate(); err != nil {
+		return ErrInvalidBranch
+	}
+	return nil
+}
+
+// ChartDefaultBranch returns the branch HEAD of a chart points to, which
+// commits, tree listings and deploys without a ref use.
+func ChartDefaultBranch(chartID string) (string, error) {
+	repo, err := openChartRepo(chartID)
+	if err != nil {
+		return "", err
+	}
+	branchName, _, err := chartBranch(repo)
+	if err != nil {
+		return "", err
+	}
+	return branchName.Short(), nil
+}
+
+// SetChartDefaultBranch points HEAD of a chart at branch. A branch that
+// doesn't exist yet is created at the current HEAD commit, so the chart
+// keeps its history; the previous branch is kept.
+func SetChartDefaultBranch(chartID, branch string) error {
+	if err := ValidateBranchName(branch); err != nil {
+		return err
+	}
+	repo, err := openChartRepo(chartID)
+	if err != nil {
+		return err
+	}
+
+	branchName := plumbing.NewBranchReferenceName(branch)
+	if _, err := repo.Reference(branchName, false); errors.Is(err, plumbing.ErrReferenceNotFound) {
+		_, headHash, err := chartBranch(repo)
+		if err != nil {
+			return err
+		}
+		if !headHash.IsZero() {
+			if err := repo.Storer.SetReference(plumbing.NewHashReference(branchName, headHash)); err != nil {
+				return err
+			}
+		}
+	} else if err != nil {
+		return err
+	}
+
+	return repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, branchName))
+}
@@ -0,0 +1,82 @@
+package chart
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrNothingToCherryPick = errors.New("chart already contains the commit changes")
+
+// CherryPickChart applies the changes a commit made relative to its first
+// parent on top of the current branch as a new commit. Text files the branch
+// changed since are merged line by line; changes that can't be merged are
+// conflicts, which are returned with ErrMergeConflict and leave the branch
+// untouched. An empty message defaults to the picked commit's message.
+func CherryPickChart(chartID, ref, message string) (MergeResult, []MergeConflict, error) {
+	repo, err := openChartRepo(chartID)
+	if err != nil {
+		return MergeResult{}, nil, err
+	}
+
+	picked, err := resolveChartCommit(repo, ref)
+	if err != nil {
+		return MergeResult{}, nil, err
+	}
+	branchName, parentHash, err := chartBranch(repo)
+	if err != nil {
+		return MergeResult{}, nil, err
+	}
+	if parentHash.IsZero() {
+		return MergeResult{}, nil, ErrNothingToCherryPick
+	}
+	head, err := repo.CommitObject(parentHash)
+	if err != nil {
+		return MergeResult{}, nil, err
+	}
+
+	baseFiles := map[string]treeFile{}
+	if picked.NumParents() > 0 {
+		parent, err := picked.Parent(0)
+		if err != nil {
+			return MergeResult{}, nil, err
+		}
+		if baseFiles, err = commitFiles(parent); err != nil {
+			return MergeResult{}, nil, err
+		}
+	}
+	pickedFiles, err := commitFiles(picked)
+	if err != nil {
+		return MergeResult{}, nil, err
+	}
+	headFiles, err := commitFiles(head)
+	if err != nil {
+		return MergeResult{}, nil, err
+	}
+
+	treeHash, changed, conflicts, err := mergeTrees(repo, head, baseFiles, pickedFiles, headFiles, nil)
+	if err != nil {
+		return MergeResult{}, nil, err
+	}
+	if len(conflicts) > 0 {
+		return MergeResult{}, conflicts, ErrMergeConflict
+	}
+	if len(changed) == 0 {
+		return MergeResult{}, nil, ErrNothingToCherryPick
+	}
+
+	if message == "" {
+		message = fmt.Sprintf("%s\n\n(cherry picked from commit %s)", strings.TrimSpace(picked.Message), picked.Hash)
+	}
+	commitHash, err := commitTree(repo, chartID, branchName, parentHash, treeHash, message)
+	if err != nil {
+		return MergeResult{}, nil, err
+	}
+
+	return MergeResult{
+		Source: picked.Hash.String(),
+		Target: parentHash.String(),
+		Commit: commitHash,
+		Paths:  changed,
+	}, nil, nil
+}
@@ -0,0 +1,61 @@
+package chart
+
+import "github.com/go-git/go-git/v5/plumbing/object"
+
+// CommitSummary is a commit with the files it changed relative to its first
+// parent, or every file for a root commit.
+type CommitSummary struct {
+	CommitInfo
+	Parents []string
+	Files   []FileDiff
+}
+
+// ReadChartCommit summarizes the commit ref resolves to.
+func ReadChartCommit(chartID, ref string) (CommitSummary, error) {
+	repo, err := openChartRepo(chartID)
+	if err != nil {
+		return CommitSummary{}, err
+	}
+
+	commit, err := resolveChartCommit(repo, ref)
+	if err != nil {
+		return CommitSummary{}, err
+	}
+	info, err := commitInfo(commit)
+	if err != nil {
+		return CommitSummary{}, err
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return CommitSummary{}, err
+	}
+	parentTree, err := firstParentTree(commit)
+	if err != nil {
+		return CommitSummary{}, err
+	}
+	files, err := diffTrees(parentTree, tree)
+	if err != nil {
+		return CommitSummary{}, err
+	}
+
+	parents := make([]string, 0, commit.NumParents())
+	for _, hash := range commit.ParentHashes {
+		parents = append(parents, hash.String())
+	}
+
+	return CommitSummary{CommitInfo: info, Parents: parents, Files: files}, nil
+}
+
+// firstParentTree returns the tree of the first parent of commit, or an empty
+// tree for a root commit.
+func firstParentTree(commit *object.Commit) (*object.Tree, error) {
+	if commit.NumParents() == 0 {
+		return &object.Tree{}, nil
+	}
+	parent, err := commit.Parent(0)
+	if err != nil {
+		return nil, err
+	}
+	return parent.Tree()
+}
@@ -0,0 +1,133 @@
+package chart
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+var ErrNothingToCopy = errors.New("chart already contains the copied files")
+
+// CopyResult describes a copy between charts.
+type CopyResult struct {
+	Source string   // Commit of the source chart the files were read from
+	Commit string   // Commit made on the destination chart
+	Paths  []string // Files copied, sorted
+}
+
+// CopyChartFiles copies the files at paths of sourceID, read at ref, into
+// chartID as a single commit on its branch. Files keep their path and mode,
+// and paths naming a directory copy every file below it. Files already at a
+// copied path are replaced. The commit message ends with a Copied-from
+// trailer naming the source chart and commit; an empty message defaults to
+// naming them too.
+func CopyChartFiles(sourceID, ref string, paths []string, chartID, message string) (CopyResult, error) {
+	if len(paths) == 0 {
+		return CopyResult{}, ErrInvalidPath
+	}
+
+	source, err := openChartRepo(sourceID)
+	if err != nil {
+		return CopyResult{}, err
+	}
+	sourceCommit, err := resolveChartCommit(source, ref)
+	if err != nil {
+		return CopyResult{}, err
+	}
+	sourceTree, err := sourceCommit.Tree()
+	if err != nil {
+		return CopyResult{}, err
+	}
+
+	files := map[string]*object.File{}
+	for _, filePath := range paths {
+		cleanPath, err := cleanChartPath(filePath)
+		if err != nil {
+			return CopyResult{}, err
+		}
+		if file, err := sourceTree.File(cleanPath); err == nil {
+			files[cleanPath] = file
+			continue
+		}
+		dir, err := sourceTree.Tree(cleanPath)
+		if err != nil {
+			return CopyResult{}, object.ErrFileNotFound
+		}
+		err = dir.Files().ForEach(func(file *object.File) error {
+			files[cleanPath+"/"+file.Name] = file
+			return nil
+		})
+		if err != nil {
+			return CopyResult{}, err
+		}
+	}
+
+	repo, err := openChartRepo(chartID)
+	if err != nil {
+		return CopyResult{}, err
+	}
+	branchName, parentHash, err := chartBranch(repo)
+	if err != nil {
+		return CopyResult{}, err
+	}
+	baseTree := &object.Tree{}
+	if !parentHash.IsZero() {
+		parent, err := repo.CommitObject(parentHash)
+		if err != nil {
+			return CopyResult{}, err
+		}
+		if baseTree, err = parent.Tree(); err != nil {
+			return CopyResult{}, err
+		}
+	}
+	baseHash := baseTree.Hash
+
+	copied := make([]string, 0, len(files))
+	for filePath := range files {
+		copied = append(copied, filePath)
+	}
+	sort.Strings(copied)
+	for _, filePath := range copied {
+		file := files[filePath]
+		contents, err := file.Contents()
+		if err != nil {
+			return CopyResult{}, err
+		}
+		if file.Mode == filemode.Symlink {
+			if err := checkSymlinkTarget(filePath, contents); err != nil {
+				return CopyResult{}, err
+			}
+		}
+
+		blobHash, err := writeBlob(repo, contents)
+		if err != nil {
+			return CopyResult{}, err
+		}
+		treeHash, err := writeTree(repo, baseTree, strings.Split(filePath, "/"), blobHash, file.Mode)
+		if err != nil {
+			return CopyResult{}, err
+		}
+		if baseTree, err = object.GetTree(repo.Storer, treeHash); err != nil {
+			return CopyResult{}, err
+		}
+	}
+	if baseTree.Hash == baseHash {
+		return CopyResult{}, ErrNothingToCopy
+	}
+
+	if message == "" {
+		message = fmt.Sprintf("Copy %d files from chart %s", len(copied), sourceID)
+	}
+	message = fmt.Sprintf("%s\n\nCopied-from: %s %s\n", strings.TrimRight(message, "\n"), sourceID, sourceCommit.Hash)
+
+	commitHash, err := commitTree(repo, chartID, branchName, parentHash, baseTree.Hash, message)
+	if err != nil {
+		return CopyResult{}, err
+	}
+
+	return CopyResult{Source: sourceCommit.Hash.String(), Commit: commitHash, Paths: copied}, nil
+}
@@ -0,0 +1,233 @@
+package chart
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// deployLogsDir holds the zstd-compressed runner output of the deploys of a
+// chart, one file per deploy, inside its metadata directory.
+const (
+	deployLogsDir   = "deploy-logs"
+	deployLogSuffix = ".log.zst"
+)
+
+var ErrDeployLogNotFound = errors.New("deploy log not found")
+
+// DeployLogColdDir is where deploy logs are moved once they are older than
+// DEPLOY_LOG_COLD_AFTER, such as a mounted object store, one directory per
+// chart. Without DEPLOY_LOG_COLD_DIR logs stay next to their chart.
+func DeployLogColdDir() string {
+	return strings.TrimSpace(os.Getenv("DEPLOY_LOG_COLD_DIR"))
+}
+
+// WriteDeployLog stores the runner output of a finished deploy, compressed.
+func WriteDeployLog(chartID, deployID, output string) error {
+	target, err := deployLogPath(chartID, deployID)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), deployID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	encoder, err := zstd.NewWriter(tmp)
+	if err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if _, err := io.WriteString(encoder, output); err != nil {
+		_ = encoder.Close()
+		_ = tmp.Close()
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), target)
+}
+
+// OpenDeployLog returns the decompressed runner output of a deploy, read
+// from the cold tier once it was moved there.
+func OpenDeployLog(chartID, deployID string) (io.ReadCloser, error) {
+	target, err := deployLogPath(chartID, deployID)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(target)
+	if errors.Is(err, os.ErrNotExist) {
+		if cold := coldDeployLogPath(chartID, deployID); cold != "" {
+			file, err = os.Open(cold)
+		}
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrDeployLogNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	decoder, err := zstd.NewReader(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return deployLogReader{decoder: decoder, file: file}, nil
+}
+
+// DeleteDeployLog removes the log of a deploy from both tiers, if any.
+func DeleteDeployLog(chartID, deployID string) error {
+	target, err := deployLogPath(chartID, deployID)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if cold := coldDeployLogPath(chartID, deployID); cold != "" {
+		if err := os.Remove(cold); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// MoveDeployLogsCold moves the deploy logs of every chart written before
+// cutoff to the cold tier and returns how many it moved. It does nothing
+// without a cold tier.
+func MoveDeployLogsCold(cutoff time.Time) (int, error) {
+	coldDir := DeployLogColdDir()
+	if coldDir == "" {
+		return 0, nil
+	}
+	charts, err := os.ReadDir(ChartWorkdir())
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for _, entry := range charts {
+		if !entry.IsDir() || !IsChartID(entry.Name()) {
+			continue
+		}
+		dir := filepath.Join(ChartWorkdir(), entry.Name(), metaDir, deployLogsDir)
+		logs, err := os.ReadDir(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return moved, err
+		}
+		for _, log := range logs {
+			if !strings.HasSuffix(log.Name(), deployLogSuffix) || !log.Type().IsRegular() {
+				continue
+			}
+			info, err := log.Info()
+			if err != nil {
+				return moved, err
+			}
+			if !info.ModTime().Before(cutoff) {
+				continue
+			}
+			if err := moveFile(filepath.Join(dir, log.Name()), filepath.Join(coldDir, entry.Name(), log.Name())); err != nil {
+				return moved, err
+			}
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+// removeColdDeployLogs removes the cold tier logs of a purged chart.
+func removeColdDeployLogs(chartID string) error {
+	coldDir := DeployLogColdDir()
+	if coldDir == "" || !IsChartID(chartID) {
+		return nil
+	}
+	return os.RemoveAll(filepath.Join(coldDir, chartID))
+}
+
+type deployLogReader struct {
+	decoder *zstd.Decoder
+	file    *os.File
+}
+
+func (r deployLogReader) Read(p []byte) (int, error) {
+	return r.decoder.Read(p)
+}
+
+func (r deployLogReader) Close() error {
+	r.decoder.Close()
+	return r.file.Close()
+}
+
+// moveFile renames source to target, copying it when they are on different
+// file systems, as a mounted cold tier usually is.
+func moveFile(source, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(source, target); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(target), filepath.Base(target)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, in); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return err
+	}
+	return os.Remove(source)
+}
+
+func deployLogPath(chartID, deployID string) (string, error) {
+	if _, err := openChartRepo(chartID); err != nil {
+		return "", err
+	}
+	if !isDeployLogName(deployID) {
+		return "", ErrInvalidPath
+	}
+	return filepath.Join(ChartWorkdir(), chartID, metaDir, deployLogsDir, deployID+deployLogSuffix), nil
+}
+
+func coldDeployLogPath(chartID, deployID string) string {
+	coldDir := DeployLogColdDir()
+	if coldDir == "" || !isDeployLogName(deployID) {
+		return ""
+	}
+	return filepath.Join(coldDir, chartID, deployID+deployLogSuffix)
+}
+
+func isDeployLogName(deployID string) bool {
+	return deployID != "" && deployID == filepath.Base(deployID) && !strings.HasPrefix(deployID, ".")
+}
@@ -0,0 +1,115 @@
+package chart
+
+import (
+	"context"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+)
+
+const (
+	ChangeAdded    = "added"
+	ChangeModified = "modified"
+	ChangeDeleted  = "deleted"
+)
+
+type FileDiff struct {
+	Path      string
+	OldPath   string // Set when the file was renamed
+	Action    string
+	Binary    bool
+	Patch     string // Unified diff, empty for binary files
+	Additions int    // Lines added, zero for binary files
+	Deletions int    // Lines removed, zero for binary files
+}
+
+// DiffChartRefs compares the trees of two refs of a chart. An empty to ref
+// compares against HEAD.
+func DiffChartRefs(chartID, from, to string) (string, string, []FileDiff, error) {
+	repo, err := openChartRepo(chartID)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	fromCommit, err := resolveChartCommit(repo, from)
+	if err != nil {
+		return "", "", nil, err
+	}
+	toCommit, err := resolveChartCommit(repo, to)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	diffs, err := diffCommits(fromCommit, toCommit)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	return fromCommit.Hash.String(), toCommit.Hash.String(), diffs, nil
+}
+
+func diffCommits(from, to *object.Commit) ([]FileDiff, error) {
+	fromTree, err := from.Tree()
+	if err != nil {
+		return nil, err
+	}
+	toTree, err := to.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	return diffTrees(fromTree, toTree)
+}
+
+// diffTrees compares two trees. Files moved with at most small changes are
+// reported once, with their OldPath, like git does.
+func diffTrees(fromTree, toTree *object.Tree) ([]FileDiff, error) {
+	changes, err := object.DiffTreeWithOptions(context.Background(), fromTree, toTree, object.DefaultDiffTreeOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := make([]FileDiff, 0, len(changes))
+	for _, change := range changes {
+		action, err := change.Action()
+		if err != nil {
+			return nil, err
+		}
+
+		patch, err := change.Patch()
+		if err != nil {
+			return nil, err
+		}
+
+		diff := FileDiff{Path: change.To.Name}
+		switch action {
+		case merkletrie.Insert:
+			diff.Action = ChangeAdded
+		case merkletrie.Delete:
+			diff.Action = ChangeDeleted
+			diff.Path = change.From.Name
+		default:
+			diff.Action = ChangeModified
+			if change.From.Name != change.To.Name {
+				diff.OldPath = change.From.Name
+			}
+		}
+
+		for _, filePatch := range patch.FilePatches() {
+			if filePatch.IsBinary() {
+				diff.Binary = true
+			}
+		}
+		if !diff.Binary {
+			diff.Patch = patch.String()
+			for _, stat := range patch.Stats() {
+				diff.Additions += stat.Addition
+				diff.Deletions += stat.Deletion
+			}
+		}
+
+		diffs = append(diffs, diff)
+	}
+
+	return diffs, nil
+}
@@ -2,6 +2,7 @@ package chart
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path"
@@ -14,15 +15,29 @@ import (
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/filemode"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage"
 	"github.com/google/uuid"
 )
 
 var ErrInvalidPath = errors.New("invalid chart file path")
 var ErrPathIsDirectory = errors.New("chart path is a directory")
+var ErrInvalidChartID = errors.New("invalid chart id")
+var ErrPathExists = errors.New("chart path already exists")
+var ErrBranchMoved = errors.New("chart branch is not at the expected commit")
 
 type FileUpdate struct {
 	Path    string
 	Content string // Full file content
+	Delete  bool   // Remove the path instead of writing Content
+	OldPath string // Move the file at OldPath to Path, keeping its content
+}
+
+// IsChartID reports whether id is a chart ID: a UUID in the canonical
+// lowercase form CreateChartRepo names repositories with. Other spellings
+// uuid.Parse accepts, and anything else, must never reach a repository path.
+func IsChartID(id string) bool {
+	parsed, err := uuid.Parse(id)
+	return err == nil && parsed.String() == id
 }
 
 func ChartWorkdir() string {
@@ -75,7 +90,7 @@ func ListChartRepos() ([]string, error) {
 
 	var chartIDs = []string{}
 	for _, entry := range entries {
-		if !entry.IsDir() {
+		if !entry.IsDir() || !IsChartID(entry.Name()) {
 			continue
 		}
 
@@ -86,6 +101,66 @@ func ListChartRepos() ([]string, error) {
 	return chartIDs, nil
 }
 
+// ChartHead summarizes where the HEAD of a chart repository is.
+type ChartHead struct {
+	Branch    string    // Branch HEAD points at
+	Ref       string    // Commit of the branch, empty before the first commit
+	When      time.Time // Author time of the commit
+	FileCount int
+}
+
+// ReadChartHead reads the HEAD commit of a chart and counts the files in its
+// tree, without walking history or reading file contents.
+func ReadChartHead(chartID string) (ChartHead, error) {
+	repo, err := openChartRepo(chartID)
+	if err != nil {
+		return ChartHead{}, err
+	}
+
+	var head ChartHead
+	symbolic, err := repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return ChartHead{}, err
+	}
+	if symbolic.Type() == plumbing.SymbolicReference {
+		head.Branch = symbolic.Target().Short()
+	}
+
+	ref, err := repo.Head()
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return head, nil
+	}
+	if err != nil {
+		return ChartHead{}, err
+	}
+	commit, err := repo.CommitObject(ref.Hash())
+	if err != nil {
+		return ChartHead{}, err
+	}
+	head.Ref = commit.Hash.String()
+	head.When = commit.Author.When
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return ChartHead{}, err
+	}
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		_, entry, err := walker.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return ChartHead{}, err
+		}
+		if entry.Mode != filemode.Dir {
+			head.FileCount++
+		}
+	}
+	return head, nil
+}
+
 func ListChartTree(chartID, ref string) (string, []string, error) {
 	workdir := ChartWorkdir()
 	repoPath := filepath.Join(workdir, chartID)
@@ -133,6 +208,123 @@ func ListChartTree(chartID, ref string) (string, []string, error) {
 	return hash.String(), files, nil
 }
 
+const (
+	TreeEntryFile = "file"
+	TreeEntryDir  = "dir"
+)
+
+// TreeEntry is a file or directory of a chart tree. Path is relative to the
+// repository root, Mode the git file mode in octal and Size the blob size of
+// files. LastCommit is the newest commit on the first-parent line that
+// changed the entry.
+type TreeEntry struct {
+	Path         string
+	Type         string
+	Hash         string
+	Mode         string
+	Size         int64
+	LastCommit   string
+	LastCommitAt time.Time
+}
+
+// ListChartTreeEntries lists the entries of the directory at dirPath (the
+// root when empty) and of its subdirectories up to depth levels down, so 1
+// lists the directory alone. Directories are listed as entries of their own.
+func ListChartTreeEntries(chartID, ref, dirPath string, depth int) (string, []TreeEntry, error) {
+	repo, err := openChartRepo(chartID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if ref == "" {
+		if _, err := repo.Head(); errors.Is(err, plumbing.ErrReferenceNotFound) {
+			if dirPath != "" {
+				return "", nil, object.ErrDirectoryNotFound
+			}
+			return "", []TreeEntry{}, nil
+		}
+	}
+	commit, err := resolveChartCommit(repo, ref)
+	if err != nil {
+		return "", nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if dirPath != "" {
+		if dirPath, err = cleanChartPath(dirPath); err != nil {
+			return "", nil, err
+		}
+		entry, err := tree.FindEntry(dirPath)
+		if err != nil || entry.Mode != filemode.Dir {
+			return "", nil, object.ErrDirectoryNotFound
+		}
+		if tree, err = object.GetTree(repo.Storer, entry.Hash); err != nil {
+			return "", nil, err
+		}
+	}
+
+	entries := []TreeEntry{}
+	if err := listTreeEntries(repo, tree, dirPath, depth, &entries); err != nil {
+		return "", nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+
+	paths := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		paths = append(paths, entry.Path)
+	}
+	lastCommits, err := lastChangingCommits(commit, paths)
+	if err != nil {
+		return "", nil, err
+	}
+	for i := range entries {
+		if last, ok := lastCommits[entries[i].Path]; ok {
+			entries[i].LastCommit = last.Hash.String()
+			entries[i].LastCommitAt = last.Author.When
+		}
+	}
+	return commit.Hash.String(), entries, nil
+}
+
+func listTreeEntries(repo *git.Repository, tree *object.Tree, dirPath string, depth int, entries *[]TreeEntry) error {
+	for _, entry := range tree.Entries {
+		item := TreeEntry{
+			Path: path.Join(dirPath, entry.Name),
+			Type: TreeEntryFile,
+			Hash: entry.Hash.String(),
+			Mode: fmt.Sprintf("%06o", uint32(entry.Mode)),
+		}
+		if entry.Mode != filemode.Dir {
+			if entry.Mode.IsFile() {
+				size, err := repo.Storer.EncodedObjectSize(entry.Hash)
+				if err != nil {
+					return err
+				}
+				item.Size = size
+			}
+			*entries = append(*entries, item)
+			continue
+		}
+
+		item.Type = TreeEntryDir
+		*entries = append(*entries, item)
+		if depth <= 1 {
+			continue
+		}
+		subtree, err := object.GetTree(repo.Storer, entry.Hash)
+		if err != nil {
+			return err
+		}
+		if err := listTreeEntries(repo, subtree, item.Path, depth-1, entries); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func ReadChartFile(chartID, path, ref string) (string, string, error) {
 	workdir := ChartWorkdir()
 	repoPath := filepath.Join(workdir, chartID)
@@ -172,6 +364,9 @@ func ReadChartFile(chartID, path, ref string) (string, string, error) {
 	if err != nil {
 		return "", "", err
 	}
+	if file.Mode == filemode.Symlink {
+		return "", "", ErrPathIsSymlink
+	}
 
 	contents, err := file.Contents()
 	if err != nil {
@@ -181,7 +376,96 @@ func ReadChartFile(chartID, path, ref string) (string, string, error) {
 	return hash.String(), contents, nil
 }
 
-func WriteChartFiles(chartID string, updates []FileUpdate, message string) (string, error) {
+// ChartFileReader streams the content of a chart file.
+type ChartFileReader struct {
+	io.ReadCloser
+	Ref  string // Commit the file was read from
+	Hash string // Blob hash
+	Size int64
+}
+
+// OpenChartFile opens a file of the chart at ref (HEAD by default) without
+// loading its content into memory. The caller closes the reader.
+func OpenChartFile(chartID, filePath, ref string) (*ChartFileReader, error) {
+	repo, err := openChartRepo(chartID)
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := resolveChartCommit(repo, ref)
+	if err != nil {
+		return nil, err
+	}
+	file, err := commit.File(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if file.Mode == filemode.Symlink {
+		return nil, ErrPathIsSymlink
+	}
+	reader, err := file.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChartFileReader{
+		ReadCloser: reader,
+		Ref:        commit.Hash.String(),
+		Hash:       file.Hash.String(),
+		Size:       file.Size,
+	}, nil
+}
+
+// ChartFile is a file read from a chart commit.
+type ChartFile struct {
+	Path     string
+	Hash     string // Blob hash
+	Contents string
+}
+
+// ReadChartFiles reads several files from the same commit of ref (HEAD by
+// default). Paths that don't name a file in that commit, or name a symlink,
+// are returned separately instead of failing the read.
+func ReadChartFiles(chartID string, paths []string, ref string) (string, []ChartFile, []string, error) {
+	repo, err := openChartRepo(chartID)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	commit, err := resolveChartCommit(repo, ref)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	files := make([]ChartFile, 0, len(paths))
+	missing := []string{}
+	for _, filePath := range paths {
+		file, err := tree.File(filePath)
+		if errors.Is(err, object.ErrFileNotFound) || errors.Is(err, object.ErrDirectoryNotFound) || (err == nil && file.Mode == filemode.Symlink) {
+			missing = append(missing, filePath)
+			continue
+		}
+		if err != nil {
+			return "", nil, nil, err
+		}
+		contents, err := file.Contents()
+		if err != nil {
+			return "", nil, nil, err
+		}
+		files = append(files, ChartFile{Path: filePath, Hash: file.Hash.String(), Contents: contents})
+	}
+
+	return commit.Hash.String(), files, missing, nil
+}
+
+// WriteChartFiles commits updates on top of the chart branch. With
+// expectedRef set, the commit is only made while the branch is still at that
+// commit and fails with ErrBranchMoved otherwise.
+func WriteChartFiles(chartID string, updates []FileUpdate, message, expectedRef string) (string, error) {
 	if len(updates) == 0 {
 		return "", ErrInvalidPath
 	}
@@ -193,29 +477,19 @@ func WriteChartFiles(chartID string, updates []FileUpdate, message string) (stri
 		return "", err
 	}
 
-	branchName := plumbing.NewBranchReferenceName("main")
-	headRef, err := repo.Head()
-	if err != nil && !errors.Is(err, plumbing.ErrReferenceNotFound) {
+	branchName, parentHash, err := chartBranch(repo)
+	if err != nil {
 		return "", err
 	}
-	if err == nil {
-		if headRef.Type() == plumbing.SymbolicReference {
-			branchName = headRef.Target()
-		} else if headRef.Name() != plumbing.HEAD {
-			branchName = headRef.Name()
+	if expectedRef != "" {
+		expected, err := repo.ResolveRevision(plumbing.Revision(expectedRef))
+		if err != nil || *expected != parentHash {
+			return "", ErrBranchMoved
 		}
 	}
 
-	var (
-		baseTree   *object.Tree
-		parentHash plumbing.Hash
-	)
-	ref, err := repo.Reference(branchName, true)
-	if err != nil && !errors.Is(err, plumbing.ErrReferenceNotFound) {
-		return "", err
-	}
-	if err == nil && !ref.Hash().IsZero() {
-		parentHash = ref.Hash()
+	var baseTree *object.Tree
+	if !parentHash.IsZero() {
 		parentCommit, err := repo.CommitObject(parentHash)
 		if err != nil {
 			return "", err
@@ -241,14 +515,36 @@ func WriteChartFiles(chartID string, updates []FileUpdate, message string) (stri
 		}
 		seen[cleanPath] = struct{}{}
 
-		blobHash, err := writeBlob(repo, update.Content)
-		if err != nil {
-			return "", err
-		}
+		switch {
+		case update.OldPath != "":
+			oldPath, err := cleanChartPath(update.OldPath)
+			if err != nil {
+				return "", err
+			}
+			if _, exists := seen[oldPath]; exists {
+				return "", ErrInvalidPath
+			}
+			seen[oldPath] = struct{}{}
 
-		treeHash, err = writeTree(repo, baseTree, strings.Split(cleanPath, "/"), blobHash)
-		if err != nil {
-			return "", err
+			treeHash, err = moveTreeEntry(repo, baseTree, oldPath, cleanPath)
+			if err != nil {
+				return "", err
+			}
+		case update.Delete:
+			treeHash, err = removeTreeEntry(repo, baseTree, strings.Split(cleanPath, "/"))
+			if err != nil {
+				return "", err
+			}
+		default:
+			blobHash, err := writeBlob(repo, update.Content)
+			if err != nil {
+				return "", err
+			}
+
+			treeHash, err = writeTree(repo, baseTree, strings.Split(cleanPath, "/"), blobHash, filemode.Regular)
+			if err != nil {
+				return "", err
+			}
 		}
 
 		baseTree, err = object.GetTree(repo.Storer, treeHash)
@@ -257,6 +553,50 @@ func WriteChartFiles(chartID string, updates []FileUpdate, message string) (stri
 		}
 	}
 
+	return commitTree(repo, chartID, branchName, parentHash, treeHash, message)
+}
+
+// chartBranch returns the branch HEAD points to and its current commit, which
+// is zero for a chart without commits.
+func chartBranch(repo *git.Repository) (plumbing.ReferenceName, plumbing.Hash, error) {
+	branchName := plumbing.NewBranchReferenceName(DefaultBranch())
+	// HEAD is read unresolved, as it names the branch even before the
+	// branch has a commit.
+	headRef, err := repo.Storer.Reference(plumbing.HEAD)
+	if err != nil && !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return "", plumbing.ZeroHash, err
+	}
+	if err == nil && headRef.Type() == plumbing.SymbolicReference {
+		branchName = headRef.Target()
+	}
+
+	ref, err := repo.Reference(branchName, true)
+	if err != nil {
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return branchName, plumbing.ZeroHash, nil
+		}
+		return "", plumbing.ZeroHash, err
+	}
+
+	return branchName, ref.Hash(), nil
+}
+
+// commitTree commits treeHash on top of parentHash and moves the branch to
+// the new commit.
+func commitTree(repo *git.Repository, chartID string, branchName plumbing.ReferenceName, parentHash, treeHash plumbing.Hash, message string) (string, error) {
+	var parents []plumbing.Hash
+	if !parentHash.IsZero() {
+		parents = append(parents, parentHash)
+	}
+	return commitTreeParents(repo, chartID, branchName, parents, treeHash, message)
+}
+
+// commitTreeParents commits treeHash with the given parents, the first being
+// the branch's current commit, and moves the branch to the new commit. When
+// the branch moved away from its first parent meanwhile, nothing is changed
+// and ErrHistoryChanged is returned. Commits breaking the commit policy of the
+// chart are rejected with a *CommitPolicyError.
+func commitTreeParents(repo *git.Repository, chartID string, branchName plumbing.ReferenceName, parents []plumbing.Hash, treeHash plumbing.Hash, message string) (string, error) {
 	commit := &object.Commit{
 		TreeHash: treeHash,
 		Author: object.Signature{
@@ -269,10 +609,8 @@ func WriteChartFiles(chartID string, updates []FileUpdate, message string) (stri
 			Email: "noreply@planemgr.local",
 			When:  time.Now(),
 		},
-		Message: message,
-	}
-	if !parentHash.IsZero() {
-		commit.ParentHashes = []plumbing.Hash{parentHash}
+		Message:      message,
+		ParentHashes: parents,
 	}
 
 	obj := repo.Storer.NewEncodedObject()
@@ -285,8 +623,27 @@ func WriteChartFiles(chartID string, updates []FileUpdate, message string) (stri
 		return "", err
 	}
 
+	written, err := repo.CommitObject(commitHash)
+	if err != nil {
+		return "", err
+	}
+	paths, err := changedPaths(written)
+	if err != nil {
+		return "", err
+	}
+	if err := checkCommitPolicy(chartID, message, paths); err != nil {
+		return "", err
+	}
+
 	newRef := plumbing.NewHashReference(branchName, commitHash)
-	if err := repo.Storer.SetReference(newRef); err != nil {
+	var oldRef *plumbing.Reference
+	if len(parents) > 0 {
+		oldRef = plumbing.NewHashReference(branchName, parents[0])
+	}
+	if err := repo.Storer.CheckAndSetReference(newRef, oldRef); err != nil {
+		if errors.Is(err, storage.ErrReferenceHasChanged) {
+			return "", ErrHistoryChanged
+		}
 		return "", err
 	}
 
@@ -299,10 +656,16 @@ func initBareRepo(path string) error {
 		return err
 	}
 
-	head := plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.NewBranchReferenceName("main"))
+	head := plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.NewBranchReferenceName(DefaultBranch()))
 	return repo.Storer.SetReference(head)
 }
 
+// CleanChartPath returns filePath cleaned, or ErrInvalidPath when it is empty
+// or leaves the chart root.
+func CleanChartPath(filePath string) (string, error) {
+	return cleanChartPath(filePath)
+}
+
 func cleanChartPath(filePath string) (string, error) {
 	if filePath == "" {
 		return "", ErrInvalidPath
@@ -338,7 +701,7 @@ func writeBlob(repo *git.Repository, contents string) (plumbing.Hash, error) {
 	return repo.Storer.SetEncodedObject(obj)
 }
 
-func writeTree(repo *git.Repository, tree *object.Tree, parts []string, blobHash plumbing.Hash) (plumbing.Hash, error) {
+func writeTree(repo *git.Repository, tree *object.Tree, parts []string, blobHash plumbing.Hash, mode filemode.FileMode) (plumbing.Hash, error) {
 	if len(parts) == 0 {
 		return plumbing.ZeroHash, ErrInvalidPath
 	}
@@ -361,7 +724,7 @@ func writeTree(repo *git.Repository, tree *object.Tree, parts []string, blobHash
 		}
 		entries = append(entries, object.TreeEntry{
 			Name: name,
-			Mode: filemode.Regular,
+			Mode: mode,
 			Hash: blobHash,
 		})
 	} else {
@@ -379,7 +742,7 @@ func writeTree(repo *git.Repository, tree *object.Tree, parts []string, blobHash
 			nextTree = &object.Tree{}
 		}
 
-		childHash, err := writeTree(repo, nextTree, parts[1:], blobHash)
+		childHash, err := writeTree(repo, nextTree, parts[1:], blobHash, mode)
 		if err != nil {
 			return plumbing.ZeroHash, err
 		}
@@ -400,3 +763,109 @@ func writeTree(repo *git.Repository, tree *object.Tree, parts []string, blobHash
 
 	return repo.Storer.SetEncodedObject(obj)
 }
+
+// moveTreeEntry moves the file at oldPath to newPath, reusing its blob and
+// mode, and returns the hash of the rewritten tree. The destination must not
+// exist yet.
+func moveTreeEntry(repo *git.Repository, tree *object.Tree, oldPath, newPath string) (plumbing.Hash, error) {
+	entry, err := tree.FindEntry(oldPath)
+	if err != nil {
+		return plumbing.ZeroHash, object.ErrFileNotFound
+	}
+	if entry.Mode == filemode.Dir {
+		return plumbing.ZeroHash, ErrPathIsDirectory
+	}
+	if _, err := tree.FindEntry(newPath); err == nil {
+		return plumbing.ZeroHash, ErrPathExists
+	}
+	if entry.Mode == filemode.Symlink {
+		// Relative targets resolve differently from the new directory.
+		link, err := tree.TreeEntryFile(entry)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		target, err := link.Contents()
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		if err := checkSymlinkTarget(newPath, target); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	blobHash, mode := entry.Hash, entry.Mode
+	treeHash, err := removeTreeEntry(repo, tree, strings.Split(oldPath, "/"))
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	tree, err = object.GetTree(repo.Storer, treeHash)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return writeTree(repo, tree, strings.Split(newPath, "/"), blobHash, mode)
+}
+
+// removeTreeEntry removes the file at parts from tree, dropping directories
+// left empty, and returns the hash of the rewritten tree.
+func removeTreeEntry(repo *git.Repository, tree *object.Tree, parts []string) (plumbing.Hash, error) {
+	if len(parts) == 0 {
+		return plumbing.ZeroHash, ErrInvalidPath
+	}
+
+	name := parts[0]
+	entries := make([]object.TreeEntry, 0, len(tree.Entries))
+	var existing *object.TreeEntry
+	for i := range tree.Entries {
+		entry := tree.Entries[i]
+		if entry.Name == name {
+			existing = &entry
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if existing == nil {
+		return plumbing.ZeroHash, object.ErrFileNotFound
+	}
+
+	if len(parts) == 1 {
+		if existing.Mode == filemode.Dir {
+			return plumbing.ZeroHash, ErrPathIsDirectory
+		}
+	} else {
+		if existing.Mode != filemode.Dir {
+			return plumbing.ZeroHash, object.ErrFileNotFound
+		}
+		childTree, err := object.GetTree(repo.Storer, existing.Hash)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		childHash, err := removeTreeEntry(repo, childTree, parts[1:])
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		childTree, err = object.GetTree(repo.Storer, childHash)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		if len(childTree.Entries) > 0 {
+			entries = append(entries, object.TreeEntry{
+				Name: name,
+				Mode: filemode.Dir,
+				Hash: childHash,
+			})
+		}
+	}
+
+	sort.Sort(object.TreeEntrySorter(entries))
+	newTree := &object.Tree{Entries: entries}
+	obj := repo.Storer.NewEncodedObject()
+	if err := newTree.Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return repo.Storer.SetEncodedObject(obj)
+}
@@ -0,0 +1,128 @@
+package chart
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+)
+
+var ErrInvalidHCL = errors.New("invalid HCL configuration")
+var ErrNotHCL = errors.New("not an HCL configuration file")
+
+// IsHCL reports whether a chart file holds native HCL configuration or
+// variable definitions.
+func IsHCL(filePath string) bool {
+	return strings.HasSuffix(filePath, ".tf") || strings.HasSuffix(filePath, ".tfvars")
+}
+
+// ValidateHCL checks that contents are syntactically valid HCL.
+func ValidateHCL(filePath string, contents []byte) error {
+	if _, diags := hclsyntax.ParseConfig(contents, filePath, hcl.InitialPos); diags.HasErrors() {
+		return fmt.Errorf("%w: %s", ErrInvalidHCL, diags.Error())
+	}
+	return nil
+}
+
+// FormatHCL rewrites contents in the canonical HCL style `tofu fmt` uses.
+func FormatHCL(filePath string, contents []byte) ([]byte, error) {
+	if err := ValidateHCL(filePath, contents); err != nil {
+		return nil, err
+	}
+	return hclwrite.Format(contents), nil
+}
+
+// FormatChartFiles formats the given HCL files of the chart branch, or every
+// HCL file when paths is empty, and commits the files that changed. Without
+// changes no commit is made and the current commit is returned. A commit
+// landing meanwhile fails the format with ErrHistoryChanged rather than being
+// overwritten.
+func FormatChartFiles(chartID string, paths []string, message string) (string, []string, error) {
+	repo, err := openChartRepo(chartID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	branchName, parentHash, err := chartBranch(repo)
+	if err != nil {
+		return "", nil, err
+	}
+	if parentHash.IsZero() {
+		return "", nil, object.ErrFileNotFound
+	}
+	parent, err := repo.CommitObject(parentHash)
+	if err != nil {
+		return "", nil, err
+	}
+	tree, err := parent.Tree()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(paths) == 0 {
+		err := tree.Files().ForEach(func(file *object.File) error {
+			if IsHCL(file.Name) {
+				paths = append(paths, file.Name)
+			}
+			return nil
+		})
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	sort.Strings(paths)
+
+	changed := []string{}
+	for _, filePath := range paths {
+		cleanPath, err := cleanChartPath(filePath)
+		if err != nil {
+			return "", nil, err
+		}
+		if !IsHCL(cleanPath) {
+			return "", nil, fmt.Errorf("%w: %s", ErrNotHCL, filePath)
+		}
+		file, err := tree.File(cleanPath)
+		if err != nil {
+			return "", nil, err
+		}
+		contents, err := file.Contents()
+		if err != nil {
+			return "", nil, err
+		}
+
+		formatted, err := FormatHCL(cleanPath, []byte(contents))
+		if err != nil {
+			return "", nil, err
+		}
+		if string(formatted) == contents {
+			continue
+		}
+
+		blobHash, err := writeBlob(repo, string(formatted))
+		if err != nil {
+			return "", nil, err
+		}
+		treeHash, err := writeTree(repo, tree, strings.Split(cleanPath, "/"), blobHash, file.Mode)
+		if err != nil {
+			return "", nil, err
+		}
+		if tree, err = object.GetTree(repo.Storer, treeHash); err != nil {
+			return "", nil, err
+		}
+		changed = append(changed, cleanPath)
+	}
+
+	if len(changed) == 0 {
+		return parentHash.String(), changed, nil
+	}
+	commitHash, err := commitTree(repo, chartID, branchName, parentHash, tree.Hash, message)
+	if err != nil {
+		return "", nil, err
+	}
+	return commitHash, changed, nil
+}
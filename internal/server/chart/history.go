@@ -0,0 +1,234 @@
+package chart
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+var ErrNoCommitAt = errors.New("chart has no commit at that time")
+
+type CommitInfo struct {
+	Hash        string
+	Message     string
+	AuthorName  string
+	AuthorEmail string
+	When        time.Time
+	Paths       []string // Paths changed relative to the first parent
+}
+
+// ListChartHistory walks the commit graph from ref (HEAD by default) in
+// reverse chronological order and returns up to limit commits after skipping
+// offset. The boolean result reports whether more commits follow.
+func ListChartHistory(chartID, ref string, offset, limit int) (string, []CommitInfo, bool, error) {
+	repo, err := openChartRepo(chartID)
+	if err != nil {
+		return "", nil, false, err
+	}
+
+	commit, err := resolveChartCommit(repo, ref)
+	if err != nil {
+		if ref == "" && errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return "", []CommitInfo{}, false, nil
+		}
+		return "", nil, false, err
+	}
+
+	iter, err := repo.Log(&git.LogOptions{From: commit.Hash, Order: git.LogOrderCommitterTime})
+	if err != nil {
+		return "", nil, false, err
+	}
+	defer iter.Close()
+
+	commits := []CommitInfo{}
+	more := false
+	index := 0
+	err = iter.ForEach(func(c *object.Commit) error {
+		defer func() { index++ }()
+		if index < offset {
+			return nil
+		}
+		if len(commits) == limit {
+			more = true
+			return storer.ErrStop
+		}
+
+		info, err := commitInfo(c)
+		if err != nil {
+			return err
+		}
+		commits = append(commits, info)
+		return nil
+	})
+	if err != nil {
+		return "", nil, false, err
+	}
+
+	return commit.Hash.String(), commits, more, nil
+}
+
+func commitInfo(commit *object.Commit) (CommitInfo, error) {
+	paths, err := changedPaths(commit)
+	if err != nil {
+		return CommitInfo{}, err
+	}
+
+	return CommitInfo{
+		Hash:        commit.Hash.String(),
+		Message:     commit.Message,
+		AuthorName:  commit.Author.Name,
+		AuthorEmail: commit.Author.Email,
+		When:        commit.Author.When,
+		Paths:       paths,
+	}, nil
+}
+
+// changedPaths lists the paths a commit touched compared to its first parent,
+// or every path for a root commit.
+func changedPaths(commit *object.Commit) ([]string, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	parentTree, err := firstParentTree(commit)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(changes))
+	for _, change := range changes {
+		name := change.To.Name
+		if name == "" {
+			name = change.From.Name
+		}
+		paths = append(paths, name)
+	}
+
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// lastChangingCommits finds the newest commit changing each path, following
+// first parents back from commit. A path changes in a commit when its entry
+// differs from the parent's, so a directory changes with any file below it.
+func lastChangingCommits(commit *object.Commit, paths []string) (map[string]*object.Commit, error) {
+	pending := map[string]plumbing.Hash{}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range paths {
+		pending[name] = treeEntryHash(tree, name)
+	}
+
+	found := map[string]*object.Commit{}
+	for len(pending) > 0 {
+		var parent *object.Commit
+		parentTree := &object.Tree{}
+		if commit.NumParents() > 0 {
+			if parent, err = commit.Parent(0); err != nil {
+				return nil, err
+			}
+			if parentTree, err = parent.Tree(); err != nil {
+				return nil, err
+			}
+		}
+
+		for name, hash := range pending {
+			parentHash := treeEntryHash(parentTree, name)
+			if parentHash != hash {
+				found[name] = commit
+				delete(pending, name)
+			}
+		}
+		if parent == nil {
+			break
+		}
+		commit = parent
+	}
+	return found, nil
+}
+
+// treeEntryHash is the hash of the entry at name, or the zero hash when the
+// tree has none.
+func treeEntryHash(tree *object.Tree, name string) plumbing.Hash {
+	entry, err := tree.FindEntry(name)
+	if err != nil {
+		return plumbing.ZeroHash
+	}
+	return entry.Hash
+}
+
+func openChartRepo(chartID string) (*git.Repository, error) {
+	return git.PlainOpen(filepath.Join(ChartWorkdir(), chartID))
+}
+
+// ResolveChartRef resolves ref (HEAD by default) to a commit hash.
+func ResolveChartRef(chartID, ref string) (string, error) {
+	repo, err := openChartRepo(chartID)
+	if err != nil {
+		return "", err
+	}
+
+	commit, err := resolveChartCommit(repo, ref)
+	if err != nil {
+		return "", err
+	}
+
+	return commit.Hash.String(), nil
+}
+
+// ResolveChartRefAt resolves ref (HEAD by default) to the newest commit on its
+// first-parent line committed at or before at, which is what the branch
+// pointed to at that time.
+func ResolveChartRefAt(chartID, ref string, at time.Time) (string, error) {
+	repo, err := openChartRepo(chartID)
+	if err != nil {
+		return "", err
+	}
+
+	commit, err := resolveChartCommit(repo, ref)
+	if err != nil {
+		return "", err
+	}
+	for commit.Committer.When.After(at) {
+		if commit.NumParents() == 0 {
+			return "", ErrNoCommitAt
+		}
+		if commit, err = commit.Parent(0); err != nil {
+			return "", err
+		}
+	}
+
+	return commit.Hash.String(), nil
+}
+
+// resolveChartCommit resolves ref to a commit, defaulting to HEAD.
+func resolveChartCommit(repo *git.Repository, ref string) (*object.Commit, error) {
+	if ref == "" {
+		head, err := repo.Head()
+		if err != nil {
+			return nil, err
+		}
+
+		ref = head.Hash().String()
+	}
+
+	hash, err := repo.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.CommitObject(*hash)
+}
@@ -0,0 +1,92 @@
+package chart
+
+import (
+	"bufio"
+	"errors"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// LockfileName is the dependency lock file tofu writes next to a module.
+const LockfileName = ".terraform.lock.hcl"
+
+// LockedProvider is a provider version pinned by a dependency lock file.
+type LockedProvider struct {
+	Path    string // Lock file the provider was found in
+	Source  string // Provider address, e.g. registry.opentofu.org/hashicorp/aws
+	Version string
+}
+
+// ListChartLockedProviders returns the providers pinned by every lock file of
+// the chart at ref (HEAD by default), with the resolved commit hash. Charts
+// without commits have no providers.
+func ListChartLockedProviders(chartID, ref string) (string, []LockedProvider, error) {
+	repo, err := openChartRepo(chartID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	commit, err := resolveChartCommit(repo, ref)
+	if err != nil {
+		if ref == "" && errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return "", []LockedProvider{}, nil
+		}
+		return "", nil, err
+	}
+
+	files, err := commit.Files()
+	if err != nil {
+		return "", nil, err
+	}
+
+	providers := []LockedProvider{}
+	err = files.ForEach(func(f *object.File) error {
+		if path.Base(f.Name) != LockfileName {
+			return nil
+		}
+		content, err := f.Contents()
+		if err != nil {
+			return err
+		}
+		providers = append(providers, parseLockfile(f.Name, content)...)
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return commit.Hash.String(), providers, nil
+}
+
+// parseLockfile reads the provider blocks of a lock file. The format is
+// generated by tofu, so a line based reader is enough: each block opens with
+// `provider "<address>" {` and pins a top level `version = "<version>"`.
+func parseLockfile(name, content string) []LockedProvider {
+	providers := []LockedProvider{}
+	var current *LockedProvider
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "provider ") && strings.HasSuffix(line, "{"):
+			source := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "provider "), "{"))
+			current = &LockedProvider{Path: name, Source: strings.Trim(source, `"`)}
+		case current == nil:
+		case line == "}":
+			if current.Version != "" {
+				providers = append(providers, *current)
+			}
+			current = nil
+		case strings.HasPrefix(line, "version "):
+			if key, value, ok := strings.Cut(line, "="); ok && strings.TrimSpace(key) == "version" {
+				current.Version = strings.Trim(strings.TrimSpace(value), `"`)
+			}
+		}
+	}
+
+	return providers
+}
@@ -0,0 +1,335 @@
+package chart
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+var ErrMergeConflict = errors.New("merge has conflicts")
+var ErrAlreadyMerged = errors.New("source branch is already merged")
+var ErrSameBranch = errors.New("source and target branch are the same")
+var ErrInvalidResolution = errors.New("resolution for a path without conflict")
+
+const (
+	ConflictContent       = "content"        // Both sides changed the file differently
+	ConflictAddAdd        = "add/add"        // Both sides added the file with different contents
+	ConflictDeletedSource = "deleted/source" // Source deleted a file target changed
+	ConflictDeletedTarget = "deleted/target" // Target deleted a file source changed
+	ConflictDirectory     = "directory"      // A file on one side is a directory on the other
+)
+
+// MergeConflict is a path both branches changed since their merge base in a
+// way that can't be combined. Hashes are the blobs of each side, empty where
+// the file doesn't exist. Content conflicts of text files carry the hunks
+// that couldn't be merged.
+type MergeConflict struct {
+	Path   string
+	Kind   string
+	Base   string
+	Source string
+	Target string
+	Hunks  []MergeHunk
+}
+
+type MergeResult struct {
+	Source string // Merged source commit
+	Target string // Target commit before the merge
+	Commit string // Merge commit
+	Paths  []string
+}
+
+type treeFile struct {
+	hash plumbing.Hash
+	mode filemode.FileMode
+}
+
+// MergeChartBranches merges the source branch into the target branch with a
+// merge commit. Files changed on one side only since the merge base are taken
+// from that side, and text files both sides changed are merged line by line.
+// Remaining conflicts are returned with ErrMergeConflict and leave the target
+// untouched, unless resolutions holds the content to commit for the path, or
+// nil to delete it. An empty message defaults to naming both branches.
+func MergeChartBranches(chartID, source, target, message string, resolutions map[string]*string) (MergeResult, []MergeConflict, error) {
+	if source == target {
+		return MergeResult{}, nil, ErrSameBranch
+	}
+
+	repo, err := openChartRepo(chartID)
+	if err != nil {
+		return MergeResult{}, nil, err
+	}
+
+	sourceCommit, err := branchCommit(repo, source)
+	if err != nil {
+		return MergeResult{}, nil, err
+	}
+	targetName := plumbing.NewBranchReferenceName(target)
+	targetCommit, err := branchCommit(repo, target)
+	if err != nil {
+		return MergeResult{}, nil, err
+	}
+
+	merged, err := sourceCommit.IsAncestor(targetCommit)
+	if err != nil {
+		return MergeResult{}, nil, err
+	}
+	if merged || sourceCommit.Hash == targetCommit.Hash {
+		return MergeResult{}, nil, ErrAlreadyMerged
+	}
+
+	baseFiles := map[string]treeFile{}
+	bases, err := sourceCommit.MergeBase(targetCommit)
+	if err != nil {
+		return MergeResult{}, nil, err
+	}
+	if len(bases) > 0 {
+		if baseFiles, err = commitFiles(bases[0]); err != nil {
+			return MergeResult{}, nil, err
+		}
+	}
+	sourceFiles, err := commitFiles(sourceCommit)
+	if err != nil {
+		return MergeResult{}, nil, err
+	}
+	targetFiles, err := commitFiles(targetCommit)
+	if err != nil {
+		return MergeResult{}, nil, err
+	}
+
+	treeHash, changed, conflicts, err := mergeTrees(repo, targetCommit, baseFiles, sourceFiles, targetFiles, resolutions)
+	if err != nil {
+		return MergeResult{}, nil, err
+	}
+	if len(conflicts) > 0 {
+		return MergeResult{}, conflicts, ErrMergeConflict
+	}
+
+	if message == "" {
+		message = fmt.Sprintf("Merge branch %s into %s", source, target)
+	}
+	commitHash, err := commitTreeParents(repo, chartID, targetName, []plumbing.Hash{targetCommit.Hash, sourceCommit.Hash}, treeHash, message)
+	if err != nil {
+		return MergeResult{}, nil, err
+	}
+
+	return MergeResult{
+		Source: sourceCommit.Hash.String(),
+		Target: targetCommit.Hash.String(),
+		Commit: commitHash,
+		Paths:  changed,
+	}, nil, nil
+}
+
+// mergeTrees applies the changes source made since base on top of the tree of
+// target, returning the merged tree, the paths taken from source and the
+// paths both sides changed in ways that couldn't be merged. Conflicting paths
+// with a resolution get the resolved content instead.
+func mergeTrees(repo *git.Repository, target *object.Commit, baseFiles, sourceFiles, targetFiles map[string]treeFile, resolutions map[string]*string) (plumbing.Hash, []string, []MergeConflict, error) {
+	paths := map[string]bool{}
+	for _, files := range []map[string]treeFile{baseFiles, sourceFiles, targetFiles} {
+		for name := range files {
+			paths[name] = true
+		}
+	}
+	names := make([]string, 0, len(paths))
+	for name := range paths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Start from the target tree and apply the changes only the source made.
+	tree, err := target.Tree()
+	if err != nil {
+		return plumbing.ZeroHash, nil, nil, err
+	}
+	treeHash := target.TreeHash
+	conflicts := []MergeConflict{}
+	changed := []string{}
+	resolved := map[string]bool{}
+	for _, name := range names {
+		base, inBase := baseFiles[name]
+		src, inSource := sourceFiles[name]
+		dst, inTarget := targetFiles[name]
+		if inSource == inTarget && src == dst {
+			continue
+		}
+
+		next, keep := src, inSource
+		if inTarget == inBase && dst == base {
+			// Only the source changed the file.
+		} else if inSource == inBase && src == base {
+			continue
+		} else {
+			conflict := newMergeConflict(name, baseFiles, sourceFiles, targetFiles)
+			resolution, hasResolution := resolutions[name]
+			switch {
+			case hasResolution:
+				resolved[name] = true
+				keep = resolution != nil
+				if !keep && !inTarget {
+					continue
+				}
+				if keep {
+					next.mode = mergedMode(base, src, dst, inTarget)
+					if next.hash, err = writeBlob(repo, *resolution); err != nil {
+						return plumbing.ZeroHash, nil, nil, err
+					}
+				}
+			case conflict.Kind == ConflictContent:
+				merged, hunks, err := mergeBlobs(repo, base.hash, src.hash, dst.hash)
+				if err != nil {
+					return plumbing.ZeroHash, nil, nil, err
+				}
+				if hunks == nil || len(hunks) > 0 {
+					conflict.Hunks = hunks
+					conflicts = append(conflicts, conflict)
+					continue
+				}
+				next.mode = mergedMode(base, src, dst, inTarget)
+				if next.hash, err = writeBlob(repo, merged); err != nil {
+					return plumbing.ZeroHash, nil, nil, err
+				}
+			default:
+				conflicts = append(conflicts, conflict)
+				continue
+			}
+		}
+
+		parts := strings.Split(name, "/")
+		var nextHash plumbing.Hash
+		if keep {
+			nextHash, err = writeTree(repo, tree, parts, next.hash, next.mode)
+		} else {
+			nextHash, err = removeTreeEntry(repo, tree, parts)
+		}
+		if errors.Is(err, ErrPathIsDirectory) || errors.Is(err, object.ErrFileNotFound) {
+			conflict := newMergeConflict(name, baseFiles, sourceFiles, targetFiles)
+			conflict.Kind = ConflictDirectory
+			conflicts = append(conflicts, conflict)
+			continue
+		}
+		if err != nil {
+			return plumbing.ZeroHash, nil, nil, err
+		}
+		if tree, err = object.GetTree(repo.Storer, nextHash); err != nil {
+			return plumbing.ZeroHash, nil, nil, err
+		}
+		treeHash = nextHash
+		changed = append(changed, name)
+	}
+
+	for name := range resolutions {
+		if !resolved[name] {
+			return plumbing.ZeroHash, nil, nil, fmt.Errorf("%w: %s", ErrInvalidResolution, name)
+		}
+	}
+	return treeHash, changed, conflicts, nil
+}
+
+// mergeBlobs merges the text blobs both sides changed since base. Hunks are
+// nil when the blobs aren't text and can't be merged.
+func mergeBlobs(repo *git.Repository, base, source, target plumbing.Hash) (string, []MergeHunk, error) {
+	contents := make([]string, 0, 3)
+	for _, hash := range []plumbing.Hash{base, source, target} {
+		blob, err := repo.BlobObject(hash)
+		if err != nil {
+			return "", nil, err
+		}
+		reader, err := blob.Reader()
+		if err != nil {
+			return "", nil, err
+		}
+		data, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return "", nil, err
+		}
+		contents = append(contents, string(data))
+	}
+
+	merged, hunks, ok := mergeText(contents[0], contents[1], contents[2])
+	if !ok {
+		return "", nil, nil
+	}
+	return merged, hunks, nil
+}
+
+// mergedMode is the file mode of a merged file: the target's, unless only the
+// source changed it.
+func mergedMode(base, source, target treeFile, inTarget bool) filemode.FileMode {
+	if !inTarget {
+		return source.mode
+	}
+	if target.mode == base.mode && source.mode != 0 {
+		return source.mode
+	}
+	return target.mode
+}
+
+func newMergeConflict(name string, base, source, target map[string]treeFile) MergeConflict {
+	conflict := MergeConflict{Path: name}
+	hash := func(files map[string]treeFile) string {
+		if file, ok := files[name]; ok {
+			return file.hash.String()
+		}
+		return ""
+	}
+	conflict.Base, conflict.Source, conflict.Target = hash(base), hash(source), hash(target)
+
+	switch {
+	case conflict.Base == "":
+		conflict.Kind = ConflictAddAdd
+	case conflict.Source == "":
+		conflict.Kind = ConflictDeletedSource
+	case conflict.Target == "":
+		conflict.Kind = ConflictDeletedTarget
+	default:
+		conflict.Kind = ConflictContent
+	}
+	return conflict
+}
+
+// branchCommit returns the commit a branch points to.
+func branchCommit(repo *git.Repository, branch string) (*object.Commit, error) {
+	name := plumbing.NewBranchReferenceName(branch)
+	if err := name.Validate(); err != nil || branch == "" {
+		return nil, plumbing.ErrReferenceNotFound
+	}
+	ref, err := repo.Reference(name, true)
+	if err != nil {
+		return nil, err
+	}
+	return repo.CommitObject(ref.Hash())
+}
+
+// commitFiles maps every file of a commit to its blob and mode.
+func commitFiles(commit *object.Commit) (map[string]treeFile, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]treeFile{}
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if entry.Mode != filemode.Dir {
+			files[name] = treeFile{hash: entry.Hash, mode: entry.Mode}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package chart
+
+import (
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// MergeHunk is a region of a file both sides changed differently. BaseStart
+// is the first base line the region replaces, counted from 1; lines keep
+// their line endings.
+type MergeHunk struct {
+	BaseStart int
+	Base      []string
+	Source    []string
+	Target    []string
+}
+
+// lineEdit replaces the base lines [start, end) with lines.
+type lineEdit struct {
+	start, end int
+	lines      []string
+}
+
+// mergeText merges the changes source and target made to base line by line.
+// Changes touching the same or adjacent base lines are combined only when
+// both sides made the same change; otherwise they are returned as hunks and
+// the merged text is not usable. Binary contents can't be merged.
+func mergeText(base, source, target string) (string, []MergeHunk, bool) {
+	for _, text := range []string{base, source, target} {
+		if !utf8.ValidString(text) || strings.ContainsRune(text, 0) {
+			return "", nil, false
+		}
+	}
+
+	baseLines := splitLines(base)
+	sourceEdits := lineEdits(base, source)
+	targetEdits := lineEdits(base, target)
+
+	var merged strings.Builder
+	hunks := []MergeHunk{}
+	pos := 0
+	for len(sourceEdits) > 0 || len(targetEdits) > 0 {
+		// Group the next edit with every edit of either side overlapping or
+		// adjacent to the group.
+		var fromSource, fromTarget []lineEdit
+		takeSource := len(targetEdits) == 0 || (len(sourceEdits) > 0 && sourceEdits[0].start <= targetEdits[0].start)
+		var first lineEdit
+		if takeSource {
+			first, sourceEdits = sourceEdits[0], sourceEdits[1:]
+			fromSource = append(fromSource, first)
+		} else {
+			first, targetEdits = targetEdits[0], targetEdits[1:]
+			fromTarget = append(fromTarget, first)
+		}
+		lo, hi := first.start, first.end
+		for {
+			if len(sourceEdits) > 0 && sourceEdits[0].start <= hi {
+				hi = max(hi, sourceEdits[0].end)
+				fromSource, sourceEdits = append(fromSource, sourceEdits[0]), sourceEdits[1:]
+				continue
+			}
+			if len(targetEdits) > 0 && targetEdits[0].start <= hi {
+				hi = max(hi, targetEdits[0].end)
+				fromTarget, targetEdits = append(fromTarget, targetEdits[0]), targetEdits[1:]
+				continue
+			}
+			break
+		}
+
+		writeLines(&merged, baseLines[pos:lo])
+		sourceLines := applyLineEdits(baseLines, lo, hi, fromSource)
+		targetLines := applyLineEdits(baseLines, lo, hi, fromTarget)
+		switch {
+		case len(fromTarget) == 0:
+			writeLines(&merged, sourceLines)
+		case len(fromSource) == 0 || slices.Equal(sourceLines, targetLines):
+			writeLines(&merged, targetLines)
+		default:
+			hunks = append(hunks, MergeHunk{
+				BaseStart: lo + 1,
+				Base:      append([]string{}, baseLines[lo:hi]...),
+				Source:    sourceLines,
+				Target:    targetLines,
+			})
+		}
+		pos = hi
+	}
+	writeLines(&merged, baseLines[pos:])
+
+	return merged.String(), hunks, true
+}
+
+// lineEdits lists the line changes turning base into side, in base order.
+func lineEdits(base, side string) []lineEdit {
+	edits := []lineEdit{}
+	pos := 0
+	var current *lineEdit
+	for _, d := range diff.Do(base, side) {
+		lines := splitLines(d.Text)
+		switch d.Type {
+		case diffmatchpatch.DiffEqual:
+			if current != nil {
+				edits = append(edits, *current)
+				current = nil
+			}
+			pos += len(lines)
+		case diffmatchpatch.DiffDelete:
+			if current == nil {
+				current = &lineEdit{start: pos, end: pos}
+			}
+			pos += len(lines)
+			current.end = pos
+		case diffmatchpatch.DiffInsert:
+			if current == nil {
+				current = &lineEdit{start: pos, end: pos}
+			}
+			current.lines = append(current.lines, lines...)
+		}
+	}
+	if current != nil {
+		edits = append(edits, *current)
+	}
+	return edits
+}
+
+// applyLineEdits returns the base lines [lo, hi) with edits applied.
+func applyLineEdits(baseLines []string, lo, hi int, edits []lineEdit) []string {
+	lines := []string{}
+	pos := lo
+	for _, edit := range edits {
+		lines = append(lines, baseLines[pos:edit.start]...)
+		lines = append(lines, edit.lines...)
+		pos = edit.end
+	}
+	return append(lines, baseLines[pos:hi]...)
+}
+
+// splitLines splits text after each newline, keeping line endings.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func writeLines(out *strings.Builder, lines []string) {
+	for _, line := range lines {
+		out.WriteString(line)
+	}
+}
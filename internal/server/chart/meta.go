@@ -0,0 +1,93 @@
+package chart
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// metaDir holds server-side chart settings inside the bare repository, next
+// to the git objects, so they are never part of the chart tree and are
+// removed together with the chart.
+const metaDir = "planemgr"
+
+var ErrMetaNotFound = errors.New("chart metadata not found")
+
+// ReadChartMeta decodes the named metadata document of a chart into v.
+func ReadChartMeta(chartID, name string, v any) error {
+	if _, err := openChartRepo(chartID); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(chartMetaPath(chartID, name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrMetaNotFound
+		}
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// WriteChartMeta replaces the named metadata document of a chart.
+func WriteChartMeta(chartID, name string, v any) error {
+	if _, err := openChartRepo(chartID); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	target := chartMetaPath(chartID, name)
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), target)
+}
+
+// DeleteChartMeta removes the named metadata document of a chart, if any.
+func DeleteChartMeta(chartID, name string) error {
+	if _, err := openChartRepo(chartID); err != nil {
+		return err
+	}
+
+	if err := os.Remove(chartMetaPath(chartID, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// ChartMetaName returns the name of the metadata document stored at rel, a
+// path inside a chart repository, or false when rel is no metadata document.
+func ChartMetaName(rel string) (string, bool) {
+	dir, file := filepath.Split(filepath.Clean(rel))
+	name, ok := strings.CutSuffix(file, ".json")
+	if filepath.Clean(dir) != metaDir || !ok || name == "" {
+		return "", false
+	}
+	return name, true
+}
+
+func chartMetaPath(chartID, name string) string {
+	return filepath.Join(ChartWorkdir(), chartID, metaDir, name+".json")
+}
@@ -0,0 +1,94 @@
+package chart
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// OwnersFile is the chart root file mapping paths to their owners.
+const OwnersFile = "OWNERS"
+
+var ErrInvalidOwners = errors.New("invalid owners file")
+
+// OwnersRule assigns the paths matching Pattern to Owners. Later rules take
+// precedence, and a rule without owners leaves its paths unowned.
+type OwnersRule struct {
+	Pattern string
+	Owners  []string
+}
+
+// ChartOwners are the rules of an owners file, in file order.
+type ChartOwners []OwnersRule
+
+// ReadChartOwners parses the owners file of the chart at ref. Every line
+// holds a path pattern followed by its owners, and # starts a comment. A
+// chart without the file has no owners.
+func ReadChartOwners(chartID, ref string) (ChartOwners, error) {
+	_, contents, err := ReadChartFile(chartID, OwnersFile, ref)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return ParseChartOwners(contents)
+}
+
+// ParseChartOwners parses the contents of an owners file.
+func ParseChartOwners(contents string) (ChartOwners, error) {
+	var owners ChartOwners
+	for number, line := range strings.Split(contents, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		pattern := strings.TrimPrefix(fields[0], "/")
+		if _, err := path.Match(strings.TrimSuffix(pattern, "/"), ""); err != nil || pattern == "" {
+			return nil, fmt.Errorf("%w: line %d: bad pattern %q", ErrInvalidOwners, number+1, fields[0])
+		}
+		owners = append(owners, OwnersRule{Pattern: pattern, Owners: fields[1:]})
+	}
+	return owners, nil
+}
+
+// Owners returns the owners of the file at name, from the last rule matching
+// it.
+func (o ChartOwners) Owners(name string) []string {
+	for i := len(o) - 1; i >= 0; i-- {
+		if ownersPatternMatches(o[i].Pattern, name) {
+			return o[i].Owners
+		}
+	}
+	return nil
+}
+
+// ownersPatternMatches reports whether pattern matches the file at name or
+// one of its directories. Patterns without a slash match at any depth, and
+// those ending with one only match directories.
+func ownersPatternMatches(pattern, name string) bool {
+	dirOnly := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+	anyDepth := !strings.Contains(pattern, "/")
+
+	parts := strings.Split(name, "/")
+	for end := len(parts); end > 0; end-- {
+		if dirOnly && end == len(parts) {
+			continue
+		}
+		for start := 0; start < end; start++ {
+			if start > 0 && !anyDepth {
+				break
+			}
+			if matched, _ := path.Match(pattern, strings.Join(parts[start:end], "/")); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,563 @@
+package chart
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+var ErrInvalidPatch = errors.New("invalid patch document")
+var ErrPatchConflict = errors.New("patch does not apply to the chart file")
+var ErrNotJSON = errors.New("chart file is not a JSON document")
+
+const (
+	PatchJSON  = "json-patch"  // RFC 6902 JSON Patch
+	PatchMerge = "merge-patch" // RFC 7386 JSON Merge Patch
+)
+
+// maxPatchAttempts bounds how often a patch is applied again when other
+// commits land while it is committed.
+const maxPatchAttempts = 5
+
+// PatchChartFile applies a JSON Patch or JSON Merge Patch document to a JSON
+// file on the chart branch and commits the result. Commits landing meanwhile
+// are never overwritten; the patch is applied again on top of them. The file
+// keeps its key order and indentation. The boolean result is false when the
+// patch changed nothing, in which case no commit is made.
+func PatchChartFile(chartID, filePath, kind string, patch []byte, message string) (string, bool, error) {
+	cleanPath, err := cleanChartPath(filePath)
+	if err != nil {
+		return "", false, err
+	}
+
+	repo, err := openChartRepo(chartID)
+	if err != nil {
+		return "", false, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		branchName, parentHash, err := chartBranch(repo)
+		if err != nil {
+			return "", false, err
+		}
+		if parentHash.IsZero() {
+			return "", false, object.ErrFileNotFound
+		}
+		parent, err := repo.CommitObject(parentHash)
+		if err != nil {
+			return "", false, err
+		}
+		file, err := parent.File(cleanPath)
+		if err != nil {
+			return "", false, err
+		}
+		contents, err := file.Contents()
+		if err != nil {
+			return "", false, err
+		}
+
+		patched, err := applyPatch(kind, []byte(contents), patch)
+		if err != nil {
+			return "", false, err
+		}
+		if string(patched) == contents {
+			return parentHash.String(), false, nil
+		}
+
+		blobHash, err := writeBlob(repo, string(patched))
+		if err != nil {
+			return "", false, err
+		}
+		tree, err := parent.Tree()
+		if err != nil {
+			return "", false, err
+		}
+		treeHash, err := writeTree(repo, tree, strings.Split(cleanPath, "/"), blobHash, file.Mode)
+		if err != nil {
+			return "", false, err
+		}
+
+		commitHash, err := commitTree(repo, chartID, branchName, parentHash, treeHash, message)
+		if errors.Is(err, ErrHistoryChanged) && attempt < maxPatchAttempts {
+			continue
+		}
+		if err != nil {
+			return "", false, err
+		}
+		return commitHash, true, nil
+	}
+}
+
+// applyPatch applies a patch document of the given kind to a JSON document.
+func applyPatch(kind string, document, patch []byte) ([]byte, error) {
+	root, err := parseJSONValue(document)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotJSON, err)
+	}
+
+	switch kind {
+	case PatchMerge:
+		merge, err := parseJSONValue(patch)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+		root = mergePatch(root, merge)
+	case PatchJSON:
+		var ops []jsonPatchOp
+		if err := json.Unmarshal(patch, &ops); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+		for i, op := range ops {
+			if err := op.apply(&root); err != nil {
+				return nil, fmt.Errorf("operation %d: %w", i, err)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown patch type %q", ErrInvalidPatch, kind)
+	}
+
+	var out bytes.Buffer
+	root.encode(&out, detectIndent(document), 0)
+	if bytes.HasSuffix(document, []byte("\n")) {
+		out.WriteByte('\n')
+	}
+	return out.Bytes(), nil
+}
+
+// mergePatch applies an RFC 7386 merge patch to target.
+func mergePatch(target, patch *jsonValue) *jsonValue {
+	if patch.kind != '{' {
+		return patch
+	}
+	if target == nil || target.kind != '{' {
+		target = &jsonValue{kind: '{'}
+	}
+	for _, member := range patch.members {
+		if member.value.isNull() {
+			target.remove(member.key)
+			continue
+		}
+		target.set(member.key, mergePatch(target.member(member.key), member.value))
+	}
+	return target
+}
+
+type jsonPatchOp struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// apply runs a single RFC 6902 operation against the document.
+func (op jsonPatchOp) apply(root **jsonValue) error {
+	if op.Path == nil {
+		return fmt.Errorf("%w: %s without path", ErrInvalidPatch, op.Op)
+	}
+	path, err := parseJSONPointer(*op.Path)
+	if err != nil {
+		return err
+	}
+
+	var from []string
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return fmt.Errorf("%w: %s without value", ErrInvalidPatch, op.Op)
+		}
+	case "move", "copy":
+		if op.From == nil {
+			return fmt.Errorf("%w: %s without from", ErrInvalidPatch, op.Op)
+		}
+		if from, err = parseJSONPointer(*op.From); err != nil {
+			return err
+		}
+	}
+
+	switch op.Op {
+	case "add":
+		parsed, err := parseJSONValue(op.Value)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+		return jsonAdd(root, path, parsed)
+	case "remove":
+		_, err := jsonRemove(root, path)
+		return err
+	case "replace":
+		parsed, err := parseJSONValue(op.Value)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+		if _, err := jsonRemove(root, path); err != nil {
+			return err
+		}
+		return jsonAdd(root, path, parsed)
+	case "move":
+		if len(from) < len(path) && slices.Equal(path[:len(from)], from) {
+			return fmt.Errorf("%w: cannot move %s into itself", ErrInvalidPatch, *op.From)
+		}
+		moved, err := jsonRemove(root, from)
+		if err != nil {
+			return err
+		}
+		return jsonAdd(root, path, moved)
+	case "copy":
+		copied, err := jsonGet(*root, from)
+		if err != nil {
+			return err
+		}
+		return jsonAdd(root, path, copied.clone())
+	case "test":
+		expected, err := parseJSONValue(op.Value)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+		actual, err := jsonGet(*root, path)
+		if err != nil {
+			return err
+		}
+		if !actual.equal(expected) {
+			return fmt.Errorf("%w: test of %s failed", ErrPatchConflict, *op.Path)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown operation %q", ErrInvalidPatch, op.Op)
+	}
+}
+
+// jsonGet returns the value a pointer addresses.
+func jsonGet(root *jsonValue, path []string) (*jsonValue, error) {
+	current := root
+	for i, token := range path {
+		switch current.kind {
+		case '{':
+			next := current.member(token)
+			if next == nil {
+				return nil, missingPath(path[:i+1])
+			}
+			current = next
+		case '[':
+			index, err := arrayIndex(token, len(current.items)-1)
+			if err != nil {
+				return nil, missingPath(path[:i+1])
+			}
+			current = current.items[index]
+		default:
+			return nil, missingPath(path[:i+1])
+		}
+	}
+	return current, nil
+}
+
+// jsonAdd adds value at path, replacing object members and shifting array
+// items.
+func jsonAdd(root **jsonValue, path []string, value *jsonValue) error {
+	if len(path) == 0 {
+		*root = value
+		return nil
+	}
+	parent, err := jsonGet(*root, path[:len(path)-1])
+	if err != nil {
+		return err
+	}
+
+	token := path[len(path)-1]
+	switch parent.kind {
+	case '{':
+		parent.set(token, value)
+	case '[':
+		if token == "-" {
+			parent.items = append(parent.items, value)
+			return nil
+		}
+		index, err := arrayIndex(token, len(parent.items))
+		if err != nil {
+			return missingPath(path)
+		}
+		parent.items = append(parent.items[:index], append([]*jsonValue{value}, parent.items[index:]...)...)
+	default:
+		return missingPath(path)
+	}
+	return nil
+}
+
+// jsonRemove removes the value at path and returns it.
+func jsonRemove(root **jsonValue, path []string) (*jsonValue, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("%w: the whole document can't be removed", ErrPatchConflict)
+	}
+	parent, err := jsonGet(*root, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	token := path[len(path)-1]
+	switch parent.kind {
+	case '{':
+		removed := parent.member(token)
+		if removed == nil {
+			return nil, missingPath(path)
+		}
+		parent.remove(token)
+		return removed, nil
+	case '[':
+		index, err := arrayIndex(token, len(parent.items)-1)
+		if err != nil {
+			return nil, missingPath(path)
+		}
+		removed := parent.items[index]
+		parent.items = append(parent.items[:index], parent.items[index+1:]...)
+		return removed, nil
+	default:
+		return nil, missingPath(path)
+	}
+}
+
+// parseJSONPointer splits an RFC 6901 pointer into its unescaped tokens.
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: invalid pointer %q", ErrInvalidPatch, pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses an array index token of at most max.
+func arrayIndex(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, strconv.ErrSyntax
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index > max {
+		return 0, strconv.ErrRange
+	}
+	return index, nil
+}
+
+func missingPath(path []string) error {
+	escaped := make([]string, len(path))
+	for i, token := range path {
+		escaped[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+	}
+	return fmt.Errorf("%w: path /%s does not exist", ErrPatchConflict, strings.Join(escaped, "/"))
+}
+
+// jsonValue is a parsed JSON document that keeps the order of object keys,
+// so patched files only change where the patch says.
+type jsonValue struct {
+	kind    byte            // '{', '[' or 0 for scalars
+	members []jsonMember    // Object members
+	items   []*jsonValue    // Array items
+	scalar  json.RawMessage // Strings, numbers, booleans and null
+}
+
+type jsonMember struct {
+	key   string
+	value *jsonValue
+}
+
+func parseJSONValue(data []byte) (*jsonValue, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	value, err := decodeJSONValue(decoder)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return nil, errors.New("unexpected data after the JSON value")
+	}
+	return value, nil
+}
+
+func decodeJSONValue(decoder *json.Decoder) (*jsonValue, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		value := &jsonValue{kind: '{', members: []jsonMember{}}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			member, err := decodeJSONValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			value.set(key.(string), member)
+		}
+		_, err := decoder.Token()
+		return value, err
+	case json.Delim('['):
+		value := &jsonValue{kind: '[', items: []*jsonValue{}}
+		for decoder.More() {
+			item, err := decodeJSONValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			value.items = append(value.items, item)
+		}
+		_, err := decoder.Token()
+		return value, err
+	default:
+		scalar, err := encodeJSONScalar(token)
+		if err != nil {
+			return nil, err
+		}
+		return &jsonValue{scalar: scalar}, nil
+	}
+}
+
+func encodeJSONScalar(token json.Token) (json.RawMessage, error) {
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(token); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(out.Bytes(), []byte("\n")), nil
+}
+
+func (v *jsonValue) member(key string) *jsonValue {
+	for _, member := range v.members {
+		if member.key == key {
+			return member.value
+		}
+	}
+	return nil
+}
+
+// set replaces the member named key in place, or appends it.
+func (v *jsonValue) set(key string, value *jsonValue) {
+	for i, member := range v.members {
+		if member.key == key {
+			v.members[i].value = value
+			return
+		}
+	}
+	v.members = append(v.members, jsonMember{key: key, value: value})
+}
+
+func (v *jsonValue) remove(key string) {
+	for i, member := range v.members {
+		if member.key == key {
+			v.members = append(v.members[:i], v.members[i+1:]...)
+			return
+		}
+	}
+}
+
+func (v *jsonValue) isNull() bool {
+	return v.kind == 0 && string(v.scalar) == "null"
+}
+
+func (v *jsonValue) clone() *jsonValue {
+	copied := &jsonValue{kind: v.kind, scalar: v.scalar}
+	for _, member := range v.members {
+		copied.members = append(copied.members, jsonMember{key: member.key, value: member.value.clone()})
+	}
+	for _, item := range v.items {
+		copied.items = append(copied.items, item.clone())
+	}
+	return copied
+}
+
+// equal compares values as RFC 6902 test does: object key order doesn't
+// matter and numbers compare by value.
+func (v *jsonValue) equal(other *jsonValue) bool {
+	var a, b bytes.Buffer
+	v.encode(&a, "", 0)
+	other.encode(&b, "", 0)
+	var left, right any
+	if json.Unmarshal(a.Bytes(), &left) != nil || json.Unmarshal(b.Bytes(), &right) != nil {
+		return false
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+// encode writes the value, one member or item per line with the given
+// indent, or compact when indent is empty.
+func (v *jsonValue) encode(out *bytes.Buffer, indent string, depth int) {
+	newline := func(depth int) {
+		if indent != "" {
+			out.WriteByte('\n')
+			out.WriteString(strings.Repeat(indent, depth))
+		}
+	}
+
+	switch v.kind {
+	case '{':
+		if len(v.members) == 0 {
+			out.WriteString("{}")
+			return
+		}
+		out.WriteByte('{')
+		for i, member := range v.members {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			newline(depth + 1)
+			key, _ := encodeJSONScalar(member.key)
+			out.Write(key)
+			out.WriteByte(':')
+			if indent != "" {
+				out.WriteByte(' ')
+			}
+			member.value.encode(out, indent, depth+1)
+		}
+		newline(depth)
+		out.WriteByte('}')
+	case '[':
+		if len(v.items) == 0 {
+			out.WriteString("[]")
+			return
+		}
+		out.WriteByte('[')
+		for i, item := range v.items {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			newline(depth + 1)
+			item.encode(out, indent, depth+1)
+		}
+		newline(depth)
+		out.WriteByte(']')
+	default:
+		out.Write(v.scalar)
+	}
+}
+
+// detectIndent returns the indent of the first indented line of a JSON
+// document, empty for compact documents and two spaces for documents
+// spanning lines without indent.
+func detectIndent(document []byte) string {
+	lines := bytes.Split(document, []byte("\n"))
+	if len(bytes.TrimSpace(document)) == 0 || len(lines) < 2 {
+		return ""
+	}
+	for _, line := range lines[1:] {
+		trimmed := bytes.TrimLeft(line, " \t")
+		if len(trimmed) > 0 && len(trimmed) < len(line) {
+			return string(line[:len(line)-len(trimmed)])
+		}
+	}
+	return "  "
+}
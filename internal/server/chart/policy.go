@@ -0,0 +1,113 @@
+package chart
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// CommitPolicyMeta names the metadata document holding the commit policy of
+// a chart.
+const CommitPolicyMeta = "commit-policy"
+
+var ErrInvalidCommitPolicy = errors.New("Invalid commit policy")
+
+// CommitPolicyError rejects a commit breaking the commit policy of a chart.
+type CommitPolicyError struct {
+	Reason string
+}
+
+func (e *CommitPolicyError) Error() string { return "commit rejected by policy: " + e.Reason }
+
+// CommitPolicy holds the conventions commits to a chart must follow, such as
+// a ticket ID in every message. Zero values leave a rule off.
+type CommitPolicy struct {
+	MessagePattern string   `json:"messagePattern,omitempty"` // Regular expression the message must match
+	MessagePrefix  string   `json:"messagePrefix,omitempty"`
+	MaxFiles       int      `json:"maxFiles,omitempty"`
+	DeniedPaths    []string `json:"deniedPaths,omitempty"` // path.Match globs, also denying everything below a matched directory
+}
+
+// ReadCommitPolicy returns the commit policy of a chart, which has every
+// rule off unless one was set.
+func ReadCommitPolicy(chartID string) (CommitPolicy, error) {
+	var policy CommitPolicy
+	if err := ReadChartMeta(chartID, CommitPolicyMeta, &policy); err != nil && !errors.Is(err, ErrMetaNotFound) {
+		return CommitPolicy{}, err
+	}
+	return policy, nil
+}
+
+func (p CommitPolicy) Validate() error {
+	if p.MessagePattern != "" {
+		if _, err := regexp.Compile(p.MessagePattern); err != nil {
+			return fmt.Errorf("%w: messagePattern: %v", ErrInvalidCommitPolicy, err)
+		}
+	}
+	if p.MaxFiles < 0 {
+		return fmt.Errorf("%w: maxFiles must not be negative", ErrInvalidCommitPolicy)
+	}
+	for _, pattern := range p.DeniedPaths {
+		if strings.TrimSpace(pattern) == "" {
+			return fmt.Errorf("%w: deniedPaths must not be empty", ErrInvalidCommitPolicy)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%w: deniedPaths: bad pattern %q", ErrInvalidCommitPolicy, pattern)
+		}
+	}
+	return nil
+}
+
+// Violation describes the first rule a commit with message touching paths
+// breaks, or returns an empty string when it follows the policy.
+func (p CommitPolicy) Violation(message string, paths []string) string {
+	if p.MessagePrefix != "" && !strings.HasPrefix(message, p.MessagePrefix) {
+		return fmt.Sprintf("message must start with %q", p.MessagePrefix)
+	}
+	if p.MessagePattern != "" {
+		pattern, err := regexp.Compile(p.MessagePattern)
+		if err != nil || !pattern.MatchString(message) {
+			return fmt.Sprintf("message must match %q", p.MessagePattern)
+		}
+	}
+	if p.MaxFiles > 0 && len(paths) > p.MaxFiles {
+		return fmt.Sprintf("commit changes %d files, at most %d are allowed", len(paths), p.MaxFiles)
+	}
+	for _, filePath := range paths {
+		if pattern, ok := p.deniedPath(filePath); ok {
+			return fmt.Sprintf("%s matches denied path %q", filePath, pattern)
+		}
+	}
+	return ""
+}
+
+// deniedPath returns the denied pattern matching filePath or one of its
+// parent directories.
+func (p CommitPolicy) deniedPath(filePath string) (string, bool) {
+	filePath = strings.Trim(path.Clean(filePath), "/")
+	for _, pattern := range p.DeniedPaths {
+		for candidate := filePath; candidate != "." && candidate != ""; candidate = path.Dir(candidate) {
+			if matched, _ := path.Match(pattern, candidate); matched {
+				return pattern, true
+			}
+		}
+	}
+	return "", false
+}
+
+// checkCommitPolicy returns a *CommitPolicyError when a commit with message
+// changing paths breaks the commit policy of the chart. Commits made through
+// the API are checked before their branch is moved, pushed ones by
+// pushGuard.
+func checkCommitPolicy(chartID, message string, paths []string) error {
+	policy, err := ReadCommitPolicy(chartID)
+	if err != nil {
+		return err
+	}
+	if violation := policy.Violation(strings.TrimRight(message, "\n"), paths); violation != "" {
+		return &CommitPolicyError{Reason: violation}
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package chart
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	gitsrv "github.com/go-git/go-git/v5/plumbing/transport/server"
+)
+
+var (
+	ErrPushRefNotAllowed = errors.New("only branches and tags can be pushed")
+	ErrPushNotCommit     = errors.New("pushed ref must point to a commit")
+	ErrPushForce         = errors.New("force pushes to the main branch are not allowed")
+	ErrPushDeleteMain    = errors.New("the main branch cannot be deleted")
+	ErrPushTagExists     = errors.New("existing tags cannot be moved")
+)
+
+// NewPushLoader returns a git server loader for pushes to a chart. Every ref
+// update of the pushed commands goes through a storer enforcing the push
+// rules; rejections are reported to the client per ref.
+func NewPushLoader(chartID string) gitsrv.Loader {
+	return pushLoader{chartID: chartID, base: gitsrv.NewFilesystemLoader(osfs.New(filepath.Join(ChartWorkdir(), chartID)))}
+}
+
+type pushLoader struct {
+	chartID string
+	base    gitsrv.Loader
+}
+
+func (l pushLoader) Load(ep *transport.Endpoint) (storer.Storer, error) {
+	st, err := l.base.Load(ep)
+	if err != nil {
+		return nil, err
+	}
+	return &pushGuard{Storer: st, chartID: l.chartID}, nil
+}
+
+// pushGuard only lets branches and tags be updated, rejects non fast-forward
+// updates, deletion of the main branch, commits with unsafe trees and new
+// commits breaking the commit policy, and keeps tags immutable.
+type pushGuard struct {
+	storer.Storer
+	chartID string
+}
+
+func (g *pushGuard) SetReference(ref *plumbing.Reference) error {
+	if err := g.checkUpdate(ref); err != nil {
+		return err
+	}
+	return g.Storer.SetReference(ref)
+}
+
+func (g *pushGuard) RemoveReference(name plumbing.ReferenceName) error {
+	if !name.IsBranch() && !name.IsTag() {
+		return ErrPushRefNotAllowed
+	}
+	if name == g.mainBranch() {
+		return ErrPushDeleteMain
+	}
+	return g.Storer.RemoveReference(name)
+}
+
+func (g *pushGuard) checkUpdate(ref *plumbing.Reference) error {
+	name := ref.Name()
+	if ref.Type() != plumbing.HashReference || (!name.IsBranch() && !name.IsTag()) {
+		return ErrPushRefNotAllowed
+	}
+
+	existing, err := g.Storer.Reference(name)
+	if err != nil && !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return err
+	}
+	if name.IsTag() {
+		if existing != nil {
+			return ErrPushTagExists
+		}
+		// Annotated tags point to a tag object wrapping the commit.
+		if tag, err := object.GetTag(g.Storer, ref.Hash()); err == nil {
+			commit, err := tag.Commit()
+			if err != nil {
+				return ErrPushNotCommit
+			}
+			if err := validateCommitTree(commit); err != nil {
+				return err
+			}
+			return g.checkPolicy(commit)
+		}
+	}
+
+	commit, err := object.GetCommit(g.Storer, ref.Hash())
+	if err != nil {
+		return ErrPushNotCommit
+	}
+	if err := validateCommitTree(commit); err != nil {
+		return err
+	}
+	if err := g.checkPolicy(commit); err != nil {
+		return err
+	}
+
+	if existing == nil || name != g.mainBranch() {
+		return nil
+	}
+
+	previous, err := object.GetCommit(g.Storer, existing.Hash())
+	if err != nil {
+		return err
+	}
+	fastForward, err := previous.IsAncestor(commit)
+	if err != nil {
+		return err
+	}
+	if !fastForward {
+		return ErrPushForce
+	}
+
+	return nil
+}
+
+// checkPolicy checks the commits a ref update brings into the chart, those no
+// branch or tag reaches yet, against the commit policy.
+func (g *pushGuard) checkPolicy(commit *object.Commit) error {
+	known, err := g.reachableCommits()
+	if err != nil {
+		return err
+	}
+
+	return object.NewCommitPreorderIter(commit, known, nil).ForEach(func(pushed *object.Commit) error {
+		paths, err := changedPaths(pushed)
+		if err != nil {
+			return err
+		}
+		if err := checkCommitPolicy(g.chartID, pushed.Message, paths); err != nil {
+			return fmt.Errorf("%s: %w", pushed.Hash.String()[:7], err)
+		}
+		return nil
+	})
+}
+
+// reachableCommits collects the commits the branches and tags of the chart
+// reach before the update.
+func (g *pushGuard) reachableCommits() (map[plumbing.Hash]bool, error) {
+	refs, err := g.Storer.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+	defer refs.Close()
+
+	known := map[plumbing.Hash]bool{}
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference || (!ref.Name().IsBranch() && !ref.Name().IsTag()) {
+			return nil
+		}
+		hash := ref.Hash()
+		if tag, err := object.GetTag(g.Storer, hash); err == nil {
+			hash = tag.Target
+		}
+		if known[hash] {
+			return nil
+		}
+		commit, err := object.GetCommit(g.Storer, hash)
+		if err != nil {
+			return nil
+		}
+		return object.NewCommitPreorderIter(commit, known, nil).ForEach(func(c *object.Commit) error {
+			known[c.Hash] = true
+			return nil
+		})
+	})
+	return known, err
+}
+
+// mainBranch is the branch HEAD points to, which chart commits and deploys
+// default to.
+func (g *pushGuard) mainBranch() plumbing.ReferenceName {
+	head, err := g.Storer.Reference(plumbing.HEAD)
+	if err == nil && head.Type() == plumbing.SymbolicReference {
+		return head.Target()
+	}
+	return plumbing.NewBranchReferenceName(DefaultBranch())
+}
+
+func validateCommitTree(commit *object.Commit) error {
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+	return validateTree(tree)
+}
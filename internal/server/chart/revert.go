@@ -0,0 +1,112 @@
+package chart
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+var ErrNothingToRevert = errors.New("chart already matches the revert target")
+
+// RevertChart commits the tree of ref on top of the current branch, restoring
+// every file to its state at ref while keeping the history in between. An
+// empty message defaults to naming the restored commit.
+func RevertChart(chartID, ref, message string) (string, string, error) {
+	repo, err := openChartRepo(chartID)
+	if err != nil {
+		return "", "", err
+	}
+
+	target, err := resolveChartCommit(repo, ref)
+	if err != nil {
+		return "", "", err
+	}
+
+	branchName, parentHash, err := chartBranch(repo)
+	if err != nil {
+		return "", "", err
+	}
+	if !parentHash.IsZero() {
+		parent, err := repo.CommitObject(parentHash)
+		if err != nil {
+			return "", "", err
+		}
+		if parent.TreeHash == target.TreeHash {
+			return "", "", ErrNothingToRevert
+		}
+	}
+
+	if message == "" {
+		message = fmt.Sprintf("Revert to %s", target.Hash.String()[:7])
+	}
+
+	commitHash, err := commitTree(repo, chartID, branchName, parentHash, target.TreeHash, message)
+	if err != nil {
+		return "", "", err
+	}
+
+	return target.Hash.String(), commitHash, nil
+}
+
+// RevertChartFile commits the version of one file at ref on top of the
+// current branch, leaving every other file as it is. An empty message
+// defaults to naming the file and the restored commit.
+func RevertChartFile(chartID, filePath, ref, message string) (string, string, error) {
+	cleanPath, err := cleanChartPath(filePath)
+	if err != nil {
+		return "", "", err
+	}
+
+	repo, err := openChartRepo(chartID)
+	if err != nil {
+		return "", "", err
+	}
+
+	target, err := resolveChartCommit(repo, ref)
+	if err != nil {
+		return "", "", err
+	}
+	targetTree, err := target.Tree()
+	if err != nil {
+		return "", "", err
+	}
+	file, err := targetTree.File(cleanPath)
+	if err != nil {
+		return "", "", err
+	}
+
+	branchName, parentHash, err := chartBranch(repo)
+	if err != nil {
+		return "", "", err
+	}
+	baseTree := &object.Tree{}
+	if !parentHash.IsZero() {
+		parent, err := repo.CommitObject(parentHash)
+		if err != nil {
+			return "", "", err
+		}
+		if baseTree, err = parent.Tree(); err != nil {
+			return "", "", err
+		}
+		if current, err := baseTree.File(cleanPath); err == nil && current.Hash == file.Hash && current.Mode == file.Mode {
+			return "", "", ErrNothingToRevert
+		}
+	}
+
+	if message == "" {
+		message = fmt.Sprintf("Revert %s to %s", cleanPath, target.Hash.String()[:7])
+	}
+
+	treeHash, err := writeTree(repo, baseTree, strings.Split(cleanPath, "/"), file.Hash, file.Mode)
+	if err != nil {
+		return "", "", err
+	}
+	commitHash, err := commitTree(repo, chartID, branchName, parentHash, treeHash, message)
+	if err != nil {
+		return "", "", err
+	}
+
+	return target.Hash.String(), commitHash, nil
+}
@@ -0,0 +1,300 @@
+package chart
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage"
+)
+
+var ErrNothingToSquash = errors.New("no chart history to squash before the cutoff")
+var ErrHistoryChanged = errors.New("chart refs changed concurrently")
+
+type SquashResult struct {
+	Baseline string // Commit replacing the squashed history
+	Squashed int    // Commits removed from the history
+	// Rewritten maps the commits that stay, with new hashes, from their old
+	// hash.
+	Rewritten map[string]string
+	Refs      []string // Branches and tags moved to rewritten commits
+}
+
+// SquashChartHistory replaces the history of the chart branch before the
+// cutoff with a single baseline commit holding the tree of the newest commit
+// before it. Commits that branches, tags or keep point to are kept on top of
+// the baseline instead of squashed; every later commit is rewritten onto it
+// with its content, author and message intact, and refs are moved to the
+// rewritten commits. Unreachable objects are pruned afterwards. The baseline
+// gets message, or a summary of the squash when empty, which only has to
+// follow the message rules of the commit policy. With dryRun nothing is
+// written and Baseline is the commit that would be squashed into.
+func SquashChartHistory(chartID string, before time.Time, keep []string, message string, dryRun bool) (SquashResult, error) {
+	repo, err := openChartRepo(chartID)
+	if err != nil {
+		return SquashResult{}, err
+	}
+
+	_, head, err := chartBranch(repo)
+	if err != nil {
+		return SquashResult{}, err
+	}
+	if head.IsZero() {
+		return SquashResult{}, ErrNothingToSquash
+	}
+
+	// The baseline is the newest commit of the branch before the cutoff.
+	base, err := repo.CommitObject(head)
+	if err != nil {
+		return SquashResult{}, err
+	}
+	for !base.Committer.When.Before(before) {
+		if base.NumParents() == 0 {
+			return SquashResult{}, ErrNothingToSquash
+		}
+		if base, err = base.Parent(0); err != nil {
+			return SquashResult{}, err
+		}
+	}
+
+	squashed := map[plumbing.Hash]*object.Commit{}
+	iter := object.NewCommitPreorderIter(base, nil, nil)
+	err = iter.ForEach(func(commit *object.Commit) error {
+		squashed[commit.Hash] = commit
+		return nil
+	})
+	if err != nil {
+		return SquashResult{}, err
+	}
+
+	refs, err := chartRefs(repo)
+	if err != nil {
+		return SquashResult{}, err
+	}
+
+	// Commits pointed to by refs or kept by the caller survive the squash as
+	// a chain leading up to the baseline, oldest first.
+	protected := map[plumbing.Hash]bool{}
+	for _, ref := range refs {
+		if _, ok := squashed[ref.commit]; ok {
+			protected[ref.commit] = true
+		}
+	}
+	for _, hash := range keep {
+		if _, ok := squashed[plumbing.NewHash(hash)]; ok {
+			protected[plumbing.NewHash(hash)] = true
+		}
+	}
+	delete(protected, base.Hash)
+	chain := make([]*object.Commit, 0, len(protected)+1)
+	for hash := range protected {
+		chain = append(chain, squashed[hash])
+	}
+	sort.Slice(chain, func(i, j int) bool { return chain[i].Committer.When.Before(chain[j].Committer.When) })
+	chain = append(chain, base)
+
+	result := SquashResult{
+		Baseline:  base.Hash.String(),
+		Squashed:  len(squashed) - len(chain),
+		Rewritten: map[string]string{},
+		Refs:      []string{},
+	}
+	if result.Squashed == 0 {
+		return SquashResult{}, ErrNothingToSquash
+	}
+	if message == "" {
+		message = fmt.Sprintf("Squash chart history before %s\n\n%d commits up to %s were squashed.\n",
+			before.UTC().Format(time.RFC3339), result.Squashed, base.Hash)
+	}
+	// The baseline changes no content, so paths rules don't apply to it.
+	if err := checkCommitPolicy(chartID, message, nil); err != nil {
+		return SquashResult{}, err
+	}
+	if dryRun {
+		return result, nil
+	}
+
+	rewritten := map[plumbing.Hash]plumbing.Hash{}
+	var parent []plumbing.Hash
+	for _, commit := range chain {
+		copied := *commit
+		if commit.Hash == base.Hash {
+			copied.Message = message
+		}
+		hash, err := writeCommit(repo, copied, parent)
+		if err != nil {
+			return SquashResult{}, err
+		}
+		rewritten[commit.Hash] = hash
+		parent = []plumbing.Hash{hash}
+	}
+	baseline := parent[0]
+	result.Baseline = baseline.String()
+
+	// Squashed commits that aren't kept, such as old merge parents, map to
+	// the baseline.
+	var rewrite func(hash plumbing.Hash) (plumbing.Hash, error)
+	rewrite = func(hash plumbing.Hash) (plumbing.Hash, error) {
+		if next, ok := rewritten[hash]; ok {
+			return next, nil
+		}
+		if _, ok := squashed[hash]; ok {
+			return baseline, nil
+		}
+
+		commit, err := repo.CommitObject(hash)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		parents := []plumbing.Hash{}
+		for _, parentHash := range commit.ParentHashes {
+			next, err := rewrite(parentHash)
+			if err != nil {
+				return plumbing.ZeroHash, err
+			}
+			if !slices.Contains(parents, next) {
+				parents = append(parents, next)
+			}
+		}
+		next, err := writeCommit(repo, *commit, parents)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		rewritten[hash] = next
+		return next, nil
+	}
+
+	updates := make([]*plumbing.Reference, 0, len(refs))
+	for _, ref := range refs {
+		next, err := rewrite(ref.commit)
+		if err != nil {
+			return SquashResult{}, err
+		}
+		target := next
+		if ref.tag != nil {
+			tag := *ref.tag
+			tag.Target = next
+			if target, err = writeTag(repo, tag); err != nil {
+				return SquashResult{}, err
+			}
+		}
+		updates = append(updates, plumbing.NewHashReference(ref.ref.Name(), target))
+	}
+
+	for i, update := range updates {
+		if err := repo.Storer.CheckAndSetReference(update, refs[i].ref); err != nil {
+			if errors.Is(err, storage.ErrReferenceHasChanged) {
+				return SquashResult{}, ErrHistoryChanged
+			}
+			return SquashResult{}, err
+		}
+		result.Refs = append(result.Refs, update.Name().String())
+	}
+	for from, to := range rewritten {
+		result.Rewritten[from.String()] = to.String()
+	}
+
+	if err := pruneChartRepo(repo); err != nil {
+		return SquashResult{}, err
+	}
+	return result, nil
+}
+
+// chartRef is a branch or tag with the commit it points to. Annotated tags
+// carry their tag object.
+type chartRef struct {
+	ref    *plumbing.Reference
+	commit plumbing.Hash
+	tag    *object.Tag
+}
+
+// chartRefs lists the branches and tags of a repo that point to commits.
+func chartRefs(repo *git.Repository) ([]chartRef, error) {
+	iter, err := repo.References()
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	refs := []chartRef{}
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference || !(ref.Name().IsBranch() || ref.Name().IsTag()) {
+			return nil
+		}
+
+		entry := chartRef{ref: ref, commit: ref.Hash()}
+		tag, err := repo.TagObject(ref.Hash())
+		switch {
+		case err == nil:
+			if tag.TargetType != plumbing.CommitObject {
+				return nil
+			}
+			entry.tag, entry.commit = tag, tag.Target
+		case !errors.Is(err, plumbing.ErrObjectNotFound):
+			return err
+		}
+		refs = append(refs, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].ref.Name() < refs[j].ref.Name() })
+	return refs, nil
+}
+
+// writeCommit stores a copy of commit with new parents.
+func writeCommit(repo *git.Repository, commit object.Commit, parents []plumbing.Hash) (plumbing.Hash, error) {
+	copied := &object.Commit{
+		Author:       commit.Author,
+		Committer:    commit.Committer,
+		Message:      commit.Message,
+		TreeHash:     commit.TreeHash,
+		ParentHashes: parents,
+	}
+	obj := repo.Storer.NewEncodedObject()
+	if err := copied.Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return repo.Storer.SetEncodedObject(obj)
+}
+
+// writeTag stores a copy of an annotated tag.
+func writeTag(repo *git.Repository, tag object.Tag) (plumbing.Hash, error) {
+	copied := &object.Tag{
+		Name:       tag.Name,
+		Tagger:     tag.Tagger,
+		Message:    tag.Message,
+		TargetType: tag.TargetType,
+		Target:     tag.Target,
+	}
+	obj := repo.Storer.NewEncodedObject()
+	if err := copied.Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return repo.Storer.SetEncodedObject(obj)
+}
+
+// pruneChartRepo deletes the objects no ref reaches anymore. Packed objects
+// are repacked, as packs can't shrink in place.
+func pruneChartRepo(repo *git.Repository) error {
+	if err := repo.Prune(git.PruneOptions{Handler: repo.DeleteObject}); err != nil {
+		return err
+	}
+
+	packed, ok := repo.Storer.(storer.PackedObjectStorer)
+	if !ok {
+		return nil
+	}
+	packs, err := packed.ObjectPacks()
+	if err != nil || len(packs) == 0 {
+		return err
+	}
+	return repo.RepackObjects(&git.RepackConfig{})
+}
@@ -0,0 +1,225 @@
+package chart
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stateDir holds the OpenTofu state of the root module and the stacks of a
+// chart next to its metadata, so it moves with the chart into the trash.
+const stateDir = "state"
+
+// rootStateName names the state of the root module. Stack names start with
+// a letter or digit, so no stack is named like it.
+const rootStateName = "_root"
+
+const stateSuffix = ".tfstate"
+
+// stateEnvironmentsDir holds a directory per environment of the chart with
+// the states of its root module and stacks, laid out like those of the chart
+// without an environment.
+const stateEnvironmentsDir = "environments"
+
+// stateVersionsDir keeps the states written for a stack, one directory per
+// stack named like its state, so an apply that went wrong can be rolled back.
+const stateVersionsDir = "versions"
+
+// StateVersionRetention is the number of state versions kept per stack.
+const StateVersionRetention = 50
+
+var ErrStateNotFound = errors.New("chart state not found")
+
+// ChartStateVersion is a state written for a stack of a chart.
+type ChartStateVersion struct {
+	Version   int       `json:"version" example:"3"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ReadChartState returns the OpenTofu state of a stack of a chart, the root
+// module when stack is empty, in an environment of the chart, or without one
+// when environment is empty.
+func ReadChartState(chartID, environment, stack string) ([]byte, error) {
+	target, err := chartStatePath(chartID, environment, stack)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(target)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrStateNotFound
+	}
+	return data, err
+}
+
+// WriteChartState replaces the OpenTofu state of a stack of a chart and
+// keeps it as a new version, dropping the oldest past the retention. Only
+// the server user may read it, as state holds the secrets of resources.
+// Callers serialize writes to a stack.
+func WriteChartState(chartID, environment, stack string, data []byte) error {
+	target, err := chartStatePath(chartID, environment, stack)
+	if err != nil {
+		return err
+	}
+	versionsDir := chartStateVersionsDir(target)
+	if err := os.MkdirAll(versionsDir, 0o700); err != nil {
+		return err
+	}
+	versions, err := readChartStateVersions(versionsDir)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), filepath.Base(target)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	// The version shares the file of the current state until the next write.
+	next := 1
+	if len(versions) > 0 {
+		next = versions[len(versions)-1].Version + 1
+	}
+	if err := os.Link(tmp.Name(), chartStateVersionPath(versionsDir, next)); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return err
+	}
+
+	for _, version := range versions[:max(0, len(versions)+1-StateVersionRetention)] {
+		if err := os.Remove(chartStateVersionPath(versionsDir, version.Version)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListChartStateVersions returns the kept state versions of a stack of a
+// chart, oldest first.
+func ListChartStateVersions(chartID, environment, stack string) ([]ChartStateVersion, error) {
+	target, err := chartStatePath(chartID, environment, stack)
+	if err != nil {
+		return nil, err
+	}
+	return readChartStateVersions(chartStateVersionsDir(target))
+}
+
+// ReadChartStateVersion returns a kept state version of a stack of a chart.
+func ReadChartStateVersion(chartID, environment, stack string, version int) ([]byte, error) {
+	target, err := chartStatePath(chartID, environment, stack)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(chartStateVersionPath(chartStateVersionsDir(target), version))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrStateNotFound
+	}
+	return data, err
+}
+
+// DeleteChartState removes the OpenTofu state of a stack of a chart, if any.
+// Its versions are kept.
+func DeleteChartState(chartID, environment, stack string) error {
+	target, err := chartStatePath(chartID, environment, stack)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// IsChartState reports whether rel, a path inside a chart repository, holds
+// OpenTofu state.
+func IsChartState(rel string) bool {
+	rel = filepath.Clean(rel)
+	return strings.HasPrefix(rel, filepath.Join(metaDir, stateDir)+string(filepath.Separator)) && strings.HasSuffix(rel, stateSuffix)
+}
+
+func chartStateVersionsDir(target string) string {
+	return filepath.Join(filepath.Dir(target), stateVersionsDir, strings.TrimSuffix(filepath.Base(target), stateSuffix))
+}
+
+func chartStateVersionPath(dir string, version int) string {
+	return filepath.Join(dir, strconv.Itoa(version)+stateSuffix)
+}
+
+func readChartStateVersions(dir string) ([]ChartStateVersion, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []ChartStateVersion{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []ChartStateVersion{}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), stateSuffix)
+		version, err := strconv.Atoi(name)
+		if !ok || err != nil || version < 1 || !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, ChartStateVersion{Version: version, Size: info.Size(), CreatedAt: info.ModTime().UTC()})
+	}
+	slices.SortFunc(versions, func(a, b ChartStateVersion) int { return a.Version - b.Version })
+	return versions, nil
+}
+
+func chartStatePath(chartID, environment, stack string) (string, error) {
+	if _, err := openChartRepo(chartID); err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(ChartWorkdir(), chartID, metaDir, stateDir)
+	if environment != "" {
+		if !isStateName(environment) {
+			return "", ErrInvalidPath
+		}
+		dir = filepath.Join(dir, stateEnvironmentsDir, environment)
+	}
+	name := rootStateName
+	if stack != "" {
+		if !isStateName(stack) {
+			return "", ErrInvalidPath
+		}
+		name = stack
+	}
+	return filepath.Join(dir, name+stateSuffix), nil
+}
+
+func isStateName(name string) bool {
+	return name == filepath.Base(name) && !strings.HasPrefix(name, ".") && !strings.HasPrefix(name, "_")
+}
+
+// ChartDeclaresBackend reports whether the module in dir, the chart root
+// when empty, configures a state backend or cloud block of its own at ref.
+func ChartDeclaresBackend(chartID, ref, dir string) (bool, error) {
+	_, err := ReadChartBackend(chartID, ref, dir)
+	if errors.Is(err, ErrNoBackend) {
+		return false, nil
+	}
+	return err == nil, err
+}
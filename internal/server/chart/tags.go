@@ -0,0 +1,112 @@
+package chart
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+var ErrInvalidTagName = errors.New("invalid chart tag name")
+
+type TagInfo struct {
+	Name        string
+	Hash        string // Commit the tag points to
+	Message     string // Empty for lightweight tags
+	TaggerName  string
+	TaggerEmail string
+	When        time.Time
+}
+
+// CreateChartTag creates an annotated tag named name on the commit ref
+// resolves to (HEAD by default).
+func CreateChartTag(chartID, name, ref, message string) (TagInfo, error) {
+	repo, err := openChartRepo(chartID)
+	if err != nil {
+		return TagInfo{}, err
+	}
+
+	if name == "" || strings.HasPrefix(name, "-") || plumbing.NewTagReferenceName(name).Validate() != nil {
+		return TagInfo{}, ErrInvalidTagName
+	}
+
+	commit, err := resolveChartCommit(repo, ref)
+	if err != nil {
+		return TagInfo{}, err
+	}
+
+	if strings.TrimSpace(message) == "" {
+		message = name
+	}
+
+	tagRef, err := repo.CreateTag(name, commit.Hash, &git.CreateTagOptions{
+		Tagger: &object.Signature{
+			Name:  "planemgr",
+			Email: "noreply@planemgr.local",
+			When:  time.Now(),
+		},
+		Message: message,
+	})
+	if err != nil {
+		return TagInfo{}, err
+	}
+
+	return tagInfo(repo, tagRef)
+}
+
+// ListChartTags returns the tags of a chart sorted by name.
+func ListChartTags(chartID string) ([]TagInfo, error) {
+	repo, err := openChartRepo(chartID)
+	if err != nil {
+		return nil, err
+	}
+
+	iter, err := repo.Tags()
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	tags := []TagInfo{}
+	if err := iter.ForEach(func(ref *plumbing.Reference) error {
+		info, err := tagInfo(repo, ref)
+		if err != nil {
+			return err
+		}
+		tags = append(tags, info)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags, nil
+}
+
+func tagInfo(repo *git.Repository, ref *plumbing.Reference) (TagInfo, error) {
+	info := TagInfo{Name: ref.Name().Short(), Hash: ref.Hash().String()}
+
+	tag, err := repo.TagObject(ref.Hash())
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		return info, nil
+	}
+	if err != nil {
+		return TagInfo{}, err
+	}
+
+	commit, err := tag.Commit()
+	if err != nil {
+		return TagInfo{}, err
+	}
+
+	info.Hash = commit.Hash.String()
+	info.Message = strings.TrimSpace(tag.Message)
+	info.TaggerName = tag.Tagger.Name
+	info.TaggerEmail = tag.Tagger.Email
+	info.When = tag.Tagger.When
+	return info, nil
+}
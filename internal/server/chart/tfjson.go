@@ -0,0 +1,110 @@
+package chart
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+var ErrInvalidTerraformJSON = errors.New("invalid Terraform JSON configuration")
+
+// terraformBlockLabels is the number of labels each top-level block type of
+// the Terraform JSON configuration syntax takes.
+var terraformBlockLabels = map[string]int{
+	"check":     1,
+	"data":      2,
+	"import":    0,
+	"locals":    0,
+	"module":    1,
+	"moved":     0,
+	"output":    1,
+	"provider":  1,
+	"removed":   0,
+	"resource":  2,
+	"terraform": 0,
+	"variable":  1,
+}
+
+// IsTerraformJSON reports whether a chart file holds Terraform JSON
+// configuration.
+func IsTerraformJSON(filePath string) bool {
+	return strings.HasSuffix(filePath, ".tf.json")
+}
+
+// ValidateTerraformJSON checks that contents are a JSON object made of
+// Terraform blocks, each nested in an object per label, such as
+// {"resource": {"type": {"name": {...}}}}. Block bodies themselves aren't
+// checked, as their schema depends on the providers.
+func ValidateTerraformJSON(contents []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	decoder.UseNumber()
+	var root any
+	if err := decoder.Decode(&root); err != nil {
+		return fmt.Errorf("%w: malformed JSON: %v", ErrInvalidTerraformJSON, err)
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: malformed JSON: unexpected data after the top-level object", ErrInvalidTerraformJSON)
+	}
+
+	body, ok := root.(map[string]any)
+	if !ok {
+		return fmt.Errorf("%w: the top-level value must be an object", ErrInvalidTerraformJSON)
+	}
+	for _, blockType := range sortedKeys(body) {
+		labels, ok := terraformBlockLabels[blockType]
+		if !ok {
+			return fmt.Errorf("%w: unknown block type %q", ErrInvalidTerraformJSON, blockType)
+		}
+		if err := validateTerraformBlock(blockType, body[blockType], labels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateTerraformBlock checks that value holds labels levels of objects
+// keyed by block label, ending in block bodies. Any level may be an array of
+// objects instead, to declare several blocks.
+func validateTerraformBlock(path string, value any, labels int) error {
+	if list, ok := value.([]any); ok {
+		for i, item := range list {
+			if err := validateTerraformBlock(fmt.Sprintf("%s[%d]", path, i), item, labels); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	object, ok := value.(map[string]any)
+	if !ok {
+		if labels > 0 {
+			return fmt.Errorf("%w: %s must be an object keyed by block label", ErrInvalidTerraformJSON, path)
+		}
+		return fmt.Errorf("%w: %s must be an object", ErrInvalidTerraformJSON, path)
+	}
+	if labels == 0 {
+		return nil
+	}
+	for _, label := range sortedKeys(object) {
+		if err := validateTerraformBlock(path+"."+label, object[label], labels-1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of object in order, skipping "//" comments.
+func sortedKeys(object map[string]any) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		if key != "//" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,146 @@
+package chart
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// trashDir holds deleted chart repositories inside the workdir until they are
+// restored or purged. Its name is never a chart ID, so it isn't listed as one.
+const trashDir = ".trash"
+
+const trashedMeta = "trashed"
+
+var ErrNotTrashed = fmt.Errorf("chart is not in the trash: %w", os.ErrNotExist)
+var ErrChartExists = errors.New("chart already exists")
+
+// TrashWorkdir is the directory deleted chart repositories wait in.
+func TrashWorkdir() string {
+	return filepath.Join(ChartWorkdir(), trashDir)
+}
+
+// TrashedChart is a deleted chart waiting in the trash.
+type TrashedChart struct {
+	ChartID   string    `json:"chartId"`
+	DeletedBy string    `json:"deletedBy"`
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+// TrashChartRepo moves a chart repository, with its metadata, to the trash.
+func TrashChartRepo(chartID, subject string) error {
+	if !IsChartID(chartID) {
+		return ErrInvalidChartID
+	}
+
+	repoPath := filepath.Join(ChartWorkdir(), chartID)
+	if _, err := git.PlainOpen(repoPath); err != nil {
+		return err
+	}
+	err := WriteChartMeta(chartID, trashedMeta, TrashedChart{
+		ChartID:   chartID,
+		DeletedBy: subject,
+		DeletedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	trashPath := filepath.Join(ChartWorkdir(), trashDir, chartID)
+	if err := os.MkdirAll(filepath.Dir(trashPath), 0o755); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(trashPath); err != nil {
+		return err
+	}
+	return os.Rename(repoPath, trashPath)
+}
+
+// RestoreChartRepo moves a chart repository out of the trash under its
+// original ID.
+func RestoreChartRepo(chartID string) error {
+	if !IsChartID(chartID) {
+		return ErrInvalidChartID
+	}
+
+	trashPath := filepath.Join(ChartWorkdir(), trashDir, chartID)
+	if _, err := os.Stat(trashPath); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrNotTrashed
+		}
+		return err
+	}
+	repoPath := filepath.Join(ChartWorkdir(), chartID)
+	if _, err := os.Stat(repoPath); err == nil {
+		return ErrChartExists
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if err := os.Rename(trashPath, repoPath); err != nil {
+		return err
+	}
+	return DeleteChartMeta(chartID, trashedMeta)
+}
+
+// ListTrashedCharts returns the charts in the trash, most recently deleted
+// first.
+func ListTrashedCharts() ([]TrashedChart, error) {
+	entries, err := os.ReadDir(filepath.Join(ChartWorkdir(), trashDir))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []TrashedChart{}, nil
+		}
+		return nil, err
+	}
+
+	charts := []TrashedChart{}
+	for _, entry := range entries {
+		if !entry.IsDir() || !IsChartID(entry.Name()) {
+			continue
+		}
+
+		trashed := TrashedChart{ChartID: entry.Name()}
+		data, err := os.ReadFile(filepath.Join(ChartWorkdir(), trashDir, entry.Name(), metaDir, trashedMeta+".json"))
+		if err == nil {
+			err = json.Unmarshal(data, &trashed)
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		charts = append(charts, trashed)
+	}
+
+	sort.Slice(charts, func(i, j int) bool { return charts[i].DeletedAt.After(charts[j].DeletedAt) })
+	return charts, nil
+}
+
+// PurgeTrashedCharts permanently removes the charts deleted before cutoff and
+// returns their IDs.
+func PurgeTrashedCharts(cutoff time.Time) ([]string, error) {
+	charts, err := ListTrashedCharts()
+	if err != nil {
+		return nil, err
+	}
+
+	purged := []string{}
+	for _, trashed := range charts {
+		if !trashed.DeletedAt.Before(cutoff) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(ChartWorkdir(), trashDir, trashed.ChartID)); err != nil {
+			return purged, err
+		}
+		if err := removeColdDeployLogs(trashed.ChartID); err != nil {
+			return purged, err
+		}
+		purged = append(purged, trashed.ChartID)
+	}
+	return purged, nil
+}
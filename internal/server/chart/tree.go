@@ -0,0 +1,97 @@
+package chart
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+var ErrPathIsSymlink = errors.New("chart path is a symlink")
+var ErrUnsafeTree = errors.New("chart tree has an unsafe entry")
+
+// maxSymlinkTarget bounds the symlink blobs read while validating a tree.
+const maxSymlinkTarget = 4096
+
+// ValidateChartTree checks the tree at ref (HEAD by default) before it is
+// checked out in a runner, see validateTree.
+func ValidateChartTree(chartID, ref string) error {
+	repo, err := openChartRepo(chartID)
+	if err != nil {
+		return err
+	}
+
+	commit, err := resolveChartCommit(repo, ref)
+	if err != nil {
+		return err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+	return validateTree(tree)
+}
+
+// validateTree rejects the entries of a pushed or deployed tree that could
+// reach outside the checkout: symlinks with absolute targets or targets
+// leaving the tree or entering .git, .git entries and submodules. Regular and
+// executable files, directories and symlinks within the tree are allowed.
+func validateTree(tree *object.Tree) error {
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+
+	for {
+		name, entry, err := walker.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if strings.EqualFold(path.Base(name), ".git") {
+			return fmt.Errorf("%w: %s", ErrUnsafeTree, name)
+		}
+		switch entry.Mode {
+		case filemode.Dir, filemode.Regular, filemode.Executable, filemode.Deprecated:
+		case filemode.Symlink:
+			if err := validateSymlink(tree, name, entry); err != nil {
+				return err
+			}
+		case filemode.Submodule:
+			return fmt.Errorf("%w: %s is a submodule", ErrUnsafeTree, name)
+		default:
+			return fmt.Errorf("%w: %s has mode %s", ErrUnsafeTree, name, entry.Mode)
+		}
+	}
+}
+
+func validateSymlink(tree *object.Tree, name string, entry object.TreeEntry) error {
+	link, err := tree.TreeEntryFile(&entry)
+	if err != nil {
+		return err
+	}
+	if link.Size > maxSymlinkTarget {
+		return fmt.Errorf("%w: %s has an overlong symlink target", ErrUnsafeTree, name)
+	}
+	target, err := link.Contents()
+	if err != nil {
+		return err
+	}
+
+	return checkSymlinkTarget(name, target)
+}
+
+// checkSymlinkTarget checks that a symlink at name resolves inside the tree.
+func checkSymlinkTarget(name, target string) error {
+	resolved := path.Clean(path.Join(path.Dir(name), target))
+	first, _, _ := strings.Cut(resolved, "/")
+	if path.IsAbs(target) || strings.Contains(target, "\\") || resolved == ".." || strings.HasPrefix(resolved, "../") || strings.EqualFold(first, ".git") {
+		return fmt.Errorf("%w: symlink %s points outside the chart", ErrUnsafeTree, name)
+	}
+	return nil
+}
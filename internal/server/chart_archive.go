@@ -0,0 +1,82 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+)
+
+var archiveContentTypes = map[string]string{
+	chart.ArchiveTarGz: "application/gzip",
+	chart.ArchiveZip:   "application/zip",
+}
+
+// Handle GET /api/chart/{id}/archive requests.
+// @Summary Download chart archive
+// @Description Streams the chart tree at a ref as a tar.gz or zip archive. Files are placed under a "<chart id>-<short hash>/" directory.
+// @Tags chart
+// @Security BearerAuth
+// @Produce application/gzip
+// @Produce application/zip
+// @Param id path string true "Chart ID"
+// @Param ref query string false "Git ref (defaults to HEAD)"
+// @Param format query string false "Archive format: tar.gz (default) or zip"
+// @Success 200 {file} file
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid archive format`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart not found`, `chart ref not found`"
+// @Failure 500 {object} errorResponse "`failed to archive chart`"
+// @Router /chart/{id}/archive [get]
+func HandleChartArchive(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.RequireAccessTokenClaims(r); err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = chart.ArchiveTarGz
+	}
+	contentType, ok := archiveContentTypes[format]
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid archive format"})
+		return
+	}
+
+	archive, err := chart.OpenChartArchive(r.PathValue("id"), r.URL.Query().Get("ref"))
+	if err != nil {
+		if errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart not found"})
+			return
+		}
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart ref not found"})
+			return
+		}
+
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to archive chart"})
+		return
+	}
+
+	filename := strings.TrimSuffix(archive.Prefix, "/") + "." + format
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("X-Chart-Ref", archive.Ref)
+	w.WriteHeader(http.StatusOK)
+
+	// Headers are sent, so a failure can only cut the stream short.
+	_ = archive.Write(w, format)
+}
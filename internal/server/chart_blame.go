@@ -0,0 +1,102 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+)
+
+type chartBlameLine struct {
+	Line        int    `json:"line"`
+	Text        string `json:"text"`
+	Hash        string `json:"hash"`
+	AuthorName  string `json:"authorName"`
+	AuthorEmail string `json:"authorEmail"`
+	Timestamp   string `json:"timestamp"`
+	Summary     string `json:"summary"`
+}
+
+type chartBlameResponse struct {
+	ChartID string           `json:"chartId"`
+	Ref     string           `json:"ref"`
+	Path    string           `json:"path"`
+	Lines   []chartBlameLine `json:"lines"`
+}
+
+// Handle GET /api/chart/{id}/blame requests.
+// @Summary Blame a chart file
+// @Description Returns every line of a file at a ref with the commit that last modified it, its author, timestamp and the first line of its message.
+// @Tags chart
+// @Security BearerAuth
+// @Param id path string true "Chart ID"
+// @Param file query string true "File path in the chart repo"
+// @Param ref query string false "Git ref (defaults to HEAD)"
+// @Success 200 {object} chartBlameResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`, `file required`, `invalid file path`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart not found`, `chart ref not found`, `chart file not found`"
+// @Failure 500 {object} errorResponse "`failed to blame chart file`"
+// @Router /chart/{id}/blame [get]
+func HandleChartBlame(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.RequireAccessTokenClaims(r); err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	filePath := r.URL.Query().Get("file")
+	if filePath == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "file required"})
+		return
+	}
+
+	chartID := r.PathValue("id")
+	resolvedRef, cleanPath, lines, err := chart.BlameChartFile(chartID, filePath, r.URL.Query().Get("ref"))
+	if err != nil {
+		switch {
+		case errors.Is(err, chart.ErrInvalidPath):
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid file path"})
+		case errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart not found"})
+		case errors.Is(err, plumbing.ErrReferenceNotFound):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart ref not found"})
+		case errors.Is(err, object.ErrFileNotFound):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart file not found"})
+		default:
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to blame chart file"})
+		}
+		return
+	}
+
+	response := chartBlameResponse{
+		ChartID: chartID,
+		Ref:     resolvedRef,
+		Path:    cleanPath,
+		Lines:   make([]chartBlameLine, 0, len(lines)),
+	}
+	for _, line := range lines {
+		response.Lines = append(response.Lines, chartBlameLine{
+			Line:        line.Number,
+			Text:        line.Text,
+			Hash:        line.Hash,
+			AuthorName:  line.AuthorName,
+			AuthorEmail: line.AuthorEmail,
+			Timestamp:   line.When.UTC().Format(time.RFC3339),
+			Summary:     line.Summary,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+)
+
+type chartBootstrapRequest struct {
+	Provider string `json:"provider" enums:"aws,gcp,azure,k8s" example:"aws"`
+	Region   string `json:"region,omitempty" example:"eu-west-1"`
+	Project  string `json:"project,omitempty" example:"my-project"`
+	Name     string `json:"name,omitempty" example:"team-artifacts"`
+}
+
+// Handle POST /api/chart/bootstrap requests.
+// @Summary Create chart for a provider
+// @Description Creates a new chart whose main.tf.json requires the selected provider, configures it and declares an example resource named name ("planemgr-" and the start of the chart ID by default): an S3 bucket on aws, a storage bucket on gcp, a resource group on azure and a namespace on k8s. region defaults to us-east-1, us-central1 and westeurope; project is the GCP project, required on gcp, or the Azure subscription. Credentials are left to the runner environment, and state stays local until the chart configures a backend.
+// @Tags chart
+// @Security BearerAuth
+// @Accept json
+// @Param request body chartBootstrapRequest true "Provider selection"
+// @Success 201 {object} chartResponse
+// @Failure 400 {object} errorResponse "`invalid request body`, the invalid parameter"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 500 {object} errorResponse "`failed to create chart`, `failed to initialize chart`"
+// @Router /chart/bootstrap [post]
+func HandleChartBootstrap(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.RequireAccessTokenClaims(r); err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	var req chartBootstrapRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	bootstrap := chart.Bootstrap(req)
+	if err := bootstrap.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	chartID, err := chart.CreateChartRepo()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create chart"})
+		return
+	}
+	if bootstrap.Name == "" {
+		bootstrap.Name = "planemgr-" + chartID[:8]
+	}
+
+	files, err := chart.BootstrapFiles(bootstrap)
+	if err == nil {
+		_, err = chart.WriteChartFiles(chartID, files, "Initialization for "+bootstrap.Provider, "")
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to initialize chart"})
+		return
+	}
+	publishChartChange(chartID)
+
+	writeJSON(w, http.StatusCreated, chartResponse{
+		ChartID: chartID,
+	})
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"slices"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+	"github.com/mtolmacs/planemgr/internal/server/deploy"
+)
+
+const chartBudgetMeta = "budget"
+
+type chartBudget struct {
+	MaxResources   int                `json:"maxResources,omitempty"`
+	MaxMonthlyCost float64            `json:"maxMonthlyCost,omitempty"`
+	UnitCosts      map[string]float64 `json:"unitCosts,omitempty"`
+	Enforcement    string             `json:"enforcement,omitempty"`
+}
+
+// HandleChartBudget handles /api/chart/{id}/budget requests.
+func HandleChartBudget(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		HandleChartBudgetGet(w, r)
+	case http.MethodPut:
+		HandleChartBudgetPut(w, r, claims.Subject)
+	case http.MethodDelete:
+		HandleChartBudgetDelete(w, r, claims.Subject)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+	}
+}
+
+// HandleChartBudgetGet handles GET /api/chart/{id}/budget requests.
+// @Summary Get chart budget
+// @Description Returns the resource count and estimated cost budget that plans of the chart are checked against.
+// @Tags chart
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Success 200 {object} chartBudget
+// @Failure 400 {object} errorResponse "`invalid chart id`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/budget [get]
+func HandleChartBudgetGet(w http.ResponseWriter, r *http.Request) {
+	budget, err := loadChartBudget(r.PathValue("id"))
+	if err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, chartBudget(budget))
+}
+
+// HandleChartBudgetPut handles PUT /api/chart/{id}/budget requests.
+// @Summary Set chart budget
+// @Description Replaces the chart budget. Deploys whose plan exceeds it are blocked, or only flagged when enforcement is "warn". Chart admins can force blocked deploys by listing "budget" in overridePolicies, which the deploy history records. Only chart admins can change the budget, so a chart without admins has to get them first.
+// @Tags chart
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Param request body chartBudget true "Budget"
+// @Success 200 {object} chartBudget
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid_request`, `invalid_budget`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/budget [put]
+func HandleChartBudgetPut(w http.ResponseWriter, r *http.Request, subject string) {
+	var req chartBudget
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "invalid JSON payload"})
+		return
+	}
+
+	budget := deploy.Budget(req)
+	if err := budget.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_budget", Message: err.Error()})
+		return
+	}
+	if !requireChartBudgetAdmin(w, r.PathValue("id"), subject, "only chart admins can change the budget") {
+		return
+	}
+
+	if err := chart.WriteChartMeta(r.PathValue("id"), chartBudgetMeta, budget); err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, req)
+}
+
+// HandleChartBudgetDelete handles DELETE /api/chart/{id}/budget requests.
+// @Summary Remove chart budget
+// @Description Removes the chart budget. Only chart admins can remove it.
+// @Tags chart
+// @Security BearerAuth
+// @Param id path string true "Chart ID"
+// @Success 200 {object} emptyResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/budget [delete]
+func HandleChartBudgetDelete(w http.ResponseWriter, r *http.Request, subject string) {
+	if !requireChartBudgetAdmin(w, r.PathValue("id"), subject, "only chart admins can remove the budget") {
+		return
+	}
+	if err := chart.DeleteChartMeta(r.PathValue("id"), chartBudgetMeta); err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, emptyResponse{})
+}
+
+// requireChartBudgetAdmin reports whether subject is an admin of the chart,
+// the only users who can change its budget or override it. It writes the
+// error with message otherwise.
+func requireChartBudgetAdmin(w http.ResponseWriter, chartID, subject, message string) bool {
+	permissions, err := loadChartPermissions(chartID)
+	if err != nil {
+		writeChartMetaError(w, err)
+		return false
+	}
+	if !slices.Contains(permissions.Admins, subject) {
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: "forbidden", Message: message})
+		return false
+	}
+	return true
+}
+
+func loadChartBudget(chartID string) (deploy.Budget, error) {
+	var budget deploy.Budget
+	if err := chart.ReadChartMeta(chartID, chartBudgetMeta, &budget); err != nil && !errors.Is(err, chart.ErrMetaNotFound) {
+		return deploy.Budget{}, err
+	}
+	return budget, nil
+}
+
+func writeChartMetaError(w http.ResponseWriter, err error) {
+	if errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist) {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "chart_not_found"})
+		return
+	}
+
+	writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "chart_settings_failed", Message: err.Error()})
+}
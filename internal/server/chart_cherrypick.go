@@ -0,0 +1,107 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+)
+
+type chartCherryPickRequest struct {
+	Ref     string `json:"ref" example:"9fceb02d0ae598e95dc970b74767f19372d61af8"`
+	Message string `json:"message,omitempty" example:"Backport VPC fix"`
+}
+
+type chartCherryPickResponse struct {
+	ChartID string   `json:"chartId"`
+	Ref     string   `json:"ref"`
+	Source  string   `json:"source"`
+	Paths   []string `json:"paths"`
+}
+
+// Handle POST /api/chart/{id}/cherry-pick requests.
+// @Summary Cherry-pick a commit
+// @Description Applies the changes of a single commit from any ref, relative to its first parent, onto the chart branch as a new commit. Text files the branch changed too are merged line by line. When changes can't be merged nothing is committed and the conflicting paths are returned, with the conflicting hunks for text files.
+// @Tags chart
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Param request body chartCherryPickRequest true "Commit ref and optional commit message"
+// @Success 200 {object} chartCherryPickResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid request body`, `ref required`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart not found`, `chart ref not found`, `chart_not_found`"
+// @Failure 409 {object} chartMergeConflictResponse "`chart already contains the changes`, `merge conflicts`"
+// @Failure 422 {object} errorResponse "`commit rejected by policy`"
+// @Failure 423 {object} errorResponse "`chart_locked`"
+// @Failure 500 {object} errorResponse "`failed to cherry-pick commit`, `chart_settings_failed`"
+// @Router /chart/{id}/cherry-pick [post]
+func HandleChartCherryPick(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	var req chartCherryPickRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	if strings.TrimSpace(req.Ref) == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "ref required"})
+		return
+	}
+
+	chartID := r.PathValue("id")
+	if !requireChartUnlocked(w, chartID, claims.Subject) {
+		return
+	}
+	result, conflicts, err := chart.CherryPickChart(chartID, strings.TrimSpace(req.Ref), strings.TrimSpace(req.Message))
+	if err != nil {
+		if writeCommitPolicyError(w, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, chart.ErrMergeConflict):
+			writeJSON(w, http.StatusConflict, newChartMergeConflictResponse(conflicts))
+		case errors.Is(err, chart.ErrNothingToCherryPick):
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "chart already contains the changes"})
+		case errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart not found"})
+		case errors.Is(err, plumbing.ErrReferenceNotFound):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart ref not found"})
+		default:
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to cherry-pick commit"})
+		}
+		return
+	}
+
+	message := strings.TrimSpace(req.Message)
+	if message == "" {
+		message = "Cherry-pick " + result.Source
+	}
+	notifyChartCommit(chartID, result.Commit, message, result.Paths)
+
+	writeJSON(w, http.StatusOK, chartCherryPickResponse{
+		ChartID: chartID,
+		Ref:     result.Commit,
+		Source:  result.Source,
+		Paths:   result.Paths,
+	})
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+)
+
+type chartCommitFile struct {
+	Path      string `json:"path"`
+	OldPath   string `json:"oldPath,omitempty"`
+	Action    string `json:"action" example:"modified"`
+	Binary    bool   `json:"binary,omitempty"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+}
+
+type chartCommitStats struct {
+	Files     int `json:"files"`
+	Additions int `json:"additions"`
+	Deletions int `json:"deletions"`
+}
+
+type chartCommitSummaryResponse struct {
+	ChartID     string            `json:"chartId"`
+	Hash        string            `json:"hash"`
+	Parents     []string          `json:"parents"` // Files are compared to the first
+	Message     string            `json:"message"`
+	AuthorName  string            `json:"authorName"`
+	AuthorEmail string            `json:"authorEmail"`
+	Timestamp   string            `json:"timestamp" example:"2026-01-02T15:04:05Z"`
+	Stats       chartCommitStats  `json:"stats"`
+	Files       []chartCommitFile `json:"files"`
+}
+
+// Handle GET /api/chart/{id}/commit/{hash} requests.
+// @Summary Summarize a chart commit
+// @Description Returns the metadata of a commit with the files it added, modified or deleted and the lines changed, compared to its first parent. Root commits list every file as added.
+// @Tags chart
+// @Security BearerAuth
+// @Param id path string true "Chart ID"
+// @Param hash path string true "Commit hash or git ref"
+// @Success 200 {object} chartCommitSummaryResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart not found`, `chart ref not found`"
+// @Failure 500 {object} errorResponse "`failed to read chart commit`"
+// @Router /chart/{id}/commit/{hash} [get]
+func HandleChartCommit(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.RequireAccessTokenClaims(r); err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	chartID := r.PathValue("id")
+	commit, err := chart.ReadChartCommit(chartID, r.PathValue("hash"))
+	if err != nil {
+		if errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart not found"})
+			return
+		}
+		if errors.Is(err, plumbing.ErrReferenceNotFound) || errors.Is(err, plumbing.ErrObjectNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart ref not found"})
+			return
+		}
+
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read chart commit"})
+		return
+	}
+
+	response := chartCommitSummaryResponse{
+		ChartID:     chartID,
+		Hash:        commit.Hash,
+		Parents:     commit.Parents,
+		Message:     commit.Message,
+		AuthorName:  commit.AuthorName,
+		AuthorEmail: commit.AuthorEmail,
+		Timestamp:   commit.When.UTC().Format(time.RFC3339),
+		Stats:       chartCommitStats{Files: len(commit.Files)},
+		Files:       make([]chartCommitFile, 0, len(commit.Files)),
+	}
+	for _, file := range commit.Files {
+		response.Stats.Additions += file.Additions
+		response.Stats.Deletions += file.Deletions
+		response.Files = append(response.Files, chartCommitFile{
+			Path:      file.Path,
+			OldPath:   file.OldPath,
+			Action:    file.Action,
+			Binary:    file.Binary,
+			Additions: file.Additions,
+			Deletions: file.Deletions,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+)
+
+const chartCommitPolicyMeta = chart.CommitPolicyMeta
+
+type chartCommitPolicy struct {
+	MessagePattern string   `json:"messagePattern,omitempty" example:"^[A-Z]+-[0-9]+ "`
+	MessagePrefix  string   `json:"messagePrefix,omitempty" example:"infra: "`
+	MaxFiles       int      `json:"maxFiles,omitempty" example:"20"`
+	DeniedPaths    []string `json:"deniedPaths,omitempty" example:"secrets,*.tfstate"`
+}
+
+// HandleChartCommitPolicy handles /api/chart/{id}/commit-policy requests.
+func HandleChartCommitPolicy(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.RequireAccessTokenClaims(r); err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		HandleChartCommitPolicyGet(w, r)
+	case http.MethodPut:
+		HandleChartCommitPolicyPut(w, r)
+	case http.MethodDelete:
+		HandleChartCommitPolicyDelete(w, r)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+	}
+}
+
+// HandleChartCommitPolicyGet handles GET /api/chart/{id}/commit-policy requests.
+// @Summary Get chart commit policy
+// @Description Returns the rules commits to the chart must follow.
+// @Tags chart
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Success 200 {object} chartCommitPolicy
+// @Failure 400 {object} errorResponse "`invalid chart id`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/commit-policy [get]
+func HandleChartCommitPolicyGet(w http.ResponseWriter, r *http.Request) {
+	policy, err := loadChartCommitPolicy(r.PathValue("id"))
+	if err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, chartCommitPolicy(policy))
+}
+
+// HandleChartCommitPolicyPut handles PUT /api/chart/{id}/commit-policy requests.
+// @Summary Set chart commit policy
+// @Description Replaces the commit policy. A commit is rejected when its message doesn't start with messagePrefix or match the messagePattern regular expression, when it touches more than maxFiles files, or when a written, deleted or moved path, or one of its directories, matches a deniedPaths glob. Every commit is checked: those made through the API are rejected with 422 and the reason, and pushes are refused per ref for their new commits. The baseline commit of a squash only has its message checked. Empty rules are off.
+// @Tags chart
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Param request body chartCommitPolicy true "Commit policy"
+// @Success 200 {object} chartCommitPolicy
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid_request`, `invalid_commit_policy`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/commit-policy [put]
+func HandleChartCommitPolicyPut(w http.ResponseWriter, r *http.Request) {
+	var req chartCommitPolicy
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "invalid JSON payload"})
+		return
+	}
+	for i, pattern := range req.DeniedPaths {
+		req.DeniedPaths[i] = strings.Trim(strings.TrimSpace(pattern), "/")
+	}
+
+	policy := chart.CommitPolicy(req)
+	if err := policy.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_commit_policy", Message: err.Error()})
+		return
+	}
+
+	if err := chart.WriteChartMeta(r.PathValue("id"), chartCommitPolicyMeta, policy); err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, req)
+}
+
+// HandleChartCommitPolicyDelete handles DELETE /api/chart/{id}/commit-policy requests.
+// @Summary Remove chart commit policy
+// @Tags chart
+// @Security BearerAuth
+// @Param id path string true "Chart ID"
+// @Success 200 {object} emptyResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/commit-policy [delete]
+func HandleChartCommitPolicyDelete(w http.ResponseWriter, r *http.Request) {
+	if err := chart.DeleteChartMeta(r.PathValue("id"), chartCommitPolicyMeta); err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, emptyResponse{})
+}
+
+func loadChartCommitPolicy(chartID string) (chart.CommitPolicy, error) {
+	return chart.ReadCommitPolicy(chartID)
+}
+
+// writeCommitPolicyError writes the response to a commit the chart commit
+// policy rejected and reports whether err was such a rejection.
+func writeCommitPolicyError(w http.ResponseWriter, err error) bool {
+	var policyErr *chart.CommitPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+	writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": "commit rejected by policy", "reason": policyErr.Reason})
+	return true
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+)
+
+type chartCopyRequest struct {
+	Source  string   `json:"source" example:"3fa85f64-5717-4562-b3fc-2c963f66afa6"`
+	Ref     string   `json:"ref,omitempty" example:"main"`
+	Paths   []string `json:"paths" example:"modules/vpc,network.tf.json"`
+	Message string   `json:"message,omitempty" example:"Share the VPC module"`
+}
+
+type chartCopyResponse struct {
+	ChartID       string   `json:"chartId"`
+	Ref           string   `json:"ref"`
+	SourceChartID string   `json:"sourceChartId"`
+	Source        string   `json:"source"` // Commit the files were read from
+	Paths         []string `json:"paths"`
+}
+
+// Handle POST /api/chart/{id}/copy requests.
+// @Summary Copy files from another chart
+// @Description Copies files of the source chart at ref (HEAD by default) into the chart as a single commit, at the same paths and with the same modes. Paths naming a directory copy every file below it, and files already at a copied path are replaced. The commit message ends with a "Copied-from:" trailer holding the source chart ID and commit.
+// @Tags chart
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Param request body chartCopyRequest true "Source chart, ref and paths"
+// @Success 200 {object} chartCopyResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid request body`, `invalid source chart id`, `paths required`, `invalid file path`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart not found`, `source chart not found`, `chart ref not found`, `chart file not found`, `chart_not_found`"
+// @Failure 409 {object} errorResponse "`chart already contains the copied files`, `chart changed concurrently, retry`"
+// @Failure 422 {object} errorResponse "`commit rejected by policy`"
+// @Failure 423 {object} errorResponse "`chart_locked`"
+// @Failure 500 {object} errorResponse "`failed to copy chart files`, `chart_settings_failed`"
+// @Router /chart/{id}/copy [post]
+func HandleChartCopy(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	var req chartCopyRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	if !chart.IsChartID(req.Source) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid source chart id"})
+		return
+	}
+	if len(req.Paths) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "paths required"})
+		return
+	}
+	// The route only scopes service accounts to the destination chart.
+	if auth.IsServiceAccount(claims.Subject) && !auth.AllowsRole(claims.Roles, auth.RoleViewer, req.Source) {
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: "forbidden", Message: auth.ErrForbidden.Error()})
+		return
+	}
+	if _, err := chart.ReadChartHead(req.Source); errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "source chart not found"})
+		return
+	}
+
+	chartID := r.PathValue("id")
+	if !requireChartUnlocked(w, chartID, claims.Subject) {
+		return
+	}
+	message := strings.TrimSpace(req.Message)
+	result, err := chart.CopyChartFiles(req.Source, strings.TrimSpace(req.Ref), req.Paths, chartID, message)
+	if err != nil {
+		if writeCommitPolicyError(w, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, chart.ErrInvalidPath) || errors.Is(err, chart.ErrPathIsDirectory) || errors.Is(err, chart.ErrUnsafeTree):
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid file path"})
+		case errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart not found"})
+		case errors.Is(err, plumbing.ErrReferenceNotFound):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart ref not found"})
+		case errors.Is(err, object.ErrFileNotFound):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart file not found"})
+		case errors.Is(err, chart.ErrNothingToCopy):
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "chart already contains the copied files"})
+		case errors.Is(err, chart.ErrHistoryChanged):
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "chart changed concurrently, retry"})
+		default:
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to copy chart files"})
+		}
+		return
+	}
+
+	if message == "" {
+		message = fmt.Sprintf("Copy %d files from chart %s", len(result.Paths), req.Source)
+	}
+	notifyChartCommit(chartID, result.Commit, message, result.Paths)
+
+	writeJSON(w, http.StatusOK, chartCopyResponse{
+		ChartID:       chartID,
+		Ref:           result.Commit,
+		SourceChartID: req.Source,
+		Source:        result.Source,
+		Paths:         result.Paths,
+	})
+}
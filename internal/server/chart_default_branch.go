@@ -0,0 +1,104 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+)
+
+type chartDefaultBranch struct {
+	Branch string `json:"branch" example:"main"`
+}
+
+// HandleChartDefaultBranch handles /api/chart/{id}/default-branch requests.
+func HandleChartDefaultBranch(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		HandleChartDefaultBranchGet(w, r)
+	case http.MethodPut:
+		HandleChartDefaultBranchPut(w, r, claims.Subject)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+	}
+}
+
+// HandleChartDefaultBranchGet handles GET /api/chart/{id}/default-branch requests.
+// @Summary Get chart default branch
+// @Description Returns the branch commits go to and that tree listings, file reads and deploys without a ref use. New charts start on DEFAULT_BRANCH (main by default).
+// @Tags chart
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Success 200 {object} chartDefaultBranch
+// @Failure 400 {object} errorResponse "`invalid chart id`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/default-branch [get]
+func HandleChartDefaultBranchGet(w http.ResponseWriter, r *http.Request) {
+	branch, err := chart.ChartDefaultBranch(r.PathValue("id"))
+	if err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, chartDefaultBranch{Branch: branch})
+}
+
+// HandleChartDefaultBranchPut handles PUT /api/chart/{id}/default-branch requests.
+// @Summary Set chart default branch
+// @Description Switches the chart to another branch. A branch that doesn't exist yet is created at the current commit, so the chart keeps its history; the previous branch is kept.
+// @Tags chart
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Param request body chartDefaultBranch true "Default branch"
+// @Success 200 {object} chartDefaultBranch
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid_request`, `invalid_branch`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`"
+// @Failure 423 {object} errorResponse "`chart_locked`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/default-branch [put]
+func HandleChartDefaultBranchPut(w http.ResponseWriter, r *http.Request, subject string) {
+	var req chartDefaultBranch
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "invalid JSON payload"})
+		return
+	}
+	req.Branch = strings.TrimPrefix(strings.TrimSpace(req.Branch), "refs/heads/")
+
+	chartID := r.PathValue("id")
+	if !requireChartUnlocked(w, chartID, subject) {
+		return
+	}
+	if err := chart.SetChartDefaultBranch(chartID, req.Branch); err != nil {
+		if errors.Is(err, chart.ErrInvalidBranch) {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_branch", Message: err.Error()})
+			return
+		}
+		writeChartMetaError(w, err)
+		return
+	}
+	publishChartChange(chartID)
+	publishChartRefEvent(chartID, plumbing.NewBranchReferenceName(req.Branch), "", "default")
+
+	writeJSON(w, http.StatusOK, req)
+}
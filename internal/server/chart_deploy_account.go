@@ -0,0 +1,246 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+	"github.com/mtolmacs/planemgr/internal/server/user"
+)
+
+const chartDeployAccountMeta = "deploy-account"
+
+type chartDeployAccountRequest struct {
+	ServiceAccount string `json:"serviceAccount" example:"ci"`
+}
+
+// chartDeployAccount binds a chart to a service account whose SSH key pair
+// deploys the chart, whoever starts the deploy.
+type chartDeployAccount struct {
+	ServiceAccount string `json:"serviceAccount"`
+	BoundBy        string `json:"boundBy"`
+	BoundAt        string `json:"boundAt"`
+}
+
+// HandleChartDeployAccount handles /api/chart/{id}/deploy-account requests.
+func HandleChartDeployAccount(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		HandleChartDeployAccountGet(w, r)
+	case http.MethodPut:
+		HandleChartDeployAccountPut(w, r, claims.Subject)
+	case http.MethodDelete:
+		HandleChartDeployAccountDelete(w, r, claims.Subject)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+	}
+}
+
+// HandleChartDeployAccountGet handles GET /api/chart/{id}/deploy-account requests.
+// @Summary Get chart deploy account
+// @Description Returns the service account the chart deploys as, or 404 when deploys use the keys of the deploying user.
+// @Tags chart
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Success 200 {object} chartDeployAccount
+// @Failure 400 {object} errorResponse "`invalid chart id`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`not_bound`, `chart_not_found`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/deploy-account [get]
+func HandleChartDeployAccountGet(w http.ResponseWriter, r *http.Request) {
+	binding, err := loadChartDeployAccount(r.PathValue("id"))
+	if err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+	if binding == nil {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "not_bound", Message: "chart deploys with the keys of the deploying user"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, binding)
+}
+
+// HandleChartDeployAccountPut handles PUT /api/chart/{id}/deploy-account requests.
+// @Summary Bind chart to a deploy account
+// @Description Binds the chart to a service account with an SSH key pair. Deploys of the chart then use the keys of the service account instead of those of the deploying user, so they don't depend on the user's private key being unlocked. Permissions and policies still apply to the deploying user. Only users can bind charts, and once the chart has admins only they can.
+// @Tags chart
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Param request body chartDeployAccountRequest true "Service account"
+// @Success 200 {object} chartDeployAccount
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid_request`, `ssh_key_required`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`, `service_account_not_found`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`, `service_account_load_failed`"
+// @Router /chart/{id}/deploy-account [put]
+func HandleChartDeployAccountPut(w http.ResponseWriter, r *http.Request, subject string) {
+	var req chartDeployAccountRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "invalid JSON payload"})
+		return
+	}
+
+	chartID := r.PathValue("id")
+	if !requireChartDeployAccountAdmin(w, chartID, subject) {
+		return
+	}
+	account, ok := loadServiceAccount(w, req.ServiceAccount)
+	if !ok {
+		return
+	}
+	if exists, err := user.UserKeyPairExists(account.Subject()); err != nil || !exists {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "ssh_key_required", Message: "service account has no SSH key pair"})
+		return
+	}
+
+	binding := chartDeployAccount{
+		ServiceAccount: account.Name,
+		BoundBy:        subject,
+		BoundAt:        time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := chart.WriteChartMeta(chartID, chartDeployAccountMeta, binding); err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, binding)
+}
+
+// HandleChartDeployAccountDelete handles DELETE /api/chart/{id}/deploy-account requests.
+// @Summary Unbind chart deploy account
+// @Description Makes deploys of the chart use the keys of the deploying user again.
+// @Tags chart
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Success 200 {object} chartDeployAccount
+// @Failure 400 {object} errorResponse "`invalid chart id`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`not_bound`, `chart_not_found`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/deploy-account [delete]
+func HandleChartDeployAccountDelete(w http.ResponseWriter, r *http.Request, subject string) {
+	chartID := r.PathValue("id")
+	if !requireChartDeployAccountAdmin(w, chartID, subject) {
+		return
+	}
+	binding, err := loadChartDeployAccount(chartID)
+	if err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+	if binding == nil {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "not_bound", Message: "chart deploys with the keys of the deploying user"})
+		return
+	}
+
+	if err := chart.DeleteChartMeta(chartID, chartDeployAccountMeta); err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, binding)
+}
+
+// requireChartDeployAccountAdmin writes 403 and returns false unless subject
+// is a user who may change the deploy account of the chart.
+func requireChartDeployAccountAdmin(w http.ResponseWriter, chartID, subject string) bool {
+	if auth.IsServiceAccount(subject) {
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: "forbidden", Message: "service accounts can't change deploy accounts"})
+		return false
+	}
+	permissions, err := loadChartPermissions(chartID)
+	if err != nil {
+		writeChartMetaError(w, err)
+		return false
+	}
+	if len(permissions.Admins) > 0 && !slices.Contains(permissions.Admins, subject) {
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: "forbidden", Message: "only chart admins can change the deploy account"})
+		return false
+	}
+	return true
+}
+
+// loadChartDeployAccount returns the deploy account binding of a chart, or nil
+// when it has none.
+func loadChartDeployAccount(chartID string) (*chartDeployAccount, error) {
+	var binding chartDeployAccount
+	if err := chart.ReadChartMeta(chartID, chartDeployAccountMeta, &binding); err != nil {
+		if errors.Is(err, chart.ErrMetaNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &binding, nil
+}
+
+// chartDeployKeys returns the SSH key pair a chart deploys with: the keys of
+// its deploy account when it is bound to one, or else those of the deploying
+// user. It writes the error and returns false when the keys are unavailable.
+func chartDeployKeys(w http.ResponseWriter, chartID, subject string) (string, string, bool) {
+	binding, err := loadChartDeployAccount(chartID)
+	if err != nil {
+		writeChartMetaError(w, err)
+		return "", "", false
+	}
+
+	if binding != nil {
+		account, err := user.LoadServiceAccount(binding.ServiceAccount)
+		if errors.Is(err, os.ErrNotExist) {
+			writeJSON(w, http.StatusConflict, errorResponse{Error: "deploy_account_unavailable", Message: "deploy account " + binding.ServiceAccount + " no longer exists"})
+			return "", "", false
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "service_account_load_failed", Message: err.Error()})
+			return "", "", false
+		}
+		publicKey, privateKey, err := user.LoadServiceAccountKeyPair(account)
+		if err == nil && privateKey == "" {
+			err = errors.New("it has no SSH key pair")
+		}
+		if err != nil {
+			writeJSON(w, http.StatusConflict, errorResponse{Error: "deploy_account_unavailable", Message: "deploy account " + binding.ServiceAccount + " can't deploy: " + err.Error()})
+			return "", "", false
+		}
+		return publicKey, privateKey, true
+	}
+
+	privateKey, ok := requirePrivateKey(w, subject)
+	if !ok {
+		return "", "", false
+	}
+	publicKey, err := user.LoadUserPublicKey(subject)
+	if err != nil {
+		status := http.StatusInternalServerError
+		code := "key_load_failed"
+		if errors.Is(err, os.ErrNotExist) {
+			status = http.StatusNotFound
+			code = "ssh_public_key_not_found"
+		}
+		writeJSON(w, status, errorResponse{Error: code, Message: err.Error()})
+		return "", "", false
+	}
+	return publicKey, privateKey, true
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"unicode/utf8"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+)
+
+const (
+	chartDeployHistoryMeta   = "deploy-history"
+	deployHistoryRetention   = 200      // Deploys kept per chart
+	deployHistoryOutputLimit = 16 << 10 // Bytes of runner output kept per deploy
+	defaultDeployHistory     = 20
+	maxDeployHistory         = 100
+)
+
+// chartDeployRun is a deploy attempt of a chart, whatever its outcome.
+type chartDeployRun struct {
+	DeployID        string `json:"deployId"`
+	Ref             string `json:"ref"`
+	Commit          string `json:"commit,omitempty"`
+	Stack           string `json:"stack,omitempty"`
+	Environment     string `json:"environment,omitempty"`
+	Sandbox         bool   `json:"sandbox,omitempty"`
+	PlanOnly        bool   `json:"planOnly,omitempty"` // Stopped after the plan
+	Destroy         bool   `json:"destroy,omitempty"`  // Tore the module down
+	Status          string `json:"status" example:"succeeded"`
+	Subject         string `json:"subject"` // Who started the deploy
+	StartedAt       string `json:"startedAt" example:"2026-01-02T15:04:05Z"`
+	FinishedAt      string `json:"finishedAt" example:"2026-01-02T15:09:05Z"`
+	ExitCode        int64  `json:"exitCode"`
+	RunnerImage     string `json:"runnerImage,omitempty"`
+	Output          string `json:"output,omitempty"` // The end of the runner output
+	OutputTruncated bool   `json:"outputTruncated,omitempty"`
+	Error           string `json:"error,omitempty"` // Why the deploy failed without a result
+
+	// OverriddenPolicies are the blocking policies, such as the budget, the
+	// subject forced the deploy past with overridePolicies.
+	OverriddenPolicies []string `json:"overriddenPolicies,omitempty" example:"budget"`
+}
+
+type chartDeployHistoryResponse struct {
+	ChartID     string           `json:"chartId"`
+	Offset      int              `json:"offset"`
+	Limit       int              `json:"limit"`
+	NextOffset  *int             `json:"nextOffset,omitempty"`
+	Deployments []chartDeployRun `json:"deployments"`
+}
+
+// Handle GET /api/chart/{id}/deployments requests.
+// @Summary List chart deployments
+// @Description Returns the deploy attempts of a chart, newest first, with who started them, when they ran, how they ended and the last 16 KiB of the runner output. The last 200 deploys of every chart are kept, and the whole output of each at GET /api/chart/{id}/deployments/{deployId}/log.
+// @Tags chart
+// @Security BearerAuth
+// @Param id path string true "Chart ID"
+// @Param stack query string false "Only list deploys of this stack; empty for the root module"
+// @Param environment query string false "Only list deploys to this environment; empty for deploys without one"
+// @Param offset query int false "Number of deploys to skip"
+// @Param limit query int false "Maximum number of deploys (default 20, max 100)"
+// @Param fields query string false "Comma-separated deployment fields to return, such as deployId,status"
+// @Success 200 {object} chartDeployHistoryResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid pagination`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart not found`"
+// @Failure 500 {object} errorResponse "`failed to read deployments`"
+// @Router /chart/{id}/deployments [get]
+func HandleChartDeployHistory(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.RequireAccessTokenClaims(r); err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	chartID := r.PathValue("id")
+	offset, limit, ok := paginationParams(r, defaultDeployHistory, maxDeployHistory)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid pagination"})
+		return
+	}
+
+	runs, err := loadChartDeployHistory(chartID)
+	if err != nil {
+		if errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart not found"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read deployments"})
+		return
+	}
+	query := r.URL.Query()
+	if query.Has("stack") {
+		stack := query.Get("stack")
+		runs = slices.DeleteFunc(runs, func(run chartDeployRun) bool { return run.Stack != stack })
+	}
+	if query.Has("environment") {
+		environment := query.Get("environment")
+		runs = slices.DeleteFunc(runs, func(run chartDeployRun) bool { return run.Environment != environment })
+	}
+
+	// The history is stored oldest first.
+	slices.Reverse(runs)
+	page := runs[min(offset, len(runs)):min(offset+limit, len(runs))]
+	response := chartDeployHistoryResponse{
+		ChartID:     chartID,
+		Offset:      offset,
+		Limit:       limit,
+		Deployments: page,
+	}
+	if next := offset + len(page); next < len(runs) {
+		response.NextOffset = &next
+	}
+
+	writeJSONFields(w, r, http.StatusOK, response, "deployments")
+}
+
+func loadChartDeployHistory(chartID string) ([]chartDeployRun, error) {
+	runs := []chartDeployRun{}
+	if err := chart.ReadChartMeta(chartID, chartDeployHistoryMeta, &runs); err != nil && !errors.Is(err, chart.ErrMetaNotFound) {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// appendChartDeployHistory adds run to the deploy history of the chart,
+// keeping the end of its output and dropping the oldest runs past the
+// retention with their logs. The whole output is stored as the deploy log.
+// Callers hold chartDeploymentsMu.
+func appendChartDeployHistory(chartID string, run chartDeployRun) error {
+	if run.Output != "" {
+		if err := chart.WriteDeployLog(chartID, run.DeployID, run.Output); err != nil {
+			log.Printf("Storing the log of deploy %s failed: %v", run.DeployID, err)
+		}
+	}
+	if len(run.Output) > deployHistoryOutputLimit {
+		start := len(run.Output) - deployHistoryOutputLimit
+		for start < len(run.Output) && !utf8.RuneStart(run.Output[start]) {
+			start++
+		}
+		run.Output = run.Output[start:]
+		run.OutputTruncated = true
+	}
+
+	runs, err := loadChartDeployHistory(chartID)
+	if err != nil {
+		return err
+	}
+	runs = append(runs, run)
+	if len(runs) > deployHistoryRetention {
+		for _, dropped := range runs[:len(runs)-deployHistoryRetention] {
+			if err := chart.DeleteDeployLog(chartID, dropped.DeployID); err != nil {
+				log.Printf("Removing the log of deploy %s failed: %v", dropped.DeployID, err)
+			}
+		}
+		runs = runs[len(runs)-deployHistoryRetention:]
+	}
+	return chart.WriteChartMeta(chartID, chartDeployHistoryMeta, runs)
+}
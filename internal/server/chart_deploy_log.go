@@ -0,0 +1,102 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+)
+
+const (
+	defaultDeployLogColdAfter = 720 * time.Hour
+	deployLogTieringInterval  = time.Hour
+)
+
+// HandleChartDeployLog handles GET /api/chart/{id}/deployments/{deployId}/log requests.
+// @Summary Get a deploy log
+// @Description Returns the whole runner output of a finished deploy of the chart, decompressed. Logs are stored zstd-compressed once their deploy finished, moved to DEPLOY_LOG_COLD_DIR when it is set and they are older than DEPLOY_LOG_COLD_AFTER (30 days by default), and removed with their deploy from the deploy history.
+// @Tags chart
+// @Security BearerAuth
+// @Produce plain
+// @Param id path string true "Chart ID"
+// @Param deployId path string true "Deploy ID"
+// @Success 200 {string} string "Runner output"
+// @Failure 400 {object} errorResponse "`invalid chart id`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`, `deploy_log_not_found`"
+// @Failure 500 {object} errorResponse "`deploy_log_failed`"
+// @Router /chart/{id}/deployments/{deployId}/log [get]
+func HandleChartDeployLog(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.RequireAccessTokenClaims(r); err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+		return
+	}
+
+	logs, err := chart.OpenDeployLog(r.PathValue("id"), r.PathValue("deployId"))
+	switch {
+	case errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist):
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "chart_not_found"})
+		return
+	case errors.Is(err, chart.ErrDeployLogNotFound) || errors.Is(err, chart.ErrInvalidPath):
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "deploy_log_not_found"})
+		return
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "deploy_log_failed", Message: err.Error()})
+		return
+	}
+	defer logs.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, logs); err != nil {
+		log.Printf("Sending the log of deploy %s failed: %v", r.PathValue("deployId"), err)
+	}
+}
+
+// StartDeployLogTiering moves deploy logs older than DEPLOY_LOG_COLD_AFTER to
+// DEPLOY_LOG_COLD_DIR every hour. Without DEPLOY_LOG_COLD_DIR logs stay
+// next to their chart.
+func StartDeployLogTiering() {
+	if chart.DeployLogColdDir() == "" {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(deployLogTieringInterval)
+		defer ticker.Stop()
+		for {
+			moved, err := chart.MoveDeployLogsCold(time.Now().Add(-deployLogColdAfter()))
+			if moved > 0 {
+				log.Printf("Moved %d deploy logs to the cold tier", moved)
+			}
+			if err != nil {
+				log.Printf("Moving deploy logs to the cold tier failed: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+func deployLogColdAfter() time.Duration {
+	value := os.Getenv("DEPLOY_LOG_COLD_AFTER")
+	if value == "" {
+		return defaultDeployLogColdAfter
+	}
+	after, err := time.ParseDuration(value)
+	if err != nil || after < 0 {
+		log.Printf("Invalid DEPLOY_LOG_COLD_AFTER %q, using %s", value, defaultDeployLogColdAfter)
+		return defaultDeployLogColdAfter
+	}
+	return after
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+	"github.com/mtolmacs/planemgr/internal/server/deploy"
+)
+
+const (
+	chartDeployStatsMeta = "deploy-stats"
+	deployStatsDate      = time.DateOnly
+	deployStatsRetention = 400 // Days of counts kept per chart
+	defaultDeployStats   = 30  // Days returned without from
+	maxDeployStatsDays   = 366
+)
+
+// chartDeployStats counts the deploy attempts of a chart by UTC day and
+// outcome, such as {"2026-01-02": {"succeeded": 3, "failed": 1}}.
+type chartDeployStats map[string]map[string]int
+
+type deployStatsDay struct {
+	Date         string  `json:"date" example:"2026-01-02"`
+	Deploys      int     `json:"deploys"`
+	Failed       int     `json:"failed"`
+	FailureRatio float64 `json:"failureRatio" example:"0.25"`
+}
+
+type deployStatsChart struct {
+	ChartID      string           `json:"chartId"`
+	Deploys      int              `json:"deploys"`
+	Failed       int              `json:"failed"`
+	FailureRatio float64          `json:"failureRatio"`
+	Days         []deployStatsDay `json:"days"` // Only days with deploys, oldest first
+}
+
+type deployStatsResponse struct {
+	From   string             `json:"from" example:"2026-01-01"`
+	To     string             `json:"to" example:"2026-01-31"`
+	Days   []deployStatsDay   `json:"days"` // Every day of the range, summed over the charts
+	Charts []deployStatsChart `json:"charts"`
+}
+
+// Handle GET /api/chart/deploy-stats requests.
+// @Summary Deploy frequency and failures per chart
+// @Description Counts deploy attempts per chart and UTC day over a date range, with how many failed. Failed, timed out and rolled back deploys count as failures. Charts without deploys in the range are left out. Counts are kept for 400 days.
+// @Tags chart
+// @Security BearerAuth
+// @Param from query string false "First day, YYYY-MM-DD (defaults to 30 days before to)"
+// @Param to query string false "Last day, YYYY-MM-DD (defaults to today)"
+// @Success 200 {object} deployStatsResponse
+// @Failure 400 {object} errorResponse "`invalid_request`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 500 {object} errorResponse "`chart_list_failed`, `chart_report_failed`"
+// @Router /chart/deploy-stats [get]
+func HandleChartDeployStats(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.RequireAccessTokenClaims(r); err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+		return
+	}
+
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	if value := r.URL.Query().Get("to"); value != "" {
+		parsed, err := time.Parse(deployStatsDate, value)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "to must be a YYYY-MM-DD date"})
+			return
+		}
+		to = parsed
+	}
+	from := to.AddDate(0, 0, 1-defaultDeployStats)
+	if value := r.URL.Query().Get("from"); value != "" {
+		parsed, err := time.Parse(deployStatsDate, value)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "from must be a YYYY-MM-DD date"})
+			return
+		}
+		from = parsed
+	}
+	if from.After(to) || to.Sub(from) >= maxDeployStatsDays*24*time.Hour {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "from must be at most 366 days before to"})
+		return
+	}
+
+	chartIDs, err := chart.ListChartRepos()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "chart_list_failed", Message: err.Error()})
+		return
+	}
+
+	response := deployStatsResponse{
+		From:   from.Format(deployStatsDate),
+		To:     to.Format(deployStatsDate),
+		Days:   []deployStatsDay{},
+		Charts: []deployStatsChart{},
+	}
+	totals := map[string]*deployStatsDay{}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		response.Days = append(response.Days, deployStatsDay{Date: day.Format(deployStatsDate)})
+		totals[day.Format(deployStatsDate)] = &response.Days[len(response.Days)-1]
+	}
+
+	for _, chartID := range chartIDs {
+		stats, err := loadChartDeployStats(chartID)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "chart_report_failed", Message: err.Error()})
+			return
+		}
+
+		entry := deployStatsChart{ChartID: chartID, Days: []deployStatsDay{}}
+		for date, statuses := range stats {
+			total, ok := totals[date]
+			if !ok {
+				continue
+			}
+			day := deployStatsDay{Date: date}
+			for status, count := range statuses {
+				day.Deploys += count
+				if status == deploy.StatusFailed || status == deploy.StatusTimedOut || status == deployStatusRolledBack {
+					day.Failed += count
+				}
+			}
+			day.FailureRatio = failureRatio(day.Failed, day.Deploys)
+			entry.Days = append(entry.Days, day)
+			entry.Deploys += day.Deploys
+			entry.Failed += day.Failed
+			total.Deploys += day.Deploys
+			total.Failed += day.Failed
+		}
+		if entry.Deploys == 0 {
+			continue
+		}
+		entry.FailureRatio = failureRatio(entry.Failed, entry.Deploys)
+		sort.Slice(entry.Days, func(i, j int) bool { return entry.Days[i].Date < entry.Days[j].Date })
+		response.Charts = append(response.Charts, entry)
+	}
+	for i := range response.Days {
+		response.Days[i].FailureRatio = failureRatio(response.Days[i].Failed, response.Days[i].Deploys)
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func failureRatio(failed, deploys int) float64 {
+	if deploys == 0 {
+		return 0
+	}
+	return float64(failed) / float64(deploys)
+}
+
+func loadChartDeployStats(chartID string) (chartDeployStats, error) {
+	stats := chartDeployStats{}
+	if err := chart.ReadChartMeta(chartID, chartDeployStatsMeta, &stats); err != nil && !errors.Is(err, chart.ErrMetaNotFound) {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// countChartDeployAttempt adds a deploy attempt to the daily counts of the
+// chart and drops the days past the retention. Callers hold
+// chartDeploymentsMu.
+func countChartDeployAttempt(chartID, status string, at time.Time) {
+	stats, err := loadChartDeployStats(chartID)
+	if err == nil {
+		date := at.UTC().Format(deployStatsDate)
+		if stats[date] == nil {
+			stats[date] = map[string]int{}
+		}
+		stats[date][status]++
+
+		cutoff := at.UTC().AddDate(0, 0, -deployStatsRetention).Format(deployStatsDate)
+		for day := range stats {
+			if day < cutoff {
+				delete(stats, day)
+			}
+		}
+		err = chart.WriteChartMeta(chartID, chartDeployStatsMeta, stats)
+	}
+	if err != nil {
+		log.Printf("Counting deploy attempt of chart %s failed: %v", chartID, err)
+	}
+}
@@ -0,0 +1,265 @@
+package server
+
+import (
+	"cmp"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+)
+
+const (
+	chartDeploymentsMeta = "deployments"
+	chartLastDeployMeta  = "last-deploy"
+)
+
+// chartDeployment is the last successful deploy of a stack of a chart in an
+// environment. The root module is recorded with an empty stack, and deploys
+// without an environment with an empty environment.
+type chartDeployment struct {
+	Environment string `json:"environment,omitempty"`
+	Stack       string `json:"stack,omitempty"`
+	Ref         string `json:"ref"`
+	Commit      string `json:"commit,omitempty"`
+	Status      string `json:"status"`
+	Subject     string `json:"subject"`
+	DeployedAt  string `json:"deployedAt"`
+	// AgentLabels are those the deploy ran with, so teardowns of ephemeral
+	// environments run where the module was deployed.
+	AgentLabels []string `json:"agentLabels,omitempty"`
+}
+
+type chartPendingChanges struct {
+	Environment    string           `json:"environment,omitempty"`
+	Stack          string           `json:"stack,omitempty"`
+	DeployedRef    string           `json:"deployedRef"`
+	DeployedCommit string           `json:"deployedCommit"`
+	DeployedAt     string           `json:"deployedAt"`
+	Summary        chartDiffSummary `json:"summary"`
+	Files          []chartFileDiff  `json:"files"`
+}
+
+type chartPendingChangesResponse struct {
+	ChartID      string                `json:"chartId"`
+	Ref          string                `json:"ref"`
+	Environments []chartPendingChanges `json:"environments"`
+}
+
+// chartDeploymentsMu serializes updates of the deployment documents, which
+// are shared by the stacks of a chart that hold separate deploy locks.
+var chartDeploymentsMu sync.Mutex
+
+// Handle GET /api/chart/{id}/pending-changes requests.
+// @Summary List changes pending deploy
+// @Description Compares a ref with the commit of the last successful deploy of every stack in every environment, answering what deploying the ref would change. The root module is reported with an empty stack, and deploys without an environment with an empty environment. With watch and the X-Watch-Cursor of the last response in since, the request waits until the chart is deployed or committed to.
+// @Tags chart
+// @Security BearerAuth
+// @Param id path string true "Chart ID"
+// @Param ref query string false "Git ref to deploy (defaults to HEAD)"
+// @Param stack query string false "Only compare against this stack"
+// @Param environment query string false "Only compare against deploys to this environment"
+// @Param watch query bool false "Wait up to 30 seconds for a change when since is the current cursor"
+// @Param since query string false "X-Watch-Cursor of the last response"
+// @Success 200 {object} chartPendingChangesResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`stack was never deployed`, `environment was never deployed`, `chart not found`, `chart ref not found`"
+// @Failure 500 {object} errorResponse "`failed to compare chart`"
+// @Router /chart/{id}/pending-changes [get]
+func HandleChartPendingChanges(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.RequireAccessTokenClaims(r); err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	chartID := r.PathValue("id")
+	if !watchChanges(w, r, watchTopicDeploy+chartID) {
+		return
+	}
+	query := r.URL.Query()
+	ref, err := chart.ResolveChartRef(chartID, query.Get("ref"))
+	if err != nil {
+		writePendingChangesError(w, err)
+		return
+	}
+
+	deployments, err := loadChartDeployments(chartID)
+	if err != nil {
+		writePendingChangesError(w, err)
+		return
+	}
+	if query.Has("stack") {
+		stack := query.Get("stack")
+		deployments = slices.DeleteFunc(deployments, func(d chartDeployment) bool { return d.Stack != stack })
+		if len(deployments) == 0 {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "stack was never deployed"})
+			return
+		}
+	}
+	if query.Has("environment") {
+		environment := query.Get("environment")
+		deployments = slices.DeleteFunc(deployments, func(d chartDeployment) bool { return d.Environment != environment })
+		if len(deployments) == 0 {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "environment was never deployed"})
+			return
+		}
+	}
+
+	response := chartPendingChangesResponse{
+		ChartID:      chartID,
+		Ref:          ref,
+		Environments: make([]chartPendingChanges, 0, len(deployments)),
+	}
+	for _, deployment := range deployments {
+		_, _, diffs, err := chart.DiffChartRefs(chartID, deployment.Commit, ref)
+		if err != nil {
+			writePendingChangesError(w, err)
+			return
+		}
+
+		diff := newChartDiffResponse(chartID, deployment.Commit, ref, diffs)
+		for i := range diff.Files {
+			diff.Files[i].Patch = ""
+		}
+		response.Environments = append(response.Environments, chartPendingChanges{
+			Environment:    deployment.Environment,
+			Stack:          deployment.Stack,
+			DeployedRef:    deployment.Ref,
+			DeployedCommit: deployment.Commit,
+			DeployedAt:     deployment.DeployedAt,
+			Summary:        diff.Summary,
+			Files:          diff.Files,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func writePendingChangesError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart not found"})
+	case errors.Is(err, plumbing.ErrReferenceNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart ref not found"})
+	default:
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to compare chart"})
+	}
+}
+
+func loadChartDeployments(chartID string) ([]chartDeployment, error) {
+	deployments := []chartDeployment{}
+	if err := chart.ReadChartMeta(chartID, chartDeploymentsMeta, &deployments); err != nil && !errors.Is(err, chart.ErrMetaNotFound) {
+		return nil, err
+	}
+	return deployments, nil
+}
+
+// recordChartDeployment stores deployment as the last successful deploy of
+// its stack in its environment. Failures are logged, they never fail the
+// deploy itself.
+func recordChartDeployment(chartID string, deployment chartDeployment) {
+	chartDeploymentsMu.Lock()
+	defer chartDeploymentsMu.Unlock()
+
+	deployment.DeployedAt = time.Now().UTC().Format(time.RFC3339)
+	deployments, err := loadChartDeployments(chartID)
+	if err == nil {
+		deployments = slices.DeleteFunc(deployments, func(d chartDeployment) bool {
+			return d.Environment == deployment.Environment && d.Stack == deployment.Stack
+		})
+		deployments = append(deployments, deployment)
+		slices.SortFunc(deployments, func(a, b chartDeployment) int {
+			return cmp.Or(strings.Compare(a.Environment, b.Environment), strings.Compare(a.Stack, b.Stack))
+		})
+		err = chart.WriteChartMeta(chartID, chartDeploymentsMeta, deployments)
+	}
+	if err != nil {
+		log.Printf("Recording deploy of chart %s failed: %v", chartID, err)
+	}
+	publishChange(watchTopicDeploy + chartID)
+}
+
+// forgetChartDeployment drops the last deploy of a stack in an environment
+// once its resources were destroyed. Failures are logged.
+func forgetChartDeployment(chartID, environment, stack string) {
+	chartDeploymentsMu.Lock()
+	defer chartDeploymentsMu.Unlock()
+
+	deployments, err := loadChartDeployments(chartID)
+	if err == nil {
+		deployments = slices.DeleteFunc(deployments, func(d chartDeployment) bool {
+			return d.Environment == environment && d.Stack == stack
+		})
+		err = chart.WriteChartMeta(chartID, chartDeploymentsMeta, deployments)
+	}
+	if err != nil {
+		log.Printf("Recording destroy of chart %s failed: %v", chartID, err)
+	}
+	publishChange(watchTopicDeploy + chartID)
+}
+
+// recordChartDeployAttempt stores run as the last deploy attempt of the
+// chart, whatever its outcome, adds it to the deploy history and counts it
+// in the deploy stats. Failures are logged.
+func recordChartDeployAttempt(chartID string, run chartDeployRun) {
+	chartDeploymentsMu.Lock()
+	defer chartDeploymentsMu.Unlock()
+
+	now := time.Now()
+	run.FinishedAt = now.UTC().Format(time.RFC3339)
+	deployment := chartDeployment{
+		Environment: run.Environment,
+		Stack:       run.Stack,
+		Ref:         run.Ref,
+		Commit:      run.Commit,
+		Status:      run.Status,
+		Subject:     run.Subject,
+		DeployedAt:  run.FinishedAt,
+	}
+	if err := chart.WriteChartMeta(chartID, chartLastDeployMeta, deployment); err != nil {
+		log.Printf("Recording deploy attempt of chart %s failed: %v", chartID, err)
+	}
+	if err := appendChartDeployHistory(chartID, run); err != nil {
+		log.Printf("Recording deploy history of chart %s failed: %v", chartID, err)
+	}
+	countChartDeployAttempt(chartID, deployment.Status, now)
+	publishChange(watchTopicDeploy + chartID)
+	publishChartEvent(chartEvent{
+		Type:        chartEventDeploy,
+		ChartID:     chartID,
+		Ref:         deployment.Ref,
+		Commit:      deployment.Commit,
+		Stack:       deployment.Stack,
+		Environment: deployment.Environment,
+		Status:      deployment.Status,
+		Subject:     deployment.Subject,
+	})
+}
+
+// loadChartLastDeploy returns the last deploy attempt of a chart, or nil when
+// it was never deployed.
+func loadChartLastDeploy(chartID string) (*chartDeployment, error) {
+	var deployment chartDeployment
+	if err := chart.ReadChartMeta(chartID, chartLastDeployMeta, &deployment); err != nil {
+		if errors.Is(err, chart.ErrMetaNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &deployment, nil
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+)
+
+type chartFileDiff struct {
+	Path    string `json:"path"`
+	OldPath string `json:"oldPath,omitempty"`
+	Action  string `json:"action"`
+	Binary  bool   `json:"binary,omitempty"`
+	Patch   string `json:"patch,omitempty"`
+}
+
+type chartDiffSummary struct {
+	Added    []string `json:"added"`
+	Modified []string `json:"modified"`
+	Deleted  []string `json:"deleted"`
+}
+
+type chartDiffResponse struct {
+	ChartID string           `json:"chartId"`
+	From    string           `json:"from"`
+	To      string           `json:"to"`
+	Summary chartDiffSummary `json:"summary"`
+	Files   []chartFileDiff  `json:"files"`
+}
+
+// Handle GET /api/chart/{id}/diff requests.
+// @Summary Diff two chart refs
+// @Description Returns per-file unified diffs and an added/modified/deleted summary between two refs. Moved files are listed once as modified, with their oldPath, when their content stayed mostly the same. fromAt and toAt resolve their ref to the commit it pointed to at that time, so "from" may be omitted when fromAt is given.
+// @Tags chart
+// @Security BearerAuth
+// @Param id path string true "Chart ID"
+// @Param from query string false "Base git ref, required without fromAt (defaults to HEAD with fromAt)"
+// @Param to query string false "Target git ref (defaults to HEAD)"
+// @Param fromAt query string false "RFC 3339 timestamp; resolves the from ref to the commit it pointed to at that time"
+// @Param toAt query string false "RFC 3339 timestamp; resolves the to ref to the commit it pointed to at that time"
+// @Success 200 {object} chartDiffResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`, `from or fromAt required`, `at must be an RFC 3339 timestamp`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart not found`, `chart ref not found`, `no chart commit at that time`"
+// @Failure 500 {object} errorResponse "`failed to diff chart`, `failed to resolve chart ref`"
+// @Router /chart/{id}/diff [get]
+func HandleChartDiff(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.RequireAccessTokenClaims(r); err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	chartID := r.PathValue("id")
+	if r.URL.Query().Get("from") == "" && r.URL.Query().Get("fromAt") == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "from or fromAt required"})
+		return
+	}
+	from, ok := chartQueryRef(w, r, chartID, "from", "fromAt")
+	if !ok {
+		return
+	}
+	to, ok := chartQueryRef(w, r, chartID, "to", "toAt")
+	if !ok {
+		return
+	}
+
+	fromRef, toRef, diffs, err := chart.DiffChartRefs(chartID, from, to)
+	if err != nil {
+		if errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart not found"})
+			return
+		}
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart ref not found"})
+			return
+		}
+
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to diff chart"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newChartDiffResponse(chartID, fromRef, toRef, diffs))
+}
+
+func newChartDiffResponse(chartID, from, to string, diffs []chart.FileDiff) chartDiffResponse {
+	response := chartDiffResponse{
+		ChartID: chartID,
+		From:    from,
+		To:      to,
+		Summary: chartDiffSummary{
+			Added:    []string{},
+			Modified: []string{},
+			Deleted:  []string{},
+		},
+		Files: make([]chartFileDiff, 0, len(diffs)),
+	}
+	for _, diff := range diffs {
+		switch diff.Action {
+		case chart.ChangeAdded:
+			response.Summary.Added = append(response.Summary.Added, diff.Path)
+		case chart.ChangeDeleted:
+			response.Summary.Deleted = append(response.Summary.Deleted, diff.Path)
+		default:
+			response.Summary.Modified = append(response.Summary.Modified, diff.Path)
+		}
+		response.Files = append(response.Files, chartFileDiff{
+			Path:    diff.Path,
+			OldPath: diff.OldPath,
+			Action:  diff.Action,
+			Binary:  diff.Binary,
+			Patch:   diff.Patch,
+		})
+	}
+	return response
+}
@@ -0,0 +1,324 @@
+package server
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+	"github.com/mtolmacs/planemgr/internal/server/deploy"
+	"github.com/mtolmacs/planemgr/internal/server/user"
+)
+
+// environmentExpiryWarning is how long before an ephemeral environment
+// expires the users who deployed to it are warned.
+const environmentExpiryWarning = time.Hour
+
+// environmentTeardownRetry is how long the teardown of an expired
+// environment waits to be tried again once it failed.
+const environmentTeardownRetry = time.Hour
+
+type chartEnvironmentExtendRequest struct {
+	ExtendSeconds int `json:"extendSeconds" example:"86400"`
+}
+
+// environmentExpiry tracks the warnings sent about expiring environments and
+// their teardowns. It is kept in memory, so a restart may warn again.
+var environmentExpiry = struct {
+	mu      sync.Mutex
+	warned  map[string]string    // ExpiresAt warned about, by deployLockKey of the environment
+	running map[string]bool      // Teardowns in progress
+	retryAt map[string]time.Time // Of teardowns that failed
+}{
+	warned:  map[string]string{},
+	running: map[string]bool{},
+	retryAt: map[string]time.Time{},
+}
+
+// HandleChartEnvironmentExtend handles /api/chart/{id}/environments/{name}/extend requests.
+// @Summary Extend an ephemeral environment
+// @Description Moves the expiry of an ephemeral environment of the chart extendSeconds later, counted from now once it passed, and warns again before the new one. Unlike setting expiresAt, anyone who can deploy the chart may extend it. Environments can't be extended while they are torn down.
+// @Tags chart
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Param name path string true "Environment name"
+// @Param request body chartEnvironmentExtendRequest true "Extension"
+// @Success 200 {object} chartEnvironment
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid_request`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`, `environment_not_found`"
+// @Failure 409 {object} errorResponse "`environment_not_ephemeral`, `environment_expiring`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/environments/{name}/extend [post]
+func HandleChartEnvironmentExtend(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.RequireAccessTokenClaims(r); err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+		return
+	}
+
+	var req chartEnvironmentExtendRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "invalid JSON payload"})
+		return
+	}
+	if req.ExtendSeconds <= 0 {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "extendSeconds must be positive"})
+		return
+	}
+
+	chartID, name := r.PathValue("id"), r.PathValue("name")
+	key := deployLockKey(chartID, name, "")
+	environmentExpiry.mu.Lock()
+	tearingDown := environmentExpiry.running[key]
+	environmentExpiry.mu.Unlock()
+	if tearingDown {
+		writeJSON(w, http.StatusConflict, errorResponse{Error: "environment_expiring", Message: "the environment is being torn down"})
+		return
+	}
+
+	chartEnvironmentsMu.Lock()
+	defer chartEnvironmentsMu.Unlock()
+	environments, err := loadChartEnvironments(chartID)
+	if err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+	i := slices.IndexFunc(environments.Environments, func(environment chartEnvironment) bool { return environment.Name == name })
+	if i < 0 {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "environment_not_found", Message: "the chart has no environment " + name})
+		return
+	}
+	environment := &environments.Environments[i]
+	expiresAt, err := time.Parse(time.RFC3339, environment.ExpiresAt)
+	if err != nil {
+		writeJSON(w, http.StatusConflict, errorResponse{Error: "environment_not_ephemeral", Message: "the environment doesn't expire"})
+		return
+	}
+	if now := time.Now(); expiresAt.Before(now) {
+		expiresAt = now
+	}
+	environment.ExpiresAt = expiresAt.Add(time.Duration(req.ExtendSeconds) * time.Second).UTC().Format(time.RFC3339)
+	if err := chart.WriteChartMeta(chartID, chartEnvironmentsMeta, environments); err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+
+	environmentExpiry.mu.Lock()
+	delete(environmentExpiry.retryAt, key)
+	environmentExpiry.mu.Unlock()
+	writeJSON(w, http.StatusOK, *environment)
+}
+
+// expireChartEnvironmentAfter makes an environment of the chart expire d
+// from now, for deploy requests with expiresInSeconds. Like setting
+// expiresAt, it is reserved to the chart admins once they are set. It writes
+// the error and returns false when it can't.
+func expireChartEnvironmentAfter(w http.ResponseWriter, chartID, name, subject string, d time.Duration) bool {
+	permissions, err := loadChartPermissions(chartID)
+	if err != nil {
+		writeChartMetaError(w, err)
+		return false
+	}
+	if len(permissions.Admins) > 0 && !slices.Contains(permissions.Admins, subject) {
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: "forbidden", Message: "only chart admins can make environments expire"})
+		return false
+	}
+
+	chartEnvironmentsMu.Lock()
+	defer chartEnvironmentsMu.Unlock()
+	environments, err := loadChartEnvironments(chartID)
+	if err != nil {
+		writeChartMetaError(w, err)
+		return false
+	}
+	i := slices.IndexFunc(environments.Environments, func(environment chartEnvironment) bool { return environment.Name == name })
+	if i < 0 {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "environment_not_found", Message: "the chart has no environment " + name})
+		return false
+	}
+	environments.Environments[i].ExpiresAt = time.Now().Add(d).UTC().Format(time.RFC3339)
+	if err := chart.WriteChartMeta(chartID, chartEnvironmentsMeta, environments); err != nil {
+		writeChartMetaError(w, err)
+		return false
+	}
+	return true
+}
+
+// StartEnvironmentExpiry warns about expiring ephemeral environments and
+// tears down the expired ones, in the background.
+func StartEnvironmentExpiry() {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			<-ticker.C
+			sweepChartEnvironments(time.Now())
+		}
+	}()
+}
+
+func sweepChartEnvironments(now time.Time) {
+	chartIDs, err := chart.ListChartRepos()
+	if err != nil {
+		log.Printf("Listing charts for expiring environments failed: %v", err)
+		return
+	}
+
+	for _, chartID := range chartIDs {
+		// Archived charts can't be deployed, so neither torn down.
+		if archived, err := isChartArchived(chartID); err != nil || archived {
+			continue
+		}
+		environments, err := loadChartEnvironments(chartID)
+		if err != nil {
+			log.Printf("Loading environments of chart %s failed: %v", chartID, err)
+			continue
+		}
+		for _, environment := range environments.Environments {
+			expiresAt, err := time.Parse(time.RFC3339, environment.ExpiresAt)
+			switch {
+			case err != nil:
+			case !now.Before(expiresAt):
+				startEnvironmentTeardown(chartID, environment.Name, now)
+			case expiresAt.Sub(now) <= environmentExpiryWarning:
+				warnEnvironmentExpiry(chartID, environment)
+			}
+		}
+	}
+}
+
+// warnEnvironmentExpiry tells the users who deployed to an environment when
+// it expires, once per expiry.
+func warnEnvironmentExpiry(chartID string, environment chartEnvironment) {
+	key := deployLockKey(chartID, environment.Name, "")
+	environmentExpiry.mu.Lock()
+	if environmentExpiry.warned[key] == environment.ExpiresAt {
+		environmentExpiry.mu.Unlock()
+		return
+	}
+	environmentExpiry.warned[key] = environment.ExpiresAt
+	environmentExpiry.mu.Unlock()
+
+	deployments, err := environmentDeployments(chartID, environment.Name)
+	if err != nil {
+		log.Printf("Loading deployments of chart %s failed: %v", chartID, err)
+		return
+	}
+	message := fmt.Sprintf("Environment %s of chart %s expires at %s and will be destroyed; POST /api/chart/%s/environments/%s/extend keeps it longer", environment.Name, chartID, environment.ExpiresAt, chartID, environment.Name)
+	notifyEnvironmentDeployers(chartID, deployments, message)
+}
+
+// startEnvironmentTeardown tears down an expired environment in the
+// background, unless it is already or failed less than
+// environmentTeardownRetry ago.
+func startEnvironmentTeardown(chartID, environment string, now time.Time) {
+	key := deployLockKey(chartID, environment, "")
+	environmentExpiry.mu.Lock()
+	defer environmentExpiry.mu.Unlock()
+	if environmentExpiry.running[key] || now.Before(environmentExpiry.retryAt[key]) {
+		return
+	}
+	environmentExpiry.running[key] = true
+
+	go func() {
+		err := tearDownChartEnvironment(chartID, environment)
+		if err != nil {
+			log.Printf("Tearing down expired environment %s of chart %s failed: %v", environment, chartID, err)
+		}
+
+		environmentExpiry.mu.Lock()
+		defer environmentExpiry.mu.Unlock()
+		delete(environmentExpiry.running, key)
+		if err != nil {
+			environmentExpiry.retryAt[key] = time.Now().Add(environmentTeardownRetry)
+			return
+		}
+		delete(environmentExpiry.retryAt, key)
+		delete(environmentExpiry.warned, key)
+	}()
+}
+
+// tearDownChartEnvironment destroys every module deployed to an expired
+// environment, the last deployed first, each as the user who deployed it,
+// then removes the environment unless it was extended meanwhile.
+func tearDownChartEnvironment(chartID, environment string) error {
+	deployments, err := environmentDeployments(chartID, environment)
+	if err != nil {
+		return err
+	}
+	slices.SortFunc(deployments, func(a, b chartDeployment) int { return strings.Compare(b.DeployedAt, a.DeployedAt) })
+
+	for _, deployment := range deployments {
+		target := cmp.Or(deployment.Stack, "the root module")
+		job, err := startBackgroundDeploy(chartID, deployment.Subject, cmp.Or(deployment.Commit, deployment.Ref), deployment.Stack, deployOptions{Environment: environment, AgentLabels: deployment.AgentLabels, Destroy: true})
+		if err != nil {
+			// Destroys that started notify about their outcome themselves.
+			notifyEnvironmentDeployers(chartID, []chartDeployment{deployment}, fmt.Sprintf("Destroying %s in expired environment %s of chart %s failed: %v", target, environment, chartID, err))
+			return fmt.Errorf("destroy %s: %w", target, err)
+		}
+		<-job.done
+		if status := job.snapshot().Status; status != deploy.StatusSucceeded {
+			return fmt.Errorf("destroy %s ended %s", target, status)
+		}
+	}
+
+	chartEnvironmentsMu.Lock()
+	defer chartEnvironmentsMu.Unlock()
+	environments, err := loadChartEnvironments(chartID)
+	if err != nil {
+		return err
+	}
+	environments.Environments = slices.DeleteFunc(environments.Environments, func(e chartEnvironment) bool {
+		expiresAt, err := time.Parse(time.RFC3339, e.ExpiresAt)
+		return e.Name == environment && err == nil && !time.Now().Before(expiresAt)
+	})
+	return chart.WriteChartMeta(chartID, chartEnvironmentsMeta, environments)
+}
+
+// environmentDeployments returns the modules of the chart deployed to an
+// environment.
+func environmentDeployments(chartID, environment string) ([]chartDeployment, error) {
+	deployments, err := loadChartDeployments(chartID)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(deployments, func(d chartDeployment) bool { return d.Environment != environment }), nil
+}
+
+// notifyEnvironmentDeployers puts message into the inbox of each user who
+// made one of the deployments.
+func notifyEnvironmentDeployers(chartID string, deployments []chartDeployment, message string) {
+	var notified []string
+	for _, deployment := range deployments {
+		if slices.Contains(notified, deployment.Subject) {
+			continue
+		}
+		notified = append(notified, deployment.Subject)
+		if err := user.NotifyUser(deployment.Subject, user.Notification{
+			Event:   user.EventEnvironmentExpiring,
+			Message: message,
+			ChartID: chartID,
+		}); err != nil {
+			log.Printf("Expiry notification for %s failed: %v", deployment.Subject, err)
+			continue
+		}
+		publishChange(watchTopicEvents + deployment.Subject)
+	}
+}
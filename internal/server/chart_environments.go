@@ -0,0 +1,194 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+	"github.com/mtolmacs/planemgr/internal/server/deploy"
+)
+
+const chartEnvironmentsMeta = "environments"
+
+// chartEnvironmentsMu serializes changes to the environments of charts.
+var chartEnvironmentsMu sync.Mutex
+
+type chartEnvironments struct {
+	Environments []chartEnvironment `json:"environments"`
+}
+
+// chartEnvironment is an environment deploys of a chart can target, such as
+// staging or prod. The root module and every stack keep a managed state of
+// their own in it.
+type chartEnvironment struct {
+	Name      string            `json:"name" example:"staging"`
+	Branch    string            `json:"branch,omitempty" example:"main"` // Deployed when the request names no ref
+	Variables map[string]string `json:"variables,omitempty"`             // Passed to tofu as variables
+	// ExpiresAt makes the environment ephemeral: once past, every module
+	// deployed to it is destroyed and the environment removed.
+	ExpiresAt string `json:"expiresAt,omitempty" example:"2026-01-02T15:04:05Z"`
+}
+
+// HandleChartEnvironments handles /api/chart/{id}/environments requests.
+func HandleChartEnvironments(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		HandleChartEnvironmentsGet(w, r)
+	case http.MethodPut:
+		HandleChartEnvironmentsPut(w, r, claims.Subject)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+	}
+}
+
+// HandleChartEnvironmentsGet handles GET /api/chart/{id}/environments requests.
+// @Summary Get chart environments
+// @Description Returns the environments deploys of the chart can target, with their branch and variables.
+// @Tags chart
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Success 200 {object} chartEnvironments
+// @Failure 400 {object} errorResponse "`invalid chart id`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/environments [get]
+func HandleChartEnvironmentsGet(w http.ResponseWriter, r *http.Request) {
+	environments, err := loadChartEnvironments(r.PathValue("id"))
+	if err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, environments)
+}
+
+// HandleChartEnvironmentsPut handles PUT /api/chart/{id}/environments requests.
+// @Summary Set chart environments
+// @Description Replaces the environments deploys of the chart can target. Each keeps the managed state of the root module and the stacks apart from the other environments and from deploys without one, served with ?environment= on the state endpoints. Its variables are passed to tofu, and its branch is deployed when the deploy request names no ref. Environments with expiresAt are ephemeral: the users who deployed to them are warned an hour before, then every module deployed to them is destroyed and they are removed. Removing an environment keeps its state. Once chart admins are set only they can change the environments.
+// @Tags chart
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Param request body chartEnvironments true "Environments"
+// @Success 200 {object} chartEnvironments
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid_request`, `invalid_environment`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/environments [put]
+func HandleChartEnvironmentsPut(w http.ResponseWriter, r *http.Request, subject string) {
+	var req chartEnvironments
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "invalid JSON payload"})
+		return
+	}
+
+	chartID := r.PathValue("id")
+	permissions, err := loadChartPermissions(chartID)
+	if err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+	if len(permissions.Admins) > 0 && !slices.Contains(permissions.Admins, subject) {
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: "forbidden", Message: "only chart admins can change the environments"})
+		return
+	}
+
+	if err := normalizeChartEnvironments(req.Environments); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_environment", Message: err.Error()})
+		return
+	}
+	if req.Environments == nil {
+		req.Environments = []chartEnvironment{}
+	}
+
+	chartEnvironmentsMu.Lock()
+	defer chartEnvironmentsMu.Unlock()
+	if err := chart.WriteChartMeta(chartID, chartEnvironmentsMeta, req); err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, req)
+}
+
+// normalizeChartEnvironments checks environments and trims their names and
+// branches, normalizing their expiry to UTC.
+func normalizeChartEnvironments(environments []chartEnvironment) error {
+	seen := map[string]bool{}
+	for i, environment := range environments {
+		environment.Name = strings.TrimSpace(environment.Name)
+		environment.Branch = strings.TrimPrefix(strings.TrimSpace(environment.Branch), "refs/heads/")
+		if environment.Name == "" || deploy.ValidateEnvironmentName(environment.Name) != nil {
+			return deploy.ErrInvalidEnvironment
+		}
+		if seen[environment.Name] {
+			return errors.New("duplicate environment " + environment.Name)
+		}
+		seen[environment.Name] = true
+		if environment.Branch != "" && chart.ValidateBranchName(environment.Branch) != nil {
+			return errors.New("invalid branch " + environment.Branch)
+		}
+		for name := range environment.Variables {
+			if err := deploy.ValidateVariableName(name); err != nil {
+				return err
+			}
+		}
+		if environment.ExpiresAt != "" {
+			expiresAt, err := time.Parse(time.RFC3339, environment.ExpiresAt)
+			if err != nil {
+				return errors.New("expiresAt of " + environment.Name + " must be an RFC 3339 time")
+			}
+			environment.ExpiresAt = expiresAt.UTC().Format(time.RFC3339)
+		}
+		environments[i] = environment
+	}
+	return nil
+}
+
+func loadChartEnvironments(chartID string) (chartEnvironments, error) {
+	environments := chartEnvironments{Environments: []chartEnvironment{}}
+	if err := chart.ReadChartMeta(chartID, chartEnvironmentsMeta, &environments); err != nil && !errors.Is(err, chart.ErrMetaNotFound) {
+		return chartEnvironments{}, err
+	}
+	return environments, nil
+}
+
+// chartDeployEnvironment returns the environment of the chart a deploy
+// targets, or nil for deploys without one. It writes the error and returns
+// false when the chart has no such environment.
+func chartDeployEnvironment(w http.ResponseWriter, chartID, name string) (*chartEnvironment, bool) {
+	if name == "" {
+		return nil, true
+	}
+	environments, err := loadChartEnvironments(chartID)
+	if err != nil {
+		writeChartMetaError(w, err)
+		return nil, false
+	}
+	i := slices.IndexFunc(environments.Environments, func(environment chartEnvironment) bool { return environment.Name == name })
+	if i < 0 {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "environment_not_found", Message: "the chart has no environment " + name})
+		return nil, false
+	}
+	return &environments.Environments[i], true
+}
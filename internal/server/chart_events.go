@@ -0,0 +1,254 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+)
+
+const (
+	chartEventCommit = "commit"
+	chartEventBranch = "branch"
+	chartEventTag    = "tag"
+	chartEventDeploy = "deploy"
+)
+
+// chartEventBuffer is how many events a stream may fall behind by before it
+// is closed; the client reconnects and reloads the chart.
+const chartEventBuffer = 64
+
+// chartEventHeartbeat is how often an idle stream sends a comment, so proxies
+// don't time it out.
+const chartEventHeartbeat = 15 * time.Second
+
+type chartEvent struct {
+	ID          string   `json:"id" example:"m1x2y3.42"`
+	Type        string   `json:"type" example:"commit"` // commit, branch, tag, deploy or presence
+	ChartID     string   `json:"chartId"`
+	Ref         string   `json:"ref,omitempty" example:"main"` // Branch, tag or deployed ref
+	Commit      string   `json:"commit,omitempty"`
+	Action      string   `json:"action,omitempty" example:"created"` // created, updated, deleted or default on branches and tags, joined, updated or left on presence
+	Message     string   `json:"message,omitempty"`
+	Paths       []string `json:"paths,omitempty"`
+	Stack       string   `json:"stack,omitempty"`
+	Environment string   `json:"environment,omitempty"` // Of deploys
+	Status      string   `json:"status,omitempty"`      // Outcome of deploys
+	Editing     bool     `json:"editing,omitempty"`     // Of presence, whether the user edits the file in paths
+	Subject     string   `json:"subject,omitempty"`
+	Timestamp   string   `json:"timestamp" example:"2026-01-02T15:04:05Z"`
+}
+
+var chartEventStreams = struct {
+	mu      sync.Mutex
+	seq     uint64
+	streams map[string]map[chan chartEvent]struct{}
+}{
+	streams: map[string]map[chan chartEvent]struct{}{},
+}
+
+// publishChartEvent sends event to the streams of its chart. Streams that
+// fell too far behind are closed instead of blocking the publisher.
+func publishChartEvent(event chartEvent) {
+	chartEventStreams.mu.Lock()
+	defer chartEventStreams.mu.Unlock()
+
+	chartEventStreams.seq++
+	event.ID = watchTopics.epoch + "." + strconv.FormatUint(chartEventStreams.seq, 10)
+	event.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	streams := chartEventStreams.streams[event.ChartID]
+	for stream := range streams {
+		select {
+		case stream <- event:
+		default:
+			delete(streams, stream)
+			close(stream)
+		}
+	}
+}
+
+// subscribeChartEvents returns a stream of the events of a chart and the
+// function ending it.
+func subscribeChartEvents(chartID string) (<-chan chartEvent, func()) {
+	chartEventStreams.mu.Lock()
+	defer chartEventStreams.mu.Unlock()
+
+	stream := make(chan chartEvent, chartEventBuffer)
+	streams, ok := chartEventStreams.streams[chartID]
+	if !ok {
+		streams = map[chan chartEvent]struct{}{}
+		chartEventStreams.streams[chartID] = streams
+	}
+	streams[stream] = struct{}{}
+
+	return stream, func() {
+		chartEventStreams.mu.Lock()
+		defer chartEventStreams.mu.Unlock()
+		streams := chartEventStreams.streams[chartID]
+		if _, ok := streams[stream]; ok {
+			delete(streams, stream)
+			close(stream)
+		}
+		if len(streams) == 0 {
+			delete(chartEventStreams.streams, chartID)
+		}
+	}
+}
+
+// publishChartCommitEvent sends a commit event for commit, made on the
+// default branch of the chart.
+func publishChartCommitEvent(chartID, commit, message string, paths []string) {
+	branch, _ := chart.ChartDefaultBranch(chartID)
+	publishChartEvent(chartEvent{
+		Type:    chartEventCommit,
+		ChartID: chartID,
+		Ref:     branch,
+		Commit:  commit,
+		Message: message,
+		Paths:   paths,
+	})
+}
+
+// publishChartRefEvent sends a branch or tag event for a change of name.
+// Other refs are ignored.
+func publishChartRefEvent(chartID string, name plumbing.ReferenceName, commit, action string) {
+	event := chartEvent{ChartID: chartID, Ref: name.Short(), Commit: commit, Action: action}
+	switch {
+	case name.IsBranch():
+		event.Type = chartEventBranch
+	case name.IsTag():
+		event.Type = chartEventTag
+	default:
+		return
+	}
+	publishChartEvent(event)
+}
+
+// publishChartPushEvents sends the events of the ref updates a push made.
+// Updates of the default branch are commits, other updates are branch and
+// tag changes.
+func publishChartPushEvents(chartID string, commands []*packp.Command, status *packp.ReportStatus) {
+	failed := map[plumbing.ReferenceName]bool{}
+	if status != nil {
+		for _, command := range status.CommandStatuses {
+			if command.Error() != nil {
+				failed[command.ReferenceName] = true
+			}
+		}
+	}
+	branch, _ := chart.ChartDefaultBranch(chartID)
+
+	for _, command := range commands {
+		if failed[command.Name] {
+			continue
+		}
+		switch command.Action() {
+		case packp.Create:
+			publishChartRefEvent(chartID, command.Name, command.New.String(), "created")
+		case packp.Delete:
+			publishChartRefEvent(chartID, command.Name, "", "deleted")
+		default:
+			if command.Name == plumbing.NewBranchReferenceName(branch) {
+				publishChartCommitEvent(chartID, command.New.String(), "", nil)
+			} else {
+				publishChartRefEvent(chartID, command.Name, command.New.String(), "updated")
+			}
+		}
+	}
+}
+
+// HandleChartEvents handles GET /api/chart/{id}/events requests.
+// @Summary Stream chart events
+// @Description Streams the events of a chart as server-sent events while the connection is open: commits to the default branch, created, moved, deleted and default branches, tags, finished deploys, and the presence of collaborators: a user joins with the stream, path and editing give the file they are viewing or editing, PUT /api/chart/{id}/presence changes it, and they leave once their last stream closed. Each event is named by its type and carries its JSON in the data field. Clients that fall behind are disconnected and should reload the chart after reconnecting; events are not replayed.
+// @Tags chart
+// @Security BearerAuth
+// @Produce text/event-stream
+// @Param id path string true "Chart ID"
+// @Param path query string false "Chart file the user is on"
+// @Param editing query bool false "The user is editing the file rather than viewing it"
+// @Success 200 {object} chartEvent
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid_request`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart not found`"
+// @Router /chart/{id}/events [get]
+func HandleChartEvents(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	presence, err := parseChartPresenceQuery(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	chartID := r.PathValue("id")
+	if _, err := chart.ReadChartHead(chartID); errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart not found"})
+		return
+	}
+
+	// Streams outlive any write timeout of the server.
+	controller := http.NewResponseController(w)
+	_ = controller.SetWriteDeadline(time.Time{})
+
+	events, unsubscribe := subscribeChartEvents(chartID)
+	defer unsubscribe()
+	leave := joinChartPresence(chartID, claims.Subject, presence)
+	defer leave()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprint(w, ": connected\n\n"); err != nil {
+		return
+	}
+	if err := controller.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(chartEventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+	"github.com/mtolmacs/planemgr/internal/server/deploy"
+)
+
+const (
+	chartExportFormat       = "planemgr-export/v1"
+	chartExportConfigDir    = "config"
+	chartExportManifestFile = "manifest.json"
+
+	// maxChartImportBytes caps the export bundle an import accepts.
+	maxChartImportBytes = 256 << 20
+)
+
+var ErrInvalidChartExport = errors.New("invalid chart export bundle")
+
+// chartExportManifest describes an export bundle. Workspaces map to Terraform
+// Cloud workspaces or Spacelift stacks, with the working directory relative
+// to the bundle root.
+type chartExportManifest struct {
+	Format       string                 `json:"format"`
+	ChartID      string                 `json:"chartId"`
+	Ref          string                 `json:"ref"`
+	ExportedAt   string                 `json:"exportedAt"`
+	Workspaces   []chartExportWorkspace `json:"workspaces"`
+	Environments []chartEnvironment     `json:"environments"`
+	Budget       *chartBudget           `json:"budget,omitempty"`
+	Tags         []chartTag             `json:"tags"`
+	Deployments  []chartDeployment      `json:"deployments"`
+	History      []chartHistoryCommit   `json:"history"`
+}
+
+type chartExportWorkspace struct {
+	Name             string `json:"name"`
+	WorkingDirectory string `json:"workingDirectory"`
+	Environment      string `json:"environment,omitempty"`
+	// State is the address of the http backend serving the state the server
+	// manages for the workspace, unless its module configures a backend.
+	State string `json:"state,omitempty"`
+}
+
+// Handle GET /api/chart/{id}/export requests.
+// @Summary Export chart bundle
+// @Description Streams a portable bundle of a chart for migrating to other orchestrators: the chart files at a ref under "config/" and a manifest.json with workspaces, environments with their variables, budget, tags, deploy records and commit history. Workspaces using the state the server manages carry the address of its http backend, on PUBLIC_URL when set. POST /api/chart/import creates a chart from a bundle.
+// @Tags chart
+// @Security BearerAuth
+// @Produce application/gzip
+// @Produce application/zip
+// @Param id path string true "Chart ID"
+// @Param ref query string false "Git ref (defaults to HEAD)"
+// @Param format query string false "Archive format: tar.gz (default) or zip"
+// @Success 200 {file} file
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid archive format`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart not found`, `chart ref not found`"
+// @Failure 500 {object} errorResponse "`failed to export chart`"
+// @Router /chart/{id}/export [get]
+func HandleChartExport(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.RequireAccessTokenClaims(r); err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = chart.ArchiveTarGz
+	}
+	contentType, ok := archiveContentTypes[format]
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid archive format"})
+		return
+	}
+
+	archive, err := openChartExport(r.PathValue("id"), r.URL.Query().Get("ref"), publicBaseURL(r))
+	if err != nil {
+		writeChartExportError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", strings.TrimSuffix(archive.Prefix, "/"+chartExportConfigDir+"/")+"."+format))
+	w.Header().Set("X-Chart-Ref", archive.Ref)
+	w.WriteHeader(http.StatusOK)
+
+	// Headers are sent, so a failure can only cut the stream short.
+	_ = archive.Write(w, format)
+}
+
+// openChartExport prepares the export bundle of a chart at ref, with the
+// managed state of its workspaces addressed on baseURL.
+func openChartExport(chartID, ref, baseURL string) (*chart.Archive, error) {
+	archive, err := chart.OpenChartArchive(chartID, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := chartExport(chartID, archive.Ref, baseURL)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	root := chartID + "-export-" + archive.Ref[:7] + "/"
+	archive.Prefix = root + chartExportConfigDir + "/"
+	archive.Extra = map[string][]byte{root + chartExportManifestFile: append(data, '\n')}
+	return archive, nil
+}
+
+func chartExport(chartID, ref, baseURL string) (chartExportManifest, error) {
+	manifest := chartExportManifest{
+		Format:     chartExportFormat,
+		ChartID:    chartID,
+		Ref:        ref,
+		ExportedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	environments, err := loadChartEnvironments(chartID)
+	if err != nil {
+		return manifest, err
+	}
+	manifest.Environments = environments.Environments
+
+	budget, err := loadChartBudget(chartID)
+	if err != nil {
+		return manifest, err
+	}
+	if budget.Enabled() {
+		exported := chartBudget(budget)
+		manifest.Budget = &exported
+	}
+
+	tags, err := chart.ListChartTags(chartID)
+	if err != nil {
+		return manifest, err
+	}
+	manifest.Tags = make([]chartTag, 0, len(tags))
+	for _, tag := range tags {
+		manifest.Tags = append(manifest.Tags, newChartTag(tag))
+	}
+
+	manifest.Deployments, err = loadChartDeployments(chartID)
+	if err != nil {
+		return manifest, err
+	}
+	// The root module gets a workspace in every environment, and every
+	// stack one in each environment it was deployed to.
+	modules := [][2]string{{"", ""}}
+	for _, environment := range manifest.Environments {
+		modules = append(modules, [2]string{"", environment.Name})
+	}
+	for _, deployment := range manifest.Deployments {
+		modules = append(modules, [2]string{deployment.Stack, deployment.Environment})
+	}
+	seen := map[[2]string]bool{}
+	for _, module := range modules {
+		if seen[module] {
+			continue
+		}
+		seen[module] = true
+		workspace, err := chartExportWorkspaceOf(chartID, ref, baseURL, module[0], module[1])
+		if err != nil {
+			return manifest, err
+		}
+		manifest.Workspaces = append(manifest.Workspaces, workspace)
+	}
+
+	_, commits, _, err := chart.ListChartHistory(chartID, ref, 0, math.MaxInt)
+	if err != nil {
+		return manifest, err
+	}
+	manifest.History = make([]chartHistoryCommit, 0, len(commits))
+	for _, commit := range commits {
+		manifest.History = append(manifest.History, chartHistoryCommit{
+			Hash:        commit.Hash,
+			Message:     commit.Message,
+			AuthorName:  commit.AuthorName,
+			AuthorEmail: commit.AuthorEmail,
+			Timestamp:   commit.When.UTC().Format(time.RFC3339),
+			Paths:       commit.Paths,
+		})
+	}
+
+	return manifest, nil
+}
+
+// chartExportWorkspaceOf returns the workspace of a stack, the root module
+// when empty, in an environment.
+func chartExportWorkspaceOf(chartID, ref, baseURL, stack, environment string) (chartExportWorkspace, error) {
+	workspace := chartExportWorkspace{Name: chartID, WorkingDirectory: chartExportConfigDir, Environment: environment}
+	if stack != "" {
+		workspace.Name += "-" + stack
+		workspace.WorkingDirectory += "/" + stack
+	}
+	if environment != "" {
+		workspace.Name += "-" + environment
+	}
+
+	declared, err := chart.ChartDeclaresBackend(chartID, ref, stack)
+	if err != nil || declared {
+		return workspace, err
+	}
+	address := baseURL + "/api/chart/" + chartID + "/state"
+	if stack != "" {
+		address = baseURL + "/api/chart/" + chartID + "/stack/" + url.PathEscape(stack) + "/state"
+	}
+	if environment != "" {
+		address += "?" + url.Values{"environment": {environment}}.Encode()
+	}
+	workspace.State = address
+	return workspace, nil
+}
+
+// Handle POST /api/chart/import requests.
+// @Summary Import chart bundle
+// @Description Creates a chart from an export bundle, of this or another instance: the files under "config/" are committed at once, and the environments with their variables and the budget of the manifest restored. Tags, deploy records and history only describe the exported chart and are not imported, and neither is state.
+// @Tags chart
+// @Security BearerAuth
+// @Accept application/gzip
+// @Accept application/zip
+// @Param format query string false "Archive format: tar.gz (default) or zip"
+// @Param bundle body string true "Export bundle"
+// @Success 201 {object} chartResponse
+// @Failure 400 {object} errorResponse "`invalid archive format`, `invalid export bundle`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 500 {object} errorResponse "`failed to import chart`"
+// @Router /chart/import [post]
+func HandleChartImport(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.RequireAccessTokenClaims(r); err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = chart.ArchiveTarGz
+	}
+	if _, ok := archiveContentTypes[format]; !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid archive format"})
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxChartImportBytes))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid export bundle", "message": err.Error()})
+		return
+	}
+
+	chartID, err := importChartExport(data, format)
+	switch {
+	case errors.Is(err, ErrInvalidChartExport):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid export bundle", "message": err.Error()})
+		return
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to import chart"})
+		return
+	}
+	publishChartChange(chartID)
+
+	writeJSON(w, http.StatusCreated, chartResponse{ChartID: chartID})
+}
+
+// importChartExport creates a chart from an export bundle and returns its
+// ID. The bundle is checked before the chart is created.
+func importChartExport(data []byte, format string) (string, error) {
+	files, err := chart.ReadArchiveFiles(data, format)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidChartExport, err)
+	}
+
+	var manifestName string
+	for name := range files {
+		if path.Base(name) == chartExportManifestFile && path.Dir(name) != "." && !strings.Contains(path.Dir(name), "/") {
+			if manifestName != "" {
+				return "", fmt.Errorf("%w: more than one %s", ErrInvalidChartExport, chartExportManifestFile)
+			}
+			manifestName = name
+		}
+	}
+	if manifestName == "" {
+		return "", fmt.Errorf("%w: no %s", ErrInvalidChartExport, chartExportManifestFile)
+	}
+	var manifest chartExportManifest
+	if err := json.Unmarshal(files[manifestName], &manifest); err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrInvalidChartExport, chartExportManifestFile, err)
+	}
+	if manifest.Format != chartExportFormat {
+		return "", fmt.Errorf("%w: unsupported format %q", ErrInvalidChartExport, manifest.Format)
+	}
+	if err := normalizeChartEnvironments(manifest.Environments); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidChartExport, err)
+	}
+	if manifest.Environments == nil {
+		manifest.Environments = []chartEnvironment{}
+	}
+	var budget deploy.Budget
+	if manifest.Budget != nil {
+		budget = deploy.Budget(*manifest.Budget)
+		if err := budget.Validate(); err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidChartExport, err)
+		}
+	}
+
+	configDir := path.Join(path.Dir(manifestName), chartExportConfigDir) + "/"
+	var updates []chart.FileUpdate
+	for name, contents := range files {
+		if rel, ok := strings.CutPrefix(name, configDir); ok {
+			updates = append(updates, chart.FileUpdate{Path: rel, Content: string(contents)})
+		}
+	}
+	sort.Slice(updates, func(i, j int) bool { return updates[i].Path < updates[j].Path })
+
+	chartID, err := chart.CreateChartRepo()
+	if err != nil {
+		return "", err
+	}
+	if len(updates) > 0 {
+		message := "Import of chart " + manifest.ChartID
+		if len(manifest.Ref) >= 7 {
+			message += " at " + manifest.Ref[:7]
+		}
+		if _, err := chart.WriteChartFiles(chartID, updates, message, ""); err != nil {
+			return "", err
+		}
+	}
+	if err := chart.WriteChartMeta(chartID, chartEnvironmentsMeta, chartEnvironments{Environments: manifest.Environments}); err != nil {
+		return "", err
+	}
+	if budget.Enabled() {
+		if err := chart.WriteChartMeta(chartID, chartBudgetMeta, budget); err != nil {
+			return "", err
+		}
+	}
+	return chartID, nil
+}
+
+func writeChartExportError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart not found"})
+	case errors.Is(err, plumbing.ErrReferenceNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart ref not found"})
+	default:
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to export chart"})
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+)
+
+func TestChartExportRoundTrip(t *testing.T) {
+	t.Setenv("WORKDIR", t.TempDir())
+	t.Setenv("SECURE_STORE", t.TempDir())
+
+	chartID, err := chart.CreateChartRepo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []chart.FileUpdate{
+		{Path: "main.tf", Content: "variable \"region\" {}\n"},
+		{Path: "modules/network/main.tf", Content: "resource \"null_resource\" \"network\" {}\n"},
+	}
+	if _, err := chart.WriteChartFiles(chartID, files, "Initial commit", ""); err != nil {
+		t.Fatal(err)
+	}
+	environments := chartEnvironments{Environments: []chartEnvironment{
+		{Name: "staging", Branch: "main", Variables: map[string]string{"region": "eu-west-1"}},
+		{Name: "prod", Variables: map[string]string{"region": "us-east-1", "replicas": "3"}},
+	}}
+	if err := chart.WriteChartMeta(chartID, chartEnvironmentsMeta, environments); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{chart.ArchiveTarGz, chart.ArchiveZip} {
+		t.Run(format, func(t *testing.T) {
+			archive, err := openChartExport(chartID, "", "https://planemgr.example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var bundle bytes.Buffer
+			if err := archive.Write(&bundle, format); err != nil {
+				t.Fatal(err)
+			}
+
+			exported, err := chart.ReadArchiveFiles(bundle.Bytes(), format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var manifest chartExportManifest
+			if err := json.Unmarshal(exported[path.Join(path.Dir(path.Dir(archive.Prefix)), chartExportManifestFile)], &manifest); err != nil {
+				t.Fatal(err)
+			}
+			states := map[string]string{}
+			for _, workspace := range manifest.Workspaces {
+				states[workspace.Environment] = workspace.State
+			}
+			base := "https://planemgr.example.com/api/chart/" + chartID + "/state"
+			want := map[string]string{"": base, "staging": base + "?environment=staging", "prod": base + "?environment=prod"}
+			if !reflect.DeepEqual(states, want) {
+				t.Errorf("workspace states = %v, want %v", states, want)
+			}
+
+			imported, err := importChartExport(bundle.Bytes(), format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if imported == chartID {
+				t.Fatal("import reused the exported chart ID")
+			}
+			got, err := loadChartEnvironments(imported)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, environments) {
+				t.Errorf("imported environments = %+v, want %+v", got, environments)
+			}
+			_, contents, missing, err := chart.ReadChartFiles(imported, []string{files[0].Path, files[1].Path}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(missing) > 0 {
+				t.Fatalf("imported chart lacks %v", missing)
+			}
+			for i, file := range contents {
+				if file.Contents != files[i].Content {
+					t.Errorf("imported %s = %q, want %q", file.Path, file.Contents, files[i].Content)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+)
+
+const maxChartFilesPaths = 100
+
+type chartFilesRequest struct {
+	Paths []string `json:"paths" example:"main.tf.json,variables.tf.json"`
+}
+
+type chartFilesEntry struct {
+	Path     string `json:"path"`
+	Hash     string `json:"hash"` // Blob hash
+	Contents string `json:"contents"`
+	Encoding string `json:"encoding,omitempty" enums:"base64"`
+}
+
+type chartFilesResponse struct {
+	ChartID string            `json:"chartId"`
+	Ref     string            `json:"ref"`
+	Files   []chartFilesEntry `json:"files"`
+	Missing []string          `json:"missing"` // Requested paths that aren't files at ref
+}
+
+// Handle GET and POST /api/chart/{id}/files and POST /api/chart/{id}/files:read
+// requests.
+// @Summary Get several chart files
+// @Description Returns the contents of several files read from the same commit in one response. GET takes a comma separated paths query parameter; POST, also served at files:read, takes the path list in the body, for paths containing commas or long lists. Paths that aren't files at the ref are listed under missing. Contents are base64 encoded, with encoding set to "base64", when asked for or when a file isn't valid UTF-8.
+// @Tags chart
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Param paths query string false "Comma separated file paths, for GET"
+// @Param ref query string false "Git ref (defaults to HEAD)"
+// @Param at query string false "RFC 3339 timestamp; resolves ref to the commit it pointed to at that time"
+// @Param encoding query string false "Set to base64 to always get base64 encoded contents" Enums(base64)
+// @Param request body chartFilesRequest false "File paths, for POST"
+// @Success 200 {object} chartFilesResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid request body`, `paths required`, `too many paths`, `unsupported encoding`, `at must be an RFC 3339 timestamp`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart not found`, `chart ref not found`, `no chart commit at that time`"
+// @Failure 500 {object} errorResponse "`failed to read chart files`, `failed to resolve chart ref`"
+// @Router /chart/{id}/files [get]
+// @Router /chart/{id}/files [post]
+// @Router /chart/{id}/files:read [post]
+func HandleChartFiles(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.RequireAccessTokenClaims(r); err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+
+	var paths []string
+	switch r.Method {
+	case http.MethodGet:
+		if query := r.URL.Query().Get("paths"); query != "" {
+			paths = strings.Split(query, ",")
+		}
+	case http.MethodPost:
+		var req chartFilesRequest
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+		paths = req.Paths
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	unique := make([]string, 0, len(paths))
+	for _, filePath := range paths {
+		if filePath != "" && !slices.Contains(unique, filePath) {
+			unique = append(unique, filePath)
+		}
+	}
+	if len(unique) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "paths required"})
+		return
+	}
+	if len(unique) > maxChartFilesPaths {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "too many paths"})
+		return
+	}
+	encoding := r.URL.Query().Get("encoding")
+	if encoding != "" && encoding != chartEncodingBase64 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported encoding"})
+		return
+	}
+
+	chartID := r.PathValue("id")
+	ref, ok := chartQueryRef(w, r, chartID, "ref", "at")
+	if !ok {
+		return
+	}
+	resolvedRef, files, missing, err := chart.ReadChartFiles(chartID, unique, ref)
+	if err != nil {
+		if errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart not found"})
+			return
+		}
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart ref not found"})
+			return
+		}
+
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read chart files"})
+		return
+	}
+
+	response := chartFilesResponse{
+		ChartID: chartID,
+		Ref:     resolvedRef,
+		Files:   make([]chartFilesEntry, 0, len(files)),
+		Missing: missing,
+	}
+	for _, file := range files {
+		contents, fileEncoding := encodeChartFileContents(file.Contents, encoding)
+		response.Files = append(response.Files, chartFilesEntry{
+			Path:     file.Path,
+			Hash:     file.Hash,
+			Contents: contents,
+			Encoding: fileEncoding,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
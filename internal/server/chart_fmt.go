@@ -0,0 +1,101 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+)
+
+type chartFmtRequest struct {
+	Paths   []string `json:"paths,omitempty" example:"main.tf,variables.tf"` // Defaults to every .tf and .tfvars file
+	Message string   `json:"message,omitempty" example:"Format HCL files"`   // Defaults to "Format HCL files"
+}
+
+// Handle POST /api/chart/{id}/fmt requests.
+// @Summary Format HCL chart files
+// @Description Rewrites HCL files (.tf and .tfvars) of the chart in the canonical style `tofu fmt` uses and commits the files that changed. Every HCL file is formatted unless paths are given. Files with syntax errors fail the request with 422 and nothing is committed. Without changes no commit is made and ref is the current commit.
+// @Tags chart
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Param request body chartFmtRequest false "Files to format"
+// @Success 200 {object} chartCommitResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid request body`, `invalid chart file path`, `not an HCL configuration file`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart not found`, `chart file not found`, `chart_not_found`"
+// @Failure 409 {object} errorResponse "`chart changed concurrently, retry`"
+// @Failure 422 {object} errorResponse "`invalid HCL configuration`, `commit rejected by policy`"
+// @Failure 423 {object} errorResponse "`chart_locked`"
+// @Failure 500 {object} errorResponse "`failed to format chart files`, `chart_settings_failed`"
+// @Router /chart/{id}/fmt [post]
+func HandleChartFmt(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	var req chartFmtRequest
+	if r.ContentLength != 0 {
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+	}
+	message := strings.TrimSpace(req.Message)
+	if message == "" {
+		message = "Format HCL files"
+	}
+
+	chartID := r.PathValue("id")
+	if !requireChartUnlocked(w, chartID, claims.Subject) {
+		return
+	}
+	commitRef, files, err := chart.FormatChartFiles(chartID, req.Paths, message)
+	if err != nil {
+		if writeCommitPolicyError(w, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, chart.ErrInvalidPath) || errors.Is(err, chart.ErrNotHCL):
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		case errors.Is(err, chart.ErrInvalidHCL):
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		case errors.Is(err, chart.ErrHistoryChanged):
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "chart changed concurrently, retry"})
+		case errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart not found"})
+		case errors.Is(err, object.ErrFileNotFound) || errors.Is(err, object.ErrDirectoryNotFound):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart file not found"})
+		default:
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to format chart files"})
+		}
+		return
+	}
+
+	if len(files) > 0 {
+		notifyChartCommit(chartID, commitRef, message, files)
+	}
+
+	writeJSON(w, http.StatusOK, chartCommitResponse{
+		ChartID: chartID,
+		Ref:     commitRef,
+		Files:   files,
+	})
+}
@@ -0,0 +1,409 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/sideband"
+	"github.com/go-git/go-git/v5/plumbing/revlist"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	gitsrv "github.com/go-git/go-git/v5/plumbing/transport/server"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+)
+
+// Git protocol v2 is negotiated through the Git-Protocol header and is only
+// served for fetches; pushes keep using protocol v0.
+
+const (
+	pktData = iota
+	pktFlush
+	pktDelim
+)
+
+var errGitV2Request = errors.New("invalid protocol v2 request")
+
+func gitProtocolV2(r *http.Request) bool {
+	for _, param := range strings.Split(r.Header.Get("Git-Protocol"), ":") {
+		if strings.TrimSpace(param) == "version=2" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeChartGitV2Capabilities answers info/refs for protocol v2 clients.
+func writeChartGitV2Capabilities(w http.ResponseWriter, chartID string) {
+	if _, err := chartGitStorer(chartID); err != nil {
+		handleChartGitSessionError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	_ = writePkts(w,
+		"# service=git-upload-pack\n", "",
+		"version 2\n",
+		"agent="+capability.DefaultAgent()+"\n",
+		"ls-refs\n",
+		"fetch\n",
+		"object-format=sha1\n", "")
+}
+
+// handleChartGitV2Command serves a protocol v2 command sent to upload-pack.
+func handleChartGitV2Command(w http.ResponseWriter, r *http.Request, chartID string) {
+	st, err := chartGitStorer(chartID)
+	if err != nil {
+		handleChartGitSessionError(w, err)
+		return
+	}
+
+	command, args, err := readGitV2Command(bufio.NewReader(r.Body))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid upload-pack request"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-git-upload-pack-result")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	switch command {
+	case "ls-refs":
+		err = gitV2LsRefs(w, st, args)
+	case "fetch":
+		err = gitV2Fetch(w, st, chartID, args)
+	default:
+		err = fmt.Errorf("unknown command %q", command)
+	}
+	if err != nil {
+		_ = writePkts(w, "ERR "+err.Error()+"\n")
+	}
+}
+
+func gitV2LsRefs(w io.Writer, st storer.Storer, args []string) error {
+	var (
+		symrefs  bool
+		peel     bool
+		prefixes []string
+	)
+	for _, arg := range args {
+		switch {
+		case arg == "symrefs":
+			symrefs = true
+		case arg == "peel":
+			peel = true
+		case strings.HasPrefix(arg, "ref-prefix "):
+			prefixes = append(prefixes, strings.TrimPrefix(arg, "ref-prefix "))
+		default:
+			return fmt.Errorf("unsupported ls-refs argument %q", arg)
+		}
+	}
+	matches := func(name plumbing.ReferenceName) bool {
+		if len(prefixes) == 0 {
+			return true
+		}
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(name.String(), prefix) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var lines []string
+	if head, err := st.Reference(plumbing.HEAD); err == nil && matches(plumbing.HEAD) {
+		if resolved, err := storer.ResolveReference(st, plumbing.HEAD); err == nil {
+			line := resolved.Hash().String() + " HEAD"
+			if symrefs && head.Type() == plumbing.SymbolicReference {
+				line += " symref-target:" + head.Target().String()
+			}
+			lines = append(lines, line+"\n")
+		}
+	}
+
+	iter, err := st.IterReferences()
+	if err != nil {
+		return err
+	}
+	var refs []*plumbing.Reference
+	if err := iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference && ref.Name() != plumbing.HEAD && matches(ref.Name()) {
+			refs = append(refs, ref)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Name() < refs[j].Name() })
+
+	for _, ref := range refs {
+		line := ref.Hash().String() + " " + ref.Name().String()
+		if peel && ref.Name().IsTag() {
+			if target, ok := peelTag(st, ref.Hash()); ok {
+				line += " peeled:" + target.String()
+			}
+		}
+		lines = append(lines, line+"\n")
+	}
+
+	return writePkts(w, append(lines, "")...)
+}
+
+func gitV2Fetch(w io.Writer, st storer.Storer, chartID string, args []string) error {
+	var (
+		wants      []plumbing.Hash
+		haves      []plumbing.Hash
+		done       bool
+		includeTag bool
+		ofsDelta   bool
+	)
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "want "):
+			hash := plumbing.NewHash(strings.TrimPrefix(arg, "want "))
+			if st.HasEncodedObject(hash) != nil {
+				return fmt.Errorf("upload-pack: not our ref %s", hash)
+			}
+			wants = append(wants, hash)
+		case strings.HasPrefix(arg, "have "):
+			hash := plumbing.NewHash(strings.TrimPrefix(arg, "have "))
+			if st.HasEncodedObject(hash) == nil {
+				haves = append(haves, hash)
+			}
+		case arg == "done":
+			done = true
+		case arg == "include-tag":
+			includeTag = true
+		case arg == "ofs-delta":
+			ofsDelta = true
+		case arg == "thin-pack", arg == "no-progress":
+		default:
+			return fmt.Errorf("unsupported fetch argument %q", arg)
+		}
+	}
+	if len(wants) == 0 {
+		return errors.New("fetch requires at least one want")
+	}
+
+	// Clones, like the runner checkout of every deploy, ask for the same
+	// objects each time, so their packs are cached.
+	var fingerprint, cacheKey string
+	var pack []byte
+	if len(haves) == 0 && chartPacks().enabled() {
+		var err error
+		fingerprint, err = refsFingerprint(st)
+		if err != nil {
+			return err
+		}
+		cacheKey = packCacheKey(wants, includeTag, ofsDelta)
+		pack, _ = chartPacks().get(chartID, fingerprint, cacheKey)
+	}
+
+	var objects []plumbing.Hash
+	if pack == nil {
+		common, err := revlist.Objects(st, haves, nil)
+		if err != nil {
+			return err
+		}
+		objects, err = revlist.Objects(st, wants, common)
+		if err != nil {
+			return err
+		}
+		if includeTag {
+			objects, err = withIncludedTags(st, objects)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if pack == nil && cacheKey != "" {
+		var buf bytes.Buffer
+		if _, err := packfile.NewEncoder(&buf, st, !ofsDelta).Encode(objects, 10); err != nil {
+			return err
+		}
+		pack = buf.Bytes()
+		chartPacks().put(chartID, fingerprint, cacheKey, pack)
+	}
+
+	// The whole pack is always sent in the first round, so the server is
+	// ready as soon as the client stops negotiating.
+	if !done {
+		lines := []string{"acknowledgments\n"}
+		for _, have := range haves {
+			lines = append(lines, "ACK "+have.String()+"\n")
+		}
+		if len(haves) == 0 {
+			lines = append(lines, "NAK\n")
+		}
+		lines = append(lines, "ready\n")
+		if err := writePkts(w, lines...); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, "0001"); err != nil {
+			return err
+		}
+	}
+
+	if err := writePkts(w, "packfile\n"); err != nil {
+		return err
+	}
+	mux := sideband.NewMuxer(sideband.Sideband64k, w)
+	if pack != nil {
+		if _, err := mux.Write(pack); err != nil {
+			return err
+		}
+	} else if _, err := packfile.NewEncoder(mux, st, !ofsDelta).Encode(objects, 10); err != nil {
+		return err
+	}
+
+	return writePkts(w, "")
+}
+
+// packCacheKey identifies the pack for a set of wants and the options that
+// change its contents.
+func packCacheKey(wants []plumbing.Hash, includeTag, ofsDelta bool) string {
+	keys := make([]string, 0, len(wants))
+	for _, want := range wants {
+		keys = append(keys, want.String())
+	}
+	slices.Sort(keys)
+	return fmt.Sprintf("%s include-tag=%t ofs-delta=%t", strings.Join(slices.Compact(keys), ","), includeTag, ofsDelta)
+}
+
+// withIncludedTags adds the annotated tags pointing at objects being sent.
+func withIncludedTags(st storer.Storer, objects []plumbing.Hash) ([]plumbing.Hash, error) {
+	sending := make(map[plumbing.Hash]bool, len(objects))
+	for _, hash := range objects {
+		sending[hash] = true
+	}
+
+	iter, err := st.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if !ref.Name().IsTag() || sending[ref.Hash()] {
+			return nil
+		}
+		tag, err := object.GetTag(st, ref.Hash())
+		if err != nil {
+			return nil
+		}
+		if sending[tag.Target] {
+			sending[ref.Hash()] = true
+			objects = append(objects, ref.Hash())
+		}
+		return nil
+	})
+	return objects, err
+}
+
+func peelTag(st storer.EncodedObjectStorer, hash plumbing.Hash) (plumbing.Hash, bool) {
+	peeled := false
+	for {
+		tag, err := object.GetTag(st, hash)
+		if err != nil {
+			return hash, peeled
+		}
+		hash, peeled = tag.Target, true
+	}
+}
+
+// readGitV2Command reads a command request: the command and capability
+// lines, an optional delimiter followed by arguments, and a flush.
+func readGitV2Command(r *bufio.Reader) (string, []string, error) {
+	var (
+		command string
+		args    []string
+		inArgs  bool
+	)
+	for {
+		line, kind, err := readPkt(r)
+		if err != nil {
+			return "", nil, err
+		}
+		switch kind {
+		case pktFlush:
+			if command == "" {
+				return "", nil, errGitV2Request
+			}
+			return command, args, nil
+		case pktDelim:
+			if inArgs {
+				return "", nil, errGitV2Request
+			}
+			inArgs = true
+		default:
+			line = strings.TrimSuffix(line, "\n")
+			if inArgs {
+				args = append(args, line)
+			} else if name, ok := strings.CutPrefix(line, "command="); ok {
+				command = name
+			}
+		}
+	}
+}
+
+func readPkt(r *bufio.Reader) (string, int, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return "", 0, err
+	}
+	length, err := strconv.ParseUint(string(size[:]), 16, 16)
+	if err != nil {
+		return "", 0, errGitV2Request
+	}
+	switch {
+	case length == 0:
+		return "", pktFlush, nil
+	case length == 1:
+		return "", pktDelim, nil
+	case length < 4:
+		return "", 0, errGitV2Request
+	}
+
+	payload := make([]byte, length-4)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return "", 0, err
+	}
+	return string(payload), pktData, nil
+}
+
+// writePkts writes each line as a pkt-line; empty lines are written as flush
+// packets.
+func writePkts(w io.Writer, lines ...string) error {
+	for _, line := range lines {
+		var err error
+		if line == "" {
+			_, err = io.WriteString(w, "0000")
+		} else {
+			_, err = fmt.Fprintf(w, "%04x%s", len(line)+4, line)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func chartGitStorer(chartID string) (storer.Storer, error) {
+	loader := gitsrv.NewFilesystemLoader(osfs.New(chart.ChartWorkdir() + "/" + chartID))
+	return loader.Load(&transport.Endpoint{})
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+)
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
+type chartHistoryCommit struct {
+	Hash        string   `json:"hash"`
+	Message     string   `json:"message"`
+	AuthorName  string   `json:"authorName"`
+	AuthorEmail string   `json:"authorEmail"`
+	Timestamp   string   `json:"timestamp"`
+	Paths       []string `json:"paths"`
+}
+
+type chartHistoryResponse struct {
+	ChartID    string               `json:"chartId"`
+	Ref        string               `json:"ref"`
+	Offset     int                  `json:"offset"`
+	Limit      int                  `json:"limit"`
+	NextOffset *int                 `json:"nextOffset,omitempty"`
+	Commits    []chartHistoryCommit `json:"commits"`
+}
+
+// Handle GET /api/chart/{id}/history requests.
+// @Summary List chart history
+// @Description Returns the commits reachable from a ref, newest first, with the paths each commit changed.
+// @Tags chart
+// @Security BearerAuth
+// @Param id path string true "Chart ID"
+// @Param ref query string false "Git ref (defaults to HEAD)"
+// @Param offset query int false "Number of commits to skip"
+// @Param limit query int false "Maximum number of commits (default 50, max 200)"
+// @Param fields query string false "Comma-separated commit fields to return, such as hash,timestamp"
+// @Success 200 {object} chartHistoryResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid pagination`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart not found`, `chart ref not found`"
+// @Failure 500 {object} errorResponse "`failed to read chart history`"
+// @Router /chart/{id}/history [get]
+func HandleChartHistory(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.RequireAccessTokenClaims(r); err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	chartID := r.PathValue("id")
+	offset, limit, ok := paginationParams(r, defaultHistoryLimit, maxHistoryLimit)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid pagination"})
+		return
+	}
+
+	resolvedRef, commits, more, err := chart.ListChartHistory(chartID, r.URL.Query().Get("ref"), offset, limit)
+	if err != nil {
+		if errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart not found"})
+			return
+		}
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart ref not found"})
+			return
+		}
+
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read chart history"})
+		return
+	}
+
+	response := chartHistoryResponse{
+		ChartID: chartID,
+		Ref:     resolvedRef,
+		Offset:  offset,
+		Limit:   limit,
+		Commits: make([]chartHistoryCommit, 0, len(commits)),
+	}
+	if more {
+		next := offset + len(commits)
+		response.NextOffset = &next
+	}
+	for _, commit := range commits {
+		response.Commits = append(response.Commits, chartHistoryCommit{
+			Hash:        commit.Hash,
+			Message:     commit.Message,
+			AuthorName:  commit.AuthorName,
+			AuthorEmail: commit.AuthorEmail,
+			Timestamp:   commit.When.UTC().Format(time.RFC3339),
+			Paths:       commit.Paths,
+		})
+	}
+
+	writeJSONFields(w, r, http.StatusOK, response, "commits")
+}
+
+// chartQueryRef returns the ref query parameter named refParam. When the
+// atParam parameter holds an RFC 3339 timestamp, the commit that ref pointed
+// to at that time is returned instead. Errors are written to w and reported
+// by the boolean result being false.
+func chartQueryRef(w http.ResponseWriter, r *http.Request, chartID, refParam, atParam string) (string, bool) {
+	ref := r.URL.Query().Get(refParam)
+	at := r.URL.Query().Get(atParam)
+	if at == "" {
+		return ref, true
+	}
+	when, err := time.Parse(time.RFC3339, at)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": atParam + " must be an RFC 3339 timestamp"})
+		return "", false
+	}
+
+	resolved, err := chart.ResolveChartRefAt(chartID, ref, when)
+	if err != nil {
+		switch {
+		case errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart not found"})
+		case errors.Is(err, plumbing.ErrReferenceNotFound):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart ref not found"})
+		case errors.Is(err, chart.ErrNoCommitAt):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "no chart commit at that time"})
+		default:
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to resolve chart ref"})
+		}
+		return "", false
+	}
+	return resolved, true
+}
+
+// paginationParams reads offset and limit query parameters, applying the
+// default limit and capping it at max.
+func paginationParams(r *http.Request, defaultLimit, max int) (int, int, bool) {
+	offset, limit := 0, defaultLimit
+	if value := r.URL.Query().Get("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return 0, 0, false
+		}
+		offset = parsed
+	}
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return 0, 0, false
+		}
+		limit = min(parsed, max)
+	}
+	return offset, limit, true
+}
@@ -0,0 +1,236 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+)
+
+const (
+	chartLockMeta       = "lock"
+	defaultChartLockTTL = time.Hour
+	maxChartLockTTL     = 7 * 24 * time.Hour
+)
+
+// chartLocksMu serializes taking and releasing chart locks.
+var chartLocksMu sync.Mutex
+
+type chartLockRequest struct {
+	Holder     string `json:"holder,omitempty" example:"incident-1234"` // Defaults to the locking user
+	Reason     string `json:"reason,omitempty" example:"Network migration"`
+	TTLSeconds int    `json:"ttlSeconds,omitempty" example:"3600"` // Defaults to an hour, at most a week
+}
+
+// chartLock freezes a chart: until it expires or is released, only the user
+// who took it can commit to or deploy the chart.
+type chartLock struct {
+	Holder    string `json:"holder"`
+	LockedBy  string `json:"lockedBy"`
+	Reason    string `json:"reason,omitempty"`
+	LockedAt  string `json:"lockedAt"`
+	ExpiresAt string `json:"expiresAt"`
+}
+
+// HandleChartLock handles /api/chart/{id}/lock requests.
+func HandleChartLock(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		HandleChartLockGet(w, r)
+	case http.MethodPost:
+		HandleChartLockPost(w, r, claims.Subject)
+	case http.MethodDelete:
+		HandleChartLockDelete(w, r, claims.Subject)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+	}
+}
+
+// HandleChartLockGet handles GET /api/chart/{id}/lock requests.
+// @Summary Get chart lock
+// @Description Returns the lock held on the chart, or 404 when the chart isn't locked.
+// @Tags chart
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Success 200 {object} chartLock
+// @Failure 400 {object} errorResponse "`invalid chart id`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`not_locked`, `chart_not_found`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/lock [get]
+func HandleChartLockGet(w http.ResponseWriter, r *http.Request) {
+	lock, err := loadChartLock(r.PathValue("id"))
+	if err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+	if lock == nil {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "not_locked", Message: "chart is not locked"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, lock)
+}
+
+// HandleChartLockPost handles POST /api/chart/{id}/lock requests.
+// @Summary Lock chart
+// @Description Freezes the chart: until the lock expires or is released, commits through the API, git pushes, deploys and deletion of the chart are refused with 423 for every user but the one who took the lock. Taking a lock you already hold replaces it, which extends it.
+// @Tags chart
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Param request body chartLockRequest false "Lock holder, reason and lifetime"
+// @Success 200 {object} chartLock
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid_request`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`"
+// @Failure 423 {object} errorResponse "`chart_locked`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/lock [post]
+func HandleChartLockPost(w http.ResponseWriter, r *http.Request, subject string) {
+	var req chartLockRequest
+	if r.ContentLength != 0 {
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "invalid JSON payload"})
+			return
+		}
+	}
+	ttl := time.Duration(req.TTLSeconds) * time.Second
+	if req.TTLSeconds == 0 {
+		ttl = defaultChartLockTTL
+	}
+	if ttl <= 0 || ttl > maxChartLockTTL {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "ttlSeconds must be between 1 and 604800"})
+		return
+	}
+	holder := strings.TrimSpace(req.Holder)
+	if holder == "" {
+		holder = subject
+	}
+
+	chartID := r.PathValue("id")
+	chartLocksMu.Lock()
+	defer chartLocksMu.Unlock()
+	if !requireChartUnlocked(w, chartID, subject) {
+		return
+	}
+
+	now := time.Now().UTC()
+	lock := chartLock{
+		Holder:    holder,
+		LockedBy:  subject,
+		Reason:    strings.TrimSpace(req.Reason),
+		LockedAt:  now.Format(time.RFC3339),
+		ExpiresAt: now.Add(ttl).Format(time.RFC3339),
+	}
+	if err := chart.WriteChartMeta(chartID, chartLockMeta, lock); err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, lock)
+}
+
+// HandleChartLockDelete handles DELETE /api/chart/{id}/lock requests.
+// @Summary Unlock chart
+// @Description Releases the chart lock. Only the user who took the lock and chart admins can release it.
+// @Tags chart
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Success 200 {object} chartLock
+// @Failure 400 {object} errorResponse "`invalid chart id`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`not_locked`, `chart_not_found`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/lock [delete]
+func HandleChartLockDelete(w http.ResponseWriter, r *http.Request, subject string) {
+	chartID := r.PathValue("id")
+	chartLocksMu.Lock()
+	defer chartLocksMu.Unlock()
+
+	lock, err := loadChartLock(chartID)
+	if err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+	if lock == nil {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "not_locked", Message: "chart is not locked"})
+		return
+	}
+	if lock.LockedBy != subject {
+		permissions, err := loadChartPermissions(chartID)
+		if err != nil {
+			writeChartMetaError(w, err)
+			return
+		}
+		if !slices.Contains(permissions.Admins, subject) {
+			writeJSON(w, http.StatusForbidden, errorResponse{Error: "forbidden", Message: "only the lock holder and chart admins can unlock the chart"})
+			return
+		}
+	}
+
+	if err := chart.DeleteChartMeta(chartID, chartLockMeta); err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, lock)
+}
+
+// loadChartLock returns the lock held on a chart, or nil when the chart isn't
+// locked or the lock expired.
+func loadChartLock(chartID string) (*chartLock, error) {
+	var lock chartLock
+	if err := chart.ReadChartMeta(chartID, chartLockMeta, &lock); err != nil {
+		if errors.Is(err, chart.ErrMetaNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	expiresAt, err := time.Parse(time.RFC3339, lock.ExpiresAt)
+	if err != nil || !time.Now().Before(expiresAt) {
+		return nil, nil
+	}
+	return &lock, nil
+}
+
+// requireChartUnlocked writes 423 and returns false when another user holds
+// the chart lock. Locks belong to users rather than sessions, as every user
+// has a single session.
+func requireChartUnlocked(w http.ResponseWriter, chartID, subject string) bool {
+	lock, err := loadChartLock(chartID)
+	if err != nil {
+		writeChartMetaError(w, err)
+		return false
+	}
+	if lock != nil && lock.LockedBy != subject {
+		message := "chart is locked by " + lock.Holder + " until " + lock.ExpiresAt
+		if lock.Reason != "" {
+			message += ": " + lock.Reason
+		}
+		writeJSON(w, http.StatusLocked, errorResponse{Error: "chart_locked", Message: message})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+)
+
+type chartMergeRequest struct {
+	Source  string `json:"source" example:"feature/vpc"`
+	Target  string `json:"target" example:"main"`
+	Message string `json:"message,omitempty" example:"Merge feature/vpc"`
+	// Resolutions maps conflicting paths to the content to commit, or null
+	// to delete the file.
+	Resolutions map[string]*string `json:"resolutions,omitempty"`
+}
+
+type chartMergeResponse struct {
+	ChartID string   `json:"chartId"`
+	Ref     string   `json:"ref"`
+	Source  string   `json:"source"`
+	Target  string   `json:"target"`
+	Paths   []string `json:"paths"`
+}
+
+type chartMergeConflict struct {
+	Path   string           `json:"path"`
+	Kind   string           `json:"kind" enums:"content,add/add,deleted/source,deleted/target,directory"`
+	Base   string           `json:"base,omitempty"`
+	Source string           `json:"source,omitempty"`
+	Target string           `json:"target,omitempty"`
+	Hunks  []chartMergeHunk `json:"hunks,omitempty"`
+}
+
+// chartMergeHunk is a region of a text file both sides changed differently.
+// Lines keep their line endings.
+type chartMergeHunk struct {
+	BaseStart int      `json:"baseStart"` // First base line replaced, counted from 1
+	Base      []string `json:"base"`
+	Source    []string `json:"source"`
+	Target    []string `json:"target"`
+}
+
+type chartMergeConflictResponse struct {
+	Error     string               `json:"error"`
+	Conflicts []chartMergeConflict `json:"conflicts"`
+}
+
+// Handle POST /api/chart/{id}/merge requests.
+// @Summary Merge chart branches
+// @Description Merges the source branch into the target branch with a merge commit. Files changed on one branch only since the merge base are taken from that branch, and text files both branches changed are merged line by line. When changes can't be merged the merge is not made and the conflicting paths are returned with the blob hash of the base and of each side, and for text files the conflicting hunks. Retrying with resolutions mapping every conflicting path to its resolved content, or null to delete it, completes the merge.
+// @Tags chart
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Param request body chartMergeRequest true "Source and target branch names and optional commit message"
+// @Success 200 {object} chartMergeResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid request body`, `source and target required`, `source and target must differ`, `resolution for a path without conflict`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart not found`, `chart branch not found`, `chart_not_found`"
+// @Failure 409 {object} chartMergeConflictResponse "`source branch already merged`, `merge conflicts`"
+// @Failure 422 {object} errorResponse "`commit rejected by policy`"
+// @Failure 423 {object} errorResponse "`chart_locked`"
+// @Failure 500 {object} errorResponse "`failed to merge chart branches`, `chart_settings_failed`"
+// @Router /chart/{id}/merge [post]
+func HandleChartMerge(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	var req chartMergeRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	source := strings.TrimSpace(req.Source)
+	target := strings.TrimSpace(req.Target)
+	if source == "" || target == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "source and target required"})
+		return
+	}
+
+	chartID := r.PathValue("id")
+	if !requireChartUnlocked(w, chartID, claims.Subject) {
+		return
+	}
+	message := strings.TrimSpace(req.Message)
+	result, conflicts, err := chart.MergeChartBranches(chartID, source, target, message, req.Resolutions)
+	if err != nil {
+		if writeCommitPolicyError(w, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, chart.ErrMergeConflict):
+			writeJSON(w, http.StatusConflict, newChartMergeConflictResponse(conflicts))
+		case errors.Is(err, chart.ErrAlreadyMerged):
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "source branch already merged"})
+		case errors.Is(err, chart.ErrInvalidResolution):
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		case errors.Is(err, chart.ErrSameBranch):
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "source and target must differ"})
+		case errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart not found"})
+		case errors.Is(err, plumbing.ErrReferenceNotFound):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart branch not found"})
+		default:
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to merge chart branches"})
+		}
+		return
+	}
+
+	if message == "" {
+		message = "Merge branch " + source + " into " + target
+	}
+	notifyChartCommit(chartID, result.Commit, message, result.Paths)
+
+	writeJSON(w, http.StatusOK, chartMergeResponse{
+		ChartID: chartID,
+		Ref:     result.Commit,
+		Source:  result.Source,
+		Target:  result.Target,
+		Paths:   result.Paths,
+	})
+}
+
+func newChartMergeConflictResponse(conflicts []chart.MergeConflict) chartMergeConflictResponse {
+	response := chartMergeConflictResponse{Error: "merge conflicts", Conflicts: make([]chartMergeConflict, 0, len(conflicts))}
+	for _, conflict := range conflicts {
+		entry := chartMergeConflict{
+			Path:   conflict.Path,
+			Kind:   conflict.Kind,
+			Base:   conflict.Base,
+			Source: conflict.Source,
+			Target: conflict.Target,
+		}
+		for _, hunk := range conflict.Hunks {
+			entry.Hunks = append(entry.Hunks, chartMergeHunk{
+				BaseStart: hunk.BaseStart,
+				Base:      hunk.Base,
+				Source:    hunk.Source,
+				Target:    hunk.Target,
+			})
+		}
+		response.Conflicts = append(response.Conflicts, entry)
+	}
+	return response
+}
@@ -0,0 +1,244 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+	"github.com/mtolmacs/planemgr/internal/server/deploy"
+)
+
+const (
+	chartPermissionsMeta = "permissions"
+	allStacks            = "*"
+)
+
+// chartPermissions separates destroying resources from deploying them. Stacks
+// with a destroy rule can still be deployed by everyone, but plans deleting
+// or replacing resources there are blocked unless the deploying user is
+// allowed. Deploys of stacks with an approval rule wait after their plan
+// until they are approved. Only admins can change the destroy and approval
+// rules, and destroy rules need admins. Once admins are set, only they can
+// change the permissions.
+type chartPermissions struct {
+	Admins   []string       `json:"admins,omitempty"`
+	Destroy  []destroyRule  `json:"destroy,omitempty"`
+	Approval []approvalRule `json:"approval,omitempty"`
+}
+
+// destroyRule restricts destroys in a stack to the allowed users. The root
+// module is the empty stack name and "*" applies to every module. With an
+// environment the rule only applies to deploys to it, otherwise to all.
+type destroyRule struct {
+	Stack       string   `json:"stack"`
+	Environment string   `json:"environment,omitempty" example:"prod"`
+	Allow       []string `json:"allow,omitempty"`
+}
+
+// approvalRule makes deploys of a stack wait for an approval before they
+// apply, only in the environment when one is set. Any user may approve
+// unless approvers are set, and with separateApprover the deploying user
+// can't approve their own deploy.
+type approvalRule struct {
+	Stack            string   `json:"stack"`
+	Environment      string   `json:"environment,omitempty" example:"prod"`
+	Approvers        []string `json:"approvers,omitempty"`
+	SeparateApprover bool     `json:"separateApprover,omitempty"`
+}
+
+// HandleChartPermissions handles /api/chart/{id}/permissions requests.
+func HandleChartPermissions(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		HandleChartPermissionsGet(w, r)
+	case http.MethodPut:
+		HandleChartPermissionsPut(w, r, claims.Subject)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+	}
+}
+
+// HandleChartPermissionsGet handles GET /api/chart/{id}/permissions requests.
+// @Summary Get chart permissions
+// @Description Returns the destroy rules of the chart and the users who may change them.
+// @Tags chart
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Success 200 {object} chartPermissions
+// @Failure 400 {object} errorResponse "`invalid chart id`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/permissions [get]
+func HandleChartPermissionsGet(w http.ResponseWriter, r *http.Request) {
+	permissions, err := loadChartPermissions(r.PathValue("id"))
+	if err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, permissions)
+}
+
+// HandleChartPermissionsPut handles PUT /api/chart/{id}/permissions requests.
+// @Summary Set chart permissions
+// @Description Replaces the chart permissions. Rules apply to the deploys of their stack, or of every module with "*", and with environment only to deploys to that environment. Deploys to a stack with a destroy rule are blocked by the mandatory "destroy" policy when their plan deletes or replaces resources and the deploying user is not allowed; overridePolicies can't lift it. Deploys to a stack with an approval rule pause as awaiting_approval once planned, until POST /api/deploy/{id}/approve by one of the approvers, or by anyone without approvers; with separateApprover the deploying user can't approve their own deploy. Sandbox and plan-only deploys need no approval. Only admins can change the destroy and approval rules, so a chart without admins has to get them first, and destroy rules can't be saved without admins. Once admins are set only they can change the permissions, and they must stay among them.
+// @Tags chart
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Param request body chartPermissions true "Permissions"
+// @Success 200 {object} chartPermissions
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid_request`, `invalid_permissions`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/permissions [put]
+func HandleChartPermissionsPut(w http.ResponseWriter, r *http.Request, subject string) {
+	var req chartPermissions
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "invalid JSON payload"})
+		return
+	}
+
+	chartID := r.PathValue("id")
+	current, err := loadChartPermissions(chartID)
+	if err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+	if len(current.Admins) > 0 && !slices.Contains(current.Admins, subject) {
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: "forbidden", Message: "only chart admins can change permissions"})
+		return
+	}
+	if len(req.Admins) > 0 && !slices.Contains(req.Admins, subject) {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_permissions", Message: "admins must include the current user"})
+		return
+	}
+	if len(req.Destroy) > 0 && len(req.Admins) == 0 {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_permissions", Message: "destroy rules need chart admins"})
+		return
+	}
+
+	stacks := map[string]bool{}
+	for i, rule := range req.Destroy {
+		rule.Stack = strings.TrimSpace(rule.Stack)
+		rule.Environment = strings.TrimSpace(rule.Environment)
+		if rule.Stack != allStacks && deploy.ValidateStackName(rule.Stack) != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_permissions", Message: "invalid stack " + rule.Stack})
+			return
+		}
+		if err := deploy.ValidateEnvironmentName(rule.Environment); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_permissions", Message: err.Error()})
+			return
+		}
+		if stacks[rule.Environment+"/"+rule.Stack] {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_permissions", Message: "duplicate rule for stack " + rule.Stack + ruleEnvironmentSuffix(rule.Environment)})
+			return
+		}
+		stacks[rule.Environment+"/"+rule.Stack] = true
+		req.Destroy[i] = rule
+	}
+	clear(stacks)
+	for i, rule := range req.Approval {
+		rule.Stack = strings.TrimSpace(rule.Stack)
+		rule.Environment = strings.TrimSpace(rule.Environment)
+		if rule.Stack != allStacks && deploy.ValidateStackName(rule.Stack) != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_permissions", Message: "invalid stack " + rule.Stack})
+			return
+		}
+		if err := deploy.ValidateEnvironmentName(rule.Environment); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_permissions", Message: err.Error()})
+			return
+		}
+		if stacks[rule.Environment+"/"+rule.Stack] {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_permissions", Message: "duplicate approval rule for stack " + rule.Stack + ruleEnvironmentSuffix(rule.Environment)})
+			return
+		}
+		stacks[rule.Environment+"/"+rule.Stack] = true
+		req.Approval[i] = rule
+	}
+	if !slices.Contains(current.Admins, subject) && !sameChartRules(current, req) {
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: "forbidden", Message: "only chart admins can change destroy and approval rules"})
+		return
+	}
+
+	if err := chart.WriteChartMeta(chartID, chartPermissionsMeta, req); err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, req)
+}
+
+func loadChartPermissions(chartID string) (chartPermissions, error) {
+	var permissions chartPermissions
+	if err := chart.ReadChartMeta(chartID, chartPermissionsMeta, &permissions); err != nil && !errors.Is(err, chart.ErrMetaNotFound) {
+		return chartPermissions{}, err
+	}
+	return permissions, nil
+}
+
+// sameChartRules reports whether a and b have the same destroy and approval
+// rules.
+func sameChartRules(a, b chartPermissions) bool {
+	rulesA, _ := json.Marshal(chartPermissions{Destroy: a.Destroy, Approval: a.Approval})
+	rulesB, _ := json.Marshal(chartPermissions{Destroy: b.Destroy, Approval: b.Approval})
+	return string(rulesA) == string(rulesB)
+}
+
+// canDestroy reports whether subject may destroy resources in stack of
+// environment. Every rule matching them has to allow it.
+func (p chartPermissions) canDestroy(environment, stack, subject string) bool {
+	for _, rule := range p.Destroy {
+		if !ruleMatches(rule.Environment, rule.Stack, environment, stack) {
+			continue
+		}
+		if !slices.Contains(rule.Allow, subject) {
+			return false
+		}
+	}
+	return true
+}
+
+// approvalRules returns the approval rules applying to deploys of stack to
+// environment.
+func (p chartPermissions) approvalRules(environment, stack string) []approvalRule {
+	var rules []approvalRule
+	for _, rule := range p.Approval {
+		if ruleMatches(rule.Environment, rule.Stack, environment, stack) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// ruleMatches reports whether a rule for ruleStack, in ruleEnvironment when
+// set, applies to deploys of stack to environment.
+func ruleMatches(ruleEnvironment, ruleStack, environment, stack string) bool {
+	return (ruleStack == allStacks || ruleStack == stack) && (ruleEnvironment == "" || ruleEnvironment == environment)
+}
+
+func ruleEnvironmentSuffix(environment string) string {
+	if environment == "" {
+		return ""
+	}
+	return " in environment " + environment
+}
@@ -0,0 +1,262 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+)
+
+const chartEventPresence = "presence"
+
+// chartPresence is what a user connected to the event stream of a chart is
+// looking at.
+type chartPresence struct {
+	Subject   string `json:"subject" example:"alice"`
+	Path      string `json:"path,omitempty" example:"modules/network/main.tf"` // Chart file the user has open
+	Editing   bool   `json:"editing,omitempty"`                                // The user is editing the file rather than viewing it
+	UpdatedAt string `json:"updatedAt" example:"2026-01-02T15:04:05Z"`
+}
+
+type chartPresenceRequest struct {
+	Path    string `json:"path,omitempty" example:"modules/network/main.tf"`
+	Editing bool   `json:"editing,omitempty"`
+}
+
+type chartPresenceListResponse struct {
+	Presence []chartPresence `json:"presence"`
+}
+
+// presenceEntry is the presence of a user, held while they have at least
+// one event stream of the chart open.
+type presenceEntry struct {
+	presence chartPresence
+	streams  int
+}
+
+var chartPresences = struct {
+	mu     sync.Mutex
+	charts map[string]map[string]*presenceEntry
+}{
+	charts: map[string]map[string]*presenceEntry{},
+}
+
+// joinChartPresence marks subject present on a chart for an event stream,
+// and returns the function to call when the stream ends. Other streams of
+// the chart get a presence event when the subject joins or their file
+// changes.
+func joinChartPresence(chartID, subject string, request chartPresenceRequest) func() {
+	chartPresences.mu.Lock()
+	entries, ok := chartPresences.charts[chartID]
+	if !ok {
+		entries = map[string]*presenceEntry{}
+		chartPresences.charts[chartID] = entries
+	}
+	entry, ok := entries[subject]
+	action := "updated"
+	if !ok {
+		entry = &presenceEntry{presence: chartPresence{Subject: subject}}
+		entries[subject] = entry
+		action = "joined"
+	}
+	entry.streams++
+	changed := updatePresence(entry, request)
+	presence := entry.presence
+	chartPresences.mu.Unlock()
+
+	if action == "joined" || changed {
+		publishChartPresenceEvent(chartID, presence, action)
+	}
+	return func() { leaveChartPresence(chartID, subject) }
+}
+
+// leaveChartPresence ends an event stream of subject, and the presence of
+// subject once it was the last one.
+func leaveChartPresence(chartID, subject string) {
+	chartPresences.mu.Lock()
+	entries := chartPresences.charts[chartID]
+	entry, ok := entries[subject]
+	if !ok {
+		chartPresences.mu.Unlock()
+		return
+	}
+	entry.streams--
+	if entry.streams > 0 {
+		chartPresences.mu.Unlock()
+		return
+	}
+	delete(entries, subject)
+	if len(entries) == 0 {
+		delete(chartPresences.charts, chartID)
+	}
+	presence := entry.presence
+	chartPresences.mu.Unlock()
+
+	publishChartPresenceEvent(chartID, presence, "left")
+}
+
+// updateChartPresence changes the file of subject on a chart, and reports
+// false when subject has no event stream of the chart open.
+func updateChartPresence(chartID, subject string, request chartPresenceRequest) (chartPresence, bool) {
+	chartPresences.mu.Lock()
+	entry, ok := chartPresences.charts[chartID][subject]
+	if !ok {
+		chartPresences.mu.Unlock()
+		return chartPresence{}, false
+	}
+	changed := updatePresence(entry, request)
+	presence := entry.presence
+	chartPresences.mu.Unlock()
+
+	if changed {
+		publishChartPresenceEvent(chartID, presence, "updated")
+	}
+	return presence, true
+}
+
+// updatePresence applies request to entry and reports whether it changed.
+func updatePresence(entry *presenceEntry, request chartPresenceRequest) bool {
+	if entry.presence.UpdatedAt != "" && entry.presence.Path == request.Path && entry.presence.Editing == request.Editing {
+		return false
+	}
+	entry.presence.Path = request.Path
+	entry.presence.Editing = request.Editing
+	entry.presence.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	return true
+}
+
+// listChartPresence returns the users present on a chart sorted by subject.
+func listChartPresence(chartID string) []chartPresence {
+	chartPresences.mu.Lock()
+	defer chartPresences.mu.Unlock()
+
+	presence := make([]chartPresence, 0, len(chartPresences.charts[chartID]))
+	for _, entry := range chartPresences.charts[chartID] {
+		presence = append(presence, entry.presence)
+	}
+	slices.SortFunc(presence, func(a, b chartPresence) int { return strings.Compare(a.Subject, b.Subject) })
+	return presence
+}
+
+func publishChartPresenceEvent(chartID string, presence chartPresence, action string) {
+	event := chartEvent{
+		Type:    chartEventPresence,
+		ChartID: chartID,
+		Action:  action,
+		Subject: presence.Subject,
+		Editing: presence.Editing,
+	}
+	if presence.Path != "" {
+		event.Paths = []string{presence.Path}
+	}
+	publishChartEvent(event)
+}
+
+// parseChartPresenceQuery reads the presence an event stream opens with
+// from its path and editing query parameters.
+func parseChartPresenceQuery(r *http.Request) (chartPresenceRequest, error) {
+	query := r.URL.Query()
+	request := chartPresenceRequest{Path: query.Get("path")}
+	if value := query.Get("editing"); value != "" {
+		editing, err := strconv.ParseBool(value)
+		if err != nil {
+			return chartPresenceRequest{}, errors.New("editing must be a boolean")
+		}
+		request.Editing = editing
+	}
+	return request, validateChartPresence(&request)
+}
+
+// validateChartPresence cleans the path of request. Editing needs a path.
+func validateChartPresence(request *chartPresenceRequest) error {
+	if request.Path == "" {
+		if request.Editing {
+			return errors.New("editing needs a path")
+		}
+		return nil
+	}
+	path, err := chart.CleanChartPath(request.Path)
+	if err != nil {
+		return err
+	}
+	request.Path = path
+	return nil
+}
+
+// HandleChartPresence handles /api/chart/{id}/presence requests.
+func HandleChartPresence(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		HandleChartPresenceGet(w, r)
+	case http.MethodPut:
+		HandleChartPresencePut(w, r, claims.Subject)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+	}
+}
+
+// HandleChartPresenceGet handles GET /api/chart/{id}/presence requests.
+// @Summary List chart collaborators
+// @Description Returns the users with an event stream of the chart open and the file each of them is viewing or editing.
+// @Tags chart
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Success 200 {object} chartPresenceListResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Router /chart/{id}/presence [get]
+func HandleChartPresenceGet(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, chartPresenceListResponse{Presence: listChartPresence(r.PathValue("id"))})
+}
+
+// HandleChartPresencePut handles PUT /api/chart/{id}/presence requests.
+// @Summary Set the file you are on
+// @Description Changes the file the user is viewing or editing, sending a presence event to the event streams of the chart. The user needs an event stream of the chart open, which holds their presence until it closes.
+// @Tags chart
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Param request body chartPresenceRequest true "File the user is on"
+// @Success 200 {object} chartPresence
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid_request`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 409 {object} errorResponse "`event_stream_required`"
+// @Router /chart/{id}/presence [put]
+func HandleChartPresencePut(w http.ResponseWriter, r *http.Request, subject string) {
+	var req chartPresenceRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "invalid JSON payload"})
+		return
+	}
+	if err := validateChartPresence(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: err.Error()})
+		return
+	}
+
+	presence, ok := updateChartPresence(r.PathValue("id"), subject, req)
+	if !ok {
+		writeJSON(w, http.StatusConflict, errorResponse{Error: "event_stream_required", Message: "open the event stream of the chart first"})
+		return
+	}
+	writeJSON(w, http.StatusOK, presence)
+}
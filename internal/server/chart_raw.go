@@ -0,0 +1,127 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+)
+
+// chartRawTypes are the content types of chart file extensions the mime
+// package doesn't know.
+var chartRawTypes = map[string]string{
+	".tf":     "text/plain; charset=utf-8",
+	".tfvars": "text/plain; charset=utf-8",
+	".hcl":    "text/plain; charset=utf-8",
+	".json":   "application/json",
+}
+
+// Handle GET /api/chart/{id}/raw requests.
+// @Summary Stream a chart file
+// @Description Streams the bytes of a file in a chart at a ref, with a Content-Type guessed from the file name or content and a Content-Length, instead of wrapping the content in JSON. The ETag is the blob hash, and X-Chart-Ref the commit the file was read from.
+// @Tags chart
+// @Security BearerAuth
+// @Produce octet-stream
+// @Param id path string true "Chart ID"
+// @Param file query string true "File path in the chart repo"
+// @Param ref query string false "Git ref (defaults to HEAD)"
+// @Param at query string false "RFC 3339 timestamp; resolves ref to the commit it pointed to at that time"
+// @Success 200 {file} file
+// @Success 304
+// @Failure 400 {object} errorResponse "`invalid chart id`, `file required`, `at must be an RFC 3339 timestamp`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart not found`, `chart ref not found`, `chart file not found`, `no chart commit at that time`"
+// @Failure 422 {object} errorResponse "`chart path is a symlink`"
+// @Failure 500 {object} errorResponse "`failed to read chart file`, `failed to resolve chart ref`"
+// @Router /chart/{id}/raw [get]
+func HandleChartRaw(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.RequireAccessTokenClaims(r); err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	chartID := r.PathValue("id")
+	filePath := r.URL.Query().Get("file")
+	if filePath == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "file required"})
+		return
+	}
+	ref, ok := chartQueryRef(w, r, chartID, "ref", "at")
+	if !ok {
+		return
+	}
+
+	file, err := chart.OpenChartFile(chartID, filePath, ref)
+	if err != nil {
+		if errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart not found"})
+			return
+		}
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart ref not found"})
+			return
+		}
+		if errors.Is(err, object.ErrFileNotFound) || errors.Is(err, object.ErrDirectoryNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart file not found"})
+			return
+		}
+		if errors.Is(err, chart.ErrPathIsSymlink) {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": "chart path is a symlink"})
+			return
+		}
+
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read chart file"})
+		return
+	}
+	defer file.Close()
+
+	etag := `"` + file.Hash + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Chart-Ref", file.Ref)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// Chart content is user supplied, so browsers must neither sniff it nor
+	// run it in the API origin.
+	reader := bufio.NewReader(file)
+	head, _ := reader.Peek(512)
+	w.Header().Set("Content-Type", chartFileContentType(filePath, head))
+	w.Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = io.Copy(w, reader)
+}
+
+// chartFileContentType guesses the content type of a chart file from its
+// extension, falling back to sniffing the first bytes of its content.
+func chartFileContentType(filePath string, head []byte) string {
+	if contentType := chartRawTypes[path.Ext(filePath)]; contentType != "" {
+		return contentType
+	}
+	if contentType := mime.TypeByExtension(path.Ext(filePath)); contentType != "" {
+		return contentType
+	}
+	return http.DetectContentType(head)
+}
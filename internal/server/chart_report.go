@@ -0,0 +1,239 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+	"github.com/mtolmacs/planemgr/internal/server/deploy"
+)
+
+const (
+	chartArchivedMeta = "archived"
+	defaultStaleDays  = 90
+)
+
+// Reasons a chart is listed in the hygiene report.
+const (
+	hygieneNoCommits        = "no_commits"
+	hygieneStaleCommits     = "stale_commits"
+	hygieneNeverDeployed    = "never_deployed"
+	hygieneStaleDeploys     = "stale_deploys"
+	hygieneLastDeployFailed = "last_deploy_failed"
+)
+
+type chartArchived struct {
+	Subject    string `json:"subject"`
+	ArchivedAt string `json:"archivedAt"`
+}
+
+type chartHygieneEntry struct {
+	ChartID          string   `json:"chartId"`
+	LastCommitAt     string   `json:"lastCommitAt,omitempty"`
+	LastDeployAt     string   `json:"lastDeployAt,omitempty"`
+	LastDeployStatus string   `json:"lastDeployStatus,omitempty"`
+	Reasons          []string `json:"reasons"`
+}
+
+type chartHygieneResponse struct {
+	StaleDays int                 `json:"staleDays"`
+	Charts    []chartHygieneEntry `json:"charts"`
+}
+
+type chartArchiveRequest struct {
+	ChartIDs []string `json:"chartIds" example:"3fa85f64-5717-4562-b3fc-2c963f66afa6"`
+	Archived bool     `json:"archived"`
+}
+
+type chartArchiveResponse struct {
+	ChartIDs []string `json:"chartIds"`
+	Archived bool     `json:"archived"`
+}
+
+// Handle GET /api/chart/report requests.
+// @Summary Chart hygiene report
+// @Description Lists charts that are not archived and have no commits or deploys in the given number of days, were never deployed, or whose last deploy failed.
+// @Tags chart
+// @Security BearerAuth
+// @Param days query int false "Days without activity before a chart is stale (default 90)"
+// @Success 200 {object} chartHygieneResponse
+// @Failure 400 {object} errorResponse "`invalid_request`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 500 {object} errorResponse "`chart_list_failed`, `chart_settings_failed`, `chart_report_failed`"
+// @Router /chart/report [get]
+func HandleChartReport(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.RequireAccessTokenClaims(r); err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+		return
+	}
+
+	days := defaultStaleDays
+	if value := r.URL.Query().Get("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "days must be a positive integer"})
+			return
+		}
+		days = parsed
+	}
+	cutoff := time.Now().AddDate(0, 0, -days)
+
+	chartIDs, err := chart.ListChartRepos()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "chart_list_failed", Message: err.Error()})
+		return
+	}
+
+	response := chartHygieneResponse{StaleDays: days, Charts: []chartHygieneEntry{}}
+	for _, chartID := range chartIDs {
+		archived, err := isChartArchived(chartID)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "chart_settings_failed", Message: err.Error()})
+			return
+		}
+		if archived {
+			continue
+		}
+
+		entry, err := chartHygiene(chartID, cutoff)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "chart_report_failed", Message: err.Error()})
+			return
+		}
+		if len(entry.Reasons) > 0 {
+			response.Charts = append(response.Charts, entry)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func chartHygiene(chartID string, cutoff time.Time) (chartHygieneEntry, error) {
+	entry := chartHygieneEntry{ChartID: chartID, Reasons: []string{}}
+
+	_, commits, _, err := chart.ListChartHistory(chartID, "", 0, 1)
+	if err != nil {
+		return entry, err
+	}
+	if len(commits) == 0 {
+		entry.Reasons = append(entry.Reasons, hygieneNoCommits)
+	} else {
+		entry.LastCommitAt = commits[0].When.UTC().Format(time.RFC3339)
+		if commits[0].When.Before(cutoff) {
+			entry.Reasons = append(entry.Reasons, hygieneStaleCommits)
+		}
+	}
+
+	lastDeploy, err := loadChartLastDeploy(chartID)
+	if err != nil {
+		return entry, err
+	}
+	if lastDeploy == nil {
+		entry.Reasons = append(entry.Reasons, hygieneNeverDeployed)
+		return entry, nil
+	}
+
+	entry.LastDeployAt = lastDeploy.DeployedAt
+	entry.LastDeployStatus = lastDeploy.Status
+	if deployedAt, err := time.Parse(time.RFC3339, lastDeploy.DeployedAt); err == nil && deployedAt.Before(cutoff) {
+		entry.Reasons = append(entry.Reasons, hygieneStaleDeploys)
+	}
+	if lastDeploy.Status == deploy.StatusFailed {
+		entry.Reasons = append(entry.Reasons, hygieneLastDeployFailed)
+	}
+
+	return entry, nil
+}
+
+// Handle POST /api/chart/archived requests.
+// @Summary Archive or restore charts
+// @Description Archives or restores several charts at once. Archived charts are hidden from the chart list unless requested and cannot be deployed.
+// @Tags chart
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body chartArchiveRequest true "Charts to update"
+// @Success 200 {object} chartArchiveResponse
+// @Failure 400 {object} errorResponse "`invalid_request`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/archived [post]
+func HandleChartArchived(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+		return
+	}
+
+	var req chartArchiveRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "invalid JSON payload"})
+		return
+	}
+	if len(req.ChartIDs) == 0 {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "chartIds are required"})
+		return
+	}
+	for _, chartID := range req.ChartIDs {
+		if !chart.IsChartID(chartID) {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "invalid chart id " + chartID})
+			return
+		}
+	}
+
+	// Validate every chart first so a typo doesn't leave a half-applied batch.
+	for _, chartID := range req.ChartIDs {
+		if _, err := isChartArchived(chartID); err != nil {
+			writeChartMetaError(w, err)
+			return
+		}
+	}
+
+	for _, chartID := range req.ChartIDs {
+		if req.Archived {
+			err = chart.WriteChartMeta(chartID, chartArchivedMeta, chartArchived{
+				Subject:    claims.Subject,
+				ArchivedAt: time.Now().UTC().Format(time.RFC3339),
+			})
+		} else {
+			err = chart.DeleteChartMeta(chartID, chartArchivedMeta)
+		}
+		if err != nil {
+			writeChartMetaError(w, err)
+			return
+		}
+		publishChartChange(chartID)
+	}
+
+	writeJSON(w, http.StatusOK, chartArchiveResponse{ChartIDs: req.ChartIDs, Archived: req.Archived})
+}
+
+func isChartArchived(chartID string) (bool, error) {
+	var archived chartArchived
+	if err := chart.ReadChartMeta(chartID, chartArchivedMeta, &archived); err != nil {
+		if errors.Is(err, chart.ErrMetaNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+	"github.com/mtolmacs/planemgr/internal/server/deploy"
+)
+
+const chartRequiredTagsMeta = "required-tags"
+
+type chartRequiredTags struct {
+	Tags        []string `json:"tags,omitempty" example:"owner,cost-center"`
+	Enforcement string   `json:"enforcement,omitempty" example:"block"`
+}
+
+// HandleChartRequiredTags handles /api/chart/{id}/required-tags requests.
+func HandleChartRequiredTags(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.RequireAccessTokenClaims(r); err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		HandleChartRequiredTagsGet(w, r)
+	case http.MethodPut:
+		HandleChartRequiredTagsPut(w, r)
+	case http.MethodDelete:
+		HandleChartRequiredTagsDelete(w, r)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+	}
+}
+
+// HandleChartRequiredTagsGet handles GET /api/chart/{id}/required-tags requests.
+// @Summary Get chart required tags
+// @Description Returns the tag keys that resources created or updated by deploys of the chart must carry.
+// @Tags chart
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Success 200 {object} chartRequiredTags
+// @Failure 400 {object} errorResponse "`invalid chart id`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/required-tags [get]
+func HandleChartRequiredTagsGet(w http.ResponseWriter, r *http.Request) {
+	requiredTags, err := loadChartRequiredTags(r.PathValue("id"))
+	if err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, chartRequiredTags(requiredTags))
+}
+
+// HandleChartRequiredTagsPut handles PUT /api/chart/{id}/required-tags requests.
+// @Summary Set chart required tags
+// @Description Replaces the required tags. Deploys whose plan creates or updates a resource with a tags_all, tags or labels attribute lacking one of them are blocked, or only flagged when enforcement is "warn". Blocked deploys can be forced by listing "tags" in overridePolicies.
+// @Tags chart
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Param request body chartRequiredTags true "Required tags"
+// @Success 200 {object} chartRequiredTags
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid_request`, `invalid_required_tags`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/required-tags [put]
+func HandleChartRequiredTagsPut(w http.ResponseWriter, r *http.Request) {
+	var req chartRequiredTags
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "invalid JSON payload"})
+		return
+	}
+	for i, tag := range req.Tags {
+		req.Tags[i] = strings.TrimSpace(tag)
+	}
+
+	requiredTags := deploy.RequiredTags(req)
+	if err := requiredTags.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_required_tags", Message: err.Error()})
+		return
+	}
+
+	if err := chart.WriteChartMeta(r.PathValue("id"), chartRequiredTagsMeta, requiredTags); err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, req)
+}
+
+// HandleChartRequiredTagsDelete handles DELETE /api/chart/{id}/required-tags requests.
+// @Summary Remove chart required tags
+// @Tags chart
+// @Security BearerAuth
+// @Param id path string true "Chart ID"
+// @Success 200 {object} emptyResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/required-tags [delete]
+func HandleChartRequiredTagsDelete(w http.ResponseWriter, r *http.Request) {
+	if err := chart.DeleteChartMeta(r.PathValue("id"), chartRequiredTagsMeta); err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, emptyResponse{})
+}
+
+func loadChartRequiredTags(chartID string) (deploy.RequiredTags, error) {
+	var requiredTags deploy.RequiredTags
+	if err := chart.ReadChartMeta(chartID, chartRequiredTagsMeta, &requiredTags); err != nil && !errors.Is(err, chart.ErrMetaNotFound) {
+		return deploy.RequiredTags{}, err
+	}
+	return requiredTags, nil
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+)
+
+type chartRevertRequest struct {
+	Ref     string `json:"ref" example:"9fceb02d0ae598e95dc970b74767f19372d61af8"`
+	Path    string `json:"path,omitempty" example:"main.tf.json"` // Only revert this file
+	Message string `json:"message,omitempty" example:"Revert to last good release"`
+}
+
+type chartRevertResponse struct {
+	ChartID string `json:"chartId"`
+	Ref     string `json:"ref"`
+	Target  string `json:"target"`
+	Path    string `json:"path,omitempty"`
+}
+
+// Handle POST /api/chart/{id}/revert requests.
+// @Summary Revert chart to an earlier commit
+// @Description Creates a new commit on the chart branch whose files match the target ref. The history in between is kept. With path, only that file is restored to its version at the target ref.
+// @Tags chart
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Param request body chartRevertRequest true "Target ref and optional commit message"
+// @Success 200 {object} chartRevertResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid request body`, `ref required`, `invalid file path`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart not found`, `chart ref not found`, `chart file not found`, `chart_not_found`"
+// @Failure 409 {object} errorResponse "`chart already matches ref`"
+// @Failure 422 {object} errorResponse "`commit rejected by policy`"
+// @Failure 423 {object} errorResponse "`chart_locked`"
+// @Failure 500 {object} errorResponse "`failed to revert chart`, `chart_settings_failed`"
+// @Router /chart/{id}/revert [post]
+func HandleChartRevert(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	var req chartRevertRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	if strings.TrimSpace(req.Ref) == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "ref required"})
+		return
+	}
+
+	chartID := r.PathValue("id")
+	if !requireChartUnlocked(w, chartID, claims.Subject) {
+		return
+	}
+	var target, commitRef string
+	if req.Path != "" {
+		target, commitRef, err = chart.RevertChartFile(chartID, req.Path, req.Ref, strings.TrimSpace(req.Message))
+	} else {
+		target, commitRef, err = chart.RevertChart(chartID, req.Ref, strings.TrimSpace(req.Message))
+	}
+	if err != nil {
+		if writeCommitPolicyError(w, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, chart.ErrInvalidPath):
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid file path"})
+		case errors.Is(err, object.ErrFileNotFound) || errors.Is(err, object.ErrDirectoryNotFound):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart file not found"})
+		case errors.Is(err, chart.ErrNothingToRevert):
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "chart already matches ref"})
+		case errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart not found"})
+		case errors.Is(err, plumbing.ErrReferenceNotFound):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart ref not found"})
+		default:
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to revert chart"})
+		}
+		return
+	}
+	publishChartChange(chartID)
+	publishChartCommitEvent(chartID, commitRef, strings.TrimSpace(req.Message), nil)
+
+	writeJSON(w, http.StatusOK, chartRevertResponse{
+		ChartID: chartID,
+		Ref:     commitRef,
+		Target:  target,
+		Path:    req.Path,
+	})
+}
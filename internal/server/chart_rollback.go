@@ -0,0 +1,111 @@
+package server
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/deploy"
+)
+
+type chartRollbackRequest struct {
+	Stack           string   `json:"stack,omitempty"`
+	Environment     string   `json:"environment,omitempty" example:"staging"`
+	DeployID        string   `json:"deployId,omitempty"` // Roll back from this deploy instead of the latest one
+	AgentLabels     []string `json:"agentLabels,omitempty" example:"region=eu"`
+	TimeoutSeconds  int      `json:"timeoutSeconds,omitempty" example:"1800"` // Defaults to DEPLOY_TIMEOUT
+	RequireApproval bool     `json:"requireApproval,omitempty"`
+}
+
+// HandleChartRollback handles /api/chart/{id}/rollback requests.
+// @Summary Roll back a chart
+// @Description Deploys the commit of the last successful deploy of the chart root module, or of a stack, in the environment, or without one, before its latest deploy attempt, or before deployId. Sandbox and plan runs are not considered. The deploy is queued and answered like POST /api/deploy, also with wait=true.
+// @Tags deploy
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Param request body chartRollbackRequest false "Rollback request"
+// @Param wait query bool false "Block until the deploy finished and return its result"
+// @Param fields query string false "Comma-separated deploy fields to return with wait, such as status,exitCode"
+// @Success 200 {object} deployResponse
+// @Success 202 {object} deployJobResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid_request`, `invalid_pipeline`, `invalid_owners`, `deploy_failed`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`, `ssh_key_required`"
+// @Failure 404 {object} errorResponse "`chart_not_found`, `deploy_not_found`, `rollback_target_not_found`, `ref_not_found`, `deploy_failed`, `ssh_public_key_not_found`, `secret_not_found`, `environment_not_found`"
+// @Failure 409 {object} errorResponse "`chart_busy`, `chart_archived`, `deploy_account_unavailable`, `deploy_canceled`"
+// @Failure 422 {object} errorResponse "`unsafe_tree`"
+// @Failure 423 {object} errorResponse "`chart_locked`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`, `pipeline_load_failed`, `ref_resolve_failed`, `policy_load_failed`, `owners_load_failed`, `run_task_load_failed`, `deploy_failed`, `service_account_load_failed`, `key_load_failed`, `state_failed`, `secrets_load_failed`"
+// @Failure 503 {object} errorResponse "`deploy_failed`"
+// @Failure 504 {object} errorResponse "`deploy_timed_out`"
+// @Router /chart/{id}/rollback [post]
+func HandleChartRollback(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+		return
+	}
+
+	var req chartRollbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "Invalid JSON payload"})
+		return
+	}
+	if req.Stack != "" && deploy.ValidateStackName(req.Stack) != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: deploy.ErrInvalidStack.Error()})
+		return
+	}
+	if err := deploy.ValidateEnvironmentName(req.Environment); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: err.Error()})
+		return
+	}
+
+	chartID := r.PathValue("id")
+	runs, err := loadChartDeployHistory(chartID)
+	if err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+	runs = slices.DeleteFunc(runs, func(run chartDeployRun) bool {
+		return run.Stack != req.Stack || run.Environment != req.Environment || run.Sandbox || run.PlanOnly
+	})
+
+	from := len(runs) - 1
+	if req.DeployID != "" {
+		from = slices.IndexFunc(runs, func(run chartDeployRun) bool { return run.DeployID == req.DeployID })
+		if from < 0 {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "deploy_not_found"})
+			return
+		}
+	}
+	var target *chartDeployRun
+	for i := from - 1; i >= 0; i-- {
+		if runs[i].Status == deploy.StatusSucceeded {
+			target = &runs[i]
+			break
+		}
+	}
+	if target == nil {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "rollback_target_not_found", Message: "no successful deploy to roll back to"})
+		return
+	}
+
+	runDeploy(w, r, claims.Subject, chartID, cmp.Or(target.Commit, target.Ref), req.Stack, deployOptions{
+		AgentLabels:     req.AgentLabels,
+		Timeout:         time.Duration(req.TimeoutSeconds) * time.Second,
+		RequireApproval: req.RequireApproval,
+		Environment:     req.Environment,
+	})
+}
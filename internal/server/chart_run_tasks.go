@@ -0,0 +1,419 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+	"github.com/mtolmacs/planemgr/internal/server/deploy"
+)
+
+const (
+	chartRunTasksMeta     = "run-tasks"
+	runTaskEvent          = "deploy.run_task"
+	defaultRunTaskTimeout = 10 * time.Minute
+	maxRunTaskTimeout     = time.Hour
+	runTaskStatusPassed   = "passed"
+	runTaskStatusFailed   = "failed"
+)
+
+// runTaskStages are the stages run tasks can follow.
+var runTaskStages = []string{deploy.StageInit, deploy.StageValidate, deploy.StagePlan, deploy.StagePolicy, deploy.StageApply}
+
+// chartRunTask is an external service deploys of the chart wait on. Once
+// the After stage finished it receives the plan and a callback URL, and the
+// deploy continues only when it reports back "passed" within the timeout.
+// Failures only warn when enforcement is "warn". The secret is never
+// returned, and stored encrypted.
+type chartRunTask struct {
+	Name           string `json:"name"`
+	URL            string `json:"url"`
+	After          string `json:"after,omitempty" enums:"init,validate,plan,policy,apply"` // Defaults to plan
+	Enforcement    string `json:"enforcement,omitempty" enums:"block,warn"`
+	TimeoutSeconds int    `json:"timeoutSeconds,omitempty"` // Defaults to 600
+	Secret         string `json:"secret,omitempty"`
+}
+
+type chartRunTasks struct {
+	Tasks []chartRunTask `json:"tasks"`
+}
+
+// runTaskPayload is the body POSTed to run tasks, signed like webhook
+// deliveries. The task reports its result by POSTing a runTaskCallback to
+// callbackUrl with accessToken as the Authorization header.
+type runTaskPayload struct {
+	Event       string          `json:"event"`
+	Task        string          `json:"task"`
+	ChartID     string          `json:"chartId"`
+	Ref         string          `json:"ref"`
+	Commit      string          `json:"commit"`
+	Stack       string          `json:"stack,omitempty"`
+	Stage       string          `json:"stage"`
+	Subject     string          `json:"subject"`
+	Plan        json.RawMessage `json:"plan,omitempty" swaggertype:"object"`
+	CallbackURL string          `json:"callbackUrl"`
+	AccessToken string          `json:"accessToken"`
+	Timestamp   string          `json:"timestamp"`
+}
+
+type runTaskCallback struct {
+	Status  string `json:"status" enums:"passed,failed"`
+	Message string `json:"message,omitempty"`
+}
+
+// pendingRunTask is a run task delivery waiting for its callback.
+type pendingRunTask struct {
+	token  string
+	result chan runTaskCallback
+}
+
+var runTaskRegistry = struct {
+	mu      sync.Mutex
+	pending map[string]*pendingRunTask
+}{
+	pending: map[string]*pendingRunTask{},
+}
+
+// HandleChartRunTasks handles /api/chart/{id}/run-tasks requests.
+func HandleChartRunTasks(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		HandleChartRunTasksGet(w, r)
+	case http.MethodPut:
+		HandleChartRunTasksPut(w, r, claims.Subject)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+	}
+}
+
+// HandleChartRunTasksGet handles GET /api/chart/{id}/run-tasks requests.
+// @Summary Get chart run tasks
+// @Description Returns the external services deploys of the chart wait on. Secrets are not included.
+// @Tags chart
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Success 200 {object} chartRunTasks
+// @Failure 400 {object} errorResponse "`invalid chart id`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/run-tasks [get]
+func HandleChartRunTasksGet(w http.ResponseWriter, r *http.Request) {
+	tasks, err := loadChartRunTasks(r.PathValue("id"))
+	if err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+
+	for i := range tasks.Tasks {
+		tasks.Tasks[i].Secret = ""
+	}
+	writeJSON(w, http.StatusOK, tasks)
+}
+
+// HandleChartRunTasksPut handles PUT /api/chart/{id}/run-tasks requests.
+// @Summary Set chart run tasks
+// @Description Replaces the chart run tasks. Once the stage a task follows finished, deploys pause and POST a runTaskPayload with the plan (when planned) to the task URL, signed with the secret in X-Planemgr-Signature like webhook deliveries. The task answers by POSTing a runTaskCallback to callbackUrl with accessToken as the Authorization header. Deploys fail when a task reports "failed" or doesn't answer within its timeout, unless enforcement is "warn". A task keeps its secret when it is omitted. Once chart admins are set only they can change run tasks.
+// @Tags chart
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Param request body chartRunTasks true "Run tasks"
+// @Success 200 {object} chartRunTasks
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid_request`, `invalid_run_task`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/run-tasks [put]
+func HandleChartRunTasksPut(w http.ResponseWriter, r *http.Request, subject string) {
+	var req chartRunTasks
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "invalid JSON payload"})
+		return
+	}
+
+	chartID := r.PathValue("id")
+	permissions, err := loadChartPermissions(chartID)
+	if err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+	if len(permissions.Admins) > 0 && !slices.Contains(permissions.Admins, subject) {
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: "forbidden", Message: "only chart admins can change run tasks"})
+		return
+	}
+	current, err := loadChartRunTasks(chartID)
+	if err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+
+	names := map[string]bool{}
+	for i, task := range req.Tasks {
+		if err := validateRunTask(&task); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_run_task", Message: err.Error()})
+			return
+		}
+		if names[task.Name] {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_run_task", Message: "duplicate run task " + task.Name})
+			return
+		}
+		names[task.Name] = true
+		if task.Secret == "" {
+			for _, previous := range current.Tasks {
+				if previous.Name == task.Name {
+					task.Secret = previous.Secret
+				}
+			}
+		} else if task.Secret, err = sealChartSecret(task.Secret); err != nil {
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "chart_settings_failed", Message: err.Error()})
+			return
+		}
+		req.Tasks[i] = task
+	}
+	if req.Tasks == nil {
+		req.Tasks = []chartRunTask{}
+	}
+
+	if err := chart.WriteChartMeta(chartID, chartRunTasksMeta, req); err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+
+	for i := range req.Tasks {
+		req.Tasks[i].Secret = ""
+	}
+	writeJSON(w, http.StatusOK, req)
+}
+
+// HandleRunTaskCallback handles POST /api/run-tasks/{id} requests.
+// @Summary Report a run task result
+// @Description Completes a run task delivery. The Authorization header must hold the accessToken of the delivery instead of a user token.
+// @Tags deploy
+// @Accept json
+// @Param id path string true "Run task delivery ID"
+// @Param request body runTaskCallback true "Run task result"
+// @Success 204
+// @Failure 400 {object} errorResponse "`invalid_request`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 404 {object} errorResponse "`run_task_not_found`"
+// @Router /run-tasks/{id} [post]
+func HandleRunTaskCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+		return
+	}
+
+	runTaskRegistry.mu.Lock()
+	pending, ok := runTaskRegistry.pending[r.PathValue("id")]
+	runTaskRegistry.mu.Unlock()
+	if !ok {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "run_task_not_found"})
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(auth.BearerToken(r)), []byte(pending.token)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+
+	var callback runTaskCallback
+	if err := json.NewDecoder(r.Body).Decode(&callback); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "Invalid JSON payload"})
+		return
+	}
+	if callback.Status != runTaskStatusPassed && callback.Status != runTaskStatusFailed {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: `status must be "passed" or "failed"`})
+		return
+	}
+
+	select {
+	case pending.result <- callback:
+	default:
+		// The result was already reported.
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func validateRunTask(task *chartRunTask) error {
+	task.Name = strings.TrimSpace(task.Name)
+	if task.Name == "" || deploy.ValidateStackName(task.Name) != nil {
+		return fmt.Errorf("invalid run task name %q", task.Name)
+	}
+	if target, err := url.Parse(task.URL); err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("invalid url for run task %s", task.Name)
+	}
+	if task.After == "" {
+		task.After = deploy.StagePlan
+	}
+	if !slices.Contains(runTaskStages, task.After) {
+		return fmt.Errorf("run task %s can't follow stage %q", task.Name, task.After)
+	}
+	if task.Enforcement != "" && task.Enforcement != deploy.EnforceBlock && task.Enforcement != deploy.EnforceWarn {
+		return fmt.Errorf("unknown enforcement %q for run task %s", task.Enforcement, task.Name)
+	}
+	if task.TimeoutSeconds < 0 || time.Duration(task.TimeoutSeconds)*time.Second > maxRunTaskTimeout {
+		return fmt.Errorf("timeout of run task %s must be at most %d seconds", task.Name, int(maxRunTaskTimeout.Seconds()))
+	}
+	return nil
+}
+
+func loadChartRunTasks(chartID string) (chartRunTasks, error) {
+	tasks := chartRunTasks{Tasks: []chartRunTask{}}
+	if err := chart.ReadChartMeta(chartID, chartRunTasksMeta, &tasks); err != nil && !errors.Is(err, chart.ErrMetaNotFound) {
+		return chartRunTasks{}, err
+	}
+	return tasks, nil
+}
+
+// chartRunTaskGates returns a deploy gate for every stage run tasks of the
+// chart follow. Callbacks are addressed to the server the deploy was
+// requested from, unless PUBLIC_URL is set.
+func chartRunTaskGates(r *http.Request, chartID, ref, commit, stack, subject string) ([]deploy.Gate, error) {
+	tasks, err := loadChartRunTasks(chartID)
+	if err != nil || len(tasks.Tasks) == 0 {
+		return nil, err
+	}
+
+	base := runTaskPayload{
+		Event:       runTaskEvent,
+		ChartID:     chartID,
+		Ref:         ref,
+		Commit:      commit,
+		Stack:       stack,
+		Subject:     subject,
+		CallbackURL: publicBaseURL(r) + "/api/run-tasks/",
+	}
+	var gates []deploy.Gate
+	for _, stage := range runTaskStages {
+		var stageTasks []chartRunTask
+		for _, task := range tasks.Tasks {
+			if task.After == stage {
+				stageTasks = append(stageTasks, task)
+			}
+		}
+		if len(stageTasks) == 0 {
+			continue
+		}
+
+		gates = append(gates, deploy.Gate{
+			After: stage,
+			Evaluate: func(ctx context.Context, input deploy.GateInput) []deploy.PolicyResult {
+				payload := base
+				payload.Stage = input.Stage
+				payload.Plan = input.Plan
+
+				results := make([]deploy.PolicyResult, len(stageTasks))
+				var wg sync.WaitGroup
+				for i, task := range stageTasks {
+					wg.Go(func() {
+						results[i] = runChartRunTask(ctx, task, payload)
+					})
+				}
+				wg.Wait()
+				return results
+			},
+		})
+	}
+	return gates, nil
+}
+
+// runChartRunTask delivers the payload to the task and waits for its
+// callback.
+func runChartRunTask(ctx context.Context, task chartRunTask, payload runTaskPayload) deploy.PolicyResult {
+	fail := func(message string) deploy.PolicyResult {
+		result := deploy.PolicyResult{Name: task.Name, Outcome: deploy.PolicyBlocked, Message: message}
+		if task.Enforcement == deploy.EnforceWarn {
+			result.Outcome = deploy.PolicyWarned
+		}
+		return result
+	}
+
+	token := make([]byte, webhookSecretBytes)
+	if _, err := rand.Read(token); err != nil {
+		return fail("Generate access token: " + err.Error())
+	}
+	id := uuid.NewString()
+	pending := &pendingRunTask{token: hex.EncodeToString(token), result: make(chan runTaskCallback, 1)}
+	runTaskRegistry.mu.Lock()
+	runTaskRegistry.pending[id] = pending
+	runTaskRegistry.mu.Unlock()
+	defer func() {
+		runTaskRegistry.mu.Lock()
+		delete(runTaskRegistry.pending, id)
+		runTaskRegistry.mu.Unlock()
+	}()
+
+	payload.Task = task.Name
+	payload.CallbackURL += id
+	payload.AccessToken = pending.token
+	payload.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fail("Encode payload: " + err.Error())
+	}
+	if err := deliverWebhook(chartWebhook{URL: task.URL, Secret: task.Secret}, runTaskEvent, body); err != nil {
+		return fail("Deliver: " + err.Error())
+	}
+
+	timeout := defaultRunTaskTimeout
+	if task.TimeoutSeconds > 0 {
+		timeout = time.Duration(task.TimeoutSeconds) * time.Second
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case callback := <-pending.result:
+		if callback.Status == runTaskStatusPassed {
+			return deploy.PolicyResult{Name: task.Name, Outcome: deploy.PolicyPassed, Message: callback.Message}
+		}
+		return fail(callback.Message)
+	case <-timer.C:
+		return fail(fmt.Sprintf("No result within %s", timeout))
+	case <-ctx.Done():
+		return fail(ctx.Err().Error())
+	}
+}
+
+// publicBaseURL is the address external services reach the server at. Behind
+// a trusted proxy the scheme and host are the ones the proxy was reached at.
+func publicBaseURL(r *http.Request) string {
+	if value := strings.TrimRight(strings.TrimSpace(os.Getenv("PUBLIC_URL")), "/"); value != "" {
+		return value
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if r.URL.Scheme != "" {
+		scheme = r.URL.Scheme
+	}
+	return scheme + "://" + r.Host
+}
@@ -0,0 +1,434 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+	"github.com/mtolmacs/planemgr/internal/server/cron"
+	"github.com/mtolmacs/planemgr/internal/server/deploy"
+	"github.com/mtolmacs/planemgr/internal/server/user"
+)
+
+const (
+	chartSchedulesMeta = "schedules"
+	scheduleModePlan   = "plan"
+	scheduleModeApply  = "apply"
+)
+
+// chartSchedulesMu serializes updates of the schedule documents.
+var chartSchedulesMu sync.Mutex
+
+// chartSchedule deploys a chart ref on a cron schedule, as the subject who
+// created it.
+type chartSchedule struct {
+	ID           string `json:"id"`
+	Cron         string `json:"cron" example:"0 3 * * *"`
+	Timezone     string `json:"timezone,omitempty" example:"Europe/Berlin"` // UTC when empty
+	Ref          string `json:"ref,omitempty" example:"main"`               // The branch of the environment, or the chart default branch, when empty
+	Stack        string `json:"stack,omitempty"`
+	Environment  string `json:"environment,omitempty" example:"staging"`
+	Mode         string `json:"mode" enums:"plan,apply"`
+	Subject      string `json:"subject"` // Who created the schedule, and whom its runs deploy as
+	CreatedAt    string `json:"createdAt" example:"2026-01-02T15:04:05Z"`
+	NextRunAt    string `json:"nextRunAt" example:"2026-01-03T03:00:00Z"`
+	LastRunAt    string `json:"lastRunAt,omitempty" example:"2026-01-02T03:00:00Z"`
+	LastDeployID string `json:"lastDeployId,omitempty"`
+	LastError    string `json:"lastError,omitempty"` // Why the last run could not start
+}
+
+type chartScheduleRequest struct {
+	Cron        string `json:"cron" example:"0 3 * * *"`
+	Timezone    string `json:"timezone,omitempty" example:"Europe/Berlin"`
+	Ref         string `json:"ref,omitempty" example:"main"`
+	Stack       string `json:"stack,omitempty"`
+	Environment string `json:"environment,omitempty" example:"staging"`
+	Mode        string `json:"mode" enums:"plan,apply"`
+}
+
+type chartSchedulesResponse struct {
+	ChartID   string          `json:"chartId"`
+	Schedules []chartSchedule `json:"schedules"`
+}
+
+// HandleChartSchedules handles /api/chart/{id}/schedules requests.
+func HandleChartSchedules(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		HandleChartScheduleList(w, r)
+	case http.MethodPost:
+		HandleChartScheduleCreate(w, r, claims.Subject)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+	}
+}
+
+// HandleChartScheduleList handles GET /api/chart/{id}/schedules requests.
+// @Summary List chart schedules
+// @Description Returns the schedules deploying the chart, with when they run next and how their last run started.
+// @Tags chart
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Success 200 {object} chartSchedulesResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/schedules [get]
+func HandleChartScheduleList(w http.ResponseWriter, r *http.Request) {
+	chartID := r.PathValue("id")
+	schedules, err := loadChartSchedules(chartID)
+	if err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, chartSchedulesResponse{ChartID: chartID, Schedules: schedules})
+}
+
+// HandleChartScheduleCreate handles POST /api/chart/{id}/schedules requests.
+// @Summary Create chart schedule
+// @Description Plans or deploys a ref of the chart, or of one of its stacks, in an environment of the chart or without one, whenever the cron expression matches: five fields (minute, hour, day of month, month, day of week) or a macro such as @daily, in the timezone, UTC by default. Runs are queued like deploys requested by the creator of the schedule and appear in the deploy history; plan runs stop after the plan and policy stages and don't change the last deployment. A run missed while the server was down starts once when it is back. Runs of service accounts use their stored credentials. Runs of users need their session, so they fail while the user is logged out; the reason is kept as lastError.
+// @Tags chart
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Param request body chartScheduleRequest true "Schedule"
+// @Success 201 {object} chartSchedule
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid_request`, `invalid_schedule`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`, `environment_not_found`"
+// @Failure 409 {object} errorResponse "`chart_archived`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/schedules [post]
+func HandleChartScheduleCreate(w http.ResponseWriter, r *http.Request, subject string) {
+	var req chartScheduleRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "Invalid JSON payload"})
+		return
+	}
+	if req.Mode != scheduleModePlan && req.Mode != scheduleModeApply {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "mode must be plan or apply"})
+		return
+	}
+	if req.Stack != "" && deploy.ValidateStackName(req.Stack) != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: deploy.ErrInvalidStack.Error()})
+		return
+	}
+	if err := deploy.ValidateEnvironmentName(req.Environment); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: err.Error()})
+		return
+	}
+
+	schedule := chartSchedule{
+		ID:          uuid.NewString(),
+		Cron:        strings.TrimSpace(req.Cron),
+		Timezone:    req.Timezone,
+		Ref:         req.Ref,
+		Stack:       req.Stack,
+		Environment: req.Environment,
+		Mode:        req.Mode,
+		Subject:     subject,
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+	}
+	next, err := schedule.next(time.Now())
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_schedule", Message: err.Error()})
+		return
+	}
+	schedule.NextRunAt = next.UTC().Format(time.RFC3339)
+
+	chartID := r.PathValue("id")
+	archived, err := isChartArchived(chartID)
+	if err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+	if archived {
+		writeJSON(w, http.StatusConflict, errorResponse{Error: "chart_archived", Message: "archived charts cannot be deployed"})
+		return
+	}
+	if _, ok := chartDeployEnvironment(w, chartID, req.Environment); !ok {
+		return
+	}
+
+	chartSchedulesMu.Lock()
+	defer chartSchedulesMu.Unlock()
+	schedules, err := loadChartSchedules(chartID)
+	if err == nil {
+		err = chart.WriteChartMeta(chartID, chartSchedulesMeta, append(schedules, schedule))
+	}
+	if err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/chart/"+chartID+"/schedules/"+schedule.ID)
+	writeJSON(w, http.StatusCreated, schedule)
+}
+
+// HandleChartScheduleDelete handles DELETE /api/chart/{id}/schedules/{scheduleId} requests.
+// @Summary Delete chart schedule
+// @Description Stops the schedule. Runs it already started keep running.
+// @Tags chart
+// @Security BearerAuth
+// @Param id path string true "Chart ID"
+// @Param scheduleId path string true "Schedule ID"
+// @Success 200 {object} emptyResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`schedule_not_found`, `chart_not_found`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/schedules/{scheduleId} [delete]
+func HandleChartScheduleDelete(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.RequireAccessTokenClaims(r); err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", "DELETE")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+		return
+	}
+
+	chartID := r.PathValue("id")
+	scheduleID := r.PathValue("scheduleId")
+	chartSchedulesMu.Lock()
+	defer chartSchedulesMu.Unlock()
+
+	schedules, err := loadChartSchedules(chartID)
+	if err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+	remaining := slices.DeleteFunc(slices.Clone(schedules), func(schedule chartSchedule) bool { return schedule.ID == scheduleID })
+	if len(remaining) == len(schedules) {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "schedule_not_found"})
+		return
+	}
+	if err := chart.WriteChartMeta(chartID, chartSchedulesMeta, remaining); err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, emptyResponse{})
+}
+
+func loadChartSchedules(chartID string) ([]chartSchedule, error) {
+	schedules := []chartSchedule{}
+	if err := chart.ReadChartMeta(chartID, chartSchedulesMeta, &schedules); err != nil && !errors.Is(err, chart.ErrMetaNotFound) {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+// next returns when the schedule runs first after after.
+func (s chartSchedule) next(after time.Time) (time.Time, error) {
+	expr, err := cron.Parse(s.Cron)
+	if err != nil {
+		return time.Time{}, err
+	}
+	location, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unknown timezone %q", s.Timezone)
+	}
+	next := expr.Next(after.In(location))
+	if next.IsZero() {
+		return time.Time{}, errors.New("the cron expression never matches")
+	}
+	return next, nil
+}
+
+// StartDeploySchedules starts the runs of the chart schedules due at the
+// start of every minute.
+func StartDeploySchedules() {
+	go func() {
+		for {
+			now := time.Now()
+			time.Sleep(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+			runDueChartSchedules(time.Now())
+		}
+	}()
+}
+
+func runDueChartSchedules(now time.Time) {
+	chartIDs, err := chart.ListChartRepos()
+	if err != nil {
+		log.Printf("Listing charts for scheduled deploys failed: %v", err)
+		return
+	}
+
+	for _, chartID := range chartIDs {
+		for _, schedule := range takeDueChartSchedules(chartID, now) {
+			deployID, err := startChartSchedule(chartID, schedule)
+			if err != nil {
+				log.Printf("Scheduled deploy %s of chart %s could not start: %v", schedule.ID, chartID, err)
+			}
+			updateChartSchedule(chartID, schedule.ID, func(s *chartSchedule) {
+				s.LastDeployID = deployID
+				s.LastError = ""
+				if err != nil {
+					s.LastError = err.Error()
+				}
+			})
+		}
+	}
+}
+
+// takeDueChartSchedules returns the schedules of a chart due at now and moves
+// them on to their next run.
+func takeDueChartSchedules(chartID string, now time.Time) []chartSchedule {
+	chartSchedulesMu.Lock()
+	defer chartSchedulesMu.Unlock()
+	schedules, err := loadChartSchedules(chartID)
+	if err != nil {
+		log.Printf("Loading schedules of chart %s failed: %v", chartID, err)
+		return nil
+	}
+
+	var due []chartSchedule
+	for i, schedule := range schedules {
+		nextRunAt, err := time.Parse(time.RFC3339, schedule.NextRunAt)
+		if err != nil || nextRunAt.After(now) {
+			continue
+		}
+		next, err := schedule.next(now)
+		if err != nil {
+			continue
+		}
+		schedules[i].NextRunAt = next.UTC().Format(time.RFC3339)
+		schedules[i].LastRunAt = now.UTC().Format(time.RFC3339)
+		due = append(due, schedules[i])
+	}
+	if len(due) == 0 {
+		return nil
+	}
+	if err := chart.WriteChartMeta(chartID, chartSchedulesMeta, schedules); err != nil {
+		log.Printf("Updating schedules of chart %s failed: %v", chartID, err)
+		return nil
+	}
+	return due
+}
+
+func updateChartSchedule(chartID, scheduleID string, update func(*chartSchedule)) {
+	chartSchedulesMu.Lock()
+	defer chartSchedulesMu.Unlock()
+	schedules, err := loadChartSchedules(chartID)
+	if err != nil {
+		log.Printf("Loading schedules of chart %s failed: %v", chartID, err)
+		return
+	}
+	i := slices.IndexFunc(schedules, func(s chartSchedule) bool { return s.ID == scheduleID })
+	if i < 0 {
+		return
+	}
+	update(&schedules[i])
+	if err := chart.WriteChartMeta(chartID, chartSchedulesMeta, schedules); err != nil {
+		log.Printf("Updating schedules of chart %s failed: %v", chartID, err)
+	}
+}
+
+// startChartSchedule queues a run of a schedule as a deploy requested by
+// its creator, and returns the deploy ID.
+func startChartSchedule(chartID string, schedule chartSchedule) (string, error) {
+	opts := deployOptions{PlanOnly: schedule.Mode == scheduleModePlan, Environment: schedule.Environment}
+	job, err := startBackgroundDeploy(chartID, schedule.Subject, schedule.Ref, schedule.Stack, opts)
+	if err != nil {
+		return "", err
+	}
+	return job.id, nil
+}
+
+// startBackgroundDeploy queues a deploy the server starts on its own, such
+// as a scheduled run, as requested by subject.
+func startBackgroundDeploy(chartID, subject, ref, stack string, opts deployOptions) (*deployJob, error) {
+	token, err := scheduleAccessToken(subject, chartID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The run goes through the checks of a deploy request, which answer it
+	// when they fail.
+	target := "http://localhost:" + cmp.Or(os.Getenv("API_PORT"), "4000") + "/api/chart/" + chartID
+	r, err := http.NewRequest(http.MethodPost, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Authorization", token)
+	recorder := httptest.NewRecorder()
+
+	deployReq, pipeline, ok := prepareDeploy(recorder, r, subject, chartID, ref, stack, opts)
+	if !ok {
+		var response errorResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil || response.Error == "" {
+			return nil, fmt.Errorf("deploy request failed with status %d", recorder.Code)
+		}
+		return nil, errors.New(strings.TrimSuffix(response.Error+": "+response.Message, ": "))
+	}
+	ticket, ok := enqueueDeploy(chartID, opts.Environment, stack, len(opts.AgentLabels) == 0)
+	if !ok {
+		return nil, errors.New("chart_busy: the chart is being deleted or squashed")
+	}
+
+	return startDeploy(context.Background(), ticket, deployReq, pipeline, opts), nil
+}
+
+// scheduleAccessToken returns an access token of subject for a run the
+// server starts on its own. Service accounts are logged in with their
+// stored credentials and need the deployer role on the chart; users need to
+// be logged in.
+func scheduleAccessToken(subject, chartID string) (string, error) {
+	name, ok := strings.CutPrefix(subject, auth.ServiceAccountPrefix)
+	if !ok {
+		token, err := auth.IssueAccessToken(subject, nil)
+		if err != nil {
+			return "", fmt.Errorf("%s can't deploy: %w", subject, err)
+		}
+		return token, nil
+	}
+
+	account, err := user.LoadServiceAccount(name)
+	if err != nil {
+		return "", fmt.Errorf("service account %s can't deploy: %w", name, err)
+	}
+	if !auth.AllowsRole(account.Roles, auth.RoleDeployer, chartID) {
+		return "", fmt.Errorf("service account %s can't deploy: %w", name, auth.ErrForbidden)
+	}
+	_, privateKey, err := user.LoadServiceAccountKeyPair(account)
+	if err != nil {
+		return "", err
+	}
+	auth.StoreServiceSession(subject, privateKey)
+	tokens, err := auth.IssueServiceTokens(subject, account.Roles)
+	if err != nil {
+		return "", err
+	}
+	return tokens.AccessToken, nil
+}
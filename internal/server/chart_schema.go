@@ -0,0 +1,173 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+	"github.com/mtolmacs/planemgr/internal/server/deploy"
+	"github.com/mtolmacs/planemgr/internal/server/user"
+)
+
+const chartSchemaMeta = "provider-schema"
+
+// chartSchemaLocks serializes schema generation per module, so concurrent
+// editor requests share one runner.
+var chartSchemaLocks sync.Map
+
+// chartSchema caches the provider schemas of a module. Schemas only change
+// with the locked providers, so the cache is keyed by the lock file, or by
+// the commit for modules without one.
+type chartSchema struct {
+	ChartID     string          `json:"chartId"`
+	Stack       string          `json:"stack,omitempty"`
+	Ref         string          `json:"ref"`
+	CacheKey    string          `json:"cacheKey"`
+	GeneratedAt string          `json:"generatedAt"`
+	Schema      json.RawMessage `json:"schema" swaggertype:"object"`
+}
+
+// Handle GET /api/chart/{id}/schema requests.
+// @Summary Get provider schemas
+// @Description Returns the `tofu providers schema -json` document of a chart module for editor completion and validation. Schemas are generated in the runner on first use and cached until the module lock file changes.
+// @Tags chart
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Param ref query string false "Git ref (defaults to HEAD)"
+// @Param stack query string false "Stack directory (defaults to the root module)"
+// @Param refresh query bool false "Regenerate the schemas even if cached"
+// @Success 200 {object} chartSchema
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid_request`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`, `ssh_key_required`"
+// @Failure 404 {object} errorResponse "`chart_not_found`, `ref_not_found`"
+// @Failure 500 {object} errorResponse "`key_load_failed`, `schema_failed`"
+// @Failure 502 {object} errorResponse "`schema_failed`"
+// @Router /chart/{id}/schema [get]
+func HandleChartSchema(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+		return
+	}
+
+	chartID := r.PathValue("id")
+	query := r.URL.Query()
+	stack := query.Get("stack")
+	if err := deploy.ValidateStackName(stack); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: err.Error()})
+		return
+	}
+
+	ref, err := chart.ResolveChartRef(chartID, query.Get("ref"))
+	if err != nil {
+		writeChartSchemaError(w, err)
+		return
+	}
+	key, err := chartSchemaKey(chartID, stack, ref)
+	if err != nil {
+		writeChartSchemaError(w, err)
+		return
+	}
+
+	lock, _ := chartSchemaLocks.LoadOrStore(chartID+"/"+stack, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	meta := chartSchemaMeta
+	if stack != "" {
+		meta += "-" + stack
+	}
+	var cached chartSchema
+	err = chart.ReadChartMeta(chartID, meta, &cached)
+	if err == nil && cached.CacheKey == key && query.Get("refresh") != "true" {
+		writeJSON(w, http.StatusOK, cached)
+		return
+	}
+	if err != nil && !errors.Is(err, chart.ErrMetaNotFound) {
+		writeChartSchemaError(w, err)
+		return
+	}
+
+	privateKey, ok := requirePrivateKey(w, claims.Subject)
+	if !ok {
+		return
+	}
+	publicKey, err := user.LoadUserPublicKey(claims.Subject)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "key_load_failed", Message: err.Error()})
+		return
+	}
+
+	schema, err := deploy.ProviderSchemas(r.Context(), deploy.Request{
+		Token:      auth.BearerToken(r),
+		ChartID:    chartID,
+		Ref:        ref,
+		Stack:      stack,
+		Subject:    claims.Subject,
+		PublicKey:  publicKey,
+		PrivateKey: privateKey,
+	})
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, errorResponse{Error: "schema_failed", Message: err.Error()})
+		return
+	}
+
+	cached = chartSchema{
+		ChartID:     chartID,
+		Stack:       stack,
+		Ref:         ref,
+		CacheKey:    key,
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+		Schema:      schema,
+	}
+	if err := chart.WriteChartMeta(chartID, meta, cached); err != nil {
+		writeChartSchemaError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, cached)
+}
+
+// chartSchemaKey identifies the providers of a module at ref: the hash of its
+// lock file, or the commit when it has none.
+func chartSchemaKey(chartID, stack, ref string) (string, error) {
+	_, contents, err := chart.ReadChartFile(chartID, path.Join(stack, chart.LockfileName), ref)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return "commit:" + ref, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(contents))
+	return "lock:" + hex.EncodeToString(sum[:]), nil
+}
+
+func writeChartSchemaError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist):
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "chart_not_found"})
+	case errors.Is(err, plumbing.ErrReferenceNotFound):
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "ref_not_found"})
+	default:
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "schema_failed", Message: err.Error()})
+	}
+}
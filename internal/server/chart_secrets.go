@@ -0,0 +1,222 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+	"github.com/mtolmacs/planemgr/internal/server/deploy"
+	"github.com/mtolmacs/planemgr/internal/server/user"
+)
+
+const chartSecretsMeta = "secrets"
+
+// chartSecretEnv maps secrets into the runner environment of deploys of the
+// chart. Values stay in the secret store; only the names are kept here.
+type chartSecretEnv struct {
+	Env []chartSecretRef `json:"env"`
+}
+
+// chartSecretRef exports a secret as an environment variable to deploys of
+// a stack. The root module is the empty stack name and "*" applies to every
+// module. Refs without an environment apply to deploys to any environment.
+type chartSecretRef struct {
+	Name        string `json:"name" example:"AWS_SECRET_ACCESS_KEY"` // Environment variable
+	Secret      string `json:"secret" example:"aws-secret-key"`
+	Stack       string `json:"stack"`
+	Environment string `json:"environment,omitempty" example:"prod"`
+}
+
+// HandleChartSecrets handles /api/chart/{id}/secrets requests.
+func HandleChartSecrets(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		HandleChartSecretsGet(w, r)
+	case http.MethodPut:
+		HandleChartSecretsPut(w, r, claims.Subject)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+	}
+}
+
+// HandleChartSecretsGet handles GET /api/chart/{id}/secrets requests.
+// @Summary Get chart secret environment
+// @Description Returns the secrets deploys of the chart export to their runner, by environment variable.
+// @Tags chart
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Success 200 {object} chartSecretEnv
+// @Failure 400 {object} errorResponse "`invalid chart id`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/secrets [get]
+func HandleChartSecretsGet(w http.ResponseWriter, r *http.Request) {
+	secrets, err := loadChartSecretEnv(r.PathValue("id"))
+	if err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, secrets)
+}
+
+// HandleChartSecretsPut handles PUT /api/chart/{id}/secrets requests.
+// @Summary Set chart secret environment
+// @Description Replaces the secrets deploys of the chart export to their runner. Secrets are looked up by name in the secret store of the chart deploy account when it is bound to one, or else of the user deploying, and deploys fail with secret_not_found when it lacks one. Values are masked in the deploy output. Sandbox deploys get no secrets. Variables mapped for an environment override those mapped for every environment in deploys to it. Once chart admins are set only they can change the secret environment.
+// @Tags chart
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Param request body chartSecretEnv true "Secret environment"
+// @Success 200 {object} chartSecretEnv
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid_request`, `invalid_secret`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/secrets [put]
+func HandleChartSecretsPut(w http.ResponseWriter, r *http.Request, subject string) {
+	var req chartSecretEnv
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "invalid JSON payload"})
+		return
+	}
+
+	chartID := r.PathValue("id")
+	permissions, err := loadChartPermissions(chartID)
+	if err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+	if len(permissions.Admins) > 0 && !slices.Contains(permissions.Admins, subject) {
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: "forbidden", Message: "only chart admins can change the secret environment"})
+		return
+	}
+
+	seen := map[string]bool{}
+	for i, ref := range req.Env {
+		ref.Name = strings.TrimSpace(ref.Name)
+		ref.Stack = strings.TrimSpace(ref.Stack)
+		ref.Environment = strings.TrimSpace(ref.Environment)
+		if err := deploy.ValidateSecretEnv(ref.Name); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_secret", Message: err.Error()})
+			return
+		}
+		if err := user.ValidateSecretName(ref.Secret); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_secret", Message: err.Error()})
+			return
+		}
+		if ref.Stack != allStacks && deploy.ValidateStackName(ref.Stack) != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_secret", Message: "invalid stack " + ref.Stack})
+			return
+		}
+		if err := deploy.ValidateEnvironmentName(ref.Environment); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_secret", Message: err.Error()})
+			return
+		}
+		key := ref.Environment + "@" + ref.Stack + "/" + ref.Name
+		if seen[key] {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_secret", Message: "duplicate variable " + ref.Name})
+			return
+		}
+		seen[key] = true
+		req.Env[i] = ref
+	}
+	if req.Env == nil {
+		req.Env = []chartSecretRef{}
+	}
+
+	if err := chart.WriteChartMeta(chartID, chartSecretsMeta, req); err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, req)
+}
+
+func loadChartSecretEnv(chartID string) (chartSecretEnv, error) {
+	secrets := chartSecretEnv{Env: []chartSecretRef{}}
+	if err := chart.ReadChartMeta(chartID, chartSecretsMeta, &secrets); err != nil && !errors.Is(err, chart.ErrMetaNotFound) {
+		return chartSecretEnv{}, err
+	}
+	return secrets, nil
+}
+
+// chartDeploySecrets resolves the secrets a deploy of stack to environment
+// exports, keyed by environment variable. The chart secret environment is read from the
+// store of its deploy account when bound, or else of the deploying subject;
+// the secrets the request maps are always those of the subject and take
+// precedence. It writes the error and returns false when a secret is
+// missing.
+func chartDeploySecrets(w http.ResponseWriter, chartID, environment, stack, subject string, requested map[string]string) (map[string]string, bool) {
+	env, err := loadChartSecretEnv(chartID)
+	if err != nil {
+		writeChartMetaError(w, err)
+		return nil, false
+	}
+	binding, err := loadChartDeployAccount(chartID)
+	if err != nil {
+		writeChartMetaError(w, err)
+		return nil, false
+	}
+	owner := subject
+	if binding != nil {
+		owner = auth.ServiceAccountPrefix + binding.ServiceAccount
+	}
+
+	chartNames := map[string]string{}
+	// Variables of the environment override those of every environment, and
+	// stack-specific variables those of every module.
+	for _, scope := range []struct{ environment, stack string }{{"", allStacks}, {"", stack}, {environment, allStacks}, {environment, stack}} {
+		for _, ref := range env.Env {
+			if ref.Environment == scope.environment && ref.Stack == scope.stack {
+				chartNames[ref.Name] = ref.Secret
+			}
+		}
+	}
+	for name := range requested {
+		if err := deploy.ValidateSecretEnv(name); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: err.Error()})
+			return nil, false
+		}
+		delete(chartNames, name)
+	}
+
+	secrets := map[string]string{}
+	for _, source := range []struct {
+		owner string
+		names map[string]string
+	}{{owner, chartNames}, {subject, requested}} {
+		values, err := user.LoadSecretValues(source.owner, slices.Collect(maps.Values(source.names)))
+		if errors.Is(err, user.ErrSecretNotFound) {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "secret_not_found", Message: fmt.Sprintf("%s of %s", err, source.owner)})
+			return nil, false
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "secrets_load_failed", Message: err.Error()})
+			return nil, false
+		}
+		for name, secret := range source.names {
+			secrets[name] = values[secret]
+		}
+	}
+	return secrets, true
+}
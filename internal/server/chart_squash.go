@@ -0,0 +1,177 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+	"github.com/mtolmacs/planemgr/internal/server/deploy"
+)
+
+type chartSquashRequest struct {
+	Before  string `json:"before" example:"2025-01-01T00:00:00Z"` // RFC 3339 cutoff
+	Message string `json:"message,omitempty"`                     // Message of the baseline commit, summarizing the squash by default
+	DryRun  bool   `json:"dryRun,omitempty"`
+}
+
+type chartSquashResponse struct {
+	ChartID  string   `json:"chartId"`
+	Baseline string   `json:"baseline"`
+	Squashed int      `json:"squashed"`
+	Refs     []string `json:"refs"`
+	DryRun   bool     `json:"dryRun,omitempty"`
+}
+
+// Handle POST /api/chart/{id}/squash requests.
+// @Summary Squash old chart history
+// @Description Replaces the history of the chart branch before the cutoff with a single baseline commit holding the content of the newest commit before it, then prunes the removed objects. Commits that branches, tags or the last deploy of a stack point to are kept on top of the baseline. Later commits keep their content, author and message but get new hashes; branches, tags and recorded deploys are moved to them. With dryRun only the number of commits that would be squashed is returned, and baseline is the commit that would be squashed into. The baseline commit gets message, which defaults to a summary of the squash. Once chart admins are set only they can squash, and deploys of the chart can't run meanwhile.
+// @Tags chart
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Param request body chartSquashRequest true "Cutoff"
+// @Success 200 {object} chartSquashResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid_request`, `nothing_to_squash`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`"
+// @Failure 409 {object} errorResponse "`deploy_in_progress`, `history_changed`"
+// @Failure 422 {object} errorResponse "`commit rejected by policy`"
+// @Failure 423 {object} errorResponse "`chart_locked`"
+// @Failure 500 {object} errorResponse "`squash_failed`, `chart_settings_failed`"
+// @Router /chart/{id}/squash [post]
+func HandleChartSquash(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+		return
+	}
+
+	var req chartSquashRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "invalid JSON payload"})
+		return
+	}
+	before, err := time.Parse(time.RFC3339, req.Before)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "before must be an RFC 3339 timestamp"})
+		return
+	}
+
+	chartID := r.PathValue("id")
+	if !requireChartUnlocked(w, chartID, claims.Subject) {
+		return
+	}
+	permissions, err := loadChartPermissions(chartID)
+	if err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+	if len(permissions.Admins) > 0 && !slices.Contains(permissions.Admins, claims.Subject) {
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: "forbidden", Message: "only chart admins can squash history"})
+		return
+	}
+
+	// Deploys clone commits that may be pruned, so none may run meanwhile.
+	if !tryAcquireChartDeleteLock(chartID) {
+		writeJSON(w, http.StatusConflict, errorResponse{Error: "deploy_in_progress", Message: "chart is being deployed"})
+		return
+	}
+	defer releaseChartDeleteLock(chartID)
+
+	chartDeploymentsMu.Lock()
+	defer chartDeploymentsMu.Unlock()
+	deployments, err := loadChartDeployments(chartID)
+	if err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+	// Successful deploys in the history stay rollback targets.
+	runs, err := loadChartDeployHistory(chartID)
+	if err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+	keep := make([]string, 0, len(deployments)+len(runs))
+	for _, deployment := range deployments {
+		if deployment.Commit != "" {
+			keep = append(keep, deployment.Commit)
+		}
+	}
+	for _, run := range runs {
+		if run.Commit != "" && run.Status == deploy.StatusSucceeded && !run.Sandbox && !run.PlanOnly {
+			keep = append(keep, run.Commit)
+		}
+	}
+
+	result, err := chart.SquashChartHistory(chartID, before, keep, strings.TrimSpace(req.Message), req.DryRun)
+	if err != nil {
+		if writeCommitPolicyError(w, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, chart.ErrNothingToSquash):
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "nothing_to_squash", Message: err.Error()})
+		case errors.Is(err, chart.ErrHistoryChanged):
+			writeJSON(w, http.StatusConflict, errorResponse{Error: "history_changed", Message: err.Error()})
+		case errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist):
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "chart_not_found"})
+		default:
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "squash_failed", Message: err.Error()})
+		}
+		return
+	}
+
+	if !req.DryRun {
+		publishChartChange(chartID)
+		for _, ref := range result.Refs {
+			publishChartRefEvent(chartID, plumbing.ReferenceName(ref), "", "updated")
+		}
+	}
+	if !req.DryRun && len(deployments) > 0 {
+		for i, deployment := range deployments {
+			if next, ok := result.Rewritten[deployment.Commit]; ok {
+				deployments[i].Commit = next
+			}
+		}
+		if err := chart.WriteChartMeta(chartID, chartDeploymentsMeta, deployments); err != nil {
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "squash_failed", Message: "history squashed but recorded deploys not updated: " + err.Error()})
+			return
+		}
+	}
+	if !req.DryRun && len(runs) > 0 {
+		for i, run := range runs {
+			if next, ok := result.Rewritten[run.Commit]; ok {
+				runs[i].Commit = next
+			}
+		}
+		if err := chart.WriteChartMeta(chartID, chartDeployHistoryMeta, runs); err != nil {
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "squash_failed", Message: "history squashed but deploy history not updated: " + err.Error()})
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, chartSquashResponse{
+		ChartID:  chartID,
+		Baseline: result.Baseline,
+		Squashed: result.Squashed,
+		Refs:     result.Refs,
+		DryRun:   req.DryRun,
+	})
+}
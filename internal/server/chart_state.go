@@ -0,0 +1,478 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+	"github.com/mtolmacs/planemgr/internal/server/deploy"
+)
+
+// maxChartStateBytes caps the state tofu may store for a stack.
+const maxChartStateBytes = 64 << 20
+
+// chartStateLease lets a running deploy use the state of the stack it
+// deploys, and only while it runs.
+type chartStateLease struct {
+	chartID     string
+	environment string
+	stack       string
+	password    string
+}
+
+// chartStateLock is a lock tofu holds on the state of a stack.
+type chartStateLock struct {
+	id    string
+	info  json.RawMessage // As tofu sent it, returned to whoever finds it locked
+	owner string          // Deploy ID holding the lock, empty for users
+}
+
+type chartStateVersionsResponse struct {
+	ChartID     string                    `json:"chartId"`
+	Environment string                    `json:"environment,omitempty"`
+	Stack       string                    `json:"stack,omitempty"`
+	Versions    []chart.ChartStateVersion `json:"versions"`
+}
+
+// chartStates holds the deploy leases and the state locks. Both live in
+// memory, so locks held across a restart are released.
+var chartStates = struct {
+	mu     sync.Mutex
+	leases map[string]chartStateLease // By deploy ID
+	locks  map[string]chartStateLock  // By deployLockKey
+}{
+	leases: map[string]chartStateLease{},
+	locks:  map[string]chartStateLock{},
+}
+
+// managedChartState returns the state backend credentials of a deploy, or
+// nil when its module configures a backend of its own.
+func managedChartState(deployReq deploy.Request) (*deploy.StateBackend, error) {
+	declared, err := chart.ChartDeclaresBackend(deployReq.ChartID, deployReq.Commit, deployReq.Stack)
+	if err != nil || declared {
+		return nil, err
+	}
+
+	password := make([]byte, webhookSecretBytes)
+	if _, err := rand.Read(password); err != nil {
+		return nil, err
+	}
+	return &deploy.StateBackend{Username: deployReq.DeployID, Password: hex.EncodeToString(password)}, nil
+}
+
+// leaseChartState lets the runner of deployReq use its managed state until
+// the returned function is called, which also releases the locks the runner
+// left behind.
+func leaseChartState(deployReq deploy.Request) func() {
+	if deployReq.State == nil {
+		return func() {}
+	}
+
+	chartStates.mu.Lock()
+	chartStates.leases[deployReq.DeployID] = chartStateLease{
+		chartID:     deployReq.ChartID,
+		environment: deployReq.Environment,
+		stack:       deployReq.Stack,
+		password:    deployReq.State.Password,
+	}
+	chartStates.mu.Unlock()
+
+	return func() {
+		chartStates.mu.Lock()
+		defer chartStates.mu.Unlock()
+		delete(chartStates.leases, deployReq.DeployID)
+		key := deployLockKey(deployReq.ChartID, deployReq.Environment, deployReq.Stack)
+		if lock, ok := chartStates.locks[key]; ok && lock.owner == deployReq.DeployID {
+			delete(chartStates.locks, key)
+		}
+	}
+}
+
+// HandleChartState handles /api/chart/{id}/state requests.
+// @Summary Managed OpenTofu state of a chart
+// @Description Serves the OpenTofu state of the chart root module as an http state backend. Deploys of modules without a backend of their own use it with credentials valid while they run; users can point tofu at it with the username access and an access token as password. GET returns the state, or 204 before the first apply, with format=resources an inventory of its resources and outputs without sensitive values, and with format=raw the state as a file to download; POST replaces it; DELETE removes it. LOCK and UNLOCK take and release the state lock with the lock info of tofu, answering 423 with the current lock info while another holder has it. Each environment of the chart has a state of its own, addressed with environment. Locks are lost when the server restarts.
+// @Tags chart
+// @Security BearerAuth
+// @Param id path string true "Chart ID"
+// @Param environment query string false "Chart environment, the state of deploys without one when empty"
+// @Param format query string false "On GET, resources for an inventory of the resources and outputs in the state, leaving out sensitive values, or raw to download the state as a file" Enums(raw, resources)
+// @Success 200 {object} chartStateInventory "The state, or its inventory with format=resources"
+// @Success 204 "No state was stored yet"
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid_request`, `invalid_state`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`"
+// @Failure 409 {object} map[string]any "Lock info of the holder when unlocking with another lock ID"
+// @Failure 413 {object} errorResponse "`state_too_large`"
+// @Failure 422 {object} errorResponse "`invalid_state` when the state can't be listed"
+// @Failure 423 {object} map[string]any "Lock info of the holder"
+// @Failure 500 {object} errorResponse "`state_failed`"
+// @Router /chart/{id}/state [get]
+func HandleChartState(w http.ResponseWriter, r *http.Request) {
+	handleChartState(w, r, r.PathValue("id"), "")
+}
+
+// HandleChartStackState handles /api/chart/{id}/stack/{name}/state requests.
+// @Summary Managed OpenTofu state of a stack
+// @Description Serves the OpenTofu state of a stack as an http state backend, like the state of the chart root module.
+// @Tags chart
+// @Security BearerAuth
+// @Param id path string true "Chart ID"
+// @Param name path string true "Stack directory name"
+// @Param environment query string false "Chart environment, the state of deploys without one when empty"
+// @Param format query string false "On GET, resources for an inventory of the state or raw to download it" Enums(raw, resources)
+// @Success 200 {object} chartStateInventory "The state, or its inventory with format=resources"
+// @Success 204 "No state was stored yet"
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid_request`, `invalid_state`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`"
+// @Failure 409 {object} map[string]any "Lock info of the holder when unlocking with another lock ID"
+// @Failure 413 {object} errorResponse "`state_too_large`"
+// @Failure 422 {object} errorResponse "`invalid_state` when the state can't be listed"
+// @Failure 423 {object} map[string]any "Lock info of the holder"
+// @Failure 500 {object} errorResponse "`state_failed`"
+// @Router /chart/{id}/stack/{name}/state [get]
+func HandleChartStackState(w http.ResponseWriter, r *http.Request) {
+	if stack, ok := chartStateStack(w, r); ok {
+		handleChartState(w, r, r.PathValue("id"), stack)
+	}
+}
+
+func handleChartState(w http.ResponseWriter, r *http.Request, chartID, stack string) {
+	environment, ok := chartStateEnvironment(w, r)
+	if !ok {
+		return
+	}
+	owner, ok := authorizeChartState(r, chartID, environment, stack)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="planemgr"`)
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+
+	key := deployLockKey(chartID, environment, stack)
+	switch r.Method {
+	case http.MethodGet:
+		format := r.URL.Query().Get("format")
+		if format != "" && format != "raw" && format != "resources" {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "format must be raw or resources"})
+			return
+		}
+		data, err := chart.ReadChartState(chartID, environment, stack)
+		if errors.Is(err, chart.ErrStateNotFound) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if err != nil {
+			writeChartStateError(w, err)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		switch format {
+		case "resources":
+			inventory, err := parseChartStateInventory(data)
+			if err != nil {
+				writeJSON(w, http.StatusUnprocessableEntity, errorResponse{Error: "invalid_state", Message: err.Error()})
+				return
+			}
+			inventory.ChartID, inventory.Environment, inventory.Stack = chartID, environment, stack
+			writeJSON(w, http.StatusOK, inventory)
+			return
+		case "raw":
+			filename := chartID
+			for _, part := range []string{environment, stack} {
+				if part != "" {
+					filename += "-" + part
+				}
+			}
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".tfstate"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	case http.MethodPost:
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxChartStateBytes))
+		if err != nil {
+			writeJSON(w, http.StatusRequestEntityTooLarge, errorResponse{Error: "state_too_large", Message: "state is larger than 64 MiB"})
+			return
+		}
+		if !json.Valid(data) {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_state", Message: "state must be JSON"})
+			return
+		}
+
+		// The lock is held while writing, so a lock taken meanwhile can't
+		// see the state change under it.
+		chartStates.mu.Lock()
+		defer chartStates.mu.Unlock()
+		if lock, ok := chartStates.locks[key]; ok && lock.id != r.URL.Query().Get("ID") {
+			writeChartStateLock(w, http.StatusLocked, lock)
+			return
+		}
+		if err := chart.WriteChartState(chartID, environment, stack, data); err != nil {
+			writeChartStateError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		chartStates.mu.Lock()
+		defer chartStates.mu.Unlock()
+		if lock, ok := chartStates.locks[key]; ok && lock.id != r.URL.Query().Get("ID") {
+			writeChartStateLock(w, http.StatusLocked, lock)
+			return
+		}
+		if err := chart.DeleteChartState(chartID, environment, stack); err != nil {
+			writeChartStateError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case "LOCK", "UNLOCK":
+		info, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		var lockInfo struct {
+			ID string `json:"ID"`
+		}
+		if err != nil || json.Unmarshal(info, &lockInfo) != nil || lockInfo.ID == "" {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "lock info with an ID is required"})
+			return
+		}
+		if _, err := chart.ReadChartHead(chartID); err != nil {
+			writeChartStateError(w, err)
+			return
+		}
+
+		chartStates.mu.Lock()
+		defer chartStates.mu.Unlock()
+		lock, locked := chartStates.locks[key]
+		if r.Method == "LOCK" {
+			if locked {
+				writeChartStateLock(w, http.StatusLocked, lock)
+				return
+			}
+			chartStates.locks[key] = chartStateLock{id: lockInfo.ID, info: info, owner: owner}
+		} else if locked {
+			if lock.id != lockInfo.ID {
+				writeChartStateLock(w, http.StatusConflict, lock)
+				return
+			}
+			delete(chartStates.locks, key)
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE, LOCK, UNLOCK")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+	}
+}
+
+// HandleChartStateVersions handles GET /api/chart/{id}/state/versions requests.
+// @Summary List state versions of a chart
+// @Description Lists the kept versions of the OpenTofu state of the chart root module, newest first. Every state written is kept as a version, the newest being the current state, up to the last 50; removing the state keeps them. Push a version back with tofu state push to roll back.
+// @Tags chart
+// @Security BearerAuth
+// @Param id path string true "Chart ID"
+// @Param environment query string false "Chart environment, the state of deploys without one when empty"
+// @Success 200 {object} chartStateVersionsResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`"
+// @Failure 500 {object} errorResponse "`state_failed`"
+// @Router /chart/{id}/state/versions [get]
+func HandleChartStateVersions(w http.ResponseWriter, r *http.Request) {
+	handleChartStateVersions(w, r, r.PathValue("id"), "")
+}
+
+// HandleChartStateVersion handles GET /api/chart/{id}/state/versions/{version} requests.
+// @Summary Get a state version of a chart
+// @Description Returns a kept version of the OpenTofu state of the chart root module.
+// @Tags chart
+// @Security BearerAuth
+// @Param id path string true "Chart ID"
+// @Param environment query string false "Chart environment, the state of deploys without one when empty"
+// @Param version path int true "State version"
+// @Success 200 {object} map[string]any
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid_request`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`, `state_version_not_found`"
+// @Failure 500 {object} errorResponse "`state_failed`"
+// @Router /chart/{id}/state/versions/{version} [get]
+func HandleChartStateVersion(w http.ResponseWriter, r *http.Request) {
+	handleChartStateVersion(w, r, r.PathValue("id"), "")
+}
+
+// HandleChartStackStateVersions handles GET /api/chart/{id}/stack/{name}/state/versions requests.
+// @Summary List state versions of a stack
+// @Description Lists the kept versions of the OpenTofu state of a stack, newest first, like those of the chart root module.
+// @Tags chart
+// @Security BearerAuth
+// @Param id path string true "Chart ID"
+// @Param name path string true "Stack directory name"
+// @Param environment query string false "Chart environment, the state of deploys without one when empty"
+// @Success 200 {object} chartStateVersionsResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid_request`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`"
+// @Failure 500 {object} errorResponse "`state_failed`"
+// @Router /chart/{id}/stack/{name}/state/versions [get]
+func HandleChartStackStateVersions(w http.ResponseWriter, r *http.Request) {
+	if stack, ok := chartStateStack(w, r); ok {
+		handleChartStateVersions(w, r, r.PathValue("id"), stack)
+	}
+}
+
+// HandleChartStackStateVersion handles GET /api/chart/{id}/stack/{name}/state/versions/{version} requests.
+// @Summary Get a state version of a stack
+// @Description Returns a kept version of the OpenTofu state of a stack.
+// @Tags chart
+// @Security BearerAuth
+// @Param id path string true "Chart ID"
+// @Param name path string true "Stack directory name"
+// @Param environment query string false "Chart environment, the state of deploys without one when empty"
+// @Param version path int true "State version"
+// @Success 200 {object} map[string]any
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid_request`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`, `state_version_not_found`"
+// @Failure 500 {object} errorResponse "`state_failed`"
+// @Router /chart/{id}/stack/{name}/state/versions/{version} [get]
+func HandleChartStackStateVersion(w http.ResponseWriter, r *http.Request) {
+	if stack, ok := chartStateStack(w, r); ok {
+		handleChartStateVersion(w, r, r.PathValue("id"), stack)
+	}
+}
+
+func handleChartStateVersions(w http.ResponseWriter, r *http.Request, chartID, stack string) {
+	environment, ok := authorizeChartStateVersions(w, r, chartID, stack)
+	if !ok {
+		return
+	}
+
+	versions, err := chart.ListChartStateVersions(chartID, environment, stack)
+	if err != nil {
+		writeChartStateError(w, err)
+		return
+	}
+	slices.Reverse(versions)
+	writeJSON(w, http.StatusOK, chartStateVersionsResponse{ChartID: chartID, Environment: environment, Stack: stack, Versions: versions})
+}
+
+func handleChartStateVersion(w http.ResponseWriter, r *http.Request, chartID, stack string) {
+	environment, ok := authorizeChartStateVersions(w, r, chartID, stack)
+	if !ok {
+		return
+	}
+
+	version, err := strconv.Atoi(r.PathValue("version"))
+	if err != nil || version < 1 {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "version must be a positive number"})
+		return
+	}
+	data, err := chart.ReadChartStateVersion(chartID, environment, stack, version)
+	if errors.Is(err, chart.ErrStateNotFound) {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "state_version_not_found"})
+		return
+	}
+	if err != nil {
+		writeChartStateError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(data)
+}
+
+// authorizeChartStateVersions checks the credentials and the method of a
+// state versions request, answering it when they don't pass. It returns the
+// environment of the request.
+func authorizeChartStateVersions(w http.ResponseWriter, r *http.Request, chartID, stack string) (string, bool) {
+	environment, ok := chartStateEnvironment(w, r)
+	if !ok {
+		return "", false
+	}
+	if _, ok := authorizeChartState(r, chartID, environment, stack); !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="planemgr"`)
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return "", false
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+		return "", false
+	}
+	return environment, true
+}
+
+// chartStateStack returns the stack named in the path of a state request,
+// answering it when the name is invalid.
+func chartStateStack(w http.ResponseWriter, r *http.Request) (string, bool) {
+	stack := r.PathValue("name")
+	if stack == "" || deploy.ValidateStackName(stack) != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: deploy.ErrInvalidStack.Error()})
+		return "", false
+	}
+	return stack, true
+}
+
+// chartStateEnvironment returns the environment named in the query of a
+// state request, answering it when the name is invalid.
+func chartStateEnvironment(w http.ResponseWriter, r *http.Request) (string, bool) {
+	environment := r.URL.Query().Get("environment")
+	if err := deploy.ValidateEnvironmentName(environment); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: err.Error()})
+		return "", false
+	}
+	return environment, true
+}
+
+// authorizeChartState checks the credentials of a state request: those of
+// a running deploy of the stack in the environment, or an access token. It
+// returns the ID of the deploy, empty for users.
+func authorizeChartState(r *http.Request, chartID, environment, stack string) (string, bool) {
+	username, password, ok := r.BasicAuth()
+	switch {
+	case ok && username == "access":
+		_, err := auth.RequireAccessTokenFromBasicAuth(r, "access")
+		return "", err == nil
+	case ok:
+		chartStates.mu.Lock()
+		lease, found := chartStates.leases[username]
+		chartStates.mu.Unlock()
+		if !found || lease.chartID != chartID || lease.environment != environment || lease.stack != stack || subtle.ConstantTimeCompare([]byte(password), []byte(lease.password)) != 1 {
+			return "", false
+		}
+		return username, true
+	default:
+		_, err := auth.RequireAccessTokenClaims(r)
+		return "", err == nil
+	}
+}
+
+func writeChartStateLock(w http.ResponseWriter, status int, lock chartStateLock) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(lock.info)
+}
+
+func writeChartStateError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist):
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "chart_not_found"})
+	default:
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "state_failed", Message: err.Error()})
+	}
+}
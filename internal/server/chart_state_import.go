@@ -0,0 +1,438 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+	"github.com/mtolmacs/planemgr/internal/server/deploy"
+)
+
+const stateImportTimeout = 30 * time.Second
+
+var stateImportClient = &http.Client{Timeout: stateImportTimeout}
+
+type chartStateImportRequest struct {
+	Environment string `json:"environment,omitempty" example:"prod"`
+	Stack       string `json:"stack,omitempty" example:"network"`
+	// S3 and HTTP complete the backend block of the module, which may leave
+	// out settings passed with -backend-config.
+	S3      *stateImportS3   `json:"s3,omitempty"`
+	HTTP    *stateImportHTTP `json:"http,omitempty"`
+	Message string           `json:"message,omitempty"` // Commit message of the backend removal
+	Replace bool             `json:"replace,omitempty"` // Replace a managed state stored already
+	DryRun  bool             `json:"dryRun,omitempty"`
+}
+
+type stateImportS3 struct {
+	Bucket          string `json:"bucket,omitempty" example:"acme-tfstate"`
+	Key             string `json:"key,omitempty" example:"network/terraform.tfstate"`
+	Region          string `json:"region,omitempty" example:"eu-central-1"`
+	Endpoint        string `json:"endpoint,omitempty" example:"https://minio.internal:9000"` // For S3 compatible stores
+	AccessKeyID     string `json:"accessKeyId"`
+	SecretAccessKey string `json:"secretAccessKey"`
+	SessionToken    string `json:"sessionToken,omitempty"`
+}
+
+type stateImportHTTP struct {
+	Address  string `json:"address,omitempty" example:"https://state.example.com/network"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+type chartStateImportResponse struct {
+	ChartID     string `json:"chartId"`
+	Environment string `json:"environment,omitempty"`
+	Stack       string `json:"stack,omitempty"`
+	Backend     string `json:"backend" example:"s3"`
+	Source      string `json:"source" example:"s3://acme-tfstate/network/terraform.tfstate"`
+	File        string `json:"file" example:"network/backend.tf"` // File the backend block is removed from
+	Ref         string `json:"ref,omitempty"`                     // Commit removing the backend block
+	Size        int    `json:"size,omitempty"`
+	DryRun      bool   `json:"dryRun,omitempty"`
+}
+
+// HandleChartStateImport handles POST /api/chart/{id}/state/import requests.
+// @Summary Import state from the backend of a module
+// @Description Moves a module of the chart, the root module or a stack, from the s3 or http state backend its terraform block configures to the managed state: the state is pulled from the backend and stored as the managed state of the module in the environment, then the backend block is removed in a commit to the chart branch, so later deploys use the managed state. The backend block settings set to literals are used; the s3 or http fields of the request complete them and carry the credentials, which are not stored. With dryRun the backend is only read and reported. A managed state stored already is only replaced with replace. The state is left in the backend.
+// @Tags chart
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Param request body chartStateImportRequest true "Module, backend settings and credentials"
+// @Success 200 {object} chartStateImportResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid_request`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`, `backend_not_found`, `environment_not_found`"
+// @Failure 409 {object} errorResponse "`state_exists`, `history_changed`"
+// @Failure 413 {object} errorResponse "`state_too_large`"
+// @Failure 422 {object} errorResponse "`unsupported_backend`, `invalid_state`, `commit rejected by policy`"
+// @Failure 423 {object} errorResponse "`chart_locked`, `state_locked`"
+// @Failure 500 {object} errorResponse "`state_failed`"
+// @Failure 502 {object} errorResponse "`state_pull_failed`"
+// @Router /chart/{id}/state/import [post]
+func HandleChartStateImport(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+		return
+	}
+
+	var req chartStateImportRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "invalid JSON payload"})
+		return
+	}
+	req.Stack = strings.TrimSpace(req.Stack)
+	if req.Stack != "" && deploy.ValidateStackName(req.Stack) != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: deploy.ErrInvalidStack.Error()})
+		return
+	}
+	if err := deploy.ValidateEnvironmentName(req.Environment); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: err.Error()})
+		return
+	}
+
+	chartID := r.PathValue("id")
+	if !requireChartUnlocked(w, chartID, claims.Subject) {
+		return
+	}
+	if _, ok := chartDeployEnvironment(w, chartID, req.Environment); !ok {
+		return
+	}
+
+	backend, err := chart.ReadChartBackend(chartID, "", req.Stack)
+	if errors.Is(err, chart.ErrNoBackend) || errors.Is(err, plumbing.ErrReferenceNotFound) {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "backend_not_found", Message: "the module configures no state backend"})
+		return
+	}
+	if err != nil {
+		writeChartStateError(w, err)
+		return
+	}
+
+	var pull func(context.Context) ([]byte, error)
+	var source string
+	switch backend.Type {
+	case "s3":
+		config, err := s3StateConfig(backend.Attributes, req.S3)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: err.Error()})
+			return
+		}
+		source = "s3://" + config.Bucket + "/" + config.Key
+		pull = func(ctx context.Context) ([]byte, error) { return pullS3State(ctx, config) }
+	case "http":
+		config, err := httpStateConfig(backend.Attributes, req.HTTP)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: err.Error()})
+			return
+		}
+		source = config.Address
+		pull = func(ctx context.Context) ([]byte, error) { return pullHTTPState(ctx, config) }
+	default:
+		writeJSON(w, http.StatusUnprocessableEntity, errorResponse{Error: "unsupported_backend", Message: "state can only be imported from s3 and http backends, not " + backend.Type})
+		return
+	}
+
+	response := chartStateImportResponse{
+		ChartID:     chartID,
+		Environment: req.Environment,
+		Stack:       req.Stack,
+		Backend:     backend.Type,
+		Source:      source,
+		File:        backend.File,
+		DryRun:      req.DryRun,
+	}
+	previous, err := chart.ReadChartState(chartID, req.Environment, req.Stack)
+	if err != nil && !errors.Is(err, chart.ErrStateNotFound) {
+		writeChartStateError(w, err)
+		return
+	}
+	if previous != nil && !req.Replace {
+		writeJSON(w, http.StatusConflict, errorResponse{Error: "state_exists", Message: "the module has a managed state already; set replace to overwrite it"})
+		return
+	}
+	if req.DryRun {
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
+
+	data, err := pull(r.Context())
+	if errors.Is(err, errStateTooLarge) {
+		writeJSON(w, http.StatusRequestEntityTooLarge, errorResponse{Error: "state_too_large", Message: err.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, errorResponse{Error: "state_pull_failed", Message: err.Error()})
+		return
+	}
+	if err := validateImportedState(data); err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, errorResponse{Error: "invalid_state", Message: err.Error()})
+		return
+	}
+
+	if !storeImportedState(w, chartID, req.Environment, req.Stack, data) {
+		return
+	}
+	message := strings.TrimSpace(req.Message)
+	if message == "" {
+		message = "Move " + moduleName(req.Stack) + " state from " + source + " to the managed state"
+	}
+	ref, err := chart.RemoveChartBackend(chartID, req.Stack, message)
+	if err != nil {
+		// Deploys keep using the backend until it is removed, so a state
+		// they can't see yet is only dropped when it replaced nothing.
+		if previous == nil {
+			if err := chart.DeleteChartState(chartID, req.Environment, req.Stack); err != nil {
+				log.Printf("Removing imported state of chart %s failed: %v", chartID, err)
+			}
+		}
+		if writeCommitPolicyError(w, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, chart.ErrBranchMoved) || errors.Is(err, chart.ErrHistoryChanged):
+			writeJSON(w, http.StatusConflict, errorResponse{Error: "history_changed", Message: "the chart changed while importing, retry"})
+		case errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist):
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "chart_not_found"})
+		default:
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "state_failed", Message: err.Error()})
+		}
+		return
+	}
+	notifyChartCommit(chartID, ref, message, []string{backend.File})
+
+	response.Ref = ref
+	response.Size = len(data)
+	writeJSON(w, http.StatusOK, response)
+}
+
+// storeImportedState writes data as the managed state unless tofu holds
+// the state lock. It writes the error and returns false otherwise.
+func storeImportedState(w http.ResponseWriter, chartID, environment, stack string, data []byte) bool {
+	chartStates.mu.Lock()
+	defer chartStates.mu.Unlock()
+	if _, ok := chartStates.locks[deployLockKey(chartID, environment, stack)]; ok {
+		writeJSON(w, http.StatusLocked, errorResponse{Error: "state_locked", Message: "the managed state is locked"})
+		return false
+	}
+	if err := chart.WriteChartState(chartID, environment, stack, data); err != nil {
+		writeChartStateError(w, err)
+		return false
+	}
+	return true
+}
+
+func moduleName(stack string) string {
+	if stack == "" {
+		return "root module"
+	}
+	return "stack " + stack
+}
+
+var errStateTooLarge = errors.New("state is larger than 64 MiB")
+
+// validateImportedState checks that data is an OpenTofu state, so nothing
+// else an address answers with is stored and served back.
+func validateImportedState(data []byte) error {
+	var state struct {
+		Version *int   `json:"version"`
+		Lineage string `json:"lineage"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil || state.Version == nil || state.Lineage == "" {
+		return errors.New("the backend holds no OpenTofu state")
+	}
+	return nil
+}
+
+func readStateBody(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusNoContent {
+		return nil, errors.New("the backend holds no state")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the backend answered %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxChartStateBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxChartStateBytes {
+		return nil, errStateTooLarge
+	}
+	return data, nil
+}
+
+// httpStateConfig completes the address and credentials of an http backend
+// block with those of the request.
+func httpStateConfig(attributes map[string]string, req *stateImportHTTP) (stateImportHTTP, error) {
+	config := stateImportHTTP{Address: attributes["address"], Username: attributes["username"], Password: attributes["password"]}
+	if req != nil {
+		config.Address = cmp.Or(req.Address, config.Address)
+		config.Username = cmp.Or(req.Username, config.Username)
+		config.Password = cmp.Or(req.Password, config.Password)
+	}
+	address, err := url.Parse(config.Address)
+	if err != nil || (address.Scheme != "https" && address.Scheme != "http") || address.Host == "" {
+		return stateImportHTTP{}, errors.New("http.address must be an http or https URL")
+	}
+	return config, nil
+}
+
+func pullHTTPState(ctx context.Context, config stateImportHTTP) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, config.Address, nil)
+	if err != nil {
+		return nil, err
+	}
+	if config.Username != "" || config.Password != "" {
+		req.SetBasicAuth(config.Username, config.Password)
+	}
+	resp, err := stateImportClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return readStateBody(resp)
+}
+
+// s3StateConfig completes the bucket, key, region and endpoint of an s3
+// backend block with those of the request, which carries the credentials.
+func s3StateConfig(attributes map[string]string, req *stateImportS3) (stateImportS3, error) {
+	if req == nil {
+		return stateImportS3{}, errors.New("s3 with accessKeyId and secretAccessKey is required")
+	}
+	config := *req
+	config.Bucket = cmp.Or(config.Bucket, attributes["bucket"])
+	config.Key = cmp.Or(config.Key, attributes["key"])
+	config.Region = cmp.Or(config.Region, attributes["region"], "us-east-1")
+	config.Endpoint = cmp.Or(config.Endpoint, attributes["endpoint"])
+	if config.Bucket == "" || config.Key == "" {
+		return stateImportS3{}, errors.New("s3.bucket and s3.key are required when the backend block doesn't set them")
+	}
+	if config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return stateImportS3{}, errors.New("s3.accessKeyId and s3.secretAccessKey are required")
+	}
+	if config.Endpoint != "" {
+		endpoint, err := url.Parse(config.Endpoint)
+		if err != nil || (endpoint.Scheme != "https" && endpoint.Scheme != "http") || endpoint.Host == "" {
+			return stateImportS3{}, errors.New("s3.endpoint must be an http or https URL")
+		}
+	}
+	return config, nil
+}
+
+// pullS3State gets the state object with a request signed with AWS
+// Signature Version 4. Custom endpoints are addressed path-style, as S3
+// compatible stores expect.
+func pullS3State(ctx context.Context, config stateImportS3) ([]byte, error) {
+	objectPath := "/" + s3EscapePath(config.Key)
+	endpoint := &url.URL{Scheme: "https", Host: config.Bucket + ".s3." + config.Region + ".amazonaws.com"}
+	if config.Endpoint != "" {
+		parsed, err := url.Parse(config.Endpoint)
+		if err != nil {
+			return nil, err
+		}
+		endpoint = &url.URL{Scheme: parsed.Scheme, Host: parsed.Host}
+		objectPath = "/" + s3EscapePath(config.Bucket) + objectPath
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String()+objectPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	signS3Request(req, objectPath, config, time.Now().UTC())
+	resp, err := stateImportClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return readStateBody(resp)
+}
+
+// emptyPayloadHash is the SHA-256 of the empty body of a GET request.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// signS3Request adds the AWS Signature Version 4 headers for a GET of
+// escapedPath without a query to req.
+func signS3Request(req *http.Request, escapedPath string, config stateImportS3, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	if config.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", config.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{req.Method, escapedPath, "", canonicalHeaders.String(), signedHeaders, emptyPayloadHash}, "\n")
+	scope := date + "/" + config.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+config.SecretAccessKey), date)
+	for _, part := range []string{config.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+config.AccessKeyID+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3EscapePath escapes an object key like S3 canonical requests expect:
+// everything but unreserved characters and slashes.
+func s3EscapePath(key string) string {
+	var escaped strings.Builder
+	for _, b := range []byte(key) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', b == '-', b == '_', b == '.', b == '~', b == '/':
+			escaped.WriteByte(b)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxInventoryString caps the attribute values shown in a state inventory.
+const maxInventoryString = 256
+
+// chartStateInventory is what the OpenTofu state of a stack holds.
+type chartStateInventory struct {
+	ChartID     string               `json:"chartId"`
+	Environment string               `json:"environment,omitempty"`
+	Stack       string               `json:"stack,omitempty"`
+	Serial      int64                `json:"serial"`
+	Lineage     string               `json:"lineage"`
+	TofuVersion string               `json:"tofuVersion" example:"1.8.0"`
+	Resources   []chartStateResource `json:"resources"`
+	Outputs     []chartStateOutput   `json:"outputs"`
+}
+
+type chartStateResource struct {
+	Address   string                       `json:"address" example:"module.net.aws_vpc.main"`
+	Mode      string                       `json:"mode" example:"managed"`
+	Type      string                       `json:"type" example:"aws_vpc"`
+	Name      string                       `json:"name" example:"main"`
+	Module    string                       `json:"module,omitempty"`
+	Provider  string                       `json:"provider" example:"registry.opentofu.org/hashicorp/aws"`
+	Instances []chartStateResourceInstance `json:"instances"`
+}
+
+type chartStateResourceInstance struct {
+	Address string `json:"address" example:"module.net.aws_vpc.main"`
+	ID      string `json:"id,omitempty"`
+	// Top-level attributes holding a string, number or bool; long strings
+	// are cut and sensitive attributes left out.
+	Attributes map[string]any `json:"attributes"`
+	Sensitive  []string       `json:"sensitive,omitempty"` // Attributes left out as sensitive
+}
+
+type chartStateOutput struct {
+	Name      string `json:"name"`
+	Sensitive bool   `json:"sensitive,omitempty"`
+	Value     any    `json:"value,omitempty"` // Left out when sensitive
+}
+
+// tofuState is the part of the OpenTofu state file format, version 4, the
+// inventory reads.
+type tofuState struct {
+	Version          int    `json:"version"`
+	TerraformVersion string `json:"terraform_version"`
+	Serial           int64  `json:"serial"`
+	Lineage          string `json:"lineage"`
+	Outputs          map[string]struct {
+		Value     any  `json:"value"`
+		Sensitive bool `json:"sensitive"`
+	} `json:"outputs"`
+	Resources []struct {
+		Module    string `json:"module"`
+		Mode      string `json:"mode"`
+		Type      string `json:"type"`
+		Name      string `json:"name"`
+		Provider  string `json:"provider"`
+		Instances []struct {
+			IndexKey            any                        `json:"index_key"`
+			Attributes          map[string]json.RawMessage `json:"attributes"`
+			SensitiveAttributes []json.RawMessage          `json:"sensitive_attributes"`
+		} `json:"instances"`
+	} `json:"resources"`
+}
+
+// parseChartStateInventory lists the resources and outputs of a state.
+func parseChartStateInventory(data []byte) (chartStateInventory, error) {
+	var state tofuState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return chartStateInventory{}, err
+	}
+	if state.Version != 4 {
+		return chartStateInventory{}, fmt.Errorf("unsupported state version %d", state.Version)
+	}
+
+	inventory := chartStateInventory{
+		Serial:      state.Serial,
+		Lineage:     state.Lineage,
+		TofuVersion: state.TerraformVersion,
+		Resources:   []chartStateResource{},
+		Outputs:     []chartStateOutput{},
+	}
+	for _, resource := range state.Resources {
+		address := resource.Type + "." + resource.Name
+		if resource.Mode == "data" {
+			address = "data." + address
+		}
+		if resource.Module != "" {
+			address = resource.Module + "." + address
+		}
+
+		row := chartStateResource{
+			Address:   address,
+			Mode:      resource.Mode,
+			Type:      resource.Type,
+			Name:      resource.Name,
+			Module:    resource.Module,
+			Provider:  stateProviderSource(resource.Provider),
+			Instances: []chartStateResourceInstance{},
+		}
+		for _, instance := range resource.Instances {
+			sensitive := stateSensitiveAttributes(instance.SensitiveAttributes)
+			item := chartStateResourceInstance{
+				Address:    address + stateIndexKey(instance.IndexKey),
+				Attributes: map[string]any{},
+			}
+			for name, raw := range instance.Attributes {
+				if _, hidden := sensitive[name]; hidden {
+					item.Sensitive = append(item.Sensitive, name)
+					continue
+				}
+				var value any
+				if json.Unmarshal(raw, &value) != nil {
+					continue
+				}
+				switch value := value.(type) {
+				case string:
+					if name == "id" {
+						item.ID = value
+					}
+					if len(value) > maxInventoryString {
+						value = strings.ToValidUTF8(value[:maxInventoryString], "") + "…"
+					}
+					item.Attributes[name] = value
+				case float64, bool:
+					item.Attributes[name] = value
+				}
+			}
+			slices.Sort(item.Sensitive)
+			row.Instances = append(row.Instances, item)
+		}
+		inventory.Resources = append(inventory.Resources, row)
+	}
+
+	for name, output := range state.Outputs {
+		row := chartStateOutput{Name: name, Sensitive: output.Sensitive}
+		if !output.Sensitive {
+			row.Value = output.Value
+		}
+		inventory.Outputs = append(inventory.Outputs, row)
+	}
+	slices.SortFunc(inventory.Outputs, func(a, b chartStateOutput) int { return strings.Compare(a.Name, b.Name) })
+	return inventory, nil
+}
+
+// stateProviderSource turns a provider config address like
+// provider["registry.opentofu.org/hashicorp/aws"].east into its source.
+func stateProviderSource(provider string) string {
+	if _, rest, ok := strings.Cut(provider, `["`); ok {
+		if source, _, ok := strings.Cut(rest, `"]`); ok {
+			return source
+		}
+	}
+	return provider
+}
+
+func stateIndexKey(key any) string {
+	switch key := key.(type) {
+	case float64:
+		return "[" + strconv.FormatFloat(key, 'f', -1, 64) + "]"
+	case string:
+		return "[" + strconv.Quote(key) + "]"
+	default:
+		return ""
+	}
+}
+
+// stateSensitiveAttributes returns the top-level attributes the paths in
+// sensitive_attributes point into.
+func stateSensitiveAttributes(paths []json.RawMessage) map[string]struct{} {
+	names := map[string]struct{}{}
+	for _, raw := range paths {
+		var steps []struct {
+			Type  string `json:"type"`
+			Value any    `json:"value"`
+		}
+		if json.Unmarshal(raw, &steps) != nil || len(steps) == 0 || steps[0].Type != "get_attr" {
+			continue
+		}
+		if name, ok := steps[0].Value.(string); ok {
+			names[name] = struct{}{}
+		}
+	}
+	return names
+}
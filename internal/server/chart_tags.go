@@ -0,0 +1,148 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+)
+
+type chartTag struct {
+	Name        string `json:"name"`
+	Hash        string `json:"hash"`
+	Message     string `json:"message,omitempty"`
+	TaggerName  string `json:"taggerName,omitempty"`
+	TaggerEmail string `json:"taggerEmail,omitempty"`
+	Timestamp   string `json:"timestamp,omitempty"`
+}
+
+type chartTagsResponse struct {
+	ChartID string     `json:"chartId"`
+	Tags    []chartTag `json:"tags"`
+}
+
+type chartTagRequest struct {
+	Name    string `json:"name" example:"v1.2.0"`
+	Ref     string `json:"ref,omitempty" example:"main"`
+	Message string `json:"message,omitempty" example:"Release 1.2.0"`
+}
+
+// HandleChartTags handles /api/chart/{id}/tags requests.
+func HandleChartTags(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.RequireAccessTokenClaims(r); err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		HandleChartTagList(w, r)
+	case http.MethodPost:
+		HandleChartTagCreate(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	}
+}
+
+// Handle GET /api/chart/{id}/tags requests.
+// @Summary List chart tags
+// @Description Returns the tags of a chart sorted by name, with the commit each one points to.
+// @Tags chart
+// @Security BearerAuth
+// @Param id path string true "Chart ID"
+// @Success 200 {object} chartTagsResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid tag name`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart not found`, `chart ref not found`"
+// @Failure 409 {object} errorResponse "`chart tag already exists`"
+// @Failure 500 {object} errorResponse "`failed to tag chart`"
+// @Router /chart/{id}/tags [get]
+func HandleChartTagList(w http.ResponseWriter, r *http.Request) {
+	chartID := r.PathValue("id")
+	tags, err := chart.ListChartTags(chartID)
+	if err != nil {
+		writeChartTagError(w, err)
+		return
+	}
+
+	response := chartTagsResponse{ChartID: chartID, Tags: make([]chartTag, 0, len(tags))}
+	for _, tag := range tags {
+		response.Tags = append(response.Tags, newChartTag(tag))
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// Handle POST /api/chart/{id}/tags requests.
+// @Summary Create chart tag
+// @Description Creates an annotated tag on a chart commit to mark a release. Tags can be used as the ref of deploys.
+// @Tags chart
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Param request body chartTagRequest true "Tag name, target ref (defaults to HEAD) and annotation"
+// @Success 201 {object} chartTag
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid request body`, `invalid tag name`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart not found`, `chart ref not found`"
+// @Failure 409 {object} errorResponse "`chart tag already exists`"
+// @Failure 500 {object} errorResponse "`failed to tag chart`"
+// @Router /chart/{id}/tags [post]
+func HandleChartTagCreate(w http.ResponseWriter, r *http.Request) {
+	var req chartTagRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+
+	chartID := r.PathValue("id")
+	tag, err := chart.CreateChartTag(chartID, req.Name, req.Ref, req.Message)
+	if err != nil {
+		writeChartTagError(w, err)
+		return
+	}
+	publishChartRefEvent(chartID, plumbing.NewTagReferenceName(tag.Name), tag.Hash, "created")
+
+	writeJSON(w, http.StatusCreated, newChartTag(tag))
+}
+
+func newChartTag(tag chart.TagInfo) chartTag {
+	response := chartTag{
+		Name:        tag.Name,
+		Hash:        tag.Hash,
+		Message:     tag.Message,
+		TaggerName:  tag.TaggerName,
+		TaggerEmail: tag.TaggerEmail,
+	}
+	if !tag.When.IsZero() {
+		response.Timestamp = tag.When.UTC().Format(time.RFC3339)
+	}
+	return response
+}
+
+func writeChartTagError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, chart.ErrInvalidTagName):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid tag name"})
+	case errors.Is(err, git.ErrTagExists):
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "chart tag already exists"})
+	case errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart not found"})
+	case errors.Is(err, plumbing.ErrReferenceNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart ref not found"})
+	default:
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to tag chart"})
+	}
+}
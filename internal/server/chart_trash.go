@@ -0,0 +1,148 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+)
+
+// defaultChartTrashRetention is how long deleted charts can be restored when
+// CHART_TRASH_RETENTION isn't set.
+const defaultChartTrashRetention = 30 * 24 * time.Hour
+
+// chartTrashPurgeInterval is how often charts past their retention are
+// removed for good.
+const chartTrashPurgeInterval = time.Hour
+
+type chartTrashEntry struct {
+	ChartID   string `json:"chartId"`
+	DeletedBy string `json:"deletedBy"`
+	DeletedAt string `json:"deletedAt" example:"2026-01-02T15:04:05Z"`
+	ExpiresAt string `json:"expiresAt" example:"2026-02-01T15:04:05Z"` // Purged for good after this
+}
+
+type chartTrashResponse struct {
+	Charts []chartTrashEntry `json:"charts"`
+}
+
+// HandleChartTrash handles GET /api/chart/trash requests.
+// @Summary List deleted charts
+// @Description Lists the charts in the trash, most recently deleted first, with when they are purged for good. Deleted charts are kept for CHART_TRASH_RETENTION (30 days by default).
+// @Tags chart
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} chartTrashResponse
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 500 {object} errorResponse "`failed to list deleted charts`"
+// @Router /chart/trash [get]
+func HandleChartTrash(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.RequireAccessTokenClaims(r); err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	charts, err := chart.ListTrashedCharts()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list deleted charts"})
+		return
+	}
+
+	retention := chartTrashRetention()
+	response := chartTrashResponse{Charts: make([]chartTrashEntry, 0, len(charts))}
+	for _, trashed := range charts {
+		response.Charts = append(response.Charts, chartTrashEntry{
+			ChartID:   trashed.ChartID,
+			DeletedBy: trashed.DeletedBy,
+			DeletedAt: trashed.DeletedAt.UTC().Format(time.RFC3339),
+			ExpiresAt: trashed.DeletedAt.Add(retention).UTC().Format(time.RFC3339),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// HandleChartRestore handles POST /api/chart/{id}/restore requests.
+// @Summary Restore a deleted chart
+// @Description Moves a chart out of the trash under its original ID, with its history and settings.
+// @Tags chart
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Success 200 {object} chartResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart not in trash`"
+// @Failure 409 {object} errorResponse "`chart already exists`"
+// @Failure 500 {object} errorResponse "`failed to restore chart`"
+// @Router /chart/{id}/restore [post]
+func HandleChartRestore(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.RequireAccessTokenClaims(r); err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	chartID := r.PathValue("id")
+	if err := chart.RestoreChartRepo(chartID); err != nil {
+		switch {
+		case errors.Is(err, chart.ErrNotTrashed):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart not in trash"})
+		case errors.Is(err, chart.ErrChartExists):
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "chart already exists"})
+		default:
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to restore chart"})
+		}
+		return
+	}
+	publishChartChange(chartID)
+
+	writeJSON(w, http.StatusOK, chartResponse{ChartID: chartID})
+}
+
+// StartChartTrashPurge removes charts from the trash once they are past the
+// retention, in the background.
+func StartChartTrashPurge() {
+	go func() {
+		ticker := time.NewTicker(chartTrashPurgeInterval)
+		defer ticker.Stop()
+		for {
+			purged, err := chart.PurgeTrashedCharts(time.Now().Add(-chartTrashRetention()))
+			for _, chartID := range purged {
+				log.Printf("Purged deleted chart %s", chartID)
+			}
+			if err != nil {
+				log.Printf("Purging deleted charts failed: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+func chartTrashRetention() time.Duration {
+	value := os.Getenv("CHART_TRASH_RETENTION")
+	if value == "" {
+		return defaultChartTrashRetention
+	}
+	retention, err := time.ParseDuration(value)
+	if err != nil || retention < 0 {
+		log.Printf("Invalid CHART_TRASH_RETENTION %q, using %s", value, defaultChartTrashRetention)
+		return defaultChartTrashRetention
+	}
+	return retention
+}
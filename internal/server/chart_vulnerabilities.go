@@ -0,0 +1,214 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/mtolmacs/planemgr/internal/server/advisory"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+)
+
+const (
+	chartVulnerabilitiesMeta = "vulnerabilities"
+	defaultVulnScanInterval  = 24 * time.Hour
+)
+
+var severityRank = map[string]int{
+	advisory.SeverityCritical: 0,
+	advisory.SeverityHigh:     1,
+	advisory.SeverityMedium:   2,
+	advisory.SeverityLow:      3,
+	advisory.SeverityUnknown:  4,
+}
+
+type chartVulnerability struct {
+	Path          string   `json:"path"`
+	Provider      string   `json:"provider"`
+	Version       string   `json:"version"`
+	ID            string   `json:"id"`
+	Aliases       []string `json:"aliases,omitempty"`
+	Summary       string   `json:"summary,omitempty"`
+	Severity      string   `json:"severity"`
+	FixedVersions []string `json:"fixedVersions"`
+}
+
+// chartVulnerabilityReport is the result of the last scan of a chart. Errors
+// lists the providers that could not be checked.
+type chartVulnerabilityReport struct {
+	ChartID   string               `json:"chartId"`
+	Ref       string               `json:"ref,omitempty"`
+	ScannedAt string               `json:"scannedAt"`
+	Providers int                  `json:"providers"`
+	Findings  []chartVulnerability `json:"findings"`
+	Errors    []string             `json:"errors,omitempty"`
+}
+
+// HandleChartVulnerabilities handles /api/chart/{id}/vulnerabilities requests.
+func HandleChartVulnerabilities(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.RequireAccessTokenClaims(r); err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		HandleChartVulnerabilitiesGet(w, r)
+	case http.MethodPost:
+		HandleChartVulnerabilitiesScan(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+	}
+}
+
+// HandleChartVulnerabilitiesGet handles GET /api/chart/{id}/vulnerabilities requests.
+// @Summary Get chart vulnerabilities
+// @Description Returns the findings of the last scan of the provider versions pinned in the chart lock files against the OSV advisory database, most severe first.
+// @Tags chart
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Success 200 {object} chartVulnerabilityReport
+// @Failure 400 {object} errorResponse "`invalid chart id`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`not_scanned`, `chart_not_found`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/vulnerabilities [get]
+func HandleChartVulnerabilitiesGet(w http.ResponseWriter, r *http.Request) {
+	var report chartVulnerabilityReport
+	if err := chart.ReadChartMeta(r.PathValue("id"), chartVulnerabilitiesMeta, &report); err != nil {
+		if errors.Is(err, chart.ErrMetaNotFound) {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "not_scanned", Message: "chart was not scanned yet"})
+			return
+		}
+		writeChartMetaError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// HandleChartVulnerabilitiesScan handles POST /api/chart/{id}/vulnerabilities requests.
+// @Summary Scan chart vulnerabilities
+// @Description Scans the lock files at HEAD right away instead of waiting for the periodic scan, and stores the result.
+// @Tags chart
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Success 200 {object} chartVulnerabilityReport
+// @Failure 400 {object} errorResponse "`invalid chart id`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart_not_found`"
+// @Failure 500 {object} errorResponse "`chart_settings_failed`"
+// @Router /chart/{id}/vulnerabilities [post]
+func HandleChartVulnerabilitiesScan(w http.ResponseWriter, r *http.Request) {
+	report, err := scanChartVulnerabilities(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// StartVulnerabilityScans scans every chart that is not archived now and then
+// every VULN_SCAN_INTERVAL (a duration, 24h by default). A zero interval
+// disables periodic scans.
+func StartVulnerabilityScans() {
+	interval := defaultVulnScanInterval
+	if value := os.Getenv("VULN_SCAN_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			log.Printf("Invalid VULN_SCAN_INTERVAL %q, using %s: %v", value, defaultVulnScanInterval, err)
+		} else {
+			interval = parsed
+		}
+	}
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			scanAllChartVulnerabilities()
+			<-ticker.C
+		}
+	}()
+}
+
+func scanAllChartVulnerabilities() {
+	chartIDs, err := chart.ListChartRepos()
+	if err != nil {
+		log.Printf("Listing charts for vulnerability scan failed: %v", err)
+		return
+	}
+
+	for _, chartID := range chartIDs {
+		if archived, err := isChartArchived(chartID); err != nil || archived {
+			continue
+		}
+		if _, err := scanChartVulnerabilities(context.Background(), chartID); err != nil {
+			log.Printf("Vulnerability scan of chart %s failed: %v", chartID, err)
+		}
+	}
+}
+
+// scanChartVulnerabilities checks the providers locked at HEAD of a chart and
+// stores the report. Providers OSV can't be asked about are listed in the
+// report errors rather than failing the scan.
+func scanChartVulnerabilities(ctx context.Context, chartID string) (chartVulnerabilityReport, error) {
+	ref, providers, err := chart.ListChartLockedProviders(chartID, "")
+	if err != nil {
+		return chartVulnerabilityReport{}, err
+	}
+
+	report := chartVulnerabilityReport{
+		ChartID:   chartID,
+		Ref:       ref,
+		Providers: len(providers),
+		Findings:  []chartVulnerability{},
+	}
+	for _, provider := range providers {
+		advisories, err := advisory.QueryProvider(ctx, provider.Source, provider.Version)
+		if err != nil {
+			report.Errors = append(report.Errors, provider.Source+" "+provider.Version+": "+err.Error())
+			continue
+		}
+		for _, a := range advisories {
+			report.Findings = append(report.Findings, chartVulnerability{
+				Path:          provider.Path,
+				Provider:      provider.Source,
+				Version:       provider.Version,
+				ID:            a.ID,
+				Aliases:       a.Aliases,
+				Summary:       a.Summary,
+				Severity:      a.Severity,
+				FixedVersions: a.Fixed,
+			})
+		}
+	}
+	slices.SortStableFunc(report.Findings, func(a, b chartVulnerability) int {
+		return cmp.Or(
+			cmp.Compare(severityRank[a.Severity], severityRank[b.Severity]),
+			cmp.Compare(a.Provider, b.Provider),
+			cmp.Compare(a.ID, b.ID),
+		)
+	})
+
+	report.ScannedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := chart.WriteChartMeta(chartID, chartVulnerabilitiesMeta, report); err != nil {
+		return report, err
+	}
+	return report, nil
+}
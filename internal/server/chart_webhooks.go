@@ -0,0 +1,382 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/google/uuid"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+	"github.com/mtolmacs/planemgr/internal/server/user"
+)
+
+const (
+	chartWebhooksMeta  = "webhooks"
+	chartCommitEvent   = "chart.commit"
+	webhookTimeout     = 10 * time.Second
+	webhookSecretBytes = 32
+
+	webhookDeliveryHeader  = "X-Planemgr-Delivery"
+	webhookTimestampHeader = "X-Planemgr-Timestamp"
+
+	// chartSecretPurpose derives the password of the webhook and run task
+	// secrets stored in chart metadata from SESSION_SECRET. It isn't bound
+	// to a chart so copies and trashed charts keep working.
+	chartSecretPurpose = "chart-secrets"
+)
+
+var (
+	webhookClient = &http.Client{Timeout: webhookTimeout}
+
+	// chartWebhooksMu serializes updates of the webhook documents.
+	chartWebhooksMu sync.Mutex
+)
+
+// chartWebhook receives a signed POST for every commit of a chart. The secret
+// is only returned when the webhook is created, and stored encrypted.
+type chartWebhook struct {
+	ID        string `json:"id"`
+	URL       string `json:"url"`
+	Secret    string `json:"secret,omitempty"`
+	CreatedAt string `json:"createdAt"`
+}
+
+type chartWebhookRequest struct {
+	URL    string `json:"url" example:"https://ci.example.com/hooks/planemgr"`
+	Secret string `json:"secret,omitempty"`
+}
+
+type chartWebhooksResponse struct {
+	ChartID  string         `json:"chartId"`
+	Webhooks []chartWebhook `json:"webhooks"`
+}
+
+// chartCommitPayload is the body of chart.commit deliveries. The
+// X-Planemgr-Signature header holds "sha256=" and the hex HMAC-SHA256, keyed
+// with the webhook secret, of the X-Planemgr-Delivery ID and the
+// X-Planemgr-Timestamp Unix time, each followed by a newline, and the body.
+// Receivers refuse deliveries with an old timestamp or an ID they saw, so a
+// captured delivery can't be replayed.
+type chartCommitPayload struct {
+	Event     string   `json:"event"`
+	ChartID   string   `json:"chartId"`
+	Ref       string   `json:"ref"`
+	Message   string   `json:"message"`
+	Paths     []string `json:"paths"`
+	Timestamp string   `json:"timestamp"`
+}
+
+// HandleChartWebhooks handles /api/chart/{id}/webhooks requests.
+func HandleChartWebhooks(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.RequireAccessTokenClaims(r); err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		HandleChartWebhookList(w, r)
+	case http.MethodPost:
+		HandleChartWebhookCreate(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	}
+}
+
+// Handle GET /api/chart/{id}/webhooks requests.
+// @Summary List chart webhooks
+// @Description Returns the webhooks notified of chart commits. Secrets are not included.
+// @Tags chart
+// @Security BearerAuth
+// @Param id path string true "Chart ID"
+// @Success 200 {object} chartWebhooksResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart not found`"
+// @Failure 500 {object} errorResponse "`failed to update chart webhooks`"
+// @Router /chart/{id}/webhooks [get]
+func HandleChartWebhookList(w http.ResponseWriter, r *http.Request) {
+	chartID := r.PathValue("id")
+	webhooks, err := loadChartWebhooks(chartID)
+	if err != nil {
+		writeChartWebhookError(w, err)
+		return
+	}
+
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	writeJSON(w, http.StatusOK, chartWebhooksResponse{ChartID: chartID, Webhooks: webhooks})
+}
+
+// Handle POST /api/chart/{id}/webhooks requests.
+// @Summary Create chart webhook
+// @Description Registers a URL that receives a POST for every commit written to the chart, with the chart ID, commit hash, message and changed paths. Deliveries are signed with the secret, which is generated when omitted and only returned in this response: X-Planemgr-Signature holds "sha256=" and the hex HMAC-SHA256 of the X-Planemgr-Delivery ID and the X-Planemgr-Timestamp Unix time, each followed by a newline, and the body. Receivers should refuse deliveries older than five minutes and IDs they already saw, so a captured delivery can't be replayed.
+// @Tags chart
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Param request body chartWebhookRequest true "Webhook"
+// @Success 201 {object} chartWebhook
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid request body`, `invalid webhook url`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`chart not found`"
+// @Failure 500 {object} errorResponse "`failed to generate webhook secret`, `failed to update chart webhooks`"
+// @Router /chart/{id}/webhooks [post]
+func HandleChartWebhookCreate(w http.ResponseWriter, r *http.Request) {
+	var req chartWebhookRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	if target, err := url.Parse(req.URL); err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid webhook url"})
+		return
+	}
+
+	webhook := chartWebhook{
+		ID:        uuid.NewString(),
+		URL:       req.URL,
+		Secret:    req.Secret,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	if webhook.Secret == "" {
+		secret := make([]byte, webhookSecretBytes)
+		if _, err := rand.Read(secret); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to generate webhook secret"})
+			return
+		}
+		webhook.Secret = hex.EncodeToString(secret)
+	}
+
+	stored := webhook
+	sealed, err := sealChartSecret(webhook.Secret)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update chart webhooks"})
+		return
+	}
+	stored.Secret = sealed
+
+	chartID := r.PathValue("id")
+	chartWebhooksMu.Lock()
+	defer chartWebhooksMu.Unlock()
+
+	webhooks, err := loadChartWebhooks(chartID)
+	if err == nil {
+		err = chart.WriteChartMeta(chartID, chartWebhooksMeta, append(webhooks, stored))
+	}
+	if err != nil {
+		writeChartWebhookError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, webhook)
+}
+
+// Handle DELETE /api/chart/{id}/webhooks/{webhookId} requests.
+// @Summary Delete chart webhook
+// @Tags chart
+// @Security BearerAuth
+// @Param id path string true "Chart ID"
+// @Param webhookId path string true "Webhook ID"
+// @Success 200 {object} emptyResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`webhook not found`, `chart not found`"
+// @Failure 500 {object} errorResponse "`failed to update chart webhooks`"
+// @Router /chart/{id}/webhooks/{webhookId} [delete]
+func HandleChartWebhookDelete(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.RequireAccessTokenClaims(r); err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", "DELETE")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	chartID := r.PathValue("id")
+	webhookID := r.PathValue("webhookId")
+	chartWebhooksMu.Lock()
+	defer chartWebhooksMu.Unlock()
+
+	webhooks, err := loadChartWebhooks(chartID)
+	if err != nil {
+		writeChartWebhookError(w, err)
+		return
+	}
+	remaining := slices.DeleteFunc(slices.Clone(webhooks), func(hook chartWebhook) bool { return hook.ID == webhookID })
+	if len(remaining) == len(webhooks) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "webhook not found"})
+		return
+	}
+	if err := chart.WriteChartMeta(chartID, chartWebhooksMeta, remaining); err != nil {
+		writeChartWebhookError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, emptyResponse{})
+}
+
+func writeChartWebhookError(w http.ResponseWriter, err error) {
+	if errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "chart not found"})
+		return
+	}
+
+	writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update chart webhooks"})
+}
+
+func loadChartWebhooks(chartID string) ([]chartWebhook, error) {
+	webhooks := []chartWebhook{}
+	if err := chart.ReadChartMeta(chartID, chartWebhooksMeta, &webhooks); err != nil && !errors.Is(err, chart.ErrMetaNotFound) {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// notifyChartCommit delivers a chart.commit event to every webhook of the
+// chart in the background. Delivery failures are logged.
+func notifyChartCommit(chartID, ref, message string, paths []string) {
+	publishChartChange(chartID)
+	publishChartCommitEvent(chartID, ref, message, paths)
+
+	webhooks, err := loadChartWebhooks(chartID)
+	if err != nil {
+		log.Printf("Loading webhooks of chart %s failed: %v", chartID, err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(chartCommitPayload{
+		Event:     chartCommitEvent,
+		ChartID:   chartID,
+		Ref:       ref,
+		Message:   message,
+		Paths:     paths,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		log.Printf("Encoding commit event of chart %s failed: %v", chartID, err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		go func() {
+			if err := deliverWebhook(webhook, chartCommitEvent, body); err != nil {
+				log.Printf("Webhook %s of chart %s failed: %v", webhook.ID, chartID, err)
+			}
+		}()
+	}
+}
+
+func deliverWebhook(webhook chartWebhook, event string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	secret, err := openChartSecret(webhook.Secret)
+	if err != nil {
+		return fmt.Errorf("decrypt webhook secret: %w", err)
+	}
+
+	delivery := uuid.NewString()
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(delivery + "\n" + timestamp + "\n"))
+	mac.Write(body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "planemgr-webhook")
+	req.Header.Set("X-Planemgr-Event", event)
+	req.Header.Set(webhookDeliveryHeader, delivery)
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set("X-Planemgr-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// sealChartSecret encrypts a webhook or run task secret for chart metadata.
+func sealChartSecret(secret string) (string, error) {
+	if secret == "" {
+		return "", nil
+	}
+	return user.SealServerSecret(chartSecretPurpose, secret)
+}
+
+// openChartSecret decrypts a secret sealChartSecret encrypted. Secrets stored
+// before they were encrypted are returned as they are.
+func openChartSecret(sealed string) (string, error) {
+	if !user.IsSealedServerSecret(sealed) {
+		return sealed, nil
+	}
+	return user.OpenServerSecret(chartSecretPurpose, sealed)
+}
+
+// convertChartSecrets applies convert to every secret of data, the chart
+// metadata document name, when it is one of migrationSealedMeta. Archives
+// carry the secrets decrypted, as SESSION_SECRET differs between instances.
+func convertChartSecrets(name string, data []byte, convert func(string) (string, error)) ([]byte, error) {
+	switch name {
+	case chartWebhooksMeta:
+		var webhooks []chartWebhook
+		if err := json.Unmarshal(data, &webhooks); err != nil {
+			return nil, err
+		}
+		for i := range webhooks {
+			secret, err := convert(webhooks[i].Secret)
+			if err != nil {
+				return nil, err
+			}
+			webhooks[i].Secret = secret
+		}
+		return json.MarshalIndent(webhooks, "", "  ")
+	case chartRunTasksMeta:
+		var tasks chartRunTasks
+		if err := json.Unmarshal(data, &tasks); err != nil {
+			return nil, err
+		}
+		for i := range tasks.Tasks {
+			secret, err := convert(tasks.Tasks[i].Secret)
+			if err != nil {
+				return nil, err
+			}
+			tasks.Tasks[i].Secret = secret
+		}
+		return json.MarshalIndent(tasks, "", "  ")
+	}
+	return data, nil
+}
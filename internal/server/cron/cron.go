@@ -0,0 +1,182 @@
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidExpression = errors.New("invalid cron expression")
+
+// macros are the named expressions cron accepts in place of the five fields.
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	monthNames = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	dayNames   = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+type field struct {
+	name     string
+	min, max int
+	names    []string // Names of the values from min on
+}
+
+var fields = []field{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: monthNames},
+	{name: "day of week", min: 0, max: 7, names: dayNames},
+}
+
+// Schedule is a parsed cron expression. Times are matched to the minute.
+type Schedule struct {
+	minutes, hours, days, months, weekdays uint64
+	// Days of month and of week restricted both match either, like cron.
+	anyDay, anyWeekday bool
+}
+
+// Parse reads a cron expression of five fields (minute, hour, day of month,
+// month and day of week) or one of the macros such as @daily. Fields take
+// *, values, ranges, steps and lists; months and days of week also take
+// their three-letter English names, and Sunday is 0 or 7.
+func Parse(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := macros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return Schedule{}, fmt.Errorf("%w: want 5 fields, got %d", ErrInvalidExpression, len(parts))
+	}
+
+	var sets [5]uint64
+	for i, part := range parts {
+		set, err := parseField(part, fields[i])
+		if err != nil {
+			return Schedule{}, err
+		}
+		sets[i] = set
+	}
+	// Sunday is both 0 and 7.
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+
+	return Schedule{
+		minutes:    sets[0],
+		hours:      sets[1],
+		days:       sets[2],
+		months:     sets[3],
+		weekdays:   sets[4],
+		anyDay:     parts[2] == "*",
+		anyWeekday: parts[4] == "*",
+	}, nil
+}
+
+// Next returns the first time after after the schedule matches, in the
+// location of after, or the zero time when it never does, as for February
+// 30.
+func (s Schedule) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	// Every date the schedule can match comes up within a leap year cycle.
+	limit := t.AddDate(4, 0, 1)
+	for t.Before(limit) {
+		if s.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hours&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s Schedule) matchesDay(t time.Time) bool {
+	day := s.days&(1<<uint(t.Day())) != 0
+	weekday := s.weekdays&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.anyDay && s.anyWeekday:
+		return true
+	case s.anyDay:
+		return weekday
+	case s.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
+
+func parseField(part string, f field) (uint64, error) {
+	var set uint64
+	for item := range strings.SplitSeq(part, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			parsed, err := strconv.Atoi(stepPart)
+			if err != nil || parsed < 1 {
+				return 0, fmt.Errorf("%w: invalid step %q in %s", ErrInvalidExpression, stepPart, f.name)
+			}
+			step = parsed
+		}
+
+		low, high := f.min, f.max
+		if rangePart != "*" {
+			lowPart, highPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = parseValue(lowPart, f); err != nil {
+				return 0, err
+			}
+			high = low
+			if isRange {
+				if high, err = parseValue(highPart, f); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				high = f.max
+			}
+			if high < low {
+				return 0, fmt.Errorf("%w: range %q in %s ends before it starts", ErrInvalidExpression, rangePart, f.name)
+			}
+		}
+		for value := low; value <= high; value += step {
+			set |= 1 << uint(value)
+		}
+	}
+	return set, nil
+}
+
+func parseValue(value string, f field) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(value, name) {
+			return f.min + i, nil
+		}
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < f.min || parsed > f.max {
+		return 0, fmt.Errorf("%w: invalid %s %q", ErrInvalidExpression, f.name, value)
+	}
+	return parsed, nil
+}
@@ -1,66 +1,173 @@
 package server
 
 import (
+	"cmp"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"os"
-	"sync"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/google/uuid"
 	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
 	"github.com/mtolmacs/planemgr/internal/server/deploy"
 	"github.com/mtolmacs/planemgr/internal/server/user"
 )
 
 type deployRequest struct {
-	Id  string `json:"id"`
-	Ref string `json:"ref"`
+	Id string `json:"id" example:"3fa85f64-5717-4562-b3fc-2c963f66afa6"`
+	deployRequestOptions
 }
 
-type deployResponse struct {
-	Ref         string `json:"ref"`
-	RunnerImage string `json:"runnerImage"`
-	ExitCode    int64  `json:"exitCode"`
-	Output      string `json:"output,omitempty"`
+type stackDeployRequest struct {
+	deployRequestOptions
 }
 
-var deployLocks = struct {
-	mu    sync.Mutex
-	locks map[string]struct{}
-}{
-	locks: map[string]struct{}{},
+// deployRequestOptions are the request fields shared by chart and stack
+// deploys.
+type deployRequestOptions struct {
+	Ref              string   `json:"ref" example:"main"`
+	RollbackRef      string   `json:"rollbackRef,omitempty" example:"v1.1.0"`
+	OverridePolicies []string `json:"overridePolicies,omitempty"`
+	AgentLabels      []string `json:"agentLabels,omitempty" example:"region=eu"`
+	Sandbox          bool     `json:"sandbox,omitempty"`
+	ServiceAddress   string   `json:"serviceAddress,omitempty" example:"172.17.0.1:4000"`
+	TimeoutSeconds   int      `json:"timeoutSeconds,omitempty" example:"1800"`    // Defaults to DEPLOY_TIMEOUT
+	RequireApproval  bool     `json:"requireApproval,omitempty"`                  // Wait for an approval after the plan even without a chart approval rule
+	Environment      string   `json:"environment,omitempty" example:"staging"`    // Chart environment to deploy to
+	Destroy          bool     `json:"destroy,omitempty"`                          // Destroy the resources of the module instead of applying it
+	ExpiresInSeconds int      `json:"expiresInSeconds,omitempty" example:"86400"` // Make the environment ephemeral, expiring that long after the request
+	// Secrets of the user to export to the runner, keyed by environment
+	// variable, on top of those the chart maps.
+	Secrets  map[string]string `json:"secrets,omitempty"`
+	Strategy *deployStrategy   `json:"strategy,omitempty"`
 }
 
-func tryAcquireDeployLock(id string) bool {
-	deployLocks.mu.Lock()
-	defer deployLocks.mu.Unlock()
-	if _, exists := deployLocks.locks[id]; exists {
-		return false
+// options returns the deployOptions of the request.
+func (req deployRequestOptions) options() deployOptions {
+	return deployOptions{
+		RollbackRef:      req.RollbackRef,
+		OverridePolicies: req.OverridePolicies,
+		AgentLabels:      req.AgentLabels,
+		Sandbox:          req.Sandbox,
+		ServiceAddress:   req.ServiceAddress,
+		Timeout:          time.Duration(req.TimeoutSeconds) * time.Second,
+		RequireApproval:  req.RequireApproval,
+		Secrets:          req.Secrets,
+		Environment:      req.Environment,
+		Destroy:          req.Destroy,
+		ExpiresIn:        time.Duration(req.ExpiresInSeconds) * time.Second,
 	}
-	deployLocks.locks[id] = struct{}{}
-	return true
 }
 
-func releaseDeployLock(id string) {
-	deployLocks.mu.Lock()
-	defer deployLocks.mu.Unlock()
-	delete(deployLocks.locks, id)
+// deployOptions carries the optional parts of a deploy request.
+type deployOptions struct {
+	RollbackRef      string
+	OverridePolicies []string
+	AgentLabels      []string // Run on a deploy agent carrying these labels
+	Sandbox          bool     // Deploy against the sandbox emulator
+	ServiceAddress   string   // Overrides the host:port the runner clones from, among the allowed ones
+	Timeout          time.Duration
+	PlanOnly         bool              // Stop after the plan, without applying it
+	RequireApproval  bool              // Wait for an approval after the plan
+	Secrets          map[string]string // Secrets of the user by environment variable
+	Environment      string            // Chart environment to deploy to
+	Destroy          bool              // Tear the module down instead of applying it
+	ExpiresIn        time.Duration     // Make the environment expire that long after the request
+}
+
+type deployStageResponse struct {
+	Name        string                     `json:"name"`
+	Status      string                     `json:"status"`
+	ExitCode    int64                      `json:"exitCode"`
+	Output      string                     `json:"output,omitempty"`
+	Check       bool                       `json:"check,omitempty"`
+	Diagnostics []deployDiagnosticResponse `json:"diagnostics,omitempty"`
+}
+
+// deployDiagnosticResponse is an error or warning reported by tofu. The range
+// path is relative to the chart root.
+type deployDiagnosticResponse struct {
+	Severity string                 `json:"severity"`
+	Summary  string                 `json:"summary"`
+	Detail   string                 `json:"detail,omitempty"`
+	Range    *deployDiagnosticRange `json:"range,omitempty"`
+}
+
+type deployDiagnosticRange struct {
+	Path        string `json:"path"`
+	StartLine   int    `json:"startLine"`
+	StartColumn int    `json:"startColumn"`
+	EndLine     int    `json:"endLine"`
+	EndColumn   int    `json:"endColumn"`
+}
+
+type deployPolicyResponse struct {
+	Name    string `json:"name"`
+	Outcome string `json:"outcome"`
+	Message string `json:"message,omitempty"`
+}
+
+type deployResponse struct {
+	DeployID    string                  `json:"deployId"` // Passed to the modules as planemgr_deploy_id
+	Ref         string                  `json:"ref"`
+	Stack       string                  `json:"stack,omitempty"`
+	Environment string                  `json:"environment,omitempty"`
+	Status      string                  `json:"status"`
+	RunnerImage string                  `json:"runnerImage"`
+	ExitCode    int64                   `json:"exitCode"`
+	Output      string                  `json:"output,omitempty"`
+	Stages      []deployStageResponse   `json:"stages,omitempty"`
+	Policies    []deployPolicyResponse  `json:"policies,omitempty"`
+	RunTasks    []deployPolicyResponse  `json:"runTasks,omitempty"`
+	Rollback    *deployResponse         `json:"rollback,omitempty"`
+	Strategy    *deployStrategyResponse `json:"strategy,omitempty"` // Steps of a rollout
 }
 
+// deployStatusRolledBack marks a deploy whose checks failed and whose
+// rollback ref was deployed in its place.
+const deployStatusRolledBack = "rolled_back"
+
+// deployStatusCanceled marks a deploy stopped by DELETE /api/deploy/{id}, or
+// by the client of a waiting request going away.
+const deployStatusCanceled = "canceled"
+
+// defaultDeployTimeout bounds deploys when DEPLOY_TIMEOUT is unset.
+const defaultDeployTimeout = time.Hour
+
 // HandleDeploy handles /api/deploy requests.
 // @Summary Deploy a ref
-// @Description Runs tofu verify and tofu apply for a git ref using the configured runner image.
+// @Description Runs tofu verify and tofu apply for a git ref (branch, tag or commit hash, the branch of the environment or the chart default branch when empty) using the configured runner image. With environment, the deploy targets that environment of the chart: tofu gets its variables as variables, and its managed state, deploy queue and last deployment are its own. Plans deleting resources are blocked when the chart permissions don't allow the user to destroy in the module. With sandbox set, an emulator (localstack unless SANDBOX_IMAGE is set) is started alongside the runner and the providers are pointed at it instead of real cloud accounts; sandbox deploys aren't recorded as the last deployment. serviceAddress picks another host:port the runner reaches the server at, the detected one or one listed in SERVICE_ADDRESS_ALLOWLIST, instead of SERVICE_ADDRESS. Deploys of a stack run one at a time in the order they were requested, and server-side runners are capped at MAX_CONCURRENT_DEPLOYS; later deploys are queued, and the chart is resolved to a commit when the deploy is requested. Queued deploys clone the chart with the access token of the request, so they fail when they wait longer than it lives. The deploy runs in the background: the response is 202 with the deploy ID, its queue position while queued, and a Location to poll for the result at GET /api/deploy/{id}. With wait=true the request blocks until the deploy finished and returns its result instead. Deploys running longer than timeoutSeconds, or DEPLOY_TIMEOUT (an hour by default), have their runner stopped and removed and end as timed_out. With requireApproval, or an approval rule for the module in the chart permissions, the deploy pauses as awaiting_approval once planned and its policies passed, keeping its runner and its place in the queue, until POST /api/deploy/{id}/approve lets it apply the plan or POST /api/deploy/{id}/reject fails it; the wait counts toward the timeout. With destroy, the plan and the apply tear the module down instead, which then no longer counts as deployed. With strategy, the module is rolled out to the idle one of a pair of environments, green, instead: once green deployed and its checks passed, the switch module is deployed with the planemgr_traffic_* variables sending it each canary weight of the traffic, then all of it, and the live environment, blue, is destroyed unless keepBlue is set. A failed switch is deployed again sending all traffic back to blue. Every step is a deploy of its own, listed under steps while the rollout runs. expiresInSeconds makes the environment ephemeral, like setting its expiresAt, so it is destroyed once it expired.
 // @Tags deploy
 // @Security BearerAuth
 // @Accept json
 // @Produce json
 // @Param request body deployRequest true "Deploy request"
+// @Param wait query bool false "Block until the deploy finished and return its result"
+// @Param fields query string false "Comma-separated deploy fields to return with wait, such as status,exitCode"
 // @Success 200 {object} deployResponse
-// @Failure 400 {object} errorResponse
-// @Failure 401 {object} errorResponse
-// @Failure 409 {object} errorResponse
-// @Failure 500 {object} errorResponse
+// @Success 202 {object} deployJobResponse
+// @Failure 400 {object} errorResponse "`invalid_request`, `invalid chart id`, `invalid_pipeline`, `invalid_owners`, `invalid_strategy`, `deploy_failed`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`, `ssh_key_required`"
+// @Failure 404 {object} errorResponse "`chart_not_found`, `ref_not_found`, `deploy_failed`, `ssh_public_key_not_found`, `secret_not_found`, `environment_not_found`"
+// @Failure 409 {object} errorResponse "`chart_busy`, `chart_archived`, `deploy_account_unavailable`, `deploy_canceled`"
+// @Failure 422 {object} errorResponse "`unsafe_tree`"
+// @Failure 423 {object} errorResponse "`chart_locked`"
+// @Failure 500 {object} errorResponse "`pipeline_load_failed`, `chart_settings_failed`, `ref_resolve_failed`, `policy_load_failed`, `owners_load_failed`, `run_task_load_failed`, `deploy_failed`, `service_account_load_failed`, `key_load_failed`, `state_failed`, `secrets_load_failed`"
+// @Failure 503 {object} errorResponse "`deploy_failed`"
+// @Failure 504 {object} errorResponse "`deploy_timed_out`"
 // @Router /deploy [post]
 func HandleDeploy(w http.ResponseWriter, r *http.Request) {
 	claims, err := auth.RequireAccessTokenClaims(r)
@@ -71,20 +178,15 @@ func HandleDeploy(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case http.MethodPost:
-		privateKey, ok := auth.PrivateKeyForSubject(claims.Subject)
-		if !ok {
-			writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized", Message: auth.ErrLoggedOut.Error()})
-			return
-		}
-		HandleDeployCreate(w, r, claims.Subject, privateKey)
+		HandleDeployCreate(w, r, claims.Subject)
 	default:
 		w.Header().Set("Allow", "POST")
-		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "Method_not_allowed"})
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
 	}
 }
 
 // HandleDeployCreate handles POST /api/deploy requests.
-func HandleDeployCreate(w http.ResponseWriter, r *http.Request, subject, privateKey string) {
+func HandleDeployCreate(w http.ResponseWriter, r *http.Request, subject string) {
 	if r.Body == nil {
 		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "Missing request body"})
 		return
@@ -96,59 +198,624 @@ func HandleDeployCreate(w http.ResponseWriter, r *http.Request, subject, private
 		return
 	}
 
-	if _, err := uuid.Parse(req.Id); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid chart id"})
+	opts := req.options()
+	if req.Strategy != nil {
+		runStrategyDeploy(w, r, subject, req.Id, req.Ref, "", *req.Strategy, opts)
+		return
+	}
+	runDeploy(w, r, subject, req.Id, req.Ref, "", opts)
+}
+
+// HandleStackDeploy handles /api/chart/{id}/stack/{name}/deploy requests.
+// @Summary Deploy a chart stack
+// @Description Deploys a single stack (a root module in a top-level subdirectory of the chart) like POST /api/deploy deploys the chart root module, taking the same request fields but the chart ID from the path. Each stack has its own deploy queue, and its managed state and last deployment are its own.
+// @Tags deploy
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Param name path string true "Stack name"
+// @Param request body stackDeployRequest true "Deploy request"
+// @Param wait query bool false "Block until the deploy finished and return its result"
+// @Param fields query string false "Comma-separated deploy fields to return with wait, such as status,exitCode"
+// @Success 200 {object} deployResponse
+// @Success 202 {object} deployJobResponse
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid_request`, `invalid_pipeline`, `invalid_owners`, `invalid_strategy`, `deploy_failed`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`, `ssh_key_required`"
+// @Failure 404 {object} errorResponse "`chart_not_found`, `ref_not_found`, `deploy_failed`, `ssh_public_key_not_found`, `secret_not_found`, `environment_not_found`"
+// @Failure 409 {object} errorResponse "`chart_busy`, `chart_archived`, `deploy_account_unavailable`, `deploy_canceled`"
+// @Failure 422 {object} errorResponse "`unsafe_tree`"
+// @Failure 423 {object} errorResponse "`chart_locked`"
+// @Failure 500 {object} errorResponse "`pipeline_load_failed`, `chart_settings_failed`, `ref_resolve_failed`, `policy_load_failed`, `owners_load_failed`, `run_task_load_failed`, `deploy_failed`, `service_account_load_failed`, `key_load_failed`, `state_failed`, `secrets_load_failed`"
+// @Failure 503 {object} errorResponse "`deploy_failed`"
+// @Failure 504 {object} errorResponse "`deploy_timed_out`"
+// @Router /chart/{id}/stack/{name}/deploy [post]
+func HandleStackDeploy(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
 		return
 	}
-	if !tryAcquireDeployLock(req.Id) {
-		writeJSON(w, http.StatusConflict, errorResponse{Error: "deploy_in_progress", Message: "another deploy is already running"})
+
+	stack := r.PathValue("name")
+	if stack == "" || deploy.ValidateStackName(stack) != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: deploy.ErrInvalidStack.Error()})
+		return
+	}
+
+	if r.Body == nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "Missing request body"})
+		return
+	}
+
+	var req stackDeployRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "Invalid JSON payload"})
+		return
+	}
+
+	opts := req.options()
+	if req.Strategy != nil {
+		runStrategyDeploy(w, r, claims.Subject, r.PathValue("id"), req.Ref, stack, *req.Strategy, opts)
+		return
+	}
+	runDeploy(w, r, claims.Subject, r.PathValue("id"), req.Ref, stack, opts)
+}
+
+// runDeploy checks and starts a deploy of the chart root module, or of a
+// single stack when stack is set. The deploy runs in the background and is
+// answered with 202 and its ID, or in the request with ?wait=true.
+func runDeploy(w http.ResponseWriter, r *http.Request, subject, chartID, ref, stack string, opts deployOptions) {
+	if !validDeployOptions(w, chartID, opts) {
 		return
 	}
-	defer releaseDeployLock(req.Id)
 
+	deployReq, pipeline, ok := prepareDeploy(w, r, subject, chartID, ref, stack, opts)
+	if !ok {
+		return
+	}
+	ticket, ok := enqueueDeploy(chartID, opts.Environment, stack, len(opts.AgentLabels) == 0)
+	if !ok {
+		writeJSON(w, http.StatusConflict, errorResponse{Error: "chart_busy", Message: "the chart is being deleted or squashed"})
+		return
+	}
+	// The environment only expires once the deploy is sure to run.
+	if opts.ExpiresIn > 0 && !expireChartEnvironmentAfter(w, chartID, opts.Environment, subject, opts.ExpiresIn) {
+		ticket.leave()
+		return
+	}
+
+	if wait, _ := strconv.ParseBool(r.URL.Query().Get("wait")); wait {
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		job := startDeployJob(deployReq, ticket, cancel)
+		outcome := runQueuedDeploy(ctx, ticket, deployReq, pipeline, opts)
+		job.finish(outcome)
+		outcome.write(w, r)
+		return
+	}
+
+	// The deploy outlives the request, so it only keeps its values.
+	job := startDeploy(context.WithoutCancel(r.Context()), ticket, deployReq, pipeline, opts)
+	w.Header().Set("Location", "/api/deploy/"+deployReq.DeployID)
+	writeJSON(w, http.StatusAccepted, job.snapshot())
+}
+
+// validDeployOptions checks the chart ID and the options of a deploy
+// request. It writes the error and returns false when they are invalid.
+func validDeployOptions(w http.ResponseWriter, chartID string, opts deployOptions) bool {
+	if !chart.IsChartID(chartID) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid chart id"})
+		return false
+	}
+	if opts.Timeout < 0 {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "timeoutSeconds must not be negative"})
+		return false
+	}
+	if opts.ServiceAddress != "" {
+		if err := deploy.ValidateServiceAddressOverride(opts.ServiceAddress); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: err.Error()})
+			return false
+		}
+	}
+	if err := deploy.ValidateEnvironmentName(opts.Environment); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: err.Error()})
+		return false
+	}
+	if opts.Destroy && opts.RollbackRef != "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "destroy can't be combined with rollbackRef"})
+		return false
+	}
+	if opts.ExpiresIn < 0 || opts.ExpiresIn > 0 && (opts.Environment == "" || opts.Destroy) {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "expiresInSeconds must be positive and needs an environment to deploy to"})
+		return false
+	}
+	return true
+}
+
+// startDeploy runs a queued deploy in the background until it finished or
+// its job is canceled.
+func startDeploy(ctx context.Context, ticket *deployTicket, deployReq deploy.Request, pipeline deploy.Pipeline, opts deployOptions) *deployJob {
+	ctx, cancel := context.WithCancel(ctx)
+	job := startDeployJob(deployReq, ticket, cancel)
+	go func() {
+		defer cancel()
+		job.finish(runQueuedDeploy(ctx, ticket, deployReq, pipeline, opts))
+	}()
+	return job
+}
+
+// prepareDeploy resolves the environment, ref, pipeline, keys, policies and
+// run tasks of a deploy into its request. It writes the error and returns false when the
+// deploy can't start.
+func prepareDeploy(w http.ResponseWriter, r *http.Request, subject, chartID, ref, stack string, opts deployOptions) (deploy.Request, deploy.Pipeline, bool) {
 	token := auth.BearerToken(r)
 	if token == "" {
-		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "Unauthorized"})
-		return
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return deploy.Request{}, deploy.Pipeline{}, false
+	}
+
+	publicKey, privateKey, ok := chartDeployKeys(w, chartID, subject)
+	if !ok {
+		return deploy.Request{}, deploy.Pipeline{}, false
 	}
 
-	publicKey, err := user.LoadUserPublicKey(subject)
+	environment, ok := chartDeployEnvironment(w, chartID, opts.Environment)
+	if !ok {
+		return deploy.Request{}, deploy.Pipeline{}, false
+	}
+	if strings.TrimSpace(ref) == "" && environment != nil {
+		ref = environment.Branch
+	}
+	if strings.TrimSpace(ref) == "" {
+		branch, err := chart.ChartDefaultBranch(chartID)
+		if err != nil {
+			writeChartMetaError(w, err)
+			return deploy.Request{}, deploy.Pipeline{}, false
+		}
+		ref = branch
+	}
+
+	pipeline, err := loadDeployPipeline(chartID, ref, stack)
 	if err != nil {
-		status := http.StatusInternalServerError
-		code := "key_load_failed"
-		if errors.Is(err, os.ErrNotExist) {
-			status = http.StatusNotFound
-			code = "ssh_public_key_not_found"
+		switch {
+		case errors.Is(err, deploy.ErrInvalidRef):
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: err.Error()})
+		case errors.Is(err, deploy.ErrInvalidPipeline):
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_pipeline", Message: err.Error()})
+		case errors.Is(err, git.ErrRepositoryNotExists) || errors.Is(err, os.ErrNotExist):
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "chart_not_found"})
+		case errors.Is(err, plumbing.ErrReferenceNotFound):
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "ref_not_found"})
+		default:
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "pipeline_load_failed", Message: err.Error()})
 		}
-		writeJSON(w, status, errorResponse{Error: code, Message: err.Error()})
+		return deploy.Request{}, deploy.Pipeline{}, false
+	}
+
+	archived, err := isChartArchived(chartID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "chart_settings_failed", Message: err.Error()})
+		return deploy.Request{}, deploy.Pipeline{}, false
+	}
+	if archived {
+		writeJSON(w, http.StatusConflict, errorResponse{Error: "chart_archived", Message: "archived charts cannot be deployed"})
+		return deploy.Request{}, deploy.Pipeline{}, false
+	}
+	if !requireChartUnlocked(w, chartID, subject) {
+		return deploy.Request{}, deploy.Pipeline{}, false
+	}
+
+	commit, err := chart.ResolveChartRef(chartID, ref)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "ref_resolve_failed", Message: err.Error()})
+		return deploy.Request{}, deploy.Pipeline{}, false
+	}
+	if err := chart.ValidateChartTree(chartID, commit); err != nil {
+		if errors.Is(err, chart.ErrUnsafeTree) {
+			writeJSON(w, http.StatusUnprocessableEntity, errorResponse{Error: "unsafe_tree", Message: err.Error()})
+			return deploy.Request{}, deploy.Pipeline{}, false
+		}
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "ref_resolve_failed", Message: err.Error()})
+		return deploy.Request{}, deploy.Pipeline{}, false
+	}
+
+	policies, err := chartPolicies(chartID, opts.Environment, stack, subject)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "policy_load_failed", Message: err.Error()})
+		return deploy.Request{}, deploy.Pipeline{}, false
+	}
+	if slices.Contains(opts.OverridePolicies, deploy.BudgetPolicyName) && !requireChartBudgetAdmin(w, chartID, subject, "only chart admins can override the budget") {
+		return deploy.Request{}, deploy.Pipeline{}, false
+	}
+	if slices.ContainsFunc(policies, func(policy deploy.Policy) bool { return policy.Name == deploy.DestroyPolicyName }) {
+		if err := pipeline.GuardDestroy(); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_pipeline", Message: err.Error()})
+			return deploy.Request{}, deploy.Pipeline{}, false
+		}
+	}
+
+	gates, err := chartRunTaskGates(r, chartID, ref, commit, stack, subject)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "run_task_load_failed", Message: err.Error()})
+		return deploy.Request{}, deploy.Pipeline{}, false
+	}
+
+	if opts.PlanOnly {
+		pipeline = pipeline.PlanOnly()
+	}
+	if opts.Destroy {
+		pipeline = pipeline.Destroy()
+	}
+	deployReq := deploy.Request{
+		Token:            token,
+		DeployID:         uuid.NewString(),
+		ChartID:          chartID,
+		Ref:              ref,
+		Commit:           commit,
+		Stack:            stack,
+		Pipeline:         pipeline,
+		Subject:          subject,
+		PublicKey:        publicKey,
+		PrivateKey:       privateKey,
+		Policies:         policies,
+		OverridePolicies: opts.OverridePolicies,
+		Gates:            gates,
+		PlanOnly:         opts.PlanOnly,
+		Destroy:          opts.Destroy,
+	}
+	if environment != nil {
+		deployReq.Environment = environment.Name
+		deployReq.Variables = environment.Variables
+	}
+	if !opts.PlanOnly {
+		gates, ok := deployApprovalGates(w, deployReq, gates, opts)
+		if !ok {
+			return deploy.Request{}, deploy.Pipeline{}, false
+		}
+		deployReq.Gates = gates
+	}
+	if opts.ServiceAddress != "" {
+		deployReq.ServiceURL = "http://" + opts.ServiceAddress
+	}
+	deployReq.Timeout = cmp.Or(opts.Timeout, deployTimeout())
+	if opts.Sandbox {
+		sandbox := deploy.DefaultSandbox()
+		deployReq.Sandbox = &sandbox
+	} else {
+		// Secrets would point sandbox deploys at real cloud accounts.
+		secrets, ok := chartDeploySecrets(w, chartID, deployReq.Environment, stack, subject, opts.Secrets)
+		if !ok {
+			return deploy.Request{}, deploy.Pipeline{}, false
+		}
+		deployReq.Secrets = secrets
+
+		// Sandbox deploys never created the resources the state tracks.
+		state, err := managedChartState(deployReq)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "state_failed", Message: err.Error()})
+			return deploy.Request{}, deploy.Pipeline{}, false
+		}
+		deployReq.State = state
+	}
+	return deployReq, pipeline, true
+}
+
+// deployOutcome is how a deploy ended: its response, or the error and the
+// status it maps to.
+type deployOutcome struct {
+	status   int
+	response deployResponse
+	err      *errorResponse
+	// deployStatus is the status of deploys that ended without a result,
+	// such as canceled ones.
+	deployStatus string
+}
+
+func (o deployOutcome) write(w http.ResponseWriter, r *http.Request) {
+	if o.err != nil {
+		writeJSON(w, o.status, *o.err)
 		return
 	}
+	writeJSONFields(w, r, o.status, o.response, "")
+}
+
+// runQueuedDeploy waits for the turn of a prepared deploy in the queue, runs
+// it and leaves the queue.
+func runQueuedDeploy(ctx context.Context, ticket *deployTicket, deployReq deploy.Request, pipeline deploy.Pipeline, opts deployOptions) deployOutcome {
+	defer ticket.leave()
+	if err := ticket.wait(ctx); err != nil {
+		return canceledDeploy(deployReq, time.Now(), deploy.Result{})
+	}
+	return executeDeploy(ctx, deployReq, pipeline, opts)
+}
+
+// canceledDeploy records a deploy started at startedAt as canceled, with
+// what its runner printed until then.
+func canceledDeploy(deployReq deploy.Request, startedAt time.Time, result deploy.Result) deployOutcome {
+	deployFinished(deployReq, startedAt, deployStatusCanceled, result, nil)
+	return deployOutcome{status: http.StatusConflict, err: &errorResponse{Error: "deploy_canceled", Message: "the deploy was canceled"}, deployStatus: deployStatusCanceled}
+}
+
+// deployTimeout reads DEPLOY_TIMEOUT, how long deploys may run unless the
+// request sets its own timeout. 0 runs them without a bound.
+func deployTimeout() time.Duration {
+	value := strings.TrimSpace(os.Getenv("DEPLOY_TIMEOUT"))
+	if value == "" {
+		return defaultDeployTimeout
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		log.Printf("Ignoring invalid DEPLOY_TIMEOUT %q", value)
+		return defaultDeployTimeout
+	}
+	return timeout
+}
+
+// executeDeploy runs a prepared deploy and records its outcome. When
+// post-deploy checks fail and the pipeline asks for it, the rollback ref is
+// deployed in its place.
+func executeDeploy(ctx context.Context, deployReq deploy.Request, pipeline deploy.Pipeline, opts deployOptions) deployOutcome {
+	chartID, ref, stack, subject := deployReq.ChartID, deployReq.Ref, deployReq.Stack, deployReq.Subject
+	jobType := jobTypeDeploy
+	if opts.Sandbox {
+		jobType = jobTypeSandbox
+	} else if opts.Destroy {
+		jobType = jobTypeDestroy
+	}
+	startedAt := time.Now()
+	defer leaseChartState(deployReq)()
+	result, err := runDeployRequest(ctx, jobType, deployReq, opts.AgentLabels)
+	if err != nil && ctx.Err() != nil {
+		return canceledDeploy(deployReq, startedAt, result)
+	}
+	if errors.Is(err, deploy.ErrTimedOut) {
+		deployFinished(deployReq, startedAt, deploy.StatusTimedOut, result, err)
+		return deployOutcome{status: http.StatusGatewayTimeout, err: &errorResponse{Error: "deploy_timed_out", Message: err.Error()}, deployStatus: deploy.StatusTimedOut}
+	}
+	rollbackRef := opts.RollbackRef
+	if errors.Is(err, deploy.ErrChecksFailed) && pipeline.OnCheckFailure == deploy.CheckFailureRollback && rollbackRef != "" {
+		rollbackResult, rollbackErr := runRollbackDeploy(ctx, deployReq, rollbackRef, opts.AgentLabels)
+		if rollbackErr != nil {
+			failure := fmt.Errorf("%w; rollback to %s failed: %v", err, rollbackRef, rollbackErr)
+			deployFinished(deployReq, startedAt, deploy.StatusFailed, result, failure)
+			return deployOutcome{status: http.StatusInternalServerError, err: &errorResponse{Error: "deploy_failed", Message: failure.Error()}, deployStatus: deploy.StatusFailed}
+		}
 
-	result, err := deploy.RunDockerDeploy(
-		r.Context(),
-		token,
-		req.Id,
-		req.Ref,
-		subject,
-		publicKey,
-		privateKey,
-	)
+		response := newDeployResponse(deployReq, ref, result)
+		response.Status = deployStatusRolledBack
+		rollback := newDeployResponse(deployReq, rollbackRef, rollbackResult)
+		response.Rollback = &rollback
+		if rollbackCommit, err := chart.ResolveChartRef(chartID, rollbackRef); err == nil && !opts.Sandbox {
+			recordChartDeployment(chartID, chartDeployment{Environment: deployReq.Environment, Stack: stack, Ref: rollbackRef, Commit: rollbackCommit, Status: rollbackResult.Status, Subject: subject, AgentLabels: opts.AgentLabels})
+		}
+		deployFinished(deployReq, startedAt, response.Status, result, nil)
+		return deployOutcome{status: http.StatusOK, response: response}
+	}
 	if err != nil {
+		deployFinished(deployReq, startedAt, deploy.StatusFailed, result, err)
 		status := http.StatusInternalServerError
-		if errors.Is(err, deploy.ErrInvalidRef) || errors.Is(err, deploy.ErrUnsupportedRunner) || errors.Is(err, deploy.ErrInvalidWorkdir) || errors.Is(err, deploy.ErrMissingSSHKey) {
+		if errors.Is(err, deploy.ErrInvalidRef) || errors.Is(err, deploy.ErrUnsupportedRunner) || errors.Is(err, deploy.ErrInvalidWorkdir) || errors.Is(err, deploy.ErrMissingSSHKey) || errors.Is(err, deploy.ErrInvalidStack) || errors.Is(err, deploy.ErrInvalidPipeline) {
 			status = http.StatusBadRequest
 		}
 		if errors.Is(err, os.ErrNotExist) {
 			status = http.StatusNotFound
 		}
-		writeJSON(w, status, errorResponse{Error: "deploy_failed", Message: err.Error()})
+		if errors.Is(err, ErrNoAgent) {
+			status = http.StatusServiceUnavailable
+		}
+		return deployOutcome{status: status, err: &errorResponse{Error: "deploy_failed", Message: err.Error()}}
+	}
+
+	// Sandbox deploys never reached the real cloud, and plans changed
+	// nothing, so neither moves the last deployed ref. Destroyed modules
+	// have none.
+	if opts.Destroy && !opts.Sandbox {
+		forgetChartDeployment(chartID, deployReq.Environment, stack)
+	} else if !opts.Sandbox && !opts.PlanOnly {
+		recordChartDeployment(chartID, chartDeployment{Environment: deployReq.Environment, Stack: stack, Ref: ref, Commit: deployReq.Commit, Status: result.Status, Subject: subject, AgentLabels: opts.AgentLabels})
+	}
+	deployFinished(deployReq, startedAt, result.Status, result, nil)
+	return deployOutcome{status: http.StatusOK, response: newDeployResponse(deployReq, ref, result)}
+}
+
+// deployFinished records the outcome of a deploy attempt started at
+// startedAt, with the result of the runner or the error it failed with, and
+// puts it into the inbox of the user who started it. Neither ever fails the
+// deploy itself.
+func deployFinished(deployReq deploy.Request, startedAt time.Time, status string, result deploy.Result, failure error) {
+	subject, chartID, ref, stack := deployReq.Subject, deployReq.ChartID, deployReq.Ref, deployReq.Stack
+	run := chartDeployRun{
+		DeployID:    deployReq.DeployID,
+		Ref:         ref,
+		Commit:      deployReq.Commit,
+		Stack:       stack,
+		Environment: deployReq.Environment,
+		Sandbox:     deployReq.Sandbox != nil,
+		PlanOnly:    deployReq.PlanOnly,
+		Destroy:     deployReq.Destroy,
+		Status:      status,
+		Subject:     subject,
+		StartedAt:   startedAt.UTC().Format(time.RFC3339),
+		ExitCode:    result.ExitCode,
+		RunnerImage: result.RunnerImage,
+		Output:      result.Output,
+	}
+	for _, policy := range result.Policies {
+		if policy.Outcome == deploy.PolicyOverridden {
+			run.OverriddenPolicies = append(run.OverriddenPolicies, policy.Name)
+		}
+	}
+	if failure != nil {
+		run.Error = failure.Error()
+	}
+	recordChartDeployAttempt(chartID, run)
+
+	target := "chart " + chartID
+	if stack != "" {
+		target += " stack " + stack
+	}
+	if deployReq.Environment != "" {
+		target += " to " + deployReq.Environment
+	}
+
+	action := "Deploy"
+	if deployReq.Destroy {
+		action = "Destroy"
+	}
+	if err := user.NotifyUser(subject, user.Notification{
+		Event:   user.EventDeployFinished,
+		Message: fmt.Sprintf("%s of %s at %s %s", action, target, ref, status),
+		ChartID: chartID,
+		Ref:     ref,
+	}); err != nil {
+		log.Printf("Deploy notification for %s failed: %v", subject, err)
 		return
 	}
+	publishChange(watchTopicEvents + subject)
+}
 
-	writeJSON(w, http.StatusOK, deployResponse{
-		Ref:         req.Ref,
+// runRollbackDeploy deploys rollbackRef with the pipeline defined at that
+// ref, without post-deploy checks or run tasks.
+func runRollbackDeploy(ctx context.Context, req deploy.Request, rollbackRef string, agentLabels []string) (deploy.Result, error) {
+	pipeline, err := loadDeployPipeline(req.ChartID, rollbackRef, req.Stack)
+	if err != nil {
+		return deploy.Result{}, err
+	}
+
+	commit, err := chart.ResolveChartRef(req.ChartID, rollbackRef)
+	if err != nil {
+		return deploy.Result{}, err
+	}
+
+	req.Ref = rollbackRef
+	req.Commit = commit
+	req.Pipeline = pipeline.WithoutChecks()
+	req.Gates = nil
+	return runDeployRequest(ctx, jobTypeRollback, req, agentLabels)
+}
+
+// newDeployResponse answers with the result of deployReq run at ref, which
+// differs from its own for rollbacks.
+func newDeployResponse(deployReq deploy.Request, ref string, result deploy.Result) deployResponse {
+	return deployResponse{
+		DeployID:    deployReq.DeployID,
+		Ref:         ref,
+		Stack:       deployReq.Stack,
+		Environment: deployReq.Environment,
+		Status:      result.Status,
 		RunnerImage: result.RunnerImage,
 		ExitCode:    result.ExitCode,
 		Output:      result.Output,
-	})
+		Stages:      deployStageResponses(result.Stages),
+		Policies:    deployPolicyResponses(result.Policies),
+		RunTasks:    deployPolicyResponses(result.Gates),
+	}
+}
+
+func deployPolicyResponses(results []deploy.PolicyResult) []deployPolicyResponse {
+	responses := make([]deployPolicyResponse, 0, len(results))
+	for _, result := range results {
+		responses = append(responses, deployPolicyResponse{
+			Name:    result.Name,
+			Outcome: result.Outcome,
+			Message: result.Message,
+		})
+	}
+	return responses
+}
+
+// chartPolicies returns the server-side policies configured for a chart.
+func chartPolicies(chartID, environment, stack, subject string) ([]deploy.Policy, error) {
+	var policies []deploy.Policy
+
+	budget, err := loadChartBudget(chartID)
+	if err != nil {
+		return nil, err
+	}
+	if budget.Enabled() {
+		policies = append(policies, deploy.BudgetPolicy(budget))
+	}
+	requiredTags, err := loadChartRequiredTags(chartID)
+	if err != nil {
+		return nil, err
+	}
+	if requiredTags.Enabled() {
+		policies = append(policies, deploy.RequiredTagsPolicy(requiredTags))
+	}
+	if maxCritical, ok := runnerImageMaxCritical(); ok {
+		policies = append(policies, deploy.RunnerImagePolicy(maxCritical))
+	}
+
+	permissions, err := loadChartPermissions(chartID)
+	if err != nil {
+		return nil, err
+	}
+	if !permissions.canDestroy(environment, stack, subject) {
+		policies = append(policies, deploy.DestroyPolicy())
+	}
+
+	return policies, nil
+}
+
+// loadDeployPipeline reads the pipeline definition of the deployed module at
+// ref, falling back to the default pipeline when the chart has none.
+func loadDeployPipeline(chartID, ref, stack string) (deploy.Pipeline, error) {
+	if strings.TrimSpace(ref) == "" {
+		return deploy.Pipeline{}, deploy.ErrInvalidRef
+	}
+
+	_, contents, err := chart.ReadChartFile(chartID, path.Join(stack, deploy.PipelineFile), ref)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return deploy.DefaultPipeline(), nil
+	}
+	if err != nil {
+		return deploy.Pipeline{}, err
+	}
+
+	return deploy.ParsePipeline([]byte(contents))
+}
+
+func deployStageResponses(stages []deploy.StageResult) []deployStageResponse {
+	responses := make([]deployStageResponse, 0, len(stages))
+	for _, stage := range stages {
+		responses = append(responses, deployStageResponse{
+			Name:        stage.Name,
+			Status:      stage.Status,
+			ExitCode:    stage.ExitCode,
+			Output:      stage.Output,
+			Check:       stage.Check,
+			Diagnostics: deployDiagnosticResponses(stage.Diagnostics),
+		})
+	}
+	return responses
+}
+
+func deployDiagnosticResponses(diagnostics []deploy.Diagnostic) []deployDiagnosticResponse {
+	responses := make([]deployDiagnosticResponse, 0, len(diagnostics))
+	for _, diagnostic := range diagnostics {
+		response := deployDiagnosticResponse{
+			Severity: diagnostic.Severity,
+			Summary:  diagnostic.Summary,
+			Detail:   diagnostic.Detail,
+		}
+		if r := diagnostic.Range; r != nil {
+			response.Range = &deployDiagnosticRange{
+				Path:        r.Path,
+				StartLine:   r.StartLine,
+				StartColumn: r.StartColumn,
+				EndLine:     r.EndLine,
+				EndColumn:   r.EndColumn,
+			}
+		}
+		responses = append(responses, response)
+	}
+	return responses
 }
@@ -0,0 +1,87 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// BudgetPolicyName names the budget policy in results and overrides.
+const BudgetPolicyName = "budget"
+
+const (
+	EnforceBlock = "block"
+	EnforceWarn  = "warn"
+)
+
+var ErrInvalidBudget = errors.New("Invalid budget")
+
+// Budget caps what a chart may have deployed after an apply. Costs are
+// estimated from user-maintained monthly unit costs per resource type.
+type Budget struct {
+	MaxResources   int                `json:"maxResources,omitempty"`
+	MaxMonthlyCost float64            `json:"maxMonthlyCost,omitempty"`
+	UnitCosts      map[string]float64 `json:"unitCosts,omitempty"`
+	Enforcement    string             `json:"enforcement,omitempty"`
+}
+
+func (b Budget) Validate() error {
+	if b.MaxResources < 0 || b.MaxMonthlyCost < 0 {
+		return fmt.Errorf("%w: limits must not be negative", ErrInvalidBudget)
+	}
+	for resourceType, cost := range b.UnitCosts {
+		if cost < 0 {
+			return fmt.Errorf("%w: negative unit cost for %s", ErrInvalidBudget, resourceType)
+		}
+	}
+	switch b.Enforcement {
+	case "", EnforceBlock, EnforceWarn:
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown enforcement %q", ErrInvalidBudget, b.Enforcement)
+	}
+}
+
+// Enabled reports whether the budget sets any limit.
+func (b Budget) Enabled() bool {
+	return b.MaxResources > 0 || b.MaxMonthlyCost > 0
+}
+
+// BudgetPolicy checks the planned resource count and estimated monthly cost
+// against the budget.
+func BudgetPolicy(b Budget) Policy {
+	return Policy{
+		Name: BudgetPolicyName,
+		Evaluate: func(_ context.Context, plan Plan) PolicyResult {
+			resources := 0
+			cost := 0.0
+			for _, change := range plan.ResourceChanges {
+				if !change.Remains() {
+					continue
+				}
+				resources++
+				cost += b.UnitCosts[change.Type]
+			}
+
+			var violations []string
+			if b.MaxResources > 0 && resources > b.MaxResources {
+				violations = append(violations, fmt.Sprintf("%d resources exceed the limit of %d", resources, b.MaxResources))
+			}
+			if b.MaxMonthlyCost > 0 && cost > b.MaxMonthlyCost {
+				violations = append(violations, fmt.Sprintf("estimated monthly cost %.2f exceeds the limit of %.2f", cost, b.MaxMonthlyCost))
+			}
+
+			summary := fmt.Sprintf("%d resources, estimated monthly cost %.2f", resources, cost)
+			if len(violations) == 0 {
+				return PolicyResult{Outcome: PolicyPassed, Message: summary}
+			}
+
+			outcome := PolicyBlocked
+			if b.Enforcement == EnforceWarn {
+				outcome = PolicyWarned
+			}
+			return PolicyResult{Outcome: outcome, Message: strings.Join(violations, "; ")}
+		},
+	}
+}
@@ -0,0 +1,194 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	StatusSucceeded = "succeeded"
+	StatusDegraded  = "degraded"
+	StatusFailed    = "failed"
+	StatusTimedOut  = "timed_out"
+)
+
+// Policies for post-deploy check failures.
+const (
+	CheckFailureFail     = "fail"
+	CheckFailureDegrade  = "degrade"
+	CheckFailureRollback = "rollback"
+)
+
+const (
+	defaultProbeTimeout = 10 * time.Second
+	maxProbeBody        = 64 * 1024
+)
+
+var (
+	ErrChecksFailed          = errors.New("Post-deploy checks failed")
+	ErrProbeTargetNotAllowed = errors.New("probe target not allowed")
+)
+
+// probeClient sends HTTP probes. As the server sends them to URLs charts
+// name, it refuses to connect to loopback, link-local, private and
+// unspecified addresses, which would reach the network of the server and
+// cloud metadata endpoints, whatever the host name resolves to. It uses no
+// proxy and doesn't follow redirects, so probes get the redirect itself.
+var probeClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: defaultProbeTimeout, Control: probeDialControl}).DialContext,
+		TLSHandshakeTimeout: defaultProbeTimeout,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// Check is a post-deploy verification. Script checks run in the runner after
+// apply, HTTP probes are sent by the server once the runner exits, to public
+// addresses only.
+type Check struct {
+	Name string     `json:"name"`
+	Run  string     `json:"run,omitempty"`
+	HTTP *HTTPProbe `json:"http,omitempty"`
+}
+
+type HTTPProbe struct {
+	URL            string `json:"url"`
+	Method         string `json:"method,omitempty"`
+	ExpectStatus   int    `json:"expectStatus,omitempty"`
+	Contains       string `json:"contains,omitempty"`
+	TimeoutSeconds int    `json:"timeoutSeconds,omitempty"`
+}
+
+func validateCheck(check Check) error {
+	if !namePattern.MatchString(check.Name) {
+		return fmt.Errorf("%w: invalid check name %q", ErrInvalidPipeline, check.Name)
+	}
+	if (strings.TrimSpace(check.Run) == "") == (check.HTTP == nil) {
+		return fmt.Errorf("%w: check %q needs exactly one of run or http", ErrInvalidPipeline, check.Name)
+	}
+	if check.HTTP != nil && !strings.HasPrefix(check.HTTP.URL, "http://") && !strings.HasPrefix(check.HTTP.URL, "https://") {
+		return fmt.Errorf("%w: check %q has an invalid url", ErrInvalidPipeline, check.Name)
+	}
+	if check.HTTP != nil {
+		target, err := url.Parse(check.HTTP.URL)
+		if err != nil || target.Hostname() == "" {
+			return fmt.Errorf("%w: check %q has an invalid url", ErrInvalidPipeline, check.Name)
+		}
+		if target.Hostname() == "localhost" {
+			return fmt.Errorf("%w: check %q: %w: localhost", ErrInvalidPipeline, check.Name, ErrProbeTargetNotAllowed)
+		}
+		if addr, err := netip.ParseAddr(target.Hostname()); err == nil {
+			if err := allowedProbeAddr(addr); err != nil {
+				return fmt.Errorf("%w: check %q: %w", ErrInvalidPipeline, check.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// probeDialControl refuses probe connections to addresses allowedProbeAddr
+// rejects, checked once the host name is resolved.
+func probeDialControl(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	return allowedProbeAddr(addr)
+}
+
+func allowedProbeAddr(addr netip.Addr) error {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsPrivate() || addr.IsUnspecified() {
+		return fmt.Errorf("%w: %s", ErrProbeTargetNotAllowed, addr)
+	}
+	return nil
+}
+
+// runHTTPProbes sends every HTTP probe of the pipeline and reports each as a
+// stage result.
+func (p Pipeline) runHTTPProbes(ctx context.Context) []StageResult {
+	results := []StageResult{}
+	for _, check := range p.Checks {
+		if check.HTTP == nil {
+			continue
+		}
+
+		result := StageResult{Name: check.Name, Status: StageSucceeded, Check: true}
+		if err := probe(ctx, *check.HTTP); err != nil {
+			result.Status = StageFailed
+			result.ExitCode = 1
+			result.Output = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func probe(ctx context.Context, spec HTTPProbe) error {
+	timeout := defaultProbeTimeout
+	if spec.TimeoutSeconds > 0 {
+		timeout = time.Duration(spec.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	method := spec.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequestWithContext(ctx, method, spec.URL, nil)
+	if err != nil {
+		return fmt.Errorf("Build probe request: %w", err)
+	}
+
+	resp, err := probeClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Probe request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	expected := spec.ExpectStatus
+	if expected == 0 {
+		expected = http.StatusOK
+	}
+	if resp.StatusCode != expected {
+		return fmt.Errorf("Probe returned status %d, expected %d", resp.StatusCode, expected)
+	}
+
+	if spec.Contains != "" {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBody))
+		if err != nil {
+			return fmt.Errorf("Read probe response: %w", err)
+		}
+		if !strings.Contains(string(body), spec.Contains) {
+			return fmt.Errorf("Probe response does not contain %q", spec.Contains)
+		}
+	}
+
+	return nil
+}
+
+// checksFailed reports whether any post-deploy check stage failed.
+func checksFailed(stages []StageResult) bool {
+	for _, stage := range stages {
+		if stage.Check && stage.Status == StageFailed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// DestroyPolicyName names the destroy policy in results.
+const DestroyPolicyName = "destroy"
+
+// DestroyPolicy blocks plans that delete managed resources, including
+// replacements. It is mandatory, so listing it in the overrides has no
+// effect.
+func DestroyPolicy() Policy {
+	return Policy{
+		Name:      DestroyPolicyName,
+		Mandatory: true,
+		Evaluate: func(_ context.Context, plan Plan) PolicyResult {
+			var deleted []string
+			for _, change := range plan.ResourceChanges {
+				if change.Mode == "managed" && slices.Contains(change.Change.Actions, "delete") {
+					deleted = append(deleted, change.Address)
+				}
+			}
+			if len(deleted) == 0 {
+				return PolicyResult{Outcome: PolicyPassed}
+			}
+
+			return PolicyResult{
+				Outcome: PolicyBlocked,
+				Message: fmt.Sprintf("Destroying resources is not permitted: %s", strings.Join(deleted, ", ")),
+			}
+		},
+	}
+}
+
+// GuardDestroy checks that the pipeline can't get around the destroy policy,
+// which only sees the plan. Custom steps and command checks run arbitrary
+// shell, which could destroy resources or rewrite the plan, so they are
+// rejected; the built-in stages and HTTP checks are left.
+func (p Pipeline) GuardDestroy() error {
+	for _, stage := range p.Stages {
+		if !stage.Skip && !slices.Contains(builtinStages, stage.Name) {
+			return fmt.Errorf("%w: stage %q runs a custom command, which deploys restricted by a destroy rule can't", ErrInvalidPipeline, stage.Name)
+		}
+	}
+	return nil
+}
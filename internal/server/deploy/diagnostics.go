@@ -0,0 +1,88 @@
+package deploy
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+)
+
+// Diagnostic is an error or warning reported by tofu. The range, when tofu
+// reports one, points into the chart with the path relative to the chart
+// root.
+type Diagnostic struct {
+	Severity string
+	Summary  string
+	Detail   string
+	Range    *DiagnosticRange
+}
+
+type DiagnosticRange struct {
+	Path        string
+	StartLine   int
+	StartColumn int
+	EndLine     int
+	EndColumn   int
+}
+
+// tofuDiagnostic is the diagnostic object shared by `tofu validate -json`
+// and the machine readable UI of plan and apply.
+type tofuDiagnostic struct {
+	Severity string `json:"severity"`
+	Summary  string `json:"summary"`
+	Detail   string `json:"detail"`
+	Range    *struct {
+		Filename string       `json:"filename"`
+		Start    tofuPosition `json:"start"`
+		End      tofuPosition `json:"end"`
+	} `json:"range"`
+}
+
+type tofuPosition struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// parseDiagnostics extracts the tofu diagnostics from the output of a stage.
+// Validate prints a single JSON document, while plan and apply stream one
+// JSON message per line. Output of custom stages that is neither is ignored.
+// File names are relative to moduleDir.
+func parseDiagnostics(output, moduleDir string) []Diagnostic {
+	var found []tofuDiagnostic
+
+	var validate struct {
+		Diagnostics []tofuDiagnostic `json:"diagnostics"`
+	}
+	if err := json.Unmarshal([]byte(output), &validate); err == nil && len(validate.Diagnostics) > 0 {
+		found = validate.Diagnostics
+	} else {
+		for _, line := range strings.Split(output, "\n") {
+			line = strings.TrimSpace(line)
+			if !strings.HasPrefix(line, "{") {
+				continue
+			}
+			var message struct {
+				Type       string          `json:"type"`
+				Diagnostic *tofuDiagnostic `json:"diagnostic"`
+			}
+			if json.Unmarshal([]byte(line), &message) == nil && message.Type == "diagnostic" && message.Diagnostic != nil {
+				found = append(found, *message.Diagnostic)
+			}
+		}
+	}
+
+	diagnostics := make([]Diagnostic, 0, len(found))
+	for _, d := range found {
+		diagnostic := Diagnostic{Severity: d.Severity, Summary: d.Summary, Detail: d.Detail}
+		if d.Range != nil && d.Range.Filename != "" {
+			diagnostic.Range = &DiagnosticRange{
+				Path:        path.Join(moduleDir, d.Range.Filename),
+				StartLine:   d.Range.Start.Line,
+				StartColumn: d.Range.Start.Column,
+				EndLine:     d.Range.End.Line,
+				EndColumn:   d.Range.End.Column,
+			}
+		}
+		diagnostics = append(diagnostics, diagnostic)
+	}
+	return diagnostics
+}
@@ -5,9 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/moby/moby/api/types/container"
 	"github.com/moby/moby/api/types/mount"
@@ -18,27 +23,131 @@ var ErrInvalidRef = errors.New("Deploy ref is required")
 var ErrUnsupportedRunner = errors.New("Unsupported runner type")
 var ErrInvalidWorkdir = errors.New("Deployment workdir missing or invalid")
 var ErrMissingSSHKey = errors.New("Ssh keys are required for deployment")
+var ErrInvalidStack = errors.New("Invalid stack name")
+var ErrTimedOut = errors.New("Deploy timed out")
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Request describes a single deploy run.
+type Request struct {
+	Token    string
+	DeployID string // Identifies the run to the modules, with Commit
+	ChartID  string
+	Ref      string
+	Commit   string // Ref resolves to
+	Stack    string
+	// Environment of the chart the run deploys to, with its own state.
+	// Empty for deploys without one.
+	Environment string
+	// Variables of the environment, passed to tofu as variables.
+	Variables  map[string]string
+	Pipeline   Pipeline
+	Subject    string
+	PublicKey  string
+	PrivateKey string
+	// Policies are evaluated against the plan before apply. Blocking
+	// policies named in OverridePolicies only warn.
+	Policies         []Policy
+	OverridePolicies []string
+	// Gates pause the pipeline after their stage until they pass.
+	Gates []Gate
+	// ServiceURL is the server base URL the runner clones the chart from.
+	// Defaults to ServiceAddress over http.
+	ServiceURL string
+	// Sandbox, when set, is started alongside the runner and the providers
+	// pointed at it instead of real cloud accounts.
+	Sandbox *Sandbox
+	// Timeout bounds the run, after which the runner is stopped and removed.
+	// Zero runs without a bound.
+	Timeout time.Duration
+	// State, when set, points tofu at the managed state backend of the
+	// server instead of the local state lost with the runner.
+	State *StateBackend
+	// PlanOnly marks runs whose pipeline stops after the plan.
+	PlanOnly bool
+	// Destroy marks runs whose pipeline tears the module down.
+	Destroy bool
+	// Traffic, when set, is passed to the module routing the traffic of a
+	// rollout.
+	Traffic *Traffic
+	// Secrets are exported to the stages, keyed by their environment
+	// variable, and masked in the output.
+	Secrets map[string]string
+}
+
+// StateBackend holds the credentials a deploy uses with the managed state
+// backend, served next to the chart repository it clones.
+type StateBackend struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// stateOverrideFile configures the managed state backend in the deployed
+// module. Override files merge into the configuration tofu reads.
+const stateOverrideFile = "planemgr_backend_override.tf"
 
 type Result struct {
+	Status      string
 	ExitCode    int64
 	Output      string
 	RunnerImage string
+	Stages      []StageResult
+	Policies    []PolicyResult
+	Gates       []PolicyResult
 }
 
-func RunDockerDeploy(
-	ctx context.Context,
-	token string,
-	id string,
-	ref string,
-	subject string,
-	publicKey string,
-	privateKey string,
-) (Result, error) {
-	ref = strings.TrimSpace(ref)
+// RunDockerDeploy runs the deploy of req in a runner container. Deploys
+// running past their timeout fail with ErrTimedOut and the output the runner
+// printed until then.
+func RunDockerDeploy(ctx context.Context, req Request) (Result, error) {
+	if req.Timeout <= 0 {
+		return runDockerDeploy(ctx, req)
+	}
+
+	timeoutCtx, cancel := context.WithTimeoutCause(ctx, req.Timeout, ErrTimedOut)
+	defer cancel()
+	result, err := runDockerDeploy(timeoutCtx, req)
+	if err != nil && errors.Is(context.Cause(timeoutCtx), ErrTimedOut) {
+		result.Status = StatusTimedOut
+		return result, fmt.Errorf("%w after %s", ErrTimedOut, req.Timeout)
+	}
+	return result, err
+}
+
+func runDockerDeploy(ctx context.Context, req Request) (Result, error) {
+	ref := strings.TrimSpace(req.Ref)
 	if ref == "" {
 		return Result{}, ErrInvalidRef
 	}
 
+	moduleDir, err := stackDir(req.Stack)
+	if err != nil {
+		return Result{}, err
+	}
+
+	pipeline := req.Pipeline
+	if len(pipeline.Stages) == 0 {
+		pipeline = DefaultPipeline()
+	}
+	if len(req.Policies) > 0 {
+		pipeline, err = pipeline.withPolicyHook()
+		if err != nil {
+			return Result{}, err
+		}
+	}
+	if slices.ContainsFunc(req.Policies, func(policy Policy) bool { return policy.Name == DestroyPolicyName }) {
+		if err := pipeline.GuardDestroy(); err != nil {
+			return Result{}, err
+		}
+	}
+	if len(req.Gates) > 0 {
+		pipeline, err = pipeline.withGates(req.Gates)
+		if err != nil {
+			return Result{}, err
+		}
+	}
+	stageScript, stageEnv := pipeline.script()
+
 	runnerImage, err := resolveRunnerImage()
 	if err != nil {
 		return Result{}, err
@@ -50,46 +159,53 @@ func RunDockerDeploy(
 	}
 	defer cli.Close()
 
-	subject = strings.TrimSpace(subject)
+	subject := strings.TrimSpace(req.Subject)
 	if subject == "" {
 		return Result{}, ErrInvalidWorkdir
 	}
 	if subject != filepath.Base(subject) || strings.Contains(subject, "/") || strings.Contains(subject, "\\") {
 		return Result{}, ErrInvalidWorkdir
 	}
-	if strings.TrimSpace(publicKey) == "" || strings.TrimSpace(privateKey) == "" {
+	if strings.TrimSpace(req.PublicKey) == "" || strings.TrimSpace(req.PrivateKey) == "" {
 		return Result{}, ErrMissingSSHKey
 	}
 
-	serviceAddress := os.Getenv("SERVICE_ADDRESS")
-	if serviceAddress == "" {
-		serviceAddress = "host.docker.internal:4000"
+	repo, err := chartRepoURL(req)
+	if err != nil {
+		return Result{}, err
+	}
+	stateEnv, stateScript, err := stateBackendConfig(req)
+	if err != nil {
+		return Result{}, err
 	}
-
-	repo := fmt.Sprintf("http://access:%s@%s/api/chart/%s.git", token, serviceAddress, id)
 
 	config := &container.Config{
 		Image: runnerImage,
 		Tty:   true,
-		Env: []string{
+		Env: append([]string{
 			fmt.Sprintf("DEPLOY_REPO=%s", repo),
 			fmt.Sprintf("DEPLOY_REF=%s", ref),
 			"GIT_TERMINAL_PROMPT=0",
-		},
+		}, slices.Concat(req.contextEnv(), req.variablesEnv(), stateEnv, stageEnv)...),
 		Cmd: []string{
 			"sh",
 			"-c",
 			`while [ ! -s /runner/.ssh/id_ed25519 ] || [ ! -s /runner/.ssh/id_ed25519.pub ]; do sleep 0.05; done && ` +
 				`git clone "$DEPLOY_REPO" && ` +
-				"cd " + id + " && " +
+				"cd " + req.ChartID + " && " +
 				`git switch --detach "$DEPLOY_REF" && ` +
-				"tofu validate --json && " +
-				"tofu apply -auto-approve --json",
+				"cd " + moduleDir + " && " +
+				req.secretsScript() +
+				stateScript +
+				stageScript,
 		},
 	}
 	hostConfig := &container.HostConfig{
 		// Use host networking so the runner can reach localhost-bound services.
 		NetworkMode: "host",
+		// Docker Desktop resolves the host gateway name by itself, Linux
+		// only when asked to.
+		ExtraHosts: []string{hostGatewayName + ":host-gateway"},
 		// Store credentials in a container tmpfs to avoid host disk writes.
 		Mounts: []mount.Mount{
 			{
@@ -102,6 +218,19 @@ func RunDockerDeploy(
 		},
 	}
 
+	if req.Sandbox != nil {
+		sandboxID, err := startSandbox(ctx, cli, *req.Sandbox)
+		if sandboxID != "" {
+			defer func() {
+				_, _ = cli.ContainerRemove(context.WithoutCancel(ctx), sandboxID, client.ContainerRemoveOptions{Force: true})
+			}()
+		}
+		if err != nil {
+			return Result{}, err
+		}
+		config.Env = append(config.Env, req.Sandbox.Env...)
+	}
+
 	resp, err := cli.ContainerCreate(ctx, client.ContainerCreateOptions{
 		Config:     config,
 		HostConfig: hostConfig,
@@ -110,18 +239,55 @@ func RunDockerDeploy(
 		return Result{}, fmt.Errorf("Create deploy container: %w", err)
 	}
 	containerID := resp.ID
+	// Canceled deploys still remove their container, which stops it.
 	defer func() {
-		_, _ = cli.ContainerRemove(ctx, containerID, client.ContainerRemoveOptions{Force: true})
+		_, _ = cli.ContainerRemove(context.WithoutCancel(ctx), containerID, client.ContainerRemoveOptions{Force: true})
 	}()
 
 	if _, err := cli.ContainerStart(ctx, containerID, client.ContainerStartOptions{}); err != nil {
 		return Result{}, fmt.Errorf("Start deploy container: %w", err)
 	}
 
-	if err := writeSSHKeysToContainer(ctx, cli, containerID, publicKey, privateKey); err != nil {
+	// The runner waits for the keys, so the secrets are in place before.
+	if err := writeSecretsToContainer(ctx, cli, containerID, req.Secrets); err != nil {
+		return Result{}, err
+	}
+	if err := writeSSHKeysToContainer(ctx, cli, containerID, req.PublicKey, req.PrivateKey); err != nil {
 		return Result{}, err
 	}
 
+	hookCtx, stopHook := context.WithCancel(ctx)
+	defer stopHook()
+	policyResults := make(chan []PolicyResult, 1)
+	if len(req.Policies) > 0 {
+		hook := policyHook{policies: req.Policies, overrides: req.OverridePolicies}
+		go func() {
+			results, err := hook.run(hookCtx, cli, containerID)
+			if err != nil && hookCtx.Err() == nil {
+				// The runner waits for a verdict forever, stop it instead.
+				results = append(results, PolicyResult{Name: "policy", Outcome: PolicyBlocked, Message: err.Error()})
+				_, _ = cli.ContainerKill(ctx, containerID, client.ContainerKillOptions{})
+			}
+			policyResults <- results
+		}()
+	} else {
+		policyResults <- nil
+	}
+	gateResults := make(chan []PolicyResult, 1)
+	if len(req.Gates) > 0 {
+		hook := gateHook{gates: req.Gates}
+		go func() {
+			results, err := hook.run(hookCtx, cli, containerID)
+			if err != nil && hookCtx.Err() == nil {
+				results = append(results, PolicyResult{Name: "gate", Outcome: PolicyBlocked, Message: err.Error()})
+				_, _ = cli.ContainerKill(ctx, containerID, client.ContainerKillOptions{})
+			}
+			gateResults <- results
+		}()
+	} else {
+		gateResults <- nil
+	}
+
 	waitResult := cli.ContainerWait(ctx, containerID, client.ContainerWaitOptions{
 		Condition: container.WaitConditionNotRunning,
 	})
@@ -129,11 +295,19 @@ func RunDockerDeploy(
 	select {
 	case err := <-waitResult.Error:
 		if err != nil {
-			return Result{}, fmt.Errorf("Wait for deploy container: %w", err)
+			// Stopped runners still tell how far they got.
+			var output string
+			if ctx.Err() != nil {
+				output = maskSecrets(containerOutput(context.WithoutCancel(ctx), cli, containerID), req.Secrets)
+			}
+			return Result{Output: output, RunnerImage: runnerImage}, fmt.Errorf("Wait for deploy container: %w", err)
 		}
 	case status := <-waitResult.Result:
 		statusCode = status.StatusCode
 	}
+	stopHook()
+	policies := <-policyResults
+	gates := <-gateResults
 
 	logs, err := cli.ContainerLogs(ctx, containerID, client.ContainerLogsOptions{
 		ShowStdout: true,
@@ -149,19 +323,128 @@ func RunDockerDeploy(
 		return Result{}, fmt.Errorf("Read deploy output: %w", err)
 	}
 
-	output := strings.TrimSpace(string(outputBytes))
+	stages, output := pipeline.splitStageOutput(maskSecrets(string(outputBytes), req.Secrets))
+	for i := range stages {
+		stages[i].Diagnostics = parseDiagnostics(stages[i].Output, moduleDir)
+	}
 	result := Result{
+		Status:      StatusSucceeded,
 		ExitCode:    statusCode,
 		Output:      output,
 		RunnerImage: runnerImage,
+		Stages:      stages,
+		Policies:    policies,
+		Gates:       gates,
 	}
 	if statusCode != 0 {
+		result.Status = StatusFailed
 		return result, fmt.Errorf("Deploy failed: exit %d\n%s", statusCode, output)
 	}
 
+	result.Stages = append(result.Stages, pipeline.runHTTPProbes(ctx)...)
+	if checksFailed(result.Stages) {
+		if pipeline.OnCheckFailure == CheckFailureDegrade {
+			result.Status = StatusDegraded
+			return result, nil
+		}
+		result.Status = StatusFailed
+		return result, ErrChecksFailed
+	}
+
 	return result, nil
 }
 
+// containerOutput returns what a container printed so far, or nothing when
+// its logs can't be read.
+func containerOutput(ctx context.Context, cli *client.Client, containerID string) string {
+	logs, err := cli.ContainerLogs(ctx, containerID, client.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+	})
+	if err != nil {
+		return ""
+	}
+	defer logs.Close()
+
+	output, _ := io.ReadAll(logs)
+	return string(output)
+}
+
+// ValidateStackName reports whether name can address a stack directory at
+// the root of a chart repo. An empty name selects the root module.
+func ValidateStackName(name string) error {
+	if name == "" {
+		return nil
+	}
+	if !namePattern.MatchString(name) {
+		return ErrInvalidStack
+	}
+	return nil
+}
+
+// stackDir returns the module directory relative to the chart root.
+func stackDir(stack string) (string, error) {
+	if err := ValidateStackName(stack); err != nil {
+		return "", err
+	}
+	return path.Join(".", stack), nil
+}
+
+// chartRepoURL returns the clone URL of the deployed chart, authenticated
+// with the request token.
+func chartRepoURL(req Request) (string, error) {
+	base, err := serviceBaseURL(req)
+	if err != nil {
+		return "", err
+	}
+	base.User = url.UserPassword("access", req.Token)
+	return base.JoinPath("api", "chart", req.ChartID+".git").String(), nil
+}
+
+// stateBackendConfig returns the environment and the script configuring the
+// managed state backend of the request, or nothing without one.
+func stateBackendConfig(req Request) ([]string, string, error) {
+	if req.State == nil {
+		return nil, "", nil
+	}
+	base, err := serviceBaseURL(req)
+	if err != nil {
+		return nil, "", err
+	}
+
+	address := base.JoinPath("api", "chart", req.ChartID, "state")
+	if req.Stack != "" {
+		address = base.JoinPath("api", "chart", req.ChartID, "stack", req.Stack, "state")
+	}
+	if req.Environment != "" {
+		address.RawQuery = url.Values{"environment": {req.Environment}}.Encode()
+	}
+	env := []string{
+		"TF_HTTP_ADDRESS=" + address.String(),
+		"TF_HTTP_LOCK_ADDRESS=" + address.String(),
+		"TF_HTTP_UNLOCK_ADDRESS=" + address.String(),
+		"TF_HTTP_USERNAME=" + req.State.Username,
+		"TF_HTTP_PASSWORD=" + req.State.Password,
+	}
+	script := `printf 'terraform {\n  backend "http" {}\n}\n' > ` + stateOverrideFile + " && "
+	return env, script, nil
+}
+
+// serviceBaseURL returns the server base URL the runner reaches the chart
+// at.
+func serviceBaseURL(req Request) (*url.URL, error) {
+	serviceURL := strings.TrimSpace(req.ServiceURL)
+	if serviceURL == "" {
+		serviceURL = "http://" + ServiceAddress()
+	}
+
+	base, err := url.Parse(serviceURL)
+	if err != nil || base.Host == "" {
+		return nil, fmt.Errorf("Invalid service URL %q", serviceURL)
+	}
+	return base, nil
+}
+
 func resolveRunnerImage() (string, error) {
 	customImage := strings.TrimSpace(os.Getenv("RUNNER_IMAGE"))
 	switch strings.TrimSpace(os.Getenv("RUNNER_IMAGE")) {
@@ -213,7 +496,7 @@ func execWriteFile(
 	ctx context.Context,
 	cli *client.Client,
 	containerID string,
-	path string,
+	filePath string,
 	contents string,
 	perm os.FileMode,
 ) error {
@@ -224,33 +507,33 @@ func execWriteFile(
 		Cmd: []string{
 			"sh",
 			"-c",
-			fmt.Sprintf("umask 077; mkdir -p /runner/.ssh; cat > %s; chmod %04o %s", path, perm, path),
+			fmt.Sprintf("umask 077; mkdir -p %s; cat > %s; chmod %04o %s", path.Dir(filePath), filePath, perm, filePath),
 		},
 	})
 	if err != nil {
-		return fmt.Errorf("Create ssh key exec: %w", err)
+		return fmt.Errorf("Create write exec: %w", err)
 	}
 
 	attach, err := cli.ExecAttach(ctx, execCreate.ID, client.ExecAttachOptions{})
 	if err != nil {
-		return fmt.Errorf("Attach ssh key exec: %w", err)
+		return fmt.Errorf("Attach write exec: %w", err)
 	}
 	defer attach.Close()
 
 	if _, err := attach.Conn.Write([]byte(contents)); err != nil {
-		return fmt.Errorf("Send ssh key to container: %w", err)
+		return fmt.Errorf("Send %s to container: %w", filePath, err)
 	}
 	if err := attach.CloseWrite(); err != nil {
-		return fmt.Errorf("Close ssh key exec input: %w", err)
+		return fmt.Errorf("Close write exec input: %w", err)
 	}
 	_, _ = io.Copy(io.Discard, attach.Reader)
 
 	inspect, err := cli.ExecInspect(ctx, execCreate.ID, client.ExecInspectOptions{})
 	if err != nil {
-		return fmt.Errorf("Inspect ssh key exec: %w", err)
+		return fmt.Errorf("Inspect write exec: %w", err)
 	}
 	if inspect.ExitCode != 0 {
-		return fmt.Errorf("Write ssh key failed: exit %d", inspect.ExitCode)
+		return fmt.Errorf("Write %s failed: exit %d", filePath, inspect.ExitCode)
 	}
 
 	return nil
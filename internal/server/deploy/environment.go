@@ -0,0 +1,54 @@
+package deploy
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var ErrInvalidEnvironment = errors.New("Environment names are 1-63 lowercase letters, digits and dashes")
+var ErrInvalidVariable = errors.New("Invalid environment variable name")
+
+var environmentPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// variablePattern matches the identifiers tofu accepts as variable names.
+var variablePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// ValidateEnvironmentName reports whether name can address an environment
+// of a chart. An empty name selects the chart without an environment.
+func ValidateEnvironmentName(name string) error {
+	if name != "" && !environmentPattern.MatchString(name) {
+		return ErrInvalidEnvironment
+	}
+	return nil
+}
+
+// ValidateVariableName reports whether name can be set as a tofu variable
+// of an environment. The planemgr_ variables describe the run and are set
+// by the runner.
+func ValidateVariableName(name string) error {
+	if !variablePattern.MatchString(name) {
+		return fmt.Errorf("%w %q", ErrInvalidVariable, name)
+	}
+	if strings.HasPrefix(strings.ToLower(name), "planemgr_") {
+		return fmt.Errorf("%w %q: reserved by the runner", ErrInvalidVariable, name)
+	}
+	return nil
+}
+
+// variablesEnv passes the variables of the environment of req to tofu.
+func (req Request) variablesEnv() []string {
+	names := make([]string, 0, len(req.Variables))
+	for name := range req.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	env := make([]string, 0, len(names))
+	for _, name := range names {
+		env = append(env, "TF_VAR_"+name+"="+req.Variables[name])
+	}
+	return env
+}
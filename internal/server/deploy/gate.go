@@ -0,0 +1,111 @@
+package deploy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/moby/moby/client"
+)
+
+const gateDir = "/runner/.gate"
+
+// Gate pauses a deploy once the After stage finished, until Evaluate decides
+// whether it may continue. Gates run even when the stage before them was
+// skipped, and any blocking result fails the deploy.
+type Gate struct {
+	After    string
+	Evaluate func(ctx context.Context, input GateInput) []PolicyResult
+}
+
+// GateInput is what a gate knows about the paused deploy.
+type GateInput struct {
+	Stage string `json:"stage"`
+	// Plan is the `tofu show -json` output, when the plan stage already ran.
+	Plan json.RawMessage `json:"plan,omitempty" swaggertype:"object"`
+}
+
+// GateStageName is the name of the pipeline stage waiting for the gate
+// placed after stage.
+func GateStageName(stage string) string {
+	return "gate-" + stage
+}
+
+// gateStageCommand hands the plan, if there is one, to the server and waits
+// for the verdict of the gate after stage.
+func gateStageCommand(stage string) string {
+	dir := gateDir + "/" + stage
+	return `mkdir -p ` + dir + ` && { [ ! -e tfplan.json ] || cp tfplan.json ` + dir + `/plan.json; } && ` +
+		`echo "` + stageMarker + `gate::` + stage + `" && ` +
+		`while [ ! -e ` + dir + `/verdict ]; do sleep 0.2; done; ` +
+		`cat ` + dir + `/report; exit "$(cat ` + dir + `/verdict)"`
+}
+
+// withGates places a stage waiting for each gate right after the stage it
+// follows.
+func (p Pipeline) withGates(gates []Gate) (Pipeline, error) {
+	stages := slices.Clone(p.Stages)
+	for _, gate := range gates {
+		index := stageIndex(stages, gate.After)
+		if index < 0 || stages[index].Check {
+			return Pipeline{}, fmt.Errorf("%w: gate after unknown stage %q", ErrInvalidPipeline, gate.After)
+		}
+		name := GateStageName(gate.After)
+		if stageIndex(stages, name) >= 0 {
+			return Pipeline{}, fmt.Errorf("%w: duplicate stage %q", ErrInvalidPipeline, name)
+		}
+		stages = slices.Insert(stages, index+1, Stage{Name: name, Run: gateStageCommand(gate.After)})
+	}
+
+	p.Stages = stages
+	return p, nil
+}
+
+// gateHook evaluates gates as the runner reaches them.
+type gateHook struct {
+	gates []Gate
+}
+
+// run follows the runner output and answers every gate the runner waits on,
+// returning the results of all gates evaluated.
+func (h gateHook) run(ctx context.Context, cli *client.Client, containerID string) ([]PolicyResult, error) {
+	logs, err := cli.ContainerLogs(ctx, containerID, client.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Follow deploy logs: %w", err)
+	}
+	defer logs.Close()
+
+	var results []PolicyResult
+	scanner := bufio.NewScanner(logs)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		stage, ok := strings.CutPrefix(strings.TrimRight(scanner.Text(), "\r"), stageMarker+"gate::")
+		if !ok {
+			continue
+		}
+		index := slices.IndexFunc(h.gates, func(gate Gate) bool { return gate.After == stage })
+		if index < 0 {
+			continue
+		}
+
+		dir := gateDir + "/" + stage
+		input := GateInput{Stage: stage}
+		if plan, err := execReadFile(ctx, cli, containerID, dir+"/plan.json"); err == nil && json.Valid(plan) {
+			input.Plan = plan
+		}
+		gateResults := h.gates[index].Evaluate(ctx, input)
+		results = append(results, gateResults...)
+		if err := writeVerdict(ctx, cli, containerID, dir, "gate", gateResults); err != nil {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
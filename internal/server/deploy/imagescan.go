@@ -0,0 +1,145 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RunnerImagePolicyName names the runner image policy in results and
+// overrides.
+const RunnerImagePolicyName = "runner_image"
+
+const SeverityCritical = "CRITICAL"
+
+// ImageScan is a trivy vulnerability report of the runner image.
+type ImageScan struct {
+	Image           string               `json:"image"`
+	ScannedAt       time.Time            `json:"scannedAt"`
+	Counts          map[string]int       `json:"counts"` // Vulnerabilities per severity
+	Vulnerabilities []ImageVulnerability `json:"vulnerabilities"`
+}
+
+type ImageVulnerability struct {
+	ID               string `json:"id"`
+	Package          string `json:"package"`
+	InstalledVersion string `json:"installedVersion"`
+	FixedVersion     string `json:"fixedVersion,omitempty"`
+	Severity         string `json:"severity"`
+	Title            string `json:"title,omitempty"`
+}
+
+type trivyReport struct {
+	Results []struct {
+		Vulnerabilities []struct {
+			VulnerabilityID  string
+			PkgName          string
+			InstalledVersion string
+			FixedVersion     string
+			Severity         string
+			Title            string
+		}
+	}
+}
+
+var (
+	lastImageScan   *ImageScan
+	lastImageScanMu sync.Mutex
+)
+
+// ScanRunnerImage scans the runner image with trivy and keeps the report as
+// the latest scan. The trivy binary is looked up on PATH unless TRIVY_PATH is
+// set.
+func ScanRunnerImage(ctx context.Context) (ImageScan, error) {
+	image, err := resolveRunnerImage()
+	if err != nil {
+		return ImageScan{}, err
+	}
+	trivy := strings.TrimSpace(os.Getenv("TRIVY_PATH"))
+	if trivy == "" {
+		trivy = "trivy"
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, trivy, "image", "--quiet", "--format", "json", "--scanners", "vuln", image)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return ImageScan{}, fmt.Errorf("Scan runner image: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var report trivyReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		return ImageScan{}, fmt.Errorf("Read runner image scan: %w", err)
+	}
+
+	scan := ImageScan{
+		Image:           image,
+		ScannedAt:       time.Now().UTC(),
+		Counts:          map[string]int{},
+		Vulnerabilities: []ImageVulnerability{},
+	}
+	for _, result := range report.Results {
+		for _, vuln := range result.Vulnerabilities {
+			scan.Counts[vuln.Severity]++
+			scan.Vulnerabilities = append(scan.Vulnerabilities, ImageVulnerability{
+				ID:               vuln.VulnerabilityID,
+				Package:          vuln.PkgName,
+				InstalledVersion: vuln.InstalledVersion,
+				FixedVersion:     vuln.FixedVersion,
+				Severity:         vuln.Severity,
+				Title:            vuln.Title,
+			})
+		}
+	}
+
+	lastImageScanMu.Lock()
+	lastImageScan = &scan
+	lastImageScanMu.Unlock()
+
+	return scan, nil
+}
+
+// LastRunnerImageScan returns the latest runner image scan, if any.
+func LastRunnerImageScan() (ImageScan, bool) {
+	lastImageScanMu.Lock()
+	defer lastImageScanMu.Unlock()
+
+	if lastImageScan == nil {
+		return ImageScan{}, false
+	}
+	return *lastImageScan, true
+}
+
+// RunnerImagePolicy blocks deploys while the latest scan of the runner image
+// found more critical vulnerabilities than maxCritical. Deploys only warn
+// until the image was scanned.
+func RunnerImagePolicy(maxCritical int) Policy {
+	return Policy{
+		Name: RunnerImagePolicyName,
+		Evaluate: func(_ context.Context, _ Plan) PolicyResult {
+			scan, ok := LastRunnerImageScan()
+			if !ok {
+				return PolicyResult{Outcome: PolicyWarned, Message: "Runner image was not scanned"}
+			}
+
+			critical := scan.Counts[SeverityCritical]
+			if critical > maxCritical {
+				return PolicyResult{
+					Outcome: PolicyBlocked,
+					Message: fmt.Sprintf("Runner image %s has %d critical vulnerabilities, the limit is %d", scan.Image, critical, maxCritical),
+				}
+			}
+			return PolicyResult{
+				Outcome: PolicyPassed,
+				Message: fmt.Sprintf("Runner image %s has %d critical vulnerabilities", scan.Image, critical),
+			}
+		},
+	}
+}
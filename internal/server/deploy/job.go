@@ -0,0 +1,140 @@
+package deploy
+
+import (
+	"cmp"
+	"errors"
+	"time"
+)
+
+// Job is a deploy request in the form handed to remote deploy agents.
+// Policies are functions, so a job carries their settings instead and the
+// agent rebuilds them.
+type Job struct {
+	ID                     string        `json:"id"`
+	Token                  string        `json:"token"`
+	DeployID               string        `json:"deployId,omitempty"`
+	ChartID                string        `json:"chartId"`
+	Ref                    string        `json:"ref"`
+	Commit                 string        `json:"commit,omitempty"`
+	Stack                  string        `json:"stack,omitempty"`
+	Pipeline               Pipeline      `json:"pipeline"`
+	Subject                string        `json:"subject"`
+	PublicKey              string        `json:"publicKey"`
+	PrivateKey             string        `json:"privateKey"`
+	Budget                 *Budget       `json:"budget,omitempty"`
+	RequiredTags           *RequiredTags `json:"requiredTags,omitempty"`
+	RunnerImageMaxCritical *int          `json:"runnerImageMaxCritical,omitempty"`
+	DenyDestroy            bool          `json:"denyDestroy,omitempty"`
+	OverridePolicies       []string      `json:"overridePolicies,omitempty"`
+	Sandbox                *Sandbox      `json:"sandbox,omitempty"`
+	ServiceURL             string        `json:"serviceUrl,omitempty"` // Overrides the agent's server URL
+	// Gates are the stages the agent pauses after, asking the server for
+	// the verdict.
+	Gates          []string          `json:"gates,omitempty"`
+	TimeoutSeconds int               `json:"timeoutSeconds,omitempty"`
+	State          *StateBackend     `json:"state,omitempty"`
+	Secrets        map[string]string `json:"secrets,omitempty"`
+	Environment    string            `json:"environment,omitempty"`
+	Variables      map[string]string `json:"variables,omitempty"`
+	Traffic        *Traffic          `json:"traffic,omitempty"`
+}
+
+// Request returns the deploy request of the job, cloning the chart from
+// serviceURL unless the job overrides it.
+func (j Job) Request(serviceURL string) Request {
+	var policies []Policy
+	if j.Budget != nil && j.Budget.Enabled() {
+		policies = append(policies, BudgetPolicy(*j.Budget))
+	}
+	if j.RequiredTags != nil && j.RequiredTags.Enabled() {
+		policies = append(policies, RequiredTagsPolicy(*j.RequiredTags))
+	}
+	if j.RunnerImageMaxCritical != nil {
+		policies = append(policies, RunnerImagePolicy(*j.RunnerImageMaxCritical))
+	}
+	if j.DenyDestroy {
+		policies = append(policies, DestroyPolicy())
+	}
+
+	return Request{
+		Token:            j.Token,
+		DeployID:         j.DeployID,
+		ChartID:          j.ChartID,
+		Ref:              j.Ref,
+		Commit:           j.Commit,
+		Stack:            j.Stack,
+		Pipeline:         j.Pipeline,
+		Subject:          j.Subject,
+		PublicKey:        j.PublicKey,
+		PrivateKey:       j.PrivateKey,
+		Policies:         policies,
+		OverridePolicies: j.OverridePolicies,
+		ServiceURL:       cmp.Or(j.ServiceURL, serviceURL),
+		Sandbox:          j.Sandbox,
+		Timeout:          time.Duration(j.TimeoutSeconds) * time.Second,
+		State:            j.State,
+		Secrets:          j.Secrets,
+		Environment:      j.Environment,
+		Variables:        j.Variables,
+		Traffic:          j.Traffic,
+	}
+}
+
+// JobResult is the outcome of a job reported back by an agent.
+type JobResult struct {
+	Result Result `json:"result"`
+	Error  string `json:"error,omitempty"`
+	// Kind is the message of the deploy error the failure wraps, so the
+	// server can tell failed checks and invalid requests apart.
+	Kind string `json:"kind,omitempty"`
+}
+
+// jobErrors are the deploy errors preserved across an agent round trip.
+var jobErrors = []error{
+	ErrChecksFailed,
+	ErrInvalidRef,
+	ErrUnsupportedRunner,
+	ErrInvalidWorkdir,
+	ErrMissingSSHKey,
+	ErrInvalidStack,
+	ErrInvalidPipeline,
+	ErrTimedOut,
+}
+
+// NewJobResult wraps the outcome of RunDockerDeploy for the server.
+func NewJobResult(result Result, err error) JobResult {
+	jobResult := JobResult{Result: result}
+	if err == nil {
+		return jobResult
+	}
+
+	jobResult.Error = err.Error()
+	for _, kind := range jobErrors {
+		if errors.Is(err, kind) {
+			jobResult.Kind = kind.Error()
+			break
+		}
+	}
+	return jobResult
+}
+
+// Err returns the deploy error of the job, if it failed.
+func (r JobResult) Err() error {
+	if r.Error == "" {
+		return nil
+	}
+	for _, kind := range jobErrors {
+		if r.Kind == kind.Error() {
+			return &jobError{message: r.Error, kind: kind}
+		}
+	}
+	return errors.New(r.Error)
+}
+
+type jobError struct {
+	message string
+	kind    error
+}
+
+func (e *jobError) Error() string { return e.message }
+func (e *jobError) Unwrap() error { return e.kind }
@@ -0,0 +1,384 @@
+package deploy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// PipelineFile is the chart file that customizes the deploy pipeline. It is
+// read from the deployed module directory at the deployed ref.
+const PipelineFile = "planemgr.pipeline.json"
+
+const (
+	StageInit       = "init"
+	StageValidate   = "validate"
+	StagePlan       = "plan"
+	StagePolicy     = "policy"
+	StageApply      = "apply"
+	StagePostChecks = "post-checks"
+)
+
+const (
+	StageSucceeded = "succeeded"
+	StageFailed    = "failed"
+	StageSkipped   = "skipped"
+	StagePending   = "pending"
+)
+
+const stageMarker = "::planemgr-stage::"
+
+var ErrInvalidPipeline = errors.New("Invalid pipeline definition")
+
+var builtinStages = []string{
+	StageInit,
+	StageValidate,
+	StagePlan,
+	StagePolicy,
+	StageApply,
+	StagePostChecks,
+}
+
+// Step is a custom command run in the runner container, placed before or
+// after another stage. Steps without a placement run at the end.
+type Step struct {
+	Name   string `json:"name"`
+	Run    string `json:"run"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// PipelineConfig is the format of PipelineFile.
+type PipelineConfig struct {
+	Skip           []string `json:"skip,omitempty"`
+	Steps          []Step   `json:"steps,omitempty"`
+	Checks         []Check  `json:"checks,omitempty"`
+	OnCheckFailure string   `json:"onCheckFailure,omitempty"`
+}
+
+type Stage struct {
+	Name  string
+	Run   string // Empty for placeholder stages, which are reported as skipped
+	Skip  bool
+	Check bool // Post-deploy check; failures don't abort the pipeline
+}
+
+// Pipeline is the ordered list of stages a deploy runs after checkout,
+// followed by its post-deploy checks.
+type Pipeline struct {
+	Stages         []Stage
+	Checks         []Check
+	OnCheckFailure string
+}
+
+type StageResult struct {
+	Name        string
+	Status      string
+	ExitCode    int64
+	Output      string
+	Check       bool
+	Diagnostics []Diagnostic
+}
+
+// DefaultPipeline returns the built-in stages with no customization.
+func DefaultPipeline() Pipeline {
+	pipeline, _ := BuildPipeline(PipelineConfig{})
+	return pipeline
+}
+
+// ParsePipeline builds a pipeline from the contents of PipelineFile.
+func ParsePipeline(data []byte) (Pipeline, error) {
+	var config PipelineConfig
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return Pipeline{}, fmt.Errorf("%w: %v", ErrInvalidPipeline, err)
+	}
+
+	return BuildPipeline(config)
+}
+
+// BuildPipeline applies skips and custom steps to the built-in stages.
+func BuildPipeline(config PipelineConfig) (Pipeline, error) {
+	skipped := make(map[string]bool, len(config.Skip))
+	for _, name := range config.Skip {
+		skipped[name] = true
+	}
+
+	stages := make([]Stage, 0, len(builtinStages)+len(config.Steps))
+	for _, name := range builtinStages {
+		stages = append(stages, Stage{Name: name})
+	}
+
+	for _, step := range config.Steps {
+		if !namePattern.MatchString(step.Name) {
+			return Pipeline{}, fmt.Errorf("%w: invalid step name %q", ErrInvalidPipeline, step.Name)
+		}
+		if stageIndex(stages, step.Name) >= 0 {
+			return Pipeline{}, fmt.Errorf("%w: duplicate stage %q", ErrInvalidPipeline, step.Name)
+		}
+		if strings.TrimSpace(step.Run) == "" {
+			return Pipeline{}, fmt.Errorf("%w: step %q has no command", ErrInvalidPipeline, step.Name)
+		}
+		if step.Before != "" && step.After != "" {
+			return Pipeline{}, fmt.Errorf("%w: step %q sets both before and after", ErrInvalidPipeline, step.Name)
+		}
+
+		at := len(stages)
+		if anchor := step.Before + step.After; anchor != "" {
+			index := stageIndex(stages, anchor)
+			if index < 0 {
+				return Pipeline{}, fmt.Errorf("%w: step %q references unknown stage %q", ErrInvalidPipeline, step.Name, anchor)
+			}
+			at = index
+			if step.After != "" {
+				at++
+			}
+		}
+
+		stages = append(stages[:at], append([]Stage{{Name: step.Name, Run: step.Run}}, stages[at:]...)...)
+	}
+
+	for name := range skipped {
+		if stageIndex(stages, name) < 0 {
+			return Pipeline{}, fmt.Errorf("%w: cannot skip unknown stage %q", ErrInvalidPipeline, name)
+		}
+	}
+
+	for i := range stages {
+		stages[i].Skip = skipped[stages[i].Name]
+		if stages[i].Run == "" {
+			stages[i].Run = builtinCommand(stages[i].Name, skipped)
+		}
+	}
+
+	probes := map[string]bool{}
+	for _, check := range config.Checks {
+		if err := validateCheck(check); err != nil {
+			return Pipeline{}, err
+		}
+		if stageIndex(stages, check.Name) >= 0 || probes[check.Name] {
+			return Pipeline{}, fmt.Errorf("%w: duplicate stage %q", ErrInvalidPipeline, check.Name)
+		}
+		if check.HTTP != nil {
+			probes[check.Name] = true
+			continue
+		}
+		stages = append(stages, Stage{Name: check.Name, Run: check.Run, Check: true})
+	}
+
+	onCheckFailure := config.OnCheckFailure
+	switch onCheckFailure {
+	case "":
+		onCheckFailure = CheckFailureFail
+	case CheckFailureFail, CheckFailureDegrade, CheckFailureRollback:
+	default:
+		return Pipeline{}, fmt.Errorf("%w: unknown onCheckFailure %q", ErrInvalidPipeline, onCheckFailure)
+	}
+
+	return Pipeline{
+		Stages:         stages,
+		Checks:         config.Checks,
+		OnCheckFailure: onCheckFailure,
+	}, nil
+}
+
+// withPolicyHook makes the policy stage wait for the verdict of the
+// server-side policies. Policies need a plan, so neither the plan nor the
+// policy stage may be skipped.
+func (p Pipeline) withPolicyHook() (Pipeline, error) {
+	plan := stageIndex(p.Stages, StagePlan)
+	policy := stageIndex(p.Stages, StagePolicy)
+	if plan < 0 || policy < 0 || p.Stages[plan].Skip || p.Stages[policy].Skip {
+		return Pipeline{}, fmt.Errorf("%w: chart policies require the plan and policy stages", ErrInvalidPipeline)
+	}
+
+	p.Stages = slices.Clone(p.Stages)
+	p.Stages[policy].Run = policyStageCommand
+	return p, nil
+}
+
+// WithoutChecks returns the pipeline with its post-deploy checks removed.
+func (p Pipeline) WithoutChecks() Pipeline {
+	stages := make([]Stage, 0, len(p.Stages))
+	for _, stage := range p.Stages {
+		if !stage.Check {
+			stages = append(stages, stage)
+		}
+	}
+	return Pipeline{Stages: stages, OnCheckFailure: p.OnCheckFailure}
+}
+
+// PlanOnly returns the pipeline stopping after the plan: apply and every
+// stage after it are skipped, and there are no post-deploy checks.
+func (p Pipeline) PlanOnly() Pipeline {
+	apply := stageIndex(p.Stages, StageApply)
+	if apply < 0 {
+		apply = len(p.Stages)
+	}
+	stages := make([]Stage, 0, len(p.Stages))
+	for i, stage := range p.Stages {
+		if stage.Check {
+			continue
+		}
+		stage.Skip = stage.Skip || i >= apply
+		stages = append(stages, stage)
+	}
+	return Pipeline{Stages: stages, OnCheckFailure: CheckFailureFail}
+}
+
+// Destroy returns the pipeline tearing the module down: its plan, or its
+// apply when the plan is skipped, destroys every resource in the state.
+// There are no post-deploy checks, as nothing is left to check.
+func (p Pipeline) Destroy() Pipeline {
+	skipped := map[string]bool{}
+	stages := make([]Stage, 0, len(p.Stages))
+	for _, stage := range p.Stages {
+		if stage.Check {
+			continue
+		}
+		skipped[stage.Name] = stage.Skip
+		stages = append(stages, stage)
+	}
+	for i, stage := range stages {
+		if stage.Name == StagePlan || stage.Name == StageApply {
+			stages[i].Run = destroyCommand(stage.Name, skipped)
+		}
+	}
+	return Pipeline{Stages: stages, OnCheckFailure: CheckFailureFail}
+}
+
+func builtinCommand(name string, skipped map[string]bool) string {
+	switch name {
+	case StageInit:
+		return "tofu init -input=false"
+	case StageValidate:
+		return "tofu validate --json"
+	case StagePlan:
+		return "tofu plan -input=false -out=tfplan --json && tofu show -json tfplan > tfplan.json"
+	case StageApply:
+		if skipped[StagePlan] {
+			return "tofu apply -input=false -auto-approve --json"
+		}
+		return "tofu apply -input=false -auto-approve --json tfplan"
+	default:
+		return ""
+	}
+}
+
+// destroyCommand is builtinCommand for pipelines tearing the module down.
+func destroyCommand(name string, skipped map[string]bool) string {
+	switch {
+	case name == StagePlan:
+		return "tofu plan -destroy -input=false -out=tfplan --json && tofu show -json tfplan > tfplan.json"
+	case name == StageApply && skipped[StagePlan]:
+		return "tofu apply -destroy -input=false -auto-approve --json"
+	default:
+		return builtinCommand(name, skipped)
+	}
+}
+
+func stageIndex(stages []Stage, name string) int {
+	for i, stage := range stages {
+		if stage.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// script returns a shell snippet running every active stage in order, plus
+// the environment carrying each stage command. Commands are passed through
+// the environment so they never need shell quoting. Checks run only once
+// every stage succeeded, and their failures don't change the exit code.
+func (p Pipeline) script() (string, []string) {
+	var (
+		calls  []string
+		checks []string
+		env    []string
+	)
+	for i, stage := range p.Stages {
+		if stage.Skip || stage.Run == "" {
+			continue
+		}
+		variable := fmt.Sprintf("PLANEMGR_STAGE_%d", i)
+		env = append(env, variable+"="+stage.Run)
+		call := fmt.Sprintf(`run_stage %s "$%s"`, stage.Name, variable)
+		if stage.Check {
+			checks = append(checks, call+"; ")
+		} else {
+			calls = append(calls, call)
+		}
+	}
+	if len(checks) > 0 {
+		calls = append(calls, "{ "+strings.Join(checks, "")+"true; }")
+	}
+
+	fn := `run_stage() { ` +
+		`echo "` + stageMarker + `start::$1"; ` +
+		`sh -c "$2"; code=$?; ` +
+		`echo "` + stageMarker + `end::$1::$code"; ` +
+		`return $code; }; `
+	if len(calls) == 0 {
+		return fn + "true", env
+	}
+	return fn + strings.Join(calls, " && "), env
+}
+
+// splitStageOutput assigns runner output lines to pipeline stages using the
+// markers written by script, and returns the output with markers removed.
+func (p Pipeline) splitStageOutput(output string) ([]StageResult, string) {
+	results := make([]StageResult, len(p.Stages))
+	for i, stage := range p.Stages {
+		results[i] = StageResult{Name: stage.Name, Status: StagePending, Check: stage.Check}
+		if stage.Skip || stage.Run == "" {
+			results[i].Status = StageSkipped
+		}
+	}
+
+	var (
+		clean   []string
+		current = -1
+		logs    = make([][]string, len(p.Stages))
+	)
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		marker, ok := strings.CutPrefix(line, stageMarker)
+		if !ok {
+			clean = append(clean, line)
+			if current >= 0 {
+				logs[current] = append(logs[current], line)
+			}
+			continue
+		}
+
+		if name, ok := strings.CutPrefix(marker, "start::"); ok {
+			current = stageIndex(p.Stages, name)
+			continue
+		}
+		if rest, ok := strings.CutPrefix(marker, "end::"); ok {
+			name, code, _ := strings.Cut(rest, "::")
+			index := stageIndex(p.Stages, name)
+			if index < 0 {
+				continue
+			}
+			exitCode, _ := strconv.ParseInt(code, 10, 64)
+			results[index].ExitCode = exitCode
+			results[index].Status = StageSucceeded
+			if exitCode != 0 {
+				results[index].Status = StageFailed
+			}
+			current = -1
+		}
+	}
+
+	for i := range results {
+		results[i].Output = strings.TrimSpace(strings.Join(logs[i], "\n"))
+	}
+
+	return results, strings.TrimSpace(strings.Join(clean, "\n"))
+}
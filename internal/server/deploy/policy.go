@@ -0,0 +1,191 @@
+package deploy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/moby/moby/api/pkg/stdcopy"
+	"github.com/moby/moby/client"
+)
+
+const (
+	PolicyPassed     = "passed"
+	PolicyWarned     = "warned"
+	PolicyBlocked    = "blocked"
+	PolicyOverridden = "overridden"
+)
+
+const (
+	policyDir         = "/runner/.policy"
+	policyPlanFile    = policyDir + "/plan.json"
+	policyReportFile  = policyDir + "/report"
+	policyVerdictFile = policyDir + "/verdict"
+)
+
+// policyStageCommand hands the JSON plan to the server and waits for the
+// verdict of the server-side policies.
+const policyStageCommand = `mkdir -p ` + policyDir + ` && cp tfplan.json ` + policyPlanFile + ` && ` +
+	`while [ ! -e ` + policyVerdictFile + ` ]; do sleep 0.2; done; ` +
+	`cat ` + policyReportFile + `; exit "$(cat ` + policyVerdictFile + `)"`
+
+// Policy is evaluated by the server against the plan of a deploy, between
+// the plan and apply stages.
+type Policy struct {
+	Name     string
+	Evaluate func(ctx context.Context, plan Plan) PolicyResult
+	// Mandatory policies block even when named in the overrides.
+	Mandatory bool
+}
+
+type PolicyResult struct {
+	Name    string
+	Outcome string
+	Message string
+}
+
+// Plan is the subset of the `tofu show -json` plan format used by policies.
+type Plan struct {
+	ResourceChanges []ResourceChange `json:"resource_changes"`
+}
+
+type ResourceChange struct {
+	Address string `json:"address"`
+	Mode    string `json:"mode"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Change  struct {
+		Actions []string       `json:"actions"`
+		After   map[string]any `json:"after"`
+	} `json:"change"`
+}
+
+// Remains reports whether the resource exists once the plan is applied.
+func (c ResourceChange) Remains() bool {
+	return c.Mode == "managed" && !slices.Equal(c.Change.Actions, []string{"delete"})
+}
+
+// policyHook evaluates policies once the runner reaches the policy stage.
+type policyHook struct {
+	policies  []Policy
+	overrides []string
+}
+
+// run follows the runner output until the policy stage starts, evaluates the
+// plan and writes the verdict back into the container. It returns nil when
+// the runner never reached the policy stage.
+func (h policyHook) run(ctx context.Context, cli *client.Client, containerID string) ([]PolicyResult, error) {
+	logs, err := cli.ContainerLogs(ctx, containerID, client.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Follow deploy logs: %w", err)
+	}
+	defer logs.Close()
+
+	reached := false
+	scanner := bufio.NewScanner(logs)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if strings.TrimRight(scanner.Text(), "\r") == stageMarker+"start::"+StagePolicy {
+			reached = true
+			break
+		}
+	}
+	if !reached {
+		return nil, nil
+	}
+
+	var results []PolicyResult
+	data, err := execReadFile(ctx, cli, containerID, policyPlanFile)
+	if err == nil {
+		var plan Plan
+		if err = json.Unmarshal(data, &plan); err == nil {
+			results = h.evaluate(ctx, plan)
+		}
+	}
+	if err != nil {
+		results = []PolicyResult{{Name: "plan", Outcome: PolicyBlocked, Message: "Read plan: " + err.Error()}}
+	}
+
+	if err := writeVerdict(ctx, cli, containerID, policyDir, "policy", results); err != nil {
+		return results, err
+	}
+
+	return results, nil
+}
+
+func (h policyHook) evaluate(ctx context.Context, plan Plan) []PolicyResult {
+	results := make([]PolicyResult, 0, len(h.policies))
+	for _, policy := range h.policies {
+		result := policy.Evaluate(ctx, plan)
+		result.Name = policy.Name
+		if result.Outcome == PolicyBlocked && !policy.Mandatory && slices.Contains(h.overrides, policy.Name) {
+			result.Outcome = PolicyOverridden
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// writeVerdict writes the report of results into dir, where a runner stage
+// waits for it, and lets the stage finish. The stage fails when any result
+// blocks.
+func writeVerdict(ctx context.Context, cli *client.Client, containerID, dir, kind string, results []PolicyResult) error {
+	verdict := "0"
+	var report strings.Builder
+	for _, result := range results {
+		if result.Outcome == PolicyBlocked {
+			verdict = "1"
+		}
+		fmt.Fprintf(&report, "%s %s: %s", kind, result.Name, result.Outcome)
+		if result.Message != "" {
+			fmt.Fprintf(&report, ": %s", result.Message)
+		}
+		report.WriteString("\n")
+	}
+
+	if err := execWriteFile(ctx, cli, containerID, dir+"/report", report.String(), 0o600); err != nil {
+		return err
+	}
+	return execWriteFile(ctx, cli, containerID, dir+"/verdict", verdict, 0o600)
+}
+
+func execReadFile(ctx context.Context, cli *client.Client, containerID string, path string) ([]byte, error) {
+	execCreate, err := cli.ExecCreate(ctx, containerID, client.ExecCreateOptions{
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          []string{"cat", path},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Create read exec: %w", err)
+	}
+
+	attach, err := cli.ExecAttach(ctx, execCreate.ID, client.ExecAttachOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Attach read exec: %w", err)
+	}
+	defer attach.Close()
+
+	var stdout bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, io.Discard, attach.Reader); err != nil {
+		return nil, fmt.Errorf("Read %s from container: %w", path, err)
+	}
+
+	inspect, err := cli.ExecInspect(ctx, execCreate.ID, client.ExecInspectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Inspect read exec: %w", err)
+	}
+	if inspect.ExitCode != 0 {
+		return nil, fmt.Errorf("Read %s failed: exit %d", path, inspect.ExitCode)
+	}
+
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,52 @@
+package deploy
+
+import (
+	"cmp"
+	"strconv"
+	"strings"
+)
+
+// Traffic tells the module routing the traffic of a rollout between two
+// environments of a chart which one serves and how much the other gets.
+type Traffic struct {
+	Blue   string `json:"blue"`   // Environment serving before the rollout
+	Green  string `json:"green"`  // Environment the rollout deployed
+	Weight int    `json:"weight"` // Percentage of the traffic sent to green
+}
+
+// contextEnv describes the run to the modules it deploys, so they can tag
+// cloud resources with their provenance. Each value is passed as the tofu
+// variable planemgr_<name>, which modules pick up by declaring it, and as the
+// PLANEMGR_<NAME> environment variable for scripts and checks. The
+// environment is the chart environment deployed to, or the stack for deploys
+// without one; the stack is empty for the root module. Runs routing the
+// traffic of a rollout also get traffic_blue, traffic_green and
+// traffic_weight.
+func (req Request) contextEnv() []string {
+	type contextValue struct{ name, value string }
+	values := []contextValue{
+		{"chart_id", req.ChartID},
+		{"ref", strings.TrimSpace(req.Ref)},
+		{"commit", req.Commit},
+		{"deploy_id", req.DeployID},
+		{"user", req.Subject},
+		{"environment", cmp.Or(req.Environment, req.Stack)},
+		{"stack", req.Stack},
+	}
+	if req.Traffic != nil {
+		values = append(values,
+			contextValue{"traffic_blue", req.Traffic.Blue},
+			contextValue{"traffic_green", req.Traffic.Green},
+			contextValue{"traffic_weight", strconv.Itoa(req.Traffic.Weight)},
+		)
+	}
+
+	env := make([]string, 0, 2*len(values))
+	for _, value := range values {
+		env = append(env,
+			"TF_VAR_planemgr_"+value.name+"="+value.value,
+			"PLANEMGR_"+strings.ToUpper(value.name)+"="+value.value,
+		)
+	}
+	return env
+}
@@ -0,0 +1,107 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/client"
+)
+
+var ErrSandboxNotReady = errors.New("Sandbox emulator did not become ready")
+
+const (
+	defaultSandboxImage = "localstack/localstack:latest"
+	sandboxReadyTimeout = 2 * time.Minute
+)
+
+// Sandbox is a cloud API emulator started next to the runner so a chart can
+// be deployed end-to-end without touching real cloud accounts. Env is added
+// to the runner environment to point the providers at the emulator.
+type Sandbox struct {
+	Image string   `json:"image"`
+	Env   []string `json:"env,omitempty"`
+}
+
+// DefaultSandbox returns the emulator configured by SANDBOX_IMAGE and
+// SANDBOX_ENV, a comma separated list of KEY=VALUE pairs. Without them
+// localstack is started and the AWS provider pointed at it.
+func DefaultSandbox() Sandbox {
+	sandbox := Sandbox{Image: strings.TrimSpace(os.Getenv("SANDBOX_IMAGE"))}
+	for pair := range strings.SplitSeq(os.Getenv("SANDBOX_ENV"), ",") {
+		if pair = strings.TrimSpace(pair); strings.Contains(pair, "=") {
+			sandbox.Env = append(sandbox.Env, pair)
+		}
+	}
+
+	if sandbox.Image == "" {
+		sandbox.Image = defaultSandboxImage
+	}
+	if sandbox.Image == defaultSandboxImage && len(sandbox.Env) == 0 {
+		sandbox.Env = []string{
+			"AWS_ENDPOINT_URL=http://localhost:4566",
+			"AWS_ACCESS_KEY_ID=test",
+			"AWS_SECRET_ACCESS_KEY=test",
+			"AWS_REGION=us-east-1",
+			"AWS_DEFAULT_REGION=us-east-1",
+		}
+	}
+	return sandbox
+}
+
+// startSandbox starts the emulator container and waits until its health
+// check passes. The emulator shares the host network like the runner, so
+// it is reachable on localhost. The returned container must be removed by
+// the caller, even when an error is returned.
+func startSandbox(ctx context.Context, cli *client.Client, sandbox Sandbox) (string, error) {
+	if _, err := cli.ImageInspect(ctx, sandbox.Image); err != nil {
+		pull, err := cli.ImagePull(ctx, sandbox.Image, client.ImagePullOptions{})
+		if err != nil {
+			return "", fmt.Errorf("Pull sandbox image: %w", err)
+		}
+		defer pull.Close()
+		if err := pull.Wait(ctx); err != nil {
+			return "", fmt.Errorf("Pull sandbox image: %w", err)
+		}
+	}
+
+	resp, err := cli.ContainerCreate(ctx, client.ContainerCreateOptions{
+		Config:     &container.Config{Image: sandbox.Image},
+		HostConfig: &container.HostConfig{NetworkMode: "host"},
+	})
+	if err != nil {
+		return "", fmt.Errorf("Create sandbox container: %w", err)
+	}
+	if _, err := cli.ContainerStart(ctx, resp.ID, client.ContainerStartOptions{}); err != nil {
+		return resp.ID, fmt.Errorf("Start sandbox container: %w", err)
+	}
+
+	readyCtx, cancel := context.WithTimeout(ctx, sandboxReadyTimeout)
+	defer cancel()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		inspect, err := cli.ContainerInspect(readyCtx, resp.ID, client.ContainerInspectOptions{})
+		if err != nil {
+			return resp.ID, fmt.Errorf("Inspect sandbox container: %w", err)
+		}
+		state := inspect.Container.State
+		if state == nil || !state.Running {
+			return resp.ID, ErrSandboxNotReady
+		}
+		// Emulators without a health check are used as soon as they run.
+		if state.Health == nil || state.Health.Status == container.Healthy {
+			return resp.ID, nil
+		}
+
+		select {
+		case <-readyCtx.Done():
+			return resp.ID, ErrSandboxNotReady
+		case <-ticker.C:
+		}
+	}
+}
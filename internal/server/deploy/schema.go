@@ -0,0 +1,41 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// StageProviderSchema prints the provider schemas of the module.
+const StageProviderSchema = "schema"
+
+var ErrProviderSchema = errors.New("Provider schema unavailable")
+
+// ProviderSchemas runs `tofu providers schema -json` for the module of req in
+// the runner and returns the schema document. Pipeline and policies of req
+// are ignored, nothing is planned or applied.
+func ProviderSchemas(ctx context.Context, req Request) (json.RawMessage, error) {
+	req.Pipeline = Pipeline{Stages: []Stage{
+		{Name: StageInit, Run: builtinCommand(StageInit, nil)},
+		{Name: StageProviderSchema, Run: "tofu providers schema -json"},
+	}}
+	req.Policies = nil
+	req.OverridePolicies = nil
+
+	result, err := RunDockerDeploy(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stage := range result.Stages {
+		if stage.Name != StageProviderSchema {
+			continue
+		}
+		if stage.Status != StageSucceeded || !json.Valid([]byte(stage.Output)) {
+			return nil, fmt.Errorf("%w: %s", ErrProviderSchema, stage.Output)
+		}
+		return json.RawMessage(stage.Output), nil
+	}
+	return nil, ErrProviderSchema
+}
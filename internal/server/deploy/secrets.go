@@ -0,0 +1,96 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/moby/moby/client"
+)
+
+var ErrInvalidSecretEnv = errors.New("Invalid secret environment variable")
+
+// secretsEnvFile holds the secrets of a deploy as shell exports. It lives in
+// the tmpfs of the SSH keys, so secrets never reach the container config or
+// the host disk.
+const secretsEnvFile = "/runner/.ssh/secrets.env"
+
+// secretMask replaces secret values in the runner output.
+const secretMask = "***"
+
+var secretEnvPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// reservedEnvPrefixes are set by the runner itself and can't be overridden
+// by secrets.
+var reservedEnvPrefixes = []string{"PLANEMGR_", "TF_VAR_PLANEMGR_", "TF_HTTP_", "DEPLOY_", "GIT_"}
+
+// ValidateSecretEnv reports whether name can carry a secret into the runner
+// environment.
+func ValidateSecretEnv(name string) error {
+	if !secretEnvPattern.MatchString(name) {
+		return fmt.Errorf("%w %q", ErrInvalidSecretEnv, name)
+	}
+	upper := strings.ToUpper(name)
+	if slices.ContainsFunc(reservedEnvPrefixes, func(prefix string) bool { return strings.HasPrefix(upper, prefix) }) || upper == "PATH" || upper == "HOME" {
+		return fmt.Errorf("%w %q: reserved by the runner", ErrInvalidSecretEnv, name)
+	}
+	return nil
+}
+
+// secretsScript returns the shell snippet exporting the secrets of req to
+// the stages, or nothing without secrets.
+func (req Request) secretsScript() string {
+	if len(req.Secrets) == 0 {
+		return ""
+	}
+	return "set -a && . " + secretsEnvFile + " && set +a && "
+}
+
+// writeSecretsToContainer hands the secrets of a deploy, keyed by their
+// environment variable, to the runner before it starts cloning.
+func writeSecretsToContainer(ctx context.Context, cli *client.Client, containerID string, secrets map[string]string) error {
+	if len(secrets) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(secrets))
+	for name := range secrets {
+		if err := ValidateSecretEnv(name); err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var env strings.Builder
+	for _, name := range names {
+		env.WriteString(name + "='" + strings.ReplaceAll(secrets[name], "'", `'\''`) + "'\n")
+	}
+	return execWriteFile(ctx, cli, containerID, secretsEnvFile, env.String(), 0o600)
+}
+
+// maskSecrets replaces the secret values, and each line of multi-line
+// values, in output.
+func maskSecrets(output string, secrets map[string]string) string {
+	var values []string
+	for _, value := range secrets {
+		values = append(values, value)
+		if strings.Contains(value, "\n") {
+			values = append(values, strings.Split(value, "\n")...)
+		}
+	}
+	// Longer values first, so no part of one is left when a shorter one
+	// matches inside it.
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			output = strings.ReplaceAll(output, value, secretMask)
+		}
+	}
+	return output
+}
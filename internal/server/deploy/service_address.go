@@ -0,0 +1,133 @@
+package deploy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var ErrInvalidServiceAddress = errors.New("Invalid service address")
+var ErrServiceAddressNotAllowed = errors.New("Service address is neither detected nor configured")
+
+// hostGatewayName resolves to the Docker host inside runner containers. Docker
+// Desktop provides it; on Linux the runner gets it as an extra host pointing
+// at the host gateway.
+const hostGatewayName = "host.docker.internal"
+
+var (
+	detectedServiceAddress     string
+	detectedServiceAddressOnce sync.Once
+)
+
+// ServiceAddress returns the host:port runners reach the server at, from
+// SERVICE_ADDRESS, or detected for the runner backend when it is empty or
+// "auto".
+func ServiceAddress() string {
+	if value := strings.TrimSpace(os.Getenv("SERVICE_ADDRESS")); value != "" && value != "auto" {
+		return value
+	}
+	return detectedAddress()
+}
+
+func detectedAddress() string {
+	detectedServiceAddressOnce.Do(func() {
+		detectedServiceAddress = detectServiceAddress()
+	})
+	return detectedServiceAddress
+}
+
+// AllowedServiceAddresses returns the addresses a deploy may point its
+// runner at instead of ServiceAddress: the detected one and those listed,
+// comma separated, in SERVICE_ADDRESS_ALLOWLIST. Runners get the clone token
+// and state credentials of the deploy, so they must only call this server.
+func AllowedServiceAddresses() []string {
+	addresses := []string{ServiceAddress(), detectedAddress()}
+	for _, value := range strings.Split(os.Getenv("SERVICE_ADDRESS_ALLOWLIST"), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			addresses = append(addresses, value)
+		}
+	}
+	return addresses
+}
+
+// detectServiceAddress guesses a callback address Docker runners can reach.
+// Runners share the network of the Docker host, so a server running there
+// is reached through the host gateway. A server in a container or pod is
+// reached at its own address instead, which the host routes to; runners on
+// the host network can't resolve cluster DNS, so pods are addressed by IP.
+func detectServiceAddress() string {
+	port := strings.TrimSpace(os.Getenv("API_PORT"))
+	if port == "" {
+		port = "4000"
+	}
+
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		if ip := net.ParseIP(strings.TrimSpace(os.Getenv("POD_IP"))); ip != nil {
+			return net.JoinHostPort(ip.String(), port)
+		}
+		if ip := outboundIP(); ip != nil {
+			return net.JoinHostPort(ip.String(), port)
+		}
+	}
+	if inContainer() {
+		if ip := outboundIP(); ip != nil {
+			return net.JoinHostPort(ip.String(), port)
+		}
+	}
+	return net.JoinHostPort(hostGatewayName, port)
+}
+
+func inContainer() bool {
+	for _, marker := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err := os.Stat(marker); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// outboundIP returns the local address of the default route. Dialing UDP
+// sends nothing, it only selects the interface.
+func outboundIP() net.IP {
+	conn, err := net.Dial("udp", "192.0.2.1:9")
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+
+	addr, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok || addr.IP.IsLoopback() {
+		return nil
+	}
+	return addr.IP
+}
+
+// ValidateServiceAddressOverride reports whether a deploy may point its
+// runner at addr.
+func ValidateServiceAddressOverride(addr string) error {
+	if err := ValidateServiceAddress(addr); err != nil {
+		return err
+	}
+	if !slices.Contains(AllowedServiceAddresses(), addr) {
+		return fmt.Errorf("%w: %q", ErrServiceAddressNotAllowed, addr)
+	}
+	return nil
+}
+
+// ValidateServiceAddress reports whether addr is a host:port runners can be
+// pointed at.
+func ValidateServiceAddress(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host == "" || strings.ContainsAny(host, "/@?#") {
+		return fmt.Errorf("%w: %q must be host:port", ErrInvalidServiceAddress, addr)
+	}
+	if number, err := strconv.Atoi(port); err != nil || number < 1 || number > 65535 {
+		return fmt.Errorf("%w: %q must be host:port", ErrInvalidServiceAddress, addr)
+	}
+	return nil
+}
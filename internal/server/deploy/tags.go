@@ -0,0 +1,102 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// TagsPolicyName names the required tags policy in results and overrides.
+const TagsPolicyName = "tags"
+
+var ErrInvalidRequiredTags = errors.New("Invalid required tags")
+
+// tagAttributes are the attributes providers keep resource tags in, checked
+// in order. tags_all includes the provider default tags.
+var tagAttributes = []string{"tags_all", "tags", "labels"}
+
+// RequiredTags lists the tag keys, such as owner or cost-center, that every
+// taggable resource a deploy creates or updates must carry.
+type RequiredTags struct {
+	Tags        []string `json:"tags,omitempty"`
+	Enforcement string   `json:"enforcement,omitempty"`
+}
+
+func (t RequiredTags) Validate() error {
+	for _, tag := range t.Tags {
+		if strings.TrimSpace(tag) == "" {
+			return fmt.Errorf("%w: tags must not be empty", ErrInvalidRequiredTags)
+		}
+	}
+	switch t.Enforcement {
+	case "", EnforceBlock, EnforceWarn:
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown enforcement %q", ErrInvalidRequiredTags, t.Enforcement)
+	}
+}
+
+// Enabled reports whether any tag is required.
+func (t RequiredTags) Enabled() bool {
+	return len(t.Tags) > 0
+}
+
+// RequiredTagsPolicy checks that the resources the plan creates or updates
+// carry the required tags. Resources without a tags or labels attribute
+// can't be tagged and are skipped.
+func RequiredTagsPolicy(t RequiredTags) Policy {
+	return Policy{
+		Name: TagsPolicyName,
+		Evaluate: func(_ context.Context, plan Plan) PolicyResult {
+			var violations []string
+			for _, change := range plan.ResourceChanges {
+				if !change.Remains() || slices.Equal(change.Change.Actions, []string{"no-op"}) {
+					continue
+				}
+				tags, ok := resourceTags(change.Change.After)
+				if !ok {
+					continue
+				}
+
+				var missing []string
+				for _, tag := range t.Tags {
+					if value, ok := tags[tag]; !ok || value == nil || value == "" {
+						missing = append(missing, tag)
+					}
+				}
+				if len(missing) > 0 {
+					violations = append(violations, fmt.Sprintf("%s lacks %s", change.Address, strings.Join(missing, ", ")))
+				}
+			}
+
+			if len(violations) == 0 {
+				return PolicyResult{Outcome: PolicyPassed}
+			}
+
+			outcome := PolicyBlocked
+			if t.Enforcement == EnforceWarn {
+				outcome = PolicyWarned
+			}
+			return PolicyResult{Outcome: outcome, Message: "Missing required tags: " + strings.Join(violations, "; ")}
+		},
+	}
+}
+
+// resourceTags returns the tags of a planned resource, and false when it has
+// no tag attribute.
+func resourceTags(after map[string]any) (map[string]any, bool) {
+	for _, attribute := range tagAttributes {
+		value, ok := after[attribute]
+		if !ok {
+			continue
+		}
+		tags, _ := value.(map[string]any)
+		if tags == nil {
+			tags = map[string]any{}
+		}
+		return tags, true
+	}
+	return nil, false
+}
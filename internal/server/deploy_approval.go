@@ -0,0 +1,439 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/deploy"
+	"github.com/mtolmacs/planemgr/internal/server/user"
+)
+
+// deployStatusAwaitingApproval marks a deploy that planned and waits for
+// POST /api/deploy/{id}/approve before it applies.
+const deployStatusAwaitingApproval = "awaiting_approval"
+
+// deployApprovalGate is the name the approval decision is reported under
+// among the run task results of a deploy.
+const deployApprovalGate = "approval"
+
+const (
+	deployApprovalApproved = "approved"
+	deployApprovalRejected = "rejected"
+)
+
+type deployApprovalRequest struct {
+	Message string `json:"message,omitempty"`
+}
+
+type deployApprovalResponse struct {
+	DeployID  string `json:"deployId"`
+	ChartID   string `json:"chartId"`
+	Ref       string `json:"ref"`
+	Stack     string `json:"stack,omitempty"`
+	Subject   string `json:"subject"` // Who started the deploy
+	Decision  string `json:"decision" enums:"approved,rejected"`
+	DecidedBy string `json:"decidedBy"`
+	// An approved deploy keeps waiting while it still awaits the approval
+	// of the approval rules or the sign-off of the owners of changed paths.
+	AwaitingApproval bool           `json:"awaitingApproval,omitempty"`
+	AwaitingOwners   []ownerSignoff `json:"awaitingOwners,omitempty"`
+}
+
+// pendingDeployApproval is a deploy paused after its plan until a user
+// decides on it. The runner keeps the plan it applies once approved.
+type pendingDeployApproval struct {
+	deployID string
+	chartID  string
+	ref      string
+	stack    string
+	subject  string
+	approval bool // Whether the rules, or the request, ask for an approval
+	rules    []approvalRule
+	owners   []ownerSignoff
+	plan     json.RawMessage
+	decision chan deploy.PolicyResult
+
+	// Guarded by deployApprovals.mu
+	approvedBy string
+	decided    bool
+}
+
+var deployApprovals = struct {
+	mu      sync.Mutex
+	pending map[string]*pendingDeployApproval
+}{
+	pending: map[string]*pendingDeployApproval{},
+}
+
+// chartApprovalGate returns the gate a deploy waits at for its approval,
+// right after the policies passed. Without rules, as for deploys requesting
+// an approval themselves, anyone may approve. Without approval the deploy
+// only waits for the sign-off of the owners.
+func chartApprovalGate(deployReq deploy.Request, approval bool, rules []approvalRule, owners []ownerSignoff) deploy.Gate {
+	return deploy.Gate{
+		After: deploy.StagePolicy,
+		Evaluate: func(ctx context.Context, input deploy.GateInput) []deploy.PolicyResult {
+			return []deploy.PolicyResult{awaitDeployApproval(ctx, deployReq, approval, rules, owners, input.Plan)}
+		},
+	}
+}
+
+// deployApprovalGates adds the approval gate to the gates of a deploy when
+// the chart approval rules or the request ask for one, or when it changes
+// paths the chart owners file assigns to others. Sandbox deploys only wait
+// when requested. It writes the error and returns false when the deploy
+// can't wait for an approval.
+func deployApprovalGates(w http.ResponseWriter, deployReq deploy.Request, gates []deploy.Gate, opts deployOptions) ([]deploy.Gate, bool) {
+	var rules []approvalRule
+	var owners []ownerSignoff
+	if !opts.Sandbox {
+		permissions, err := loadChartPermissions(deployReq.ChartID)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "policy_load_failed", Message: err.Error()})
+			return nil, false
+		}
+		rules = permissions.approvalRules(deployReq.Environment, deployReq.Stack)
+		var ok bool
+		if owners, ok = deployOwnerSignoffs(w, deployReq, permissions); !ok {
+			return nil, false
+		}
+	}
+	approval := len(rules) > 0 || opts.RequireApproval
+	if !approval && len(owners) == 0 {
+		return gates, true
+	}
+
+	planned := slices.ContainsFunc(deployReq.Pipeline.Stages, func(stage deploy.Stage) bool {
+		return stage.Name == deploy.StagePlan && !stage.Skip
+	})
+	if !planned {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_pipeline", Message: "deploys awaiting approval require the plan stage"})
+		return nil, false
+	}
+	return withApprovalGate(gates, chartApprovalGate(deployReq, approval, rules, owners)), true
+}
+
+// withApprovalGate adds the approval gate to the gates of a deploy. Run
+// tasks following the same stage run first, and the approval is only asked
+// for once none of them blocked.
+func withApprovalGate(gates []deploy.Gate, approval deploy.Gate) []deploy.Gate {
+	index := slices.IndexFunc(gates, func(gate deploy.Gate) bool { return gate.After == approval.After })
+	if index < 0 {
+		return append(gates, approval)
+	}
+
+	gates = slices.Clone(gates)
+	runTasks := gates[index]
+	gates[index] = deploy.Gate{
+		After: approval.After,
+		Evaluate: func(ctx context.Context, input deploy.GateInput) []deploy.PolicyResult {
+			results := runTasks.Evaluate(ctx, input)
+			if slices.ContainsFunc(results, func(result deploy.PolicyResult) bool { return result.Outcome == deploy.PolicyBlocked }) {
+				return results
+			}
+			return append(results, approval.Evaluate(ctx, input)...)
+		},
+	}
+	return gates
+}
+
+// awaitDeployApproval registers the planned deploy as awaiting approval and
+// blocks until it is approved, rejected or ctx is done.
+func awaitDeployApproval(ctx context.Context, deployReq deploy.Request, approval bool, rules []approvalRule, owners []ownerSignoff, plan json.RawMessage) deploy.PolicyResult {
+	pending := &pendingDeployApproval{
+		deployID: deployReq.DeployID,
+		chartID:  deployReq.ChartID,
+		ref:      deployReq.Ref,
+		stack:    deployReq.Stack,
+		subject:  deployReq.Subject,
+		approval: approval,
+		rules:    rules,
+		owners:   slices.Clone(owners),
+		plan:     plan,
+		decision: make(chan deploy.PolicyResult, 1),
+	}
+	deployApprovals.mu.Lock()
+	deployApprovals.pending[pending.deployID] = pending
+	deployApprovals.mu.Unlock()
+	defer func() {
+		deployApprovals.mu.Lock()
+		delete(deployApprovals.pending, pending.deployID)
+		deployApprovals.mu.Unlock()
+	}()
+	notifyDeployApprovers(pending)
+
+	select {
+	case result := <-pending.decision:
+		return result
+	case <-ctx.Done():
+		return deploy.PolicyResult{Name: deployApprovalGate, Outcome: deploy.PolicyBlocked, Message: "Not approved: " + ctx.Err().Error()}
+	}
+}
+
+// notifyDeployApprovers puts the deploy into the inbox of the user who
+// started it, of the approvers named by the rules and of the owners who have
+// to sign off.
+func notifyDeployApprovers(pending *pendingDeployApproval) {
+	target := "chart " + pending.chartID
+	if pending.stack != "" {
+		target += " stack " + pending.stack
+	}
+	recipients := []string{pending.subject}
+	for _, rule := range pending.rules {
+		for _, approver := range rule.Approvers {
+			if !slices.Contains(recipients, approver) {
+				recipients = append(recipients, approver)
+			}
+		}
+	}
+	for _, signoff := range pending.owners {
+		for _, owner := range signoff.Owners {
+			if !slices.Contains(recipients, owner) {
+				recipients = append(recipients, owner)
+			}
+		}
+	}
+
+	for _, recipient := range recipients {
+		if err := user.NotifyUser(recipient, user.Notification{
+			Event:   user.EventDeployAwaitingApproval,
+			Message: fmt.Sprintf("Deploy %s of %s at %s by %s awaits approval", pending.deployID, target, pending.ref, pending.subject),
+			ChartID: pending.chartID,
+			Ref:     pending.ref,
+		}); err != nil {
+			log.Printf("Approval notification for %s failed: %v", recipient, err)
+			continue
+		}
+		publishChange(watchTopicEvents + recipient)
+	}
+}
+
+// canApprove reports whether subject may give the approval the deploy waits
+// for. Every rule applying to it has to allow them.
+func (p *pendingDeployApproval) canApprove(subject string) bool {
+	if !p.approval {
+		return false
+	}
+	for _, rule := range p.rules {
+		if rule.SeparateApprover && subject == p.subject {
+			return false
+		}
+		if len(rule.Approvers) > 0 && !slices.Contains(rule.Approvers, subject) {
+			return false
+		}
+	}
+	return true
+}
+
+// canDecide reports whether subject may decide on the deploy: they can
+// approve it or own changed paths that weren't signed off yet. Callers hold
+// deployApprovals.mu.
+func (p *pendingDeployApproval) canDecide(subject string) bool {
+	if p.approvedBy == "" && p.canApprove(subject) {
+		return true
+	}
+	return slices.ContainsFunc(p.owners, func(signoff ownerSignoff) bool {
+		return signoff.SignedOffBy == "" && slices.Contains(signoff.Owners, subject)
+	})
+}
+
+// isOwner reports whether subject owns paths the deploy changes.
+func (p *pendingDeployApproval) isOwner(subject string) bool {
+	return slices.ContainsFunc(p.owners, func(signoff ownerSignoff) bool { return slices.Contains(signoff.Owners, subject) })
+}
+
+// awaitingOwners returns the sign-offs the deploy still waits for. Callers
+// hold deployApprovals.mu.
+func (p *pendingDeployApproval) awaitingOwners() []ownerSignoff {
+	return slices.DeleteFunc(slices.Clone(p.owners), func(signoff ownerSignoff) bool { return signoff.SignedOffBy != "" })
+}
+
+// isDeployAwaitingApproval reports whether the deploy is paused for an
+// approval.
+func isDeployAwaitingApproval(deployID string) bool {
+	deployApprovals.mu.Lock()
+	defer deployApprovals.mu.Unlock()
+	_, ok := deployApprovals.pending[deployID]
+	return ok
+}
+
+// HandleDeployApprove handles /api/deploy/{id}/approve requests.
+// @Summary Approve a deploy
+// @Description Lets a deploy awaiting approval apply the plan it made. The chart approval rules of the deployed stack decide who may approve; deploys that requested an approval themselves can be approved by anyone. Deploys changing paths the OWNERS file of the chart assigns to others also need one of the owners of each set of paths listed in awaitingOwners to approve, signing them off; an approval leaves the deploy waiting until every sign-off is in. The decision is reported among the runTasks of the deploy result as "approval".
+// @Tags deploy
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Deploy ID"
+// @Param request body deployApprovalRequest false "Approval"
+// @Success 200 {object} deployApprovalResponse
+// @Failure 400 {object} errorResponse "`invalid_request`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`approval_not_found`"
+// @Failure 409 {object} errorResponse "`approval_decided`"
+// @Router /deploy/{id}/approve [post]
+func HandleDeployApprove(w http.ResponseWriter, r *http.Request) {
+	decideDeployApproval(w, r, deployApprovalApproved)
+}
+
+// HandleDeployReject handles /api/deploy/{id}/reject requests.
+// @Summary Reject a deploy
+// @Description Fails a deploy awaiting approval without applying its plan. Users who may approve the deploy may reject it, as may the owners of changed paths who didn't sign them off yet.
+// @Tags deploy
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Deploy ID"
+// @Param request body deployApprovalRequest false "Rejection"
+// @Success 200 {object} deployApprovalResponse
+// @Failure 400 {object} errorResponse "`invalid_request`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`approval_not_found`"
+// @Failure 409 {object} errorResponse "`approval_decided`"
+// @Router /deploy/{id}/reject [post]
+func HandleDeployReject(w http.ResponseWriter, r *http.Request) {
+	decideDeployApproval(w, r, deployApprovalRejected)
+}
+
+func decideDeployApproval(w http.ResponseWriter, r *http.Request, decision string) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+		return
+	}
+
+	var req deployApprovalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "Invalid JSON payload"})
+		return
+	}
+
+	pending, ok := loadDeployApproval(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	deployApprovals.mu.Lock()
+	defer deployApprovals.mu.Unlock()
+	if pending.decided {
+		writeJSON(w, http.StatusConflict, errorResponse{Error: "approval_decided", Message: "the deploy was already decided on"})
+		return
+	}
+	if !pending.canDecide(claims.Subject) {
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: "forbidden", Message: "you may not decide on this deploy"})
+		return
+	}
+
+	result := deploy.PolicyResult{Name: deployApprovalGate, Outcome: deploy.PolicyBlocked, Message: "Rejected by " + claims.Subject}
+	if decision == deployApprovalApproved {
+		if pending.approvedBy == "" && pending.canApprove(claims.Subject) {
+			pending.approvedBy = claims.Subject
+		}
+		var signedOff []string
+		for i := range pending.owners {
+			signoff := &pending.owners[i]
+			if signoff.SignedOffBy == "" && slices.Contains(signoff.Owners, claims.Subject) {
+				signoff.SignedOffBy = claims.Subject
+			}
+			if !slices.Contains(signedOff, signoff.SignedOffBy) {
+				signedOff = append(signedOff, signoff.SignedOffBy)
+			}
+		}
+		result.Outcome = deploy.PolicyPassed
+		result.Message = "Approved by " + pending.approvedBy
+		if !pending.approval {
+			result.Message = "Signed off by " + strings.Join(signedOff, ", ")
+		} else if len(signedOff) > 0 {
+			result.Message += ", signed off by " + strings.Join(signedOff, ", ")
+		}
+	}
+	if req.Message != "" {
+		result.Message += ": " + req.Message
+	}
+
+	response := deployApprovalResponse{
+		DeployID:         pending.deployID,
+		ChartID:          pending.chartID,
+		Ref:              pending.ref,
+		Stack:            pending.stack,
+		Subject:          pending.subject,
+		Decision:         decision,
+		DecidedBy:        claims.Subject,
+		AwaitingApproval: pending.approval && pending.approvedBy == "",
+		AwaitingOwners:   pending.awaitingOwners(),
+	}
+	if decision == deployApprovalRejected || !response.AwaitingApproval && len(response.AwaitingOwners) == 0 {
+		pending.decided = true
+		pending.decision <- result
+		response.AwaitingApproval, response.AwaitingOwners = false, nil
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// HandleDeployPlan handles /api/deploy/{id}/plan requests.
+// @Summary Get the plan of a deploy awaiting approval
+// @Description Returns the plan, as printed by `tofu show -json`, a deploy awaiting approval applies once approved. The user who started the deploy, the users who may approve it and the owners of the paths it changes can read it.
+// @Tags deploy
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Deploy ID"
+// @Success 200 {object} object
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`approval_not_found`, `plan_not_found`"
+// @Router /deploy/{id}/plan [get]
+func HandleDeployPlan(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+		return
+	}
+
+	pending, ok := loadDeployApproval(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	if claims.Subject != pending.subject && !pending.canApprove(claims.Subject) && !pending.isOwner(claims.Subject) {
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: "forbidden"})
+		return
+	}
+	if len(pending.plan) == 0 {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "plan_not_found", Message: "the deploy made no plan"})
+		return
+	}
+	writeJSON(w, http.StatusOK, pending.plan)
+}
+
+// loadDeployApproval returns the approval a deploy waits for, writing the
+// error when there is none.
+func loadDeployApproval(w http.ResponseWriter, deployID string) (*pendingDeployApproval, bool) {
+	deployApprovals.mu.Lock()
+	pending, ok := deployApprovals.pending[deployID]
+	deployApprovals.mu.Unlock()
+	if !ok {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "approval_not_found", Message: "the deploy isn't awaiting approval"})
+		return nil, false
+	}
+	return pending, true
+}
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/deploy"
+)
+
+// deployJobRetention is how long the result of a finished deploy can be
+// fetched by its ID.
+const deployJobRetention = 24 * time.Hour
+
+// deployStatusRunning marks a deploy that has started and not finished yet.
+const deployStatusRunning = "running"
+
+// deployStatusQueued marks a deploy waiting for an earlier deploy of its
+// stack, or for a runner slot.
+const deployStatusQueued = "queued"
+
+// deployCancelWait bounds how long canceling a deploy waits for its runner
+// to be removed before answering.
+const deployCancelWait = 30 * time.Second
+
+type deployJobResponse struct {
+	DeployID      string          `json:"deployId"`
+	ChartID       string          `json:"chartId"`
+	Ref           string          `json:"ref"`
+	Stack         string          `json:"stack,omitempty"`
+	Environment   string          `json:"environment,omitempty"`
+	Status        string          `json:"status" example:"running"` // queued, running, awaiting_approval, then the status of the result, failed, timed_out or canceled
+	QueuePosition int             `json:"queuePosition,omitempty"`  // Of queued deploys, 1 for the next to start
+	StartedAt     string          `json:"startedAt" example:"2026-01-02T15:04:05Z"`
+	FinishedAt    string          `json:"finishedAt,omitempty" example:"2026-01-02T15:09:05Z"`
+	Result        *deployResponse `json:"result,omitempty"`
+	Error         *errorResponse  `json:"error,omitempty"` // Why the deploy failed without a result
+	Steps         []string        `json:"steps,omitempty"` // Deploy IDs of the steps a rollout started so far
+}
+
+// deployJob is a deploy running in the background, and its outcome once it
+// finished. Jobs are kept in memory, so they don't survive a restart.
+type deployJob struct {
+	id          string
+	subject     string
+	chartID     string
+	ref         string
+	stack       string
+	environment string
+	startedAt   time.Time
+	ticket      *deployTicket
+	cancel      context.CancelFunc
+	done        chan struct{} // Closed once finished
+
+	mu         sync.Mutex
+	finishedAt time.Time
+	outcome    *deployOutcome
+	steps      []string
+}
+
+var deployJobs = struct {
+	mu   sync.Mutex
+	jobs map[string]*deployJob
+}{
+	jobs: map[string]*deployJob{},
+}
+
+// startDeployJob registers the deploy of req, queued with ticket, which
+// cancel stops, dropping the finished jobs past their retention.
+func startDeployJob(req deploy.Request, ticket *deployTicket, cancel context.CancelFunc) *deployJob {
+	job := &deployJob{
+		id:          req.DeployID,
+		subject:     req.Subject,
+		chartID:     req.ChartID,
+		ref:         req.Ref,
+		stack:       req.Stack,
+		environment: req.Environment,
+		startedAt:   time.Now(),
+		ticket:      ticket,
+		cancel:      cancel,
+		done:        make(chan struct{}),
+	}
+
+	deployJobs.mu.Lock()
+	defer deployJobs.mu.Unlock()
+	for id, existing := range deployJobs.jobs {
+		if existing.expired(job.startedAt) {
+			delete(deployJobs.jobs, id)
+		}
+	}
+	deployJobs.jobs[job.id] = job
+	return job
+}
+
+func (j *deployJob) finish(outcome deployOutcome) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.finishedAt = time.Now()
+	j.outcome = &outcome
+	close(j.done)
+}
+
+// addStep lists the deploy of a step the rollout of the job started.
+func (j *deployJob) addStep(deployID string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.steps = append(j.steps, deployID)
+}
+
+func (j *deployJob) expired(now time.Time) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.outcome != nil && now.Sub(j.finishedAt) > deployJobRetention
+}
+
+func (j *deployJob) snapshot() deployJobResponse {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	response := deployJobResponse{
+		DeployID:    j.id,
+		ChartID:     j.chartID,
+		Ref:         j.ref,
+		Stack:       j.stack,
+		Environment: j.environment,
+		Status:      deployStatusRunning,
+		StartedAt:   j.startedAt.UTC().Format(time.RFC3339),
+		Steps:       slices.Clone(j.steps),
+	}
+	if j.outcome == nil {
+		if position := j.ticket.position(); position > 0 {
+			response.Status = deployStatusQueued
+			response.QueuePosition = position
+		} else if isDeployAwaitingApproval(j.id) {
+			response.Status = deployStatusAwaitingApproval
+		}
+		return response
+	}
+	response.FinishedAt = j.finishedAt.UTC().Format(time.RFC3339)
+	if j.outcome.deployStatus != "" {
+		response.Status = j.outcome.deployStatus
+		response.Error = j.outcome.err
+		return response
+	}
+	if j.outcome.err != nil {
+		response.Status = deploy.StatusFailed
+		response.Error = j.outcome.err
+		return response
+	}
+	result := j.outcome.response
+	response.Status = result.Status
+	response.Result = &result
+	return response
+}
+
+// HandleDeployJob handles /api/deploy/{id} requests.
+func HandleDeployJob(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		HandleDeployJobGet(w, r, claims.Subject)
+	case http.MethodDelete:
+		HandleDeployJobCancel(w, r, claims.Subject)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+	}
+}
+
+// HandleDeployJobGet handles GET /api/deploy/{id} requests.
+// @Summary Get deploy status
+// @Description Returns the status of a deploy started by the user, queued with its position until it starts, running until it finishes, then the result or the error it failed with. Results are kept for 24 hours after the deploy finished and are lost when the server restarts.
+// @Tags deploy
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Deploy ID"
+// @Success 200 {object} deployJobResponse
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`deploy_not_found`"
+// @Router /deploy/{id} [get]
+func HandleDeployJobGet(w http.ResponseWriter, r *http.Request, subject string) {
+	job, ok := loadDeployJob(r.PathValue("id"), subject)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "deploy_not_found"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, job.snapshot())
+}
+
+// HandleDeployJobCancel handles DELETE /api/deploy/{id} requests.
+// @Summary Cancel a deploy
+// @Description Cancels a queued or running deploy of the user: queued deploys leave the queue, running ones have their runner container stopped and removed, and the deploy is recorded as canceled. Resources tofu already changed stay changed. Deploys already claimed by an agent keep running on the agent; only queued ones are withdrawn. Answers once the runner was removed, or with 202 while it is still stopping after 30 seconds.
+// @Tags deploy
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Deploy ID"
+// @Success 200 {object} deployJobResponse
+// @Success 202 {object} deployJobResponse
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`deploy_not_found`"
+// @Failure 409 {object} errorResponse "`deploy_finished`"
+// @Router /deploy/{id} [delete]
+func HandleDeployJobCancel(w http.ResponseWriter, r *http.Request, subject string) {
+	job, ok := loadDeployJob(r.PathValue("id"), subject)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "deploy_not_found"})
+		return
+	}
+	select {
+	case <-job.done:
+		writeJSON(w, http.StatusConflict, errorResponse{Error: "deploy_finished", Message: "the deploy already finished"})
+		return
+	default:
+	}
+
+	job.cancel()
+	timer := time.NewTimer(deployCancelWait)
+	defer timer.Stop()
+	select {
+	case <-job.done:
+		writeJSON(w, http.StatusOK, job.snapshot())
+	case <-timer.C:
+		writeJSON(w, http.StatusAccepted, job.snapshot())
+	case <-r.Context().Done():
+	}
+}
+
+// loadDeployJob returns a deploy subject started. Results carry the runner
+// output, so other users never see them.
+func loadDeployJob(deployID, subject string) (*deployJob, bool) {
+	deployJobs.mu.Lock()
+	job, ok := deployJobs.jobs[deployID]
+	deployJobs.mu.Unlock()
+	if !ok || job.subject != subject || job.expired(time.Now()) {
+		return nil, false
+	}
+	return job, true
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+	"github.com/mtolmacs/planemgr/internal/server/deploy"
+)
+
+// ownersAdmins names the chart admins among the owners of a path.
+const ownersAdmins = "@admins"
+
+// ownerSignoff is a set of paths a deploy changes with the same owners, one
+// of whom has to sign off before the deploy applies.
+type ownerSignoff struct {
+	Paths       []string `json:"paths" example:"modules/network/main.tf"`
+	Owners      []string `json:"owners" example:"alice"`
+	SignedOffBy string   `json:"signedOffBy,omitempty"`
+}
+
+// deployOwnerSignoffs returns the sign-offs a deploy needs from the owners of
+// the paths it changes since the last deploy of its module to its
+// environment, or of every path when it was never deployed. The owners file
+// is read at the chart HEAD, so a deploy can't drop the owners of its own
+// changes. Paths the deploying user owns need no sign-off. It writes the
+// error and returns false when the owners can't be determined.
+func deployOwnerSignoffs(w http.ResponseWriter, deployReq deploy.Request, permissions chartPermissions) ([]ownerSignoff, bool) {
+	head, err := chart.ReadChartHead(deployReq.ChartID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "owners_load_failed", Message: err.Error()})
+		return nil, false
+	}
+	owners, err := chart.ReadChartOwners(deployReq.ChartID, head.Ref)
+	if errors.Is(err, chart.ErrInvalidOwners) {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_owners", Message: err.Error()})
+		return nil, false
+	} else if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "owners_load_failed", Message: err.Error()})
+		return nil, false
+	}
+	if len(owners) == 0 {
+		return nil, true
+	}
+
+	paths, err := deployChangedPaths(deployReq)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "owners_load_failed", Message: err.Error()})
+		return nil, false
+	}
+
+	var signoffs []ownerSignoff
+	for _, name := range paths {
+		var pathOwners []string
+		for _, owner := range owners.Owners(name) {
+			if owner == ownersAdmins {
+				pathOwners = append(pathOwners, permissions.Admins...)
+			} else {
+				pathOwners = append(pathOwners, owner)
+			}
+		}
+		slices.Sort(pathOwners)
+		pathOwners = slices.Compact(pathOwners)
+		if len(pathOwners) == 0 || slices.Contains(pathOwners, deployReq.Subject) {
+			continue
+		}
+
+		i := slices.IndexFunc(signoffs, func(signoff ownerSignoff) bool { return slices.Equal(signoff.Owners, pathOwners) })
+		if i < 0 {
+			signoffs = append(signoffs, ownerSignoff{Owners: pathOwners})
+			i = len(signoffs) - 1
+		}
+		signoffs[i].Paths = append(signoffs[i].Paths, name)
+	}
+	return signoffs, true
+}
+
+// deployChangedPaths returns the paths a deploy changes since the last
+// successful deploy of its module to its environment, with both paths of
+// renamed files.
+func deployChangedPaths(deployReq deploy.Request) ([]string, error) {
+	deployments, err := loadChartDeployments(deployReq.ChartID)
+	if err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(deployments, func(d chartDeployment) bool {
+		return d.Environment == deployReq.Environment && d.Stack == deployReq.Stack && d.Commit != ""
+	})
+	if i < 0 {
+		_, paths, err := chart.ListChartTree(deployReq.ChartID, deployReq.Commit)
+		return paths, err
+	}
+
+	_, _, diffs, err := chart.DiffChartRefs(deployReq.ChartID, deployments[i].Commit, deployReq.Commit)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, diff := range diffs {
+		paths = append(paths, diff.Path)
+		if diff.OldPath != "" {
+			paths = append(paths, diff.OldPath)
+		}
+	}
+	slices.Sort(paths)
+	return slices.Compact(paths), nil
+}
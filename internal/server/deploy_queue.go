@@ -0,0 +1,201 @@
+package server
+
+import (
+	"context"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// deployTicket is the place of a deploy in the deploy queue. It waits for
+// the earlier deploys of its chart stack, then, when it runs on the server,
+// for a free runner slot.
+type deployTicket struct {
+	key   string
+	local bool
+	ready chan struct{} // Closed once the deploy may start
+
+	// Guarded by deployQueue.mu.
+	slot bool
+	left bool
+}
+
+// deployQueue runs the deploys of each chart stack one at a time, in the
+// order they were requested, and holds the runner containers of all charts
+// to MAX_CONCURRENT_DEPLOYS.
+var deployQueue = struct {
+	mu       sync.Mutex
+	stacks   map[string][]*deployTicket // The first ticket of a stack holds its lock
+	deleting map[string]struct{}
+	runners  int
+	waiting  []*deployTicket // For a runner slot, in order
+}{
+	stacks:   map[string][]*deployTicket{},
+	deleting: map[string]struct{}{},
+}
+
+var (
+	maxConcurrentDeploysValue int
+	maxConcurrentDeploysOnce  sync.Once
+)
+
+// maxConcurrentDeploys reads MAX_CONCURRENT_DEPLOYS, the number of runner
+// containers deploys may run on the server at once. 0, the default, sets no
+// cap. Deploys on agents are capped by the agents instead.
+func maxConcurrentDeploys() int {
+	maxConcurrentDeploysOnce.Do(func() {
+		value := strings.TrimSpace(os.Getenv("MAX_CONCURRENT_DEPLOYS"))
+		if value == "" {
+			return
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			log.Printf("Ignoring invalid MAX_CONCURRENT_DEPLOYS %q", value)
+			return
+		}
+		maxConcurrentDeploysValue = parsed
+	})
+	return maxConcurrentDeploysValue
+}
+
+// enqueueDeploy queues a deploy of a chart stack in an environment, run on
+// the server when local is set. It fails while the chart is being deleted or
+// squashed.
+func enqueueDeploy(chartID, environment, stack string, local bool) (*deployTicket, bool) {
+	deployQueue.mu.Lock()
+	defer deployQueue.mu.Unlock()
+	if _, deleting := deployQueue.deleting[chartID]; deleting {
+		return nil, false
+	}
+
+	ticket := &deployTicket{key: deployLockKey(chartID, environment, stack), local: local, ready: make(chan struct{})}
+	deployQueue.stacks[ticket.key] = append(deployQueue.stacks[ticket.key], ticket)
+	if len(deployQueue.stacks[ticket.key]) == 1 {
+		admitDeployLocked(ticket)
+	}
+	return ticket, true
+}
+
+// admitDeployLocked starts the deploy of ticket, which holds the lock of its
+// stack, or queues it for a runner slot when all are taken.
+func admitDeployLocked(ticket *deployTicket) {
+	if !ticket.local {
+		close(ticket.ready)
+		return
+	}
+	if limit := maxConcurrentDeploys(); limit > 0 && deployQueue.runners >= limit {
+		deployQueue.waiting = append(deployQueue.waiting, ticket)
+		return
+	}
+	deployQueue.runners++
+	ticket.slot = true
+	close(ticket.ready)
+}
+
+// wait blocks until the deploy may start or ctx is done.
+func (t *deployTicket) wait(ctx context.Context) error {
+	select {
+	case <-t.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// leave removes the deploy from the queue, passing its stack lock and its
+// runner slot on to the next deploys waiting for them.
+func (t *deployTicket) leave() {
+	deployQueue.mu.Lock()
+	defer deployQueue.mu.Unlock()
+	if t.left {
+		return
+	}
+	t.left = true
+
+	if t.slot {
+		t.slot = false
+		deployQueue.runners--
+		for len(deployQueue.waiting) > 0 {
+			limit := maxConcurrentDeploys()
+			if limit > 0 && deployQueue.runners >= limit {
+				break
+			}
+			next := deployQueue.waiting[0]
+			deployQueue.waiting = deployQueue.waiting[1:]
+			deployQueue.runners++
+			next.slot = true
+			close(next.ready)
+		}
+	} else if i := slices.Index(deployQueue.waiting, t); i >= 0 {
+		deployQueue.waiting = slices.Delete(deployQueue.waiting, i, i+1)
+	}
+
+	tickets := deployQueue.stacks[t.key]
+	i := slices.Index(tickets, t)
+	if i < 0 {
+		return
+	}
+	tickets = slices.Delete(tickets, i, i+1)
+	if len(tickets) == 0 {
+		delete(deployQueue.stacks, t.key)
+		return
+	}
+	deployQueue.stacks[t.key] = tickets
+	if i == 0 {
+		admitDeployLocked(tickets[0])
+	}
+}
+
+// position returns the place of a waiting deploy in the queue, 1 for the
+// next to start, and 0 once it started.
+func (t *deployTicket) position() int {
+	deployQueue.mu.Lock()
+	defer deployQueue.mu.Unlock()
+	if i := slices.Index(deployQueue.stacks[t.key], t); i > 0 {
+		return i
+	}
+	if i := slices.Index(deployQueue.waiting, t); i >= 0 {
+		return i + 1
+	}
+	return 0
+}
+
+// deployLockKey scopes deploy locks to a chart stack in an environment so
+// independent stacks and environments of one chart can deploy concurrently.
+func deployLockKey(chartID, environment, stack string) string {
+	key := chartID
+	if environment != "" {
+		key += "@" + environment
+	}
+	if stack != "" {
+		key += "/" + stack
+	}
+	return key
+}
+
+// tryAcquireChartDeleteLock fails while any stack of the chart is deploying
+// or has deploys queued, and otherwise blocks new deploys of the chart until
+// released.
+func tryAcquireChartDeleteLock(chartID string) bool {
+	deployQueue.mu.Lock()
+	defer deployQueue.mu.Unlock()
+	if _, deleting := deployQueue.deleting[chartID]; deleting {
+		return false
+	}
+	for key := range deployQueue.stacks {
+		if key == chartID || strings.HasPrefix(key, chartID+"/") || strings.HasPrefix(key, chartID+"@") {
+			return false
+		}
+	}
+	deployQueue.deleting[chartID] = struct{}{}
+	return true
+}
+
+func releaseChartDeleteLock(chartID string) {
+	deployQueue.mu.Lock()
+	defer deployQueue.mu.Unlock()
+	delete(deployQueue.deleting, chartID)
+}
@@ -0,0 +1,377 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+	"github.com/mtolmacs/planemgr/internal/server/deploy"
+)
+
+const (
+	deployStrategyBlueGreen = "blue-green"
+	deployStrategyCanary    = "canary"
+)
+
+// Actions of the steps of a rollout.
+const (
+	rolloutStepDeploy       = "deploy"
+	rolloutStepSwitch       = "switch"
+	rolloutStepRestore      = "restore"
+	rolloutStepDecommission = "decommission"
+)
+
+const chartRolloutsMeta = "rollouts"
+
+var chartRolloutsMu sync.Mutex
+
+// deployStrategy rolls a module out to the idle one of a pair of chart
+// environments, green, moves the traffic over from the live one, blue, by
+// deploying the module routing it, then destroys blue.
+type deployStrategy struct {
+	Type         string   `json:"type" enums:"blue-green,canary" example:"blue-green"`
+	Environments []string `json:"environments" example:"prod-blue,prod-green"` // The pair the module alternates between
+	// Switch is the module routing the traffic, deployed with the
+	// planemgr_traffic_blue, planemgr_traffic_green and
+	// planemgr_traffic_weight variables.
+	Switch   deploySwitch `json:"switch"`
+	Weights  []int        `json:"weights,omitempty" example:"10,50"` // Canary percentages of the traffic sent to green before all of it
+	KeepBlue bool         `json:"keepBlue,omitempty"`                // Leave blue deployed instead of destroying it
+}
+
+type deploySwitch struct {
+	Stack       string `json:"stack,omitempty" example:"router"` // The root module when empty
+	Environment string `json:"environment,omitempty" example:"prod"`
+}
+
+type deployStrategyResponse struct {
+	Type  string               `json:"type" example:"blue-green"`
+	Blue  string               `json:"blue" example:"prod-blue"`
+	Green string               `json:"green" example:"prod-green"`
+	Live  string               `json:"live,omitempty" example:"prod-green"` // Serving the traffic once the rollout ended, unknown when restoring it failed
+	Steps []deployStrategyStep `json:"steps"`
+}
+
+type deployStrategyStep struct {
+	Action   string         `json:"action" enums:"deploy,switch,restore,decommission"`
+	DeployID string         `json:"deployId"`         // Its result is at GET /api/deploy/{id}
+	Weight   int            `json:"weight,omitempty"` // Percentage of the traffic a switch sends to green
+	Status   string         `json:"status"`
+	Error    *errorResponse `json:"error,omitempty"`
+}
+
+// chartRollout is the environment serving the traffic of a module rolled
+// out between a pair of environments.
+type chartRollout struct {
+	Stack       string `json:"stack,omitempty"`
+	Live        string `json:"live"`
+	RolledOutAt string `json:"rolledOutAt"`
+}
+
+// rolloutStep is a prepared deploy run by a rollout.
+type rolloutStep struct {
+	req      deploy.Request
+	pipeline deploy.Pipeline
+	opts     deployOptions
+}
+
+// deployRollout is a prepared rollout: the deploy of green, the switches
+// moving the traffic to it, the switch restoring it to blue when one of
+// them fails, and the destroy of blue when it is decommissioned.
+type deployRollout struct {
+	strategy     deployStrategy
+	blue         string
+	green        string
+	deploy       rolloutStep
+	switches     []rolloutStep
+	restore      rolloutStep
+	decommission *rolloutStep
+}
+
+// validate checks the strategy of a rollout of stack.
+func (s deployStrategy) validate(stack string) error {
+	switch s.Type {
+	case deployStrategyBlueGreen:
+		if len(s.Weights) > 0 {
+			return errors.New("only canary rollouts take weights")
+		}
+	case deployStrategyCanary:
+		if len(s.Weights) == 0 {
+			return errors.New("canary rollouts need weights")
+		}
+	default:
+		return fmt.Errorf("unknown strategy %q", s.Type)
+	}
+	if len(s.Environments) != 2 || s.Environments[0] == s.Environments[1] {
+		return errors.New("rollouts need a pair of different environments")
+	}
+	for _, environment := range s.Environments {
+		if environment == "" || deploy.ValidateEnvironmentName(environment) != nil {
+			return deploy.ErrInvalidEnvironment
+		}
+	}
+	if err := deploy.ValidateStackName(s.Switch.Stack); err != nil {
+		return err
+	}
+	if err := deploy.ValidateEnvironmentName(s.Switch.Environment); err != nil {
+		return err
+	}
+	if s.Switch.Stack == stack && slices.Contains(s.Environments, s.Switch.Environment) {
+		return errors.New("the switch can't be the module rolled out")
+	}
+	previous := 0
+	for _, weight := range s.Weights {
+		if weight <= previous || weight >= 100 {
+			return errors.New("weights must increase between 1 and 99")
+		}
+		previous = weight
+	}
+	return nil
+}
+
+// runStrategyDeploy checks and prepares every step of a rollout of the
+// chart root module, or of a single stack, and starts it like runDeploy
+// starts a deploy.
+func runStrategyDeploy(w http.ResponseWriter, r *http.Request, subject, chartID, ref, stack string, strategy deployStrategy, opts deployOptions) {
+	if !validDeployOptions(w, chartID, opts) {
+		return
+	}
+	if opts.Environment != "" || opts.Sandbox || opts.Destroy {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_strategy", Message: "rollouts pick their environment, and can't run in the sandbox or destroy"})
+		return
+	}
+	if err := strategy.validate(stack); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_strategy", Message: err.Error()})
+		return
+	}
+
+	rollouts, err := loadChartRollouts(chartID)
+	if err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+	deployments, err := loadChartDeployments(chartID)
+	if err != nil {
+		writeChartMetaError(w, err)
+		return
+	}
+	rollout := &deployRollout{strategy: strategy}
+	rollout.blue, rollout.green = rolloutEnvironments(strategy.Environments, stack, rollouts, deployments)
+
+	opts.Environment = rollout.green
+	deployReq, pipeline, ok := prepareDeploy(w, r, subject, chartID, ref, stack, opts)
+	if !ok {
+		return
+	}
+	rollout.deploy = rolloutStep{req: deployReq, pipeline: pipeline, opts: opts}
+
+	// The switches and the destroy of blue only take what reaches the
+	// runner from the request; approvals asked for cover the deploy of
+	// green.
+	stepOpts := deployOptions{
+		AgentLabels:    opts.AgentLabels,
+		ServiceAddress: opts.ServiceAddress,
+		Timeout:        opts.Timeout,
+		Secrets:        opts.Secrets,
+		Environment:    strategy.Switch.Environment,
+	}
+	for _, weight := range append(slices.Clone(strategy.Weights), 100, 0) {
+		switchReq, switchPipeline, ok := prepareDeploy(w, r, subject, chartID, deployReq.Ref, strategy.Switch.Stack, stepOpts)
+		if !ok {
+			return
+		}
+		switchReq.Traffic = &deploy.Traffic{Blue: rollout.blue, Green: rollout.green, Weight: weight}
+		rollout.switches = append(rollout.switches, rolloutStep{req: switchReq, pipeline: switchPipeline, opts: stepOpts})
+	}
+	rollout.switches, rollout.restore = rollout.switches[:len(rollout.switches)-1], rollout.switches[len(rollout.switches)-1]
+
+	i := slices.IndexFunc(deployments, func(d chartDeployment) bool { return d.Environment == rollout.blue && d.Stack == stack })
+	if i >= 0 && !strategy.KeepBlue {
+		permissions, err := loadChartPermissions(chartID)
+		if err != nil {
+			writeChartMetaError(w, err)
+			return
+		}
+		if !permissions.canDestroy(rollout.blue, stack, subject) {
+			writeJSON(w, http.StatusForbidden, errorResponse{Error: "forbidden", Message: "the chart permissions don't allow you to destroy " + rollout.blue + "; set keepBlue to leave it deployed"})
+			return
+		}
+
+		destroyOpts := stepOpts
+		destroyOpts.Environment = rollout.blue
+		destroyOpts.Destroy = true
+		destroyReq, destroyPipeline, ok := prepareDeploy(w, r, subject, chartID, cmp.Or(deployments[i].Commit, deployments[i].Ref), stack, destroyOpts)
+		if !ok {
+			return
+		}
+		rollout.decommission = &rolloutStep{req: destroyReq, pipeline: destroyPipeline, opts: destroyOpts}
+	}
+
+	ticket, ok := enqueueDeploy(chartID, rollout.green, stack, len(opts.AgentLabels) == 0)
+	if !ok {
+		writeJSON(w, http.StatusConflict, errorResponse{Error: "chart_busy", Message: "the chart is being deleted or squashed"})
+		return
+	}
+	rolloutReq := deployReq
+	rolloutReq.DeployID = uuid.NewString()
+
+	if wait, _ := strconv.ParseBool(r.URL.Query().Get("wait")); wait {
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		job := startDeployJob(rolloutReq, ticket, cancel)
+		outcome := rollout.run(ctx, job, ticket)
+		job.finish(outcome)
+		outcome.write(w, r)
+		return
+	}
+
+	// The rollout outlives the request, so it only keeps its values.
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	job := startDeployJob(rolloutReq, ticket, cancel)
+	go func() {
+		defer cancel()
+		job.finish(rollout.run(ctx, job, ticket))
+	}()
+	w.Header().Set("Location", "/api/deploy/"+rolloutReq.DeployID)
+	writeJSON(w, http.StatusAccepted, job.snapshot())
+}
+
+// rolloutEnvironments picks blue, the environment of the pair the last
+// rollout of the module left serving, and green, the other one. Before the
+// first rollout blue is the one the module was deployed to last, and
+// without a deploy to either green is the first of the pair.
+func rolloutEnvironments(environments []string, stack string, rollouts []chartRollout, deployments []chartDeployment) (string, string) {
+	live := ""
+	for _, rollout := range rollouts {
+		if rollout.Stack == stack && slices.Contains(environments, rollout.Live) {
+			live = rollout.Live
+		}
+	}
+	if live == "" {
+		deployedAt := ""
+		for _, deployment := range deployments {
+			if deployment.Stack == stack && slices.Contains(environments, deployment.Environment) && deployment.DeployedAt > deployedAt {
+				live, deployedAt = deployment.Environment, deployment.DeployedAt
+			}
+		}
+	}
+	if live == environments[0] {
+		return environments[0], environments[1]
+	}
+	return environments[1], environments[0]
+}
+
+// run runs the steps of the rollout in order until one fails. The deploy of
+// green is queued with ticket already.
+func (rollout *deployRollout) run(ctx context.Context, job *deployJob, ticket *deployTicket) deployOutcome {
+	strategy := &deployStrategyResponse{
+		Type:  rollout.strategy.Type,
+		Blue:  rollout.blue,
+		Green: rollout.green,
+		Live:  rollout.blue,
+		Steps: []deployStrategyStep{},
+	}
+	response := deployResponse{
+		DeployID:    job.id,
+		Ref:         rollout.deploy.req.Ref,
+		Stack:       rollout.deploy.req.Stack,
+		Environment: rollout.green,
+		Status:      deploy.StatusFailed,
+		Strategy:    strategy,
+	}
+	finish := func() deployOutcome {
+		if ctx.Err() != nil {
+			return deployOutcome{status: http.StatusConflict, err: &errorResponse{Error: "deploy_canceled", Message: "the rollout was canceled"}, deployStatus: deployStatusCanceled}
+		}
+		return deployOutcome{status: http.StatusOK, response: response}
+	}
+
+	if !rollout.runStep(ctx, job, strategy, rolloutStepDeploy, rollout.deploy, ticket) {
+		return finish()
+	}
+	for _, step := range rollout.switches {
+		if rollout.runStep(ctx, job, strategy, rolloutStepSwitch, step, nil) {
+			continue
+		}
+		// A failed switch may have moved part of the traffic, so all of
+		// it goes back to blue, even when the rollout was canceled.
+		if !rollout.runStep(context.WithoutCancel(ctx), job, strategy, rolloutStepRestore, rollout.restore, nil) {
+			strategy.Live = ""
+		}
+		return finish()
+	}
+	strategy.Live = rollout.green
+	recordChartRollout(rollout.deploy.req.ChartID, chartRollout{Stack: rollout.deploy.req.Stack, Live: rollout.green}, rollout.strategy.Environments)
+
+	if rollout.decommission != nil && !rollout.runStep(ctx, job, strategy, rolloutStepDecommission, *rollout.decommission, nil) {
+		return finish()
+	}
+	response.Status = deploy.StatusSucceeded
+	return finish()
+}
+
+// runStep runs a step of the rollout as a deploy of its own, queued with
+// ticket or else behind the deploys of its stack, adds it to the steps of
+// strategy and reports whether it succeeded.
+func (rollout *deployRollout) runStep(ctx context.Context, job *deployJob, strategy *deployStrategyResponse, action string, step rolloutStep, ticket *deployTicket) bool {
+	result := deployStrategyStep{Action: action, DeployID: step.req.DeployID, Status: deploy.StatusFailed}
+	if step.req.Traffic != nil {
+		result.Weight = step.req.Traffic.Weight
+	}
+	defer func() { strategy.Steps = append(strategy.Steps, result) }()
+
+	if ticket == nil {
+		var ok bool
+		ticket, ok = enqueueDeploy(step.req.ChartID, step.req.Environment, step.req.Stack, len(step.opts.AgentLabels) == 0)
+		if !ok {
+			result.Error = &errorResponse{Error: "chart_busy", Message: "the chart is being deleted or squashed"}
+			return false
+		}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stepJob := startDeployJob(step.req, ticket, cancel)
+	job.addStep(step.req.DeployID)
+	stepJob.finish(runQueuedDeploy(ctx, ticket, step.req, step.pipeline, step.opts))
+
+	snapshot := stepJob.snapshot()
+	result.Status, result.Error = snapshot.Status, snapshot.Error
+	return snapshot.Status == deploy.StatusSucceeded
+}
+
+func loadChartRollouts(chartID string) ([]chartRollout, error) {
+	rollouts := []chartRollout{}
+	if err := chart.ReadChartMeta(chartID, chartRolloutsMeta, &rollouts); err != nil && !errors.Is(err, chart.ErrMetaNotFound) {
+		return nil, err
+	}
+	return rollouts, nil
+}
+
+// recordChartRollout stores the environment of the pair serving the traffic
+// of a module once a rollout switched it. Failures are logged, they never
+// fail the rollout itself.
+func recordChartRollout(chartID string, rollout chartRollout, environments []string) {
+	chartRolloutsMu.Lock()
+	defer chartRolloutsMu.Unlock()
+
+	rollout.RolledOutAt = time.Now().UTC().Format(time.RFC3339)
+	rollouts, err := loadChartRollouts(chartID)
+	if err == nil {
+		rollouts = slices.DeleteFunc(rollouts, func(r chartRollout) bool {
+			return r.Stack == rollout.Stack && slices.Contains(environments, r.Live)
+		})
+		err = chart.WriteChartMeta(chartID, chartRolloutsMeta, append(rollouts, rollout))
+	}
+	if err != nil {
+		log.Printf("Recording rollout of chart %s failed: %v", chartID, err)
+	}
+}
@@ -15,22 +15,27 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/auth": {
-            "get": {
-                "description": "Issues a new access token using a refresh token in the Authorization header or refresh_token query param.",
+        "/admin/export": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns every chart with its history and metadata, the trash and the secure store as a tar.gz archive, as ` + "`" + `server export` + "`" + ` writes it. Chart secrets, stored secrets and service account keys are sealed with the passphrase in X-Migration-Passphrase; user keys stay encrypted with the passwords of their users. Charts written to during the export may be archived half way, so export while the instance is idle. Only instance admins can export: users named in INSTANCE_ADMINS and service accounts with the admin role.",
                 "produces": [
-                    "application/json"
+                    "application/gzip"
                 ],
                 "tags": [
-                    "auth"
+                    "admin"
                 ],
-                "summary": "Refresh access token",
+                "summary": "Export the instance",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Refresh token",
-                        "name": "refresh_token",
-                        "in": "query",
+                        "description": "Passphrase sealing the secrets of the archive",
+                        "name": "X-Migration-Passphrase",
+                        "in": "header",
                         "required": true
                     }
                 ],
@@ -38,67 +43,96 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/server.authResponse"
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid_passphrase` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
                         }
                     },
                     "401": {
-                        "description": "Unauthorized",
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
                         "schema": {
                             "$ref": "#/definitions/server.errorResponse"
                         }
                     },
                     "500": {
-                        "description": "Internal Server Error",
+                        "description": "` + "`" + `export_failed` + "`" + `",
                         "schema": {
                             "$ref": "#/definitions/server.errorResponse"
                         }
                     }
                 }
-            },
+            }
+        },
+        "/admin/import": {
             "post": {
-                "description": "Issues access and refresh tokens by decrypting the stored SSH private key with the provided password.",
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Restores the archive of an export in the body, as ` + "`" + `server import` + "`" + ` does, keeping the chart IDs and subjects. Nothing is imported when the instance already has any of them. The passphrase the archive was sealed with goes in X-Migration-Passphrase. Only instance admins can import: users named in INSTANCE_ADMINS and service accounts with the admin role.",
                 "consumes": [
-                    "application/json"
+                    "application/gzip"
                 ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "auth"
+                    "admin"
                 ],
-                "summary": "Log in",
+                "summary": "Import an instance export",
                 "parameters": [
                     {
-                        "description": "User credentials",
-                        "name": "credentials",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/server.authRequest"
-                        }
+                        "type": "string",
+                        "description": "Passphrase the archive was sealed with",
+                        "name": "X-Migration-Passphrase",
+                        "in": "header",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/server.authResponse"
+                            "$ref": "#/definitions/server.adminImportResponse"
                         }
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "` + "`" + `invalid_passphrase` + "`" + `, ` + "`" + `invalid_archive` + "`" + `",
                         "schema": {
                             "$ref": "#/definitions/server.errorResponse"
                         }
                     },
                     "401": {
-                        "description": "Unauthorized",
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "` + "`" + `migration_conflict` + "`" + `",
                         "schema": {
                             "$ref": "#/definitions/server.errorResponse"
                         }
                     },
                     "500": {
-                        "description": "Internal Server Error",
+                        "description": "` + "`" + `import_failed` + "`" + `",
                         "schema": {
                             "$ref": "#/definitions/server.errorResponse"
                         }
@@ -106,221 +140,291 @@ const docTemplate = `{
                 }
             }
         },
-        "/chart": {
+        "/admin/jobs/summary": {
             "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Lists all available charts.",
+                "description": "Returns the deploy queue depth, running jobs, the average time agent jobs waited in the queue, started, succeeded and failed jobs with the failure rate per type, and how much of the capacity of connected agents is in use. Counters cover the jobs since the server started.",
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
-                    "chart"
+                    "jobs"
                 ],
-                "summary": "List charts",
+                "summary": "Summarize deploy jobs",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/server.chartListResponse"
+                            "$ref": "#/definitions/server.jobsSummaryResponse"
                         }
-                    }
-                }
-            },
-            "post": {
-                "security": [
-                    {
-                        "BearerAuth": []
-                    }
-                ],
-                "description": "Creates a new chart.",
-                "tags": [
-                    "chart"
-                ],
-                "summary": "Create chart",
-                "responses": {
-                    "201": {
-                        "description": "Created",
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
                         "schema": {
-                            "$ref": "#/definitions/server.chartResponse"
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
                         }
                     }
                 }
             }
         },
-        "/chart/{id}": {
+        "/agent": {
             "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Returns the contents of a file in a chart at a ref.",
-                "tags": [
-                    "chart"
+                "description": "Returns the deploy agents registered by the current user since the server started.",
+                "produces": [
+                    "application/json"
                 ],
-                "summary": "Get chart file",
-                "parameters": [
-                    {
-                        "type": "string",
-                        "description": "Chart ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "File path in the chart repo",
-                        "name": "file",
-                        "in": "query",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "Git ref (defaults to HEAD)",
-                        "name": "ref",
-                        "in": "query"
-                    }
+                "tags": [
+                    "deploy"
                 ],
+                "summary": "List deploy agents",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/server.chartFileResponse"
+                            "$ref": "#/definitions/server.agentListResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
                         }
                     }
                 }
             },
-            "put": {
+            "post": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Writes files to a chart and commits the change.",
+                "description": "Registers a self-hosted deploy agent. The agent then polls /agent/{id}/jobs for the deploys of the current user that request a subset of its labels, such as cloud=aws or region=eu, and runs up to capacity of them at once in its own network. Registrations are kept in memory, agents register again when the server restarts.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
-                    "chart"
+                    "deploy"
                 ],
-                "summary": "Create or replace whole files in chart",
+                "summary": "Register a deploy agent",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "Chart ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "description": "Commit payload",
+                        "description": "Agent",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/server.chartCommitRequest"
+                            "$ref": "#/definitions/server.agentRegisterRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/server.agentResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid_request` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
                         }
                     }
+                }
+            }
+        },
+        "/agent/capacity": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the connected agents of the current user grouped by label set with their free capacity, and the deploys queued per requested label set.",
+                "produces": [
+                    "application/json"
                 ],
+                "tags": [
+                    "deploy"
+                ],
+                "summary": "Deploy agent capacity",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/server.chartCommitResponse"
+                            "$ref": "#/definitions/server.agentCapacityResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
                         }
                     }
                 }
-            },
-            "head": {
+            }
+        },
+        "/agent/{id}/jobs": {
+            "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Returns a recursive listing of files for a chart at a ref.",
+                "description": "Waits up to 30 seconds for a queued deploy job the agent can take: the oldest one whose labels the agent carries, while the agent runs fewer jobs than its capacity. Agents that stop polling for a minute are considered offline.",
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
-                    "chart"
+                    "jobs"
                 ],
-                "summary": "List chart files",
+                "summary": "Poll for a deploy job",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Chart ID",
+                        "description": "Agent ID",
                         "name": "id",
                         "in": "path",
                         "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "Git ref (defaults to HEAD)",
-                        "name": "ref",
-                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/server.chartTreeResponse"
+                            "$ref": "#/definitions/deploy.Job"
+                        }
+                    },
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `agent_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
                         }
                     }
                 }
             }
         },
-        "/deploy": {
+        "/agent/{id}/jobs/{jobId}": {
             "post": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Runs tofu verify and tofu apply for a git ref using the configured runner image.",
+                "description": "Completes a deploy job with the result of the run on the agent.",
                 "consumes": [
                     "application/json"
                 ],
-                "produces": [
-                    "application/json"
-                ],
                 "tags": [
-                    "deploy"
+                    "jobs"
                 ],
-                "summary": "Deploy a ref",
+                "summary": "Report a deploy job result",
                 "parameters": [
                     {
-                        "description": "Deploy request",
+                        "type": "string",
+                        "description": "Agent ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Job ID",
+                        "name": "jobId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Job result",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/server.deployRequest"
+                            "$ref": "#/definitions/deploy.JobResult"
                         }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "$ref": "#/definitions/server.deployResponse"
-                        }
+                    "204": {
+                        "description": "No Content"
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "` + "`" + `invalid_request` + "`" + `",
                         "schema": {
                             "$ref": "#/definitions/server.errorResponse"
                         }
                     },
                     "401": {
-                        "description": "Unauthorized",
+                        "description": "` + "`" + `unauthorized` + "`" + `",
                         "schema": {
                             "$ref": "#/definitions/server.errorResponse"
                         }
                     },
-                    "409": {
-                        "description": "Conflict",
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
                         "schema": {
                             "$ref": "#/definitions/server.errorResponse"
                         }
                     },
-                    "500": {
-                        "description": "Internal Server Error",
+                    "404": {
+                        "description": "` + "`" + `agent_not_found` + "`" + `, ` + "`" + `job_not_found` + "`" + `",
                         "schema": {
                             "$ref": "#/definitions/server.errorResponse"
                         }
@@ -328,197 +432,11636 @@ const docTemplate = `{
                 }
             }
         },
-        "/health": {
-            "get": {
-                "description": "Returns the API status.",
-                "tags": [
-                    "health"
-                ],
-                "summary": "Health check",
-                "responses": {
-                    "200": {
+        "/agent/{id}/jobs/{jobId}/gate": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Evaluates the gate a running job paused at, such as the chart run tasks following a stage, and returns its results once it decided. Any blocked result fails the job.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "jobs"
+                ],
+                "summary": "Evaluate a deploy job gate",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Agent ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Job ID",
+                        "name": "jobId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Gate stage and plan",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/deploy.GateInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/server.healthResponse"
+                            "$ref": "#/definitions/server.agentGateResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid_request` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `agent_not_found` + "`" + `, ` + "`" + `gate_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth": {
+            "get": {
+                "description": "Issues a new access token using a refresh token in the Authorization header or refresh_token query param. The new refresh token keeps the expiry of the session's login, unless sliding sessions are enabled, in which case it expires a full refresh token lifetime from now, but never after sessionExpiresAt.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Refresh access token",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Refresh token",
+                        "name": "refresh_token",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.authResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Issues access and refresh tokens by decrypting the stored SSH private key with the provided password. Service accounts log in with their subject (\"service:\" and their name) as the username and their secret as the password, and get tokens only allowing what their role bindings grant.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Log in",
+                "parameters": [
+                    {
+                        "description": "User credentials",
+                        "name": "credentials",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.authRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.authResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid_request` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `token_error` + "`" + `, ` + "`" + `key_load_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Lists charts a page at a time with the branch and commit of their HEAD, when it was committed and how many files it has. Archived charts are only listed, marked archived, when requested. With watch and the X-Watch-Cursor of the last response in since, the request waits until charts are created, deleted, archived or committed to. Charts can be filtered by ID and sorted by ID or by last commit, newest first; charts without commits sort last.",
+                "tags": [
+                    "chart"
+                ],
+                "summary": "List charts",
+                "parameters": [
+                    {
+                        "type": "boolean",
+                        "description": "Also list archived charts",
+                        "name": "archived",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only list charts whose ID contains this text",
+                        "name": "q",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Sort by id (default) or lastCommit",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of charts to skip",
+                        "name": "offset",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of charts (default 100, max 500)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated chart fields to return, such as chartId,lastCommitAt",
+                        "name": "fields",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Wait up to 30 seconds for a change when since is the current cursor",
+                        "name": "watch",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "X-Watch-Cursor of the last response",
+                        "name": "since",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartListResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid pagination` + "`" + `, ` + "`" + `invalid sort` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to list charts` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Creates a new chart.",
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Create chart",
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartResponse"
                         }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to create chart` + "`" + `, ` + "`" + `failed to initialize chart` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/archived": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
                     }
+                ],
+                "description": "Archives or restores several charts at once. Archived charts are hidden from the chart list unless requested and cannot be deployed.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Archive or restore charts",
+                "parameters": [
+                    {
+                        "description": "Charts to update",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.chartArchiveRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartArchiveResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid_request` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/bootstrap": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Creates a new chart whose main.tf.json requires the selected provider, configures it and declares an example resource named name (\"planemgr-\" and the start of the chart ID by default): an S3 bucket on aws, a storage bucket on gcp, a resource group on azure and a namespace on k8s. region defaults to us-east-1, us-central1 and westeurope; project is the GCP project, required on gcp, or the Azure subscription. Credentials are left to the runner environment, and state stays local until the chart configures a backend.",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Create chart for a provider",
+                "parameters": [
+                    {
+                        "description": "Provider selection",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.chartBootstrapRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid request body` + "`" + `, the invalid parameter",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to create chart` + "`" + `, ` + "`" + `failed to initialize chart` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/deploy-stats": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Counts deploy attempts per chart and UTC day over a date range, with how many failed. Failed, timed out and rolled back deploys count as failures. Charts without deploys in the range are left out. Counts are kept for 400 days.",
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Deploy frequency and failures per chart",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "First day, YYYY-MM-DD (defaults to 30 days before to)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last day, YYYY-MM-DD (defaults to today)",
+                        "name": "to",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.deployStatsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid_request` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_list_failed` + "`" + `, ` + "`" + `chart_report_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/import": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Creates a chart from an export bundle, of this or another instance: the files under \"config/\" are committed at once, and the environments with their variables and the budget of the manifest restored. Tags, deploy records and history only describe the exported chart and are not imported, and neither is state.",
+                "consumes": [
+                    "application/gzip",
+                    "application/zip"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Import chart bundle",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Archive format: tar.gz (default) or zip",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "description": "Export bundle",
+                        "name": "bundle",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid archive format` + "`" + `, ` + "`" + `invalid export bundle` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to import chart` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/report": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Lists charts that are not archived and have no commits or deploys in the given number of days, were never deployed, or whose last deploy failed.",
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Chart hygiene report",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Days without activity before a chart is stale (default 90)",
+                        "name": "days",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartHygieneResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid_request` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_list_failed` + "`" + `, ` + "`" + `chart_settings_failed` + "`" + `, ` + "`" + `chart_report_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/trash": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Lists the charts in the trash, most recently deleted first, with when they are purged for good. Deleted charts are kept for CHART_TRASH_RETENTION (30 days by default).",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "List deleted charts",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartTrashResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to list deleted charts` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the contents of a file in a chart at a ref. Contents are base64 encoded, with encoding set to \"base64\", when asked for or when the file isn't valid UTF-8. contentType is guessed from the file name or content and size is in bytes. Files larger than CHART_FILE_INLINE_KB (1024 by default) aren't inlined; 422 is returned with a raw link to the raw endpoint instead. With at, the file is read from the commit the ref pointed to at that time. The ETag is the blob hash, so polling with If-None-Match gets 304 until the content changes; X-Chart-Ref is the commit the file was read from.",
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Get chart file",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "File path in the chart repo",
+                        "name": "file",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Git ref (defaults to HEAD)",
+                        "name": "ref",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 timestamp; resolves ref to the commit it pointed to at that time",
+                        "name": "at",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "base64"
+                        ],
+                        "type": "string",
+                        "description": "Set to base64 to always get base64 encoded contents",
+                        "name": "encoding",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Blob hash of the content the client has",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartFileResponse"
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified"
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `chart id required` + "`" + `, ` + "`" + `file required` + "`" + `, ` + "`" + `unsupported encoding` + "`" + `, ` + "`" + `at must be an RFC 3339 timestamp` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart not found` + "`" + `, ` + "`" + `chart ref not found` + "`" + `, ` + "`" + `chart file not found` + "`" + `, ` + "`" + `no chart commit at that time` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "` + "`" + `chart path is a symlink` + "`" + `, ` + "`" + `chart file too large to inline` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to read chart file` + "`" + `, ` + "`" + `failed to resolve chart ref` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Writes files to a chart and commits the change. Entries with \"encoding\": \"base64\" carry base64 encoded content, for binary files. Entries with \"delete\": true remove the path instead, and entries with \"oldPath\" and \"newPath\" move a file without changing its content. With expectedRef, or an If-Match header, holding the commit the edit was based on, nothing is committed and 409 is returned with the current ref when the branch moved since. With \"validate\": true, written .tf.json files must be well-formed Terraform JSON configuration and .tf and .tfvars files valid HCL, or nothing is committed and 422 is returned. Writes breaking the chart commit policy are rejected with 422 and the reason.",
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Create, replace, delete or move whole files in chart",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Commit payload",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.chartCommitRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Commit the branch must still be at, as returned in the ETag of tree listings or the X-Chart-Ref header of file reads",
+                        "name": "If-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartCommitResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `chart id required` + "`" + `, ` + "`" + `invalid request body` + "`" + `, ` + "`" + `message required` + "`" + `, ` + "`" + `files required` + "`" + `, ` + "`" + `moved files require only oldPath and newPath` + "`" + `, ` + "`" + `file path required` + "`" + `, ` + "`" + `deleted files cannot have content` + "`" + `, ` + "`" + `invalid base64 content` + "`" + `, ` + "`" + `unsupported encoding` + "`" + `, ` + "`" + `expectedRef and If-Match differ` + "`" + `, ` + "`" + `invalid file path` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart not found` + "`" + `, ` + "`" + `chart file not found` + "`" + `, ` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "` + "`" + `chart branch moved past the expected commit` + "`" + `, ` + "`" + `chart file already exists` + "`" + `, ` + "`" + `chart changed concurrently, retry` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "the path of the invalid file and the validation error, ` + "`" + `commit rejected by policy` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "423": {
+                        "description": "` + "`" + `chart_locked` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to write chart file` + "`" + `, ` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Moves a chart repository to the trash, where it can be restored until CHART_TRASH_RETENTION (30 days by default) passes. Fails with 409 while a deploy of the chart is running.",
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Delete chart",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart not found` + "`" + `, ` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "` + "`" + `chart deploy in progress` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "423": {
+                        "description": "` + "`" + `chart_locked` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to delete chart` + "`" + `, ` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "head": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns a recursive listing of files for a chart at a ref. With path or depth, returns the entries of the directory at path instead, directories included, and of its subdirectories up to depth levels down (1 by default, the directory alone), so large trees can be loaded lazily. Entries carry their mode, the size of files and the last commit on the first-parent line that changed them. With at, the listing is of the commit the ref pointed to at that time, following its first parents.",
+                "tags": [
+                    "chart"
+                ],
+                "summary": "List chart files",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Git ref (defaults to HEAD)",
+                        "name": "ref",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 timestamp; resolves ref to the commit it pointed to at that time",
+                        "name": "at",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Directory to list (defaults to the root)",
+                        "name": "path",
+                        "in": "query"
+                    },
+                    {
+                        "minimum": 1,
+                        "type": "integer",
+                        "description": "Directory levels to list",
+                        "name": "depth",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Recursive listing, or a chartTreeEntriesResponse with path or depth",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartTreeResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `chart id required` + "`" + `, ` + "`" + `depth must be a positive integer` + "`" + `, ` + "`" + `invalid chart file path` + "`" + `, ` + "`" + `at must be an RFC 3339 timestamp` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart not found` + "`" + `, ` + "`" + `chart ref not found` + "`" + `, ` + "`" + `chart directory not found` + "`" + `, ` + "`" + `no chart commit at that time` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to list chart files` + "`" + `, ` + "`" + `failed to resolve chart ref` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Applies an RFC 6902 JSON Patch (Content-Type application/json-patch+json) or RFC 7386 JSON Merge Patch (Content-Type application/merge-patch+json) document to a JSON file of the chart, such as main.tf.json, and commits the result. The patch is applied to the latest commit, so changes committed meanwhile are never overwritten; use a JSON Patch \"test\" operation to make the patch depend on a value. The file keeps its key order and indentation. A patch that changes nothing returns the current commit without committing.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Patch a JSON file in chart",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Path of the JSON file",
+                        "name": "file",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Commit message, defaults to Patch followed by the file path",
+                        "name": "message",
+                        "in": "query"
+                    },
+                    {
+                        "description": "JSON Patch or JSON Merge Patch document",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartCommitResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `chart id required` + "`" + `, ` + "`" + `file query parameter required` + "`" + `, ` + "`" + `invalid request body` + "`" + `, ` + "`" + `invalid file path` + "`" + `, ` + "`" + `invalid patch document` + "`" + `, ` + "`" + `chart file is not a JSON document` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart not found` + "`" + `, ` + "`" + `chart file not found` + "`" + `, ` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "` + "`" + `chart changed concurrently, retry` + "`" + `, ` + "`" + `patch does not apply to the chart file` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "415": {
+                        "description": "` + "`" + `unsupported patch content type` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "` + "`" + `commit rejected by policy` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "423": {
+                        "description": "` + "`" + `chart_locked` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to patch chart file` + "`" + `, ` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/archive": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Streams the chart tree at a ref as a tar.gz or zip archive. Files are placed under a \"\u003cchart id\u003e-\u003cshort hash\u003e/\" directory.",
+                "produces": [
+                    "application/gzip",
+                    "application/zip"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Download chart archive",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Git ref (defaults to HEAD)",
+                        "name": "ref",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Archive format: tar.gz (default) or zip",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid archive format` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart not found` + "`" + `, ` + "`" + `chart ref not found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to archive chart` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/blame": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns every line of a file at a ref with the commit that last modified it, its author, timestamp and the first line of its message.",
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Blame a chart file",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "File path in the chart repo",
+                        "name": "file",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Git ref (defaults to HEAD)",
+                        "name": "ref",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartBlameResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `file required` + "`" + `, ` + "`" + `invalid file path` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart not found` + "`" + `, ` + "`" + `chart ref not found` + "`" + `, ` + "`" + `chart file not found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to blame chart file` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/budget": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the resource count and estimated cost budget that plans of the chart are checked against.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Get chart budget",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartBudget"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Replaces the chart budget. Deploys whose plan exceeds it are blocked, or only flagged when enforcement is \"warn\". Chart admins can force blocked deploys by listing \"budget\" in overridePolicies, which the deploy history records. Only chart admins can change the budget, so a chart without admins has to get them first.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Set chart budget",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Budget",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.chartBudget"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartBudget"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid_request` + "`" + `, ` + "`" + `invalid_budget` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Removes the chart budget. Only chart admins can remove it.",
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Remove chart budget",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.emptyResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/cherry-pick": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Applies the changes of a single commit from any ref, relative to its first parent, onto the chart branch as a new commit. Text files the branch changed too are merged line by line. When changes can't be merged nothing is committed and the conflicting paths are returned, with the conflicting hunks for text files.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Cherry-pick a commit",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Commit ref and optional commit message",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.chartCherryPickRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartCherryPickResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid request body` + "`" + `, ` + "`" + `ref required` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart not found` + "`" + `, ` + "`" + `chart ref not found` + "`" + `, ` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "` + "`" + `chart already contains the changes` + "`" + `, ` + "`" + `merge conflicts` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartMergeConflictResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "` + "`" + `commit rejected by policy` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "423": {
+                        "description": "` + "`" + `chart_locked` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to cherry-pick commit` + "`" + `, ` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/commit-policy": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the rules commits to the chart must follow.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Get chart commit policy",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartCommitPolicy"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Replaces the commit policy. A commit is rejected when its message doesn't start with messagePrefix or match the messagePattern regular expression, when it touches more than maxFiles files, or when a written, deleted or moved path, or one of its directories, matches a deniedPaths glob. Every commit is checked: those made through the API are rejected with 422 and the reason, and pushes are refused per ref for their new commits. The baseline commit of a squash only has its message checked. Empty rules are off.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Set chart commit policy",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Commit policy",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.chartCommitPolicy"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartCommitPolicy"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid_request` + "`" + `, ` + "`" + `invalid_commit_policy` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Remove chart commit policy",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.emptyResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/commit/{hash}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the metadata of a commit with the files it added, modified or deleted and the lines changed, compared to its first parent. Root commits list every file as added.",
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Summarize a chart commit",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Commit hash or git ref",
+                        "name": "hash",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartCommitSummaryResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart not found` + "`" + `, ` + "`" + `chart ref not found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to read chart commit` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/copy": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Copies files of the source chart at ref (HEAD by default) into the chart as a single commit, at the same paths and with the same modes. Paths naming a directory copy every file below it, and files already at a copied path are replaced. The commit message ends with a \"Copied-from:\" trailer holding the source chart ID and commit.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Copy files from another chart",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Source chart, ref and paths",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.chartCopyRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartCopyResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid request body` + "`" + `, ` + "`" + `invalid source chart id` + "`" + `, ` + "`" + `paths required` + "`" + `, ` + "`" + `invalid file path` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart not found` + "`" + `, ` + "`" + `source chart not found` + "`" + `, ` + "`" + `chart ref not found` + "`" + `, ` + "`" + `chart file not found` + "`" + `, ` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "` + "`" + `chart already contains the copied files` + "`" + `, ` + "`" + `chart changed concurrently, retry` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "` + "`" + `commit rejected by policy` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "423": {
+                        "description": "` + "`" + `chart_locked` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to copy chart files` + "`" + `, ` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/default-branch": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the branch commits go to and that tree listings, file reads and deploys without a ref use. New charts start on DEFAULT_BRANCH (main by default).",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Get chart default branch",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartDefaultBranch"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Switches the chart to another branch. A branch that doesn't exist yet is created at the current commit, so the chart keeps its history; the previous branch is kept.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Set chart default branch",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Default branch",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.chartDefaultBranch"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartDefaultBranch"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid_request` + "`" + `, ` + "`" + `invalid_branch` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "423": {
+                        "description": "` + "`" + `chart_locked` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/deploy-account": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the service account the chart deploys as, or 404 when deploys use the keys of the deploying user.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Get chart deploy account",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartDeployAccount"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `not_bound` + "`" + `, ` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Binds the chart to a service account with an SSH key pair. Deploys of the chart then use the keys of the service account instead of those of the deploying user, so they don't depend on the user's private key being unlocked. Permissions and policies still apply to the deploying user. Only users can bind charts, and once the chart has admins only they can.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Bind chart to a deploy account",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Service account",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.chartDeployAccountRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartDeployAccount"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid_request` + "`" + `, ` + "`" + `ssh_key_required` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `, ` + "`" + `service_account_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `, ` + "`" + `service_account_load_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Makes deploys of the chart use the keys of the deploying user again.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Unbind chart deploy account",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartDeployAccount"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `not_bound` + "`" + `, ` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/deployments": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the deploy attempts of a chart, newest first, with who started them, when they ran, how they ended and the last 16 KiB of the runner output. The last 200 deploys of every chart are kept, and the whole output of each at GET /api/chart/{id}/deployments/{deployId}/log.",
+                "tags": [
+                    "chart"
+                ],
+                "summary": "List chart deployments",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only list deploys of this stack; empty for the root module",
+                        "name": "stack",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only list deploys to this environment; empty for deploys without one",
+                        "name": "environment",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of deploys to skip",
+                        "name": "offset",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of deploys (default 20, max 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated deployment fields to return, such as deployId,status",
+                        "name": "fields",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartDeployHistoryResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid pagination` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart not found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to read deployments` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/deployments/{deployId}/log": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the whole runner output of a finished deploy of the chart, decompressed. Logs are stored zstd-compressed once their deploy finished, moved to DEPLOY_LOG_COLD_DIR when it is set and they are older than DEPLOY_LOG_COLD_AFTER (30 days by default), and removed with their deploy from the deploy history.",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Get a deploy log",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Deploy ID",
+                        "name": "deployId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Runner output",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `, ` + "`" + `deploy_log_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `deploy_log_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/diff": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns per-file unified diffs and an added/modified/deleted summary between two refs. Moved files are listed once as modified, with their oldPath, when their content stayed mostly the same. fromAt and toAt resolve their ref to the commit it pointed to at that time, so \"from\" may be omitted when fromAt is given.",
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Diff two chart refs",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base git ref, required without fromAt (defaults to HEAD with fromAt)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Target git ref (defaults to HEAD)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 timestamp; resolves the from ref to the commit it pointed to at that time",
+                        "name": "fromAt",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 timestamp; resolves the to ref to the commit it pointed to at that time",
+                        "name": "toAt",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartDiffResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `from or fromAt required` + "`" + `, ` + "`" + `at must be an RFC 3339 timestamp` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart not found` + "`" + `, ` + "`" + `chart ref not found` + "`" + `, ` + "`" + `no chart commit at that time` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to diff chart` + "`" + `, ` + "`" + `failed to resolve chart ref` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/environments": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the environments deploys of the chart can target, with their branch and variables.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Get chart environments",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartEnvironments"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Replaces the environments deploys of the chart can target. Each keeps the managed state of the root module and the stacks apart from the other environments and from deploys without one, served with ?environment= on the state endpoints. Its variables are passed to tofu, and its branch is deployed when the deploy request names no ref. Environments with expiresAt are ephemeral: the users who deployed to them are warned an hour before, then every module deployed to them is destroyed and they are removed. Removing an environment keeps its state. Once chart admins are set only they can change the environments.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Set chart environments",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Environments",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.chartEnvironments"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartEnvironments"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid_request` + "`" + `, ` + "`" + `invalid_environment` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/environments/{name}/extend": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Moves the expiry of an ephemeral environment of the chart extendSeconds later, counted from now once it passed, and warns again before the new one. Unlike setting expiresAt, anyone who can deploy the chart may extend it. Environments can't be extended while they are torn down.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Extend an ephemeral environment",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Environment name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Extension",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.chartEnvironmentExtendRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartEnvironment"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid_request` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `, ` + "`" + `environment_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "` + "`" + `environment_not_ephemeral` + "`" + `, ` + "`" + `environment_expiring` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/events": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Streams the events of a chart as server-sent events while the connection is open: commits to the default branch, created, moved, deleted and default branches, tags, finished deploys, and the presence of collaborators: a user joins with the stream, path and editing give the file they are viewing or editing, PUT /api/chart/{id}/presence changes it, and they leave once their last stream closed. Each event is named by its type and carries its JSON in the data field. Clients that fall behind are disconnected and should reload the chart after reconnecting; events are not replayed.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Stream chart events",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Chart file the user is on",
+                        "name": "path",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "The user is editing the file rather than viewing it",
+                        "name": "editing",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartEvent"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid_request` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart not found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/export": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Streams a portable bundle of a chart for migrating to other orchestrators: the chart files at a ref under \"config/\" and a manifest.json with workspaces, environments with their variables, budget, tags, deploy records and commit history. Workspaces using the state the server manages carry the address of its http backend, on PUBLIC_URL when set. POST /api/chart/import creates a chart from a bundle.",
+                "produces": [
+                    "application/gzip",
+                    "application/zip"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Export chart bundle",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Git ref (defaults to HEAD)",
+                        "name": "ref",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Archive format: tar.gz (default) or zip",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid archive format` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart not found` + "`" + `, ` + "`" + `chart ref not found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to export chart` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/files": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the contents of several files read from the same commit in one response. GET takes a comma separated paths query parameter; POST, also served at files:read, takes the path list in the body, for paths containing commas or long lists. Paths that aren't files at the ref are listed under missing. Contents are base64 encoded, with encoding set to \"base64\", when asked for or when a file isn't valid UTF-8.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Get several chart files",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma separated file paths, for GET",
+                        "name": "paths",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Git ref (defaults to HEAD)",
+                        "name": "ref",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 timestamp; resolves ref to the commit it pointed to at that time",
+                        "name": "at",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "base64"
+                        ],
+                        "type": "string",
+                        "description": "Set to base64 to always get base64 encoded contents",
+                        "name": "encoding",
+                        "in": "query"
+                    },
+                    {
+                        "description": "File paths, for POST",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartFilesRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartFilesResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid request body` + "`" + `, ` + "`" + `paths required` + "`" + `, ` + "`" + `too many paths` + "`" + `, ` + "`" + `unsupported encoding` + "`" + `, ` + "`" + `at must be an RFC 3339 timestamp` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart not found` + "`" + `, ` + "`" + `chart ref not found` + "`" + `, ` + "`" + `no chart commit at that time` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to read chart files` + "`" + `, ` + "`" + `failed to resolve chart ref` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the contents of several files read from the same commit in one response. GET takes a comma separated paths query parameter; POST, also served at files:read, takes the path list in the body, for paths containing commas or long lists. Paths that aren't files at the ref are listed under missing. Contents are base64 encoded, with encoding set to \"base64\", when asked for or when a file isn't valid UTF-8.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Get several chart files",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma separated file paths, for GET",
+                        "name": "paths",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Git ref (defaults to HEAD)",
+                        "name": "ref",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 timestamp; resolves ref to the commit it pointed to at that time",
+                        "name": "at",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "base64"
+                        ],
+                        "type": "string",
+                        "description": "Set to base64 to always get base64 encoded contents",
+                        "name": "encoding",
+                        "in": "query"
+                    },
+                    {
+                        "description": "File paths, for POST",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartFilesRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartFilesResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid request body` + "`" + `, ` + "`" + `paths required` + "`" + `, ` + "`" + `too many paths` + "`" + `, ` + "`" + `unsupported encoding` + "`" + `, ` + "`" + `at must be an RFC 3339 timestamp` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart not found` + "`" + `, ` + "`" + `chart ref not found` + "`" + `, ` + "`" + `no chart commit at that time` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to read chart files` + "`" + `, ` + "`" + `failed to resolve chart ref` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/files:read": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the contents of several files read from the same commit in one response. GET takes a comma separated paths query parameter; POST, also served at files:read, takes the path list in the body, for paths containing commas or long lists. Paths that aren't files at the ref are listed under missing. Contents are base64 encoded, with encoding set to \"base64\", when asked for or when a file isn't valid UTF-8.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Get several chart files",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma separated file paths, for GET",
+                        "name": "paths",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Git ref (defaults to HEAD)",
+                        "name": "ref",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 timestamp; resolves ref to the commit it pointed to at that time",
+                        "name": "at",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "base64"
+                        ],
+                        "type": "string",
+                        "description": "Set to base64 to always get base64 encoded contents",
+                        "name": "encoding",
+                        "in": "query"
+                    },
+                    {
+                        "description": "File paths, for POST",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartFilesRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartFilesResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid request body` + "`" + `, ` + "`" + `paths required` + "`" + `, ` + "`" + `too many paths` + "`" + `, ` + "`" + `unsupported encoding` + "`" + `, ` + "`" + `at must be an RFC 3339 timestamp` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart not found` + "`" + `, ` + "`" + `chart ref not found` + "`" + `, ` + "`" + `no chart commit at that time` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to read chart files` + "`" + `, ` + "`" + `failed to resolve chart ref` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/fmt": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Rewrites HCL files (.tf and .tfvars) of the chart in the canonical style ` + "`" + `tofu fmt` + "`" + ` uses and commits the files that changed. Every HCL file is formatted unless paths are given. Files with syntax errors fail the request with 422 and nothing is committed. Without changes no commit is made and ref is the current commit.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Format HCL chart files",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Files to format",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartFmtRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartCommitResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid request body` + "`" + `, ` + "`" + `invalid chart file path` + "`" + `, ` + "`" + `not an HCL configuration file` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart not found` + "`" + `, ` + "`" + `chart file not found` + "`" + `, ` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "` + "`" + `chart changed concurrently, retry` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "` + "`" + `invalid HCL configuration` + "`" + `, ` + "`" + `commit rejected by policy` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "423": {
+                        "description": "` + "`" + `chart_locked` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to format chart files` + "`" + `, ` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/history": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the commits reachable from a ref, newest first, with the paths each commit changed.",
+                "tags": [
+                    "chart"
+                ],
+                "summary": "List chart history",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Git ref (defaults to HEAD)",
+                        "name": "ref",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of commits to skip",
+                        "name": "offset",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of commits (default 50, max 200)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated commit fields to return, such as hash,timestamp",
+                        "name": "fields",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartHistoryResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid pagination` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart not found` + "`" + `, ` + "`" + `chart ref not found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to read chart history` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/lock": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the lock held on the chart, or 404 when the chart isn't locked.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Get chart lock",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartLock"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `not_locked` + "`" + `, ` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Freezes the chart: until the lock expires or is released, commits through the API, git pushes, deploys and deletion of the chart are refused with 423 for every user but the one who took the lock. Taking a lock you already hold replaces it, which extends it.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Lock chart",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Lock holder, reason and lifetime",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartLockRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartLock"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid_request` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "423": {
+                        "description": "` + "`" + `chart_locked` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Releases the chart lock. Only the user who took the lock and chart admins can release it.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Unlock chart",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartLock"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `not_locked` + "`" + `, ` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/merge": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Merges the source branch into the target branch with a merge commit. Files changed on one branch only since the merge base are taken from that branch, and text files both branches changed are merged line by line. When changes can't be merged the merge is not made and the conflicting paths are returned with the blob hash of the base and of each side, and for text files the conflicting hunks. Retrying with resolutions mapping every conflicting path to its resolved content, or null to delete it, completes the merge.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Merge chart branches",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Source and target branch names and optional commit message",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.chartMergeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartMergeResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid request body` + "`" + `, ` + "`" + `source and target required` + "`" + `, ` + "`" + `source and target must differ` + "`" + `, ` + "`" + `resolution for a path without conflict` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart not found` + "`" + `, ` + "`" + `chart branch not found` + "`" + `, ` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "` + "`" + `source branch already merged` + "`" + `, ` + "`" + `merge conflicts` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartMergeConflictResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "` + "`" + `commit rejected by policy` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "423": {
+                        "description": "` + "`" + `chart_locked` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to merge chart branches` + "`" + `, ` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/pending-changes": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Compares a ref with the commit of the last successful deploy of every stack in every environment, answering what deploying the ref would change. The root module is reported with an empty stack, and deploys without an environment with an empty environment. With watch and the X-Watch-Cursor of the last response in since, the request waits until the chart is deployed or committed to.",
+                "tags": [
+                    "chart"
+                ],
+                "summary": "List changes pending deploy",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Git ref to deploy (defaults to HEAD)",
+                        "name": "ref",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only compare against this stack",
+                        "name": "stack",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only compare against deploys to this environment",
+                        "name": "environment",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Wait up to 30 seconds for a change when since is the current cursor",
+                        "name": "watch",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "X-Watch-Cursor of the last response",
+                        "name": "since",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartPendingChangesResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `stack was never deployed` + "`" + `, ` + "`" + `environment was never deployed` + "`" + `, ` + "`" + `chart not found` + "`" + `, ` + "`" + `chart ref not found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to compare chart` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/permissions": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the destroy rules of the chart and the users who may change them.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Get chart permissions",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartPermissions"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Replaces the chart permissions. Rules apply to the deploys of their stack, or of every module with \"*\", and with environment only to deploys to that environment. Deploys to a stack with a destroy rule are blocked by the mandatory \"destroy\" policy when their plan deletes or replaces resources and the deploying user is not allowed; overridePolicies can't lift it. Deploys to a stack with an approval rule pause as awaiting_approval once planned, until POST /api/deploy/{id}/approve by one of the approvers, or by anyone without approvers; with separateApprover the deploying user can't approve their own deploy. Sandbox and plan-only deploys need no approval. Only admins can change the destroy and approval rules, so a chart without admins has to get them first, and destroy rules can't be saved without admins. Once admins are set only they can change the permissions, and they must stay among them.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Set chart permissions",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Permissions",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.chartPermissions"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartPermissions"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid_request` + "`" + `, ` + "`" + `invalid_permissions` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/presence": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the users with an event stream of the chart open and the file each of them is viewing or editing.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "List chart collaborators",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartPresenceListResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Changes the file the user is viewing or editing, sending a presence event to the event streams of the chart. The user needs an event stream of the chart open, which holds their presence until it closes.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Set the file you are on",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "File the user is on",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.chartPresenceRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartPresence"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid_request` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "` + "`" + `event_stream_required` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/raw": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Streams the bytes of a file in a chart at a ref, with a Content-Type guessed from the file name or content and a Content-Length, instead of wrapping the content in JSON. The ETag is the blob hash, and X-Chart-Ref the commit the file was read from.",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Stream a chart file",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "File path in the chart repo",
+                        "name": "file",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Git ref (defaults to HEAD)",
+                        "name": "ref",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 timestamp; resolves ref to the commit it pointed to at that time",
+                        "name": "at",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified"
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `file required` + "`" + `, ` + "`" + `at must be an RFC 3339 timestamp` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart not found` + "`" + `, ` + "`" + `chart ref not found` + "`" + `, ` + "`" + `chart file not found` + "`" + `, ` + "`" + `no chart commit at that time` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "` + "`" + `chart path is a symlink` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to read chart file` + "`" + `, ` + "`" + `failed to resolve chart ref` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/required-tags": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the tag keys that resources created or updated by deploys of the chart must carry.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Get chart required tags",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartRequiredTags"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Replaces the required tags. Deploys whose plan creates or updates a resource with a tags_all, tags or labels attribute lacking one of them are blocked, or only flagged when enforcement is \"warn\". Blocked deploys can be forced by listing \"tags\" in overridePolicies.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Set chart required tags",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Required tags",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.chartRequiredTags"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartRequiredTags"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid_request` + "`" + `, ` + "`" + `invalid_required_tags` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Remove chart required tags",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.emptyResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/restore": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Moves a chart out of the trash under its original ID, with its history and settings.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Restore a deleted chart",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart not in trash` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "` + "`" + `chart already exists` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to restore chart` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/revert": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Creates a new commit on the chart branch whose files match the target ref. The history in between is kept. With path, only that file is restored to its version at the target ref.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Revert chart to an earlier commit",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Target ref and optional commit message",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.chartRevertRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartRevertResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid request body` + "`" + `, ` + "`" + `ref required` + "`" + `, ` + "`" + `invalid file path` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart not found` + "`" + `, ` + "`" + `chart ref not found` + "`" + `, ` + "`" + `chart file not found` + "`" + `, ` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "` + "`" + `chart already matches ref` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "` + "`" + `commit rejected by policy` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "423": {
+                        "description": "` + "`" + `chart_locked` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to revert chart` + "`" + `, ` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/rollback": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Deploys the commit of the last successful deploy of the chart root module, or of a stack, in the environment, or without one, before its latest deploy attempt, or before deployId. Sandbox and plan runs are not considered. The deploy is queued and answered like POST /api/deploy, also with wait=true.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "deploy"
+                ],
+                "summary": "Roll back a chart",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Rollback request",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartRollbackRequest"
+                        }
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Block until the deploy finished and return its result",
+                        "name": "wait",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated deploy fields to return with wait, such as status,exitCode",
+                        "name": "fields",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.deployResponse"
+                        }
+                    },
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/server.deployJobResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid_request` + "`" + `, ` + "`" + `invalid_pipeline` + "`" + `, ` + "`" + `invalid_owners` + "`" + `, ` + "`" + `deploy_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `, ` + "`" + `ssh_key_required` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `, ` + "`" + `deploy_not_found` + "`" + `, ` + "`" + `rollback_target_not_found` + "`" + `, ` + "`" + `ref_not_found` + "`" + `, ` + "`" + `deploy_failed` + "`" + `, ` + "`" + `ssh_public_key_not_found` + "`" + `, ` + "`" + `secret_not_found` + "`" + `, ` + "`" + `environment_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "` + "`" + `chart_busy` + "`" + `, ` + "`" + `chart_archived` + "`" + `, ` + "`" + `deploy_account_unavailable` + "`" + `, ` + "`" + `deploy_canceled` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "` + "`" + `unsafe_tree` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "423": {
+                        "description": "` + "`" + `chart_locked` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `, ` + "`" + `pipeline_load_failed` + "`" + `, ` + "`" + `ref_resolve_failed` + "`" + `, ` + "`" + `policy_load_failed` + "`" + `, ` + "`" + `owners_load_failed` + "`" + `, ` + "`" + `run_task_load_failed` + "`" + `, ` + "`" + `deploy_failed` + "`" + `, ` + "`" + `service_account_load_failed` + "`" + `, ` + "`" + `key_load_failed` + "`" + `, ` + "`" + `state_failed` + "`" + `, ` + "`" + `secrets_load_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "` + "`" + `deploy_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "` + "`" + `deploy_timed_out` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/run-tasks": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the external services deploys of the chart wait on. Secrets are not included.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Get chart run tasks",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartRunTasks"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Replaces the chart run tasks. Once the stage a task follows finished, deploys pause and POST a runTaskPayload with the plan (when planned) to the task URL, signed with the secret in X-Planemgr-Signature like webhook deliveries. The task answers by POSTing a runTaskCallback to callbackUrl with accessToken as the Authorization header. Deploys fail when a task reports \"failed\" or doesn't answer within its timeout, unless enforcement is \"warn\". A task keeps its secret when it is omitted. Once chart admins are set only they can change run tasks.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Set chart run tasks",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Run tasks",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.chartRunTasks"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartRunTasks"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid_request` + "`" + `, ` + "`" + `invalid_run_task` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/schedules": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the schedules deploying the chart, with when they run next and how their last run started.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "List chart schedules",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartSchedulesResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Plans or deploys a ref of the chart, or of one of its stacks, in an environment of the chart or without one, whenever the cron expression matches: five fields (minute, hour, day of month, month, day of week) or a macro such as @daily, in the timezone, UTC by default. Runs are queued like deploys requested by the creator of the schedule and appear in the deploy history; plan runs stop after the plan and policy stages and don't change the last deployment. A run missed while the server was down starts once when it is back. Runs of service accounts use their stored credentials. Runs of users need their session, so they fail while the user is logged out; the reason is kept as lastError.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Create chart schedule",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Schedule",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.chartScheduleRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartSchedule"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid_request` + "`" + `, ` + "`" + `invalid_schedule` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `, ` + "`" + `environment_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "` + "`" + `chart_archived` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/schedules/{scheduleId}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Stops the schedule. Runs it already started keep running.",
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Delete chart schedule",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Schedule ID",
+                        "name": "scheduleId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.emptyResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `schedule_not_found` + "`" + `, ` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/schema": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the ` + "`" + `tofu providers schema -json` + "`" + ` document of a chart module for editor completion and validation. Schemas are generated in the runner on first use and cached until the module lock file changes.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Get provider schemas",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Git ref (defaults to HEAD)",
+                        "name": "ref",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Stack directory (defaults to the root module)",
+                        "name": "stack",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Regenerate the schemas even if cached",
+                        "name": "refresh",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartSchema"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid_request` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `, ` + "`" + `ssh_key_required` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `, ` + "`" + `ref_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `key_load_failed` + "`" + `, ` + "`" + `schema_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "` + "`" + `schema_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/secrets": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the secrets deploys of the chart export to their runner, by environment variable.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Get chart secret environment",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartSecretEnv"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Replaces the secrets deploys of the chart export to their runner. Secrets are looked up by name in the secret store of the chart deploy account when it is bound to one, or else of the user deploying, and deploys fail with secret_not_found when it lacks one. Values are masked in the deploy output. Sandbox deploys get no secrets. Variables mapped for an environment override those mapped for every environment in deploys to it. Once chart admins are set only they can change the secret environment.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Set chart secret environment",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Secret environment",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.chartSecretEnv"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartSecretEnv"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid_request` + "`" + `, ` + "`" + `invalid_secret` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/squash": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Replaces the history of the chart branch before the cutoff with a single baseline commit holding the content of the newest commit before it, then prunes the removed objects. Commits that branches, tags or the last deploy of a stack point to are kept on top of the baseline. Later commits keep their content, author and message but get new hashes; branches, tags and recorded deploys are moved to them. With dryRun only the number of commits that would be squashed is returned, and baseline is the commit that would be squashed into. The baseline commit gets message, which defaults to a summary of the squash. Once chart admins are set only they can squash, and deploys of the chart can't run meanwhile.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Squash old chart history",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Cutoff",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.chartSquashRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartSquashResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid_request` + "`" + `, ` + "`" + `nothing_to_squash` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "` + "`" + `deploy_in_progress` + "`" + `, ` + "`" + `history_changed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "` + "`" + `commit rejected by policy` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "423": {
+                        "description": "` + "`" + `chart_locked` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `squash_failed` + "`" + `, ` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/stack/{name}/deploy": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Deploys a single stack (a root module in a top-level subdirectory of the chart) like POST /api/deploy deploys the chart root module, taking the same request fields but the chart ID from the path. Each stack has its own deploy queue, and its managed state and last deployment are its own.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "deploy"
+                ],
+                "summary": "Deploy a chart stack",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Stack name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Deploy request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.stackDeployRequest"
+                        }
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Block until the deploy finished and return its result",
+                        "name": "wait",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated deploy fields to return with wait, such as status,exitCode",
+                        "name": "fields",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.deployResponse"
+                        }
+                    },
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/server.deployJobResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid_request` + "`" + `, ` + "`" + `invalid_pipeline` + "`" + `, ` + "`" + `invalid_owners` + "`" + `, ` + "`" + `invalid_strategy` + "`" + `, ` + "`" + `deploy_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `, ` + "`" + `ssh_key_required` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `, ` + "`" + `ref_not_found` + "`" + `, ` + "`" + `deploy_failed` + "`" + `, ` + "`" + `ssh_public_key_not_found` + "`" + `, ` + "`" + `secret_not_found` + "`" + `, ` + "`" + `environment_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "` + "`" + `chart_busy` + "`" + `, ` + "`" + `chart_archived` + "`" + `, ` + "`" + `deploy_account_unavailable` + "`" + `, ` + "`" + `deploy_canceled` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "` + "`" + `unsafe_tree` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "423": {
+                        "description": "` + "`" + `chart_locked` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `pipeline_load_failed` + "`" + `, ` + "`" + `chart_settings_failed` + "`" + `, ` + "`" + `ref_resolve_failed` + "`" + `, ` + "`" + `policy_load_failed` + "`" + `, ` + "`" + `owners_load_failed` + "`" + `, ` + "`" + `run_task_load_failed` + "`" + `, ` + "`" + `deploy_failed` + "`" + `, ` + "`" + `service_account_load_failed` + "`" + `, ` + "`" + `key_load_failed` + "`" + `, ` + "`" + `state_failed` + "`" + `, ` + "`" + `secrets_load_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "` + "`" + `deploy_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "` + "`" + `deploy_timed_out` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/stack/{name}/state": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Serves the OpenTofu state of a stack as an http state backend, like the state of the chart root module.",
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Managed OpenTofu state of a stack",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Stack directory name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Chart environment, the state of deploys without one when empty",
+                        "name": "environment",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "raw",
+                            "resources"
+                        ],
+                        "type": "string",
+                        "description": "On GET, resources for an inventory of the state or raw to download it",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "The state, or its inventory with format=resources",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartStateInventory"
+                        }
+                    },
+                    "204": {
+                        "description": "No state was stored yet"
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid_request` + "`" + `, ` + "`" + `invalid_state` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Lock info of the holder when unlocking with another lock ID",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "413": {
+                        "description": "` + "`" + `state_too_large` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "` + "`" + `invalid_state` + "`" + ` when the state can't be listed",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "423": {
+                        "description": "Lock info of the holder",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `state_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/stack/{name}/state/versions": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Lists the kept versions of the OpenTofu state of a stack, newest first, like those of the chart root module.",
+                "tags": [
+                    "chart"
+                ],
+                "summary": "List state versions of a stack",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Stack directory name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Chart environment, the state of deploys without one when empty",
+                        "name": "environment",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartStateVersionsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid_request` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `state_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/stack/{name}/state/versions/{version}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns a kept version of the OpenTofu state of a stack.",
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Get a state version of a stack",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Stack directory name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Chart environment, the state of deploys without one when empty",
+                        "name": "environment",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "State version",
+                        "name": "version",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid_request` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `, ` + "`" + `state_version_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `state_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/state": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Serves the OpenTofu state of the chart root module as an http state backend. Deploys of modules without a backend of their own use it with credentials valid while they run; users can point tofu at it with the username access and an access token as password. GET returns the state, or 204 before the first apply, with format=resources an inventory of its resources and outputs without sensitive values, and with format=raw the state as a file to download; POST replaces it; DELETE removes it. LOCK and UNLOCK take and release the state lock with the lock info of tofu, answering 423 with the current lock info while another holder has it. Each environment of the chart has a state of its own, addressed with environment. Locks are lost when the server restarts.",
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Managed OpenTofu state of a chart",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Chart environment, the state of deploys without one when empty",
+                        "name": "environment",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "raw",
+                            "resources"
+                        ],
+                        "type": "string",
+                        "description": "On GET, resources for an inventory of the resources and outputs in the state, leaving out sensitive values, or raw to download the state as a file",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "The state, or its inventory with format=resources",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartStateInventory"
+                        }
+                    },
+                    "204": {
+                        "description": "No state was stored yet"
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid_request` + "`" + `, ` + "`" + `invalid_state` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Lock info of the holder when unlocking with another lock ID",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "413": {
+                        "description": "` + "`" + `state_too_large` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "` + "`" + `invalid_state` + "`" + ` when the state can't be listed",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "423": {
+                        "description": "Lock info of the holder",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `state_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/state/import": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Moves a module of the chart, the root module or a stack, from the s3 or http state backend its terraform block configures to the managed state: the state is pulled from the backend and stored as the managed state of the module in the environment, then the backend block is removed in a commit to the chart branch, so later deploys use the managed state. The backend block settings set to literals are used; the s3 or http fields of the request complete them and carry the credentials, which are not stored. With dryRun the backend is only read and reported. A managed state stored already is only replaced with replace. The state is left in the backend.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Import state from the backend of a module",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Module, backend settings and credentials",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.chartStateImportRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartStateImportResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid_request` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `, ` + "`" + `backend_not_found` + "`" + `, ` + "`" + `environment_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "` + "`" + `state_exists` + "`" + `, ` + "`" + `history_changed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "` + "`" + `state_too_large` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "` + "`" + `unsupported_backend` + "`" + `, ` + "`" + `invalid_state` + "`" + `, ` + "`" + `commit rejected by policy` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "423": {
+                        "description": "` + "`" + `chart_locked` + "`" + `, ` + "`" + `state_locked` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `state_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "` + "`" + `state_pull_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/state/versions": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Lists the kept versions of the OpenTofu state of the chart root module, newest first. Every state written is kept as a version, the newest being the current state, up to the last 50; removing the state keeps them. Push a version back with tofu state push to roll back.",
+                "tags": [
+                    "chart"
+                ],
+                "summary": "List state versions of a chart",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Chart environment, the state of deploys without one when empty",
+                        "name": "environment",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartStateVersionsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `state_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/state/versions/{version}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns a kept version of the OpenTofu state of the chart root module.",
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Get a state version of a chart",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Chart environment, the state of deploys without one when empty",
+                        "name": "environment",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "State version",
+                        "name": "version",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid_request` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `, ` + "`" + `state_version_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `state_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/tags": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the tags of a chart sorted by name, with the commit each one points to.",
+                "tags": [
+                    "chart"
+                ],
+                "summary": "List chart tags",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartTagsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid tag name` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart not found` + "`" + `, ` + "`" + `chart ref not found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "` + "`" + `chart tag already exists` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to tag chart` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Creates an annotated tag on a chart commit to mark a release. Tags can be used as the ref of deploys.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Create chart tag",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Tag name, target ref (defaults to HEAD) and annotation",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.chartTagRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartTag"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid request body` + "`" + `, ` + "`" + `invalid tag name` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart not found` + "`" + `, ` + "`" + `chart ref not found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "` + "`" + `chart tag already exists` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to tag chart` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/vulnerabilities": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the findings of the last scan of the provider versions pinned in the chart lock files against the OSV advisory database, most severe first.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Get chart vulnerabilities",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartVulnerabilityReport"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `not_scanned` + "`" + `, ` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Scans the lock files at HEAD right away instead of waiting for the periodic scan, and stores the result.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Scan chart vulnerabilities",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartVulnerabilityReport"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `chart_settings_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/webhooks": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the webhooks notified of chart commits. Secrets are not included.",
+                "tags": [
+                    "chart"
+                ],
+                "summary": "List chart webhooks",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartWebhooksResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart not found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to update chart webhooks` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Registers a URL that receives a POST for every commit written to the chart, with the chart ID, commit hash, message and changed paths. Deliveries are signed with the secret, which is generated when omitted and only returned in this response: X-Planemgr-Signature holds \"sha256=\" and the hex HMAC-SHA256 of the X-Planemgr-Delivery ID and the X-Planemgr-Timestamp Unix time, each followed by a newline, and the body. Receivers should refuse deliveries older than five minutes and IDs they already saw, so a captured delivery can't be replayed.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Create chart webhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Webhook",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.chartWebhookRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/server.chartWebhook"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid request body` + "`" + `, ` + "`" + `invalid webhook url` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart not found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to generate webhook secret` + "`" + `, ` + "`" + `failed to update chart webhooks` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chart/{id}/webhooks/{webhookId}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "Delete chart webhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Webhook ID",
+                        "name": "webhookId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.emptyResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `webhook not found` + "`" + `, ` + "`" + `chart not found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `failed to update chart webhooks` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/deploy": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Runs tofu verify and tofu apply for a git ref (branch, tag or commit hash, the branch of the environment or the chart default branch when empty) using the configured runner image. With environment, the deploy targets that environment of the chart: tofu gets its variables as variables, and its managed state, deploy queue and last deployment are its own. Plans deleting resources are blocked when the chart permissions don't allow the user to destroy in the module. With sandbox set, an emulator (localstack unless SANDBOX_IMAGE is set) is started alongside the runner and the providers are pointed at it instead of real cloud accounts; sandbox deploys aren't recorded as the last deployment. serviceAddress picks another host:port the runner reaches the server at, the detected one or one listed in SERVICE_ADDRESS_ALLOWLIST, instead of SERVICE_ADDRESS. Deploys of a stack run one at a time in the order they were requested, and server-side runners are capped at MAX_CONCURRENT_DEPLOYS; later deploys are queued, and the chart is resolved to a commit when the deploy is requested. Queued deploys clone the chart with the access token of the request, so they fail when they wait longer than it lives. The deploy runs in the background: the response is 202 with the deploy ID, its queue position while queued, and a Location to poll for the result at GET /api/deploy/{id}. With wait=true the request blocks until the deploy finished and returns its result instead. Deploys running longer than timeoutSeconds, or DEPLOY_TIMEOUT (an hour by default), have their runner stopped and removed and end as timed_out. With requireApproval, or an approval rule for the module in the chart permissions, the deploy pauses as awaiting_approval once planned and its policies passed, keeping its runner and its place in the queue, until POST /api/deploy/{id}/approve lets it apply the plan or POST /api/deploy/{id}/reject fails it; the wait counts toward the timeout. With destroy, the plan and the apply tear the module down instead, which then no longer counts as deployed. With strategy, the module is rolled out to the idle one of a pair of environments, green, instead: once green deployed and its checks passed, the switch module is deployed with the planemgr_traffic_* variables sending it each canary weight of the traffic, then all of it, and the live environment, blue, is destroyed unless keepBlue is set. A failed switch is deployed again sending all traffic back to blue. Every step is a deploy of its own, listed under steps while the rollout runs. expiresInSeconds makes the environment ephemeral, like setting its expiresAt, so it is destroyed once it expired.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "deploy"
+                ],
+                "summary": "Deploy a ref",
+                "parameters": [
+                    {
+                        "description": "Deploy request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.deployRequest"
+                        }
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Block until the deploy finished and return its result",
+                        "name": "wait",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated deploy fields to return with wait, such as status,exitCode",
+                        "name": "fields",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.deployResponse"
+                        }
+                    },
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/server.deployJobResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid_request` + "`" + `, ` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid_pipeline` + "`" + `, ` + "`" + `invalid_owners` + "`" + `, ` + "`" + `invalid_strategy` + "`" + `, ` + "`" + `deploy_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `, ` + "`" + `ssh_key_required` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `chart_not_found` + "`" + `, ` + "`" + `ref_not_found` + "`" + `, ` + "`" + `deploy_failed` + "`" + `, ` + "`" + `ssh_public_key_not_found` + "`" + `, ` + "`" + `secret_not_found` + "`" + `, ` + "`" + `environment_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "` + "`" + `chart_busy` + "`" + `, ` + "`" + `chart_archived` + "`" + `, ` + "`" + `deploy_account_unavailable` + "`" + `, ` + "`" + `deploy_canceled` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "` + "`" + `unsafe_tree` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "423": {
+                        "description": "` + "`" + `chart_locked` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `pipeline_load_failed` + "`" + `, ` + "`" + `chart_settings_failed` + "`" + `, ` + "`" + `ref_resolve_failed` + "`" + `, ` + "`" + `policy_load_failed` + "`" + `, ` + "`" + `owners_load_failed` + "`" + `, ` + "`" + `run_task_load_failed` + "`" + `, ` + "`" + `deploy_failed` + "`" + `, ` + "`" + `service_account_load_failed` + "`" + `, ` + "`" + `key_load_failed` + "`" + `, ` + "`" + `state_failed` + "`" + `, ` + "`" + `secrets_load_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "` + "`" + `deploy_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "` + "`" + `deploy_timed_out` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/deploy/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the status of a deploy started by the user, queued with its position until it starts, running until it finishes, then the result or the error it failed with. Results are kept for 24 hours after the deploy finished and are lost when the server restarts.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "deploy"
+                ],
+                "summary": "Get deploy status",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Deploy ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.deployJobResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `deploy_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Cancels a queued or running deploy of the user: queued deploys leave the queue, running ones have their runner container stopped and removed, and the deploy is recorded as canceled. Resources tofu already changed stay changed. Deploys already claimed by an agent keep running on the agent; only queued ones are withdrawn. Answers once the runner was removed, or with 202 while it is still stopping after 30 seconds.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "deploy"
+                ],
+                "summary": "Cancel a deploy",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Deploy ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.deployJobResponse"
+                        }
+                    },
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/server.deployJobResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `deploy_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "` + "`" + `deploy_finished` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/deploy/{id}/approve": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Lets a deploy awaiting approval apply the plan it made. The chart approval rules of the deployed stack decide who may approve; deploys that requested an approval themselves can be approved by anyone. Deploys changing paths the OWNERS file of the chart assigns to others also need one of the owners of each set of paths listed in awaitingOwners to approve, signing them off; an approval leaves the deploy waiting until every sign-off is in. The decision is reported among the runTasks of the deploy result as \"approval\".",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "deploy"
+                ],
+                "summary": "Approve a deploy",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Deploy ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Approval",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/server.deployApprovalRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.deployApprovalResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid_request` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `approval_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "` + "`" + `approval_decided` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/deploy/{id}/plan": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the plan, as printed by ` + "`" + `tofu show -json` + "`" + `, a deploy awaiting approval applies once approved. The user who started the deploy, the users who may approve it and the owners of the paths it changes can read it.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "deploy"
+                ],
+                "summary": "Get the plan of a deploy awaiting approval",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Deploy ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `approval_not_found` + "`" + `, ` + "`" + `plan_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/deploy/{id}/reject": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Fails a deploy awaiting approval without applying its plan. Users who may approve the deploy may reject it, as may the owners of changed paths who didn't sign them off yet.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "deploy"
+                ],
+                "summary": "Reject a deploy",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Deploy ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Rejection",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/server.deployApprovalRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.deployApprovalResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid_request` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `approval_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "` + "`" + `approval_decided` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/health": {
+            "get": {
+                "description": "Returns the API status.",
+                "tags": [
+                    "health"
+                ],
+                "summary": "Health check",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.healthResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/metrics": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the server metrics in expvar format, including packs, objects and bytes served by git upload-pack and a negotiation duration histogram per chart, and the concurrent upload-pack cap with the sessions active, waiting and rejected, a histogram of the time waited for a slot, and the active sessions with those ended by the session sweeper per reason.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Server metrics",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/replication/chart": {
+            "get": {
+                "description": "Lists the charts a standby holds, for the instance replicating to it to delete those it no longer has. Only instances with REPLICATION_SECRET and without a STANDBY_URL of their own answer, to requests signed with the secret in X-Planemgr-Signature as \"sha256=\" and the hex HMAC-SHA256 of the method, route and X-Planemgr-Timestamp, each followed by a newline, and the body.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "replication"
+                ],
+                "summary": "List replicated charts",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Request signature",
+                        "name": "X-Planemgr-Signature",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Unix time of the request",
+                        "name": "X-Planemgr-Timestamp",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.replicationChartsResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `invalid_signature` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `replication_disabled` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `replication_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/replication/chart/{id}": {
+            "put": {
+                "description": "PUT replaces the chart on a standby with the tar.gz archive of the chart directory in the body, holding its history, metadata and state, with secrets and state sealed with REPLICATION_SECRET. DELETE removes the chart. Requests are signed as for GET /api/replication/chart, and those older than the last one applied to the chart or five minutes off are refused.",
+                "consumes": [
+                    "application/gzip"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "replication"
+                ],
+                "summary": "Replicate a chart",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Request signature",
+                        "name": "X-Planemgr-Signature",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Unix time of the request",
+                        "name": "X-Planemgr-Timestamp",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid_replica` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `invalid_signature` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `replication_disabled` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "` + "`" + `replica_outdated` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `replication_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "PUT replaces the chart on a standby with the tar.gz archive of the chart directory in the body, holding its history, metadata and state, with secrets and state sealed with REPLICATION_SECRET. DELETE removes the chart. Requests are signed as for GET /api/replication/chart, and those older than the last one applied to the chart or five minutes off are refused.",
+                "consumes": [
+                    "application/gzip"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "replication"
+                ],
+                "summary": "Replicate a chart",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Chart ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Request signature",
+                        "name": "X-Planemgr-Signature",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Unix time of the request",
+                        "name": "X-Planemgr-Timestamp",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid chart id` + "`" + `, ` + "`" + `invalid_replica` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `invalid_signature` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `replication_disabled` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "` + "`" + `replica_outdated` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `replication_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/run-tasks/{id}": {
+            "post": {
+                "description": "Completes a run task delivery. The Authorization header must hold the accessToken of the delivery instead of a user token.",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "deploy"
+                ],
+                "summary": "Report a run task result",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Run task delivery ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Run task result",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.runTaskCallback"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid_request` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `run_task_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/runner/image-scan": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the latest trivy vulnerability report of the runner image, with counts per severity.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "runner"
+                ],
+                "summary": "Get runner image scan",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/deploy.ImageScan"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `not_scanned` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Scans the runner image with trivy right away and returns the report.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "runner"
+                ],
+                "summary": "Scan runner image",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/deploy.ImageScan"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `scan_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/service-account": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Lists the service accounts automation logs in as. Only users can manage service accounts.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "service-account"
+                ],
+                "summary": "List service accounts",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.serviceAccountListResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `service_account_load_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Creates a service account for CI pipelines, schedulers and other automation, so they don't act as a user with the user's keys. The returned secret is shown only once: log in at POST /api/auth with the subject as username and the secret as password. Tokens of the service account only allow what its role bindings grant: viewers read, editors also change charts, deployers also deploy and run agents and admins also export and import the instance; bindings listing charts only apply to the endpoints of those charts, and admin bindings list none. Only instance admins can grant the admin role. Deploying needs an SSH key pair, generated with generateSshKey or given, which is stored encrypted with a key derived from SESSION_SECRET.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "service-account"
+                ],
+                "summary": "Create service account",
+                "parameters": [
+                    {
+                        "description": "Service account",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.serviceAccountRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/server.serviceAccountResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid_request` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "` + "`" + `service_account_exists` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `key_generation_failed` + "`" + `, ` + "`" + `secret_generation_failed` + "`" + `, ` + "`" + `service_account_store_failed` + "`" + `, ` + "`" + `key_store_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/service-account/{name}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "service-account"
+                ],
+                "summary": "Get service account",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Service account name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.serviceAccountResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `service_account_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `service_account_load_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Replaces the description and role bindings of a service account. Tokens already issued keep their bindings until they are refreshed. Only instance admins can grant the admin role.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "service-account"
+                ],
+                "summary": "Update service account",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Service account name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Description and role bindings",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.serviceAccountRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.serviceAccountResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid_request` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `service_account_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `service_account_store_failed` + "`" + `, ` + "`" + `service_account_load_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Deletes a service account with its SSH key pair and logs it out, invalidating its tokens.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "service-account"
+                ],
+                "summary": "Delete service account",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Service account name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.serviceAccountResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `service_account_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `service_account_delete_failed` + "`" + `, ` + "`" + `service_account_load_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns any available user info when the bearer token is valid.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Return user info",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.userInfoResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `ssh_public_key_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `key_load_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Accepts credentials for the single-user setup, optionally storing an SSH keypair or generating one.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Set the user name and password",
+                "parameters": [
+                    {
+                        "description": "User credentials",
+                        "name": "credentials",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.userRegisterRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/server.emptyResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid_request` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "` + "`" + `ssh_keypair_exists` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `key_lookup_failed` + "`" + `, ` + "`" + `key_generation_failed` + "`" + `, ` + "`" + `key_store_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/notifications": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the in-app notifications of the authenticated user, newest first, with the number of unread ones. With watch and the X-Watch-Cursor of the last response in since, the request waits until a notification arrives or is marked read.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "List notifications",
+                "parameters": [
+                    {
+                        "type": "boolean",
+                        "description": "Only return unread notifications",
+                        "name": "unread",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated notification fields to return, such as id,read",
+                        "name": "fields",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Wait up to 30 seconds for a change when since is the current cursor",
+                        "name": "watch",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "X-Watch-Cursor of the last response",
+                        "name": "since",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.userNotificationsResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `notifications_load_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/notifications/read": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Marks the listed notifications as read, or all of them when no ids are given.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Mark notifications as read",
+                "parameters": [
+                    {
+                        "description": "Notification ids",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/server.userNotificationsReadRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.userNotificationsReadResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid_request` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `notifications_store_failed` + "`" + `, ` + "`" + `notifications_load_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/preferences": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the preferences stored for the authenticated user, empty when none were saved yet.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Get user preferences",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.userPreferences"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `preferences_load_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Replaces the preferences stored for the authenticated user.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Set user preferences",
+                "parameters": [
+                    {
+                        "description": "User preferences",
+                        "name": "preferences",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.userPreferences"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.userPreferences"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid_request` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `preferences_store_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/secrets": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Lists the secrets of the authenticated user or service account, without their values.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "List secrets",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.userSecretsResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `secrets_load_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/secrets/{name}": {
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Creates or replaces a secret of the authenticated user or service account. Values are encrypted with a key derived from SESSION_SECRET, hold up to 64 KiB and are never returned; deploys inject them into the runner environment as the chart or the deploy request maps them.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Set a secret",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Secret name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Secret value",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.userSecretRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.Secret"
+                        }
+                    },
+                    "400": {
+                        "description": "` + "`" + `invalid_request` + "`" + `, ` + "`" + `invalid_secret` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `secret_store_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Deletes a secret of the authenticated user or service account. Deploys still referencing it fail until it is set again.",
+                "tags": [
+                    "user"
+                ],
+                "summary": "Delete a secret",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Secret name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "401": {
+                        "description": "` + "`" + `unauthorized` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "` + "`" + `forbidden` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "` + "`" + `secret_not_found` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "` + "`" + `secret_store_failed` + "`" + `",
+                        "schema": {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "auth.RoleBinding": {
+            "type": "object",
+            "properties": {
+                "charts": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "3fa85f64-5717-4562-b3fc-2c963f66afa6"
+                    ]
+                },
+                "role": {
+                    "type": "string",
+                    "enum": [
+                        "viewer",
+                        "editor",
+                        "deployer",
+                        "admin"
+                    ]
+                }
+            }
+        },
+        "chart.ChartStateVersion": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                },
+                "version": {
+                    "type": "integer",
+                    "example": 3
+                }
+            }
+        },
+        "deploy.Budget": {
+            "type": "object",
+            "properties": {
+                "enforcement": {
+                    "type": "string"
+                },
+                "maxMonthlyCost": {
+                    "type": "number"
+                },
+                "maxResources": {
+                    "type": "integer"
+                },
+                "unitCosts": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "number"
+                    }
+                }
+            }
+        },
+        "deploy.Check": {
+            "type": "object",
+            "properties": {
+                "http": {
+                    "$ref": "#/definitions/deploy.HTTPProbe"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "run": {
+                    "type": "string"
+                }
+            }
+        },
+        "deploy.Diagnostic": {
+            "type": "object",
+            "properties": {
+                "detail": {
+                    "type": "string"
+                },
+                "range": {
+                    "$ref": "#/definitions/deploy.DiagnosticRange"
+                },
+                "severity": {
+                    "type": "string"
+                },
+                "summary": {
+                    "type": "string"
+                }
+            }
+        },
+        "deploy.DiagnosticRange": {
+            "type": "object",
+            "properties": {
+                "endColumn": {
+                    "type": "integer"
+                },
+                "endLine": {
+                    "type": "integer"
+                },
+                "path": {
+                    "type": "string"
+                },
+                "startColumn": {
+                    "type": "integer"
+                },
+                "startLine": {
+                    "type": "integer"
+                }
+            }
+        },
+        "deploy.GateInput": {
+            "type": "object",
+            "properties": {
+                "plan": {
+                    "description": "Plan is the ` + "`" + `tofu show -json` + "`" + ` output, when the plan stage already ran.",
+                    "type": "object"
+                },
+                "stage": {
+                    "type": "string"
+                }
+            }
+        },
+        "deploy.HTTPProbe": {
+            "type": "object",
+            "properties": {
+                "contains": {
+                    "type": "string"
+                },
+                "expectStatus": {
+                    "type": "integer"
+                },
+                "method": {
+                    "type": "string"
+                },
+                "timeoutSeconds": {
+                    "type": "integer"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "deploy.ImageScan": {
+            "type": "object",
+            "properties": {
+                "counts": {
+                    "description": "Vulnerabilities per severity",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                },
+                "image": {
+                    "type": "string"
+                },
+                "scannedAt": {
+                    "type": "string"
+                },
+                "vulnerabilities": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/deploy.ImageVulnerability"
+                    }
+                }
+            }
+        },
+        "deploy.ImageVulnerability": {
+            "type": "object",
+            "properties": {
+                "fixedVersion": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "installedVersion": {
+                    "type": "string"
+                },
+                "package": {
+                    "type": "string"
+                },
+                "severity": {
+                    "type": "string"
+                },
+                "title": {
+                    "type": "string"
+                }
+            }
+        },
+        "deploy.Job": {
+            "type": "object",
+            "properties": {
+                "budget": {
+                    "$ref": "#/definitions/deploy.Budget"
+                },
+                "chartId": {
+                    "type": "string"
+                },
+                "commit": {
+                    "type": "string"
+                },
+                "denyDestroy": {
+                    "type": "boolean"
+                },
+                "deployId": {
+                    "type": "string"
+                },
+                "environment": {
+                    "type": "string"
+                },
+                "gates": {
+                    "description": "Gates are the stages the agent pauses after, asking the server for\nthe verdict.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "id": {
+                    "type": "string"
+                },
+                "overridePolicies": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "pipeline": {
+                    "$ref": "#/definitions/deploy.Pipeline"
+                },
+                "privateKey": {
+                    "type": "string"
+                },
+                "publicKey": {
+                    "type": "string"
+                },
+                "ref": {
+                    "type": "string"
+                },
+                "requiredTags": {
+                    "$ref": "#/definitions/deploy.RequiredTags"
+                },
+                "runnerImageMaxCritical": {
+                    "type": "integer"
+                },
+                "sandbox": {
+                    "$ref": "#/definitions/deploy.Sandbox"
+                },
+                "secrets": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "serviceUrl": {
+                    "description": "Overrides the agent's server URL",
+                    "type": "string"
+                },
+                "stack": {
+                    "type": "string"
+                },
+                "state": {
+                    "$ref": "#/definitions/deploy.StateBackend"
+                },
+                "subject": {
+                    "type": "string"
+                },
+                "timeoutSeconds": {
+                    "type": "integer"
+                },
+                "token": {
+                    "type": "string"
+                },
+                "traffic": {
+                    "$ref": "#/definitions/deploy.Traffic"
+                },
+                "variables": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "deploy.JobResult": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "kind": {
+                    "description": "Kind is the message of the deploy error the failure wraps, so the\nserver can tell failed checks and invalid requests apart.",
+                    "type": "string"
+                },
+                "result": {
+                    "$ref": "#/definitions/deploy.Result"
+                }
+            }
+        },
+        "deploy.Pipeline": {
+            "type": "object",
+            "properties": {
+                "checks": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/deploy.Check"
+                    }
+                },
+                "onCheckFailure": {
+                    "type": "string"
+                },
+                "stages": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/deploy.Stage"
+                    }
+                }
+            }
+        },
+        "deploy.PolicyResult": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "outcome": {
+                    "type": "string"
+                }
+            }
+        },
+        "deploy.RequiredTags": {
+            "type": "object",
+            "properties": {
+                "enforcement": {
+                    "type": "string"
+                },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "deploy.Result": {
+            "type": "object",
+            "properties": {
+                "exitCode": {
+                    "type": "integer"
+                },
+                "gates": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/deploy.PolicyResult"
+                    }
+                },
+                "output": {
+                    "type": "string"
+                },
+                "policies": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/deploy.PolicyResult"
+                    }
+                },
+                "runnerImage": {
+                    "type": "string"
+                },
+                "stages": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/deploy.StageResult"
+                    }
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "deploy.Sandbox": {
+            "type": "object",
+            "properties": {
+                "env": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "image": {
+                    "type": "string"
+                }
+            }
+        },
+        "deploy.Stage": {
+            "type": "object",
+            "properties": {
+                "check": {
+                    "description": "Post-deploy check; failures don't abort the pipeline",
+                    "type": "boolean"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "run": {
+                    "description": "Empty for placeholder stages, which are reported as skipped",
+                    "type": "string"
+                },
+                "skip": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "deploy.StageResult": {
+            "type": "object",
+            "properties": {
+                "check": {
+                    "type": "boolean"
+                },
+                "diagnostics": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/deploy.Diagnostic"
+                    }
+                },
+                "exitCode": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "output": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "deploy.StateBackend": {
+            "type": "object",
+            "properties": {
+                "password": {
+                    "type": "string"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "deploy.Traffic": {
+            "type": "object",
+            "properties": {
+                "blue": {
+                    "description": "Environment serving before the rollout",
+                    "type": "string"
+                },
+                "green": {
+                    "description": "Environment the rollout deployed",
+                    "type": "string"
+                },
+                "weight": {
+                    "description": "Percentage of the traffic sent to green",
+                    "type": "integer"
+                }
+            }
+        },
+        "server.adminImportResponse": {
+            "type": "object",
+            "properties": {
+                "charts": {
+                    "type": "integer"
+                },
+                "subjects": {
+                    "description": "Users and service accounts",
+                    "type": "integer"
+                },
+                "trashed": {
+                    "type": "integer"
+                }
+            }
+        },
+        "server.agentCapacityResponse": {
+            "type": "object",
+            "properties": {
+                "pools": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.agentPoolResponse"
+                    }
+                },
+                "queues": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.agentQueueResponse"
+                    }
+                }
+            }
+        },
+        "server.agentGateResponse": {
+            "type": "object",
+            "properties": {
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/deploy.PolicyResult"
+                    }
+                }
+            }
+        },
+        "server.agentListResponse": {
+            "type": "object",
+            "properties": {
+                "agents": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.agentResponse"
+                    }
+                }
+            }
+        },
+        "server.agentPoolResponse": {
+            "type": "object",
+            "properties": {
+                "agents": {
+                    "type": "integer"
+                },
+                "available": {
+                    "type": "integer"
+                },
+                "capacity": {
+                    "type": "integer"
+                },
+                "labels": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "running": {
+                    "type": "integer"
+                }
+            }
+        },
+        "server.agentQueueResponse": {
+            "type": "object",
+            "properties": {
+                "available": {
+                    "type": "integer"
+                },
+                "labels": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "oldestQueuedAt": {
+                    "type": "string"
+                },
+                "queued": {
+                    "type": "integer"
+                }
+            }
+        },
+        "server.agentRegisterRequest": {
+            "type": "object",
+            "properties": {
+                "capacity": {
+                    "description": "Defaults to 1",
+                    "type": "integer",
+                    "example": 2
+                },
+                "labels": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "cloud=aws",
+                        "region=eu"
+                    ]
+                },
+                "name": {
+                    "type": "string",
+                    "example": "eu-runner-1"
+                }
+            }
+        },
+        "server.agentResponse": {
+            "type": "object",
+            "properties": {
+                "capacity": {
+                    "type": "integer"
+                },
+                "connected": {
+                    "type": "boolean"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "labels": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "lastSeen": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "registeredAt": {
+                    "type": "string"
+                },
+                "running": {
+                    "type": "integer"
+                }
+            }
+        },
+        "server.approvalRule": {
+            "type": "object",
+            "properties": {
+                "approvers": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "environment": {
+                    "type": "string",
+                    "example": "prod"
+                },
+                "separateApprover": {
+                    "type": "boolean"
+                },
+                "stack": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.authRequest": {
+            "type": "object",
+            "properties": {
+                "password": {
+                    "type": "string",
+                    "example": "correct horse battery staple"
+                },
+                "username": {
+                    "type": "string",
+                    "example": "alice"
+                }
+            }
+        },
+        "server.authResponse": {
+            "type": "object",
+            "properties": {
+                "accessToken": {
+                    "type": "string"
+                },
+                "expiresAt": {
+                    "type": "string",
+                    "example": "2026-01-02T15:04:05Z"
+                },
+                "expiresIn": {
+                    "description": "Seconds until the access token expires",
+                    "type": "integer"
+                },
+                "refreshExpiresAt": {
+                    "type": "string",
+                    "example": "2026-01-09T15:04:05Z"
+                },
+                "refreshExpiresIn": {
+                    "description": "Seconds until the refresh token expires",
+                    "type": "integer"
+                },
+                "refreshToken": {
+                    "type": "string"
+                },
+                "sessionExpiresAt": {
+                    "description": "No refresh extends the session past this",
+                    "type": "string",
+                    "example": "2026-02-01T15:04:05Z"
+                },
+                "tokenType": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartArchiveRequest": {
+            "type": "object",
+            "properties": {
+                "archived": {
+                    "type": "boolean"
+                },
+                "chartIds": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "3fa85f64-5717-4562-b3fc-2c963f66afa6"
+                    ]
+                }
+            }
+        },
+        "server.chartArchiveResponse": {
+            "type": "object",
+            "properties": {
+                "archived": {
+                    "type": "boolean"
+                },
+                "chartIds": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "server.chartBlameLine": {
+            "type": "object",
+            "properties": {
+                "authorEmail": {
+                    "type": "string"
+                },
+                "authorName": {
+                    "type": "string"
+                },
+                "hash": {
+                    "type": "string"
+                },
+                "line": {
+                    "type": "integer"
+                },
+                "summary": {
+                    "type": "string"
+                },
+                "text": {
+                    "type": "string"
+                },
+                "timestamp": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartBlameResponse": {
+            "type": "object",
+            "properties": {
+                "chartId": {
+                    "type": "string"
+                },
+                "lines": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.chartBlameLine"
+                    }
+                },
+                "path": {
+                    "type": "string"
+                },
+                "ref": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartBootstrapRequest": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string",
+                    "example": "team-artifacts"
+                },
+                "project": {
+                    "type": "string",
+                    "example": "my-project"
+                },
+                "provider": {
+                    "type": "string",
+                    "enum": [
+                        "aws",
+                        "gcp",
+                        "azure",
+                        "k8s"
+                    ],
+                    "example": "aws"
+                },
+                "region": {
+                    "type": "string",
+                    "example": "eu-west-1"
+                }
+            }
+        },
+        "server.chartBudget": {
+            "type": "object",
+            "properties": {
+                "enforcement": {
+                    "type": "string"
+                },
+                "maxMonthlyCost": {
+                    "type": "number"
+                },
+                "maxResources": {
+                    "type": "integer"
+                },
+                "unitCosts": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "number"
+                    }
+                }
+            }
+        },
+        "server.chartCherryPickRequest": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string",
+                    "example": "Backport VPC fix"
+                },
+                "ref": {
+                    "type": "string",
+                    "example": "9fceb02d0ae598e95dc970b74767f19372d61af8"
+                }
+            }
+        },
+        "server.chartCherryPickResponse": {
+            "type": "object",
+            "properties": {
+                "chartId": {
+                    "type": "string"
+                },
+                "paths": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "ref": {
+                    "type": "string"
+                },
+                "source": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartCommitFile": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string",
+                    "example": "modified"
+                },
+                "additions": {
+                    "type": "integer"
+                },
+                "binary": {
+                    "type": "boolean"
+                },
+                "deletions": {
+                    "type": "integer"
+                },
+                "oldPath": {
+                    "type": "string"
+                },
+                "path": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartCommitPolicy": {
+            "type": "object",
+            "properties": {
+                "deniedPaths": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "secrets",
+                        "*.tfstate"
+                    ]
+                },
+                "maxFiles": {
+                    "type": "integer",
+                    "example": 20
+                },
+                "messagePattern": {
+                    "type": "string",
+                    "example": "^[A-Z]+-[0-9]+ "
+                },
+                "messagePrefix": {
+                    "type": "string",
+                    "example": "infra: "
+                }
+            }
+        },
+        "server.chartCommitRequest": {
+            "type": "object",
+            "properties": {
+                "expectedRef": {
+                    "description": "ExpectedRef is the commit the branch must still be at, so concurrent\nedits aren't overwritten. The If-Match header can carry it instead.",
+                    "type": "string",
+                    "example": "9fceb02d0ae598e95dc970b74767f19372d61af8"
+                },
+                "files": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.chartFileUpdate"
+                    }
+                },
+                "message": {
+                    "type": "string",
+                    "example": "Add VPC"
+                },
+                "validate": {
+                    "description": "Validate rejects the commit when a written .tf.json file isn't valid\nTerraform JSON configuration, or a .tf or .tfvars file isn't valid HCL.",
+                    "type": "boolean"
+                }
+            }
+        },
+        "server.chartCommitResponse": {
+            "type": "object",
+            "properties": {
+                "chartId": {
+                    "type": "string"
+                },
+                "files": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "ref": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartCommitStats": {
+            "type": "object",
+            "properties": {
+                "additions": {
+                    "type": "integer"
+                },
+                "deletions": {
+                    "type": "integer"
+                },
+                "files": {
+                    "type": "integer"
+                }
+            }
+        },
+        "server.chartCommitSummaryResponse": {
+            "type": "object",
+            "properties": {
+                "authorEmail": {
+                    "type": "string"
+                },
+                "authorName": {
+                    "type": "string"
+                },
+                "chartId": {
+                    "type": "string"
+                },
+                "files": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.chartCommitFile"
+                    }
+                },
+                "hash": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "parents": {
+                    "description": "Files are compared to the first",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "stats": {
+                    "$ref": "#/definitions/server.chartCommitStats"
+                },
+                "timestamp": {
+                    "type": "string",
+                    "example": "2026-01-02T15:04:05Z"
+                }
+            }
+        },
+        "server.chartCopyRequest": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string",
+                    "example": "Share the VPC module"
+                },
+                "paths": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "modules/vpc",
+                        "network.tf.json"
+                    ]
+                },
+                "ref": {
+                    "type": "string",
+                    "example": "main"
+                },
+                "source": {
+                    "type": "string",
+                    "example": "3fa85f64-5717-4562-b3fc-2c963f66afa6"
+                }
+            }
+        },
+        "server.chartCopyResponse": {
+            "type": "object",
+            "properties": {
+                "chartId": {
+                    "type": "string"
+                },
+                "paths": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "ref": {
+                    "type": "string"
+                },
+                "source": {
+                    "description": "Commit the files were read from",
+                    "type": "string"
+                },
+                "sourceChartId": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartDefaultBranch": {
+            "type": "object",
+            "properties": {
+                "branch": {
+                    "type": "string",
+                    "example": "main"
+                }
+            }
+        },
+        "server.chartDeployAccount": {
+            "type": "object",
+            "properties": {
+                "boundAt": {
+                    "type": "string"
+                },
+                "boundBy": {
+                    "type": "string"
+                },
+                "serviceAccount": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartDeployAccountRequest": {
+            "type": "object",
+            "properties": {
+                "serviceAccount": {
+                    "type": "string",
+                    "example": "ci"
+                }
+            }
+        },
+        "server.chartDeployHistoryResponse": {
+            "type": "object",
+            "properties": {
+                "chartId": {
+                    "type": "string"
+                },
+                "deployments": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.chartDeployRun"
+                    }
+                },
+                "limit": {
+                    "type": "integer"
+                },
+                "nextOffset": {
+                    "type": "integer"
+                },
+                "offset": {
+                    "type": "integer"
+                }
+            }
+        },
+        "server.chartDeployRun": {
+            "type": "object",
+            "properties": {
+                "commit": {
+                    "type": "string"
+                },
+                "deployId": {
+                    "type": "string"
+                },
+                "destroy": {
+                    "description": "Tore the module down",
+                    "type": "boolean"
+                },
+                "environment": {
+                    "type": "string"
+                },
+                "error": {
+                    "description": "Why the deploy failed without a result",
+                    "type": "string"
+                },
+                "exitCode": {
+                    "type": "integer"
+                },
+                "finishedAt": {
+                    "type": "string",
+                    "example": "2026-01-02T15:09:05Z"
+                },
+                "output": {
+                    "description": "The end of the runner output",
+                    "type": "string"
+                },
+                "outputTruncated": {
+                    "type": "boolean"
+                },
+                "overriddenPolicies": {
+                    "description": "OverriddenPolicies are the blocking policies, such as the budget, the\nsubject forced the deploy past with overridePolicies.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "budget"
+                    ]
+                },
+                "planOnly": {
+                    "description": "Stopped after the plan",
+                    "type": "boolean"
+                },
+                "ref": {
+                    "type": "string"
+                },
+                "runnerImage": {
+                    "type": "string"
+                },
+                "sandbox": {
+                    "type": "boolean"
+                },
+                "stack": {
+                    "type": "string"
+                },
+                "startedAt": {
+                    "type": "string",
+                    "example": "2026-01-02T15:04:05Z"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "succeeded"
+                },
+                "subject": {
+                    "description": "Who started the deploy",
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartDiffResponse": {
+            "type": "object",
+            "properties": {
+                "chartId": {
+                    "type": "string"
+                },
+                "files": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.chartFileDiff"
+                    }
+                },
+                "from": {
+                    "type": "string"
+                },
+                "summary": {
+                    "$ref": "#/definitions/server.chartDiffSummary"
+                },
+                "to": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartDiffSummary": {
+            "type": "object",
+            "properties": {
+                "added": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "deleted": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "modified": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "server.chartEnvironment": {
+            "type": "object",
+            "properties": {
+                "branch": {
+                    "description": "Deployed when the request names no ref",
+                    "type": "string",
+                    "example": "main"
+                },
+                "expiresAt": {
+                    "description": "ExpiresAt makes the environment ephemeral: once past, every module\ndeployed to it is destroyed and the environment removed.",
+                    "type": "string",
+                    "example": "2026-01-02T15:04:05Z"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "staging"
+                },
+                "variables": {
+                    "description": "Passed to tofu as variables",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "server.chartEnvironmentExtendRequest": {
+            "type": "object",
+            "properties": {
+                "extendSeconds": {
+                    "type": "integer",
+                    "example": 86400
+                }
+            }
+        },
+        "server.chartEnvironments": {
+            "type": "object",
+            "properties": {
+                "environments": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.chartEnvironment"
+                    }
+                }
+            }
+        },
+        "server.chartEvent": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "description": "created, updated, deleted or default on branches and tags, joined, updated or left on presence",
+                    "type": "string",
+                    "example": "created"
+                },
+                "chartId": {
+                    "type": "string"
+                },
+                "commit": {
+                    "type": "string"
+                },
+                "editing": {
+                    "description": "Of presence, whether the user edits the file in paths",
+                    "type": "boolean"
+                },
+                "environment": {
+                    "description": "Of deploys",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "m1x2y3.42"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "paths": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "ref": {
+                    "description": "Branch, tag or deployed ref",
+                    "type": "string",
+                    "example": "main"
+                },
+                "stack": {
+                    "type": "string"
+                },
+                "status": {
+                    "description": "Outcome of deploys",
+                    "type": "string"
+                },
+                "subject": {
+                    "type": "string"
+                },
+                "timestamp": {
+                    "type": "string",
+                    "example": "2026-01-02T15:04:05Z"
+                },
+                "type": {
+                    "description": "commit, branch, tag, deploy or presence",
+                    "type": "string",
+                    "example": "commit"
+                }
+            }
+        },
+        "server.chartFileDiff": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "binary": {
+                    "type": "boolean"
+                },
+                "oldPath": {
+                    "type": "string"
+                },
+                "patch": {
+                    "type": "string"
+                },
+                "path": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartFileResponse": {
+            "type": "object",
+            "properties": {
+                "chartId": {
+                    "type": "string"
+                },
+                "contentType": {
+                    "type": "string",
+                    "example": "application/json"
+                },
+                "contents": {
+                    "type": "string"
+                },
+                "encoding": {
+                    "type": "string",
+                    "enum": [
+                        "base64"
+                    ]
+                },
+                "path": {
+                    "type": "string"
+                },
+                "ref": {
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                }
+            }
+        },
+        "server.chartFileUpdate": {
+            "type": "object",
+            "properties": {
+                "content": {
+                    "type": "string",
+                    "example": "{}"
+                },
+                "delete": {
+                    "type": "boolean"
+                },
+                "encoding": {
+                    "type": "string",
+                    "enum": [
+                        "base64"
+                    ]
+                },
+                "newPath": {
+                    "type": "string",
+                    "example": "vpc.tf.json"
+                },
+                "oldPath": {
+                    "type": "string",
+                    "example": "network.tf.json"
+                },
+                "path": {
+                    "type": "string",
+                    "example": "main.tf.json"
+                }
+            }
+        },
+        "server.chartFilesEntry": {
+            "type": "object",
+            "properties": {
+                "contents": {
+                    "type": "string"
+                },
+                "encoding": {
+                    "type": "string",
+                    "enum": [
+                        "base64"
+                    ]
+                },
+                "hash": {
+                    "description": "Blob hash",
+                    "type": "string"
+                },
+                "path": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartFilesRequest": {
+            "type": "object",
+            "properties": {
+                "paths": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "main.tf.json",
+                        "variables.tf.json"
+                    ]
+                }
+            }
+        },
+        "server.chartFilesResponse": {
+            "type": "object",
+            "properties": {
+                "chartId": {
+                    "type": "string"
+                },
+                "files": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.chartFilesEntry"
+                    }
+                },
+                "missing": {
+                    "description": "Requested paths that aren't files at ref",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "ref": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartFmtRequest": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "description": "Defaults to \"Format HCL files\"",
+                    "type": "string",
+                    "example": "Format HCL files"
+                },
+                "paths": {
+                    "description": "Defaults to every .tf and .tfvars file",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "main.tf",
+                        "variables.tf"
+                    ]
+                }
+            }
+        },
+        "server.chartHistoryCommit": {
+            "type": "object",
+            "properties": {
+                "authorEmail": {
+                    "type": "string"
+                },
+                "authorName": {
+                    "type": "string"
+                },
+                "hash": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "paths": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "timestamp": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartHistoryResponse": {
+            "type": "object",
+            "properties": {
+                "chartId": {
+                    "type": "string"
+                },
+                "commits": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.chartHistoryCommit"
+                    }
+                },
+                "limit": {
+                    "type": "integer"
+                },
+                "nextOffset": {
+                    "type": "integer"
+                },
+                "offset": {
+                    "type": "integer"
+                },
+                "ref": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartHygieneEntry": {
+            "type": "object",
+            "properties": {
+                "chartId": {
+                    "type": "string"
+                },
+                "lastCommitAt": {
+                    "type": "string"
+                },
+                "lastDeployAt": {
+                    "type": "string"
+                },
+                "lastDeployStatus": {
+                    "type": "string"
+                },
+                "reasons": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "server.chartHygieneResponse": {
+            "type": "object",
+            "properties": {
+                "charts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.chartHygieneEntry"
+                    }
+                },
+                "staleDays": {
+                    "type": "integer"
+                }
+            }
+        },
+        "server.chartListEntry": {
+            "type": "object",
+            "properties": {
+                "archived": {
+                    "type": "boolean"
+                },
+                "chartId": {
+                    "type": "string"
+                },
+                "fileCount": {
+                    "type": "integer"
+                },
+                "head": {
+                    "description": "Branch HEAD points at",
+                    "type": "string",
+                    "example": "main"
+                },
+                "lastCommitAt": {
+                    "type": "string",
+                    "example": "2026-01-02T15:04:05Z"
+                },
+                "ref": {
+                    "description": "Commit of the branch, omitted before the first commit",
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartListResponse": {
+            "type": "object",
+            "properties": {
+                "charts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.chartListEntry"
+                    }
+                },
+                "limit": {
+                    "type": "integer"
+                },
+                "nextOffset": {
+                    "type": "integer"
+                },
+                "offset": {
+                    "type": "integer"
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "server.chartLock": {
+            "type": "object",
+            "properties": {
+                "expiresAt": {
+                    "type": "string"
+                },
+                "holder": {
+                    "type": "string"
+                },
+                "lockedAt": {
+                    "type": "string"
+                },
+                "lockedBy": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartLockRequest": {
+            "type": "object",
+            "properties": {
+                "holder": {
+                    "description": "Defaults to the locking user",
+                    "type": "string",
+                    "example": "incident-1234"
+                },
+                "reason": {
+                    "type": "string",
+                    "example": "Network migration"
+                },
+                "ttlSeconds": {
+                    "description": "Defaults to an hour, at most a week",
+                    "type": "integer",
+                    "example": 3600
+                }
+            }
+        },
+        "server.chartMergeConflict": {
+            "type": "object",
+            "properties": {
+                "base": {
+                    "type": "string"
+                },
+                "hunks": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.chartMergeHunk"
+                    }
+                },
+                "kind": {
+                    "type": "string",
+                    "enum": [
+                        "content",
+                        "add/add",
+                        "deleted/source",
+                        "deleted/target",
+                        "directory"
+                    ]
+                },
+                "path": {
+                    "type": "string"
+                },
+                "source": {
+                    "type": "string"
+                },
+                "target": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartMergeConflictResponse": {
+            "type": "object",
+            "properties": {
+                "conflicts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.chartMergeConflict"
+                    }
+                },
+                "error": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartMergeHunk": {
+            "type": "object",
+            "properties": {
+                "base": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "baseStart": {
+                    "description": "First base line replaced, counted from 1",
+                    "type": "integer"
+                },
+                "source": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "target": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "server.chartMergeRequest": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string",
+                    "example": "Merge feature/vpc"
+                },
+                "resolutions": {
+                    "description": "Resolutions maps conflicting paths to the content to commit, or null\nto delete the file.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "source": {
+                    "type": "string",
+                    "example": "feature/vpc"
+                },
+                "target": {
+                    "type": "string",
+                    "example": "main"
+                }
+            }
+        },
+        "server.chartMergeResponse": {
+            "type": "object",
+            "properties": {
+                "chartId": {
+                    "type": "string"
+                },
+                "paths": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "ref": {
+                    "type": "string"
+                },
+                "source": {
+                    "type": "string"
+                },
+                "target": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartPendingChanges": {
+            "type": "object",
+            "properties": {
+                "deployedAt": {
+                    "type": "string"
+                },
+                "deployedCommit": {
+                    "type": "string"
+                },
+                "deployedRef": {
+                    "type": "string"
+                },
+                "environment": {
+                    "type": "string"
+                },
+                "files": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.chartFileDiff"
+                    }
+                },
+                "stack": {
+                    "type": "string"
+                },
+                "summary": {
+                    "$ref": "#/definitions/server.chartDiffSummary"
+                }
+            }
+        },
+        "server.chartPendingChangesResponse": {
+            "type": "object",
+            "properties": {
+                "chartId": {
+                    "type": "string"
+                },
+                "environments": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.chartPendingChanges"
+                    }
+                },
+                "ref": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartPermissions": {
+            "type": "object",
+            "properties": {
+                "admins": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "approval": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.approvalRule"
+                    }
+                },
+                "destroy": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.destroyRule"
+                    }
+                }
+            }
+        },
+        "server.chartPresence": {
+            "type": "object",
+            "properties": {
+                "editing": {
+                    "description": "The user is editing the file rather than viewing it",
+                    "type": "boolean"
+                },
+                "path": {
+                    "description": "Chart file the user has open",
+                    "type": "string",
+                    "example": "modules/network/main.tf"
+                },
+                "subject": {
+                    "type": "string",
+                    "example": "alice"
+                },
+                "updatedAt": {
+                    "type": "string",
+                    "example": "2026-01-02T15:04:05Z"
+                }
+            }
+        },
+        "server.chartPresenceListResponse": {
+            "type": "object",
+            "properties": {
+                "presence": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.chartPresence"
+                    }
+                }
+            }
+        },
+        "server.chartPresenceRequest": {
+            "type": "object",
+            "properties": {
+                "editing": {
+                    "type": "boolean"
+                },
+                "path": {
+                    "type": "string",
+                    "example": "modules/network/main.tf"
+                }
+            }
+        },
+        "server.chartRequiredTags": {
+            "type": "object",
+            "properties": {
+                "enforcement": {
+                    "type": "string",
+                    "example": "block"
+                },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "owner",
+                        "cost-center"
+                    ]
+                }
+            }
+        },
+        "server.chartResponse": {
+            "type": "object",
+            "properties": {
+                "chartId": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartRevertRequest": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string",
+                    "example": "Revert to last good release"
+                },
+                "path": {
+                    "description": "Only revert this file",
+                    "type": "string",
+                    "example": "main.tf.json"
+                },
+                "ref": {
+                    "type": "string",
+                    "example": "9fceb02d0ae598e95dc970b74767f19372d61af8"
+                }
+            }
+        },
+        "server.chartRevertResponse": {
+            "type": "object",
+            "properties": {
+                "chartId": {
+                    "type": "string"
+                },
+                "path": {
+                    "type": "string"
+                },
+                "ref": {
+                    "type": "string"
+                },
+                "target": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartRollbackRequest": {
+            "type": "object",
+            "properties": {
+                "agentLabels": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "region=eu"
+                    ]
+                },
+                "deployId": {
+                    "description": "Roll back from this deploy instead of the latest one",
+                    "type": "string"
+                },
+                "environment": {
+                    "type": "string",
+                    "example": "staging"
+                },
+                "requireApproval": {
+                    "type": "boolean"
+                },
+                "stack": {
+                    "type": "string"
+                },
+                "timeoutSeconds": {
+                    "description": "Defaults to DEPLOY_TIMEOUT",
+                    "type": "integer",
+                    "example": 1800
+                }
+            }
+        },
+        "server.chartRunTask": {
+            "type": "object",
+            "properties": {
+                "after": {
+                    "description": "Defaults to plan",
+                    "type": "string",
+                    "enum": [
+                        "init",
+                        "validate",
+                        "plan",
+                        "policy",
+                        "apply"
+                    ]
+                },
+                "enforcement": {
+                    "type": "string",
+                    "enum": [
+                        "block",
+                        "warn"
+                    ]
+                },
+                "name": {
+                    "type": "string"
+                },
+                "secret": {
+                    "type": "string"
+                },
+                "timeoutSeconds": {
+                    "description": "Defaults to 600",
+                    "type": "integer"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartRunTasks": {
+            "type": "object",
+            "properties": {
+                "tasks": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.chartRunTask"
+                    }
+                }
+            }
+        },
+        "server.chartSchedule": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string",
+                    "example": "2026-01-02T15:04:05Z"
+                },
+                "cron": {
+                    "type": "string",
+                    "example": "0 3 * * *"
+                },
+                "environment": {
+                    "type": "string",
+                    "example": "staging"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "lastDeployId": {
+                    "type": "string"
+                },
+                "lastError": {
+                    "description": "Why the last run could not start",
+                    "type": "string"
+                },
+                "lastRunAt": {
+                    "type": "string",
+                    "example": "2026-01-02T03:00:00Z"
+                },
+                "mode": {
+                    "type": "string",
+                    "enum": [
+                        "plan",
+                        "apply"
+                    ]
+                },
+                "nextRunAt": {
+                    "type": "string",
+                    "example": "2026-01-03T03:00:00Z"
+                },
+                "ref": {
+                    "description": "The branch of the environment, or the chart default branch, when empty",
+                    "type": "string",
+                    "example": "main"
+                },
+                "stack": {
+                    "type": "string"
+                },
+                "subject": {
+                    "description": "Who created the schedule, and whom its runs deploy as",
+                    "type": "string"
+                },
+                "timezone": {
+                    "description": "UTC when empty",
+                    "type": "string",
+                    "example": "Europe/Berlin"
+                }
+            }
+        },
+        "server.chartScheduleRequest": {
+            "type": "object",
+            "properties": {
+                "cron": {
+                    "type": "string",
+                    "example": "0 3 * * *"
+                },
+                "environment": {
+                    "type": "string",
+                    "example": "staging"
+                },
+                "mode": {
+                    "type": "string",
+                    "enum": [
+                        "plan",
+                        "apply"
+                    ]
+                },
+                "ref": {
+                    "type": "string",
+                    "example": "main"
+                },
+                "stack": {
+                    "type": "string"
+                },
+                "timezone": {
+                    "type": "string",
+                    "example": "Europe/Berlin"
+                }
+            }
+        },
+        "server.chartSchedulesResponse": {
+            "type": "object",
+            "properties": {
+                "chartId": {
+                    "type": "string"
+                },
+                "schedules": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.chartSchedule"
+                    }
+                }
+            }
+        },
+        "server.chartSchema": {
+            "type": "object",
+            "properties": {
+                "cacheKey": {
+                    "type": "string"
+                },
+                "chartId": {
+                    "type": "string"
+                },
+                "generatedAt": {
+                    "type": "string"
+                },
+                "ref": {
+                    "type": "string"
+                },
+                "schema": {
+                    "type": "object"
+                },
+                "stack": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartSecretEnv": {
+            "type": "object",
+            "properties": {
+                "env": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.chartSecretRef"
+                    }
+                }
+            }
+        },
+        "server.chartSecretRef": {
+            "type": "object",
+            "properties": {
+                "environment": {
+                    "type": "string",
+                    "example": "prod"
+                },
+                "name": {
+                    "description": "Environment variable",
+                    "type": "string",
+                    "example": "AWS_SECRET_ACCESS_KEY"
+                },
+                "secret": {
+                    "type": "string",
+                    "example": "aws-secret-key"
+                },
+                "stack": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartSquashRequest": {
+            "type": "object",
+            "properties": {
+                "before": {
+                    "description": "RFC 3339 cutoff",
+                    "type": "string",
+                    "example": "2025-01-01T00:00:00Z"
+                },
+                "dryRun": {
+                    "type": "boolean"
+                },
+                "message": {
+                    "description": "Message of the baseline commit, summarizing the squash by default",
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartSquashResponse": {
+            "type": "object",
+            "properties": {
+                "baseline": {
+                    "type": "string"
+                },
+                "chartId": {
+                    "type": "string"
+                },
+                "dryRun": {
+                    "type": "boolean"
+                },
+                "refs": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "squashed": {
+                    "type": "integer"
+                }
+            }
+        },
+        "server.chartStateImportRequest": {
+            "type": "object",
+            "properties": {
+                "dryRun": {
+                    "type": "boolean"
+                },
+                "environment": {
+                    "type": "string",
+                    "example": "prod"
+                },
+                "http": {
+                    "$ref": "#/definitions/server.stateImportHTTP"
+                },
+                "message": {
+                    "description": "Commit message of the backend removal",
+                    "type": "string"
+                },
+                "replace": {
+                    "description": "Replace a managed state stored already",
+                    "type": "boolean"
+                },
+                "s3": {
+                    "description": "S3 and HTTP complete the backend block of the module, which may leave\nout settings passed with -backend-config.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/server.stateImportS3"
+                        }
+                    ]
+                },
+                "stack": {
+                    "type": "string",
+                    "example": "network"
+                }
+            }
+        },
+        "server.chartStateImportResponse": {
+            "type": "object",
+            "properties": {
+                "backend": {
+                    "type": "string",
+                    "example": "s3"
+                },
+                "chartId": {
+                    "type": "string"
+                },
+                "dryRun": {
+                    "type": "boolean"
+                },
+                "environment": {
+                    "type": "string"
+                },
+                "file": {
+                    "description": "File the backend block is removed from",
+                    "type": "string",
+                    "example": "network/backend.tf"
+                },
+                "ref": {
+                    "description": "Commit removing the backend block",
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                },
+                "source": {
+                    "type": "string",
+                    "example": "s3://acme-tfstate/network/terraform.tfstate"
+                },
+                "stack": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartStateInventory": {
+            "type": "object",
+            "properties": {
+                "chartId": {
+                    "type": "string"
+                },
+                "environment": {
+                    "type": "string"
+                },
+                "lineage": {
+                    "type": "string"
+                },
+                "outputs": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.chartStateOutput"
+                    }
+                },
+                "resources": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.chartStateResource"
+                    }
+                },
+                "serial": {
+                    "type": "integer"
+                },
+                "stack": {
+                    "type": "string"
+                },
+                "tofuVersion": {
+                    "type": "string",
+                    "example": "1.8.0"
+                }
+            }
+        },
+        "server.chartStateOutput": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string"
+                },
+                "sensitive": {
+                    "type": "boolean"
+                },
+                "value": {
+                    "description": "Left out when sensitive"
+                }
+            }
+        },
+        "server.chartStateResource": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string",
+                    "example": "module.net.aws_vpc.main"
+                },
+                "instances": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.chartStateResourceInstance"
+                    }
+                },
+                "mode": {
+                    "type": "string",
+                    "example": "managed"
+                },
+                "module": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "main"
+                },
+                "provider": {
+                    "type": "string",
+                    "example": "registry.opentofu.org/hashicorp/aws"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "aws_vpc"
+                }
+            }
+        },
+        "server.chartStateResourceInstance": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string",
+                    "example": "module.net.aws_vpc.main"
+                },
+                "attributes": {
+                    "description": "Top-level attributes holding a string, number or bool; long strings\nare cut and sensitive attributes left out.",
+                    "type": "object",
+                    "additionalProperties": {}
+                },
+                "id": {
+                    "type": "string"
+                },
+                "sensitive": {
+                    "description": "Attributes left out as sensitive",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "server.chartStateVersionsResponse": {
+            "type": "object",
+            "properties": {
+                "chartId": {
+                    "type": "string"
+                },
+                "environment": {
+                    "type": "string"
+                },
+                "stack": {
+                    "type": "string"
+                },
+                "versions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/chart.ChartStateVersion"
+                    }
+                }
+            }
+        },
+        "server.chartTag": {
+            "type": "object",
+            "properties": {
+                "hash": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "taggerEmail": {
+                    "type": "string"
+                },
+                "taggerName": {
+                    "type": "string"
+                },
+                "timestamp": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartTagRequest": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string",
+                    "example": "Release 1.2.0"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "v1.2.0"
+                },
+                "ref": {
+                    "type": "string",
+                    "example": "main"
+                }
+            }
+        },
+        "server.chartTagsResponse": {
+            "type": "object",
+            "properties": {
+                "chartId": {
+                    "type": "string"
+                },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.chartTag"
+                    }
+                }
+            }
+        },
+        "server.chartTrashEntry": {
+            "type": "object",
+            "properties": {
+                "chartId": {
+                    "type": "string"
+                },
+                "deletedAt": {
+                    "type": "string",
+                    "example": "2026-01-02T15:04:05Z"
+                },
+                "deletedBy": {
+                    "type": "string"
+                },
+                "expiresAt": {
+                    "description": "Purged for good after this",
+                    "type": "string",
+                    "example": "2026-02-01T15:04:05Z"
+                }
+            }
+        },
+        "server.chartTrashResponse": {
+            "type": "object",
+            "properties": {
+                "charts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.chartTrashEntry"
+                    }
+                }
+            }
+        },
+        "server.chartTreeResponse": {
+            "type": "object",
+            "properties": {
+                "chartId": {
+                    "type": "string"
+                },
+                "files": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "ref": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartVulnerability": {
+            "type": "object",
+            "properties": {
+                "aliases": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "fixedVersions": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "id": {
+                    "type": "string"
+                },
+                "path": {
+                    "type": "string"
+                },
+                "provider": {
+                    "type": "string"
+                },
+                "severity": {
+                    "type": "string"
+                },
+                "summary": {
+                    "type": "string"
+                },
+                "version": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartVulnerabilityReport": {
+            "type": "object",
+            "properties": {
+                "chartId": {
+                    "type": "string"
+                },
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "findings": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.chartVulnerability"
+                    }
+                },
+                "providers": {
+                    "type": "integer"
+                },
+                "ref": {
+                    "type": "string"
+                },
+                "scannedAt": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartWebhook": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "secret": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.chartWebhookRequest": {
+            "type": "object",
+            "properties": {
+                "secret": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string",
+                    "example": "https://ci.example.com/hooks/planemgr"
+                }
+            }
+        },
+        "server.chartWebhooksResponse": {
+            "type": "object",
+            "properties": {
+                "chartId": {
+                    "type": "string"
+                },
+                "webhooks": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.chartWebhook"
+                    }
+                }
+            }
+        },
+        "server.deployApprovalRequest": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.deployApprovalResponse": {
+            "type": "object",
+            "properties": {
+                "awaitingApproval": {
+                    "description": "An approved deploy keeps waiting while it still awaits the approval\nof the approval rules or the sign-off of the owners of changed paths.",
+                    "type": "boolean"
+                },
+                "awaitingOwners": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.ownerSignoff"
+                    }
+                },
+                "chartId": {
+                    "type": "string"
+                },
+                "decidedBy": {
+                    "type": "string"
+                },
+                "decision": {
+                    "type": "string",
+                    "enum": [
+                        "approved",
+                        "rejected"
+                    ]
+                },
+                "deployId": {
+                    "type": "string"
+                },
+                "ref": {
+                    "type": "string"
+                },
+                "stack": {
+                    "type": "string"
+                },
+                "subject": {
+                    "description": "Who started the deploy",
+                    "type": "string"
+                }
+            }
+        },
+        "server.deployDiagnosticRange": {
+            "type": "object",
+            "properties": {
+                "endColumn": {
+                    "type": "integer"
+                },
+                "endLine": {
+                    "type": "integer"
+                },
+                "path": {
+                    "type": "string"
+                },
+                "startColumn": {
+                    "type": "integer"
+                },
+                "startLine": {
+                    "type": "integer"
+                }
+            }
+        },
+        "server.deployDiagnosticResponse": {
+            "type": "object",
+            "properties": {
+                "detail": {
+                    "type": "string"
+                },
+                "range": {
+                    "$ref": "#/definitions/server.deployDiagnosticRange"
+                },
+                "severity": {
+                    "type": "string"
+                },
+                "summary": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.deployJobResponse": {
+            "type": "object",
+            "properties": {
+                "chartId": {
+                    "type": "string"
+                },
+                "deployId": {
+                    "type": "string"
+                },
+                "environment": {
+                    "type": "string"
+                },
+                "error": {
+                    "description": "Why the deploy failed without a result",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/server.errorResponse"
+                        }
+                    ]
+                },
+                "finishedAt": {
+                    "type": "string",
+                    "example": "2026-01-02T15:09:05Z"
+                },
+                "queuePosition": {
+                    "description": "Of queued deploys, 1 for the next to start",
+                    "type": "integer"
+                },
+                "ref": {
+                    "type": "string"
+                },
+                "result": {
+                    "$ref": "#/definitions/server.deployResponse"
+                },
+                "stack": {
+                    "type": "string"
+                },
+                "startedAt": {
+                    "type": "string",
+                    "example": "2026-01-02T15:04:05Z"
+                },
+                "status": {
+                    "description": "queued, running, awaiting_approval, then the status of the result, failed, timed_out or canceled",
+                    "type": "string",
+                    "example": "running"
+                },
+                "steps": {
+                    "description": "Deploy IDs of the steps a rollout started so far",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "server.deployPolicyResponse": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "outcome": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.deployRequest": {
+            "type": "object",
+            "properties": {
+                "agentLabels": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "region=eu"
+                    ]
+                },
+                "destroy": {
+                    "description": "Destroy the resources of the module instead of applying it",
+                    "type": "boolean"
+                },
+                "environment": {
+                    "description": "Chart environment to deploy to",
+                    "type": "string",
+                    "example": "staging"
+                },
+                "expiresInSeconds": {
+                    "description": "Make the environment ephemeral, expiring that long after the request",
+                    "type": "integer",
+                    "example": 86400
+                },
+                "id": {
+                    "type": "string",
+                    "example": "3fa85f64-5717-4562-b3fc-2c963f66afa6"
+                },
+                "overridePolicies": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "ref": {
+                    "type": "string",
+                    "example": "main"
+                },
+                "requireApproval": {
+                    "description": "Wait for an approval after the plan even without a chart approval rule",
+                    "type": "boolean"
+                },
+                "rollbackRef": {
+                    "type": "string",
+                    "example": "v1.1.0"
+                },
+                "sandbox": {
+                    "type": "boolean"
+                },
+                "secrets": {
+                    "description": "Secrets of the user to export to the runner, keyed by environment\nvariable, on top of those the chart maps.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "serviceAddress": {
+                    "type": "string",
+                    "example": "172.17.0.1:4000"
+                },
+                "strategy": {
+                    "$ref": "#/definitions/server.deployStrategy"
+                },
+                "timeoutSeconds": {
+                    "description": "Defaults to DEPLOY_TIMEOUT",
+                    "type": "integer",
+                    "example": 1800
+                }
+            }
+        },
+        "server.deployResponse": {
+            "type": "object",
+            "properties": {
+                "deployId": {
+                    "description": "Passed to the modules as planemgr_deploy_id",
+                    "type": "string"
+                },
+                "environment": {
+                    "type": "string"
+                },
+                "exitCode": {
+                    "type": "integer"
+                },
+                "output": {
+                    "type": "string"
+                },
+                "policies": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.deployPolicyResponse"
+                    }
+                },
+                "ref": {
+                    "type": "string"
+                },
+                "rollback": {
+                    "$ref": "#/definitions/server.deployResponse"
+                },
+                "runTasks": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.deployPolicyResponse"
+                    }
+                },
+                "runnerImage": {
+                    "type": "string"
+                },
+                "stack": {
+                    "type": "string"
+                },
+                "stages": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.deployStageResponse"
+                    }
+                },
+                "status": {
+                    "type": "string"
+                },
+                "strategy": {
+                    "description": "Steps of a rollout",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/server.deployStrategyResponse"
+                        }
+                    ]
+                }
+            }
+        },
+        "server.deployStageResponse": {
+            "type": "object",
+            "properties": {
+                "check": {
+                    "type": "boolean"
+                },
+                "diagnostics": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.deployDiagnosticResponse"
+                    }
+                },
+                "exitCode": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "output": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.deployStatsChart": {
+            "type": "object",
+            "properties": {
+                "chartId": {
+                    "type": "string"
+                },
+                "days": {
+                    "description": "Only days with deploys, oldest first",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.deployStatsDay"
+                    }
+                },
+                "deploys": {
+                    "type": "integer"
+                },
+                "failed": {
+                    "type": "integer"
+                },
+                "failureRatio": {
+                    "type": "number"
+                }
+            }
+        },
+        "server.deployStatsDay": {
+            "type": "object",
+            "properties": {
+                "date": {
+                    "type": "string",
+                    "example": "2026-01-02"
+                },
+                "deploys": {
+                    "type": "integer"
+                },
+                "failed": {
+                    "type": "integer"
+                },
+                "failureRatio": {
+                    "type": "number",
+                    "example": 0.25
+                }
+            }
+        },
+        "server.deployStatsResponse": {
+            "type": "object",
+            "properties": {
+                "charts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.deployStatsChart"
+                    }
+                },
+                "days": {
+                    "description": "Every day of the range, summed over the charts",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.deployStatsDay"
+                    }
+                },
+                "from": {
+                    "type": "string",
+                    "example": "2026-01-01"
+                },
+                "to": {
+                    "type": "string",
+                    "example": "2026-01-31"
+                }
+            }
+        },
+        "server.deployStrategy": {
+            "type": "object",
+            "properties": {
+                "environments": {
+                    "description": "The pair the module alternates between",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "prod-blue",
+                        "prod-green"
+                    ]
+                },
+                "keepBlue": {
+                    "description": "Leave blue deployed instead of destroying it",
+                    "type": "boolean"
+                },
+                "switch": {
+                    "description": "Switch is the module routing the traffic, deployed with the\nplanemgr_traffic_blue, planemgr_traffic_green and\nplanemgr_traffic_weight variables.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/server.deploySwitch"
+                        }
+                    ]
+                },
+                "type": {
+                    "type": "string",
+                    "enum": [
+                        "blue-green",
+                        "canary"
+                    ],
+                    "example": "blue-green"
+                },
+                "weights": {
+                    "description": "Canary percentages of the traffic sent to green before all of it",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    },
+                    "example": [
+                        10,
+                        50
+                    ]
+                }
+            }
+        },
+        "server.deployStrategyResponse": {
+            "type": "object",
+            "properties": {
+                "blue": {
+                    "type": "string",
+                    "example": "prod-blue"
+                },
+                "green": {
+                    "type": "string",
+                    "example": "prod-green"
+                },
+                "live": {
+                    "description": "Serving the traffic once the rollout ended, unknown when restoring it failed",
+                    "type": "string",
+                    "example": "prod-green"
+                },
+                "steps": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.deployStrategyStep"
+                    }
+                },
+                "type": {
+                    "type": "string",
+                    "example": "blue-green"
+                }
+            }
+        },
+        "server.deployStrategyStep": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string",
+                    "enum": [
+                        "deploy",
+                        "switch",
+                        "restore",
+                        "decommission"
+                    ]
+                },
+                "deployId": {
+                    "description": "Its result is at GET /api/deploy/{id}",
+                    "type": "string"
+                },
+                "error": {
+                    "$ref": "#/definitions/server.errorResponse"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "weight": {
+                    "description": "Percentage of the traffic a switch sends to green",
+                    "type": "integer"
+                }
+            }
+        },
+        "server.deploySwitch": {
+            "type": "object",
+            "properties": {
+                "environment": {
+                    "type": "string",
+                    "example": "prod"
+                },
+                "stack": {
+                    "description": "The root module when empty",
+                    "type": "string",
+                    "example": "router"
+                }
+            }
+        },
+        "server.destroyRule": {
+            "type": "object",
+            "properties": {
+                "allow": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "environment": {
+                    "type": "string",
+                    "example": "prod"
+                },
+                "stack": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.emptyResponse": {
+            "type": "object"
+        },
+        "server.errorResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string",
+                    "example": "invalid_request"
+                },
+                "localizedMessage": {
+                    "type": "string",
+                    "example": "Die Anfrage ist ungültig."
+                },
+                "message": {
+                    "type": "string",
+                    "example": "invalid JSON payload"
+                }
+            }
+        },
+        "server.healthResponse": {
+            "type": "object",
+            "properties": {
+                "status": {
+                    "type": "string"
+                },
+                "time": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.jobTypeSummary": {
+            "type": "object",
+            "properties": {
+                "failed": {
+                    "type": "integer"
+                },
+                "failureRate": {
+                    "description": "Failed out of finished jobs",
+                    "type": "number",
+                    "example": 0.25
+                },
+                "running": {
+                    "type": "integer"
+                },
+                "started": {
+                    "type": "integer"
+                },
+                "succeeded": {
+                    "type": "integer"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "deploy"
+                }
+            }
+        },
+        "server.jobWorkersSummary": {
+            "type": "object",
+            "properties": {
+                "agents": {
+                    "type": "integer"
+                },
+                "capacity": {
+                    "type": "integer"
+                },
+                "running": {
+                    "type": "integer"
+                },
+                "utilization": {
+                    "type": "number",
+                    "example": 0.5
+                }
+            }
+        },
+        "server.jobsSummaryResponse": {
+            "type": "object",
+            "properties": {
+                "averageWaitSeconds": {
+                    "description": "Of agent jobs, until an agent claimed them",
+                    "type": "number"
+                },
+                "queueDepth": {
+                    "description": "Jobs waiting for an agent",
+                    "type": "integer"
+                },
+                "running": {
+                    "type": "integer"
+                },
+                "runningAgent": {
+                    "type": "integer"
+                },
+                "runningLocal": {
+                    "type": "integer"
+                },
+                "since": {
+                    "description": "When the counters started, at server start",
+                    "type": "string",
+                    "example": "2026-01-02T15:04:05Z"
+                },
+                "types": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.jobTypeSummary"
+                    }
+                },
+                "workers": {
+                    "$ref": "#/definitions/server.jobWorkersSummary"
                 }
             }
         },
-        "/user": {
-            "get": {
-                "security": [
-                    {
-                        "BearerAuth": []
-                    }
-                ],
-                "description": "Returns any available user info when the bearer token is valid.",
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "user"
-                ],
-                "summary": "Return user info",
-                "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "$ref": "#/definitions/server.userInfoResponse"
-                        }
-                    },
-                    "401": {
-                        "description": "Unauthorized",
-                        "schema": {
-                            "$ref": "#/definitions/server.errorResponse"
-                        }
-                    }
-                }
-            },
-            "post": {
-                "description": "Accepts credentials for the single-user setup, optionally storing an SSH keypair or generating one.",
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "user"
-                ],
-                "summary": "Set the user name and password",
-                "parameters": [
-                    {
-                        "description": "User credentials",
-                        "name": "credentials",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/server.userRegisterRequest"
-                        }
-                    }
-                ],
-                "responses": {
-                    "201": {
-                        "description": "Created",
-                        "schema": {
-                            "$ref": "#/definitions/server.emptyResponse"
-                        }
-                    },
-                    "400": {
-                        "description": "Bad Request",
-                        "schema": {
-                            "$ref": "#/definitions/server.errorResponse"
-                        }
+        "server.ownerSignoff": {
+            "type": "object",
+            "properties": {
+                "owners": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
                     },
-                    "401": {
-                        "description": "Unauthorized",
-                        "schema": {
-                            "$ref": "#/definitions/server.errorResponse"
-                        }
+                    "example": [
+                        "alice"
+                    ]
+                },
+                "paths": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
                     },
-                    "500": {
-                        "description": "Internal Server Error",
-                        "schema": {
-                            "$ref": "#/definitions/server.errorResponse"
-                        }
+                    "example": [
+                        "modules/network/main.tf"
+                    ]
+                },
+                "signedOffBy": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.replicationChartsResponse": {
+            "type": "object",
+            "properties": {
+                "charts": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "server.authRequest": {
+        },
+        "server.runTaskCallback": {
             "type": "object",
             "properties": {
-                "password": {
+                "message": {
                     "type": "string"
                 },
-                "username": {
-                    "type": "string"
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "passed",
+                        "failed"
+                    ]
                 }
             }
         },
-        "server.authResponse": {
+        "server.serviceAccountListResponse": {
             "type": "object",
             "properties": {
-                "access_token": {
-                    "type": "string"
+                "serviceAccounts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.serviceAccountResponse"
+                    }
+                }
+            }
+        },
+        "server.serviceAccountRequest": {
+            "type": "object",
+            "properties": {
+                "description": {
+                    "type": "string",
+                    "example": "CI pipeline"
                 },
-                "expires_in": {
-                    "type": "integer"
+                "generateSshKey": {
+                    "description": "Only when creating",
+                    "type": "boolean"
+                },
+                "name": {
+                    "description": "Only when creating",
+                    "type": "string",
+                    "example": "ci"
                 },
-                "refresh_token": {
+                "roles": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/auth.RoleBinding"
+                    }
+                },
+                "sshPrivateKey": {
+                    "description": "Only when creating",
                     "type": "string"
                 },
-                "token_type": {
+                "sshPublicKey": {
+                    "description": "Only when creating",
                     "type": "string"
                 }
             }
         },
-        "server.chartCommitRequest": {
+        "server.serviceAccountResponse": {
             "type": "object",
             "properties": {
-                "files": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "createdBy": {
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "roles": {
                     "type": "array",
                     "items": {
-                        "$ref": "#/definitions/server.chartFileUpdate"
+                        "$ref": "#/definitions/auth.RoleBinding"
                     }
                 },
-                "message": {
+                "secret": {
+                    "description": "Secret is only returned when the service account is created.",
                     "type": "string"
+                },
+                "sshPublicKey": {
+                    "type": "string"
+                },
+                "subject": {
+                    "type": "string",
+                    "example": "service:ci"
                 }
             }
         },
-        "server.chartCommitResponse": {
+        "server.stackDeployRequest": {
             "type": "object",
             "properties": {
-                "chartId": {
-                    "type": "string"
+                "agentLabels": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "region=eu"
+                    ]
                 },
-                "files": {
+                "destroy": {
+                    "description": "Destroy the resources of the module instead of applying it",
+                    "type": "boolean"
+                },
+                "environment": {
+                    "description": "Chart environment to deploy to",
+                    "type": "string",
+                    "example": "staging"
+                },
+                "expiresInSeconds": {
+                    "description": "Make the environment ephemeral, expiring that long after the request",
+                    "type": "integer",
+                    "example": 86400
+                },
+                "overridePolicies": {
                     "type": "array",
                     "items": {
                         "type": "string"
                     }
                 },
                 "ref": {
-                    "type": "string"
+                    "type": "string",
+                    "example": "main"
+                },
+                "requireApproval": {
+                    "description": "Wait for an approval after the plan even without a chart approval rule",
+                    "type": "boolean"
+                },
+                "rollbackRef": {
+                    "type": "string",
+                    "example": "v1.1.0"
+                },
+                "sandbox": {
+                    "type": "boolean"
+                },
+                "secrets": {
+                    "description": "Secrets of the user to export to the runner, keyed by environment\nvariable, on top of those the chart maps.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "serviceAddress": {
+                    "type": "string",
+                    "example": "172.17.0.1:4000"
+                },
+                "strategy": {
+                    "$ref": "#/definitions/server.deployStrategy"
+                },
+                "timeoutSeconds": {
+                    "description": "Defaults to DEPLOY_TIMEOUT",
+                    "type": "integer",
+                    "example": 1800
                 }
             }
         },
-        "server.chartFileResponse": {
+        "server.stateImportHTTP": {
             "type": "object",
             "properties": {
-                "chartId": {
+                "address": {
+                    "type": "string",
+                    "example": "https://state.example.com/network"
+                },
+                "password": {
                     "type": "string"
                 },
-                "contents": {
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.stateImportS3": {
+            "type": "object",
+            "properties": {
+                "accessKeyId": {
                     "type": "string"
                 },
-                "path": {
+                "bucket": {
+                    "type": "string",
+                    "example": "acme-tfstate"
+                },
+                "endpoint": {
+                    "description": "For S3 compatible stores",
+                    "type": "string",
+                    "example": "https://minio.internal:9000"
+                },
+                "key": {
+                    "type": "string",
+                    "example": "network/terraform.tfstate"
+                },
+                "region": {
+                    "type": "string",
+                    "example": "eu-central-1"
+                },
+                "secretAccessKey": {
                     "type": "string"
                 },
-                "ref": {
+                "sessionToken": {
                     "type": "string"
                 }
             }
         },
-        "server.chartFileUpdate": {
+        "server.userInfoResponse": {
             "type": "object",
             "properties": {
-                "content": {
-                    "type": "string"
-                },
-                "path": {
+                "sshPublicKey": {
                     "type": "string"
                 }
             }
         },
-        "server.chartListResponse": {
+        "server.userNotificationsReadRequest": {
             "type": "object",
             "properties": {
-                "chartIds": {
+                "ids": {
                     "type": "array",
                     "items": {
                         "type": "string"
@@ -526,105 +12069,123 @@ const docTemplate = `{
                 }
             }
         },
-        "server.chartResponse": {
+        "server.userNotificationsReadResponse": {
             "type": "object",
             "properties": {
-                "chartId": {
-                    "type": "string"
+                "marked": {
+                    "type": "integer"
+                },
+                "unread": {
+                    "type": "integer"
                 }
             }
         },
-        "server.chartTreeResponse": {
+        "server.userNotificationsResponse": {
             "type": "object",
             "properties": {
-                "chartId": {
-                    "type": "string"
-                },
-                "files": {
+                "notifications": {
                     "type": "array",
                     "items": {
-                        "type": "string"
+                        "$ref": "#/definitions/user.Notification"
                     }
                 },
-                "ref": {
-                    "type": "string"
+                "unread": {
+                    "type": "integer"
                 }
             }
         },
-        "server.deployRequest": {
+        "server.userPreferences": {
             "type": "object",
             "properties": {
-                "id": {
+                "defaultChart": {
                     "type": "string"
                 },
-                "ref": {
-                    "type": "string"
+                "notifications": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "boolean"
+                    }
+                },
+                "ui": {
+                    "type": "object",
+                    "additionalProperties": {}
                 }
             }
         },
-        "server.deployResponse": {
+        "server.userRegisterRequest": {
             "type": "object",
             "properties": {
-                "exitCode": {
-                    "type": "integer"
+                "password": {
+                    "type": "string",
+                    "example": "correct horse battery staple"
                 },
-                "output": {
+                "sshPrivateKey": {
                     "type": "string"
                 },
-                "ref": {
+                "sshPublicKey": {
                     "type": "string"
                 },
-                "runnerImage": {
-                    "type": "string"
+                "username": {
+                    "type": "string",
+                    "example": "alice"
                 }
             }
         },
-        "server.emptyResponse": {
-            "type": "object"
-        },
-        "server.errorResponse": {
+        "server.userSecretRequest": {
             "type": "object",
             "properties": {
-                "error": {
-                    "type": "string"
-                },
-                "message": {
+                "value": {
                     "type": "string"
                 }
             }
         },
-        "server.healthResponse": {
+        "server.userSecretsResponse": {
             "type": "object",
             "properties": {
-                "status": {
-                    "type": "string"
-                },
-                "time": {
-                    "type": "string"
+                "secrets": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/user.Secret"
+                    }
                 }
             }
         },
-        "server.userInfoResponse": {
+        "user.Notification": {
             "type": "object",
             "properties": {
-                "ssh_public_key": {
+                "chartId": {
+                    "type": "string"
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "event": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "read": {
+                    "type": "boolean"
+                },
+                "ref": {
                     "type": "string"
                 }
             }
         },
-        "server.userRegisterRequest": {
+        "user.Secret": {
             "type": "object",
             "properties": {
-                "password": {
+                "createdAt": {
                     "type": "string"
                 },
-                "ssh_private_key": {
+                "name": {
                     "type": "string"
                 },
-                "ssh_public_key": {
-                    "type": "string"
-                },
-                "username": {
+                "updatedAt": {
                     "type": "string"
                 }
             }
@@ -632,12 +12193,46 @@ const docTemplate = `{
     },
     "securityDefinitions": {
         "BearerAuth": {
-            "description": "Use \"Bearer \u003ctoken\u003e\" for authenticated requests.",
+            "description": "Use \"Bearer \u003ctoken\u003e\" for authenticated requests. Chart permissions can further deny destroying resources per stack to users who may still deploy, see /chart/{id}/permissions.",
             "type": "apiKey",
             "name": "Authorization",
             "in": "header"
         }
-    }
+    },
+    "tags": [
+        {
+            "description": "Sessions and tokens",
+            "name": "auth"
+        },
+        {
+            "description": "The authenticated user, their SSH keys, preferences and notifications",
+            "name": "user"
+        },
+        {
+            "description": "Non-human subjects automation logs in as, with role bindings",
+            "name": "service-account"
+        },
+        {
+            "description": "Chart files, history, branches and settings. Errors of chart file endpoints carry a message instead of a code in error",
+            "name": "chart"
+        },
+        {
+            "description": "Deploys and the agents that run them",
+            "name": "deploy"
+        },
+        {
+            "description": "Deploy jobs self-hosted agents claim, report on and gate",
+            "name": "jobs"
+        },
+        {
+            "description": "The runner image and its scan",
+            "name": "runner"
+        },
+        {
+            "description": "Liveness",
+            "name": "health"
+        }
+    ]
 }`
 
 // SwaggerInfo holds exported Swagger Info so clients can modify it
@@ -647,7 +12242,7 @@ var SwaggerInfo = &swag.Spec{
 	BasePath:         "/api",
 	Schemes:          []string{"http"},
 	Title:            "Plane Manager API",
-	Description:      "Plane Manager HTTP API for chart and workspace operations.",
+	Description:      "Plane Manager HTTP API for chart and workspace operations. Fields are camelCase; clients still expecting the snake_case names of the auth and user responses can send \"X-JSON-Casing: legacy\". Add ?pretty=1 to any request for indented JSON. Error responses keep their English message and stable code; send Accept-Language to also get a localizedMessage where a translation exists.",
 	InfoInstanceName: "swagger",
 	SwaggerTemplate:  docTemplate,
 	LeftDelim:        "{{",
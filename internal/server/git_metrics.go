@@ -0,0 +1,219 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"expvar"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+)
+
+// negotiationBuckets are the upper bounds, in seconds, of the negotiation
+// duration histogram.
+var negotiationBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// uploadPackMetrics counts the packs served per chart. Negotiation is the time
+// from the upload-pack request until the first pack byte, which includes
+// walking the object graph to select the objects to send.
+var uploadPackMetrics = struct {
+	mu     sync.Mutex
+	charts map[string]*chartUploadPackStats
+}{charts: map[string]*chartUploadPackStats{}}
+
+type chartUploadPackStats struct {
+	Fetches     int64                `json:"fetches"`
+	Objects     int64                `json:"objects"`
+	Bytes       int64                `json:"bytes"`
+	Negotiation negotiationHistogram `json:"negotiationSeconds"`
+}
+
+type negotiationHistogram struct {
+	Buckets map[string]int64 `json:"buckets"` // Cumulative counts by upper bound
+	Sum     float64          `json:"sum"`
+	Count   int64            `json:"count"`
+}
+
+func init() {
+	expvar.Publish("git_upload_pack", expvar.Func(uploadPackSnapshot))
+}
+
+func uploadPackSnapshot() any {
+	uploadPackMetrics.mu.Lock()
+	defer uploadPackMetrics.mu.Unlock()
+
+	snapshot := make(map[string]chartUploadPackStats, len(uploadPackMetrics.charts))
+	for chartID, stats := range uploadPackMetrics.charts {
+		copied := *stats
+		copied.Negotiation.Buckets = make(map[string]int64, len(stats.Negotiation.Buckets))
+		for bound, count := range stats.Negotiation.Buckets {
+			copied.Negotiation.Buckets[bound] = count
+		}
+		snapshot[chartID] = copied
+	}
+	return snapshot
+}
+
+// packMeter counts the bytes of an upload-pack response and reads the object
+// count from the pack header as it passes through. The pack follows the
+// pkt-line negotiation either raw or multiplexed on sideband 1.
+type packMeter struct {
+	http.ResponseWriter
+	start       time.Time
+	bytes       int64
+	objects     int64
+	negotiation time.Duration
+	packSeen    bool
+	done        bool   // Header read, or the stream isn't understood
+	raw         bool   // Pack data follows without pkt-line framing
+	pending     []byte // Bytes not parsed yet
+	remaining   int    // Bytes left in the current pkt-line payload
+	band1       bool   // Whether the current payload carries pack data
+	head        []byte // Pack data read so far, up to the header size
+}
+
+const packHeaderSize = 12 // "PACK", version and object count
+
+func newPackMeter(w http.ResponseWriter) *packMeter {
+	return &packMeter{ResponseWriter: w, start: time.Now()}
+}
+
+func (m *packMeter) Write(p []byte) (int, error) {
+	if !m.done {
+		m.scan(p)
+	}
+
+	n, err := m.ResponseWriter.Write(p)
+	m.bytes += int64(n)
+	return n, err
+}
+
+func (m *packMeter) scan(p []byte) {
+	if m.raw {
+		m.collect(p)
+		return
+	}
+
+	m.pending = append(m.pending, p...)
+	for !m.done {
+		if m.remaining > 0 {
+			n := min(m.remaining, len(m.pending))
+			if n == 0 {
+				return
+			}
+			chunk := m.pending[:n]
+			m.pending = m.pending[n:]
+			m.remaining -= n
+			if m.band1 {
+				m.collect(chunk)
+			}
+			continue
+		}
+
+		if len(m.pending) < 4 {
+			return
+		}
+		if bytes.HasPrefix(m.pending, []byte("PACK")) {
+			m.raw = true
+			m.collect(m.pending)
+			return
+		}
+		length, err := strconv.ParseUint(string(m.pending[:4]), 16, 16)
+		if err != nil {
+			m.done = true
+			return
+		}
+		if length <= 4 {
+			// Flush and delimiter packets carry no payload.
+			m.pending = m.pending[4:]
+			continue
+		}
+		if len(m.pending) < 5 {
+			return
+		}
+		m.band1 = m.pending[4] == 1
+		if m.band1 {
+			m.pending = m.pending[5:]
+			m.remaining = int(length) - 5
+		} else {
+			m.pending = m.pending[4:]
+			m.remaining = int(length) - 4
+		}
+	}
+}
+
+func (m *packMeter) collect(p []byte) {
+	if len(m.head) == 0 && len(p) > 0 {
+		m.negotiation = time.Since(m.start)
+	}
+	m.head = append(m.head, p[:min(len(p), packHeaderSize-len(m.head))]...)
+	if len(m.head) < packHeaderSize {
+		return
+	}
+
+	if bytes.HasPrefix(m.head, []byte("PACK")) {
+		m.packSeen = true
+		m.objects = int64(binary.BigEndian.Uint32(m.head[8:packHeaderSize]))
+	}
+	m.done = true
+}
+
+// record adds the response to the chart metrics when a pack was served.
+// Requests without one, like ref listings, are not counted.
+func (m *packMeter) record(chartID string) {
+	if !m.packSeen {
+		return
+	}
+
+	uploadPackMetrics.mu.Lock()
+	defer uploadPackMetrics.mu.Unlock()
+
+	stats, ok := uploadPackMetrics.charts[chartID]
+	if !ok {
+		stats = &chartUploadPackStats{Negotiation: negotiationHistogram{Buckets: map[string]int64{}}}
+		uploadPackMetrics.charts[chartID] = stats
+	}
+	stats.Fetches++
+	stats.Objects += m.objects
+	stats.Bytes += m.bytes
+
+	stats.Negotiation.observe(m.negotiation.Seconds())
+}
+
+// observe adds a duration in seconds to the histogram.
+func (h *negotiationHistogram) observe(seconds float64) {
+	h.Count++
+	h.Sum += seconds
+	for _, bound := range negotiationBuckets {
+		if seconds <= bound {
+			h.Buckets[strconv.FormatFloat(bound, 'f', -1, 64)]++
+		}
+	}
+	h.Buckets["+Inf"]++
+}
+
+// HandleMetrics godoc
+// @Summary Server metrics
+// @Description Returns the server metrics in expvar format, including packs, objects and bytes served by git upload-pack and a negotiation duration histogram per chart, and the concurrent upload-pack cap with the sessions active, waiting and rejected, a histogram of the time waited for a slot, and the active sessions with those ended by the session sweeper per reason.
+// @Tags health
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} map[string]any
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Router /metrics [get]
+func HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.RequireAccessTokenClaims(r); err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+		return
+	}
+	expvar.Handler().ServeHTTP(w, r)
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+const defaultPackCacheMB = 64
+
+// packCache keeps the packs served to clones, which always ask for the same
+// objects for a ref, so back-to-back deploys of a ref are served without
+// walking the object graph. Entries of a chart are dropped as soon as one of
+// its refs moves; the least recently used packs are evicted past the size
+// limit.
+type packCache struct {
+	mu           sync.Mutex
+	maxBytes     int
+	size         int
+	order        *list.List // Of *packCacheEntry, most recently used first
+	entries      map[string]*list.Element
+	fingerprints map[string]string // Refs of each chart the entries match
+}
+
+type packCacheEntry struct {
+	chartID string
+	key     string
+	pack    []byte
+}
+
+var (
+	chartPackCache     *packCache
+	chartPackCacheOnce sync.Once
+)
+
+// chartPacks returns the pack cache, sized by PACK_CACHE_MB (64 by default).
+// A size of 0 disables caching.
+func chartPacks() *packCache {
+	chartPackCacheOnce.Do(func() {
+		size := defaultPackCacheMB
+		if value := strings.TrimSpace(os.Getenv("PACK_CACHE_MB")); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				log.Printf("Ignoring invalid PACK_CACHE_MB %q", value)
+			} else {
+				size = parsed
+			}
+		}
+		chartPackCache = &packCache{
+			maxBytes:     size << 20,
+			order:        list.New(),
+			entries:      map[string]*list.Element{},
+			fingerprints: map[string]string{},
+		}
+	})
+	return chartPackCache
+}
+
+func (c *packCache) enabled() bool {
+	return c.maxBytes > 0
+}
+
+func (c *packCache) get(chartID, fingerprint, key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.syncRefs(chartID, fingerprint)
+	element, ok := c.entries[chartID+"/"+key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*packCacheEntry).pack, true
+}
+
+func (c *packCache) put(chartID, fingerprint, key string, pack []byte) {
+	if len(pack) > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.syncRefs(chartID, fingerprint)
+	if _, ok := c.entries[chartID+"/"+key]; ok {
+		return
+	}
+	c.entries[chartID+"/"+key] = c.order.PushFront(&packCacheEntry{chartID: chartID, key: key, pack: pack})
+	c.size += len(pack)
+	for c.size > c.maxBytes {
+		c.remove(c.order.Back())
+	}
+}
+
+// syncRefs drops the entries of a chart when its refs changed since they
+// were cached.
+func (c *packCache) syncRefs(chartID, fingerprint string) {
+	if c.fingerprints[chartID] == fingerprint {
+		return
+	}
+	c.fingerprints[chartID] = fingerprint
+	for element := c.order.Front(); element != nil; {
+		next := element.Next()
+		if element.Value.(*packCacheEntry).chartID == chartID {
+			c.remove(element)
+		}
+		element = next
+	}
+}
+
+func (c *packCache) remove(element *list.Element) {
+	entry := c.order.Remove(element).(*packCacheEntry)
+	delete(c.entries, entry.chartID+"/"+entry.key)
+	c.size -= len(entry.pack)
+}
+
+// refsFingerprint hashes every ref of a repository, so any ref update
+// changes it.
+func refsFingerprint(st storer.ReferenceStorer) (string, error) {
+	iter, err := st.IterReferences()
+	if err != nil {
+		return "", err
+	}
+	var lines []string
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		lines = append(lines, ref.String())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	slices.Sort(lines)
+
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:]), nil
+}
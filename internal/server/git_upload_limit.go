@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultUploadPackLimit = 8
+	defaultUploadPackWait  = 30 * time.Second
+)
+
+var errUploadPackBusy = errors.New("too many concurrent clones")
+
+// uploadPackLimiter caps the upload-pack sessions served at once, as every
+// session builds its pack in memory and many deploys queued together clone
+// the same charts at the same time. Sessions past the cap wait in line for
+// up to the wait time.
+type uploadPackLimiter struct {
+	slots chan struct{} // Nil when the cap is disabled
+	wait  time.Duration
+
+	mu       sync.Mutex
+	waiting  int64
+	rejected int64
+	waits    negotiationHistogram
+}
+
+var (
+	chartUploadLimiter     *uploadPackLimiter
+	chartUploadLimiterOnce sync.Once
+)
+
+func init() {
+	expvar.Publish("git_upload_pack_limit", expvar.Func(func() any {
+		return uploadPackLimits().snapshot()
+	}))
+}
+
+// uploadPackLimits returns the upload-pack limiter, capped by
+// GIT_UPLOAD_PACK_LIMIT sessions (8 by default, 0 for no cap) that wait up to
+// GIT_UPLOAD_PACK_WAIT (30s by default) for a slot.
+func uploadPackLimits() *uploadPackLimiter {
+	chartUploadLimiterOnce.Do(func() {
+		limit := defaultUploadPackLimit
+		if value := strings.TrimSpace(os.Getenv("GIT_UPLOAD_PACK_LIMIT")); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				log.Printf("Ignoring invalid GIT_UPLOAD_PACK_LIMIT %q", value)
+			} else {
+				limit = parsed
+			}
+		}
+		wait := defaultUploadPackWait
+		if value := strings.TrimSpace(os.Getenv("GIT_UPLOAD_PACK_WAIT")); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed < 0 {
+				log.Printf("Ignoring invalid GIT_UPLOAD_PACK_WAIT %q", value)
+			} else {
+				wait = parsed
+			}
+		}
+
+		chartUploadLimiter = &uploadPackLimiter{
+			wait:  wait,
+			waits: negotiationHistogram{Buckets: map[string]int64{}},
+		}
+		if limit > 0 {
+			chartUploadLimiter.slots = make(chan struct{}, limit)
+		}
+	})
+	return chartUploadLimiter
+}
+
+// acquire waits for a free slot and returns the function releasing it. It
+// fails with errUploadPackBusy when no slot frees up in time, or with the
+// context error when the client goes away first.
+func (l *uploadPackLimiter) acquire(ctx context.Context) (func(), error) {
+	if l.slots == nil {
+		return func() {}, nil
+	}
+
+	start := time.Now()
+	select {
+	case l.slots <- struct{}{}:
+		l.observe(0)
+		return l.release, nil
+	default:
+	}
+
+	l.mu.Lock()
+	l.waiting++
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		l.waiting--
+		l.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(l.wait)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		l.observe(time.Since(start))
+		return l.release, nil
+	case <-timer.C:
+		l.mu.Lock()
+		l.rejected++
+		l.mu.Unlock()
+		return nil, errUploadPackBusy
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *uploadPackLimiter) release() {
+	<-l.slots
+}
+
+func (l *uploadPackLimiter) observe(wait time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.waits.observe(wait.Seconds())
+}
+
+func (l *uploadPackLimiter) snapshot() any {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	waits := l.waits
+	waits.Buckets = make(map[string]int64, len(l.waits.Buckets))
+	for bound, count := range l.waits.Buckets {
+		waits.Buckets[bound] = count
+	}
+	return struct {
+		Limit    int                  `json:"limit"`
+		Active   int                  `json:"active"`
+		Waiting  int64                `json:"waiting"`
+		Rejected int64                `json:"rejected"`
+		Waits    negotiationHistogram `json:"waitSeconds"`
+	}{cap(l.slots), len(l.slots), l.waiting, l.rejected, waits}
+}
@@ -0,0 +1,109 @@
+// Package i18n translates the messages of API errors. Catalogues map the
+// error code of a response, or the error text of endpoints without codes, to
+// the message in one language. They are embedded from messages/<tag>.json,
+// and files in I18N_DIR add languages or override embedded messages.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/language"
+)
+
+//go:embed messages/*.json
+var embedded embed.FS
+
+var catalogues struct {
+	once     sync.Once
+	messages map[string]map[string]string // By language tag, then code
+	matcher  language.Matcher
+	tags     []language.Tag // English, which needs no catalogue, first
+}
+
+// Negotiate picks the catalogue language best matching an Accept-Language
+// header. It returns false when English, the language of the API, fits best
+// or nothing matches.
+func Negotiate(acceptLanguage string) (string, bool) {
+	if acceptLanguage == "" {
+		return "", false
+	}
+	load()
+
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return "", false
+	}
+	_, index, confidence := catalogues.matcher.Match(tags...)
+	if index == 0 || confidence == language.No {
+		return "", false
+	}
+	return catalogues.tags[index].String(), true
+}
+
+// Message returns the message for code in the catalogue of lang.
+func Message(lang, code string) (string, bool) {
+	load()
+	message, ok := catalogues.messages[lang][code]
+	return message, ok
+}
+
+func load() {
+	catalogues.once.Do(func() {
+		catalogues.messages = map[string]map[string]string{}
+		loadDir(embedded, "messages")
+		if dir := os.Getenv("I18N_DIR"); dir != "" {
+			loadDir(os.DirFS(dir), ".")
+		}
+
+		catalogues.tags = []language.Tag{language.English}
+		for lang := range catalogues.messages {
+			catalogues.tags = append(catalogues.tags, language.Make(lang))
+		}
+		catalogues.matcher = language.NewMatcher(catalogues.tags)
+	})
+}
+
+func loadDir(files fs.FS, dir string) {
+	entries, err := fs.ReadDir(files, dir)
+	if err != nil {
+		log.Printf("Reading message catalogues in %s failed: %v", dir, err)
+		return
+	}
+
+	for _, entry := range entries {
+		lang, ok := strings.CutSuffix(entry.Name(), ".json")
+		if entry.IsDir() || !ok {
+			continue
+		}
+		tag, err := language.Parse(lang)
+		if err != nil {
+			log.Printf("Skipping message catalogue %s: %v", entry.Name(), err)
+			continue
+		}
+
+		var messages map[string]string
+		data, err := fs.ReadFile(files, path.Join(dir, entry.Name()))
+		if err == nil {
+			err = json.Unmarshal(data, &messages)
+		}
+		if err != nil {
+			log.Printf("Skipping message catalogue %s: %v", entry.Name(), err)
+			continue
+		}
+
+		lang = tag.String()
+		if catalogues.messages[lang] == nil {
+			catalogues.messages[lang] = map[string]string{}
+		}
+		for code, message := range messages {
+			catalogues.messages[lang][code] = message
+		}
+	}
+}
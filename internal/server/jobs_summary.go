@@ -0,0 +1,174 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+)
+
+// Job types counted separately in the summary.
+const (
+	jobTypeDeploy   = "deploy"
+	jobTypeSandbox  = "sandbox"
+	jobTypeRollback = "rollback"
+	jobTypeDestroy  = "destroy"
+)
+
+type jobTypeStats struct {
+	Started   int
+	Succeeded int
+	Failed    int
+}
+
+// jobStats counts the deploy jobs run since the server started.
+var jobStats = struct {
+	mu           sync.Mutex
+	since        time.Time
+	runningLocal int
+	types        map[string]*jobTypeStats
+	waits        int // Agent jobs claimed, with waitTotal their time in the queue
+	waitTotal    time.Duration
+}{
+	since: time.Now(),
+	types: map[string]*jobTypeStats{},
+}
+
+type jobTypeSummary struct {
+	Type        string  `json:"type" example:"deploy"`
+	Started     int     `json:"started"`
+	Succeeded   int     `json:"succeeded"`
+	Failed      int     `json:"failed"`
+	Running     int     `json:"running"`
+	FailureRate float64 `json:"failureRate" example:"0.25"` // Failed out of finished jobs
+}
+
+// jobWorkersSummary sums up the connected agents. Utilization is the share of
+// their capacity running jobs.
+type jobWorkersSummary struct {
+	Agents      int     `json:"agents"`
+	Capacity    int     `json:"capacity"`
+	Running     int     `json:"running"`
+	Utilization float64 `json:"utilization" example:"0.5"`
+}
+
+type jobsSummaryResponse struct {
+	Since              string            `json:"since" example:"2026-01-02T15:04:05Z"` // When the counters started, at server start
+	QueueDepth         int               `json:"queueDepth"`                           // Jobs waiting for an agent
+	Running            int               `json:"running"`
+	RunningLocal       int               `json:"runningLocal"`
+	RunningAgent       int               `json:"runningAgent"`
+	AverageWaitSeconds float64           `json:"averageWaitSeconds"` // Of agent jobs, until an agent claimed them
+	Types              []jobTypeSummary  `json:"types"`
+	Workers            jobWorkersSummary `json:"workers"`
+}
+
+// HandleJobsSummary handles GET /api/admin/jobs/summary requests.
+// @Summary Summarize deploy jobs
+// @Description Returns the deploy queue depth, running jobs, the average time agent jobs waited in the queue, started, succeeded and failed jobs with the failure rate per type, and how much of the capacity of connected agents is in use. Counters cover the jobs since the server started.
+// @Tags jobs
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} jobsSummaryResponse
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Router /admin/jobs/summary [get]
+func HandleJobsSummary(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.RequireAccessTokenClaims(r); err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+		return
+	}
+
+	response := jobsSummaryResponse{Types: []jobTypeSummary{}}
+
+	agentRegistry.mu.Lock()
+	for _, queue := range agentRegistry.queues {
+		response.QueueDepth += len(queue)
+	}
+	for _, agent := range agentRegistry.agents {
+		response.RunningAgent += agent.Running
+		if !agent.connected() {
+			continue
+		}
+		response.Workers.Agents++
+		response.Workers.Capacity += agent.Capacity
+		response.Workers.Running += agent.Running
+	}
+	agentRegistry.mu.Unlock()
+	if response.Workers.Capacity > 0 {
+		response.Workers.Utilization = float64(response.Workers.Running) / float64(response.Workers.Capacity)
+	}
+
+	jobStats.mu.Lock()
+	response.Since = jobStats.since.UTC().Format(time.RFC3339)
+	response.RunningLocal = jobStats.runningLocal
+	if jobStats.waits > 0 {
+		response.AverageWaitSeconds = (jobStats.waitTotal / time.Duration(jobStats.waits)).Seconds()
+	}
+	for jobType, stats := range jobStats.types {
+		summary := jobTypeSummary{
+			Type:      jobType,
+			Started:   stats.Started,
+			Succeeded: stats.Succeeded,
+			Failed:    stats.Failed,
+			Running:   stats.Started - stats.Succeeded - stats.Failed,
+		}
+		if finished := stats.Succeeded + stats.Failed; finished > 0 {
+			summary.FailureRate = float64(stats.Failed) / float64(finished)
+		}
+		response.Types = append(response.Types, summary)
+	}
+	jobStats.mu.Unlock()
+
+	response.Running = response.RunningLocal + response.RunningAgent
+	sort.Slice(response.Types, func(i, j int) bool { return response.Types[i].Type < response.Types[j].Type })
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func recordJobStarted(jobType string, local bool) {
+	jobStats.mu.Lock()
+	defer jobStats.mu.Unlock()
+
+	stats, ok := jobStats.types[jobType]
+	if !ok {
+		stats = &jobTypeStats{}
+		jobStats.types[jobType] = stats
+	}
+	stats.Started++
+	if local {
+		jobStats.runningLocal++
+	}
+}
+
+func recordJobFinished(jobType string, local bool, err error) {
+	jobStats.mu.Lock()
+	defer jobStats.mu.Unlock()
+
+	stats := jobStats.types[jobType]
+	if err != nil {
+		stats.Failed++
+	} else {
+		stats.Succeeded++
+	}
+	if local {
+		jobStats.runningLocal--
+	}
+}
+
+// recordJobWait counts how long an agent job waited before an agent claimed
+// it.
+func recordJobWait(wait time.Duration) {
+	jobStats.mu.Lock()
+	defer jobStats.mu.Unlock()
+
+	jobStats.waits++
+	jobStats.waitTotal += wait
+}
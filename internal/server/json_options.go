@@ -0,0 +1,60 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mtolmacs/planemgr/internal/server/i18n"
+)
+
+// jsonOptions are the choices a request makes about how writeJSON renders its
+// responses.
+type jsonOptions struct {
+	lang   string // Language of localizedMessage on errors, empty for none
+	legacy bool   // Field names from before all responses used camelCase
+	pretty bool   // Indented for reading by hand
+}
+
+// jsonOptionsWriter carries the jsonOptions of a request to writeJSON.
+type jsonOptionsWriter struct {
+	http.ResponseWriter
+	jsonOptions
+}
+
+func (w *jsonOptionsWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// legacyJSON is implemented by responses that used snake_case field names
+// before the API settled on camelCase. Clients sending X-JSON-Casing: legacy
+// keep getting the old names until they are updated.
+type legacyJSON interface {
+	legacyJSON() any
+}
+
+// withJSONOptions negotiates the jsonOptions of a request: the language of
+// error messages from Accept-Language, legacy field names from X-JSON-Casing
+// and indentation from ?pretty=1. Requests asking for none of them are passed
+// on untouched.
+func withJSONOptions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		options := jsonOptions{
+			legacy: strings.EqualFold(r.Header.Get("X-JSON-Casing"), "legacy"),
+		}
+		options.lang, _ = i18n.Negotiate(r.Header.Get("Accept-Language"))
+		options.pretty, _ = strconv.ParseBool(r.URL.Query().Get("pretty"))
+		if options == (jsonOptions{}) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(&jsonOptionsWriter{ResponseWriter: w, jsonOptions: options}, r)
+	})
+}
+
+func requestJSONOptions(w http.ResponseWriter) jsonOptions {
+	if writer, ok := w.(*jsonOptionsWriter); ok {
+		return writer.jsonOptions
+	}
+	return jsonOptions{}
+}
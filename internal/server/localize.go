@@ -0,0 +1,36 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/mtolmacs/planemgr/internal/server/i18n"
+)
+
+// localizeError adds localizedMessage to an error payload when the request
+// negotiated a language with a translation for its code. The error code and
+// the English message are kept, so clients can still branch on them.
+func localizeError(w http.ResponseWriter, lang string, payload any) any {
+	if lang == "" {
+		return payload
+	}
+
+	switch body := payload.(type) {
+	case errorResponse:
+		if message, ok := i18n.Message(lang, body.Error); ok {
+			body.LocalizedMessage = message
+			w.Header().Set("Content-Language", lang)
+			return body
+		}
+	case map[string]string:
+		if message, ok := i18n.Message(lang, body["error"]); ok {
+			localized := make(map[string]string, len(body)+1)
+			for key, value := range body {
+				localized[key] = value
+			}
+			localized["localizedMessage"] = message
+			w.Header().Set("Content-Language", lang)
+			return localized
+		}
+	}
+	return payload
+}
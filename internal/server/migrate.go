@@ -0,0 +1,496 @@
+package server
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+	"github.com/mtolmacs/planemgr/internal/server/user"
+)
+
+// migrationFormat versions the archives ExportInstance writes.
+const migrationFormat = "planemgr-migration/1"
+
+// Top-level entries of a migration archive. The manifest comes first, then
+// a directory per chart, trashed chart and secure store subject.
+const (
+	migrationManifestFile = "manifest.json"
+	migrationCharts       = "charts"
+	migrationTrash        = "trash"
+	migrationSecure       = "secure"
+)
+
+// migrationSealedSuffix marks archive files encrypted with the migration
+// passphrase instead of copied as they are.
+const migrationSealedSuffix = ".sealed"
+
+// migrationSealedMeta are the chart metadata documents holding secrets.
+var migrationSealedMeta = []string{chartWebhooksMeta, chartRunTasksMeta}
+
+var (
+	ErrInvalidMigrationArchive = errors.New("invalid migration archive")
+	ErrMigrationPassphrase     = errors.New("wrong migration passphrase")
+	ErrMigrationConflict       = errors.New("instance already holds data of the archive")
+)
+
+type migrationManifest struct {
+	Format     string   `json:"format"`
+	ExportedAt string   `json:"exportedAt"`
+	Charts     []string `json:"charts"`
+	Trashed    []string `json:"trashed"`
+	Subjects   []string `json:"subjects"` // Users and service accounts of the secure store
+	Check      string   `json:"check"`    // The format sealed with the passphrase, to check it before importing
+}
+
+// MigrationSummary counts what a migration archive moved.
+type MigrationSummary struct {
+	Charts   int
+	Trashed  int
+	Subjects int
+}
+
+// ExportInstance writes every chart with its history and metadata, the trash
+// and the secure store to w as a tar.gz archive ImportInstance reads on
+// another instance. Chart secrets, stored secrets and service account keys
+// are sealed with passphrase; user keys stay encrypted with the passwords of
+// their users.
+// The server should be stopped, so the archive is consistent.
+func ExportInstance(w io.Writer, passphrase string) (MigrationSummary, error) {
+	if strings.TrimSpace(passphrase) == "" {
+		return MigrationSummary{}, ErrMigrationPassphrase
+	}
+	check, err := user.EncryptPrivateKey(passphrase, migrationFormat)
+	if err != nil {
+		return MigrationSummary{}, err
+	}
+
+	manifest := migrationManifest{
+		Format:     migrationFormat,
+		ExportedAt: time.Now().UTC().Format(time.RFC3339),
+		Check:      check,
+	}
+	if manifest.Charts, err = migrationChartIDs(chart.ChartWorkdir()); err != nil {
+		return MigrationSummary{}, err
+	}
+	if manifest.Trashed, err = migrationChartIDs(chart.TrashWorkdir()); err != nil {
+		return MigrationSummary{}, err
+	}
+	if manifest.Subjects, err = migrationSubjects(); err != nil {
+		return MigrationSummary{}, err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return MigrationSummary{}, err
+	}
+	if err := writeMigrationFile(tw, migrationManifestFile, 0o644, append(data, '\n')); err != nil {
+		return MigrationSummary{}, err
+	}
+
+	for _, chartID := range manifest.Charts {
+		dir := filepath.Join(chart.ChartWorkdir(), chartID)
+		if err := addMigrationTree(tw, dir, path.Join(migrationCharts, chartID), passphrase, sealChartTree(dir)); err != nil {
+			return MigrationSummary{}, err
+		}
+	}
+	for _, chartID := range manifest.Trashed {
+		dir := filepath.Join(chart.TrashWorkdir(), chartID)
+		if err := addMigrationTree(tw, dir, path.Join(migrationTrash, chartID), passphrase, sealChartTree(dir)); err != nil {
+			return MigrationSummary{}, err
+		}
+	}
+	for _, subject := range manifest.Subjects {
+		seal := sealSubjectSecrets(subject)
+		if name, ok := strings.CutPrefix(subject, auth.ServiceAccountPrefix); ok {
+			seal = sealServiceAccountKey(name)
+		}
+		dir := filepath.Join(user.SecureStoreDir(), subject)
+		if err := addMigrationTree(tw, dir, path.Join(migrationSecure, subject), passphrase, seal); err != nil {
+			return MigrationSummary{}, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return MigrationSummary{}, err
+	}
+	if err := gz.Close(); err != nil {
+		return MigrationSummary{}, err
+	}
+	return MigrationSummary{Charts: len(manifest.Charts), Trashed: len(manifest.Trashed), Subjects: len(manifest.Subjects)}, nil
+}
+
+// ImportInstance restores an archive of ExportInstance, keeping the chart
+// IDs and subjects. Nothing is imported when the instance already has any
+// of them. Service account keys are encrypted for SESSION_SECRET of this
+// instance.
+func ImportInstance(r io.Reader, passphrase string) (MigrationSummary, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return MigrationSummary{}, fmt.Errorf("%w: %v", ErrInvalidMigrationArchive, err)
+	}
+	tr := tar.NewReader(gz)
+
+	header, err := tr.Next()
+	if err != nil || header.Name != migrationManifestFile {
+		return MigrationSummary{}, fmt.Errorf("%w: missing %s", ErrInvalidMigrationArchive, migrationManifestFile)
+	}
+	var manifest migrationManifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return MigrationSummary{}, fmt.Errorf("%w: %v", ErrInvalidMigrationArchive, err)
+	}
+	if manifest.Format != migrationFormat {
+		return MigrationSummary{}, fmt.Errorf("%w: unsupported format %q", ErrInvalidMigrationArchive, manifest.Format)
+	}
+	if check, err := user.DecryptPrivateKey(passphrase, manifest.Check); err != nil || check != migrationFormat {
+		return MigrationSummary{}, ErrMigrationPassphrase
+	}
+	if err := checkMigrationConflicts(manifest); err != nil {
+		return MigrationSummary{}, err
+	}
+
+	targets := map[string]string{
+		migrationCharts: chart.ChartWorkdir(),
+		migrationTrash:  chart.TrashWorkdir(),
+		migrationSecure: user.SecureStoreDir(),
+	}
+	members := map[string][]string{
+		migrationCharts: manifest.Charts,
+		migrationTrash:  manifest.Trashed,
+		migrationSecure: manifest.Subjects,
+	}
+	// Entries are unpacked next to their targets first and only moved in
+	// once the whole archive was read.
+	stage := ".import-" + uuid.NewString()
+	for top, dir := range targets {
+		mode := os.FileMode(0o755)
+		if top == migrationSecure {
+			mode = 0o700
+		}
+		if err := os.MkdirAll(dir, mode); err != nil {
+			return MigrationSummary{}, err
+		}
+		if err := os.MkdirAll(filepath.Join(dir, stage), 0o700); err != nil {
+			return MigrationSummary{}, err
+		}
+		defer os.RemoveAll(filepath.Join(dir, stage))
+	}
+
+	serviceKeys := map[string]string{}
+	secrets := map[string]string{}
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return MigrationSummary{}, fmt.Errorf("%w: %v", ErrInvalidMigrationArchive, err)
+		}
+
+		top, rest, _ := strings.Cut(path.Clean(header.Name), "/")
+		member, rel, _ := strings.Cut(rest, "/")
+		if !slices.Contains(members[top], member) || (rel != "" && !filepath.IsLocal(rel)) {
+			return MigrationSummary{}, fmt.Errorf("%w: unexpected entry %q", ErrInvalidMigrationArchive, header.Name)
+		}
+		target := filepath.Join(targets[top], stage, member, filepath.FromSlash(rel))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, header.FileInfo().Mode().Perm()|0o700); err != nil {
+				return MigrationSummary{}, err
+			}
+		case tar.TypeReg:
+			if !strings.HasSuffix(rel, migrationSealedSuffix) {
+				if err := writeMigrationTarget(target, header.FileInfo().Mode().Perm(), tr); err != nil {
+					return MigrationSummary{}, err
+				}
+				continue
+			}
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return MigrationSummary{}, fmt.Errorf("%w: %v", ErrInvalidMigrationArchive, err)
+			}
+			plaintext, err := user.DecryptPrivateKey(passphrase, string(data))
+			if err != nil {
+				return MigrationSummary{}, fmt.Errorf("%w: %s: %v", ErrInvalidMigrationArchive, header.Name, err)
+			}
+			// Service account keys and secrets are stored again once their
+			// subject is in place, encrypted for this instance.
+			if top == migrationSecure && rel == user.SecretsFile+migrationSealedSuffix {
+				secrets[member] = plaintext
+				continue
+			}
+			if top == migrationSecure && strings.HasPrefix(member, auth.ServiceAccountPrefix) {
+				serviceKeys[member] = plaintext
+				continue
+			}
+			plaintext, err = resealChartFile(strings.TrimSuffix(rel, migrationSealedSuffix), plaintext)
+			if err != nil {
+				return MigrationSummary{}, fmt.Errorf("%w: %s: %v", ErrInvalidMigrationArchive, header.Name, err)
+			}
+			target = strings.TrimSuffix(target, migrationSealedSuffix)
+			if err := writeMigrationTarget(target, 0o600, strings.NewReader(plaintext+"\n")); err != nil {
+				return MigrationSummary{}, err
+			}
+		default:
+			return MigrationSummary{}, fmt.Errorf("%w: unsupported entry %q", ErrInvalidMigrationArchive, header.Name)
+		}
+	}
+
+	for top, dir := range targets {
+		for _, member := range members[top] {
+			if err := os.Rename(filepath.Join(dir, stage, member), filepath.Join(dir, member)); err != nil {
+				return MigrationSummary{}, err
+			}
+		}
+	}
+	for subject, privateKey := range serviceKeys {
+		account, err := user.LoadServiceAccount(strings.TrimPrefix(subject, auth.ServiceAccountPrefix))
+		if err != nil {
+			return MigrationSummary{}, err
+		}
+		publicKey, err := user.LoadUserPublicKey(subject)
+		if err != nil {
+			return MigrationSummary{}, err
+		}
+		if err := user.StoreServiceAccountKeyPair(account, publicKey, privateKey); err != nil {
+			return MigrationSummary{}, err
+		}
+	}
+	for subject, exported := range secrets {
+		if err := user.ImportSecrets(subject, exported); err != nil {
+			return MigrationSummary{}, err
+		}
+	}
+
+	return MigrationSummary{Charts: len(manifest.Charts), Trashed: len(manifest.Trashed), Subjects: len(manifest.Subjects)}, nil
+}
+
+// migrationSeal reports whether the file at rel, relative to the exported
+// directory, holds secrets. The plaintext to seal is returned when it isn't
+// the file content.
+type migrationSeal func(rel string) (plaintext string, sealed bool, err error)
+
+// sealSubjectSecrets seals the secrets of subject decrypted, as
+// SESSION_SECRET of the importing instance differs.
+func sealSubjectSecrets(subject string) migrationSeal {
+	return func(rel string) (string, bool, error) {
+		if rel != user.SecretsFile {
+			return "", false, nil
+		}
+		return user.ExportSecrets(subject)
+	}
+}
+
+// sealServiceAccountKey seals the private key and the secrets of the service
+// account name decrypted, as SESSION_SECRET of the importing instance
+// differs.
+func sealServiceAccountKey(name string) migrationSeal {
+	sealSecrets := sealSubjectSecrets(auth.ServiceAccountPrefix + name)
+	return func(rel string) (string, bool, error) {
+		if rel != "id_ed25519" {
+			return sealSecrets(rel)
+		}
+		account, err := user.LoadServiceAccount(name)
+		if err != nil {
+			return "", false, err
+		}
+		_, privateKey, err := user.LoadServiceAccountKeyPair(account)
+		if err != nil {
+			return "", false, err
+		}
+		return privateKey, true, nil
+	}
+}
+
+// sealChartTree seals the secret metadata and the state of the chart
+// directory dir. The secrets of the metadata are decrypted first, as the
+// importing instance encrypts them with its own SESSION_SECRET.
+func sealChartTree(dir string) migrationSeal {
+	return func(rel string) (string, bool, error) {
+		if chart.IsChartState(rel) {
+			return "", true, nil
+		}
+		name, ok := chart.ChartMetaName(rel)
+		if !ok || !slices.Contains(migrationSealedMeta, name) {
+			return "", false, nil
+		}
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(rel)))
+		if err != nil {
+			return "", false, err
+		}
+		plaintext, err := convertChartSecrets(name, data, openChartSecret)
+		if err != nil {
+			return "", false, fmt.Errorf("%s: %w", rel, err)
+		}
+		return string(plaintext), true, nil
+	}
+}
+
+// resealChartFile encrypts the secrets of a chart file sealChartTree
+// exported, stored at rel in the chart directory, for this instance.
+func resealChartFile(rel, plaintext string) (string, error) {
+	name, ok := chart.ChartMetaName(rel)
+	if !ok || !slices.Contains(migrationSealedMeta, name) {
+		return plaintext, nil
+	}
+	data, err := convertChartSecrets(name, []byte(plaintext), sealChartSecret)
+	return string(data), err
+}
+
+func addMigrationTree(tw *tar.Writer, dir, prefix, passphrase string, seal migrationSeal) error {
+	return filepath.WalkDir(dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		name := path.Join(prefix, filepath.ToSlash(rel))
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case entry.IsDir():
+			return tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: name + "/", Mode: int64(info.Mode().Perm()), ModTime: info.ModTime()})
+		case !info.Mode().IsRegular():
+			return nil
+		}
+
+		if seal != nil {
+			plaintext, sealed, err := seal(filepath.ToSlash(rel))
+			if err != nil {
+				return err
+			}
+			if sealed {
+				if plaintext == "" {
+					data, err := os.ReadFile(file)
+					if err != nil {
+						return err
+					}
+					plaintext = string(data)
+				}
+				ciphertext, err := user.EncryptPrivateKey(passphrase, plaintext)
+				if err != nil {
+					return err
+				}
+				return writeMigrationFile(tw, name+migrationSealedSuffix, 0o600, []byte(ciphertext))
+			}
+		}
+
+		source, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer source.Close()
+		header := &tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: int64(info.Mode().Perm()), Size: info.Size(), ModTime: info.ModTime()}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err = io.CopyN(tw, source, info.Size())
+		return err
+	})
+}
+
+func writeMigrationFile(tw *tar.Writer, name string, mode int64, data []byte) error {
+	header := &tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: mode, Size: int64(len(data)), ModTime: time.Now()}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+func writeMigrationTarget(target string, mode fs.FileMode, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// migrationChartIDs lists the chart repositories in dir.
+func migrationChartIDs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() && chart.IsChartID(entry.Name()) {
+			ids = append(ids, entry.Name())
+		}
+	}
+	return ids, nil
+}
+
+// migrationSubjects lists the users and service accounts of the secure store.
+func migrationSubjects() ([]string, error) {
+	entries, err := os.ReadDir(user.SecureStoreDir())
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	subjects := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			subjects = append(subjects, entry.Name())
+		}
+	}
+	return subjects, nil
+}
+
+func checkMigrationConflicts(manifest migrationManifest) error {
+	var conflicts []string
+	for _, chartID := range append(slices.Clone(manifest.Charts), manifest.Trashed...) {
+		if !chart.IsChartID(chartID) {
+			return fmt.Errorf("%w: invalid chart id %q", ErrInvalidMigrationArchive, chartID)
+		}
+		for _, dir := range []string{chart.ChartWorkdir(), chart.TrashWorkdir()} {
+			if _, err := os.Stat(filepath.Join(dir, chartID)); err == nil {
+				conflicts = append(conflicts, "chart "+chartID)
+			}
+		}
+	}
+	for _, subject := range manifest.Subjects {
+		if subject != filepath.Base(subject) || strings.HasPrefix(subject, ".") || subject == "" {
+			return fmt.Errorf("%w: invalid subject %q", ErrInvalidMigrationArchive, subject)
+		}
+		if _, err := os.Stat(filepath.Join(user.SecureStoreDir(), subject)); err == nil {
+			conflicts = append(conflicts, "subject "+subject)
+		}
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("%w: %s", ErrMigrationConflict, strings.Join(conflicts, ", "))
+	}
+	return nil
+}
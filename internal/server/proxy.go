@@ -0,0 +1,120 @@
+package server
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	trustedProxyPrefixes     []netip.Prefix
+	trustedProxyPrefixesOnce sync.Once
+)
+
+// trustedProxies returns the addresses of the reverse proxies in front of the
+// server, from the comma-separated IPs and CIDRs of TRUSTED_PROXIES. Only
+// their X-Forwarded-* headers are believed.
+func trustedProxies() []netip.Prefix {
+	trustedProxyPrefixesOnce.Do(func() {
+		for value := range strings.SplitSeq(os.Getenv("TRUSTED_PROXIES"), ",") {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				continue
+			}
+			prefix, err := netip.ParsePrefix(value)
+			if err != nil {
+				addr, addrErr := netip.ParseAddr(value)
+				if addrErr != nil {
+					log.Printf("Ignoring invalid TRUSTED_PROXIES entry %q", value)
+					continue
+				}
+				prefix = netip.PrefixFrom(addr, addr.BitLen())
+			}
+			trustedProxyPrefixes = append(trustedProxyPrefixes, prefix.Masked())
+		}
+	})
+	return trustedProxyPrefixes
+}
+
+func isTrustedProxy(addr netip.Addr, proxies []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range proxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// withTrustedProxies rewrites requests relayed by a trusted proxy to look as
+// they did to the proxy: RemoteAddr becomes the client address from
+// X-Forwarded-For or X-Real-IP, and the scheme and host of X-Forwarded-Proto
+// and X-Forwarded-Host are set on URL.Scheme and Host for building absolute
+// URLs. The headers of other peers are ignored, as anyone can send them.
+func withTrustedProxies(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxies := trustedProxies()
+		if len(proxies) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		peer, err := netip.ParseAddrPort(r.RemoteAddr)
+		if err != nil || !isTrustedProxy(peer.Addr(), proxies) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r = r.Clone(r.Context())
+		if client, ok := forwardedClient(r.Header, proxies); ok {
+			r.RemoteAddr = net.JoinHostPort(client.String(), "0")
+		}
+		switch proto := strings.ToLower(firstHeaderValue(r.Header.Get("X-Forwarded-Proto"))); proto {
+		case "http", "https":
+			r.URL.Scheme = proto
+		}
+		if host := firstHeaderValue(r.Header.Get("X-Forwarded-Host")); host != "" {
+			r.Host = host
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardedClient returns the client address a chain of trusted proxies
+// relayed the request for. X-Forwarded-For is read from the right, as every
+// proxy appends the peer it saw and only the entries added by trusted
+// proxies can be believed; the first untrusted address is the client.
+func forwardedClient(header http.Header, proxies []netip.Prefix) (netip.Addr, bool) {
+	var hops []string
+	for _, value := range header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	var client netip.Addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = addr.Unmap()
+		if !isTrustedProxy(client, proxies) {
+			return client, true
+		}
+	}
+	if client.IsValid() {
+		return client, true
+	}
+
+	addr, err := netip.ParseAddr(strings.TrimSpace(header.Get("X-Real-IP")))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+func firstHeaderValue(value string) string {
+	first, _, _ := strings.Cut(value, ",")
+	return strings.TrimSpace(first)
+}
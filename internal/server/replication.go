@@ -0,0 +1,426 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+	"github.com/mtolmacs/planemgr/internal/server/user"
+)
+
+const (
+	// maxReplicaBytes caps the archive of a chart a standby accepts.
+	maxReplicaBytes = 1 << 30
+	// replicaMaxSkew is how far the time a replica was signed at may be off,
+	// so a captured push can't be replayed later to roll a chart back.
+	replicaMaxSkew = 5 * time.Minute
+)
+
+const (
+	replicaSignatureHeader = "X-Planemgr-Signature"
+	replicaTimestampHeader = "X-Planemgr-Timestamp"
+)
+
+type replicationChartsResponse struct {
+	Charts []string `json:"charts"`
+}
+
+// replicaTimestamps holds the time of the last replica applied per chart,
+// so pushes overtaken by a newer one are refused.
+var replicaTimestamps = struct {
+	mu   sync.Mutex
+	last map[string]int64
+}{
+	last: map[string]int64{},
+}
+
+// standbyReplicator pushes the charts of this instance to a standby.
+type standbyReplicator struct {
+	target string
+	secret string
+	client *http.Client
+	pushed map[string]string // Fingerprint of the chart directory last pushed, by chart ID
+}
+
+// StartStandbyReplication pushes every chart with its history, metadata and
+// state to the standby at STANDBY_URL every REPLICATION_INTERVAL, one
+// minute by default, when it is set. Only charts that changed since their
+// last push are sent again, and charts gone here are deleted there. Chart
+// secrets and state are sealed with REPLICATION_SECRET, which the standby
+// needs too.
+func StartStandbyReplication() error {
+	target := strings.TrimSuffix(os.Getenv("STANDBY_URL"), "/")
+	if target == "" {
+		return nil
+	}
+	parsed, err := url.Parse(target)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("STANDBY_URL must be an http or https URL, got %q", target)
+	}
+	secret := os.Getenv("REPLICATION_SECRET")
+	if strings.TrimSpace(secret) == "" {
+		return errors.New("STANDBY_URL requires REPLICATION_SECRET")
+	}
+	interval := time.Minute
+	if value := os.Getenv("REPLICATION_INTERVAL"); value != "" {
+		if interval, err = time.ParseDuration(value); err != nil || interval <= 0 {
+			return fmt.Errorf("REPLICATION_INTERVAL must be a positive duration, got %q", value)
+		}
+	}
+
+	replicator := &standbyReplicator{
+		target: target,
+		secret: secret,
+		client: &http.Client{Timeout: 10 * time.Minute},
+		pushed: map[string]string{},
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			replicator.replicate()
+			<-ticker.C
+		}
+	}()
+	return nil
+}
+
+// replicate pushes the charts changed since their last push and deletes
+// those the standby holds but this instance doesn't.
+func (s *standbyReplicator) replicate() {
+	chartIDs, err := migrationChartIDs(chart.ChartWorkdir())
+	if err != nil {
+		log.Printf("Listing charts to replicate failed: %v", err)
+		return
+	}
+
+	for _, chartID := range chartIDs {
+		dir := filepath.Join(chart.ChartWorkdir(), chartID)
+		fingerprint, err := replicaFingerprint(dir)
+		if err != nil {
+			log.Printf("Replicating chart %s failed: %v", chartID, err)
+			continue
+		}
+		if s.pushed[chartID] == fingerprint {
+			continue
+		}
+		archive, err := replicaArchive(chartID, s.secret)
+		if err != nil {
+			log.Printf("Replicating chart %s failed: %v", chartID, err)
+			continue
+		}
+		// A chart written to meanwhile may have been archived half way, as
+		// with refs pointing at objects that weren't; it is sent next time.
+		if after, err := replicaFingerprint(dir); err != nil || after != fingerprint {
+			continue
+		}
+		if err := s.send(http.MethodPut, "/api/replication/chart/"+chartID, archive, nil); err != nil {
+			log.Printf("Replicating chart %s failed: %v", chartID, err)
+			continue
+		}
+		s.pushed[chartID] = fingerprint
+	}
+
+	var replicated replicationChartsResponse
+	if err := s.send(http.MethodGet, "/api/replication/chart", nil, &replicated); err != nil {
+		log.Printf("Listing charts of the standby failed: %v", err)
+		return
+	}
+	for _, chartID := range replicated.Charts {
+		if slices.Contains(chartIDs, chartID) || !chart.IsChartID(chartID) {
+			continue
+		}
+		if err := s.send(http.MethodDelete, "/api/replication/chart/"+chartID, nil, nil); err != nil {
+			log.Printf("Deleting chart %s from the standby failed: %v", chartID, err)
+			continue
+		}
+		delete(s.pushed, chartID)
+	}
+}
+
+// send makes a signed request to the standby and decodes its answer into
+// response when given.
+func (s *standbyReplicator) send(method, route string, body []byte, response any) error {
+	req, err := http.NewRequest(method, s.target+route, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(replicaTimestampHeader, timestamp)
+	req.Header.Set(replicaSignatureHeader, "sha256="+replicaSignature(s.secret, method, route, timestamp, body))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/gzip")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var failure errorResponse
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&failure)
+		return fmt.Errorf("standby answered %d %s", resp.StatusCode, strings.TrimSpace(failure.Error+" "+failure.Message))
+	}
+	if response != nil {
+		return json.NewDecoder(resp.Body).Decode(response)
+	}
+	return nil
+}
+
+// replicaSignature is the hex HMAC-SHA256 of a replication request with the
+// shared secret, binding the body to its method, route and time.
+func replicaSignature(secret, method, route, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n", method, route, timestamp)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// replicaFingerprint summarizes the names, sizes and modification times of
+// the files of a chart directory, which change with every write.
+func replicaFingerprint(dir string) (string, error) {
+	hash := sha256.New()
+	err := filepath.WalkDir(dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(hash, "%s\x00%d\x00%d\n", file, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return hex.EncodeToString(hash.Sum(nil)), err
+}
+
+// replicaArchive packs a chart directory as a tar.gz archive, sealing its
+// secrets and state with secret as migration archives do.
+func replicaArchive(chartID, secret string) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	dir := filepath.Join(chart.ChartWorkdir(), chartID)
+	if err := addMigrationTree(tw, dir, chartID, secret, sealChartTree(dir)); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// HandleReplicationCharts handles /api/replication/chart requests.
+// @Summary List replicated charts
+// @Description Lists the charts a standby holds, for the instance replicating to it to delete those it no longer has. Only instances with REPLICATION_SECRET and without a STANDBY_URL of their own answer, to requests signed with the secret in X-Planemgr-Signature as "sha256=" and the hex HMAC-SHA256 of the method, route and X-Planemgr-Timestamp, each followed by a newline, and the body.
+// @Tags replication
+// @Produce json
+// @Param X-Planemgr-Signature header string true "Request signature"
+// @Param X-Planemgr-Timestamp header string true "Unix time of the request"
+// @Success 200 {object} replicationChartsResponse
+// @Failure 401 {object} errorResponse "`invalid_signature`"
+// @Failure 404 {object} errorResponse "`replication_disabled`"
+// @Failure 500 {object} errorResponse "`replication_failed`"
+// @Router /replication/chart [get]
+func HandleReplicationCharts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+		return
+	}
+	if _, ok := verifyReplicaRequest(w, r); !ok {
+		return
+	}
+
+	chartIDs, err := migrationChartIDs(chart.ChartWorkdir())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "replication_failed", Message: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, replicationChartsResponse{Charts: chartIDs})
+}
+
+// HandleReplicationChart handles /api/replication/chart/{id} requests.
+// @Summary Replicate a chart
+// @Description PUT replaces the chart on a standby with the tar.gz archive of the chart directory in the body, holding its history, metadata and state, with secrets and state sealed with REPLICATION_SECRET. DELETE removes the chart. Requests are signed as for GET /api/replication/chart, and those older than the last one applied to the chart or five minutes off are refused.
+// @Tags replication
+// @Accept application/gzip
+// @Produce json
+// @Param id path string true "Chart ID"
+// @Param X-Planemgr-Signature header string true "Request signature"
+// @Param X-Planemgr-Timestamp header string true "Unix time of the request"
+// @Success 204
+// @Failure 400 {object} errorResponse "`invalid chart id`, `invalid_replica`"
+// @Failure 401 {object} errorResponse "`invalid_signature`"
+// @Failure 404 {object} errorResponse "`replication_disabled`"
+// @Failure 409 {object} errorResponse "`replica_outdated`"
+// @Failure 500 {object} errorResponse "`replication_failed`"
+// @Router /replication/chart/{id} [put]
+// @Router /replication/chart/{id} [delete]
+func HandleReplicationChart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		w.Header().Set("Allow", "PUT, DELETE")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+		return
+	}
+	body, ok := verifyReplicaRequest(w, r)
+	if !ok {
+		return
+	}
+
+	chartID := r.PathValue("id")
+	timestamp, _ := strconv.ParseInt(r.Header.Get(replicaTimestampHeader), 10, 64)
+	replicaTimestamps.mu.Lock()
+	defer replicaTimestamps.mu.Unlock()
+	if timestamp < replicaTimestamps.last[chartID] {
+		writeJSON(w, http.StatusConflict, errorResponse{Error: "replica_outdated", Message: "a newer replica of the chart was applied"})
+		return
+	}
+
+	target := filepath.Join(chart.ChartWorkdir(), chartID)
+	if r.Method == http.MethodDelete {
+		if err := os.RemoveAll(target); err != nil {
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "replication_failed", Message: err.Error()})
+			return
+		}
+	} else if err := applyReplica(chartID, body); errors.Is(err, ErrInvalidMigrationArchive) {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_replica", Message: err.Error()})
+		return
+	} else if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "replication_failed", Message: err.Error()})
+		return
+	}
+	replicaTimestamps.last[chartID] = timestamp
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verifyReplicaRequest reads the body of a replication request and checks
+// its signature. It writes the error and returns false when replication to
+// this instance is disabled or the request isn't signed with the secret.
+func verifyReplicaRequest(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	secret := os.Getenv("REPLICATION_SECRET")
+	if strings.TrimSpace(secret) == "" || os.Getenv("STANDBY_URL") != "" {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "replication_disabled", Message: "this instance isn't a standby"})
+		return nil, false
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxReplicaBytes))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_replica", Message: err.Error()})
+		return nil, false
+	}
+	timestamp := r.Header.Get(replicaTimestampHeader)
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	signature, _ := strings.CutPrefix(r.Header.Get(replicaSignatureHeader), "sha256=")
+	expected := replicaSignature(secret, r.Method, r.URL.Path, timestamp, body)
+	if err != nil || time.Since(time.Unix(signedAt, 0)).Abs() > replicaMaxSkew || !hmac.Equal([]byte(signature), []byte(expected)) {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "invalid_signature"})
+		return nil, false
+	}
+	return body, true
+}
+
+// applyReplica unpacks the archive of a chart next to the chart directory
+// and swaps it in once complete.
+func applyReplica(chartID string, archive []byte) error {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidMigrationArchive, err)
+	}
+	tr := tar.NewReader(gz)
+
+	workdir := chart.ChartWorkdir()
+	stage := filepath.Join(workdir, ".replica-"+uuid.NewString())
+	if err := os.MkdirAll(stage, 0o700); err != nil {
+		return err
+	}
+	defer os.RemoveAll(stage)
+
+	secret := os.Getenv("REPLICATION_SECRET")
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidMigrationArchive, err)
+		}
+
+		member, rel, _ := strings.Cut(path.Clean(header.Name), "/")
+		if member != chartID || (rel != "" && !filepath.IsLocal(rel)) {
+			return fmt.Errorf("%w: unexpected entry %q", ErrInvalidMigrationArchive, header.Name)
+		}
+		target := filepath.Join(stage, chartID, filepath.FromSlash(rel))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, header.FileInfo().Mode().Perm()|0o700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if !strings.HasSuffix(rel, migrationSealedSuffix) {
+				if err := writeMigrationTarget(target, header.FileInfo().Mode().Perm(), tr); err != nil {
+					return err
+				}
+				continue
+			}
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidMigrationArchive, err)
+			}
+			plaintext, err := user.DecryptPrivateKey(secret, string(data))
+			if err != nil {
+				return fmt.Errorf("%w: %s: %v", ErrInvalidMigrationArchive, header.Name, err)
+			}
+			plaintext, err = resealChartFile(strings.TrimSuffix(rel, migrationSealedSuffix), plaintext)
+			if err != nil {
+				return fmt.Errorf("%w: %s: %v", ErrInvalidMigrationArchive, header.Name, err)
+			}
+			if err := writeMigrationTarget(strings.TrimSuffix(target, migrationSealedSuffix), 0o600, strings.NewReader(plaintext+"\n")); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w: unsupported entry %q", ErrInvalidMigrationArchive, header.Name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(stage, chartID)); err != nil {
+		return fmt.Errorf("%w: empty archive", ErrInvalidMigrationArchive)
+	}
+
+	target := filepath.Join(workdir, chartID)
+	replaced := filepath.Join(stage, "replaced")
+	if err := os.Rename(target, replaced); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Rename(filepath.Join(stage, chartID), target); err != nil {
+		// Put the previous replica back rather than leave the chart missing.
+		_ = os.Rename(replaced, target)
+		return err
+	}
+	return nil
+}
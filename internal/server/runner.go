@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/deploy"
+)
+
+// StartRunnerImageScan scans the runner image in the background when
+// RUNNER_IMAGE_SCAN is "true". Call it once the runner image is verified.
+func StartRunnerImageScan() {
+	if os.Getenv("RUNNER_IMAGE_SCAN") != "true" {
+		return
+	}
+
+	go func() {
+		scan, err := deploy.ScanRunnerImage(context.Background())
+		if err != nil {
+			log.Printf("Runner image scan failed: %v", err)
+			return
+		}
+		log.Printf("Runner image %s has %d critical vulnerabilities", scan.Image, scan.Counts[deploy.SeverityCritical])
+	}()
+}
+
+// StartServiceAddressCheck validates the address runners call the server
+// back at, and checks in the background that it reaches this server once it
+// is listening. An unreachable address is only logged, as the server may not
+// see the network the way runners do.
+func StartServiceAddressCheck() error {
+	address := deploy.ServiceAddress()
+	for _, allowed := range deploy.AllowedServiceAddresses() {
+		if err := deploy.ValidateServiceAddress(allowed); err != nil {
+			return err
+		}
+	}
+	log.Printf("Runners reach the server at %s", address)
+
+	go func() {
+		client := &http.Client{Timeout: 2 * time.Second}
+		for attempt := 0; attempt < 10; attempt++ {
+			time.Sleep(time.Second)
+			resp, err := client.Get("http://" + address + "/api/health")
+			if err == nil {
+				resp.Body.Close()
+				return
+			}
+		}
+		log.Printf("Service address %s doesn't reach this server; set SERVICE_ADDRESS if deploys can't clone charts", address)
+	}()
+	return nil
+}
+
+// runnerImageMaxCritical reads RUNNER_IMAGE_MAX_CRITICAL, the number of
+// critical vulnerabilities in the runner image above which deploys are
+// blocked. Deploys are never blocked when it is unset.
+func runnerImageMaxCritical() (int, bool) {
+	value := strings.TrimSpace(os.Getenv("RUNNER_IMAGE_MAX_CRITICAL"))
+	if value == "" {
+		return 0, false
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 0 {
+		log.Printf("Ignoring invalid RUNNER_IMAGE_MAX_CRITICAL %q", value)
+		return 0, false
+	}
+	return limit, true
+}
+
+// HandleRunnerImageScan handles /api/runner/image-scan requests.
+func HandleRunnerImageScan(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.RequireAccessTokenClaims(r); err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		HandleRunnerImageScanGet(w, r)
+	case http.MethodPost:
+		HandleRunnerImageScanRun(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+	}
+}
+
+// HandleRunnerImageScanGet handles GET /api/runner/image-scan requests.
+// @Summary Get runner image scan
+// @Description Returns the latest trivy vulnerability report of the runner image, with counts per severity.
+// @Tags runner
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} deploy.ImageScan
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`not_scanned`"
+// @Router /runner/image-scan [get]
+func HandleRunnerImageScanGet(w http.ResponseWriter, _ *http.Request) {
+	scan, ok := deploy.LastRunnerImageScan()
+	if !ok {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "not_scanned", Message: "runner image was not scanned yet"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, scan)
+}
+
+// HandleRunnerImageScanRun handles POST /api/runner/image-scan requests.
+// @Summary Scan runner image
+// @Description Scans the runner image with trivy right away and returns the report.
+// @Tags runner
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} deploy.ImageScan
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 500 {object} errorResponse "`scan_failed`"
+// @Router /runner/image-scan [post]
+func HandleRunnerImageScanRun(w http.ResponseWriter, r *http.Request) {
+	scan, err := deploy.ScanRunnerImage(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "scan_failed", Message: err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, scan)
+}
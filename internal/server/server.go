@@ -2,6 +2,9 @@ package server
 
 import (
 	"net/http"
+	"strings"
+
+	"github.com/mtolmacs/planemgr/internal/server/chart"
 )
 
 // New wires the API routes and optional static asset handler.
@@ -10,10 +13,88 @@ func New() http.Handler {
 	mux.HandleFunc("/api/health", HandleHealth)
 	mux.HandleFunc("/api/auth", HandleAuth)
 	mux.HandleFunc("/api/user", HandleUser)
+	mux.HandleFunc("/api/user/preferences", HandleUserPreferences)
+	mux.HandleFunc("/api/user/notifications", HandleUserNotifications)
+	mux.HandleFunc("/api/user/secrets", HandleUserSecrets)
+	mux.HandleFunc("/api/user/secrets/{name}", HandleUserSecret)
+	mux.HandleFunc("/api/user/notifications/read", HandleUserNotificationsRead)
+	mux.HandleFunc("/api/service-account", HandleServiceAccounts)
+	mux.HandleFunc("/api/service-account/{name}", HandleServiceAccount)
 	mux.HandleFunc("/api/deploy", HandleDeploy)
+	mux.HandleFunc("/api/deploy/{id}", HandleDeployJob)
+	mux.HandleFunc("/api/deploy/{id}/approve", HandleDeployApprove)
+	mux.HandleFunc("/api/deploy/{id}/reject", HandleDeployReject)
+	mux.HandleFunc("/api/deploy/{id}/plan", HandleDeployPlan)
 	mux.HandleFunc("/api/chart", HandleChartCollection)
-	mux.HandleFunc("/api/chart/{id}", HandleChartEntity)
-	mux.HandleFunc("/api/chart/{id}/", HandleChartGit)
+	mux.HandleFunc("/api/chart/report", HandleChartReport)
+	mux.HandleFunc("/api/chart/bootstrap", HandleChartBootstrap)
+	mux.HandleFunc("/api/chart/import", HandleChartImport)
+	mux.HandleFunc("/api/chart/deploy-stats", HandleChartDeployStats)
+	mux.HandleFunc("/api/chart/archived", HandleChartArchived)
+	mux.HandleFunc("/api/chart/trash", HandleChartTrash)
+	mux.HandleFunc("/api/chart/{id}", requireChartID("", HandleChartEntity))
+	mux.HandleFunc("/api/chart/{id}/", requireChartID(".git", HandleChartGit))
+	mux.HandleFunc("/api/chart/{id}/history", requireChartID("", HandleChartHistory))
+	mux.HandleFunc("/api/chart/{id}/commit/{hash}", requireChartID("", HandleChartCommit))
+	mux.HandleFunc("/api/chart/{id}/diff", requireChartID("", HandleChartDiff))
+	mux.HandleFunc("/api/chart/{id}/blame", requireChartID("", HandleChartBlame))
+	mux.HandleFunc("/api/chart/{id}/files", requireChartID("", HandleChartFiles))
+	mux.HandleFunc("/api/chart/{id}/files:read", requireChartID("", HandleChartFiles))
+	mux.HandleFunc("/api/chart/{id}/raw", requireChartID("", HandleChartRaw))
+	mux.HandleFunc("/api/chart/{id}/fmt", requireChartID("", HandleChartFmt))
+	mux.HandleFunc("/api/chart/{id}/events", requireChartID("", HandleChartEvents))
+	mux.HandleFunc("/api/chart/{id}/presence", requireChartID("", HandleChartPresence))
+	mux.HandleFunc("/api/chart/{id}/lock", requireChartID("", HandleChartLock))
+	mux.HandleFunc("/api/chart/{id}/default-branch", requireChartID("", HandleChartDefaultBranch))
+	mux.HandleFunc("/api/chart/{id}/budget", requireChartID("", HandleChartBudget))
+	mux.HandleFunc("/api/chart/{id}/required-tags", requireChartID("", HandleChartRequiredTags))
+	mux.HandleFunc("/api/chart/{id}/commit-policy", requireChartID("", HandleChartCommitPolicy))
+	mux.HandleFunc("/api/chart/{id}/permissions", requireChartID("", HandleChartPermissions))
+	mux.HandleFunc("/api/chart/{id}/deploy-account", requireChartID("", HandleChartDeployAccount))
+	mux.HandleFunc("/api/chart/{id}/run-tasks", requireChartID("", HandleChartRunTasks))
+	mux.HandleFunc("/api/chart/{id}/secrets", requireChartID("", HandleChartSecrets))
+	mux.HandleFunc("/api/chart/{id}/environments", requireChartID("", HandleChartEnvironments))
+	mux.HandleFunc("/api/chart/{id}/environments/{name}/extend", requireChartID("", HandleChartEnvironmentExtend))
+	mux.HandleFunc("/api/chart/{id}/tags", requireChartID("", HandleChartTags))
+	mux.HandleFunc("/api/chart/{id}/pending-changes", requireChartID("", HandleChartPendingChanges))
+	mux.HandleFunc("/api/chart/{id}/deployments", requireChartID("", HandleChartDeployHistory))
+	mux.HandleFunc("/api/chart/{id}/deployments/{deployId}/log", requireChartID("", HandleChartDeployLog))
+	mux.HandleFunc("/api/chart/{id}/revert", requireChartID("", HandleChartRevert))
+	mux.HandleFunc("/api/chart/{id}/merge", requireChartID("", HandleChartMerge))
+	mux.HandleFunc("/api/chart/{id}/cherry-pick", requireChartID("", HandleChartCherryPick))
+	mux.HandleFunc("/api/chart/{id}/copy", requireChartID("", HandleChartCopy))
+	mux.HandleFunc("/api/chart/{id}/squash", requireChartID("", HandleChartSquash))
+	mux.HandleFunc("/api/chart/{id}/archive", requireChartID("", HandleChartArchive))
+	mux.HandleFunc("/api/chart/{id}/export", requireChartID("", HandleChartExport))
+	mux.HandleFunc("/api/chart/{id}/restore", requireChartID("", HandleChartRestore))
+	mux.HandleFunc("/api/chart/{id}/vulnerabilities", requireChartID("", HandleChartVulnerabilities))
+	mux.HandleFunc("/api/chart/{id}/webhooks", requireChartID("", HandleChartWebhooks))
+	mux.HandleFunc("/api/chart/{id}/schema", requireChartID("", HandleChartSchema))
+	mux.HandleFunc("/api/chart/{id}/webhooks/{webhookId}", requireChartID("", HandleChartWebhookDelete))
+	mux.HandleFunc("/api/chart/{id}/rollback", requireChartID("", HandleChartRollback))
+	mux.HandleFunc("/api/chart/{id}/schedules", requireChartID("", HandleChartSchedules))
+	mux.HandleFunc("/api/chart/{id}/schedules/{scheduleId}", requireChartID("", HandleChartScheduleDelete))
+	mux.HandleFunc("/api/chart/{id}/stack/{name}/deploy", requireChartID("", HandleStackDeploy))
+	mux.HandleFunc("/api/chart/{id}/state", requireChartID("", HandleChartState))
+	mux.HandleFunc("/api/chart/{id}/stack/{name}/state", requireChartID("", HandleChartStackState))
+	mux.HandleFunc("/api/chart/{id}/state/versions", requireChartID("", HandleChartStateVersions))
+	mux.HandleFunc("/api/chart/{id}/state/versions/{version}", requireChartID("", HandleChartStateVersion))
+	mux.HandleFunc("/api/chart/{id}/stack/{name}/state/versions", requireChartID("", HandleChartStackStateVersions))
+	mux.HandleFunc("/api/chart/{id}/stack/{name}/state/versions/{version}", requireChartID("", HandleChartStackStateVersion))
+	mux.HandleFunc("/api/chart/{id}/state/import", requireChartID("", HandleChartStateImport))
+	mux.HandleFunc("/api/runner/image-scan", HandleRunnerImageScan)
+	mux.HandleFunc("/api/agent", HandleAgents)
+	mux.HandleFunc("/api/agent/capacity", HandleAgentCapacity)
+	mux.HandleFunc("/api/admin/jobs/summary", HandleJobsSummary)
+	mux.HandleFunc("/api/admin/export", HandleAdminExport)
+	mux.HandleFunc("/api/admin/import", HandleAdminImport)
+	mux.HandleFunc("/api/agent/{id}/jobs", HandleAgentJobs)
+	mux.HandleFunc("/api/agent/{id}/jobs/{jobId}", HandleAgentJobResult)
+	mux.HandleFunc("/api/agent/{id}/jobs/{jobId}/gate", HandleAgentJobGate)
+	mux.HandleFunc("/api/run-tasks/{id}", HandleRunTaskCallback)
+	mux.HandleFunc("/api/replication/chart", HandleReplicationCharts)
+	mux.HandleFunc("/api/replication/chart/{id}", requireChartID("", HandleReplicationChart))
+	mux.HandleFunc("/api/metrics", HandleMetrics)
 	mux.HandleFunc("/api/openapi.json", HandleOpenAPI)
 	mux.HandleFunc("/api/docs", HandleDocsRedirect)
 	mux.Handle("/api/docs/", HandleDocs())
@@ -25,9 +106,27 @@ func New() http.Handler {
 		mux.Handle("/", http.NotFoundHandler())
 	}
 
-	return mux
+	return withTrustedProxies(withJSONOptions(authorizeServiceAccounts(mux)))
 }
 
 func handleApiNotFound(w http.ResponseWriter, _ *http.Request) {
 	writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown endpoint"})
 }
+
+// requireChartID rejects requests whose {id} path value isn't a chart ID
+// before the handler runs, so handlers never build repository paths from
+// arbitrary strings such as "..". Routes git clients use may address the
+// chart with suffix appended, as in {id}.git.
+func requireChartID(suffix string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		chartID := r.PathValue("id")
+		if suffix != "" {
+			chartID = strings.TrimSuffix(chartID, suffix)
+		}
+		if !chart.IsChartID(chartID) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid chart id"})
+			return
+		}
+		next(w, r)
+	}
+}
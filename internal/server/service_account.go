@@ -0,0 +1,406 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+	"github.com/mtolmacs/planemgr/internal/server/user"
+)
+
+// readOnlyPostSuffixes end the paths of POST endpoints that only read, which
+// viewers may call.
+var readOnlyPostSuffixes = []string{"/git-upload-pack", "/files", "/files:read"}
+
+type serviceAccountRequest struct {
+	Name           string             `json:"name,omitempty" example:"ci"` // Only when creating
+	Description    string             `json:"description,omitempty" example:"CI pipeline"`
+	Roles          []auth.RoleBinding `json:"roles"`
+	GenerateSSHKey bool               `json:"generateSshKey,omitempty"` // Only when creating
+	SSHPublicKey   string             `json:"sshPublicKey,omitempty"`   // Only when creating
+	SSHPrivateKey  string             `json:"sshPrivateKey,omitempty"`  // Only when creating
+}
+
+type serviceAccountResponse struct {
+	Name         string             `json:"name"`
+	Subject      string             `json:"subject" example:"service:ci"`
+	Description  string             `json:"description,omitempty"`
+	Roles        []auth.RoleBinding `json:"roles"`
+	SSHPublicKey string             `json:"sshPublicKey,omitempty"`
+	CreatedBy    string             `json:"createdBy"`
+	CreatedAt    string             `json:"createdAt"`
+	// Secret is only returned when the service account is created.
+	Secret string `json:"secret,omitempty"`
+}
+
+type serviceAccountListResponse struct {
+	ServiceAccounts []serviceAccountResponse `json:"serviceAccounts"`
+}
+
+// HandleServiceAccounts handles /api/service-account requests.
+func HandleServiceAccounts(w http.ResponseWriter, r *http.Request) {
+	subject, ok := requireHumanSubject(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		HandleServiceAccountList(w, r)
+	case http.MethodPost:
+		HandleServiceAccountCreate(w, r, subject)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+	}
+}
+
+// HandleServiceAccount handles /api/service-account/{name} requests.
+func HandleServiceAccount(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireHumanSubject(w, r); !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		HandleServiceAccountGet(w, r)
+	case http.MethodPut:
+		HandleServiceAccountPut(w, r)
+	case http.MethodDelete:
+		HandleServiceAccountDelete(w, r)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+	}
+}
+
+// HandleServiceAccountList handles GET /api/service-account requests.
+// @Summary List service accounts
+// @Description Lists the service accounts automation logs in as. Only users can manage service accounts.
+// @Tags service-account
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} serviceAccountListResponse
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 500 {object} errorResponse "`service_account_load_failed`"
+// @Router /service-account [get]
+func HandleServiceAccountList(w http.ResponseWriter, r *http.Request) {
+	accounts, err := user.ListServiceAccounts()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "service_account_load_failed", Message: err.Error()})
+		return
+	}
+
+	response := serviceAccountListResponse{ServiceAccounts: make([]serviceAccountResponse, 0, len(accounts))}
+	for _, account := range accounts {
+		response.ServiceAccounts = append(response.ServiceAccounts, newServiceAccountResponse(account))
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// HandleServiceAccountCreate handles POST /api/service-account requests.
+// @Summary Create service account
+// @Description Creates a service account for CI pipelines, schedulers and other automation, so they don't act as a user with the user's keys. The returned secret is shown only once: log in at POST /api/auth with the subject as username and the secret as password. Tokens of the service account only allow what its role bindings grant: viewers read, editors also change charts, deployers also deploy and run agents and admins also export and import the instance; bindings listing charts only apply to the endpoints of those charts, and admin bindings list none. Only instance admins can grant the admin role. Deploying needs an SSH key pair, generated with generateSshKey or given, which is stored encrypted with a key derived from SESSION_SECRET.
+// @Tags service-account
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body serviceAccountRequest true "Service account"
+// @Success 201 {object} serviceAccountResponse
+// @Failure 400 {object} errorResponse "`invalid_request`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 409 {object} errorResponse "`service_account_exists`"
+// @Failure 500 {object} errorResponse "`key_generation_failed`, `secret_generation_failed`, `service_account_store_failed`, `key_store_failed`"
+// @Router /service-account [post]
+func HandleServiceAccountCreate(w http.ResponseWriter, r *http.Request, subject string) {
+	req, ok := decodeServiceAccountRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := user.ValidateServiceAccountName(req.Name); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: err.Error()})
+		return
+	}
+	if _, err := user.LoadServiceAccount(req.Name); err == nil {
+		writeJSON(w, http.StatusConflict, errorResponse{Error: "service_account_exists", Message: "service account already exists"})
+		return
+	}
+
+	publicKey := strings.TrimSpace(req.SSHPublicKey)
+	privateKey := strings.TrimSpace(req.SSHPrivateKey)
+	var err error
+	switch {
+	case req.GenerateSSHKey:
+		if publicKey != "" || privateKey != "" {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "generateSshKey can't be combined with a given key pair"})
+			return
+		}
+		publicKey, privateKey, err = user.GenerateEd25519KeyPair()
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "key_generation_failed", Message: err.Error()})
+			return
+		}
+	case publicKey != "" || privateKey != "":
+		if publicKey == "" || privateKey == "" {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "sshPublicKey and sshPrivateKey must be provided together"})
+			return
+		}
+		if err := user.ValidateSSHKeyPair(publicKey, privateKey); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: err.Error()})
+			return
+		}
+	}
+
+	secret, secretHash, err := user.NewServiceAccountSecret()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "secret_generation_failed", Message: err.Error()})
+		return
+	}
+	account := user.ServiceAccount{
+		Name:        req.Name,
+		Description: strings.TrimSpace(req.Description),
+		Roles:       req.Roles,
+		CreatedBy:   subject,
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+		SecretHash:  secretHash,
+	}
+	if err := user.StoreServiceAccount(account); err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "service_account_store_failed", Message: err.Error()})
+		return
+	}
+	if privateKey != "" {
+		if err := user.StoreServiceAccountKeyPair(account, publicKey, privateKey); err != nil {
+			_ = user.DeleteServiceAccount(account.Name)
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "key_store_failed", Message: err.Error()})
+			return
+		}
+	}
+
+	response := newServiceAccountResponse(account)
+	response.Secret = secret
+	writeJSON(w, http.StatusCreated, response)
+}
+
+// HandleServiceAccountGet handles GET /api/service-account/{name} requests.
+// @Summary Get service account
+// @Tags service-account
+// @Security BearerAuth
+// @Produce json
+// @Param name path string true "Service account name"
+// @Success 200 {object} serviceAccountResponse
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`service_account_not_found`"
+// @Failure 500 {object} errorResponse "`service_account_load_failed`"
+// @Router /service-account/{name} [get]
+func HandleServiceAccountGet(w http.ResponseWriter, r *http.Request) {
+	account, ok := loadServiceAccount(w, r.PathValue("name"))
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newServiceAccountResponse(account))
+}
+
+// HandleServiceAccountPut handles PUT /api/service-account/{name} requests.
+// @Summary Update service account
+// @Description Replaces the description and role bindings of a service account. Tokens already issued keep their bindings until they are refreshed. Only instance admins can grant the admin role.
+// @Tags service-account
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param name path string true "Service account name"
+// @Param request body serviceAccountRequest true "Description and role bindings"
+// @Success 200 {object} serviceAccountResponse
+// @Failure 400 {object} errorResponse "`invalid_request`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`service_account_not_found`"
+// @Failure 500 {object} errorResponse "`service_account_store_failed`, `service_account_load_failed`"
+// @Router /service-account/{name} [put]
+func HandleServiceAccountPut(w http.ResponseWriter, r *http.Request) {
+	account, ok := loadServiceAccount(w, r.PathValue("name"))
+	if !ok {
+		return
+	}
+	req, ok := decodeServiceAccountRequest(w, r)
+	if !ok {
+		return
+	}
+	if (req.Name != "" && req.Name != account.Name) || req.GenerateSSHKey || req.SSHPublicKey != "" || req.SSHPrivateKey != "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "only the description and roles of a service account can change"})
+		return
+	}
+
+	account.Description = strings.TrimSpace(req.Description)
+	account.Roles = req.Roles
+	if err := user.StoreServiceAccount(account); err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "service_account_store_failed", Message: err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newServiceAccountResponse(account))
+}
+
+// HandleServiceAccountDelete handles DELETE /api/service-account/{name} requests.
+// @Summary Delete service account
+// @Description Deletes a service account with its SSH key pair and logs it out, invalidating its tokens.
+// @Tags service-account
+// @Security BearerAuth
+// @Produce json
+// @Param name path string true "Service account name"
+// @Success 200 {object} serviceAccountResponse
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`service_account_not_found`"
+// @Failure 500 {object} errorResponse "`service_account_delete_failed`, `service_account_load_failed`"
+// @Router /service-account/{name} [delete]
+func HandleServiceAccountDelete(w http.ResponseWriter, r *http.Request) {
+	account, ok := loadServiceAccount(w, r.PathValue("name"))
+	if !ok {
+		return
+	}
+
+	response := newServiceAccountResponse(account)
+	if err := user.DeleteServiceAccount(account.Name); err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "service_account_delete_failed", Message: err.Error()})
+		return
+	}
+	auth.EndSession(account.Subject())
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// requireHumanSubject authenticates a user; service accounts can't manage
+// service accounts.
+func requireHumanSubject(w http.ResponseWriter, r *http.Request) (string, bool) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return "", false
+	}
+	if auth.IsServiceAccount(claims.Subject) {
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: "forbidden", Message: "service accounts can't manage service accounts"})
+		return "", false
+	}
+	return claims.Subject, true
+}
+
+func decodeServiceAccountRequest(w http.ResponseWriter, r *http.Request) (serviceAccountRequest, bool) {
+	var req serviceAccountRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "invalid JSON payload"})
+		return req, false
+	}
+	if req.Roles == nil {
+		req.Roles = []auth.RoleBinding{}
+	}
+	for _, binding := range req.Roles {
+		if !auth.ValidRole(binding.Role) {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "roles must be viewer, editor, deployer or admin"})
+			return req, false
+		}
+		if binding.Role == auth.RoleAdmin && len(binding.Charts) > 0 {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "the admin role applies to the whole instance and can't list charts"})
+			return req, false
+		}
+		if binding.Role == auth.RoleAdmin {
+			if claims, err := auth.RequireAccessTokenClaims(r); err != nil || !isInstanceAdmin(claims.Subject, claims.Roles) {
+				writeJSON(w, http.StatusForbidden, errorResponse{Error: "forbidden", Message: "only instance admins can grant the admin role"})
+				return req, false
+			}
+		}
+		for _, chartID := range binding.Charts {
+			if !chart.IsChartID(chartID) {
+				writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "invalid chart id " + chartID})
+				return req, false
+			}
+		}
+	}
+	return req, true
+}
+
+func loadServiceAccount(w http.ResponseWriter, name string) (user.ServiceAccount, bool) {
+	account, err := user.LoadServiceAccount(name)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, user.ErrInvalidServiceAccountName) {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "service_account_not_found", Message: "service account not found"})
+			return user.ServiceAccount{}, false
+		}
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "service_account_load_failed", Message: err.Error()})
+		return user.ServiceAccount{}, false
+	}
+	return account, true
+}
+
+func newServiceAccountResponse(account user.ServiceAccount) serviceAccountResponse {
+	publicKey, _ := user.LoadUserPublicKey(account.Subject())
+	return serviceAccountResponse{
+		Name:         account.Name,
+		Subject:      account.Subject(),
+		Description:  account.Description,
+		Roles:        account.Roles,
+		SSHPublicKey: publicKey,
+		CreatedBy:    account.CreatedBy,
+		CreatedAt:    account.CreatedAt,
+	}
+}
+
+// authorizeServiceAccounts refuses requests made with a service account
+// token before they reach a handler, unless the role bindings of the token
+// grant the role the request needs.
+func authorizeServiceAccounts(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := auth.BearerToken(r)
+		if _, password, ok := r.BasicAuth(); ok {
+			token = password
+		}
+		claims, err := auth.ParseToken(token)
+		if token == "" || err != nil || claims.TokenType != "access" || !auth.IsServiceAccount(claims.Subject) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		role, chartID := serviceAccountRole(r)
+		if !auth.AllowsRole(claims.Roles, role, chartID) {
+			writeJSON(w, http.StatusForbidden, errorResponse{Error: "forbidden", Message: auth.ErrForbidden.Error()})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serviceAccountRole is the role a request needs and the chart it is for,
+// empty for endpoints not specific to one chart.
+func serviceAccountRole(r *http.Request) (string, string) {
+	chartID := ""
+	if rest, ok := strings.CutPrefix(r.URL.Path, "/api/chart/"); ok {
+		id, _, _ := strings.Cut(rest, "/")
+		if id = strings.TrimSuffix(id, ".git"); chart.IsChartID(id) {
+			chartID = id
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/api/admin/export") || strings.HasPrefix(r.URL.Path, "/api/admin/import"):
+		return auth.RoleAdmin, ""
+	case r.URL.Path == "/api/deploy" || strings.HasPrefix(r.URL.Path, "/api/deploy/") || strings.HasSuffix(r.URL.Path, "/deploy") || strings.HasSuffix(r.URL.Path, "/rollback") || strings.HasSuffix(r.URL.Path, "/state") || strings.Contains(r.URL.Path, "/state/versions") || strings.Contains(r.URL.Path, "/schedules") && r.Method != http.MethodGet || strings.HasPrefix(r.URL.Path, "/api/agent") || strings.HasPrefix(r.URL.Path, "/api/admin/jobs"):
+		return auth.RoleDeployer, chartID
+	case r.Method == http.MethodGet || r.Method == http.MethodHead || slices.ContainsFunc(readOnlyPostSuffixes, func(suffix string) bool {
+		return strings.HasSuffix(r.URL.Path, suffix)
+	}):
+		return auth.RoleViewer, chartID
+	default:
+		return auth.RoleEditor, chartID
+	}
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"expvar"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+)
+
+// defaultSessionSweepInterval is how often expired sessions are dropped when
+// SESSION_SWEEP_INTERVAL isn't set.
+const defaultSessionSweepInterval = time.Minute
+
+// sessionSweepStats counts the sessions the sweeper ended, by reason.
+var sessionSweepStats struct {
+	mu        sync.Mutex
+	swept     map[string]int64
+	lastSweep time.Time
+}
+
+func init() {
+	expvar.Publish("sessions", expvar.Func(func() any {
+		sessionSweepStats.mu.Lock()
+		defer sessionSweepStats.mu.Unlock()
+		swept := map[string]int64{auth.SessionExpired: 0, auth.SessionIdle: 0}
+		for reason, count := range sessionSweepStats.swept {
+			swept[reason] = count
+		}
+		lastSweep := ""
+		if !sessionSweepStats.lastSweep.IsZero() {
+			lastSweep = sessionSweepStats.lastSweep.UTC().Format(time.RFC3339)
+		}
+		return map[string]any{
+			"active":    auth.ActiveSessions(),
+			"swept":     swept,
+			"lastSweep": lastSweep,
+		}
+	}))
+}
+
+// StartSessionSweeper ends the sessions whose tokens all expired, and with
+// SESSION_IDLE_TIMEOUT set those unused for that long, every
+// SESSION_SWEEP_INTERVAL (1m by default) in the background. Their unlocked
+// private keys are dropped with them.
+func StartSessionSweeper() {
+	interval := sessionDuration("SESSION_SWEEP_INTERVAL", defaultSessionSweepInterval)
+	if interval <= 0 {
+		interval = defaultSessionSweepInterval
+	}
+	idle := sessionDuration("SESSION_IDLE_TIMEOUT", 0)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			sweepSessions(time.Now(), idle)
+		}
+	}()
+}
+
+func sweepSessions(now time.Time, idle time.Duration) {
+	swept := auth.SweepSessions(now, idle)
+	for _, session := range swept {
+		if session.HadPrivateKey {
+			log.Printf("Ended %s session of %s, dropped its private key", session.Reason, session.Subject)
+		} else {
+			log.Printf("Ended %s session of %s", session.Reason, session.Subject)
+		}
+	}
+
+	sessionSweepStats.mu.Lock()
+	defer sessionSweepStats.mu.Unlock()
+	if sessionSweepStats.swept == nil {
+		sessionSweepStats.swept = map[string]int64{}
+	}
+	for _, session := range swept {
+		sessionSweepStats.swept[session.Reason]++
+	}
+	sessionSweepStats.lastSweep = now
+}
+
+func sessionDuration(name string, fallback time.Duration) time.Duration {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		log.Printf("Ignoring invalid %s %q", name, value)
+		return fallback
+	}
+	return duration
+}
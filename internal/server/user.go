@@ -1,6 +1,7 @@
 package server
 
 import (
+	"cmp"
 	"encoding/json"
 	"errors"
 	"net/http"
@@ -26,16 +27,28 @@ func HandleUser(w http.ResponseWriter, r *http.Request) {
 }
 
 type userRegisterRequest struct {
-	Username      string `json:"username"`
-	Password      string `json:"password"`
-	SSHPublicKey  string `json:"ssh_public_key,omitempty"`
-	SSHPrivateKey string `json:"ssh_private_key,omitempty"`
+	Username      string `json:"username" example:"alice"`
+	Password      string `json:"password" example:"correct horse battery staple"`
+	SSHPublicKey  string `json:"sshPublicKey,omitempty"`
+	SSHPrivateKey string `json:"sshPrivateKey,omitempty"`
+
+	// The snake_case names clients used before, still accepted
+	LegacySSHPublicKey  string `json:"ssh_public_key,omitempty" swaggerignore:"true"`
+	LegacySSHPrivateKey string `json:"ssh_private_key,omitempty" swaggerignore:"true"`
 }
 
 type userInfoResponse struct {
+	SSHPublicKey string `json:"sshPublicKey"`
+}
+
+type legacyUserInfoResponse struct {
 	SSHPublicKey string `json:"ssh_public_key"`
 }
 
+func (response userInfoResponse) legacyJSON() any {
+	return legacyUserInfoResponse(response)
+}
+
 // HandleUserRegister godoc
 // @Summary Set the user name and password
 // @Description Accepts credentials for the single-user setup, optionally storing an SSH keypair or generating one.
@@ -44,9 +57,9 @@ type userInfoResponse struct {
 // @Produce json
 // @Param credentials body userRegisterRequest true "User credentials"
 // @Success 201 {object} emptyResponse
-// @Failure 400 {object} errorResponse
-// @Failure 401 {object} errorResponse
-// @Failure 500 {object} errorResponse
+// @Failure 400 {object} errorResponse "`invalid_request`"
+// @Failure 409 {object} errorResponse "`ssh_keypair_exists`"
+// @Failure 500 {object} errorResponse "`key_lookup_failed`, `key_generation_failed`, `key_store_failed`"
 // @Router /user [post]
 func HandleUserRegister(w http.ResponseWriter, r *http.Request) {
 	if r.Body == nil {
@@ -64,6 +77,10 @@ func HandleUserRegister(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "username and password are required"})
 		return
 	}
+	if auth.IsServiceAccount(req.Username) {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "usernames can't start with " + auth.ServiceAccountPrefix})
+		return
+	}
 
 	exists, err := user.UserKeyPairExists(req.Username)
 	if err != nil {
@@ -75,8 +92,8 @@ func HandleUserRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	publicKey := strings.TrimSpace(req.SSHPublicKey)
-	privateKey := strings.TrimSpace(req.SSHPrivateKey)
+	publicKey := strings.TrimSpace(cmp.Or(req.SSHPublicKey, req.LegacySSHPublicKey))
+	privateKey := strings.TrimSpace(cmp.Or(req.SSHPrivateKey, req.LegacySSHPrivateKey))
 	if publicKey == "" && privateKey == "" {
 		publicKey, privateKey, err = user.GenerateEd25519KeyPair()
 		if err != nil {
@@ -85,7 +102,7 @@ func HandleUserRegister(w http.ResponseWriter, r *http.Request) {
 		}
 	} else {
 		if publicKey == "" || privateKey == "" {
-			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "ssh_public_key and ssh_private_key must be provided together"})
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "sshPublicKey and sshPrivateKey must be provided together"})
 			return
 		}
 		if err := user.ValidateSSHKeyPair(publicKey, privateKey); err != nil {
@@ -109,7 +126,10 @@ func HandleUserRegister(w http.ResponseWriter, r *http.Request) {
 // @Security BearerAuth
 // @Produce json
 // @Success 200 {object} userInfoResponse
-// @Failure 401 {object} errorResponse
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`ssh_public_key_not_found`"
+// @Failure 500 {object} errorResponse "`key_load_failed`"
 // @Router /user [get]
 func HandleUserInfo(w http.ResponseWriter, r *http.Request) {
 	claims, err := auth.RequireAccessTokenClaims(r)
@@ -0,0 +1,161 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	notificationsFile = "notifications.json"
+	maxNotifications  = 200
+)
+
+// Notification events.
+const (
+	EventDeployFinished         = "deploy.finished"
+	EventDeployAwaitingApproval = "deploy.awaiting_approval"
+	EventEnvironmentExpiring    = "environment.expiring"
+)
+
+// Notification is an entry of the in-app inbox of a user.
+type Notification struct {
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	Message   string    `json:"message"`
+	ChartID   string    `json:"chartId,omitempty"`
+	Ref       string    `json:"ref,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	Read      bool      `json:"read"`
+}
+
+// notificationsMu serializes read-modify-write cycles of inbox files.
+var notificationsMu sync.Mutex
+
+// NotifyUser adds a notification to the inbox of a user unless their
+// preferences opt out of its event. The oldest entries are dropped once the
+// inbox is full.
+func NotifyUser(username string, notification Notification) error {
+	prefs, err := LoadUserPreferences(username)
+	if err != nil {
+		return err
+	}
+	if enabled, ok := prefs.Notifications[notification.Event]; ok && !enabled {
+		return nil
+	}
+
+	notification.ID = uuid.New().String()
+	notification.CreatedAt = time.Now().UTC()
+	notification.Read = false
+
+	notificationsMu.Lock()
+	defer notificationsMu.Unlock()
+
+	notifications, err := loadNotifications(username)
+	if err != nil {
+		return err
+	}
+
+	notifications = append(notifications, notification)
+	if len(notifications) > maxNotifications {
+		notifications = notifications[len(notifications)-maxNotifications:]
+	}
+
+	return storeNotifications(username, notifications)
+}
+
+// ListUserNotifications returns the inbox of a user, newest first.
+func ListUserNotifications(username string) ([]Notification, error) {
+	notificationsMu.Lock()
+	defer notificationsMu.Unlock()
+
+	notifications, err := loadNotifications(username)
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Reverse(notifications)
+	return notifications, nil
+}
+
+// MarkUserNotificationsRead marks the given notifications as read, or every
+// notification when ids is empty. It returns the number of entries changed.
+func MarkUserNotificationsRead(username string, ids []string) (int, error) {
+	notificationsMu.Lock()
+	defer notificationsMu.Unlock()
+
+	notifications, err := loadNotifications(username)
+	if err != nil {
+		return 0, err
+	}
+
+	marked := 0
+	for i := range notifications {
+		if notifications[i].Read || (len(ids) > 0 && !slices.Contains(ids, notifications[i].ID)) {
+			continue
+		}
+		notifications[i].Read = true
+		marked++
+	}
+	if marked == 0 {
+		return 0, nil
+	}
+
+	return marked, storeNotifications(username, notifications)
+}
+
+func loadNotifications(username string) ([]Notification, error) {
+	path, err := buildUserNotificationsPath(SecureStoreDir(), username)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []Notification{}, nil
+		}
+		return nil, fmt.Errorf("read notifications: %w", err)
+	}
+
+	notifications := []Notification{}
+	if err := json.Unmarshal(data, &notifications); err != nil {
+		return nil, fmt.Errorf("decode notifications: %w", err)
+	}
+
+	return notifications, nil
+}
+
+func storeNotifications(username string, notifications []Notification) error {
+	path, err := buildUserNotificationsPath(SecureStoreDir(), username)
+	if err != nil {
+		return err
+	}
+
+	if err := ensureSecureDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(notifications)
+	if err != nil {
+		return fmt.Errorf("encode notifications: %w", err)
+	}
+
+	return writeSecureFile(path, string(data)+"\n", 0o600)
+}
+
+func buildUserNotificationsPath(storeDir, username string) (string, error) {
+	paths, err := buildUserKeyPaths(storeDir, username)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(filepath.Dir(paths.publicKey), notificationsFile), nil
+}
@@ -0,0 +1,72 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const preferencesFile = "preferences.json"
+
+// Preferences are per-user settings kept on the server so they follow the
+// user across devices.
+type Preferences struct {
+	DefaultChart  string          `json:"defaultChart,omitempty"`
+	UI            map[string]any  `json:"ui,omitempty"`            // Opaque settings owned by the SPA
+	Notifications map[string]bool `json:"notifications,omitempty"` // Opt-ins keyed by event name
+}
+
+// LoadUserPreferences returns the stored preferences of a user, or empty
+// preferences when none were saved yet.
+func LoadUserPreferences(username string) (Preferences, error) {
+	path, err := buildUserPreferencesPath(SecureStoreDir(), username)
+	if err != nil {
+		return Preferences{}, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Preferences{}, nil
+		}
+		return Preferences{}, fmt.Errorf("read preferences: %w", err)
+	}
+
+	var prefs Preferences
+	if err := json.Unmarshal(data, &prefs); err != nil {
+		return Preferences{}, fmt.Errorf("decode preferences: %w", err)
+	}
+
+	return prefs, nil
+}
+
+// StoreUserPreferences replaces the stored preferences of a user.
+func StoreUserPreferences(username string, prefs Preferences) error {
+	storeDir := SecureStoreDir()
+	path, err := buildUserPreferencesPath(storeDir, username)
+	if err != nil {
+		return err
+	}
+
+	if err := ensureSecureDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(prefs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode preferences: %w", err)
+	}
+
+	return writeSecureFile(path, string(data)+"\n", 0o600)
+}
+
+func buildUserPreferencesPath(storeDir, username string) (string, error) {
+	paths, err := buildUserKeyPaths(storeDir, username)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(filepath.Dir(paths.publicKey), preferencesFile), nil
+}
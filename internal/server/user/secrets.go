@@ -0,0 +1,260 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// SecretsFile holds the secrets of a subject in its secure store
+	// directory.
+	SecretsFile = "secrets.json"
+	// MaxSecretSize bounds the value of a secret.
+	MaxSecretSize = 64 * 1024
+)
+
+var (
+	ErrInvalidSecretName = errors.New("secret names are 1-128 letters, digits, dots, dashes and underscores")
+	ErrSecretNotFound    = errors.New("secret not found")
+)
+
+var secretNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// Secret describes a stored secret. Values are never returned once stored.
+type Secret struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// storedSecret is a secret as written to the secrets file of its subject,
+// its value encrypted like SSH private keys with a password derived from
+// SESSION_SECRET, so deploys can use it while its owner isn't logged in.
+// Changing SESSION_SECRET makes the secrets unusable.
+type storedSecret struct {
+	Secret
+	Value string `json:"value"`
+}
+
+// secretsMu serializes read-modify-write cycles of secrets files.
+var secretsMu sync.Mutex
+
+// ValidateSecretName checks a secret name.
+func ValidateSecretName(name string) error {
+	if !secretNamePattern.MatchString(name) {
+		return ErrInvalidSecretName
+	}
+	return nil
+}
+
+// ListSecrets returns the secrets of a subject sorted by name, without their
+// values.
+func ListSecrets(subject string) ([]Secret, error) {
+	stored, err := loadSecrets(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := make([]Secret, 0, len(stored))
+	for _, secret := range stored {
+		secrets = append(secrets, secret.Secret)
+	}
+	sort.Slice(secrets, func(i, j int) bool { return secrets[i].Name < secrets[j].Name })
+	return secrets, nil
+}
+
+// StoreSecret creates or replaces a secret of a subject.
+func StoreSecret(subject, name, value string) (Secret, error) {
+	if err := ValidateSecretName(name); err != nil {
+		return Secret{}, err
+	}
+	if len(value) > MaxSecretSize {
+		return Secret{}, fmt.Errorf("secret %s exceeds %d bytes", name, MaxSecretSize)
+	}
+	password, err := secretsPassword(subject)
+	if err != nil {
+		return Secret{}, err
+	}
+	encrypted, err := encryptWithPassword(password, []byte(value))
+	if err != nil {
+		return Secret{}, err
+	}
+
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	stored, err := loadSecrets(subject)
+	if err != nil {
+		return Secret{}, err
+	}
+
+	now := time.Now().UTC()
+	secret, ok := stored[name]
+	if !ok {
+		secret.Name = name
+		secret.CreatedAt = now
+	}
+	secret.UpdatedAt = now
+	secret.Value = encrypted
+	stored[name] = secret
+	if err := storeSecrets(subject, stored); err != nil {
+		return Secret{}, err
+	}
+	return secret.Secret, nil
+}
+
+// DeleteSecret removes a secret of a subject.
+func DeleteSecret(subject, name string) error {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	stored, err := loadSecrets(subject)
+	if err != nil {
+		return err
+	}
+	if _, ok := stored[name]; !ok {
+		return ErrSecretNotFound
+	}
+
+	delete(stored, name)
+	return storeSecrets(subject, stored)
+}
+
+// LoadSecretValues decrypts the named secrets of a subject, keyed by name.
+func LoadSecretValues(subject string, names []string) (map[string]string, error) {
+	if len(names) == 0 {
+		return map[string]string{}, nil
+	}
+	stored, err := loadSecrets(subject)
+	if err != nil {
+		return nil, err
+	}
+	password, err := secretsPassword(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(names))
+	for _, name := range names {
+		secret, ok := stored[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+		}
+		if _, done := values[name]; done {
+			continue
+		}
+		value, err := decryptWithPassword(password, secret.Value)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt secret %s: %w", name, err)
+		}
+		values[name] = string(value)
+	}
+	return values, nil
+}
+
+// ExportSecrets returns the secrets file of a subject with its values
+// decrypted, for sealing into a migration archive, or false when the subject
+// has no secrets.
+func ExportSecrets(subject string) (string, bool, error) {
+	stored, err := loadSecrets(subject)
+	if err != nil || len(stored) == 0 {
+		return "", false, err
+	}
+	password, err := secretsPassword(subject)
+	if err != nil {
+		return "", false, err
+	}
+	for name, secret := range stored {
+		value, err := decryptWithPassword(password, secret.Value)
+		if err != nil {
+			return "", false, fmt.Errorf("decrypt secret %s: %w", name, err)
+		}
+		secret.Value = string(value)
+		stored[name] = secret
+	}
+
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return "", false, fmt.Errorf("encode secrets: %w", err)
+	}
+	return string(data), true, nil
+}
+
+// ImportSecrets stores the secrets ExportSecrets returned, encrypted for
+// this instance.
+func ImportSecrets(subject, exported string) error {
+	stored := map[string]storedSecret{}
+	if err := json.Unmarshal([]byte(exported), &stored); err != nil {
+		return fmt.Errorf("decode secrets: %w", err)
+	}
+	password, err := secretsPassword(subject)
+	if err != nil {
+		return err
+	}
+	for name, secret := range stored {
+		encrypted, err := encryptWithPassword(password, []byte(secret.Value))
+		if err != nil {
+			return err
+		}
+		secret.Value = encrypted
+		stored[name] = secret
+	}
+
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	return storeSecrets(subject, stored)
+}
+
+func secretsPassword(subject string) (string, error) {
+	return sessionSecretPassword("secrets:" + subject)
+}
+
+func loadSecrets(subject string) (map[string]storedSecret, error) {
+	path, err := buildSecretsPath(SecureStoreDir(), subject)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := map[string]storedSecret{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return stored, nil
+		}
+		return nil, fmt.Errorf("read secrets: %w", err)
+	}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("decode secrets: %w", err)
+	}
+	return stored, nil
+}
+
+func storeSecrets(subject string, stored map[string]storedSecret) error {
+	path, err := buildSecretsPath(SecureStoreDir(), subject)
+	if err != nil {
+		return err
+	}
+	if err := ensureSecureDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode secrets: %w", err)
+	}
+	return writeSecureFile(path, string(data)+"\n", 0o600)
+}
+
+func buildSecretsPath(storeDir, subject string) (string, error) {
+	paths, err := buildUserKeyPaths(storeDir, subject)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(filepath.Dir(paths.publicKey), SecretsFile), nil
+}
@@ -0,0 +1,251 @@
+package user
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+)
+
+const (
+	serviceAccountFile   = "service-account.json"
+	serviceAccountSecret = "pmsa_"
+)
+
+var ErrInvalidServiceAccountName = errors.New("service account names are 1-63 lowercase letters, digits and dashes")
+
+var serviceAccountNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// ServiceAccount is a non-human subject automation logs in as with a secret
+// instead of a password. Its SSH key pair, when it has one, is stored like a
+// user's under its subject, encrypted with a password derived from
+// SESSION_SECRET, so charts bound to the service account can deploy with it
+// while it isn't logged in. Changing SESSION_SECRET makes the keys unusable.
+type ServiceAccount struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	Roles       []auth.RoleBinding `json:"roles"`
+	CreatedBy   string             `json:"createdBy"`
+	CreatedAt   string             `json:"createdAt"`
+	SecretHash  string             `json:"secretHash"`
+}
+
+// Subject is the token subject of the service account.
+func (account ServiceAccount) Subject() string {
+	return auth.ServiceAccountPrefix + account.Name
+}
+
+// CheckSecret reports whether secret is the secret of the service account.
+func (account ServiceAccount) CheckSecret(secret string) bool {
+	hash := sha256.Sum256([]byte(secret))
+	return subtle.ConstantTimeCompare([]byte(hex.EncodeToString(hash[:])), []byte(account.SecretHash)) == 1
+}
+
+// StoreServiceAccountKeyPair stores the SSH key pair of a service account.
+func StoreServiceAccountKeyPair(account ServiceAccount, publicKey, privateKey string) error {
+	password, err := serviceAccountKeyPassword(account.Subject())
+	if err != nil {
+		return err
+	}
+	return StoreUserKeyPair(account.Subject(), publicKey, privateKey, password)
+}
+
+// LoadServiceAccountKeyPair returns the SSH key pair of a service account, or
+// empty keys when it has none.
+func LoadServiceAccountKeyPair(account ServiceAccount) (string, string, error) {
+	exists, err := UserKeyPairExists(account.Subject())
+	if err != nil || !exists {
+		return "", "", err
+	}
+	password, err := serviceAccountKeyPassword(account.Subject())
+	if err != nil {
+		return "", "", err
+	}
+	publicKey, err := LoadUserPublicKey(account.Subject())
+	if err != nil {
+		return "", "", err
+	}
+	privateKey, err := LoadUserPrivateKey(account.Subject(), password)
+	if err != nil {
+		return "", "", err
+	}
+	return publicKey, privateKey, nil
+}
+
+func serviceAccountKeyPassword(subject string) (string, error) {
+	return sessionSecretPassword("ssh-key:" + subject)
+}
+
+// sessionSecretPassword derives the password of what the server has to
+// decrypt by itself from SESSION_SECRET.
+func sessionSecretPassword(purpose string) (string, error) {
+	secret := os.Getenv("SESSION_SECRET")
+	if secret == "" {
+		return "", errors.New("SESSION_SECRET is not configured")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// SealServerSecret encrypts a secret the server keeps outside the secure
+// store like stored secrets, with a password derived from SESSION_SECRET for
+// purpose.
+func SealServerSecret(purpose, secret string) (string, error) {
+	password, err := sessionSecretPassword(purpose)
+	if err != nil {
+		return "", err
+	}
+	return encryptWithPassword(password, []byte(secret))
+}
+
+// OpenServerSecret decrypts a secret SealServerSecret encrypted for purpose.
+func OpenServerSecret(purpose, sealed string) (string, error) {
+	password, err := sessionSecretPassword(purpose)
+	if err != nil {
+		return "", err
+	}
+	secret, err := decryptWithPassword(password, sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+// IsSealedServerSecret reports whether value is in the format
+// SealServerSecret writes, to tell it from a secret stored before they were
+// encrypted.
+func IsSealedServerSecret(value string) bool {
+	parts := strings.Split(value, ":")
+	return len(parts) == 4 && parts[0] == privateKeyCipherVersion
+}
+
+// ValidateServiceAccountName checks a service account name.
+func ValidateServiceAccountName(name string) error {
+	if !serviceAccountNamePattern.MatchString(name) {
+		return ErrInvalidServiceAccountName
+	}
+	return nil
+}
+
+// NewServiceAccountSecret generates a secret and the hash to store for it.
+func NewServiceAccountSecret() (string, string, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return "", "", fmt.Errorf("generate secret: %w", err)
+	}
+	secret := serviceAccountSecret + base64.RawURLEncoding.EncodeToString(data)
+	hash := sha256.Sum256([]byte(secret))
+	return secret, hex.EncodeToString(hash[:]), nil
+}
+
+// LoadServiceAccount returns a stored service account, or an error wrapping
+// os.ErrNotExist when there is none with the name.
+func LoadServiceAccount(name string) (ServiceAccount, error) {
+	path, err := buildServiceAccountPath(SecureStoreDir(), name)
+	if err != nil {
+		return ServiceAccount{}, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ServiceAccount{}, fmt.Errorf("read service account: %w", err)
+	}
+
+	var account ServiceAccount
+	if err := json.Unmarshal(data, &account); err != nil {
+		return ServiceAccount{}, fmt.Errorf("decode service account: %w", err)
+	}
+
+	return account, nil
+}
+
+// ListServiceAccounts returns the stored service accounts by name.
+func ListServiceAccounts() ([]ServiceAccount, error) {
+	entries, err := os.ReadDir(SecureStoreDir())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []ServiceAccount{}, nil
+		}
+		return nil, fmt.Errorf("list service accounts: %w", err)
+	}
+
+	accounts := []ServiceAccount{}
+	for _, entry := range entries {
+		name, ok := strings.CutPrefix(entry.Name(), auth.ServiceAccountPrefix)
+		if !entry.IsDir() || !ok {
+			continue
+		}
+		account, err := LoadServiceAccount(name)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Name < accounts[j].Name })
+	return accounts, nil
+}
+
+// StoreServiceAccount creates or replaces a service account.
+func StoreServiceAccount(account ServiceAccount) error {
+	storeDir := SecureStoreDir()
+	if err := ensureSecureDir(storeDir); err != nil {
+		return err
+	}
+
+	path, err := buildServiceAccountPath(storeDir, account.Name)
+	if err != nil {
+		return err
+	}
+	if err := ensureSecureDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(account, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode service account: %w", err)
+	}
+
+	return writeSecureFile(path, string(data)+"\n", 0o600)
+}
+
+// DeleteServiceAccount removes a service account with its SSH key pair.
+func DeleteServiceAccount(name string) error {
+	path, err := buildServiceAccountPath(SecureStoreDir(), name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("read service account: %w", err)
+	}
+
+	return os.RemoveAll(filepath.Dir(path))
+}
+
+func buildServiceAccountPath(storeDir, name string) (string, error) {
+	if err := ValidateServiceAccountName(name); err != nil {
+		return "", err
+	}
+	paths, err := buildUserKeyPaths(storeDir, auth.ServiceAccountPrefix+name)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(filepath.Dir(paths.publicKey), serviceAccountFile), nil
+}
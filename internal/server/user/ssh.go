@@ -50,16 +50,16 @@ func GenerateEd25519KeyPair() (string, string, error) {
 func ValidateSSHKeyPair(publicKey, privateKey string) error {
 	parsedPublicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey))
 	if err != nil {
-		return fmt.Errorf("invalid ssh_public_key: %w", err)
+		return fmt.Errorf("invalid sshPublicKey: %w", err)
 	}
 
 	signer, err := ssh.ParsePrivateKey([]byte(privateKey))
 	if err != nil {
-		return fmt.Errorf("invalid ssh_private_key: %w", err)
+		return fmt.Errorf("invalid sshPrivateKey: %w", err)
 	}
 
 	if !bytes.Equal(parsedPublicKey.Marshal(), signer.PublicKey().Marshal()) {
-		return errors.New("ssh_public_key does not match ssh_private_key")
+		return errors.New("sshPublicKey does not match sshPrivateKey")
 	}
 
 	return nil
@@ -67,7 +67,7 @@ func ValidateSSHKeyPair(publicKey, privateKey string) error {
 
 func StoreUserKeyPair(username, publicKey, privateKey, password string) error {
 	// Persist SSH keys under SECURE_STORE/<username> with locked-down permissions.
-	storeDir := secureStoreDir()
+	storeDir := SecureStoreDir()
 	if err := ensureSecureDir(storeDir); err != nil {
 		return err
 	}
@@ -101,7 +101,7 @@ func StoreUserKeyPair(username, publicKey, privateKey, password string) error {
 }
 
 func UserKeyPairExists(username string) (bool, error) {
-	storeDir := secureStoreDir()
+	storeDir := SecureStoreDir()
 	paths, err := buildUserKeyPaths(storeDir, username)
 	if err != nil {
 		return false, err
@@ -121,7 +121,7 @@ func UserKeyPairExists(username string) (bool, error) {
 }
 
 func LoadUserPublicKey(username string) (string, error) {
-	storeDir := secureStoreDir()
+	storeDir := SecureStoreDir()
 	paths, err := buildUserKeyPaths(storeDir, username)
 	if err != nil {
 		return "", err
@@ -136,7 +136,7 @@ func LoadUserPublicKey(username string) (string, error) {
 }
 
 func LoadUserEncryptedPrivateKey(username string) (string, error) {
-	storeDir := secureStoreDir()
+	storeDir := SecureStoreDir()
 	paths, err := buildUserKeyPaths(storeDir, username)
 	if err != nil {
 		return "", err
@@ -159,7 +159,9 @@ func LoadUserPrivateKey(username, password string) (string, error) {
 	return DecryptPrivateKey(password, encrypted)
 }
 
-func secureStoreDir() string {
+// SecureStoreDir is where the keys, settings and inboxes of users and
+// service accounts are stored, one directory per subject.
+func SecureStoreDir() string {
 	if dir := strings.TrimSpace(os.Getenv("SECURE_STORE")); dir != "" {
 		return dir
 	}
@@ -239,19 +241,38 @@ func EncryptPrivateKey(password, privateKey string) (string, error) {
 		return "", errors.New("private key is required for encryption")
 	}
 
+	return encryptWithPassword(trimmedPassword, []byte(trimmedKey))
+}
+
+func DecryptPrivateKey(password, encryptedPrivateKey string) (string, error) {
+	trimmedPassword := strings.TrimSpace(password)
+	if trimmedPassword == "" {
+		return "", errors.New("password is required to decrypt private key")
+	}
+	trimmedEncrypted := strings.TrimSpace(encryptedPrivateKey)
+	if trimmedEncrypted == "" {
+		return "", errors.New("encrypted private key is required")
+	}
+
+	plaintext, err := decryptWithPassword(trimmedPassword, trimmedEncrypted)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(plaintext)), nil
+}
+
+// encryptWithPassword seals plaintext with AES-GCM under a key derived from
+// password with argon2id, in the format decryptWithPassword reads.
+func encryptWithPassword(password string, plaintext []byte) (string, error) {
 	salt := make([]byte, privateKeySaltSize)
 	if _, err := rand.Read(salt); err != nil {
 		return "", fmt.Errorf("generate private key salt: %w", err)
 	}
 
-	key := argon2.IDKey([]byte(trimmedPassword), salt, privateKeyArgonTime, privateKeyArgonMemory, privateKeyArgonThreads, privateKeyKeyLen)
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return "", fmt.Errorf("create private key cipher: %w", err)
-	}
-	gcm, err := cipher.NewGCM(block)
+	gcm, err := passwordCipher(password, salt)
 	if err != nil {
-		return "", fmt.Errorf("create private key gcm: %w", err)
+		return "", err
 	}
 
 	nonce := make([]byte, gcm.NonceSize())
@@ -259,7 +280,7 @@ func EncryptPrivateKey(password, privateKey string) (string, error) {
 		return "", fmt.Errorf("generate private key nonce: %w", err)
 	}
 
-	ciphertext := gcm.Seal(nil, nonce, []byte(trimmedKey), nil)
+	ciphertext := gcm.Seal(nil, nonce, plaintext, nil)
 
 	return fmt.Sprintf("%s:%s:%s:%s",
 		privateKeyCipherVersion,
@@ -269,48 +290,47 @@ func EncryptPrivateKey(password, privateKey string) (string, error) {
 	), nil
 }
 
-func DecryptPrivateKey(password, encryptedPrivateKey string) (string, error) {
-	trimmedPassword := strings.TrimSpace(password)
-	if trimmedPassword == "" {
-		return "", errors.New("password is required to decrypt private key")
-	}
-	trimmedEncrypted := strings.TrimSpace(encryptedPrivateKey)
-	if trimmedEncrypted == "" {
-		return "", errors.New("encrypted private key is required")
-	}
-
-	parts := strings.Split(trimmedEncrypted, ":")
+func decryptWithPassword(password, encrypted string) ([]byte, error) {
+	parts := strings.Split(encrypted, ":")
 	if len(parts) != 4 || parts[0] != privateKeyCipherVersion {
-		return "", errors.New("invalid encrypted private key format")
+		return nil, errors.New("invalid encrypted private key format")
 	}
 
 	salt, err := base64.StdEncoding.DecodeString(parts[1])
 	if err != nil {
-		return "", errors.New("invalid encrypted private key salt")
+		return nil, errors.New("invalid encrypted private key salt")
 	}
 	nonce, err := base64.StdEncoding.DecodeString(parts[2])
 	if err != nil {
-		return "", errors.New("invalid encrypted private key nonce")
+		return nil, errors.New("invalid encrypted private key nonce")
 	}
 	ciphertext, err := base64.StdEncoding.DecodeString(parts[3])
 	if err != nil {
-		return "", errors.New("invalid encrypted private key data")
+		return nil, errors.New("invalid encrypted private key data")
 	}
 
-	key := argon2.IDKey([]byte(trimmedPassword), salt, privateKeyArgonTime, privateKeyArgonMemory, privateKeyArgonThreads, privateKeyKeyLen)
-	block, err := aes.NewCipher(key)
+	gcm, err := passwordCipher(password, salt)
 	if err != nil {
-		return "", fmt.Errorf("create private key cipher: %w", err)
-	}
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", fmt.Errorf("create private key gcm: %w", err)
+		return nil, err
 	}
 
 	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
 	if err != nil {
-		return "", errors.New("invalid password or corrupted private key")
+		return nil, errors.New("invalid password or corrupted private key")
 	}
 
-	return strings.TrimSpace(string(plaintext)), nil
+	return plaintext, nil
+}
+
+func passwordCipher(password string, salt []byte) (cipher.AEAD, error) {
+	key := argon2.IDKey([]byte(password), salt, privateKeyArgonTime, privateKeyArgonMemory, privateKeyArgonThreads, privateKeyKeyLen)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("create private key cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("create private key gcm: %w", err)
+	}
+	return gcm, nil
 }
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/user"
+)
+
+type userNotificationsResponse struct {
+	Unread        int                 `json:"unread"`
+	Notifications []user.Notification `json:"notifications"`
+}
+
+type userNotificationsReadRequest struct {
+	IDs []string `json:"ids,omitempty"`
+}
+
+type userNotificationsReadResponse struct {
+	Marked int `json:"marked"`
+	Unread int `json:"unread"`
+}
+
+// HandleUserNotifications godoc
+// @Summary List notifications
+// @Description Returns the in-app notifications of the authenticated user, newest first, with the number of unread ones. With watch and the X-Watch-Cursor of the last response in since, the request waits until a notification arrives or is marked read.
+// @Tags user
+// @Security BearerAuth
+// @Produce json
+// @Param unread query bool false "Only return unread notifications"
+// @Param fields query string false "Comma-separated notification fields to return, such as id,read"
+// @Param watch query bool false "Wait up to 30 seconds for a change when since is the current cursor"
+// @Param since query string false "X-Watch-Cursor of the last response"
+// @Success 200 {object} userNotificationsResponse
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 500 {object} errorResponse "`notifications_load_failed`"
+// @Router /user/notifications [get]
+func HandleUserNotifications(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+		return
+	}
+
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized", Message: err.Error()})
+		return
+	}
+
+	if !watchChanges(w, r, watchTopicEvents+claims.Subject) {
+		return
+	}
+	notifications, err := user.ListUserNotifications(claims.Subject)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "notifications_load_failed", Message: err.Error()})
+		return
+	}
+
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+	response := userNotificationsResponse{Notifications: []user.Notification{}}
+	for _, notification := range notifications {
+		if !notification.Read {
+			response.Unread++
+		} else if unreadOnly {
+			continue
+		}
+		response.Notifications = append(response.Notifications, notification)
+	}
+
+	writeJSONFields(w, r, http.StatusOK, response, "notifications")
+}
+
+// HandleUserNotificationsRead godoc
+// @Summary Mark notifications as read
+// @Description Marks the listed notifications as read, or all of them when no ids are given.
+// @Tags user
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body userNotificationsReadRequest false "Notification ids"
+// @Success 200 {object} userNotificationsReadResponse
+// @Failure 400 {object} errorResponse "`invalid_request`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 500 {object} errorResponse "`notifications_store_failed`, `notifications_load_failed`"
+// @Router /user/notifications/read [post]
+func HandleUserNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+		return
+	}
+
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized", Message: err.Error()})
+		return
+	}
+
+	var req userNotificationsReadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "invalid JSON payload"})
+		return
+	}
+
+	marked, err := user.MarkUserNotificationsRead(claims.Subject, req.IDs)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "notifications_store_failed", Message: err.Error()})
+		return
+	}
+	publishChange(watchTopicEvents + claims.Subject)
+
+	notifications, err := user.ListUserNotifications(claims.Subject)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "notifications_load_failed", Message: err.Error()})
+		return
+	}
+
+	response := userNotificationsReadResponse{Marked: marked}
+	for _, notification := range notifications {
+		if !notification.Read {
+			response.Unread++
+		}
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
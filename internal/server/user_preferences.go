@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/chart"
+	"github.com/mtolmacs/planemgr/internal/server/user"
+)
+
+type userPreferences struct {
+	DefaultChart  string          `json:"defaultChart,omitempty"`
+	UI            map[string]any  `json:"ui,omitempty"`
+	Notifications map[string]bool `json:"notifications,omitempty"`
+}
+
+// HandleUserPreferences handles /api/user/preferences requests.
+func HandleUserPreferences(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		HandleUserPreferencesGet(w, r)
+	case http.MethodPut:
+		HandleUserPreferencesPut(w, r)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+	}
+}
+
+// HandleUserPreferencesGet godoc
+// @Summary Get user preferences
+// @Description Returns the preferences stored for the authenticated user, empty when none were saved yet.
+// @Tags user
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} userPreferences
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 500 {object} errorResponse "`preferences_load_failed`"
+// @Router /user/preferences [get]
+func HandleUserPreferencesGet(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized", Message: err.Error()})
+		return
+	}
+
+	prefs, err := user.LoadUserPreferences(claims.Subject)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "preferences_load_failed", Message: err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, userPreferences(prefs))
+}
+
+// HandleUserPreferencesPut godoc
+// @Summary Set user preferences
+// @Description Replaces the preferences stored for the authenticated user.
+// @Tags user
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param preferences body userPreferences true "User preferences"
+// @Success 200 {object} userPreferences
+// @Failure 400 {object} errorResponse "`invalid_request`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 500 {object} errorResponse "`preferences_store_failed`"
+// @Router /user/preferences [put]
+func HandleUserPreferencesPut(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized", Message: err.Error()})
+		return
+	}
+
+	var req userPreferences
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "invalid JSON payload"})
+		return
+	}
+
+	req.DefaultChart = strings.TrimSpace(req.DefaultChart)
+	if req.DefaultChart != "" {
+		if !chart.IsChartID(req.DefaultChart) {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "defaultChart must be a chart id"})
+			return
+		}
+	}
+
+	if err := user.StoreUserPreferences(claims.Subject, user.Preferences(req)); err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "preferences_store_failed", Message: err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, req)
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/mtolmacs/planemgr/internal/server/auth"
+	"github.com/mtolmacs/planemgr/internal/server/user"
+)
+
+type userSecretRequest struct {
+	Value string `json:"value"`
+}
+
+type userSecretsResponse struct {
+	Secrets []user.Secret `json:"secrets"`
+}
+
+// HandleUserSecrets handles /api/user/secrets requests.
+// @Summary List secrets
+// @Description Lists the secrets of the authenticated user or service account, without their values.
+// @Tags user
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} userSecretsResponse
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 500 {object} errorResponse "`secrets_load_failed`"
+// @Router /user/secrets [get]
+func HandleUserSecrets(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+		return
+	}
+
+	secrets, err := user.ListSecrets(claims.Subject)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "secrets_load_failed", Message: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, userSecretsResponse{Secrets: secrets})
+}
+
+// HandleUserSecret handles /api/user/secrets/{name} requests.
+func HandleUserSecret(w http.ResponseWriter, r *http.Request) {
+	claims, err := auth.RequireAccessTokenClaims(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		HandleUserSecretPut(w, r, claims.Subject)
+	case http.MethodDelete:
+		HandleUserSecretDelete(w, r, claims.Subject)
+	default:
+		w.Header().Set("Allow", "PUT, DELETE")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method_not_allowed"})
+	}
+}
+
+// HandleUserSecretPut handles PUT /api/user/secrets/{name} requests.
+// @Summary Set a secret
+// @Description Creates or replaces a secret of the authenticated user or service account. Values are encrypted with a key derived from SESSION_SECRET, hold up to 64 KiB and are never returned; deploys inject them into the runner environment as the chart or the deploy request maps them.
+// @Tags user
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param name path string true "Secret name"
+// @Param request body userSecretRequest true "Secret value"
+// @Success 200 {object} user.Secret
+// @Failure 400 {object} errorResponse "`invalid_request`, `invalid_secret`"
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 500 {object} errorResponse "`secret_store_failed`"
+// @Router /user/secrets/{name} [put]
+func HandleUserSecretPut(w http.ResponseWriter, r *http.Request, subject string) {
+	name := r.PathValue("name")
+	if err := user.ValidateSecretName(name); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_secret", Message: err.Error()})
+		return
+	}
+
+	var req userSecretRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 2*user.MaxSecretSize)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "Invalid JSON payload"})
+		return
+	}
+	if req.Value == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_secret", Message: "value is required"})
+		return
+	}
+	if len(req.Value) > user.MaxSecretSize {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_secret", Message: "value exceeds 64 KiB"})
+		return
+	}
+
+	secret, err := user.StoreSecret(subject, name, req.Value)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "secret_store_failed", Message: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, secret)
+}
+
+// HandleUserSecretDelete handles DELETE /api/user/secrets/{name} requests.
+// @Summary Delete a secret
+// @Description Deletes a secret of the authenticated user or service account. Deploys still referencing it fail until it is set again.
+// @Tags user
+// @Security BearerAuth
+// @Param name path string true "Secret name"
+// @Success 204
+// @Failure 401 {object} errorResponse "`unauthorized`"
+// @Failure 403 {object} errorResponse "`forbidden`"
+// @Failure 404 {object} errorResponse "`secret_not_found`"
+// @Failure 500 {object} errorResponse "`secret_store_failed`"
+// @Router /user/secrets/{name} [delete]
+func HandleUserSecretDelete(w http.ResponseWriter, r *http.Request, subject string) {
+	if err := user.DeleteSecret(subject, r.PathValue("name")); err != nil {
+		if errors.Is(err, user.ErrSecretNotFound) {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "secret_not_found"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "secret_store_failed", Message: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
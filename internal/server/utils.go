@@ -4,12 +4,25 @@ import (
 	"encoding/json"
 	"io/fs"
 	"net/http"
+	"strings"
 )
 
 func writeJSON(w http.ResponseWriter, status int, payload any) {
+	options := requestJSONOptions(w)
+	if legacy, ok := payload.(legacyJSON); ok && options.legacy {
+		payload = legacy.legacyJSON()
+	}
+	if status >= http.StatusBadRequest {
+		payload = localizeError(w, options.lang, payload)
+	}
+
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(status)
-	_ = json.NewEncoder(w).Encode(payload)
+	encoder := json.NewEncoder(w)
+	if options.pretty {
+		encoder.SetIndent("", "  ")
+	}
+	_ = encoder.Encode(payload)
 }
 
 func fileExists(files fs.FS, name string) bool {
@@ -30,3 +43,77 @@ func fileExists(files fs.FS, name string) bool {
 
 	return !info.IsDir()
 }
+
+// etagMatches reports whether an If-None-Match header value names etag, or
+// any representation with "*". Weak and strong tags compare the same.
+func etagMatches(header, etag string) bool {
+	for candidate := range strings.SplitSeq(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeJSONFields writes payload like writeJSON, trimmed to the
+// comma-separated fields of the fields query parameter when there is one.
+// With listKey the fields select the keys of every object in that array of
+// payload, and the other top-level keys are kept. Unknown fields are ignored.
+// Fields are selected after the legacy casing conversion, so they name the
+// keys in the casing the client asked for.
+func writeJSONFields(w http.ResponseWriter, r *http.Request, status int, payload any, listKey string) {
+	fields := map[string]bool{}
+	for field := range strings.SplitSeq(r.URL.Query().Get("fields"), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields[field] = true
+		}
+	}
+	if len(fields) == 0 {
+		writeJSON(w, status, payload)
+		return
+	}
+
+	if legacy, ok := payload.(legacyJSON); ok && requestJSONOptions(w).legacy {
+		payload = legacy.legacyJSON()
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to encode response"})
+		return
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		writeJSON(w, status, payload)
+		return
+	}
+	if listKey == "" {
+		writeJSON(w, status, selectFields(object, fields))
+		return
+	}
+
+	var items []map[string]json.RawMessage
+	if err := json.Unmarshal(object[listKey], &items); err != nil {
+		writeJSON(w, status, payload)
+		return
+	}
+	selected := make([]map[string]json.RawMessage, 0, len(items))
+	for _, item := range items {
+		selected = append(selected, selectFields(item, fields))
+	}
+	if object[listKey], err = json.Marshal(selected); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to encode response"})
+		return
+	}
+	writeJSON(w, status, object)
+}
+
+func selectFields(object map[string]json.RawMessage, fields map[string]bool) map[string]json.RawMessage {
+	selected := map[string]json.RawMessage{}
+	for key, value := range object {
+		if fields[key] {
+			selected[key] = value
+		}
+	}
+	return selected
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// watchTimeout bounds how long a watching request waits for a change before
+// it answers with the unchanged listing.
+const watchTimeout = 30 * time.Second
+
+const (
+	watchTopicCharts = "charts"
+	watchTopicDeploy = "deploys:" // Followed by the chart ID
+	watchTopicEvents = "events:"  // Followed by the subject
+)
+
+// watchTopic counts the changes of a listing. Cursors are only meaningful
+// within one server process, so they carry the time it started.
+type watchTopic struct {
+	version uint64
+	changed chan struct{} // Closed on the next change
+}
+
+var watchTopics = struct {
+	mu     sync.Mutex
+	epoch  string
+	topics map[string]*watchTopic
+}{
+	epoch:  strconv.FormatInt(time.Now().UnixNano(), 36),
+	topics: map[string]*watchTopic{},
+}
+
+// publishChange wakes the requests watching the topics.
+func publishChange(topics ...string) {
+	watchTopics.mu.Lock()
+	defer watchTopics.mu.Unlock()
+
+	for _, name := range topics {
+		topic := watchTopicLocked(name)
+		topic.version++
+		close(topic.changed)
+		topic.changed = make(chan struct{})
+	}
+}
+
+// publishChartChange marks the chart listing and the deploy state of the
+// chart as changed, after the chart was created, deleted, archived or
+// committed to.
+func publishChartChange(chartID string) {
+	publishChange(watchTopicCharts, watchTopicDeploy+chartID)
+}
+
+// watchChanges implements ?watch=true&since=<cursor> on listings: when since
+// is the current cursor of the topic, it blocks until the topic changes or
+// watchTimeout passes. It sets X-Watch-Cursor to the cursor the listing is
+// current as of, and returns false when the client went away while waiting.
+func watchChanges(w http.ResponseWriter, r *http.Request, topic string) bool {
+	cursor, changed := watchCursor(topic)
+	query := r.URL.Query()
+	if query.Get("watch") == "true" && query.Get("since") == cursor {
+		timer := time.NewTimer(watchTimeout)
+		defer timer.Stop()
+		select {
+		case <-changed:
+		case <-timer.C:
+		case <-r.Context().Done():
+			return false
+		}
+		cursor, _ = watchCursor(topic)
+	}
+
+	w.Header().Set("X-Watch-Cursor", cursor)
+	return true
+}
+
+func watchCursor(name string) (string, <-chan struct{}) {
+	watchTopics.mu.Lock()
+	defer watchTopics.mu.Unlock()
+
+	topic := watchTopicLocked(name)
+	return watchTopics.epoch + "." + strconv.FormatUint(topic.version, 10), topic.changed
+}
+
+func watchTopicLocked(name string) *watchTopic {
+	topic, ok := watchTopics.topics[name]
+	if !ok {
+		topic = &watchTopic{changed: make(chan struct{})}
+		watchTopics.topics[name] = topic
+	}
+	return topic
+}